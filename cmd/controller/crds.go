@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/deploy/crds"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// crdFieldOwner is the field manager of the CRDs applied by the controller.
+const crdFieldOwner = "origin-ca-issuer"
+
+// crdEstablishTimeout is how long installed CRDs are waited on to be served
+// by the apiserver.
+const crdEstablishTimeout = time.Minute
+
+// loadCRDs returns the CRD manifests embedded in the controller.
+func loadCRDs(manifests fs.FS) ([]*unstructured.Unstructured, error) {
+	paths, err := fs.Glob(manifests, "*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, path := range paths {
+		data, err := fs.ReadFile(manifests, path)
+		if err != nil {
+			return nil, err
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		if obj.GetKind() != "CustomResourceDefinition" {
+			return nil, fmt.Errorf("decoding %s: expected a CustomResourceDefinition, got %q", path, obj.GetKind())
+		}
+
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+// installCRDs applies the embedded CRDs with server-side apply, taking over
+// the fields set by previous installs such as with kubectl, then waits for
+// the apiserver to serve them.
+func installCRDs(ctx context.Context, c client.Client) error {
+	objs, err := loadCRDs(crds.FS)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(crdFieldOwner), client.ForceOwnership); err != nil {
+			return fmt.Errorf("applying CRD %s: %w", obj.GetName(), err)
+		}
+	}
+
+	for _, obj := range objs {
+		err := wait.PollUntilContextTimeout(ctx, time.Second, crdEstablishTimeout, true, func(ctx context.Context) (bool, error) {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return false, err
+			}
+
+			return crdEstablished(obj), nil
+		})
+		if err != nil {
+			return fmt.Errorf("waiting for CRD %s to be established: %w", obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// crdEstablished reports whether the CRD has an Established condition that
+// is True.
+func crdEstablished(obj *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+
+	return false
+}
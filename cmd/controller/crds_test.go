@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/cloudflare/origin-ca-issuer/deploy/crds"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLoadCRDs(t *testing.T) {
+	objs, err := loadCRDs(crds.FS)
+	assert.NilError(t, err)
+
+	var names []string
+	for _, obj := range objs {
+		names = append(names, obj.GetName())
+	}
+	assert.DeepEqual(t, names, []string{
+		"clusteroriginissuers.cert-manager.k8s.cloudflare.com",
+		"originissuers.cert-manager.k8s.cloudflare.com",
+	})
+
+	_, err = loadCRDs(fstest.MapFS{
+		"role.yaml": {Data: []byte("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\n")},
+	})
+	assert.Error(t, err, `decoding role.yaml: expected a CustomResourceDefinition, got "ClusterRole"`)
+}
+
+func TestCRDEstablished(t *testing.T) {
+	crd := func(status string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+					map[string]interface{}{"type": "Established", "status": status},
+				},
+			},
+		}}
+	}
+
+	assert.Assert(t, crdEstablished(crd("True")))
+	assert.Assert(t, !crdEstablished(crd("False")))
+	assert.Assert(t, !crdEstablished(&unstructured.Unstructured{Object: map[string]interface{}{}}))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Exit codes of the controller, distinguishing misconfiguration from
+// crashes. Invalid flags share the exit code of flag parsing errors.
+const (
+	exitError       = 1
+	exitConfig      = 2
+	exitForbidden   = 3
+	exitCRDsMissing = 4
+)
+
+// exitReasons are the reasons of the termination message of each exit code.
+var exitReasons = map[int]string{
+	exitError:       "Error",
+	exitConfig:      "InvalidConfiguration",
+	exitForbidden:   "Forbidden",
+	exitCRDsMissing: "CRDsMissing",
+}
+
+// terminationLogPath is where the kubelet reads the termination message of
+// the container from. It is only written if it exists, such as when running
+// in a pod.
+var terminationLogPath = "/dev/termination-log"
+
+// terminationMessage is written to the termination log when exiting.
+type terminationMessage struct {
+	Reason   string `json:"reason"`
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message"`
+	Error    string `json:"error"`
+}
+
+// exit logs the error, writes it to the termination log, and exits with the
+// code.
+func exit(log logr.Logger, code int, err error, msg string) {
+	log.Error(err, msg)
+
+	if err := writeTerminationMessage(terminationLogPath, code, err, msg); err != nil {
+		log.Error(err, "could not write termination message")
+	}
+
+	os.Exit(code)
+}
+
+func writeTerminationMessage(path string, code int, err error, msg string) error {
+	f, ferr := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if errors.Is(ferr, os.ErrNotExist) {
+		return nil
+	}
+	if ferr != nil {
+		return ferr
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(terminationMessage{
+		Reason:   exitReasons[code],
+		ExitCode: code,
+		Message:  msg,
+		Error:    err.Error(),
+	})
+}
+
+// exitCode returns the exit code of an error from the apiserver: requests
+// the controller's RBAC role does not allow, or resources whose CRD is not
+// installed, are reported as such.
+func exitCode(err error) int {
+	switch {
+	case apierrors.IsForbidden(err):
+		return exitForbidden
+	case meta.IsNoMatchError(err), apierrors.IsNotFound(err):
+		return exitCRDsMissing
+	}
+
+	return exitError
+}
+
+// preflight lists each resource the controller reconciles, so that missing
+// CRDs or permissions fail startup with a clear exit code rather than
+// leaving the controller's caches waiting to sync.
+func preflight(ctx context.Context, c client.Reader) (int, error) {
+	lists := []client.ObjectList{
+		&v1.OriginIssuerList{},
+		&v1.ClusterOriginIssuerList{},
+		&certmanager.CertificateRequestList{},
+	}
+
+	for _, list := range lists {
+		if err := c.List(ctx, list, client.Limit(1)); err != nil {
+			return exitCode(err), fmt.Errorf("listing %T: %w", list, err)
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestExitCode(t *testing.T) {
+	resource := schema.GroupResource{Group: "cert-manager.k8s.cloudflare.com", Resource: "originissuers"}
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{
+			name: "forbidden",
+			err:  apierrors.NewForbidden(resource, "", errors.New("denied")),
+			code: exitForbidden,
+		},
+		{
+			name: "no kind match",
+			err:  &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "cert-manager.k8s.cloudflare.com", Kind: "OriginIssuer"}},
+			code: exitCRDsMissing,
+		},
+		{
+			name: "resource not found",
+			err:  apierrors.NewNotFound(resource, ""),
+			code: exitCRDsMissing,
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection refused"),
+			code: exitError,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, exitCode(tt.err), tt.code)
+		})
+	}
+}
+
+func TestWriteTerminationMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	// Nothing is written outside of a pod.
+	assert.NilError(t, writeTerminationMessage(path, exitConfig, errors.New("bad flag"), "error validating options"))
+	_, err := os.Stat(path)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist), "expected no termination log, got %v", err)
+
+	assert.NilError(t, os.WriteFile(path, nil, 0o600))
+	assert.NilError(t, writeTerminationMessage(path, exitConfig, errors.New("bad flag"), "error validating options"))
+
+	data, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), `{"reason":"InvalidConfiguration","exitCode":2,"message":"error validating options","error":"bad flag"}`+"\n")
+}
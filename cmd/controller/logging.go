@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zerologr"
+	"github.com/rs/zerolog"
+)
+
+// newLogger returns the logger of the controller, writing JSON lines, or
+// human readable ones for the text format, at the level and above. Invalid
+// values are left for the options' validation to report, falling back to
+// JSON at the info level so that the report is logged.
+func newLogger(w io.Writer, format, level string) zerolog.Logger {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil || lvl == zerolog.NoLevel {
+		lvl = zerolog.InfoLevel
+	}
+
+	if format == "text" {
+		w = zerolog.ConsoleWriter{Out: w, NoColor: true, TimeFormat: time.RFC3339}
+	}
+
+	return zerolog.New(w).Level(lvl).With().Caller().Timestamp().Logger()
+}
+
+// newLogr returns a logr.Logger writing to the zerolog logger, with the
+// verbosity of messages mapped onto its levels by verbositySink.
+func newLogr(zl *zerolog.Logger) logr.Logger {
+	return logr.New(verbositySink{zerologr.NewLogSink(zl)})
+}
+
+// debugVerbosity is the highest verbosity logged at the debug level. The
+// controllers log their debug messages at V(4).
+const debugVerbosity = 4
+
+// verbositySink logs V(0) messages at the info level, up to V(4) at the
+// debug level and anything more verbose at the trace level. zerologr maps
+// V(n) to the zerolog level 1-n, and drops anything more verbose than V(2),
+// so that the log-level flag would otherwise never show the controllers'
+// debug messages.
+type verbositySink struct {
+	sink *zerologr.LogSink
+}
+
+func verbosity(level int) int {
+	switch {
+	case level <= 0:
+		return 0
+	case level <= debugVerbosity:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (s verbositySink) Init(info logr.RuntimeInfo) {
+	// Account for the frame of the wrapper when reporting the caller.
+	info.CallDepth++
+	s.sink.Init(info)
+}
+
+func (s verbositySink) Enabled(level int) bool {
+	return s.sink.Enabled(verbosity(level))
+}
+
+func (s verbositySink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(verbosity(level), msg, keysAndValues...)
+}
+
+func (s verbositySink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.sink.Error(err, msg, keysAndValues...)
+}
+
+func (s verbositySink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return verbositySink{s.sink.WithValues(keysAndValues...).(*zerologr.LogSink)}
+}
+
+func (s verbositySink) WithName(name string) logr.LogSink {
+	return verbositySink{s.sink.WithName(name).(*zerologr.LogSink)}
+}
+
+func (s verbositySink) WithCallDepth(depth int) logr.LogSink {
+	return verbositySink{s.sink.WithCallDepth(depth).(*zerologr.LogSink)}
+}
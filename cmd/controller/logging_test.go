@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/zerologr"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	zl := newLogger(&buf, "json", "info")
+	log := zerologr.New(&zl)
+
+	log.V(1).Info("debug")
+	log.Info("reconciled", "issuer_name", "foo")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, len(lines), 1, buf.String())
+
+	var line map[string]interface{}
+	assert.NilError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, line["message"], "reconciled")
+	assert.Equal(t, line["issuer_name"], "foo")
+
+	buf.Reset()
+	zl = newLogger(&buf, "text", "debug")
+	log = zerologr.New(&zl)
+
+	log.V(1).Info("debug", "issuer_name", "foo")
+	assert.Assert(t, strings.Contains(buf.String(), "debug"), buf.String())
+	assert.Assert(t, strings.Contains(buf.String(), "issuer_name=foo"), buf.String())
+	assert.Assert(t, !strings.HasPrefix(buf.String(), "{"), "expected text, got %s", buf.String())
+
+	// Invalid values fall back to the info level.
+	buf.Reset()
+	zl = newLogger(&buf, "yaml", "verbose")
+	log = zerologr.New(&zl)
+
+	log.V(1).Info("debug")
+	log.Info("info")
+	assert.Equal(t, strings.Count(buf.String(), "\n"), 1, buf.String())
+	assert.Assert(t, strings.HasPrefix(buf.String(), "{"), "expected JSON, got %s", buf.String())
+}
+
+func TestNewLogrVerbosity(t *testing.T) {
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{level: "info", want: []string{"info"}},
+		{level: "debug", want: []string{"info", "debug"}},
+		{level: "trace", want: []string{"info", "debug", "trace"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			zl := newLogger(&buf, "json", tt.level)
+			log := newLogr(&zl).WithName("origin-issuer")
+
+			log.Info("info")
+			log.V(4).Info("debug")
+			log.V(8).Info("trace")
+
+			var got []string
+			for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var line map[string]interface{}
+				assert.NilError(t, json.Unmarshal([]byte(l), &line))
+				assert.Equal(t, line["logger"], "origin-issuer")
+				assert.Assert(t, strings.Contains(line["caller"].(string), "logging_test.go"), line["caller"])
+				got = append(got, line["message"].(string))
+			}
+			assert.DeepEqual(t, got, tt.want)
+		})
+	}
+}
@@ -1,29 +1,54 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/cloudflare/origin-ca-issuer/cmd/controller/options"
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/audit"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/certcache"
 	"github.com/cloudflare/origin-ca-issuer/pkgs/controllers"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/istiocsr"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/metrics"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/webhook"
 	"github.com/go-logr/zerologr"
 	"github.com/rs/zerolog"
 	"github.com/spf13/pflag"
+	certificates "k8s.io/api/certificates/v1"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
+// shutdownReturnTimeout is how long reconciles cancelled at the end of the
+// shutdown grace period have to return before the controller exits anyway.
+const shutdownReturnTimeout = 5 * time.Second
+
 func main() {
 	fs := pflag.CommandLine
 	o := options.NewControllerOptions()
@@ -35,107 +60,498 @@ func main() {
 	zerologr.NameFieldName = "logger"
 	zerologr.NameSeparator = "/"
 
-	zl := zerolog.New(os.Stderr).With().Caller().Timestamp().Logger()
-	logf.SetLogger(zerologr.New(&zl))
-	log := logf.Log.WithName("origin-issuer").V(8)
+	zl := newLogger(os.Stderr, o.LogFormat, o.LogLevel)
+	logf.SetLogger(newLogr(&zl))
+	log := logf.Log.WithName("origin-issuer")
 
 	if err := o.Validate(); err != nil {
-		log.Error(err, "error validating options")
-		os.Exit(1)
+		exit(log, exitConfig, err, "error validating options")
 	}
 
 	scheme := runtime.NewScheme()
 	if err := clientgoscheme.AddToScheme(scheme); err != nil {
-		log.Error(err, "could not add to scheme")
-		os.Exit(1)
+		exit(log, exitError, err, "could not add to scheme")
 	}
 	if err := certmanager.AddToScheme(scheme); err != nil {
-		log.Error(err, "could not add to scheme")
-		os.Exit(1)
+		exit(log, exitError, err, "could not add to scheme")
 	}
 	if err := v1.AddToScheme(scheme); err != nil {
-		log.Error(err, "could not add to scheme")
-		os.Exit(1)
+		exit(log, exitError, err, "could not add to scheme")
 	}
 
+	ctx := signals.SetupSignalHandler()
+
 	kubeCfg, err := config.GetConfig()
 	if err != nil {
-		log.Error(err, "could not load kubeconfig")
-		os.Exit(1)
+		exit(log, exitConfig, err, "could not load kubeconfig")
 	}
 
 	kubeCfg.QPS = o.KubernetesAPIQPS
 	kubeCfg.Burst = o.KubernetesAPIBurst
 
-	mgr, err := manager.New(kubeCfg, manager.Options{
-		Scheme: scheme,
-	})
+	// The manager waits for reconciles in flight to drain for the grace
+	// period, and for them to return once cancelled at its end.
+	gracefulShutdownTimeout := o.ShutdownGracePeriod + shutdownReturnTimeout
+
+	mgrOpts := manager.Options{
+		Scheme:                  scheme,
+		HealthProbeBindAddress:  o.HealthProbeBindAddress,
+		PprofBindAddress:        o.ProfilerAddress,
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
+	}
+
+	// SIGHUP, or a POST to the kick endpoint, re-verifies every issuer and
+	// retries pending and failed CertificateRequests at once.
+	kicker := &controllers.Kicker{
+		Clock: clock.RealClock{},
+		Log:   log.WithName("kicker"),
+	}
+	if o.KickEndpoint {
+		mgrOpts.Metrics.ExtraHandlers = map[string]http.Handler{"/kick": kicker}
+	}
+
+	if o.StripCompletedCertificateRequests {
+		mgrOpts.Cache.ByObject = map[client.Object]cache.ByObject{
+			&certmanager.CertificateRequest{}: {Transform: controllers.StripCompletedCertificateRequest},
+		}
+	}
+
+	// Reads are sent to the read-only apiserver proxy, if any, while
+	// writes are always sent to the apiserver.
+	readCfg := kubeCfg
+	if o.ReadAPIServerURL != "" {
+		readCfg = rest.CopyConfig(kubeCfg)
+		readCfg.Host = o.ReadAPIServerURL
+
+		mgrOpts.NewCache = func(_ *rest.Config, opts cache.Options) (cache.Cache, error) {
+			// The manager's HTTP client is bound to the apiserver.
+			opts.HTTPClient = nil
+			return cache.New(readCfg, opts)
+		}
+	}
+
+	if o.WebhookPort > 0 {
+		mgrOpts.WebhookServer = ctrlwebhook.NewServer(ctrlwebhook.Options{
+			Port:    o.WebhookPort,
+			CertDir: o.WebhookCertDir,
+		})
+	}
+
+	mgr, err := manager.New(kubeCfg, mgrOpts)
+	if err != nil {
+		exit(log, exitError, err, "could not create manager")
+	}
+
+	// Uncached reads, such as of issuer secrets, are rate limited apart from
+	// the manager's client when given their own limits, so that bursts of
+	// reads during mass renewals don't delay status updates.
+	reader := mgr.GetAPIReader()
+	if o.ReadAPIServerURL != "" || o.KubernetesAPIReaderQPS > 0 || o.KubernetesAPIReaderBurst > 0 {
+		readerCfg := rest.CopyConfig(readCfg)
+		if o.KubernetesAPIReaderQPS > 0 {
+			readerCfg.QPS = o.KubernetesAPIReaderQPS
+		}
+		if o.KubernetesAPIReaderBurst > 0 {
+			readerCfg.Burst = o.KubernetesAPIReaderBurst
+		}
+
+		reader, err = client.New(readerCfg, client.Options{
+			Scheme: scheme,
+			Mapper: mgr.GetRESTMapper(),
+		})
+		if err != nil {
+			exit(log, exitError, err, "could not create apiserver reader")
+		}
+	}
+
+	// CRDs are installed before anything watches or indexes the resources
+	// they define.
+	if o.InstallCRDs {
+		if err := installCRDs(ctx, mgr.GetClient()); err != nil {
+			exit(log, exitCode(err), err, "could not install CRDs")
+		}
+	}
+
+	transportOpts := cfapi.TransportOptions{
+		Timeout: o.CFAPITimeout,
+		CAFile:  o.CFAPICAFile,
+	}
+	if o.CFAPIProxyURL != "" {
+		// validated by o.Validate
+		transportOpts.ProxyURL, _ = url.Parse(o.CFAPIProxyURL)
+	}
+
+	httpClient, err := cfapi.NewHTTPClient(transportOpts)
 	if err != nil {
-		log.Error(err, "could not create manager")
-		os.Exit(1)
+		exit(log, exitConfig, err, "could not configure Cloudflare API transport")
 	}
+	retryPolicy := cfapi.DefaultRetryPolicy()
+	retryPolicy.MaxRetries = o.CFAPIRetryMax
+	// validated by o.Validate
+	errorClasses, _ := cfapi.ParseErrorClasses(o.CFAPIErrorClasses)
+	retryPolicy = retryPolicy.WithErrorClasses(errorClasses)
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
+	clientOpts := []cfapi.Options{
+		cfapi.WithClient(httpClient),
+		cfapi.WithRetryPolicy(retryPolicy),
+		cfapi.WithRateLimiters(cfapi.NewRateLimiters()),
+		cfapi.WithZoneCache(cfapi.DefaultZoneCacheTTL),
 	}
-	f := cfapi.FactoryFunc(func(serviceKey []byte) (cfapi.Interface, error) {
-		return cfapi.New(serviceKey, cfapi.WithClient(httpClient)), nil
+
+	if len(o.CFAPIEndpoints) > 0 {
+		endpoints, err := cfapi.NewEndpoints(o.CFAPIEndpoints, o.CFAPIEndpointCooldown)
+		if err != nil {
+			exit(log, exitConfig, err, "could not configure Cloudflare API endpoints")
+		}
+
+		clientOpts = append(clientOpts, cfapi.WithEndpoints(endpoints))
+
+		if o.CFAPIEndpointHealthInterval > 0 {
+			if err := mgr.Add(cfapi.NewEndpointHealthCheck(endpoints, httpClient, o.CFAPIEndpointHealthInterval, clock.RealClock{})); err != nil {
+				exit(log, exitError, err, "could not add Cloudflare API endpoint health check")
+			}
+		}
+	}
+
+	factory, err := cfapi.NewFactory(o.CFAPIFactory, o.CFAPIFactoryConfig, clientOpts...)
+	if err != nil {
+		exit(log, exitConfig, err, "could not create Cloudflare API client factory")
+	}
+
+	factory = cfapi.WithClientCache(factory, cfapi.DefaultClientIdleTimeout, clock.RealClock{})
+	factory = cfapi.WithAllowedEndpoints(factory, o.IssuerCFAPIURLs)
+	f := cfapi.WithMiddleware(factory, cfapi.Logging(logf.Log.WithName("cfapi").V(4)))
+
+	exchangeClient, err := cfapi.NewHTTPClient(cfapi.TransportOptions{
+		Timeout: o.CFAPITimeout,
+		CAFile:  o.TokenExchangeCAFile,
+	})
+	if err != nil {
+		exit(log, exitConfig, err, "could not configure token exchange transport")
+	}
+	tokens := tokenexchange.NewTokenSource(mgr.GetClient(), mgr.GetAPIReader(), tokenexchange.DefaultTokenExpiration)
+	exchanger := tokenexchange.New(tokens, exchangeClient, clock.RealClock{}, o.TokenExchangeURLs)
+
+	vaultClient, err := cfapi.NewHTTPClient(cfapi.TransportOptions{
+		Timeout: o.CFAPITimeout,
+		CAFile:  o.VaultCAFile,
 	})
+	if err != nil {
+		exit(log, exitConfig, err, "could not configure vault transport")
+	}
+	vc := vault.New(tokens, vaultClient, clock.RealClock{}, o.VaultAddresses)
+
+	if err := controllers.SetupIndexes(ctx, mgr.GetFieldIndexer()); err != nil {
+		exit(log, exitError, err, "could not setup field indexes")
+	}
+
+	controllerOpts := controller.Options{MaxConcurrentReconciles: o.MaxConcurrentReconciles}
+
+	issuerController := &controllers.OriginIssuerController{
+		Client:   mgr.GetClient(),
+		Reader:   reader,
+		Clock:    clock.RealClock{},
+		Factory:  f,
+		Recorder: mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:      log.WithName("controllers").WithName("OriginIssuer"),
+
+		Exchanger: exchanger,
+		Vault:     vc,
 
+		CertificateCountInterval: o.CertificateCountInterval,
+		DryRun:                   o.DryRun,
+	}
+
+	// Issuers are reconciled when their spec changes, rather than on
+	// their own status updates, which would otherwise verify them with
+	// the Cloudflare API again at once. Secrets, the kicker and the
+	// certificate count interval reconcile them otherwise.
 	err = builder.
 		ControllerManagedBy(mgr).
-		For(&v1.OriginIssuer{}).
-		Complete(reconcile.AsReconciler(mgr.GetClient(), &controllers.OriginIssuerController{
-			Client:  mgr.GetClient(),
-			Reader:  mgr.GetAPIReader(),
-			Clock:   clock.RealClock{},
-			Factory: f,
-			Log:     log.WithName("controllers").WithName("OriginIssuer"),
-		}))
+		For(&v1.OriginIssuer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controllerOpts).
+		WatchesMetadata(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(issuerController.SecretToIssuers)).
+		WatchesRawSource(kicker.OriginIssuerSource(), &handler.EnqueueRequestForObject{}).
+		Complete(reconcile.AsReconciler(mgr.GetClient(), issuerController))
 
 	if err != nil {
-		log.Error(err, "could not create origin issuer controller")
-		os.Exit(1)
+		exit(log, exitError, err, "could not create origin issuer controller")
+	}
+
+	clusterIssuerController := &controllers.ClusterOriginIssuerController{
+		Client:                   mgr.GetClient(),
+		Reader:                   reader,
+		ClusterResourceNamespace: o.ClusterResourceNamespace,
+		Clock:                    clock.RealClock{},
+		Factory:                  f,
+		Recorder:                 mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:                      log.WithName("controllers").WithName("ClusterOriginIssuer"),
+
+		Exchanger: exchanger,
+		Vault:     vc,
+
+		CertificateCountInterval: o.CertificateCountInterval,
+		DryRun:                   o.DryRun,
 	}
 
 	err = builder.
 		ControllerManagedBy(mgr).
-		For(&v1.ClusterOriginIssuer{}).
-		Complete(reconcile.AsReconciler(mgr.GetClient(), &controllers.ClusterOriginIssuerController{
-			Client:                   mgr.GetClient(),
-			Reader:                   mgr.GetAPIReader(),
-			ClusterResourceNamespace: o.ClusterResourceNamespace,
-			Clock:                    clock.RealClock{},
-			Factory:                  f,
-			Log:                      log.WithName("controllers").WithName("ClusterOriginIssuer"),
-		}))
+		For(&v1.ClusterOriginIssuer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controllerOpts).
+		WatchesMetadata(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(clusterIssuerController.SecretToIssuers)).
+		WatchesRawSource(kicker.ClusterOriginIssuerSource(), &handler.EnqueueRequestForObject{}).
+		Complete(reconcile.AsReconciler(mgr.GetClient(), clusterIssuerController))
+
+	if err != nil {
+		exit(log, exitError, err, "could not create cluster origin issuer controller")
+	}
+
+	var cache *certcache.Cache
+	if o.CertificateCachePath != "" {
+		cache, err = certcache.Open(o.CertificateCachePath, clock.RealClock{})
+		if err != nil {
+			exit(log, exitConfig, err, "could not open certificate cache")
+		}
+		cache.MaxEntries = o.CertificateCacheMaxEntries
+	}
+
+	var sinks []audit.Sink
+	for _, spec := range o.AuditSinks {
+		sink, err := audit.NewSink(spec, mgr.GetEventRecorderFor("origin-ca-issuer"))
+		if err != nil {
+			exit(log, exitConfig, err, "could not create audit sink")
+		}
+
+		sinks = append(sinks, sink)
+	}
 
+	roots := cfapi.NewRootStore(httpClient, cfapi.RootURLs)
+	embedded, err := cfapi.EmbeddedRoots()
 	if err != nil {
-		log.Error(err, "could not create cluster origin issuer controller")
-		os.Exit(1)
+		exit(log, exitConfig, err, "could not read vendored Origin CA roots")
+	}
+	roots.Pin(embedded)
+	for requestType := range cfapi.RootURLs {
+		if _, ok := embedded[requestType]; !ok {
+			log.Info("no vendored Origin CA root, fetching it from Cloudflare on first use", "requestType", requestType)
+		}
+	}
+	if o.OriginCARootsDir != "" {
+		overrides, err := cfapi.LoadRoots(o.OriginCARootsDir)
+		if err != nil {
+			exit(log, exitConfig, err, "could not read Origin CA roots")
+		}
+		roots.Pin(overrides)
+	}
+
+	var messageTemplates controllers.MessageTemplates
+	if o.MessageTemplatesDir != "" {
+		messageTemplates, err = controllers.LoadMessageTemplates(o.MessageTemplatesDir)
+		if err != nil {
+			exit(log, exitConfig, err, "could not read message templates")
+		}
+	}
+
+	crController := &controllers.CertificateRequestController{
+		Client:                   mgr.GetClient(),
+		Reader:                   reader,
+		ClusterResourceNamespace: o.ClusterResourceNamespace,
+		Factory:                  f,
+		Recorder:                 mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:                      log.WithName("controllers").WithName("CertificateRequest"),
+
+		Clock:                  clock.RealClock{},
+		CheckApprovedCondition: !o.DisableApprovedCheck,
+		SignTimeout:            o.SignTimeout,
+		ShutdownGracePeriod:    o.ShutdownGracePeriod,
+		DefaultDuration:        o.DefaultDuration,
+		AuthFailureTTL:         o.AuthFailureTTL,
+		MaxRetriesBeforeFail:   o.MaxRetriesBeforeFail,
+		RevokeOnDelete:         o.RevokeOnDelete,
+		RevokeDryRun:           o.RevokeDryRun || o.DryRun,
+		ReuseCertificates:      o.ReuseCertificates,
+		DryRun:                 o.DryRun,
+		Roots:                  roots,
+		PopulateCA:             o.PopulateCA,
+		Cache:                  cache,
+		Exchanger:              exchanger,
+		Vault:                  vc,
+		TenantKey:              o.TenantKey,
+		AttributionKeys:        o.AttributionKeys,
+		DefaultClusterIssuer:   o.DefaultClusterIssuer,
+		DefaultIssuerFallback:  o.DefaultIssuerFallback,
+		MessageTemplates:       messageTemplates,
+	}
+	if len(sinks) > 0 {
+		crController.Audit = audit.Multi(sinks...)
+	}
+	if len(o.AttributionMetricValues) > 0 {
+		// validated by o.Validate
+		crController.AttributionMetricValues = make(map[string][]string)
+		for _, value := range o.AttributionMetricValues {
+			key, value, _ := strings.Cut(value, "=")
+			crController.AttributionMetricValues[key] = append(crController.AttributionMetricValues[key], value)
+		}
 	}
 
 	err = builder.
 		ControllerManagedBy(mgr).
 		For(&certmanager.CertificateRequest{}).
-		Complete(reconcile.AsReconciler(mgr.GetClient(), &controllers.CertificateRequestController{
+		WithOptions(controllerOpts).
+		Watches(&v1.OriginIssuer{}, handler.EnqueueRequestsFromMapFunc(crController.IssuerToRequests)).
+		Watches(&v1.ClusterOriginIssuer{}, handler.EnqueueRequestsFromMapFunc(crController.IssuerToRequests)).
+		WatchesRawSource(kicker.CertificateRequestSource(), &handler.EnqueueRequestForObject{}).
+		Complete(reconcile.AsReconciler(mgr.GetClient(), crController))
+
+	if err != nil {
+		exit(log, exitError, err, "could not create certificaterequest controller")
+	}
+
+	kicker.Client = mgr.GetClient()
+	kicker.CertificateRequests = crController
+	if err := mgr.Add(kicker); err != nil {
+		exit(log, exitError, err, "could not add kicker")
+	}
+
+	if o.Approver {
+		approver := &controllers.CertificateRequestApprover{
+			Client:   mgr.GetClient(),
+			Clock:    clock.RealClock{},
+			Recorder: mgr.GetEventRecorderFor("origin-ca-issuer"),
+			Log:      log.WithName("controllers").WithName("Approver"),
+
+			Namespaces: o.ApproverNamespaces,
+			DNSZones:   o.ApproverDNSZones,
+			DryRun:     o.DryRun,
+		}
+
+		err = builder.
+			ControllerManagedBy(mgr).
+			Named("approver").
+			For(&certmanager.CertificateRequest{}).
+			WithOptions(controllerOpts).
+			Complete(reconcile.AsReconciler(mgr.GetClient(), approver))
+
+		if err != nil {
+			exit(log, exitError, err, "could not create certificaterequest approver")
+		}
+	}
+
+	if o.CertificateSigningRequests {
+		csrController := &controllers.CertificateSigningRequestController{
 			Client:                   mgr.GetClient(),
-			Reader:                   mgr.GetAPIReader(),
+			Reader:                   reader,
 			ClusterResourceNamespace: o.ClusterResourceNamespace,
 			Factory:                  f,
-			Log:                      log.WithName("controllers").WithName("CertificateRequest"),
+			Recorder:                 mgr.GetEventRecorderFor("origin-ca-issuer"),
+			Log:                      log.WithName("controllers").WithName("CertificateSigningRequest"),
 
-			Clock:                  clock.RealClock{},
-			CheckApprovedCondition: !o.DisableApprovedCheck,
-		}))
+			Clock:                clock.RealClock{},
+			DefaultDuration:      o.DefaultDuration,
+			ShutdownGracePeriod:  o.ShutdownGracePeriod,
+			Exchanger:            exchanger,
+			Vault:                vc,
+			DefaultClusterIssuer: o.DefaultClusterIssuer,
+			MessageTemplates:     messageTemplates,
+		}
 
-	if err != nil {
-		log.Error(err, "could not create certificaterequest controller")
-		os.Exit(1)
+		err = builder.
+			ControllerManagedBy(mgr).
+			For(&certificates.CertificateSigningRequest{}).
+			WithOptions(controllerOpts).
+			Complete(reconcile.AsReconciler(mgr.GetClient(), csrController))
+
+		if err != nil {
+			exit(log, exitError, err, "could not create certificatesigningrequest controller")
+		}
+	}
+
+	if o.IstioCSRPort > 0 {
+		istioCSR := &istiocsr.Server{
+			Signer: &controllers.ClusterIssuerSigner{
+				Client:                   mgr.GetClient(),
+				Reader:                   reader,
+				ClusterResourceNamespace: o.ClusterResourceNamespace,
+				Factory:                  f,
+				Clock:                    clock.RealClock{},
+				Exchanger:                exchanger,
+				Vault:                    vc,
+				DefaultDuration:          o.DefaultDuration,
+			},
+			Authenticator: &istiocsr.TokenReviewAuthenticator{Client: mgr.GetClient()},
+			Roots:         roots,
+			Log:           log.WithName("istiocsr"),
+			Issuer:        o.IstioCSRIssuer,
+			Domain:        o.IstioCSRDomain,
+			TrustDomain:   o.IstioCSRTrustDomain,
+			Addr:          fmt.Sprintf(":%d", o.IstioCSRPort),
+			CertDir:       o.IstioCSRCertDir,
+			Clock:         clock.RealClock{},
+
+			ShutdownGracePeriod: o.ShutdownGracePeriod,
+		}
+
+		if err := mgr.Add(istioCSR); err != nil {
+			exit(log, exitError, err, "could not add Istio CA API server")
+		}
+	}
+
+	if o.WebhookPort > 0 {
+		if err := webhook.SetupWithManager(mgr, v1.RequestType(o.WebhookDefaultRequestType)); err != nil {
+			exit(log, exitError, err, "could not create origin issuer webhook")
+		}
+	}
+
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		exit(log, exitError, err, "could not add health check")
+	}
+
+	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		exit(log, exitError, err, "could not add readiness check")
+	}
+
+	if o.BackpressureMaxQueueDepth > 0 || o.BackpressureMaxErrorRate > 0 {
+		backpressure := &metrics.Backpressure{
+			MaxQueueDepth: o.BackpressureMaxQueueDepth,
+			MaxErrorRate:  o.BackpressureMaxErrorRate,
+			Interval:      30 * time.Second,
+			Gatherer:      ctrlmetrics.Registry,
+			Clock:         clock.RealClock{},
+			Log:           log.WithName("backpressure"),
+		}
+
+		if err := mgr.Add(backpressure); err != nil {
+			exit(log, exitError, err, "could not add backpressure monitor")
+		}
+
+		if err := mgr.AddReadyzCheck("backpressure", backpressure.Check); err != nil {
+			exit(log, exitError, err, "could not add backpressure readiness check")
+		}
+	}
+
+	// Renewing Certificates on a root rotation would issue certificates.
+	if o.RootRotationCheckInterval > 0 && !o.DryRun {
+		watcher := &controllers.RootRotationWatcher{
+			Client:   mgr.GetClient(),
+			Roots:    roots,
+			Recorder: mgr.GetEventRecorderFor("origin-ca-issuer"),
+			Interval: o.RootRotationCheckInterval,
+			Clock:    clock.RealClock{},
+			Log:      log.WithName("controllers").WithName("RootRotation"),
+
+			DefaultClusterIssuer: o.DefaultClusterIssuer,
+		}
+
+		if err := mgr.Add(watcher); err != nil {
+			exit(log, exitError, err, "could not add Origin CA root rotation watcher")
+		}
+	}
+
+	if code, err := preflight(ctx, reader); err != nil {
+		exit(log, code, err, "could not list the resources reconciled by the controller")
 	}
 
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
-		log.Error(err, "could not start manager")
-		os.Exit(1)
+	if err := mgr.Start(ctx); err != nil {
+		exit(log, exitCode(err), err, "could not start manager")
 	}
 }
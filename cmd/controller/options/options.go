@@ -2,8 +2,18 @@ package options
 
 import (
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/audit"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/istiocsr"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 type ControllerOptions struct {
@@ -11,26 +21,238 @@ type ControllerOptions struct {
 	KubernetesAPIBurst       int
 	ClusterResourceNamespace string
 
+	KubernetesAPIReaderQPS   float32
+	KubernetesAPIReaderBurst int
+
+	ReadAPIServerURL string
+
+	MaxConcurrentReconciles int
+
 	DisableApprovedCheck bool
+
+	Approver           bool
+	ApproverNamespaces []string
+	ApproverDNSZones   []string
+
+	SignTimeout         time.Duration
+	ShutdownGracePeriod time.Duration
+
+	DefaultDuration time.Duration
+
+	RevokeOnDelete bool
+	RevokeDryRun   bool
+
+	ReuseCertificates bool
+
+	DryRun bool
+
+	CertificateSigningRequests bool
+
+	PopulateCA bool
+
+	OriginCARootsDir string
+
+	MessageTemplatesDir string
+
+	RootRotationCheckInterval time.Duration
+
+	CFAPIRetryMax int
+
+	CFAPIErrorClasses map[string]string
+
+	CFAPIEndpoints        []string
+	CFAPIEndpointCooldown time.Duration
+
+	// IssuerCFAPIURLs are the Cloudflare API endpoints issuers may send
+	// their requests to with cloudflareAPIURL.
+	IssuerCFAPIURLs []string
+
+	// CFAPIEndpointHealthInterval is how often the Cloudflare API endpoints
+	// are probed, 0 disabling probes.
+	CFAPIEndpointHealthInterval time.Duration
+
+	CFAPIFactory       string
+	CFAPIFactoryConfig string
+
+	CFAPITimeout  time.Duration
+	CFAPIProxyURL string
+	CFAPICAFile   string
+
+	TokenExchangeURLs   []string
+	TokenExchangeCAFile string
+	VaultAddresses      []string
+	VaultCAFile         string
+
+	AuthFailureTTL time.Duration
+
+	MaxRetriesBeforeFail int
+
+	CertificateCachePath       string
+	CertificateCacheMaxEntries int
+
+	StripCompletedCertificateRequests bool
+
+	AuditSinks []string
+
+	TenantKey string
+
+	AttributionKeys         []string
+	AttributionMetricValues []string
+
+	DefaultClusterIssuer  string
+	DefaultIssuerFallback bool
+
+	CertificateCountInterval time.Duration
+
+	HealthProbeBindAddress string
+
+	ProfilerAddress string
+
+	KickEndpoint bool
+
+	InstallCRDs bool
+
+	LogFormat string
+	LogLevel  string
+
+	WebhookPort               int
+	WebhookCertDir            string
+	WebhookDefaultRequestType string
+
+	IstioCSRPort        int
+	IstioCSRCertDir     string
+	IstioCSRIssuer      string
+	IstioCSRDomain      string
+	IstioCSRTrustDomain string
+
+	BackpressureMaxQueueDepth int
+	BackpressureMaxErrorRate  float64
 }
 
 const (
-	defaultKubernetesAPIQPS   float32 = 20
-	defaultKubernetesAPIBurst int     = 50
+	defaultKubernetesAPIQPS      float32       = 20
+	defaultKubernetesAPIBurst    int           = 50
+	defaultSignTimeout           time.Duration = 30 * time.Second
+	defaultShutdownGracePeriod   time.Duration = 20 * time.Second
+	defaultCFAPIRetryMax         int           = 3
+	defaultCFAPIEndpointCooldown time.Duration = 30 * time.Second
+	defaultCFAPITimeout          time.Duration = 30 * time.Second
+	defaultDefaultDuration       time.Duration = 7 * 24 * time.Hour
+	defaultAuthFailureTTL        time.Duration = 30 * time.Second
+
+	defaultCertificateCountInterval time.Duration = time.Hour
+
+	defaultCFAPIEndpointHealthInterval time.Duration = 10 * time.Second
+
+	defaultMaxConcurrentReconciles int = 1
+
+	defaultHealthProbeBindAddress = ":8081"
+	defaultLogFormat              = "json"
+	defaultLogLevel               = "info"
+	defaultWebhookCertDir         = "/tmp/k8s-webhook-server/serving-certs"
+	defaultWebhookRequestType     = string(v1.RequestTypeOriginRSA)
+	defaultIstioCSRCertDir        = "/etc/origin-ca-issuer/istio-csr"
 )
 
+// logLevels are the supported values of the log-level flag.
+var logLevels = []string{"trace", "debug", "info", "warn", "error"}
+
 func NewControllerOptions() *ControllerOptions {
 	return &ControllerOptions{
-		KubernetesAPIQPS:   defaultKubernetesAPIQPS,
-		KubernetesAPIBurst: defaultKubernetesAPIBurst,
+		KubernetesAPIQPS:      defaultKubernetesAPIQPS,
+		KubernetesAPIBurst:    defaultKubernetesAPIBurst,
+		SignTimeout:           defaultSignTimeout,
+		ShutdownGracePeriod:   defaultShutdownGracePeriod,
+		DefaultDuration:       defaultDefaultDuration,
+		CFAPIRetryMax:         defaultCFAPIRetryMax,
+		CFAPIEndpointCooldown: defaultCFAPIEndpointCooldown,
+		CFAPIFactory:          cfapi.DefaultFactory,
+		CFAPITimeout:          defaultCFAPITimeout,
+		AuthFailureTTL:        defaultAuthFailureTTL,
+
+		CertificateCountInterval: defaultCertificateCountInterval,
+
+		CFAPIEndpointHealthInterval: defaultCFAPIEndpointHealthInterval,
+
+		MaxConcurrentReconciles: defaultMaxConcurrentReconciles,
+
+		HealthProbeBindAddress:    defaultHealthProbeBindAddress,
+		LogFormat:                 defaultLogFormat,
+		LogLevel:                  defaultLogLevel,
+		WebhookCertDir:            defaultWebhookCertDir,
+		WebhookDefaultRequestType: defaultWebhookRequestType,
+		IstioCSRCertDir:           defaultIstioCSRCertDir,
+		IstioCSRTrustDomain:       istiocsr.DefaultTrustDomain,
 	}
 }
 
 func (o *ControllerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.Float32Var(&o.KubernetesAPIQPS, "kube-api-qps", defaultKubernetesAPIQPS, "Maximium queries-per-second of requests to the Kubernetes apiserver.")
 	fs.IntVar(&o.KubernetesAPIBurst, "kube-api-burst", defaultKubernetesAPIBurst, "Maximium queries-per-second burst of request send to the Kubernetes apiserver.")
+	fs.Float32Var(&o.KubernetesAPIReaderQPS, "kube-api-reader-qps", o.KubernetesAPIReaderQPS, "Maximum queries-per-second of the uncached reads of the Kubernetes apiserver, such as of issuer secrets, rate limited apart from status updates and other requests so bursts of reads during mass renewals don't delay them. Defaults to kube-api-qps, shared with the other requests.")
+	fs.IntVar(&o.KubernetesAPIReaderBurst, "kube-api-reader-burst", o.KubernetesAPIReaderBurst, "Maximum burst of the uncached reads of the Kubernetes apiserver, rate limited apart from other requests. Defaults to kube-api-burst.")
+	fs.StringVar(&o.ReadAPIServerURL, "read-apiserver-url", o.ReadAPIServerURL, "URL of a read-only proxy of the Kubernetes apiserver, such as a caching proxy, to list, watch and get resources through with the same credentials. Writes are still sent to the apiserver. Defaults to the apiserver.")
+	fs.IntVar(&o.MaxConcurrentReconciles, "max-concurrent-reconciles", defaultMaxConcurrentReconciles, "Maximum number of objects each controller reconciles concurrently. Raise it to sign CertificateRequests faster in clusters with many of them, within the rate limits of the Cloudflare and Kubernetes APIs.")
 	fs.BoolVar(&o.DisableApprovedCheck, "disable-approved-check", o.DisableApprovedCheck, "Disables waiting for CertificateRequests to have an approved condition before signing.")
+	fs.BoolVar(&o.Approver, "approver", o.Approver, "Approve the CertificateRequests of OriginIssuers and ClusterOriginIssuers allowed by approver-namespace and approver-dns-zone, and deny the others, so that cert-manager's approver need not be granted to approve them. Requires permission to approve the signers of the issuers, and both approver-namespace and approver-dns-zone.")
+	fs.StringSliceVar(&o.ApproverNamespaces, "approver-namespace", o.ApproverNamespaces, "Namespace whose CertificateRequests the approver approves, or * for every namespace. May be repeated.")
+	fs.StringSliceVar(&o.ApproverDNSZones, "approver-dns-zone", o.ApproverDNSZones, "Domain, such as example.com, whose hostnames, including the domain itself, CertificateRequests approved by the approver may request. May be repeated.")
 	fs.StringVar(&o.ClusterResourceNamespace, "cluster-resource-namespace", o.ClusterResourceNamespace, "Namespace used for cluster-scoped resources, such as secrets used by ClusterOriginIssuer")
+	fs.DurationVar(&o.SignTimeout, "sign-timeout", defaultSignTimeout, "Maximum duration of a Cloudflare API call to sign a certificate. Calls are further bounded by the expiry of the owning Certificate's current certificate. Set to 0 to disable.")
+	fs.DurationVar(&o.ShutdownGracePeriod, "shutdown-grace-period", defaultShutdownGracePeriod, "How long the Cloudflare API calls and status updates of reconciles in flight when the controller shuts down may take to complete before they are cancelled, so that certificates being signed are still recorded. The pod's terminationGracePeriodSeconds must leave time for it. Set to 0 to cancel them at once.")
+	fs.StringVar(&o.LogFormat, "log-format", defaultLogFormat, "Format of the logs: json, or text for human readable lines.")
+	fs.StringVar(&o.LogLevel, "log-level", defaultLogLevel, "Minimum level of the logs: trace, debug, info, warn or error.")
+	fs.DurationVar(&o.DefaultDuration, "default-duration", defaultDefaultDuration, "Validity of certificates requested without a duration, unless their issuer sets a defaultDuration. Must be a validity supported by Cloudflare: 168h, 720h, 2160h, 8760h, 17520h, 26280h or 131400h.")
+	fs.BoolVar(&o.RevokeOnDelete, "revoke-on-delete", o.RevokeOnDelete, "Revoke Origin CA certificates when the CertificateRequest that issued them is deleted, such as when its Certificate is deleted.")
+	fs.BoolVar(&o.RevokeDryRun, "revoke-dry-run", o.RevokeDryRun, "Only report, with events and metrics, the Origin CA certificates revoke-on-delete and issuers revoking superseded certificates would revoke, without revoking them.")
+	fs.BoolVar(&o.ReuseCertificates, "reuse-certificates", o.ReuseCertificates, "Reuse the Origin CA certificate of the previous revision of a Certificate, rather than signing a new one, when the new revision requests the same private key, hostnames and duration from the same issuer and the certificate is not yet due for renewal, such as when only the Certificate's metadata changed. Re-issuance triggered manually or by a root rotation always signs a new certificate.")
+	fs.BoolVar(&o.DryRun, "dry-run", o.DryRun, "Validate issuers and CertificateRequests, logging the requests that would be sent to sign them, without ever calling the Cloudflare API. Outcomes are reported in a DryRun condition, leaving the Ready condition untouched, nothing is revoked, and the root rotation check is disabled.")
+	fs.BoolVar(&o.CertificateSigningRequests, "certificate-signing-requests", o.CertificateSigningRequests, "Sign the approved Kubernetes CertificateSigningRequests of the clusteroriginissuers.cert-manager.k8s.cloudflare.com/<name> signers with the named ClusterOriginIssuer. Not supported with dry-run.")
+	fs.BoolVar(&o.PopulateCA, "populate-ca", o.PopulateCA, "Set the CA of signed CertificateRequests to the Cloudflare Origin CA root, fetched from Cloudflare on first use, so secrets carry a ca.crt.")
+	fs.StringVar(&o.OriginCARootsDir, "origin-ca-roots-dir", o.OriginCARootsDir, "Directory, such as a mounted ConfigMap, of Origin CA root certificates overriding those vendored into the controller, as PEM files named after their request type: origin-rsa.pem and origin-ecc.pem. Roots that are neither overridden nor vendored are fetched from Cloudflare.")
+	fs.StringVar(&o.MessageTemplatesDir, "message-templates-dir", o.MessageTemplatesDir, "Directory, such as a mounted ConfigMap, of Go templates overriding the messages of the conditions and events of CertificateRequests and CertificateSigningRequests, in files named after the reason they apply to. Templates may refer to .Reason, .Message, .Kind, .Namespace, .Name, .IssuerKind and .IssuerName.")
+	fs.DurationVar(&o.RootRotationCheckInterval, "root-rotation-check-interval", o.RootRotationCheckInterval, "How often the Origin CA roots are fetched from Cloudflare to renew the Certificates of OriginIssuers and ClusterOriginIssuers once a root is rotated, so they pick up the new chain. Set to 0 to disable.")
+	fs.IntVar(&o.CFAPIRetryMax, "cf-api-retry-max", defaultCFAPIRetryMax, "Maximum number of retries of a Cloudflare API call failing with a transient error, such as rate limiting or a server error. Set to 0 to disable.")
+	fs.StringToStringVar(&o.CFAPIErrorClasses, "cf-api-error-classes", o.CFAPIErrorClasses, "Classes of Cloudflare API error codes, overriding the defaults, as code=class pairs such as 1100=temporary,1010=permanent. Temporary errors are retried, then requeued with backoff, while permanent errors fail the CertificateRequest. Unclassified codes are temporary when returned with a rate limiting or server error status. May be repeated.")
+	fs.StringSliceVar(&o.CFAPIEndpoints, "cf-api-endpoint", o.CFAPIEndpoints, "Cloudflare API endpoint, such as https://api.cloudflare.com. May be repeated to fail over between endpoints, in order, when one can't be reached or fails with a server error. Defaults to https://api.cloudflare.com.")
+	fs.DurationVar(&o.CFAPIEndpointCooldown, "cf-api-endpoint-cooldown", defaultCFAPIEndpointCooldown, "How long a Cloudflare API endpoint that failed is skipped in favor of the following ones.")
+	fs.StringSliceVar(&o.IssuerCFAPIURLs, "issuer-cf-api-url", o.IssuerCFAPIURLs, "https URL of a Cloudflare API endpoint, such as an internal API gateway, issuers may send their requests to with cloudflareAPIURL. May be repeated. Issuers setting cloudflareAPIURL are not Ready when unset.")
+	fs.DurationVar(&o.CFAPIEndpointHealthInterval, "cf-api-endpoint-health-interval", defaultCFAPIEndpointHealthInterval, "How often the Cloudflare API endpoints listed with cf-api-endpoint are probed, so that failing endpoints are skipped, and recovered ones used again, before requests are sent to them. Set to 0 to disable.")
+	fs.StringVar(&o.CFAPIFactory, "cf-api-factory", cfapi.DefaultFactory, "Name of the factory of Cloudflare API clients, such as grpc for a certificate broker served over gRPC, or one compiled into the controller, interposed between it and Cloudflare. Defaults to calling the Cloudflare API directly.")
+	fs.StringVar(&o.CFAPIFactoryConfig, "cf-api-factory-config", o.CFAPIFactoryConfig, "Configuration of the Cloudflare API client factory, such as the address of a certificate broker, as https://host:port, or host:port of a loopback address or unix:///path to call it in cleartext, for grpc. Its format is up to the factory.")
+	fs.DurationVar(&o.CFAPITimeout, "cf-api-timeout", defaultCFAPITimeout, "Timeout of each Cloudflare API request, including reading its response. Set to 0 to disable.")
+	fs.StringVar(&o.CFAPIProxyURL, "cf-api-proxy-url", o.CFAPIProxyURL, "URL of an HTTP proxy to reach the Cloudflare API through. Defaults to the proxy of the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.")
+	fs.StringVar(&o.CFAPICAFile, "cf-api-ca-file", o.CFAPICAFile, "Path to a PEM bundle of certificate authorities trusted by Cloudflare API clients in addition to the system roots, such as that of a TLS-intercepting egress proxy.")
+	fs.StringSliceVar(&o.TokenExchangeURLs, "token-exchange-url", o.TokenExchangeURLs, "https URL of a secret broker issuers may exchange ServiceAccount tokens with for their credentials. May be repeated. Token exchange is disabled when unset.")
+	fs.StringVar(&o.TokenExchangeCAFile, "token-exchange-ca-file", o.TokenExchangeCAFile, "Path to a PEM bundle of certificate authorities trusted, in addition to the system roots, when exchanging ServiceAccount tokens for the credentials of issuers with a secret broker.")
+	fs.StringSliceVar(&o.VaultAddresses, "vault-address", o.VaultAddresses, "https address of a HashiCorp Vault server, such as https://vault.example.com:8200, issuers may read their credentials from. May be repeated. Vault is disabled when unset.")
+	fs.StringVar(&o.VaultCAFile, "vault-ca-file", o.VaultCAFile, "Path to a PEM bundle of certificate authorities trusted, in addition to the system roots, when reading the credentials of issuers from HashiCorp Vault.")
+	fs.DurationVar(&o.AuthFailureTTL, "auth-failure-ttl", defaultAuthFailureTTL, "How long credentials rejected by the Cloudflare API fail further CertificateRequests without calling Cloudflare, unless their secret is updated. Set to 0 to disable.")
+	fs.IntVar(&o.MaxRetriesBeforeFail, "max-retries-before-fail", o.MaxRetriesBeforeFail, "Number of times in a row signing a CertificateRequest may fail with a rate limit or a transient error of the Cloudflare API, each retried with a growing backoff, before the CertificateRequest is failed. Retried indefinitely when 0.")
+	fs.StringVar(&o.CertificateCachePath, "certificate-cache-path", o.CertificateCachePath, "File persisting the Origin CA certificates issued for each CertificateRequest until they are recorded on it, across restarts, such as on a persistent volume, so that they are published rather than signed again, or revoked on deletion, when recording them failed. Its directory must exist. Disabled when empty.")
+	fs.IntVar(&o.CertificateCacheMaxEntries, "certificate-cache-max-entries", o.CertificateCacheMaxEntries, "Maximum number of CertificateRequests the certificate cache holds unrecorded certificates of. Further CertificateRequests are left pending until some are recorded, rather than dropping certificates which could then no longer be revoked. Unlimited when 0.")
+	fs.BoolVar(&o.StripCompletedCertificateRequests, "strip-completed-certificate-requests", o.StripCompletedCertificateRequests, "Keep only the metadata, spec and conditions of issued CertificateRequests in the controller's cache, reading their certificates from the apiserver when needed, so that memory stays flat in clusters with many historical CertificateRequests.")
+	fs.StringArrayVar(&o.AuditSinks, "audit-sink", o.AuditSinks, "Sink recording the Origin CA certificates issued and revoked, as its name optionally followed by a colon and its configuration: stdout for JSON lines on stdout, file:<path> for JSON lines in a file rotated every 100MiB, events for Kubernetes events, or a sink compiled into the controller. May be repeated to record to several sinks. Disabled when unset.")
+	fs.StringVar(&o.TenantKey, "tenant-key", o.TenantKey, "Annotation, or else label, of the namespaces of CertificateRequests whose value, such as a team name, labels their issuance metrics and audit records with a tenant for chargeback and per-team reporting. Disabled when empty.")
+	fs.StringSliceVar(&o.AttributionKeys, "attribution-key", o.AttributionKeys, "Annotation, or else label, of CertificateRequests, or of the Certificates owning them, such as team or app, whose value is carried with the calls to the Cloudflare API signing them, and added to their logs, audit records and the origin_ca_issuer_attributed_certificates_total metric, for cost attribution. May be repeated. Disabled when unset.")
+	fs.StringSliceVar(&o.AttributionMetricValues, "attribution-metric-value", o.AttributionMetricValues, "Value of an attribution-key, as key=value such as app=checkout, counted on its own by the origin_ca_issuer_attributed_certificates_total metric. Other values are counted as other, bounding the number of series. May be repeated.")
+	fs.StringVar(&o.DefaultClusterIssuer, "default-cluster-issuer", o.DefaultClusterIssuer, "Name of the ClusterOriginIssuer signing CertificateRequests that reference the ClusterOriginIssuer named \"default\", so that manifests shared between clusters need not know the name of the issuer in each. Disabled when empty.")
+	fs.BoolVar(&o.DefaultIssuerFallback, "default-issuer-fallback", o.DefaultIssuerFallback, "Sign CertificateRequests referencing an OriginIssuer or ClusterOriginIssuer that doesn't exist with the default-cluster-issuer instead.")
+	fs.DurationVar(&o.CertificateCountInterval, "certificate-count-interval", defaultCertificateCountInterval, "How often the number of Origin CA certificates of the zone of issuers with a zoneID is refreshed. Set to 0 to only refresh it when the issuer changes.")
+	fs.StringVar(&o.HealthProbeBindAddress, "health-probe-bind-address", defaultHealthProbeBindAddress, "The address the health and readiness probe endpoints bind to. Set to 0 to disable.")
+	fs.StringVar(&o.ProfilerAddress, "profiler-address", o.ProfilerAddress, "The address the net/http/pprof profiling endpoints bind to, such as localhost:6060 to only reach them with kubectl port-forward. Disabled when empty.")
+	fs.BoolVar(&o.KickEndpoint, "kick-endpoint", o.KickEndpoint, "Serve /kick on the metrics endpoint, which like SIGHUP re-verifies every issuer and retries every pending and failed CertificateRequest at once when POSTed to by a user allowed to create the /kick non-resource URL, with a token for the origin-ca-issuer audience, rather than waiting for their backoff, such as during incident recovery.")
+	fs.BoolVar(&o.InstallCRDs, "install-crds", o.InstallCRDs, "Apply the OriginIssuer and ClusterOriginIssuer CRDs bundled with the controller at startup with server-side apply, installing or upgrading them. Requires permission to get, create and patch CustomResourceDefinitions.")
+	fs.IntVar(&o.WebhookPort, "webhook-port", o.WebhookPort, "The port the mutating and validating admission webhooks for OriginIssuers and ClusterOriginIssuers listen on, defaulting and validating their specs. Set to 0 to disable.")
+	fs.StringVar(&o.WebhookCertDir, "webhook-cert-dir", defaultWebhookCertDir, "Directory holding the tls.crt and tls.key serving certificate of the admission webhooks.")
+	fs.StringVar(&o.WebhookDefaultRequestType, "webhook-default-request-type", defaultWebhookRequestType, "Request type the admission webhook sets on OriginIssuers and ClusterOriginIssuers created without one: OriginRSA or OriginECC.")
+	fs.IntVar(&o.IstioCSRPort, "istio-csr-port", o.IstioCSRPort, "The port Istio's CA API, as served by cert-manager's istio-csr, listens on, signing the certificates of Istio proxies authenticated with their ServiceAccount token with istio-csr-issuer. Set to 0 to disable.")
+	fs.StringVar(&o.IstioCSRCertDir, "istio-csr-cert-dir", o.IstioCSRCertDir, "Directory holding the tls.crt and tls.key serving certificate of Istio's CA API, which Istio proxies must trust.")
+	fs.StringVar(&o.IstioCSRIssuer, "istio-csr-issuer", o.IstioCSRIssuer, "Name of the ClusterOriginIssuer signing the certificates requested through Istio's CA API.")
+	fs.StringVar(&o.IstioCSRDomain, "istio-csr-domain", o.IstioCSRDomain, "Domain, such as mesh.example.com, of the hostnames the certificates requested through Istio's CA API are issued for: each proxy is issued a certificate for <serviceaccount>.<namespace>.<domain>, as authenticated by its ServiceAccount token and SPIFFE ID.")
+	fs.StringVar(&o.IstioCSRTrustDomain, "istio-csr-trust-domain", o.IstioCSRTrustDomain, "SPIFFE trust domain of the mesh, which the SPIFFE IDs of the CSRs requested through Istio's CA API must be of.")
+	fs.IntVar(&o.BackpressureMaxQueueDepth, "backpressure-max-queue-depth", o.BackpressureMaxQueueDepth, "Report the controller as not ready when its work queues hold more items than this. Set to 0 to disable.")
+	fs.Float64Var(&o.BackpressureMaxErrorRate, "backpressure-max-error-rate", o.BackpressureMaxErrorRate, "Report the controller as not ready when more than this fraction, between 0 and 1, of recent sign requests failed. Set to 0 to disable.")
 }
 
 func (o *ControllerOptions) Validate() error {
@@ -42,6 +264,232 @@ func (o *ControllerOptions) Validate() error {
 		return fmt.Errorf("invalid value for kube-api-qps: %v must be higher than 0", o.KubernetesAPIQPS)
 	}
 
+	if o.KubernetesAPIReaderBurst < 0 {
+		return fmt.Errorf("invalid value for kube-api-reader-burst: %v must not be negative", o.KubernetesAPIReaderBurst)
+	}
+
+	if o.KubernetesAPIReaderQPS < 0 {
+		return fmt.Errorf("invalid value for kube-api-reader-qps: %v must not be negative", o.KubernetesAPIReaderQPS)
+	}
+
+	if o.MaxConcurrentReconciles <= 0 {
+		return fmt.Errorf("invalid value for max-concurrent-reconciles: %v must be higher than 0", o.MaxConcurrentReconciles)
+	}
+
+	if o.CertificateCacheMaxEntries < 0 {
+		return fmt.Errorf("invalid value for certificate-cache-max-entries: %v must not be negative", o.CertificateCacheMaxEntries)
+	}
+
+	if o.ReadAPIServerURL != "" {
+		u, err := url.Parse(o.ReadAPIServerURL)
+		if err != nil {
+			return fmt.Errorf("invalid value for read-apiserver-url: %w", err)
+		}
+
+		if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			return fmt.Errorf("invalid value for read-apiserver-url: %v must be an absolute http or https URL", o.ReadAPIServerURL)
+		}
+	}
+
+	for _, ns := range o.ApproverNamespaces {
+		if ns == "*" {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return fmt.Errorf("invalid value for approver-namespace: %v must be a namespace name: %s", ns, strings.Join(errs, "; "))
+		}
+	}
+
+	for _, zone := range o.ApproverDNSZones {
+		if errs := validation.IsDNS1123Subdomain(zone); len(errs) > 0 {
+			return fmt.Errorf("invalid value for approver-dns-zone: %v must be a domain name: %s", zone, strings.Join(errs, "; "))
+		}
+	}
+
+	if !o.Approver && (len(o.ApproverNamespaces) > 0 || len(o.ApproverDNSZones) > 0) {
+		return fmt.Errorf("invalid value for approver: must be set to restrict the approver to namespaces or DNS zones")
+	}
+
+	if o.Approver && (len(o.ApproverNamespaces) == 0 || len(o.ApproverDNSZones) == 0) {
+		return fmt.Errorf("invalid value for approver: approver-namespace and approver-dns-zone are required, the approver denying every request otherwise")
+	}
+
+	if o.SignTimeout < 0 {
+		return fmt.Errorf("invalid value for sign-timeout: %v must not be negative", o.SignTimeout)
+	}
+
+	if o.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("invalid value for shutdown-grace-period: %v must not be negative", o.ShutdownGracePeriod)
+	}
+
+	if !provisioners.IsSupportedValidity(o.DefaultDuration) {
+		return fmt.Errorf("invalid value for default-duration: %v is not a validity supported by Cloudflare", o.DefaultDuration)
+	}
+
+	if o.CertificateSigningRequests && o.DryRun {
+		return fmt.Errorf("invalid value for certificate-signing-requests: not supported with dry-run")
+	}
+
+	if o.RootRotationCheckInterval < 0 {
+		return fmt.Errorf("invalid value for root-rotation-check-interval: %v must not be negative", o.RootRotationCheckInterval)
+	}
+
+	if o.CFAPIRetryMax < 0 {
+		return fmt.Errorf("invalid value for cf-api-retry-max: %v must not be negative", o.CFAPIRetryMax)
+	}
+
+	if _, err := cfapi.ParseErrorClasses(o.CFAPIErrorClasses); err != nil {
+		return fmt.Errorf("invalid value for cf-api-error-classes: %w", err)
+	}
+
+	if len(o.CFAPIEndpoints) > 0 {
+		if _, err := cfapi.NewEndpoints(o.CFAPIEndpoints, o.CFAPIEndpointCooldown); err != nil {
+			return fmt.Errorf("invalid value for cf-api-endpoint: %w", err)
+		}
+	}
+
+	if o.CFAPIEndpointCooldown < 0 {
+		return fmt.Errorf("invalid value for cf-api-endpoint-cooldown: %v must not be negative", o.CFAPIEndpointCooldown)
+	}
+
+	for _, u := range o.IssuerCFAPIURLs {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid value for issuer-cf-api-url: %v must be an absolute https URL", u)
+		}
+	}
+
+	if o.CFAPIEndpointHealthInterval < 0 {
+		return fmt.Errorf("invalid value for cf-api-endpoint-health-interval: %v must not be negative", o.CFAPIEndpointHealthInterval)
+	}
+
+	if !slices.Contains(cfapi.Factories(), o.CFAPIFactory) {
+		return fmt.Errorf("invalid value for cf-api-factory: %v is not one of %s", o.CFAPIFactory, strings.Join(cfapi.Factories(), ", "))
+	}
+
+	if o.CFAPITimeout < 0 {
+		return fmt.Errorf("invalid value for cf-api-timeout: %v must not be negative", o.CFAPITimeout)
+	}
+
+	for _, u := range o.TokenExchangeURLs {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid value for token-exchange-url: %v must be an absolute https URL", u)
+		}
+	}
+
+	for _, address := range o.VaultAddresses {
+		if parsed, err := url.Parse(address); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid value for vault-address: %v must be an absolute https URL", address)
+		}
+	}
+
+	if o.CFAPIProxyURL != "" {
+		u, err := url.Parse(o.CFAPIProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid value for cf-api-proxy-url: %w", err)
+		}
+
+		if u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "socks5" || u.Host == "" {
+			return fmt.Errorf("invalid value for cf-api-proxy-url: %v must be an absolute http, https or socks5 URL", o.CFAPIProxyURL)
+		}
+	}
+
+	if o.AuthFailureTTL < 0 {
+		return fmt.Errorf("invalid value for auth-failure-ttl: %v must not be negative", o.AuthFailureTTL)
+	}
+
+	if o.MaxRetriesBeforeFail < 0 {
+		return fmt.Errorf("invalid value for max-retries-before-fail: %v must not be negative", o.MaxRetriesBeforeFail)
+	}
+
+	for _, spec := range o.AuditSinks {
+		if _, _, err := audit.ParseSink(spec); err != nil {
+			return fmt.Errorf("invalid value for audit-sink: %w", err)
+		}
+	}
+
+	if o.DefaultClusterIssuer != "" {
+		if errs := validation.IsDNS1123Subdomain(o.DefaultClusterIssuer); len(errs) > 0 {
+			return fmt.Errorf("invalid value for default-cluster-issuer: %v must be a resource name: %s", o.DefaultClusterIssuer, strings.Join(errs, "; "))
+		}
+	}
+
+	if o.DefaultIssuerFallback && o.DefaultClusterIssuer == "" {
+		return fmt.Errorf("invalid value for default-cluster-issuer: must be set to fall back to the default issuer")
+	}
+
+	if o.TenantKey != "" {
+		if errs := validation.IsQualifiedName(o.TenantKey); len(errs) > 0 {
+			return fmt.Errorf("invalid value for tenant-key: %v must be a qualified name: %s", o.TenantKey, strings.Join(errs, "; "))
+		}
+	}
+
+	for _, key := range o.AttributionKeys {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid value for attribution-key: %v must be a qualified name: %s", key, strings.Join(errs, "; "))
+		}
+	}
+
+	for _, value := range o.AttributionMetricValues {
+		key, _, ok := strings.Cut(value, "=")
+		if !ok || !slices.Contains(o.AttributionKeys, key) {
+			return fmt.Errorf("invalid value for attribution-metric-value: %v must be key=value with a key of attribution-key", value)
+		}
+	}
+
+	if o.CertificateCountInterval < 0 {
+		return fmt.Errorf("invalid value for certificate-count-interval: %v must not be negative", o.CertificateCountInterval)
+	}
+
+	switch o.LogFormat {
+	case "json", "text":
+	default:
+		return fmt.Errorf("invalid value for log-format: %v must be json or text", o.LogFormat)
+	}
+
+	if !slices.Contains(logLevels, o.LogLevel) {
+		return fmt.Errorf("invalid value for log-level: %v is not one of %s", o.LogLevel, strings.Join(logLevels, ", "))
+	}
+
+	if o.WebhookPort < 0 || o.WebhookPort > 65535 {
+		return fmt.Errorf("invalid value for webhook-port: %v must be between 0 and 65535", o.WebhookPort)
+	}
+
+	switch v1.RequestType(o.WebhookDefaultRequestType) {
+	case v1.RequestTypeOriginRSA, v1.RequestTypeOriginECC:
+	default:
+		return fmt.Errorf("invalid value for webhook-default-request-type: %v must be OriginRSA or OriginECC", o.WebhookDefaultRequestType)
+	}
+
+	if o.IstioCSRPort < 0 || o.IstioCSRPort > 65535 {
+		return fmt.Errorf("invalid value for istio-csr-port: %v must be between 0 and 65535", o.IstioCSRPort)
+	}
+
+	if o.IstioCSRPort > 0 && o.IstioCSRIssuer == "" {
+		return fmt.Errorf("invalid value for istio-csr-issuer: must be set to serve Istio's CA API")
+	}
+
+	if o.IstioCSRPort > 0 && o.IstioCSRDomain == "" {
+		return fmt.Errorf("invalid value for istio-csr-domain: must be set to serve Istio's CA API")
+	}
+
+	if o.IstioCSRDomain != "" {
+		if errs := validation.IsDNS1123Subdomain(o.IstioCSRDomain); len(errs) > 0 {
+			return fmt.Errorf("invalid value for istio-csr-domain: %v must be a domain name: %s", o.IstioCSRDomain, strings.Join(errs, "; "))
+		}
+	}
+
+	if o.IstioCSRPort > 0 && o.DryRun {
+		return fmt.Errorf("invalid value for istio-csr-port: not supported with dry-run")
+	}
+
+	if o.BackpressureMaxQueueDepth < 0 {
+		return fmt.Errorf("invalid value for backpressure-max-queue-depth: %v must not be negative", o.BackpressureMaxQueueDepth)
+	}
+
+	if o.BackpressureMaxErrorRate < 0 || o.BackpressureMaxErrorRate > 1 {
+		return fmt.Errorf("invalid value for backpressure-max-error-rate: %v must be between 0 and 1", o.BackpressureMaxErrorRate)
+	}
+
 	if o.ClusterResourceNamespace == "" {
 		return fmt.Errorf("invalid value for cluster-resource-namespace: must be set")
 	}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// Version and kind of the bundles written by export, so that import can
+// refuse bundles of a format it doesn't know.
+const (
+	bundleAPIVersion = "originca.cert-manager.k8s.cloudflare.com/v1"
+	bundleKind       = "Bundle"
+)
+
+// bundle is the portable backup of the issuers of a cluster. The Secrets and
+// ServiceAccounts they authenticate with are only referenced, never copied,
+// so that bundles can be stored and moved without exposing credentials.
+type bundle struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// Issuers are the OriginIssuers and ClusterOriginIssuers, without their
+	// status.
+	Issuers []map[string]interface{} `json:"issuers,omitempty"`
+
+	// Bindings are the ClusterRoles allowing cert-manager to approve the
+	// CertificateRequests of the issuers, followed by the ClusterRoleBindings
+	// and RoleBindings granting them.
+	Bindings []map[string]interface{} `json:"bindings,omitempty"`
+
+	// References are the objects the issuers authenticate with, which must
+	// be restored separately.
+	References []reference `json:"references,omitempty"`
+}
+
+// reference is a Secret key or ServiceAccount referenced by an issuer.
+type reference struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+
+	// Issuer is the kind, namespace if any, and name of the issuer, such as
+	// OriginIssuer/default/prod-issuer.
+	Issuer string `json:"issuer"`
+}
+
+func (r reference) String() string {
+	if r.Key != "" {
+		return fmt.Sprintf("%s %s/%s key %s", r.Kind, r.Namespace, r.Name, r.Key)
+	}
+
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// approverSignerPrefixes are the signer names of the issuers, as approved by
+// cert-manager.
+var approverSignerPrefixes = []string{
+	"originissuers." + v1.GroupVersion.Group + "/",
+	"clusteroriginissuers." + v1.GroupVersion.Group + "/",
+}
+
+// newClient returns a client of the cluster of the kubeconfig, or of the
+// default kubeconfig, such as $KUBECONFIG, if empty.
+func newClient(kubeconfig string) (client.Client, error) {
+	var (
+		cfg *rest.Config
+		err error
+	)
+	if kubeconfig != "" {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		cfg, err = config.GetConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := certmanager.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
+
+// issuerGVKs are the kinds of issuers backed up, listed in the order they are
+// restored.
+var issuerGVKs = []schema.GroupVersionKind{
+	v1.GroupVersion.WithKind("ClusterOriginIssuer"),
+	v1.GroupVersion.WithKind("OriginIssuer"),
+}
+
+// issuerName returns the kind, namespace if any, and name of the issuer.
+func issuerName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetKind() + "/" + obj.GetName()
+	}
+
+	return obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// issuerReferences returns the Secret keys and ServiceAccounts the issuer
+// authenticates with. Those of ClusterOriginIssuers are in the cluster
+// resource namespace of the controller.
+func issuerReferences(obj *unstructured.Unstructured, clusterResourceNamespace string) ([]reference, error) {
+	var spec v1.OriginIssuerSpec
+	if raw, ok := obj.Object["spec"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+			return nil, fmt.Errorf("%s: %w", issuerName(obj), err)
+		}
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = clusterResourceNamespace
+	}
+
+	var refs []reference
+	secret := func(ref *v1.SecretKeySelector) {
+		if ref != nil && ref.Name != "" {
+			refs = append(refs, reference{Kind: "Secret", Namespace: namespace, Name: ref.Name, Key: ref.Key, Issuer: issuerName(obj)})
+		}
+	}
+	serviceAccount := func(ref v1.ServiceAccountRef) {
+		if ref.Name != "" {
+			refs = append(refs, reference{Kind: "ServiceAccount", Namespace: namespace, Name: ref.Name, Issuer: issuerName(obj)})
+		}
+	}
+
+	auth := spec.Auth
+	secret(&auth.ServiceKeyRef)
+	secret(auth.APITokenRef)
+	secret(auth.VerifyTokenRef)
+	if auth.TokenExchange != nil {
+		serviceAccount(auth.TokenExchange.ServiceAccountRef)
+	}
+	if auth.Vault != nil {
+		serviceAccount(auth.Vault.ServiceAccountRef)
+	}
+	for i := range auth.Zones {
+		secret(auth.Zones[i].ServiceKeyRef)
+		secret(auth.Zones[i].APITokenRef)
+	}
+
+	return refs, nil
+}
+
+// approvesIssuers reports whether the ClusterRole allows approving the
+// CertificateRequests of the issuers.
+func approvesIssuers(role *rbacv1.ClusterRole) bool {
+	for _, rule := range role.Rules {
+		if !contains(rule.APIGroups, "cert-manager.io") || !contains(rule.Resources, "signers") || !contains(rule.Verbs, "approve") {
+			continue
+		}
+
+		for _, name := range rule.ResourceNames {
+			for _, prefix := range approverSignerPrefixes {
+				if strings.HasPrefix(name, prefix) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// portable removes the fields of the object set by the apiserver or
+// controllers, keeping those needed to recreate it in another cluster.
+func portable(obj *unstructured.Unstructured) {
+	delete(obj.Object, "status")
+
+	metadata := map[string]interface{}{"name": obj.GetName()}
+	if ns := obj.GetNamespace(); ns != "" {
+		metadata["namespace"] = ns
+	}
+
+	labels := obj.GetLabels()
+	annotations := obj.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+
+	obj.Object["metadata"] = metadata
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+}
+
+// restore creates the object, or updates it if it already exists, returning
+// what was done.
+func restore(ctx context.Context, c client.Client, obj *unstructured.Unstructured, dryRun bool) (string, error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if client.IgnoreNotFound(err) != nil {
+		return "", err
+	}
+
+	if err != nil {
+		var opts []client.CreateOption
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+
+		return "created", c.Create(ctx, obj, opts...)
+	}
+
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	var opts []client.UpdateOption
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+
+	return "configured", c.Update(ctx, obj, opts...)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	"gotest.tools/v3/assert"
+	core "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestExportImport(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NilError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NilError(t, v1.AddToScheme(scheme))
+
+	issuer := issuerclient.NewOriginIssuer("default", "prod-issuer", issuerclient.WithAPITokenRef("api-token", "token"), issuerclient.WithVerifyTokenRef("verify-token", "token"))
+	issuer.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}
+	issuer.Status.Conditions = []metav1.Condition{{Type: v1.ConditionReady, Status: metav1.ConditionTrue}}
+	other := issuerclient.NewOriginIssuer("other", "other-issuer", issuerclient.WithServiceKeyRef("service-key", "key"))
+	clusterIssuer := issuerclient.NewClusterOriginIssuer("cluster-issuer", issuerclient.WithServiceKeyRef("service-key", "key"))
+
+	approver := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "cert-manager-controller-approve:cert-manager-k8s-cloudflare-com"},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{"cert-manager.io"},
+			Resources:     []string{"signers"},
+			Verbs:         []string{"approve"},
+			ResourceNames: []string{"originissuers.cert-manager.k8s.cloudflare.com/*", "clusteroriginissuers.cert-manager.k8s.cloudflare.com/*"},
+		}},
+	}
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: approver.Name},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: approver.Name},
+		Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Name: "cert-manager", Namespace: "cert-manager"}},
+	}
+	unrelated := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "view"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+	}
+
+	source := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(issuer, other, clusterIssuer, approver, binding, unrelated).
+		Build()
+
+	b, err := export(context.Background(), source, exportOptions{Namespace: "default", ClusterResourceNamespace: "origin-ca-issuer"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(b.Issuers), 2)
+	assert.Equal(t, len(b.Bindings), 2)
+	assert.DeepEqual(t, b.References, []reference{
+		{Kind: "Secret", Namespace: "origin-ca-issuer", Name: "service-key", Key: "key", Issuer: "ClusterOriginIssuer/cluster-issuer"},
+		{Kind: "Secret", Namespace: "default", Name: "api-token", Key: "token", Issuer: "OriginIssuer/default/prod-issuer"},
+		{Kind: "Secret", Namespace: "default", Name: "verify-token", Key: "token", Issuer: "OriginIssuer/default/prod-issuer"},
+	})
+
+	data, err := yaml.Marshal(b)
+	assert.NilError(t, err)
+	assert.Assert(t, !bytes.Contains(data, []byte("status")), "status exported:\n%s", data)
+	assert.Assert(t, !bytes.Contains(data, []byte("resourceVersion")), "resourceVersion exported:\n%s", data)
+	assert.Assert(t, !bytes.Contains(data, []byte("last-applied-configuration")), "annotations of kubectl exported:\n%s", data)
+
+	parsed, err := parseBundle(data)
+	assert.NilError(t, err)
+
+	target := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&core.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "api-token", Namespace: "default"},
+				Data:       map[string][]byte{"token": []byte("token")},
+			},
+			issuerclient.NewClusterOriginIssuer("cluster-issuer", issuerclient.WithAPITokenRef("api-token", "token")),
+		).
+		Build()
+
+	var out bytes.Buffer
+	assert.NilError(t, importBundle(context.Background(), target, parsed, false, &out))
+	assert.Equal(t, out.String(), `clusterrole cert-manager-controller-approve:cert-manager-k8s-cloudflare-com created
+clusterrolebinding cert-manager-controller-approve:cert-manager-k8s-cloudflare-com created
+clusteroriginissuer cluster-issuer configured
+originissuer default/prod-issuer created
+warning: Secret origin-ca-issuer/service-key key key referenced by ClusterOriginIssuer/cluster-issuer does not exist
+warning: Secret default/verify-token key token referenced by OriginIssuer/default/prod-issuer does not exist
+`)
+
+	var restored v1.OriginIssuer
+	assert.NilError(t, target.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "prod-issuer"}, &restored))
+	assert.DeepEqual(t, restored.Spec, issuer.Spec)
+
+	var restoredCluster v1.ClusterOriginIssuer
+	assert.NilError(t, target.Get(context.Background(), client.ObjectKey{Name: "cluster-issuer"}, &restoredCluster))
+	assert.DeepEqual(t, restoredCluster.Spec, clusterIssuer.Spec)
+}
+
+func TestParseBundle_UnknownFormat(t *testing.T) {
+	_, err := parseBundle([]byte("apiVersion: v1\nkind: List\n"))
+	assert.Error(t, err, `not a bundle written by originca export: expected apiVersion originca.cert-manager.k8s.cloudflare.com/v1 and kind Bundle, got "v1" and "List"`)
+}
@@ -0,0 +1,35 @@
+/*
+Originca is a command line tool for operating the origin-ca-issuer project.
+
+Usage:
+
+	originca <command> [flags]
+
+Commands:
+
+	migrate    Rewrite OriginIssuer and ClusterOriginIssuer manifests to the current API.
+	export     Back up the issuers of a cluster, and the RBAC approving their requests, as a bundle.
+	import     Restore the issuers and RBAC of a bundle written by export.
+	reissue    Renew the Certificates of the issuers, such as to migrate them to a new request type.
+
+Export writes the OriginIssuers and ClusterOriginIssuers of a cluster, without
+their status, along with the ClusterRoles allowing cert-manager to approve
+their CertificateRequests and the bindings granting them, as a YAML bundle.
+The Secrets and ServiceAccounts the issuers authenticate with are only
+referenced by the bundle, and must be restored separately, such as from a
+secret manager. Import creates the objects of a bundle, or updates those that
+exist, then warns of the references missing from the cluster:
+
+	originca export --cluster-resource-namespace=origin-ca-issuer -o issuers.yaml
+	originca import --kubeconfig=new-cluster.yaml -f issuers.yaml
+
+Reissue renews the Certificates of OriginIssuers and ClusterOriginIssuers
+through cert-manager, as cmctl renew does, after a change to the issuers that
+only applies to new certificates, such as moving from the RSA to the ECC
+Origin CA. Certificates are selected by labels, namespace and issuer, and
+annotated with the reason given, so that running it again, such as in
+batches with --limit, skips those already renewed:
+
+	originca reissue --issuer-kind=ClusterOriginIssuer --issuer=prod --reason=rsa-to-ecc --limit=50
+*/
+package main
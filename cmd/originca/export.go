@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// exportOptions select what export backs up.
+type exportOptions struct {
+	// Namespace restricts the OriginIssuers exported to a namespace. Every
+	// ClusterOriginIssuer is exported regardless.
+	Namespace string
+
+	// ClusterResourceNamespace is the namespace of the Secrets and
+	// ServiceAccounts of ClusterOriginIssuers.
+	ClusterResourceNamespace string
+}
+
+func runExport(args []string, _ io.Reader, stdout io.Writer) error {
+	fs := pflag.NewFlagSet("export", pflag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", "", "Kubeconfig of the cluster to export from. Defaults to $KUBECONFIG, or the in-cluster configuration.")
+	output := fs.StringP("output", "o", "-", "File to write the bundle to, or \"-\" for stdout.")
+	var opts exportOptions
+	fs.StringVarP(&opts.Namespace, "namespace", "n", "", "Only export the OriginIssuers of this namespace. Defaults to all namespaces.")
+	fs.StringVar(&opts.ClusterResourceNamespace, "cluster-resource-namespace", "origin-ca-issuer", "Namespace of the Secrets used by ClusterOriginIssuers, as set on the controller.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newClient(*kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	b, err := export(context.Background(), c, opts)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err = stdout.Write(out)
+		return err
+	}
+
+	return os.WriteFile(*output, out, 0o600)
+}
+
+// export backs up the issuers of the cluster, the RBAC allowing cert-manager
+// to approve their CertificateRequests, and references to the objects they
+// authenticate with. Issuers are migrated to the current API.
+func export(ctx context.Context, c client.Client, opts exportOptions) (*bundle, error) {
+	b := &bundle{APIVersion: bundleAPIVersion, Kind: bundleKind}
+
+	for _, gvk := range issuerGVKs {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+		var listOpts []client.ListOption
+		if gvk.Kind == "OriginIssuer" && opts.Namespace != "" {
+			listOpts = append(listOpts, client.InNamespace(opts.Namespace))
+		}
+		if err := c.List(ctx, list, listOpts...); err != nil {
+			return nil, fmt.Errorf("listing %ss: %w", gvk.Kind, err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			for _, m := range migrations {
+				if _, err := m(obj); err != nil {
+					return nil, fmt.Errorf("%s: %w", issuerName(obj), err)
+				}
+			}
+			portable(obj)
+
+			refs, err := issuerReferences(obj, opts.ClusterResourceNamespace)
+			if err != nil {
+				return nil, err
+			}
+
+			b.Issuers = append(b.Issuers, obj.Object)
+			b.References = append(b.References, refs...)
+		}
+	}
+
+	bindings, err := exportBindings(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	b.Bindings = bindings
+
+	return b, nil
+}
+
+// exportBindings returns the ClusterRoles allowing cert-manager to approve
+// the CertificateRequests of the issuers, and the bindings granting them.
+func exportBindings(ctx context.Context, c client.Client) ([]map[string]interface{}, error) {
+	var roles rbacv1.ClusterRoleList
+	if err := c.List(ctx, &roles); err != nil {
+		return nil, fmt.Errorf("listing ClusterRoles: %w", err)
+	}
+
+	approvers := make(map[string]bool)
+	var objs []client.Object
+	for i := range roles.Items {
+		if approvesIssuers(&roles.Items[i]) {
+			approvers[roles.Items[i].Name] = true
+			objs = append(objs, &roles.Items[i])
+		}
+	}
+
+	if len(approvers) == 0 {
+		return nil, nil
+	}
+
+	var clusterRoleBindings rbacv1.ClusterRoleBindingList
+	if err := c.List(ctx, &clusterRoleBindings); err != nil {
+		return nil, fmt.Errorf("listing ClusterRoleBindings: %w", err)
+	}
+	for i := range clusterRoleBindings.Items {
+		if ref := clusterRoleBindings.Items[i].RoleRef; ref.Kind == "ClusterRole" && approvers[ref.Name] {
+			objs = append(objs, &clusterRoleBindings.Items[i])
+		}
+	}
+
+	var roleBindings rbacv1.RoleBindingList
+	if err := c.List(ctx, &roleBindings); err != nil {
+		return nil, fmt.Errorf("listing RoleBindings: %w", err)
+	}
+	for i := range roleBindings.Items {
+		if ref := roleBindings.Items[i].RoleRef; ref.Kind == "ClusterRole" && approvers[ref.Name] {
+			objs = append(objs, &roleBindings.Items[i])
+		}
+	}
+
+	var bindings []map[string]interface{}
+	for _, obj := range objs {
+		gvk, err := c.GroupVersionKindFor(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		u := &unstructured.Unstructured{Object: content}
+		u.SetGroupVersionKind(gvk)
+		portable(u)
+		bindings = append(bindings, u.Object)
+	}
+
+	return bindings, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+func runImport(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := pflag.NewFlagSet("import", pflag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", "", "Kubeconfig of the cluster to import into. Defaults to $KUBECONFIG, or the in-cluster configuration.")
+	file := fs.StringP("filename", "f", "-", "Bundle written by export to import, or \"-\" for stdin.")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be imported, validating the objects with the apiserver without persisting them.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if *file == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := parseBundle(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+
+	c, err := newClient(*kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	return importBundle(context.Background(), c, b, *dryRun, stdout)
+}
+
+// parseBundle decodes a bundle, refusing those of an unknown format.
+func parseBundle(data []byte) (*bundle, error) {
+	var b bundle
+	if err := yaml.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+
+	if b.APIVersion != bundleAPIVersion || b.Kind != bundleKind {
+		return nil, fmt.Errorf("not a bundle written by originca export: expected apiVersion %s and kind %s, got %q and %q", bundleAPIVersion, bundleKind, b.APIVersion, b.Kind)
+	}
+
+	return &b, nil
+}
+
+// importBundle restores the bindings, then the issuers of the bundle, creating
+// them or updating those that exist. References to objects missing from the
+// cluster are reported, as the issuers won't become ready without them.
+func importBundle(ctx context.Context, c client.Client, b *bundle, dryRun bool, out io.Writer) error {
+	suffix := ""
+	if dryRun {
+		suffix = " (dry run)"
+	}
+
+	objs := append(append([]map[string]interface{}{}, b.Bindings...), b.Issuers...)
+	for _, content := range objs {
+		obj := &unstructured.Unstructured{Object: content}
+
+		action, err := restore(ctx, c, obj, dryRun)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", obj.GetKind(), objectName(obj), err)
+		}
+
+		fmt.Fprintf(out, "%s %s %s%s\n", strings.ToLower(obj.GetKind()), objectName(obj), action, suffix)
+	}
+
+	for _, ref := range b.References {
+		missing, err := referenceMissing(ctx, c, ref)
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", ref, err)
+		}
+
+		if missing != "" {
+			fmt.Fprintf(out, "warning: %s referenced by %s %s\n", ref, ref.Issuer, missing)
+		}
+	}
+
+	return nil
+}
+
+// referenceMissing returns why the referenced object is missing from the
+// cluster, or an empty string if it exists.
+func referenceMissing(ctx context.Context, c client.Client, ref reference) (string, error) {
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+
+	switch ref.Kind {
+	case "Secret":
+		var secret core.Secret
+		if err := c.Get(ctx, key, &secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "does not exist", nil
+			}
+
+			return "", err
+		}
+
+		if _, ok := secret.Data[ref.Key]; ref.Key != "" && !ok {
+			return "lacks the key", nil
+		}
+	case "ServiceAccount":
+		var sa core.ServiceAccount
+		if err := c.Get(ctx, key, &sa); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "does not exist", nil
+			}
+
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
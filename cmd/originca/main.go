@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand of originca. It receives the arguments following
+// the command name.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "migrate", usage: "Rewrite OriginIssuer and ClusterOriginIssuer manifests to the current API.", run: runMigrate},
+	{name: "export", usage: "Back up the issuers of a cluster, and the RBAC approving their requests, as a bundle.", run: runExport},
+	{name: "import", usage: "Restore the issuers and RBAC of a bundle written by export.", run: runImport},
+	{name: "reissue", usage: "Renew the Certificates of the issuers, such as to migrate them to a new request type.", run: runReissue},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+
+		if err := cmd.run(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "originca %s: %s\n", cmd.name, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: originca <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// migration rewrites a single issuer document in place, returning true if it
+// was modified.
+type migration func(obj *unstructured.Unstructured) (bool, error)
+
+// migrations are applied in order to every OriginIssuer and
+// ClusterOriginIssuer document. Conversions between API versions belong here
+// as new versions are introduced.
+var migrations = []migration{
+	migrateAPIVersion,
+	migrateRequestType,
+	migrateEmptyServiceKeyRef,
+	migrateStatus,
+}
+
+func runMigrate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := pflag.NewFlagSet("migrate", pflag.ContinueOnError)
+	files := fs.StringSliceP("filename", "f", nil, "Manifests to migrate. Reads from stdin if unset or \"-\".")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*files) == 0 {
+		*files = []string{"-"}
+	}
+
+	first := true
+	for _, name := range *files {
+		docs, err := migrateFile(name, stdin)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		for _, doc := range docs {
+			if !first {
+				fmt.Fprintln(stdout, "---")
+			}
+			first = false
+
+			if _, err := stdout.Write(doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func migrateFile(name string, stdin io.Reader) ([][]byte, error) {
+	if name == "-" {
+		return migrate(stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return migrate(f)
+}
+
+// migrate reads a stream of YAML or JSON documents, and returns each document
+// as YAML with migrations applied to issuer documents. Other documents are
+// returned unchanged.
+func migrate(r io.Reader) ([][]byte, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+
+	var docs [][]byte
+	for {
+		raw, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(raw, &obj.Object); err != nil {
+			return nil, err
+		}
+
+		if !isIssuer(obj) {
+			docs = append(docs, raw)
+			continue
+		}
+
+		for _, m := range migrations {
+			if _, err := m(obj); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+			}
+		}
+
+		out, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, out)
+	}
+}
+
+func isIssuer(obj *unstructured.Unstructured) bool {
+	gv, err := schema.ParseGroupVersion(obj.GetAPIVersion())
+	if err != nil || gv.Group != v1.GroupVersion.Group {
+		return false
+	}
+
+	return obj.GetKind() == "OriginIssuer" || obj.GetKind() == "ClusterOriginIssuer"
+}
+
+// migrateAPIVersion rewrites the apiVersion of the document to the current
+// version of the API.
+func migrateAPIVersion(obj *unstructured.Unstructured) (bool, error) {
+	if obj.GetAPIVersion() == v1.GroupVersion.String() {
+		return false, nil
+	}
+
+	obj.SetAPIVersion(v1.GroupVersion.String())
+
+	return true, nil
+}
+
+// migrateRequestType rewrites request types given as the Cloudflare API's
+// names, such as "origin-ecc", to the names used by the API.
+func migrateRequestType(obj *unstructured.Unstructured) (bool, error) {
+	reqType, found, err := unstructured.NestedString(obj.Object, "spec", "requestType")
+	if err != nil || !found {
+		return false, err
+	}
+
+	var migrated v1.RequestType
+	switch strings.ToLower(strings.ReplaceAll(reqType, "-", "")) {
+	case "originrsa":
+		migrated = v1.RequestTypeOriginRSA
+	case "originecc":
+		migrated = v1.RequestTypeOriginECC
+	default:
+		return false, fmt.Errorf("unknown request type %q", reqType)
+	}
+
+	if string(migrated) == reqType {
+		return false, nil
+	}
+
+	return true, unstructured.SetNestedField(obj.Object, string(migrated), "spec", "requestType")
+}
+
+// migrateEmptyServiceKeyRef removes empty serviceKeyRef stanzas, as written
+// by clients serializing issuers that authenticate with apiTokenRef.
+func migrateEmptyServiceKeyRef(obj *unstructured.Unstructured) (bool, error) {
+	ref, found, err := unstructured.NestedMap(obj.Object, "spec", "auth", "serviceKeyRef")
+	if err != nil || !found {
+		return false, err
+	}
+
+	for _, v := range ref {
+		if v != "" {
+			return false, nil
+		}
+	}
+
+	unstructured.RemoveNestedField(obj.Object, "spec", "auth", "serviceKeyRef")
+
+	return true, nil
+}
+
+// migrateStatus removes the status, which is managed by the controller and may
+// not match the migrated spec.
+func migrateStatus(obj *unstructured.Unstructured) (bool, error) {
+	if _, found := obj.Object["status"]; !found {
+		return false, nil
+	}
+
+	delete(obj.Object, "status")
+
+	return true, nil
+}
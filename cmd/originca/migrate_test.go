@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	input := `apiVersion: cert-manager.k8s.cloudflare.com/v1
+kind: OriginIssuer
+metadata:
+  name: prod-issuer
+  namespace: default
+spec:
+  requestType: origin-ecc
+  auth:
+    serviceKeyRef:
+      name: ""
+      key: ""
+    apiTokenRef:
+      name: api-token
+      key: token
+status:
+  conditions:
+  - type: Ready
+    status: "True"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: api-token
+  namespace: default
+---
+apiVersion: cert-manager.k8s.cloudflare.com/v1
+kind: ClusterOriginIssuer
+metadata:
+  name: cluster-issuer
+spec:
+  requestType: OriginRSA
+  auth:
+    serviceKeyRef:
+      name: service-key
+      key: key
+`
+
+	expected := `apiVersion: cert-manager.k8s.cloudflare.com/v1
+kind: OriginIssuer
+metadata:
+  name: prod-issuer
+  namespace: default
+spec:
+  auth:
+    apiTokenRef:
+      key: token
+      name: api-token
+  requestType: OriginECC
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: api-token
+  namespace: default
+---
+apiVersion: cert-manager.k8s.cloudflare.com/v1
+kind: ClusterOriginIssuer
+metadata:
+  name: cluster-issuer
+spec:
+  auth:
+    serviceKeyRef:
+      key: key
+      name: service-key
+  requestType: OriginRSA
+`
+
+	var out bytes.Buffer
+	assert.NilError(t, runMigrate(nil, strings.NewReader(input), &out))
+	assert.Equal(t, out.String(), expected)
+}
+
+func TestMigrate_UnknownRequestType(t *testing.T) {
+	input := `apiVersion: cert-manager.k8s.cloudflare.com/v1
+kind: OriginIssuer
+metadata:
+  name: prod-issuer
+spec:
+  requestType: origin-dsa
+`
+
+	var out bytes.Buffer
+	err := runMigrate(nil, strings.NewReader(input), &out)
+	assert.Error(t, err, `-: OriginIssuer prod-issuer: unknown request type "origin-dsa"`)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reissueOptions select the Certificates reissue renews.
+type reissueOptions struct {
+	// Selector is a label selector of the Certificates.
+	Selector string
+
+	// Namespace restricts the Certificates to a namespace. Certificates of
+	// every namespace are renewed when empty.
+	Namespace string
+
+	// IssuerKind and IssuerName restrict the Certificates to those of an
+	// issuer. Either may be empty to match any.
+	IssuerKind string
+	IssuerName string
+
+	// Reason is recorded in the ReissueAnnotation of the renewed
+	// Certificates. Those already annotated with it are skipped.
+	Reason string
+
+	// Limit is the largest number of Certificates renewed, or 0 for no
+	// limit.
+	Limit int
+
+	DryRun bool
+}
+
+// manuallyTriggeredReason is the reason of the Issuing condition set by
+// cmctl renew, which cert-manager and the issuer treat as a forced renewal.
+const manuallyTriggeredReason = "ManuallyTriggered"
+
+func runReissue(args []string, _ io.Reader, stdout io.Writer) error {
+	fs := pflag.NewFlagSet("reissue", pflag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", "", "Kubeconfig of the cluster to renew Certificates in. Defaults to $KUBECONFIG, or the in-cluster configuration.")
+	var opts reissueOptions
+	fs.StringVarP(&opts.Selector, "selector", "l", "", "Label selector of the Certificates to renew, such as app=web. Defaults to every Certificate of the issuers.")
+	fs.StringVarP(&opts.Namespace, "namespace", "n", "", "Only renew the Certificates of this namespace. Defaults to all namespaces.")
+	fs.StringVar(&opts.IssuerKind, "issuer-kind", "", "Only renew the Certificates of issuers of this kind, OriginIssuer or ClusterOriginIssuer. Defaults to both.")
+	fs.StringVar(&opts.IssuerName, "issuer", "", "Only renew the Certificates of issuers of this name. Defaults to any issuer.")
+	fs.StringVar(&opts.Reason, "reason", "", "Reason for renewing, such as the name of the migration, recorded on the Certificates renewed. Certificates already renewed for the same reason are skipped, so that an interrupted migration can be resumed. Required.")
+	fs.IntVar(&opts.Limit, "limit", 0, "Renew at most this many Certificates, to migrate in batches. Defaults to no limit.")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Only report the Certificates that would be renewed.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if opts.Reason == "" {
+		return errors.New("--reason is required")
+	}
+	switch opts.IssuerKind {
+	case "", "OriginIssuer", "ClusterOriginIssuer":
+	default:
+		return fmt.Errorf("invalid value for --issuer-kind: %q must be OriginIssuer or ClusterOriginIssuer", opts.IssuerKind)
+	}
+	if opts.Limit < 0 {
+		return fmt.Errorf("invalid value for --limit: %d must not be negative", opts.Limit)
+	}
+
+	c, err := newClient(*kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	return reissue(context.Background(), c, opts, stdout)
+}
+
+// reissue renews the Certificates of the issuers matching the options, by
+// setting their Issuing condition as cmctl renew does, and records the reason
+// in their ReissueAnnotation. Certificates already being issued, or already
+// renewed for the same reason, are skipped.
+func reissue(ctx context.Context, c client.Client, opts reissueOptions, out io.Writer) error {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid value for --selector: %w", err)
+	}
+
+	suffix := ""
+	if opts.DryRun {
+		suffix = " (dry run)"
+	}
+
+	var crts certmanager.CertificateList
+	if err := c.List(ctx, &crts, client.InNamespace(opts.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return fmt.Errorf("listing Certificates: %w", err)
+	}
+
+	renewed := 0
+	for i := range crts.Items {
+		crt := &crts.Items[i]
+		if !issuedBy(crt, opts.IssuerKind, opts.IssuerName) || crt.Annotations[v1.ReissueAnnotation] == opts.Reason {
+			continue
+		}
+
+		if cmutil.CertificateHasCondition(crt, certmanager.CertificateCondition{Type: certmanager.CertificateConditionIssuing, Status: cmmeta.ConditionTrue}) {
+			fmt.Fprintf(out, "certificate %s/%s skipped, already being issued\n", crt.Namespace, crt.Name)
+			continue
+		}
+
+		if opts.Limit > 0 && renewed >= opts.Limit {
+			break
+		}
+		renewed++
+
+		if !opts.DryRun {
+			// The annotation is only recorded once renewal was triggered, so
+			// that Certificates failing in between are renewed on the next
+			// run.
+			cmutil.SetCertificateCondition(crt, crt.Generation, certmanager.CertificateConditionIssuing, cmmeta.ConditionTrue, manuallyTriggeredReason, fmt.Sprintf("Certificate re-issuance manually triggered by originca reissue: %s", opts.Reason))
+			if err := c.Status().Update(ctx, crt); err != nil {
+				return fmt.Errorf("certificate %s/%s: %w", crt.Namespace, crt.Name, err)
+			}
+
+			metav1.SetMetaDataAnnotation(&crt.ObjectMeta, v1.ReissueAnnotation, opts.Reason)
+			if err := c.Update(ctx, crt); err != nil {
+				return fmt.Errorf("certificate %s/%s: %w", crt.Namespace, crt.Name, err)
+			}
+		}
+
+		fmt.Fprintf(out, "certificate %s/%s renewed%s\n", crt.Namespace, crt.Name, suffix)
+	}
+
+	return nil
+}
+
+// issuedBy reports whether the Certificate is issued by an OriginIssuer or
+// ClusterOriginIssuer of the kind and name, either of which may be empty to
+// match any.
+func issuedBy(crt *certmanager.Certificate, kind, name string) bool {
+	ref := crt.Spec.IssuerRef
+	if ref.Group != v1.GroupVersion.Group {
+		return false
+	}
+
+	refKind := ref.Kind
+	if refKind == "" {
+		refKind = "OriginIssuer"
+	}
+
+	return (kind == "" || kind == refKind) && (name == "" || name == ref.Name)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReissue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NilError(t, certmanager.AddToScheme(scheme))
+
+	certificate := func(namespace, name string, ref cmmeta.ObjectReference, mods ...func(*certmanager.Certificate)) *certmanager.Certificate {
+		crt := &certmanager.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": "web"}},
+			Spec:       certmanager.CertificateSpec{IssuerRef: ref},
+		}
+		for _, mod := range mods {
+			mod(crt)
+		}
+
+		return crt
+	}
+	issuer := cmmeta.ObjectReference{Group: v1.GroupVersion.Group, Kind: "OriginIssuer", Name: "prod"}
+	clusterIssuer := cmmeta.ObjectReference{Group: v1.GroupVersion.Group, Kind: "ClusterOriginIssuer", Name: "prod"}
+
+	objects := []*certmanager.Certificate{
+		certificate("default", "a", issuer),
+		certificate("default", "b", clusterIssuer),
+		certificate("default", "c", issuer, func(crt *certmanager.Certificate) { crt.Labels = nil }),
+		certificate("default", "d", cmmeta.ObjectReference{Group: "cert-manager.io", Kind: "Issuer", Name: "prod"}),
+		certificate("default", "e", issuer, func(crt *certmanager.Certificate) {
+			crt.Annotations = map[string]string{v1.ReissueAnnotation: "rsa-to-ecc"}
+		}),
+		certificate("default", "f", issuer, func(crt *certmanager.Certificate) {
+			cmutil.SetCertificateCondition(crt, 0, certmanager.CertificateConditionIssuing, cmmeta.ConditionTrue, "Expired", "")
+		}),
+		certificate("other", "g", issuer),
+	}
+
+	tests := []struct {
+		name    string
+		opts    reissueOptions
+		renewed []string
+		output  string
+	}{
+		{
+			name:    "selector",
+			opts:    reissueOptions{Selector: "app=web", Reason: "rsa-to-ecc"},
+			renewed: []string{"default/a", "default/b", "other/g"},
+			output:  "certificate default/a renewed\ncertificate default/b renewed\ncertificate default/f skipped, already being issued\ncertificate other/g renewed\n",
+		},
+		{
+			name:    "issuer",
+			opts:    reissueOptions{Namespace: "default", IssuerKind: "OriginIssuer", IssuerName: "prod", Reason: "rsa-to-ecc"},
+			renewed: []string{"default/a", "default/c"},
+			output:  "certificate default/a renewed\ncertificate default/c renewed\ncertificate default/f skipped, already being issued\n",
+		},
+		{
+			name:    "limit",
+			opts:    reissueOptions{Reason: "rsa-to-ecc", Limit: 1},
+			renewed: []string{"default/a"},
+			output:  "certificate default/a renewed\n",
+		},
+		{
+			name:   "dry run",
+			opts:   reissueOptions{Namespace: "other", Reason: "rsa-to-ecc", DryRun: true},
+			output: "certificate other/g renewed (dry run)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&certmanager.Certificate{})
+			for _, obj := range objects {
+				builder = builder.WithObjects(obj.DeepCopy())
+			}
+			c := builder.Build()
+
+			var out bytes.Buffer
+			assert.NilError(t, reissue(context.Background(), c, tt.opts, &out))
+			assert.Equal(t, out.String(), tt.output)
+
+			var renewed []string
+			for _, obj := range objects {
+				crt := &certmanager.Certificate{}
+				assert.NilError(t, c.Get(context.Background(), types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}, crt))
+
+				cond := cmutil.GetCertificateCondition(crt, certmanager.CertificateConditionIssuing)
+				if cond == nil || cond.Reason != manuallyTriggeredReason {
+					continue
+				}
+
+				assert.Equal(t, crt.Annotations[v1.ReissueAnnotation], tt.opts.Reason)
+				renewed = append(renewed, crt.Namespace+"/"+crt.Name)
+			}
+			assert.DeepEqual(t, renewed, tt.renewed)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+// Package crds embeds the CustomResourceDefinitions of the OriginIssuer and
+// ClusterOriginIssuer resources, as generated by controller-gen, so that the
+// controller can install them.
+package crds
+
+import "embed"
+
+// FS holds the CRD manifests.
+//
+//go:embed *.yaml
+var FS embed.FS
@@ -0,0 +1,76 @@
+package cfapi
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// DefaultClientIdleTimeout is how long cached API clients are kept without
+// being used, so that clients of rotated credentials are eventually dropped.
+const DefaultClientIdleTimeout = time.Hour
+
+type cachedClient struct {
+	api      Interface
+	lastUsed time.Time
+}
+
+// WithClientCache returns a Factory reusing the API clients created by f for
+// the same credentials, so that their HTTP connections, rate limiting and
+// retry state are shared across reconciles rather than rebuilt for each.
+// Clients are keyed by a hash of the credentials, so the cache doesn't hold
+// them in a second place, and dropped once unused for the idle timeout. The
+// clients created by f must be safe for concurrent use.
+func WithClientCache(f Factory, idle time.Duration, clock clock.Clock) Factory {
+	var (
+		mu      sync.Mutex
+		clients = make(map[[sha256.Size]byte]*cachedClient)
+	)
+
+	return FactoryFunc(func(creds Credentials) (Interface, error) {
+		key := credentialsKey(creds)
+		now := clock.Now()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for k, c := range clients {
+			if now.Sub(c.lastUsed) > idle {
+				delete(clients, k)
+			}
+		}
+
+		if c, ok := clients[key]; ok {
+			c.lastUsed = now
+
+			return c.api, nil
+		}
+
+		api, err := f.APIWith(creds)
+		if err != nil {
+			return nil, err
+		}
+
+		clients[key] = &cachedClient{api: api, lastUsed: now}
+
+		return api, nil
+	})
+}
+
+// credentialsKey hashes the credentials, separating their fields so that
+// different credentials can't collide by concatenation.
+func credentialsKey(creds Credentials) [sha256.Size]byte {
+	h := sha256.New()
+	for _, field := range [][]byte{creds.ServiceKey, creds.APIToken, []byte(creds.Endpoint)} {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write(field)
+	}
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	return key
+}
@@ -0,0 +1,58 @@
+package cfapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestWithClientCache(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Now())
+
+	var created []string
+	var calls []string
+	f := WithClientCache(FactoryFunc(func(creds Credentials) (Interface, error) {
+		name := string(creds.ServiceKey) + string(creds.APIToken)
+		if name == "invalid" {
+			return nil, errors.New("invalid credentials")
+		}
+
+		created = append(created, name)
+
+		return fakeAPI{name: name, calls: &calls}, nil
+	}), time.Hour, clock)
+
+	a, err := f.APIWith(Credentials{ServiceKey: []byte("v1.0-a")})
+	assert.NilError(t, err)
+	b, err := f.APIWith(Credentials{ServiceKey: []byte("v1.0-a")})
+	assert.NilError(t, err)
+	assert.Equal(t, a, b)
+	assert.DeepEqual(t, created, []string{"v1.0-a"})
+
+	// Credentials are told apart by every field.
+	_, err = f.APIWith(Credentials{APIToken: []byte("v1.0-a")})
+	assert.NilError(t, err)
+	_, err = f.APIWith(Credentials{ServiceKey: []byte("v1.0-a"), Endpoint: "https://gateway.example.com"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, created, []string{"v1.0-a", "v1.0-a", "v1.0-a"})
+
+	// Failures are not cached.
+	_, err = f.APIWith(Credentials{APIToken: []byte("invalid")})
+	assert.Error(t, err, "invalid credentials")
+	_, err = f.APIWith(Credentials{APIToken: []byte("invalid")})
+	assert.Error(t, err, "invalid credentials")
+
+	// Clients in use are kept, idle clients are dropped.
+	clock.Step(45 * time.Minute)
+	_, err = f.APIWith(Credentials{ServiceKey: []byte("v1.0-a")})
+	assert.NilError(t, err)
+	clock.Step(45 * time.Minute)
+	_, err = f.APIWith(Credentials{ServiceKey: []byte("v1.0-a")})
+	assert.NilError(t, err)
+	_, err = f.APIWith(Credentials{APIToken: []byte("v1.0-a")})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, created, []string{"v1.0-a", "v1.0-a", "v1.0-a", "v1.0-a"})
+}
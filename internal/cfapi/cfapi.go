@@ -4,33 +4,69 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"k8s.io/utils/clock"
 )
 
+// Interface is the subset of the Cloudflare API used by the issuers. The
+// context of each call may carry Metadata identifying the Kubernetes objects
+// the call is made on behalf of, see MetadataFromContext.
 type Interface interface {
 	Sign(context.Context, *SignRequest) (*SignResponse, error)
+	Verify(context.Context) error
+	Revoke(context.Context, string) error
+	List(context.Context, *ListRequest) (*ListResponse, error)
 }
 
 type Client struct {
-	serviceKey []byte
-	client     *http.Client
-	endpoint   string
+	creds     Credentials
+	client    *http.Client
+	endpoint  string
+	endpoints *Endpoints
+	retry     RetryPolicy
+	limiter   *RateLimiter
+	limiters  *RateLimiters
+	clock     clock.Clock
+	zoneCache *zoneCache
 }
 
-func New(serviceKey []byte, options ...Options) *Client {
+func New(creds Credentials, options ...Options) *Client {
 	c := &Client{
-		serviceKey: serviceKey,
-		client:     http.DefaultClient,
-		endpoint:   "https://api.cloudflare.com/client/v4/certificates",
+		creds:    creds,
+		client:   http.DefaultClient,
+		endpoint: "https://api.cloudflare.com/client/v4/certificates",
+		retry:    DefaultRetryPolicy(),
+		clock:    clock.RealClock{},
 	}
 
 	for _, opt := range options {
 		opt(c)
 	}
 
+	if c.limiters != nil {
+		c.limiter = c.limiters.For(creds)
+	}
+
+	// An endpoint that fails to parse is kept as is, failing every request
+	// rather than silently sending them to another endpoint.
+	if creds.Endpoint != "" {
+		c.endpoint = creds.Endpoint
+		c.endpoints = nil
+
+		if opt, err := WithEndpoint(creds.Endpoint); err == nil {
+			opt(c)
+		}
+	}
+
 	return c
 }
 
@@ -42,13 +78,49 @@ func WithClient(client *http.Client) Options {
 	}
 }
 
+// WithRetryPolicy overrides how requests failing with transient errors are
+// retried.
+func WithRetryPolicy(policy RetryPolicy) Options {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithRateLimiter shares the rate limiting state reported by the Cloudflare
+// API with other clients using the same RateLimiter.
+func WithRateLimiter(limiter *RateLimiter) Options {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// WithRateLimiters shares the rate limiting state reported by the Cloudflare
+// API with other clients using the same credentials, overriding
+// WithRateLimiter.
+func WithRateLimiters(limiters *RateLimiters) Options {
+	return func(c *Client) {
+		c.limiters = limiters
+	}
+}
+
+// WithClock sets the clock used to wait between retries and to track rate
+// limits.
+func WithClock(clock clock.Clock) Options {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WithEndpoint sends requests to the Cloudflare API at endpoint. The path of
+// the endpoint, such as that of a gateway serving the API under a prefix, is
+// kept, as with Endpoints.
 func WithEndpoint(endpoint string) (Options, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	u.Path = "/client/v4/certificates"
+	u = u.JoinPath("client/v4/certificates")
 
 	return func(c *Client) {
 		c.endpoint = u.String()
@@ -70,23 +142,158 @@ type SignResponse struct {
 	Type        string    `json:"request_type"`
 	Validity    int       `json:"requested_validity"`
 	CSR         string    `json:"csr"`
+
+	// RayID is the Cloudflare Ray ID of the response signing the
+	// certificate, identifying the request to Cloudflare support.
+	RayID string `json:"-"`
+}
+
+// ListRequest selects a page of the Origin CA certificates of a zone. Pages
+// are numbered from 1.
+type ListRequest struct {
+	ZoneID  string
+	Page    int
+	PerPage int
+}
+
+// ListResponse is a page of the Origin CA certificates of a zone.
+type ListResponse struct {
+	Certificates []SignResponse
+	TotalCount   int
 }
 
 type APIResponse struct {
-	Success  bool            `json:"success"`
-	Errors   []APIError      `json:"errors"`
-	Messages []string        `json:"messages"`
-	Result   json.RawMessage `json:"result"`
+	Success    bool              `json:"success"`
+	Errors     []APIError        `json:"errors"`
+	Messages   []ResponseMessage `json:"messages"`
+	Result     json.RawMessage   `json:"result"`
+	ResultInfo *ResultInfo       `json:"result_info,omitempty"`
 }
 
-type APIError struct {
-	Code    int    `json:"code"`
+// apiError returns the first error of the failed response, carrying the
+// other errors and the messages of the response, or an error of its HTTP
+// status when it has none.
+func (a *APIResponse) apiError(resp *http.Response, rayID string, now time.Time) *APIError {
+	if len(a.Errors) == 0 {
+		return statusError(resp, rayID, now)
+	}
+
+	err := &a.Errors[0]
+	err.Others = a.Errors[1:]
+	err.Messages = a.Messages
+	err.RayID = rayID
+	err.StatusCode = resp.StatusCode
+	err.RetryAfter = retryAfter(resp, now)
+	return err
+}
+
+// ResponseMessage is a message of a response of the Cloudflare API, or a
+// cause in the error chain of one of its errors.
+type ResponseMessage struct {
+	Code    int    `json:"code,omitempty"`
 	Message string `json:"message"`
-	RayID   string `json:"-"`
 }
 
+// UnmarshalJSON decodes messages given as objects, or as bare strings, as
+// some Cloudflare APIs do.
+func (m *ResponseMessage) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*m = ResponseMessage{Message: message}
+		return nil
+	}
+
+	type plain ResponseMessage
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+func (m ResponseMessage) String() string {
+	if m.Code == 0 {
+		return m.Message
+	}
+
+	return fmt.Sprintf("code=%d message=%s", m.Code, m.Message)
+}
+
+// ResultInfo describes the page of a paginated result.
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+}
+
+type APIError struct {
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	RayID      string `json:"-"`
+	StatusCode int    `json:"-"`
+
+	// ErrorChain are the causes of the error, such as the hostname of a
+	// request not being found in any zone, which the message of the error
+	// itself often leaves out.
+	ErrorChain []ResponseMessage `json:"error_chain,omitempty"`
+
+	// Others are the errors of the response following this one, and
+	// Messages its messages.
+	Others   []APIError        `json:"-"`
+	Messages []ResponseMessage `json:"-"`
+
+	// RetryAfter is the delay asked for by the Retry-After header of the
+	// response, if any.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Error renders the error followed by its causes, the other errors of the
+// response and its messages, so that conditions built from it explain why
+// the request failed.
 func (a *APIError) Error() string {
-	return fmt.Sprintf("Cloudflare API Error code=%d message=%s ray_id=%s", a.Code, a.Message, a.RayID)
+	var b strings.Builder
+	b.WriteString("Cloudflare API Error ")
+	a.describe(&b)
+	for i := range a.Others {
+		b.WriteString("; ")
+		a.Others[i].describe(&b)
+	}
+	if len(a.Messages) > 0 {
+		messages := make([]string, 0, len(a.Messages))
+		for _, m := range a.Messages {
+			messages = append(messages, m.String())
+		}
+		fmt.Fprintf(&b, " messages=[%s]", strings.Join(messages, "; "))
+	}
+	fmt.Fprintf(&b, " ray_id=%s", a.RayID)
+
+	return b.String()
+}
+
+func (a *APIError) describe(b *strings.Builder) {
+	fmt.Fprintf(b, "code=%d message=%s", a.Code, a.Message)
+	for _, cause := range a.ErrorChain {
+		fmt.Fprintf(b, ": %s", cause)
+	}
+}
+
+// IsAuthError reports whether err is an API error rejecting the client's
+// credentials.
+func IsAuthError(err error) bool {
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	return apiError.StatusCode == http.StatusUnauthorized || apiError.StatusCode == http.StatusForbidden
+}
+
+// IsOriginDBWriteError reports whether err is an API error failing to store
+// the signed certificate.
+func IsOriginDBWriteError(err error) bool {
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	return apiError.Code == originDBWriteErrorCode
 }
 
 func (c *Client) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
@@ -95,16 +302,34 @@ func (c *Client) Sign(ctx context.Context, req *SignRequest) (*SignResponse, err
 		return nil, err
 	}
 
-	r, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(p))
+	var signResp *SignResponse
+	err = c.withRetry(ctx, false, func() error {
+		var err error
+		signResp, err = c.sign(ctx, p)
+		return err
+	})
+
+	return signResp, err
+}
+
+func (c *Client) sign(ctx context.Context, p []byte) (*SignResponse, error) {
+	var wrote atomic.Bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { wrote.Store(true) },
+	})
+
+	r, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(p))
 	if err != nil {
 		return nil, err
 	}
 
-	r.Header.Add("User-Agent", "github.com/cloudflare/origin-ca-issuer")
-	r.Header.Add("X-Auth-User-Service-Key", string(c.serviceKey))
-
-	resp, err := c.client.Do(r)
+	resp, err := c.do(r)
 	if err != nil {
+		var rateLimited *RateLimitError
+		if !wrote.Load() && ctx.Err() == nil && !errors.As(err, &rateLimited) {
+			return nil, &notSentError{err: err}
+		}
+
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -113,23 +338,201 @@ func (c *Client) Sign(ctx context.Context, req *SignRequest) (*SignResponse, err
 
 	api := APIResponse{}
 	if err := json.NewDecoder(resp.Body).Decode(&api); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, statusError(resp, rayID, c.clock.Now())
+		}
+
 		return nil, err
 	}
 
 	if !api.Success {
-		err := &api.Errors[0]
-		err.RayID = rayID
-		return nil, err
+		return nil, api.apiError(resp, rayID, c.clock.Now())
 	}
 
 	signResp := SignResponse{}
 	if err := json.Unmarshal(api.Result, &signResp); err != nil {
 		return nil, err
 	}
+	signResp.RayID = rayID
 
 	return &signResp, nil
 }
 
+// Verify checks the client's credentials are accepted by the Cloudflare API by
+// requesting the list of Origin CA certificates. Only authentication failures
+// are reported, the response is otherwise discarded.
+func (c *Client) Verify(ctx context.Context) error {
+	r, err := http.NewRequestWithContext(ctx, "GET", c.endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+
+	rayID := resp.Header.Get("CF-Ray")
+
+	api := APIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&api); err != nil {
+		return statusError(resp, rayID, c.clock.Now())
+	}
+
+	return api.apiError(resp, rayID, c.clock.Now())
+}
+
+// Revoke revokes the Origin CA certificate with the given ID. Certificates that
+// no longer exist are treated as already revoked.
+func (c *Client) Revoke(ctx context.Context, id string) error {
+	return c.withRetry(ctx, true, func() error {
+		return c.revoke(ctx, id)
+	})
+}
+
+func (c *Client) revoke(ctx context.Context, id string) error {
+	r, err := http.NewRequestWithContext(ctx, "DELETE", c.endpoint+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	rayID := resp.Header.Get("CF-Ray")
+
+	api := APIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&api); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return statusError(resp, rayID, c.clock.Now())
+		}
+
+		return err
+	}
+
+	if !api.Success {
+		return api.apiError(resp, rayID, c.clock.Now())
+	}
+
+	return nil
+}
+
+// List returns a page of the Origin CA certificates of a zone, and the number
+// of certificates of the zone.
+func (c *Client) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	var listResp *ListResponse
+	err := c.withRetry(ctx, true, func() error {
+		var err error
+		listResp, err = c.list(ctx, req)
+		return err
+	})
+
+	return listResp, err
+}
+
+func (c *Client) list(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	query := url.Values{}
+	query.Set("zone_id", req.ZoneID)
+	if req.Page > 0 {
+		query.Set("page", strconv.Itoa(req.Page))
+	}
+	if req.PerPage > 0 {
+		query.Set("per_page", strconv.Itoa(req.PerPage))
+	}
+
+	r, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rayID := resp.Header.Get("CF-Ray")
+
+	api := APIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&api); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, statusError(resp, rayID, c.clock.Now())
+		}
+
+		return nil, err
+	}
+
+	if !api.Success {
+		return nil, api.apiError(resp, rayID, c.clock.Now())
+	}
+
+	listResp := ListResponse{}
+	if err := json.Unmarshal(api.Result, &listResp.Certificates); err != nil {
+		return nil, err
+	}
+
+	listResp.TotalCount = len(listResp.Certificates)
+	if api.ResultInfo != nil {
+		listResp.TotalCount = api.ResultInfo.TotalCount
+	}
+
+	return &listResp, nil
+}
+
+// statusError describes a failed response which carries no Cloudflare API
+// error, such as one returned by a proxy, using its HTTP status.
+func statusError(resp *http.Response, rayID string, now time.Time) *APIError {
+	return &APIError{
+		Code:       resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+		RayID:      rayID,
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter(resp, now),
+	}
+}
+
+// do authenticates and sends the request, unless the API is currently rate
+// limiting requests, and records any rate limit the response carries.
+func (c *Client) do(r *http.Request) (*http.Response, error) {
+	if wait := c.limiter.delay(c.clock.Now()); wait > 0 {
+		return nil, &RateLimitError{RetryAfter: wait}
+	}
+
+	c.authenticate(r)
+
+	resp, err := c.send(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c.limiter.observe(resp, c.clock.Now())
+
+	return resp, nil
+}
+
+// authenticate adds the headers identifying the client and its credentials to
+// the request.
+func (c *Client) authenticate(r *http.Request) {
+	r.Header.Add("User-Agent", "github.com/cloudflare/origin-ca-issuer")
+	if len(c.creds.APIToken) > 0 {
+		r.Header.Add("Authorization", "Bearer "+string(c.creds.APIToken))
+	} else {
+		r.Header.Add("X-Auth-User-Service-Key", string(c.creds.ServiceKey))
+	}
+}
+
 // adapted from http://choly.ca/post/go-json-marshalling/
 func (r *SignResponse) UnmarshalJSON(p []byte) error {
 	type resp SignResponse
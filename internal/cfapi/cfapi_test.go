@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
 )
 
 func TestSignResponse_Unmarshal(t *testing.T) {
@@ -100,6 +102,7 @@ func TestSign(t *testing.T) {
 				Type:        "origin-ecc",
 				Validity:    7,
 				CSR:         "-----BEGIN CERTIFICATE REQUEST-----\n-----END CERTIFICATE REQUEST-----",
+				RayID:       "0123456789abcdef-ABC",
 			},
 			error: "",
 		},
@@ -118,6 +121,25 @@ func TestSign(t *testing.T) {
 			error:     "Cloudflare API Error code=9001 message=Over Nine Thousand! ray_id=0123456789abcdef-ABC",
 			errorType: &APIError{},
 		},
+		{
+			name: "API error chain",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("cf-ray", "0123456789abcdef-ABC")
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, `{
+	"success": false,
+	"errors": [
+		{"code": 1010, "message": "Failed to validate requested hostname", "error_chain": [{"code": 1413, "message": "hostname not found in zone"}]},
+		{"code": 1001, "message": "Invalid request type"}
+	],
+	"messages": [{"code": 10000, "message": "Certificate request incomplete"}, "see the documentation"],
+	"result": null
+}`)
+			}),
+			response:  nil,
+			error:     "Cloudflare API Error code=1010 message=Failed to validate requested hostname: code=1413 message=hostname not found in zone; code=1001 message=Invalid request type messages=[code=10000 message=Certificate request incomplete; see the documentation] ray_id=0123456789abcdef-ABC",
+			errorType: &APIError{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -126,7 +148,7 @@ func TestSign(t *testing.T) {
 			ts := httptest.NewTLSServer(tt.handler)
 			defer ts.Close()
 
-			client := New([]byte("v1.0-FFFF-FFFF"),
+			client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
 				WithClient(ts.Client()),
 				Must(WithEndpoint(ts.URL)),
 			)
@@ -150,6 +172,223 @@ func TestSign(t *testing.T) {
 
 }
 
+func TestSign_Authentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		creds   Credentials
+		headers map[string]string
+	}{
+		{
+			name:  "service key",
+			creds: Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+			headers: map[string]string{
+				"X-Auth-User-Service-Key": "v1.0-FFFF-FFFF",
+				"Authorization":           "",
+			},
+		},
+		{
+			name:  "api token",
+			creds: Credentials{APIToken: []byte("token")},
+			headers: map[string]string{
+				"X-Auth-User-Service-Key": "",
+				"Authorization":           "Bearer token",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					assert.Equal(t, r.Header.Get(k), v, "header %s", k)
+				}
+
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": {"expires_on": "2020-12-25T06:27:00Z"}}`)
+			}))
+			defer ts.Close()
+
+			client := New(tt.creds,
+				WithClient(ts.Client()),
+				Must(WithEndpoint(ts.URL)),
+			)
+			_, err := client.Sign(context.Background(), &SignRequest{})
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		error   string
+	}{
+		{
+			name: "accepted",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, r.Method, "GET")
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": []}`)
+			}),
+		},
+		{
+			name: "unrelated error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, `{"success": false, "errors": [{"code": 1004, "message": "zone_id required"}], "messages": [], "result": null}`)
+			}),
+		},
+		{
+			name: "rejected",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("cf-ray", "0123456789abcdef-ABC")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}], "messages": [], "result": null}`)
+			}),
+			error: "Cloudflare API Error code=10000 message=Authentication error ray_id=0123456789abcdef-ABC",
+		},
+		{
+			name: "rejected without body",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}),
+			error: "Cloudflare API Error code=401 message=Unauthorized ray_id=",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(tt.handler)
+			defer ts.Close()
+
+			client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+				WithClient(ts.Client()),
+				Must(WithEndpoint(ts.URL)),
+			)
+
+			err := client.Verify(context.Background())
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+			} else {
+				assert.NilError(t, err)
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		error   string
+	}{
+		{
+			name: "revoked",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, r.Method, "DELETE")
+				assert.Equal(t, r.URL.Path, "/client/v4/certificates/9001")
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "9001"}}`)
+			}),
+		},
+		{
+			name: "not found",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			}),
+		},
+		{
+			name: "API error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("cf-ray", "0123456789abcdef-ABC")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}], "messages": [], "result": null}`)
+			}),
+			error: "Cloudflare API Error code=10000 message=Authentication error ray_id=0123456789abcdef-ABC",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(tt.handler)
+			defer ts.Close()
+
+			client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+				WithClient(ts.Client()),
+				Must(WithEndpoint(ts.URL)),
+			)
+
+			err := client.Revoke(context.Background(), "9001")
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+			} else {
+				assert.NilError(t, err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		expected *ListResponse
+		error    string
+	}{
+		{
+			name: "page",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, r.Method, "GET")
+				assert.Equal(t, r.URL.Path, "/client/v4/certificates")
+				assert.Equal(t, r.URL.RawQuery, "page=2&per_page=1&zone_id=023e105f4ecef8ad9ca31a8372d0c353")
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "9001", "hostnames": ["example.com"], "request_type": "origin-rsa", "requested_validity": 7, "expires_on": "2020-01-08 00:00:00 +0000 UTC"}], "result_info": {"page": 2, "per_page": 1, "count": 1, "total_count": 12}}`)
+			}),
+			expected: &ListResponse{
+				Certificates: []SignResponse{{
+					Id:         "9001",
+					Hostnames:  []string{"example.com"},
+					Type:       "origin-rsa",
+					Validity:   7,
+					Expiration: time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC),
+				}},
+				TotalCount: 12,
+			},
+		},
+		{
+			name: "API error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("cf-ray", "0123456789abcdef-ABC")
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, `{"success": false, "errors": [{"code": 1000, "message": "Invalid zone"}], "messages": [], "result": null}`)
+			}),
+			error: "Cloudflare API Error code=1000 message=Invalid zone ray_id=0123456789abcdef-ABC",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(tt.handler)
+			defer ts.Close()
+
+			client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+				WithClient(ts.Client()),
+				Must(WithEndpoint(ts.URL)),
+			)
+
+			resp, err := client.List(context.Background(), &ListRequest{ZoneID: "023e105f4ecef8ad9ca31a8372d0c353", Page: 2, PerPage: 1})
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, resp, tt.expected, cmpopts.EquateApproxTime(0))
+		})
+	}
+}
+
 func Must(opt Options, err error) Options {
 	if err != nil {
 		panic("option constructo returned error " + err.Error())
@@ -157,3 +396,105 @@ func Must(opt Options, err error) Options {
 
 	return opt
 }
+
+func TestIsAuthError(t *testing.T) {
+	assert.Assert(t, IsAuthError(&APIError{Code: 10000, StatusCode: http.StatusForbidden}))
+	assert.Assert(t, IsAuthError(fmt.Errorf("unable to sign request: %w", &APIError{StatusCode: http.StatusUnauthorized})))
+	assert.Assert(t, !IsAuthError(&APIError{Code: 1010, StatusCode: http.StatusBadRequest}))
+	assert.Assert(t, !IsAuthError(context.DeadlineExceeded))
+}
+
+func TestZones(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		expected []Zone
+		error    string
+	}{
+		{
+			name: "zone",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, r.Method, "GET")
+				assert.Equal(t, r.URL.Path, "/client/v4/zones")
+				assert.Equal(t, r.URL.RawQuery, "name=example.com")
+				assert.Equal(t, r.Header.Get("Authorization"), "Bearer api-token")
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "023e105f4ecef8ad9ca31a8372d0c353", "name": "example.com", "status": "active"}]}`)
+			}),
+			expected: []Zone{{ID: "023e105f4ecef8ad9ca31a8372d0c353", Name: "example.com", Status: "active"}},
+		},
+		{
+			name: "paused zone",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "023e105f4ecef8ad9ca31a8372d0c353", "name": "example.com", "status": "active", "paused": true}]}`)
+			}),
+			expected: []Zone{{ID: "023e105f4ecef8ad9ca31a8372d0c353", Name: "example.com", Status: "active", Paused: true}},
+		},
+		{
+			name: "no zone",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": []}`)
+			}),
+			expected: []Zone{},
+		},
+		{
+			name: "API error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("cf-ray", "0123456789abcdef-ABC")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `{"success": false, "errors": [{"code": 9109, "message": "Unauthorized to access requested resource"}], "messages": [], "result": null}`)
+			}),
+			error: "Cloudflare API Error code=9109 message=Unauthorized to access requested resource ray_id=0123456789abcdef-ABC",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(tt.handler)
+			defer ts.Close()
+
+			client := New(Credentials{APIToken: []byte("api-token")},
+				WithClient(ts.Client()),
+				Must(WithEndpoint(ts.URL)),
+			)
+
+			zones, err := client.Zones(context.Background(), "example.com")
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, zones, tt.expected)
+		})
+	}
+}
+
+func TestZones_Cache(t *testing.T) {
+	var lookups int
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": [{"id": "023e105f4ecef8ad9ca31a8372d0c353", "name": "example.com", "status": "active"}]}`)
+	}))
+	defer ts.Close()
+
+	clock := fakeClock.NewFakeClock(time.Now())
+	client := New(Credentials{APIToken: []byte("api-token")},
+		WithClient(ts.Client()),
+		WithClock(clock),
+		WithZoneCache(time.Minute),
+		Must(WithEndpoint(ts.URL)),
+	)
+
+	for i := 0; i < 2; i++ {
+		zones, err := client.Zones(context.Background(), "example.com")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, zones, []Zone{{ID: "023e105f4ecef8ad9ca31a8372d0c353", Name: "example.com", Status: "active"}})
+	}
+	assert.Equal(t, lookups, 1)
+
+	clock.Step(time.Minute)
+	_, err := client.Zones(context.Background(), "example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lookups, 2)
+}
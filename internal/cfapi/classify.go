@@ -0,0 +1,85 @@
+package cfapi
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// ErrorClass is how an error of the Cloudflare API is handled.
+type ErrorClass string
+
+const (
+	// ErrorClassTemporary errors are retried by the client, and once its
+	// retries are exhausted returned as a TransientError, which controllers
+	// requeue after a delay.
+	ErrorClassTemporary ErrorClass = "temporary"
+
+	// ErrorClassPermanent errors are never retried, whatever the HTTP status
+	// they are returned with, and fail the CertificateRequest.
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+// ErrorClasses classifies the errors of the Cloudflare API by their code.
+// Errors with a code not classified are temporary if their HTTP status is
+// retryable, and permanent otherwise.
+type ErrorClasses map[int]ErrorClass
+
+// DefaultErrorClasses returns the classification used unless overridden.
+// Failures to store the signed certificate are temporary.
+func DefaultErrorClasses() ErrorClasses {
+	return ErrorClasses{
+		originDBWriteErrorCode: ErrorClassTemporary,
+	}
+}
+
+// ParseErrorClasses parses the classes of error codes, keyed by code, such
+// as {"1100": "temporary", "1010": "permanent"}.
+func ParseErrorClasses(classes map[string]string) (ErrorClasses, error) {
+	parsed := make(ErrorClasses, len(classes))
+	for code, class := range classes {
+		c, err := strconv.Atoi(code)
+		if err != nil || c <= 0 {
+			return nil, fmt.Errorf("error code %q must be a positive integer", code)
+		}
+
+		switch ErrorClass(class) {
+		case ErrorClassTemporary, ErrorClassPermanent:
+			parsed[c] = ErrorClass(class)
+		default:
+			return nil, fmt.Errorf("class %q of error code %d must be %s or %s", class, c, ErrorClassTemporary, ErrorClassPermanent)
+		}
+	}
+
+	return parsed, nil
+}
+
+// WithErrorClasses returns the policy with the error codes reclassified,
+// overriding the class of codes it already classifies.
+func (p RetryPolicy) WithErrorClasses(classes ErrorClasses) RetryPolicy {
+	without := func(codes []int) []int {
+		var kept []int
+		for _, code := range codes {
+			if _, ok := classes[code]; !ok {
+				kept = append(kept, code)
+			}
+		}
+
+		return kept
+	}
+	p.RetryableCodes = without(p.RetryableCodes)
+	p.PermanentCodes = without(p.PermanentCodes)
+
+	for code, class := range classes {
+		switch class {
+		case ErrorClassTemporary:
+			p.RetryableCodes = append(p.RetryableCodes, code)
+		case ErrorClassPermanent:
+			p.PermanentCodes = append(p.PermanentCodes, code)
+		}
+	}
+	slices.Sort(p.RetryableCodes)
+	slices.Sort(p.PermanentCodes)
+
+	return p
+}
@@ -0,0 +1,94 @@
+package cfapi
+
+import (
+	"net/http"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseErrorClasses(t *testing.T) {
+	tests := []struct {
+		name     string
+		classes  map[string]string
+		expected ErrorClasses
+		error    string
+	}{
+		{
+			name:     "empty",
+			expected: ErrorClasses{},
+		},
+		{
+			name:     "classes",
+			classes:  map[string]string{"1100": "permanent", "1010": "temporary"},
+			expected: ErrorClasses{1100: ErrorClassPermanent, 1010: ErrorClassTemporary},
+		},
+		{
+			name:    "invalid code",
+			classes: map[string]string{"db-write": "temporary"},
+			error:   `error code "db-write" must be a positive integer`,
+		},
+		{
+			name:    "invalid class",
+			classes: map[string]string{"1100": "transient"},
+			error:   `class "transient" of error code 1100 must be temporary or permanent`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseErrorClasses(tt.classes)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tt.expected)
+		})
+	}
+}
+
+func TestRetryPolicy_WithErrorClasses(t *testing.T) {
+	policy := DefaultRetryPolicy().WithErrorClasses(ErrorClasses{
+		1100: ErrorClassPermanent,
+		1010: ErrorClassTemporary,
+		1001: ErrorClassPermanent,
+	})
+
+	assert.DeepEqual(t, policy.RetryableCodes, []int{1010})
+	assert.DeepEqual(t, policy.PermanentCodes, []int{1001, 1100})
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{
+			name: "reclassified as permanent",
+			err:  &APIError{Code: 1100, StatusCode: http.StatusOK},
+		},
+		{
+			name:      "reclassified as temporary",
+			err:       &APIError{Code: 1010, StatusCode: http.StatusBadRequest},
+			retryable: true,
+		},
+		{
+			name: "permanent despite a server error",
+			err:  &APIError{Code: 1001, StatusCode: http.StatusInternalServerError},
+		},
+		{
+			name:      "unclassified server error",
+			err:       &APIError{Code: 1002, StatusCode: http.StatusInternalServerError},
+			retryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, policy.Retryable(tt.err), tt.retryable)
+		})
+	}
+}
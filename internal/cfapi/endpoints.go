@@ -0,0 +1,254 @@
+package cfapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// Endpoints is an ordered set of Cloudflare API endpoints, such as a primary
+// endpoint followed by regional backups, that requests fail over between. An
+// endpoint that can't be reached or fails with a server error is considered
+// unhealthy for a cooldown, during which requests are sent to the next healthy
+// endpoint. Clients sharing the Endpoints share their health, which an
+// EndpointHealthCheck can also probe outside of requests.
+//
+// The path of an endpoint, such as that of an egress proxy serving the API
+// under a prefix, is prepended to the path of each request.
+//
+// A nil Endpoints sends every request to the client's endpoint.
+type Endpoints struct {
+	urls     []*url.URL
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	unhealthy []time.Time
+}
+
+// NewEndpoints returns Endpoints failing over between the endpoints, in
+// order, each unhealthy for the cooldown after a failure.
+func NewEndpoints(endpoints []string, cooldown time.Duration) (*Endpoints, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no Cloudflare API endpoints given")
+	}
+
+	urls := make([]*url.URL, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("Cloudflare API endpoint %q must be an absolute URL", endpoint)
+		}
+
+		urls = append(urls, u)
+	}
+
+	return &Endpoints{
+		urls:      urls,
+		cooldown:  cooldown,
+		unhealthy: make([]time.Time, len(urls)),
+	}, nil
+}
+
+// order returns the indices of the endpoints to try a request against:
+// healthy endpoints in order, followed by unhealthy ones, those recovering
+// soonest first, so that a request is attempted even when every endpoint
+// recently failed.
+func (e *Endpoints) order(now time.Time) []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var healthy, unhealthy []int
+	for i := range e.urls {
+		if e.unhealthy[i].After(now) {
+			unhealthy = append(unhealthy, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+
+	sort.SliceStable(unhealthy, func(a, b int) bool {
+		return e.unhealthy[unhealthy[a]].Before(e.unhealthy[unhealthy[b]])
+	})
+
+	return append(healthy, unhealthy...)
+}
+
+// request returns a copy of r sent to the endpoint, its path prefixed by the
+// endpoint's and keeping its query.
+func (e *Endpoints) request(r *http.Request, i int) (*http.Request, error) {
+	req := r.Clone(r.Context())
+	req.URL.Scheme = e.urls[i].Scheme
+	req.URL.Host = e.urls[i].Host
+	req.URL.Path = strings.TrimSuffix(e.urls[i].Path, "/") + r.URL.Path
+	req.URL.RawPath = ""
+	req.Host = ""
+
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = body
+	}
+
+	return req, nil
+}
+
+// failed marks the endpoint unhealthy for the cooldown.
+func (e *Endpoints) failed(i int, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.unhealthy[i] = now.Add(e.cooldown)
+}
+
+// succeeded marks the endpoint healthy.
+func (e *Endpoints) succeeded(i int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.unhealthy[i] = time.Time{}
+}
+
+// WithEndpoints fails requests over between the endpoints, rather than
+// sending them to the single endpoint set with WithEndpoint.
+func WithEndpoints(endpoints *Endpoints) Options {
+	return func(c *Client) {
+		c.endpoints = endpoints
+	}
+}
+
+// send sends the request, failing over between the client's endpoints. The
+// response of the last endpoint tried is returned when every one fails.
+//
+// A POST, such as signing a certificate, only fails over when it wasn't sent
+// to the failing endpoint: a server error, or a connection lost after sending
+// it, doesn't tell whether it was processed, and sending it again could sign
+// a second certificate.
+func (c *Client) send(r *http.Request) (*http.Response, error) {
+	if c.endpoints == nil {
+		return c.client.Do(r)
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for _, i := range c.endpoints.order(c.clock.Now()) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		var req *http.Request
+		req, err = c.endpoints.request(r, i)
+		if err != nil {
+			return nil, err
+		}
+
+		var wrote atomic.Bool
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			WroteRequest: func(httptrace.WroteRequestInfo) { wrote.Store(true) },
+		}))
+
+		resp, err = c.client.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			c.endpoints.succeeded(i)
+
+			return resp, nil
+		}
+
+		// A request cancelled by the caller says nothing about the
+		// endpoint's health.
+		if r.Context().Err() != nil {
+			return resp, err
+		}
+
+		c.endpoints.failed(i, c.clock.Now())
+
+		if r.Method == http.MethodPost && wrote.Load() {
+			return resp, err
+		}
+	}
+
+	return resp, err
+}
+
+// EndpointHealthCheck probes every endpoint of Endpoints at an interval, so
+// that an endpoint going down is skipped before requests fail against it, and
+// one recovering is used again before its cooldown passed. Probes are GET
+// requests of the unauthenticated IP ranges of the Cloudflare API, an endpoint
+// answering with anything but a server error being healthy.
+type EndpointHealthCheck struct {
+	endpoints *Endpoints
+	client    *http.Client
+	interval  time.Duration
+	clock     clock.Clock
+}
+
+// NewEndpointHealthCheck returns an EndpointHealthCheck probing the endpoints
+// with the client at the interval.
+func NewEndpointHealthCheck(endpoints *Endpoints, client *http.Client, interval time.Duration, clock clock.Clock) *EndpointHealthCheck {
+	return &EndpointHealthCheck{
+		endpoints: endpoints,
+		client:    client,
+		interval:  interval,
+		clock:     clock,
+	}
+}
+
+// Start probes the endpoints until the context is cancelled.
+func (h *EndpointHealthCheck) Start(ctx context.Context) error {
+	for {
+		h.Probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.clock.After(h.interval):
+		}
+	}
+}
+
+// Probe probes every endpoint once, updating their health.
+func (h *EndpointHealthCheck) Probe(ctx context.Context) {
+	for i := range h.endpoints.urls {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.cloudflare.com/client/v4/ips", nil)
+		if err != nil {
+			return
+		}
+
+		req, err := h.endpoints.request(r, i)
+		if err != nil {
+			return
+		}
+
+		resp, err := h.client.Do(req)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			h.endpoints.succeeded(i)
+		} else {
+			h.endpoints.failed(i, h.clock.Now())
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package cfapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestNewEndpoints(t *testing.T) {
+	_, err := NewEndpoints(nil, time.Minute)
+	assert.Error(t, err, "no Cloudflare API endpoints given")
+
+	_, err = NewEndpoints([]string{"https://api.cloudflare.com", "api.example.com"}, time.Minute)
+	assert.Error(t, err, `Cloudflare API endpoint "api.example.com" must be an absolute URL`)
+}
+
+func TestSign_Failover(t *testing.T) {
+	var requests []string
+	server := func(name string, healthy *bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, name)
+			assert.Equal(t, r.URL.Path, "/client/v4/certificates")
+
+			if !*healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "%s", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`, name)
+		}))
+	}
+
+	primaryHealthy, backupHealthy := false, true
+	primary := server("primary", &primaryHealthy)
+	defer primary.Close()
+	backup := server("backup", &backupHealthy)
+	defer backup.Close()
+
+	// An endpoint that can't be reached at all.
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	clock := fakeClock.NewFakeClock(time.Now())
+	endpoints, err := NewEndpoints([]string{primary.URL, unreachable.URL, backup.URL}, time.Minute)
+	assert.NilError(t, err)
+
+	sign := func() (string, error) {
+		client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{}),
+			Must(WithEndpoint(primary.URL)),
+			WithEndpoints(endpoints),
+		)
+
+		resp, err := client.Sign(context.Background(), &SignRequest{})
+		if err != nil {
+			return "", err
+		}
+
+		return resp.Id, nil
+	}
+
+	verify := func() error {
+		client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{}),
+			Must(WithEndpoint(primary.URL)),
+			WithEndpoints(endpoints),
+		)
+
+		return client.Verify(context.Background())
+	}
+
+	// A signing request failing with a server error may have been
+	// processed, and isn't sent to another endpoint.
+	_, err = sign()
+	assert.Error(t, err, "Cloudflare API Error code=503 message=Service Unavailable ray_id=")
+	assert.DeepEqual(t, requests, []string{"primary"})
+
+	// Unhealthy endpoints are skipped during the cooldown, and requests
+	// that couldn't be sent fail over.
+	requests = nil
+	primaryHealthy = true
+	id, err := sign()
+	assert.NilError(t, err)
+	assert.Equal(t, id, "backup")
+	assert.DeepEqual(t, requests, []string{"backup"})
+
+	// And tried again once it passed.
+	requests = nil
+	clock.Step(time.Minute)
+	id, err = sign()
+	assert.NilError(t, err)
+	assert.Equal(t, id, "primary")
+	assert.DeepEqual(t, requests, []string{"primary"})
+
+	// Other requests fail over on server errors.
+	requests = nil
+	primaryHealthy = false
+	assert.NilError(t, verify())
+	assert.DeepEqual(t, requests, []string{"primary", "backup"})
+
+	// Every endpoint is tried when all of them are unhealthy.
+	requests = nil
+	backupHealthy = false
+	_ = verify()
+	assert.DeepEqual(t, requests, []string{"backup", "primary"})
+}
+
+func TestSign_EndpointPrefix(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/cloudflare/client/v4/certificates")
+
+		fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "1", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`)
+	}))
+	defer ts.Close()
+
+	endpoints, err := NewEndpoints([]string{ts.URL + "/cloudflare/"}, time.Minute)
+	assert.NilError(t, err)
+
+	client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+		WithRetryPolicy(RetryPolicy{}),
+		WithEndpoints(endpoints),
+	)
+
+	_, err = client.Sign(context.Background(), &SignRequest{})
+	assert.NilError(t, err)
+}
+
+func TestSign_CredentialsEndpointPrefix(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "1", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`)
+	}))
+	defer ts.Close()
+
+	// The endpoint of an issuer's cloudflareAPIURL keeps its path, as those
+	// of the controller's endpoints do.
+	client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF"), Endpoint: ts.URL + "/gateway/cloudflare"},
+		WithRetryPolicy(RetryPolicy{}),
+	)
+
+	_, err := client.Sign(context.Background(), &SignRequest{})
+	assert.NilError(t, err)
+	assert.NilError(t, client.Revoke(context.Background(), "1"))
+	assert.DeepEqual(t, paths, []string{"/gateway/cloudflare/client/v4/certificates", "/gateway/cloudflare/client/v4/certificates/1"})
+}
+
+func TestEndpointHealthCheck(t *testing.T) {
+	healthy := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/client/v4/ips")
+
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	clock := fakeClock.NewFakeClock(time.Now())
+	endpoints, err := NewEndpoints([]string{ts.URL}, time.Minute)
+	assert.NilError(t, err)
+
+	check := NewEndpointHealthCheck(endpoints, ts.Client(), 10*time.Second, clock)
+
+	check.Probe(context.Background())
+	assert.Equal(t, endpoints.unhealthy[0], clock.Now().Add(time.Minute))
+
+	// An endpoint recovering is used again before its cooldown passed.
+	healthy = true
+	check.Probe(context.Background())
+	assert.Equal(t, endpoints.unhealthy[0], time.Time{})
+}
+
+func TestSign_CredentialsEndpoint(t *testing.T) {
+	var requests []string
+	server := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, name)
+			assert.Equal(t, r.URL.Path, "/client/v4/certificates")
+
+			fmt.Fprintf(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "%s", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`, name)
+		}))
+	}
+
+	shared := server("shared")
+	defer shared.Close()
+	gateway := server("gateway")
+	defer gateway.Close()
+
+	endpoints, err := NewEndpoints([]string{shared.URL}, time.Minute)
+	assert.NilError(t, err)
+
+	client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF"), Endpoint: gateway.URL},
+		WithRetryPolicy(RetryPolicy{}),
+		WithEndpoints(endpoints),
+	)
+
+	resp, err := client.Sign(context.Background(), &SignRequest{})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Id, "gateway")
+	assert.DeepEqual(t, requests, []string{"gateway"})
+}
@@ -1,11 +1,54 @@
 package cfapi
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Credentials authenticate requests to the Cloudflare API. Only one of
+// ServiceKey or APIToken should be set.
+type Credentials struct {
+	// ServiceKey is an Origin CA service key, beginning with "v1.0-".
+	ServiceKey []byte
+
+	// APIToken is a scoped Cloudflare API Token.
+	APIToken []byte
+
+	// Endpoint, if set, is the Cloudflare API endpoint the credentials are
+	// used with, such as an API gateway, overriding the client's endpoints.
+	Endpoint string
+}
+
 type Factory interface {
-	APIWith([]byte) (Interface, error)
+	APIWith(Credentials) (Interface, error)
 }
 
-type FactoryFunc func([]byte) (Interface, error)
+type FactoryFunc func(Credentials) (Interface, error)
+
+func (f FactoryFunc) APIWith(creds Credentials) (Interface, error) {
+	return f(creds)
+}
+
+// ErrEndpointNotAllowed is returned when credentials name an Endpoint the
+// controller wasn't configured to allow.
+var ErrEndpointNotAllowed = errors.New("not allowed by the controller")
+
+// WithAllowedEndpoints returns a Factory refusing credentials whose Endpoint
+// isn't one of the allowed endpoints, so that issuers can only send their
+// credentials to endpoints chosen by the controller's operators. Credentials
+// without an Endpoint use the client's endpoints, and are always allowed.
+func WithAllowedEndpoints(f Factory, allowed []string) Factory {
+	endpoints := make(map[string]bool, len(allowed))
+	for _, endpoint := range allowed {
+		endpoints[strings.TrimRight(endpoint, "/")] = true
+	}
+
+	return FactoryFunc(func(creds Credentials) (Interface, error) {
+		if creds.Endpoint != "" && !endpoints[strings.TrimRight(creds.Endpoint, "/")] {
+			return nil, fmt.Errorf("Cloudflare API endpoint %s is %w", creds.Endpoint, ErrEndpointNotAllowed)
+		}
 
-func (f FactoryFunc) APIWith(serviceKey []byte) (Interface, error) {
-	return f(serviceKey)
+		return f.APIWith(creds)
+	})
 }
@@ -0,0 +1,48 @@
+package cfapi
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWithAllowedEndpoints(t *testing.T) {
+	var calls []string
+	f := WithAllowedEndpoints(FactoryFunc(func(creds Credentials) (Interface, error) {
+		return fakeAPI{name: "api", calls: &calls}, nil
+	}), []string{"https://api-gateway.example.com/"})
+
+	tests := []struct {
+		name     string
+		endpoint string
+		err      string
+	}{
+		{
+			name: "controller endpoints",
+		},
+		{
+			name:     "allowed",
+			endpoint: "https://api-gateway.example.com",
+		},
+		{
+			name:     "not allowed",
+			endpoint: "https://attacker.example.com",
+			err:      "Cloudflare API endpoint https://attacker.example.com is not allowed by the controller",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.APIWith(Credentials{APIToken: []byte("token"), Endpoint: tt.endpoint})
+			if tt.err == "" {
+				assert.NilError(t, err)
+				return
+			}
+
+			assert.Error(t, err, tt.err)
+			assert.Assert(t, errors.Is(err, ErrEndpointNotAllowed))
+		})
+	}
+}
@@ -0,0 +1,449 @@
+// Package fake implements an in-process fake of the Cloudflare Origin CA API,
+// serving the sign, revoke and list endpoints used by cfapi.Client, so that
+// the controllers can be tested end to end without calling Cloudflare.
+//
+// Certificates are signed by a CA generated for each request type, RSA for
+// origin-rsa and ECDSA for origin-ecc, whose root is available with Root.
+// Errors, such as the transient 1100 or rate limiting, are injected with
+// Fail, and returned by the next matching requests.
+package fake
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"k8s.io/utils/clock"
+)
+
+// Error codes returned by the fake, as returned by the Cloudflare API.
+const (
+	// CodeDBWrite is returned when a signed certificate could not be
+	// stored, which clients retry.
+	CodeDBWrite = 1100
+
+	// CodeInvalidCSR is returned for CSRs that can't be parsed.
+	CodeInvalidCSR = 1010
+
+	// CodeInvalidRequestType is returned for unknown request types.
+	CodeInvalidRequestType = 1002
+
+	// CodeRateLimited is returned with a 429 status when rate limiting.
+	CodeRateLimited = 971
+
+	// CodeAuthentication is returned for missing or unknown credentials.
+	CodeAuthentication = 10001
+)
+
+// path is the path of the Origin CA certificates endpoint.
+const path = "/client/v4/certificates"
+
+// defaultPerPage is the page size of lists not setting one.
+const defaultPerPage = 20
+
+// Fault is an error response injected with Fail.
+type Fault struct {
+	StatusCode int
+	Code       int
+	Message    string
+
+	// RetryAfter is sent as the Retry-After header, in seconds, if set.
+	RetryAfter time.Duration
+}
+
+// DBWriteError returns the transient error the Cloudflare API responds with
+// when a signed certificate could not be stored.
+func DBWriteError() Fault {
+	return Fault{StatusCode: http.StatusBadRequest, Code: CodeDBWrite, Message: "Failed to write certificate to Database"}
+}
+
+// RateLimited returns the error the Cloudflare API responds with when rate
+// limiting a client, asking it to retry after the duration.
+func RateLimited(retryAfter time.Duration) Fault {
+	return Fault{StatusCode: http.StatusTooManyRequests, Code: CodeRateLimited, Message: "Please wait and consider throttling your request speed", RetryAfter: retryAfter}
+}
+
+type fault struct {
+	method string
+	Fault
+}
+
+type certificate struct {
+	cfapi.SignResponse
+	revoked bool
+}
+
+// Server is a fake Cloudflare API server. Its URL is used as the endpoint of
+// cfapi clients, with WithEndpoint or the Endpoint of their Credentials.
+type Server struct {
+	*httptest.Server
+
+	// Clock sets the validity of signed certificates. It must be set before
+	// the first request.
+	Clock clock.Clock
+
+	credentials map[string]bool
+
+	mu           sync.Mutex
+	cas          map[string]*ca
+	certificates []*certificate
+	faults       []fault
+	requests     int
+}
+
+type ca struct {
+	key  crypto.Signer
+	cert *x509.Certificate
+	pem  []byte
+}
+
+// NewServer starts a Server accepting requests authenticated with one of the
+// credentials, as a service key or an API token. Any credentials are
+// accepted when none are given. The Server must be closed once done.
+func NewServer(credentials ...string) *Server {
+	s := &Server{
+		Clock:       clock.RealClock{},
+		credentials: make(map[string]bool),
+		cas:         make(map[string]*ca),
+	}
+	for _, c := range credentials {
+		s.credentials[c] = true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.handle)
+	mux.HandleFunc(path+"/", s.handle)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Fail makes the next requests of the HTTP method, such as http.MethodPost to
+// sign, fail with the faults, one request each, in order. Requests of any
+// method fail when the method is empty.
+func (s *Server) Fail(method string, faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range faults {
+		s.faults = append(s.faults, fault{method: method, Fault: f})
+	}
+}
+
+// Issued returns the certificates signed, including those since revoked, in
+// the order they were signed.
+func (s *Server) Issued() []cfapi.SignResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued := make([]cfapi.SignResponse, 0, len(s.certificates))
+	for _, c := range s.certificates {
+		issued = append(issued, c.SignResponse)
+	}
+
+	return issued
+}
+
+// Revoked returns the IDs of the certificates revoked, in the order they were
+// signed.
+func (s *Server) Revoked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revoked []string
+	for _, c := range s.certificates {
+		if c.revoked {
+			revoked = append(revoked, c.Id)
+		}
+	}
+
+	return revoked
+}
+
+// Requests returns the number of requests served, including failed ones.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// Root returns the PEM encoded root certificate of the CA signing the request
+// type, such as "origin-ecc".
+func (s *Server) Root(requestType string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ca, err := s.ca(requestType)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.pem, nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	w.Header().Set("CF-Ray", fmt.Sprintf("%016x-SJC", s.requests))
+	w.Header().Set("Content-Type", "application/json")
+
+	if !s.authenticated(r) {
+		writeError(w, http.StatusForbidden, CodeAuthentication, "Unable to authenticate request")
+
+		return
+	}
+
+	for i, f := range s.faults {
+		if f.method != "" && f.method != r.Method {
+			continue
+		}
+		s.faults = append(s.faults[:i], s.faults[i+1:]...)
+
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Seconds())))
+		}
+		writeError(w, f.StatusCode, f.Code, f.Message)
+
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, path), "/")
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		s.sign(w, r)
+	case r.Method == http.MethodGet && id == "":
+		s.list(w, r)
+	case r.Method == http.MethodDelete && id != "":
+		s.revoke(w, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, 7001, "Method not allowed")
+	}
+}
+
+func (s *Server) authenticated(r *http.Request) bool {
+	credential := r.Header.Get("X-Auth-User-Service-Key")
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != r.Header.Get("Authorization") {
+		credential = token
+	}
+
+	if len(s.credentials) == 0 {
+		return credential != ""
+	}
+
+	return s.credentials[credential]
+}
+
+func (s *Server) sign(w http.ResponseWriter, r *http.Request) {
+	var req cfapi.SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, 1001, "Invalid request body")
+
+		return
+	}
+
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidCSR, "Invalid CSR")
+
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidCSR, "Invalid CSR")
+
+		return
+	}
+
+	ca, err := s.ca(req.Type)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequestType, err.Error())
+
+		return
+	}
+
+	now := s.Clock.Now()
+	expiration := now.Add(time.Duration(req.Validity) * 24 * time.Hour).UTC().Truncate(time.Second)
+	id := strconv.Itoa(len(s.certificates) + 1)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(s.certificates) + 1)),
+		Subject:      pkix.Name{Organization: []string{"CloudFlare, Inc."}, CommonName: "CloudFlare Origin Certificate"},
+		DNSNames:     req.Hostnames,
+		NotBefore:    now,
+		NotAfter:     expiration,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidCSR, err.Error())
+
+		return
+	}
+
+	c := &certificate{SignResponse: cfapi.SignResponse{
+		Id:          id,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Hostnames:   req.Hostnames,
+		Expiration:  expiration,
+		Type:        req.Type,
+		Validity:    req.Validity,
+		CSR:         req.CSR,
+		RayID:       w.Header().Get("CF-Ray"),
+	}}
+	s.certificates = append(s.certificates, c)
+
+	writeResult(w, response(c.SignResponse), nil)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+
+	var valid []*certificate
+	for _, c := range s.certificates {
+		if !c.revoked {
+			valid = append(valid, c)
+		}
+	}
+
+	results := []signResponse{}
+	for i := (page - 1) * perPage; i < len(valid) && i < page*perPage; i++ {
+		results = append(results, response(valid[i].SignResponse))
+	}
+
+	writeResult(w, results, &cfapi.ResultInfo{Page: page, PerPage: perPage, Count: len(results), TotalCount: len(valid)})
+}
+
+func (s *Server) revoke(w http.ResponseWriter, id string) {
+	for _, c := range s.certificates {
+		if c.Id != id || c.revoked {
+			continue
+		}
+
+		c.revoked = true
+		writeResult(w, map[string]string{"id": id}, nil)
+
+		return
+	}
+
+	writeError(w, http.StatusNotFound, 1003, "Certificate not found")
+}
+
+// ca returns the CA signing the request type, generating it on first use.
+func (s *Server) ca(requestType string) (*ca, error) {
+	if c, ok := s.cas[requestType]; ok {
+		return c, nil
+	}
+
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch requestType {
+	case "origin-rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "origin-ecc":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("invalid request type %q", requestType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"CloudFlare, Inc."}, CommonName: "Fake " + requestType + " Origin CA"},
+		NotBefore:             s.Clock.Now().Add(-time.Hour),
+		NotAfter:              s.Clock.Now().Add(20 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ca{key: key, cert: cert, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+	s.cas[requestType] = c
+
+	return c, nil
+}
+
+// signResponse is a certificate as encoded by the Cloudflare API, whose
+// expiration is not RFC 3339.
+type signResponse struct {
+	ID          string   `json:"id"`
+	Certificate string   `json:"certificate"`
+	Hostnames   []string `json:"hostnames"`
+	Expiration  string   `json:"expires_on"`
+	Type        string   `json:"request_type"`
+	Validity    int      `json:"requested_validity"`
+	CSR         string   `json:"csr"`
+}
+
+func response(r cfapi.SignResponse) signResponse {
+	hostnames := append([]string(nil), r.Hostnames...)
+	sort.Strings(hostnames)
+
+	return signResponse{
+		ID:          r.Id,
+		Certificate: r.Certificate,
+		Hostnames:   hostnames,
+		Expiration:  r.Expiration.UTC().Format("2006-01-02 15:04:05 -0700 MST"),
+		Type:        r.Type,
+		Validity:    r.Validity,
+		CSR:         r.CSR,
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}, info *cfapi.ResultInfo) {
+	data, _ := json.Marshal(result)
+	_ = json.NewEncoder(w).Encode(cfapi.APIResponse{
+		Success:    true,
+		Errors:     []cfapi.APIError{},
+		Messages:   []cfapi.ResponseMessage{},
+		Result:     data,
+		ResultInfo: info,
+	})
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(cfapi.APIResponse{
+		Success:  false,
+		Errors:   []cfapi.APIError{{Code: code, Message: message}},
+		Messages: []cfapi.ResponseMessage{},
+		Result:   json.RawMessage("null"),
+	})
+}
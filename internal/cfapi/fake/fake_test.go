@@ -0,0 +1,119 @@
+package fake
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"gotest.tools/v3/assert"
+)
+
+func client(t *testing.T, s *Server, credential string, retry cfapi.RetryPolicy) *cfapi.Client {
+	t.Helper()
+
+	endpoint, err := cfapi.WithEndpoint(s.URL)
+	assert.NilError(t, err)
+
+	return cfapi.New(cfapi.Credentials{ServiceKey: []byte(credential)},
+		cfapi.WithClient(s.Client()),
+		endpoint,
+		cfapi.WithRetryPolicy(retry),
+		cfapi.WithRateLimiter(cfapi.NewRateLimiter()),
+	)
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("v1.0-key")
+	defer s.Close()
+
+	ctx := context.Background()
+	c := client(t, s, "v1.0-key", cfapi.RetryPolicy{})
+
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+	assert.NilError(t, err)
+
+	resp, err := c.Sign(ctx, &cfapi.SignRequest{Hostnames: []string{"example.com"}, Validity: 7, Type: "origin-ecc", CSR: string(csr)})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Id, "1")
+	assert.Equal(t, resp.RayID, "0000000000000001-SJC")
+
+	// Certificates are signed by the root of their request type.
+	block, _ := pem.Decode([]byte(resp.Certificate))
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, leaf.DNSNames, []string{"example.com"})
+	assert.Assert(t, leaf.NotAfter.Equal(resp.Expiration))
+
+	root, err := s.Root("origin-ecc")
+	assert.NilError(t, err)
+	roots := x509.NewCertPool()
+	assert.Assert(t, roots.AppendCertsFromPEM(root))
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com"})
+	assert.NilError(t, err)
+
+	_, err = c.Sign(ctx, &cfapi.SignRequest{Hostnames: []string{"example.com"}, Validity: 7, Type: "origin-ecc", CSR: "foobar"})
+	var apiErr *cfapi.APIError
+	assert.Assert(t, errors.As(err, &apiErr))
+	assert.Equal(t, apiErr.Code, CodeInvalidCSR)
+
+	_, err = c.Sign(ctx, &cfapi.SignRequest{Hostnames: []string{"example.com"}, Validity: 7, Type: "origin-rsa", CSR: string(csr)})
+	assert.NilError(t, err)
+
+	list, err := c.List(ctx, &cfapi.ListRequest{ZoneID: "zone", PerPage: 1, Page: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, list.TotalCount, 2)
+	assert.Equal(t, len(list.Certificates), 1)
+	assert.Equal(t, list.Certificates[0].Id, "2")
+
+	assert.NilError(t, c.Revoke(ctx, "1"))
+	assert.NilError(t, c.Revoke(ctx, "1"), "revoked certificates are not found, and treated as revoked")
+	assert.DeepEqual(t, s.Revoked(), []string{"1"})
+	assert.Equal(t, len(s.Issued()), 2)
+
+	list, err = c.List(ctx, &cfapi.ListRequest{ZoneID: "zone"})
+	assert.NilError(t, err)
+	assert.Equal(t, list.TotalCount, 1)
+
+	assert.NilError(t, c.Verify(ctx))
+	assert.Assert(t, cfapi.IsAuthError(client(t, s, "v1.0-other", cfapi.RetryPolicy{}).Verify(ctx)))
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+	assert.NilError(t, err)
+	req := &cfapi.SignRequest{Hostnames: []string{"example.com"}, Validity: 7, Type: "origin-ecc", CSR: string(csr)}
+
+	// Faults only fail requests of their method, and are retried by clients
+	// when transient.
+	s.Fail(http.MethodPost, DBWriteError())
+	c := client(t, s, "v1.0-key", cfapi.RetryPolicy{MaxRetries: 1, RetryableCodes: []int{CodeDBWrite}})
+	assert.NilError(t, c.Verify(ctx))
+	_, err = c.Sign(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Requests(), 3)
+
+	s.Fail("", RateLimited(30*time.Second))
+	_, err = c.Sign(ctx, req)
+	var rateLimited *cfapi.RateLimitError
+	assert.Assert(t, errors.As(err, &rateLimited))
+	assert.Assert(t, rateLimited.RetryAfter > 29*time.Second && rateLimited.RetryAfter <= 30*time.Second)
+
+	// Requests are refused by the client until the limit resets, without
+	// reaching the server.
+	_, err = c.Sign(ctx, req)
+	assert.Assert(t, errors.As(err, &rateLimited))
+	assert.Equal(t, s.Requests(), 4)
+
+	_, err = client(t, s, "", cfapi.RetryPolicy{}).Sign(ctx, req)
+	assert.Assert(t, cfapi.IsAuthError(err))
+}
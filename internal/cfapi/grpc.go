@@ -0,0 +1,445 @@
+package cfapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// GRPCFactory is the name of the factory of clients calling a certificate
+// broker, such as a sidecar, over gRPC. Its config is the address of the
+// broker, as https://host:port, or as host:port of a loopback address or
+// unix:///path/to/socket to call it in cleartext.
+const GRPCFactory = "grpc"
+
+// grpcService is the gRPC service served by certificate brokers, as defined
+// by pkgs/cfapi/broker.proto.
+const grpcService = "originca.broker.v1.Broker"
+
+// maxGRPCMessageSize bounds the size of the responses read, far above that
+// of a page of certificates.
+const maxGRPCMessageSize = 4 << 20
+
+// Field numbers of the messages of the broker service. The messages are
+// encoded by hand with protowire, as the controller's Istio CA API does, so
+// that gRPC need not be vendored, and checked against pkgs/cfapi/broker.proto
+// by the tests.
+const (
+	credentialsField protowire.Number = 1
+	callerField      protowire.Number = 2
+
+	credentialsServiceKeyField protowire.Number = 1
+	credentialsAPITokenField   protowire.Number = 2
+	credentialsEndpointField   protowire.Number = 3
+
+	callerCorrelationIDField   protowire.Number = 1
+	callerIssuerKindField      protowire.Number = 2
+	callerIssuerNamespaceField protowire.Number = 3
+	callerIssuerNameField      protowire.Number = 4
+	callerObjectKindField      protowire.Number = 5
+	callerObjectNamespaceField protowire.Number = 6
+	callerObjectNameField      protowire.Number = 7
+	callerObjectUIDField       protowire.Number = 8
+	callerAttributionField     protowire.Number = 9
+
+	signHostnamesField protowire.Number = 3
+	signValidityField  protowire.Number = 4
+	signTypeField      protowire.Number = 5
+	signCSRField       protowire.Number = 6
+
+	revokeIDField protowire.Number = 3
+
+	listZoneIDField  protowire.Number = 3
+	listPageField    protowire.Number = 4
+	listPerPageField protowire.Number = 5
+
+	certificateIDField        protowire.Number = 1
+	certificateField          protowire.Number = 2
+	certificateHostnamesField protowire.Number = 3
+	certificateExpiresField   protowire.Number = 4
+	certificateTypeField      protowire.Number = 5
+	certificateValidityField  protowire.Number = 6
+
+	listCertificatesField protowire.Number = 1
+	listTotalCountField   protowire.Number = 2
+)
+
+// gRPC status codes mapped to HTTP statuses, so that errors of brokers are
+// classified as those of the Cloudflare API are.
+var grpcStatuses = map[int]int{
+	3:  http.StatusBadRequest,          // INVALID_ARGUMENT
+	4:  http.StatusGatewayTimeout,      // DEADLINE_EXCEEDED
+	5:  http.StatusNotFound,            // NOT_FOUND
+	6:  http.StatusConflict,            // ALREADY_EXISTS
+	7:  http.StatusForbidden,           // PERMISSION_DENIED
+	8:  http.StatusTooManyRequests,     // RESOURCE_EXHAUSTED
+	9:  http.StatusBadRequest,          // FAILED_PRECONDITION
+	12: http.StatusNotImplemented,      // UNIMPLEMENTED
+	13: http.StatusInternalServerError, // INTERNAL
+	14: http.StatusServiceUnavailable,  // UNAVAILABLE
+	16: http.StatusUnauthorized,        // UNAUTHENTICATED
+}
+
+// NewGRPCFactory returns a Factory of clients calling the certificate broker
+// at address over gRPC. The credentials of issuers are passed on to the broker
+// with each call, so brokers are called over TLS, unless they listen on a
+// loopback address or a unix socket, as sidecars do, which are called in
+// cleartext HTTP/2.
+func NewGRPCFactory(address string) (Factory, error) {
+	if host, ok := strings.CutPrefix(address, "https://"); ok {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			return nil, fmt.Errorf("invalid gRPC broker address %q, must be https://host:port: %w", address, err)
+		}
+
+		client := &http.Client{Transport: &http2.Transport{}}
+		return FactoryFunc(func(creds Credentials) (Interface, error) {
+			return &grpcClient{creds: creds, client: client, base: address}, nil
+		}), nil
+	}
+
+	network, dialAddress := "tcp", address
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		network, dialAddress = "unix", path
+	} else if host, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid gRPC broker address %q, must be https://host:port, host:port or unix:///path: %w", address, err)
+	} else if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("invalid gRPC broker address %q, only loopback addresses are called in cleartext, use https://%s for other brokers", address, address)
+	}
+
+	if dialAddress == "" {
+		return nil, fmt.Errorf("invalid gRPC broker address %q, must be https://host:port, host:port or unix:///path", address)
+	}
+
+	var dialer net.Dialer
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, dialAddress)
+			},
+		},
+	}
+
+	base := "http://" + address
+	if network == "unix" {
+		base = "http://localhost"
+	}
+
+	return FactoryFunc(func(creds Credentials) (Interface, error) {
+		return &grpcClient{creds: creds, client: client, base: base}, nil
+	}), nil
+}
+
+// grpcClient calls the Cloudflare API through a certificate broker.
+type grpcClient struct {
+	creds  Credentials
+	client *http.Client
+	base   string
+}
+
+func (c *grpcClient) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	b := c.header(ctx)
+	for _, hostname := range req.Hostnames {
+		b = appendString(b, signHostnamesField, hostname)
+	}
+	b = appendVarint(b, signValidityField, uint64(req.Validity))
+	b = appendString(b, signTypeField, req.Type)
+	b = appendString(b, signCSRField, req.CSR)
+
+	resp, err := c.call(ctx, "Sign", b)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalCertificate(resp)
+}
+
+// Verify checks the broker accepts the credentials. Credentials rejected by
+// the broker fail with an error for which IsAuthError is true, like those
+// rejected by the Cloudflare API, and a broker that can't be reached or fails
+// with any other error fails the verification as well.
+func (c *grpcClient) Verify(ctx context.Context) error {
+	_, err := c.call(ctx, "Verify", c.header(ctx))
+	return err
+}
+
+func (c *grpcClient) Revoke(ctx context.Context, id string) error {
+	_, err := c.call(ctx, "Revoke", appendString(c.header(ctx), revokeIDField, id))
+
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (c *grpcClient) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	b := appendString(c.header(ctx), listZoneIDField, req.ZoneID)
+	b = appendVarint(b, listPageField, uint64(req.Page))
+	b = appendVarint(b, listPerPageField, uint64(req.PerPage))
+
+	resp, err := c.call(ctx, "List", b)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &ListResponse{}
+	for len(resp) > 0 {
+		num, typ, n := protowire.ConsumeTag(resp)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		resp = resp[n:]
+
+		switch {
+		case num == listCertificatesField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(resp)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			cert, err := unmarshalCertificate(v)
+			if err != nil {
+				return nil, err
+			}
+			list.Certificates = append(list.Certificates, *cert)
+			resp = resp[n:]
+		case num == listTotalCountField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(resp)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			list.TotalCount = int(v)
+			resp = resp[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, resp)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			resp = resp[n:]
+		}
+	}
+
+	return list, nil
+}
+
+// header encodes the fields common to every request: the credentials, and
+// the metadata of the call identifying its caller.
+func (c *grpcClient) header(ctx context.Context) []byte {
+	var creds []byte
+	creds = appendBytes(creds, credentialsServiceKeyField, c.creds.ServiceKey)
+	creds = appendBytes(creds, credentialsAPITokenField, c.creds.APIToken)
+	creds = appendString(creds, credentialsEndpointField, c.creds.Endpoint)
+
+	b := protowire.AppendTag(nil, credentialsField, protowire.BytesType)
+	b = protowire.AppendBytes(b, creds)
+
+	m, ok := MetadataFromContext(ctx)
+	if !ok {
+		return b
+	}
+
+	var caller []byte
+	caller = appendString(caller, callerCorrelationIDField, m.CorrelationID)
+	caller = appendString(caller, callerIssuerKindField, m.IssuerKind)
+	caller = appendString(caller, callerIssuerNamespaceField, m.IssuerNamespace)
+	caller = appendString(caller, callerIssuerNameField, m.IssuerName)
+	caller = appendString(caller, callerObjectKindField, m.ObjectKind)
+	caller = appendString(caller, callerObjectNamespaceField, m.ObjectNamespace)
+	caller = appendString(caller, callerObjectNameField, m.ObjectName)
+	caller = appendString(caller, callerObjectUIDField, string(m.ObjectUID))
+	for key, value := range m.Attribution {
+		entry := appendString(appendString(nil, 1, key), 2, value)
+		caller = protowire.AppendTag(caller, callerAttributionField, protowire.BytesType)
+		caller = protowire.AppendBytes(caller, entry)
+	}
+
+	b = protowire.AppendTag(b, callerField, protowire.BytesType)
+	return protowire.AppendBytes(b, caller)
+}
+
+// call calls the method of the broker with the encoded request, returning
+// the encoded response. Failures reported by the broker with a gRPC status
+// are returned as APIErrors of the matching HTTP status.
+func (c *grpcClient) call(ctx context.Context, method string, req []byte) ([]byte, error) {
+	body := make([]byte, 5, 5+len(req))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(req)))
+	body = append(body, req...)
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"/"+grpcService+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("TE", "trailers")
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("gRPC broker responded with HTTP status %d", resp.StatusCode)}
+	}
+
+	msg, err := readGRPCMessage(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trailers are only available once the body was read.
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return nil, err
+	}
+
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// Trailers-only responses carry the status in their headers.
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("gRPC broker responded without a valid status: %q", status)
+	}
+
+	if code != 0 {
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+
+		httpStatus, ok := grpcStatuses[code]
+		if !ok {
+			httpStatus = http.StatusInternalServerError
+		}
+
+		apiError := &APIError{Code: code, Message: message, StatusCode: httpStatus}
+		if httpStatus == http.StatusTooManyRequests {
+			apiError.RetryAfter = time.Minute
+		}
+
+		return nil, apiError
+	}
+
+	return msg, nil
+}
+
+// readGRPCMessage reads a length-prefixed gRPC message, or nil when the
+// response has none.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if prefix[0] != 0 {
+		return nil, errors.New("gRPC broker responded with a compressed message, which isn't supported")
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessageSize {
+		return nil, fmt.Errorf("gRPC broker responded with a message of %d bytes, larger than %d", size, maxGRPCMessageSize)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// unmarshalCertificate decodes a Certificate message of the broker service.
+func unmarshalCertificate(b []byte) (*SignResponse, error) {
+	cert := &SignResponse{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case typ == protowire.BytesType && (num == certificateIDField || num == certificateField || num == certificateHostnamesField || num == certificateTypeField):
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			switch num {
+			case certificateIDField:
+				cert.Id = v
+			case certificateField:
+				cert.Certificate = v
+			case certificateHostnamesField:
+				cert.Hostnames = append(cert.Hostnames, v)
+			case certificateTypeField:
+				cert.Type = v
+			}
+			b = b[n:]
+		case typ == protowire.VarintType && (num == certificateExpiresField || num == certificateValidityField):
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			if num == certificateExpiresField {
+				cert.Expiration = time.Unix(int64(v), 0).UTC()
+			} else {
+				cert.Validity = int(v)
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	return cert, nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
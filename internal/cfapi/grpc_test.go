@@ -0,0 +1,437 @@
+package cfapi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gotest.tools/v3/assert"
+)
+
+// grpcBroker serves the broker service, recording the decoded fields of the
+// requests it receives.
+type grpcBroker struct {
+	methods []string
+	fields  map[protowire.Number][]string
+	request []byte
+
+	status  int
+	message string
+
+	// response, when set, is responded in place of a certificate.
+	response []byte
+}
+
+func (b *grpcBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.methods = append(b.methods, strings.TrimPrefix(r.URL.Path, "/"+grpcService+"/"))
+
+	body, _ := io.ReadAll(r.Body)
+	msg := body[5:]
+	b.request = msg
+	b.fields = map[protowire.Number][]string{}
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		msg = msg[n:]
+		if typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(msg)
+			b.fields[num] = append(b.fields[num], strconv.FormatUint(v, 10))
+			msg = msg[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(msg)
+		b.fields[num] = append(b.fields[num], string(v))
+		msg = msg[n:]
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	if b.status != 0 {
+		w.Header().Set("Grpc-Status", strconv.Itoa(b.status))
+		w.Header().Set("Grpc-Message", b.message)
+		return
+	}
+
+	resp := b.response
+	if resp == nil {
+		resp = appendString(resp, certificateIDField, "9001")
+		resp = appendString(resp, certificateField, "bogus")
+		resp = appendString(resp, certificateHostnamesField, "example.com")
+		resp = appendVarint(resp, certificateExpiresField, uint64(time.Date(2020, time.December, 25, 6, 27, 0, 0, time.UTC).Unix()))
+		if strings.HasSuffix(r.URL.Path, "/List") {
+			cert := resp
+			resp = protowire.AppendTag(nil, listCertificatesField, protowire.BytesType)
+			resp = protowire.AppendBytes(resp, cert)
+			resp = appendVarint(resp, listTotalCountField, 1)
+		}
+	}
+
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(resp)))
+	_, _ = w.Write(append(prefix, resp...))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func TestGRPCFactory(t *testing.T) {
+	broker := &grpcBroker{}
+	ts := httptest.NewServer(h2c.NewHandler(broker, &http2.Server{}))
+	defer ts.Close()
+
+	f, err := NewFactory(GRPCFactory, strings.TrimPrefix(ts.URL, "http://"))
+	assert.NilError(t, err)
+
+	api, err := f.APIWith(Credentials{APIToken: []byte("token")})
+	assert.NilError(t, err)
+
+	ctx := WithMetadata(context.Background(), Metadata{IssuerKind: "OriginIssuer", IssuerName: "foobar"})
+
+	resp, err := api.Sign(ctx, &SignRequest{Hostnames: []string{"example.com"}, Validity: 7, Type: "origin-ecc", CSR: "csr"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, resp, &SignResponse{
+		Id:          "9001",
+		Certificate: "bogus",
+		Hostnames:   []string{"example.com"},
+		Expiration:  time.Date(2020, time.December, 25, 6, 27, 0, 0, time.UTC),
+	})
+	assert.DeepEqual(t, broker.fields[signHostnamesField], []string{"example.com"})
+	assert.DeepEqual(t, broker.fields[signValidityField], []string{"7"})
+	assert.DeepEqual(t, broker.fields[signCSRField], []string{"csr"})
+	assert.DeepEqual(t, broker.fields[credentialsField], []string{string(appendBytes(nil, credentialsAPITokenField, []byte("token")))})
+	assert.Equal(t, len(broker.fields[callerField]), 1)
+
+	list, err := api.List(ctx, &ListRequest{ZoneID: "023e105f4ecef8ad9ca31a8372d0c353", Page: 1})
+	assert.NilError(t, err)
+	assert.Equal(t, list.TotalCount, 1)
+	assert.Equal(t, list.Certificates[0].Id, "9001")
+	assert.DeepEqual(t, broker.fields[listZoneIDField], []string{"023e105f4ecef8ad9ca31a8372d0c353"})
+
+	assert.DeepEqual(t, broker.methods, []string{"Sign", "List"})
+}
+
+func TestGRPCFactory_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		call    func(Interface) error
+		err     string
+		checkFn func(*testing.T, error)
+	}{
+		{
+			name:   "credentials rejected",
+			status: 16,
+			call: func(api Interface) error {
+				return api.Verify(context.Background())
+			},
+			err: "Cloudflare API Error code=16 message=token revoked ray_id=",
+			checkFn: func(t *testing.T, err error) {
+				assert.Assert(t, IsAuthError(err))
+			},
+		},
+		{
+			name:   "verify unavailable",
+			status: 14,
+			call: func(api Interface) error {
+				return api.Verify(context.Background())
+			},
+			err: "Cloudflare API Error code=14 message=token revoked ray_id=",
+			checkFn: func(t *testing.T, err error) {
+				assert.Assert(t, !IsAuthError(err))
+			},
+		},
+		{
+			name:   "rate limited",
+			status: 8,
+			call: func(api Interface) error {
+				_, err := api.Sign(context.Background(), &SignRequest{})
+				return err
+			},
+			err: "Cloudflare API Error code=8 message=token revoked ray_id=",
+			checkFn: func(t *testing.T, err error) {
+				var apiError *APIError
+				assert.Assert(t, errors.As(err, &apiError))
+				assert.Equal(t, apiError.StatusCode, http.StatusTooManyRequests)
+			},
+		},
+		{
+			name:   "revoked already",
+			status: 5,
+			call: func(api Interface) error {
+				return api.Revoke(context.Background(), "9001")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &grpcBroker{status: tt.status, message: "token%20revoked"}
+			ts := httptest.NewServer(h2c.NewHandler(broker, &http2.Server{}))
+			defer ts.Close()
+
+			f, err := NewGRPCFactory(strings.TrimPrefix(ts.URL, "http://"))
+			assert.NilError(t, err)
+
+			api, err := f.APIWith(Credentials{APIToken: []byte("token")})
+			assert.NilError(t, err)
+
+			err = tt.call(api)
+			if tt.err == "" {
+				assert.NilError(t, err)
+				return
+			}
+
+			assert.Error(t, err, tt.err)
+			tt.checkFn(t, err)
+		})
+	}
+}
+
+func TestNewGRPCFactory_InvalidAddress(t *testing.T) {
+	_, err := NewGRPCFactory("broker.example.com")
+	assert.ErrorContains(t, err, `invalid gRPC broker address "broker.example.com"`)
+
+	_, err = NewGRPCFactory("unix://")
+	assert.Error(t, err, `invalid gRPC broker address "unix://", must be https://host:port, host:port or unix:///path`)
+
+	_, err = NewGRPCFactory("https://broker.example.com")
+	assert.ErrorContains(t, err, `invalid gRPC broker address "https://broker.example.com", must be https://host:port`)
+
+	// Credentials are only sent in cleartext to loopback addresses.
+	_, err = NewGRPCFactory("broker.example.com:9000")
+	assert.Error(t, err, `invalid gRPC broker address "broker.example.com:9000", only loopback addresses are called in cleartext, use https://broker.example.com:9000 for other brokers`)
+
+	_, err = NewGRPCFactory("10.0.0.1:9000")
+	assert.ErrorContains(t, err, "only loopback addresses are called in cleartext")
+
+	for _, address := range []string{"unix:///run/broker.sock", "localhost:9000", "127.0.0.1:9000", "[::1]:9000", "https://broker.example.com:9000"} {
+		_, err = NewGRPCFactory(address)
+		assert.NilError(t, err, address)
+	}
+}
+
+func TestGRPCFactory_TLS(t *testing.T) {
+	broker := &grpcBroker{}
+	ts := httptest.NewUnstartedServer(broker)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	f, err := NewGRPCFactory(ts.URL)
+	assert.NilError(t, err)
+
+	api, err := f.APIWith(Credentials{APIToken: []byte("token")})
+	assert.NilError(t, err)
+
+	// The test server's certificate isn't trusted by the system roots.
+	assert.ErrorContains(t, api.Verify(context.Background()), "certificate")
+
+	api.(*grpcClient).client = ts.Client()
+	assert.NilError(t, api.Verify(context.Background()))
+	assert.DeepEqual(t, broker.methods, []string{"Verify"})
+}
+
+var (
+	protoMessage = regexp.MustCompile(`message (\w+) \{([^}]*)\}`)
+	protoField   = regexp.MustCompile(`(repeated )?(map<(\w+), (\w+)>|\w+) (\w+) = (\d+);`)
+	protoComment = regexp.MustCompile(`//.*`)
+)
+
+// brokerProto parses the messages of pkgs/cfapi/broker.proto, which only
+// declares scalar, message, repeated and map fields, so that the messages
+// encoded by hand are checked against their definition.
+func brokerProto(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+
+	b, err := os.ReadFile("../../pkgs/cfapi/broker.proto")
+	assert.NilError(t, err)
+	src := protoComment.ReplaceAllString(string(b), "")
+
+	scalars := map[string]descriptorpb.FieldDescriptorProto_Type{
+		"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+		"bytes":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+		"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	}
+	field := func(name, typ string, num int32, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(num), Label: label.Enum(), JsonName: proto.String(name)}
+		if scalar, ok := scalars[typ]; ok {
+			f.Type = scalar.Enum()
+		} else {
+			f.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			f.TypeName = proto.String(typ)
+		}
+		return f
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("broker.proto"),
+		Package: proto.String("originca.broker.v1"),
+		Syntax:  proto.String("proto3"),
+	}
+	for _, m := range protoMessage.FindAllStringSubmatch(src, -1) {
+		msg := &descriptorpb.DescriptorProto{Name: proto.String(m[1])}
+		for _, f := range protoField.FindAllStringSubmatch(m[2], -1) {
+			num, _ := strconv.Atoi(f[6])
+			switch {
+			case f[3] != "":
+				entry := strings.ToUpper(f[5][:1]) + f[5][1:] + "Entry"
+				msg.NestedType = append(msg.NestedType, &descriptorpb.DescriptorProto{
+					Name: proto.String(entry),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", f[3], 1, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL),
+						field("value", f[4], 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				})
+				msg.Field = append(msg.Field, field(f[5], ".originca.broker.v1."+m[1]+"."+entry, int32(num), descriptorpb.FieldDescriptorProto_LABEL_REPEATED))
+			case f[1] != "":
+				msg.Field = append(msg.Field, field(f[5], qualify(f[2], scalars), int32(num), descriptorpb.FieldDescriptorProto_LABEL_REPEATED))
+			default:
+				msg.Field = append(msg.Field, field(f[5], qualify(f[2], scalars), int32(num), descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL))
+			}
+		}
+		file.MessageType = append(file.MessageType, msg)
+	}
+
+	fd, err := protodesc.NewFile(file, nil)
+	assert.NilError(t, err)
+
+	return fd
+}
+
+func qualify(typ string, scalars map[string]descriptorpb.FieldDescriptorProto_Type) string {
+	if _, ok := scalars[typ]; ok {
+		return typ
+	}
+
+	return ".originca.broker.v1." + typ
+}
+
+// TestGRPCFactory_BrokerProto checks the messages encoded and decoded by hand
+// round-trip through the messages of broker.proto.
+func TestGRPCFactory_BrokerProto(t *testing.T) {
+	fd := brokerProto(t)
+	message := func(name string) *dynamicpb.Message {
+		md := fd.Messages().ByName(protoreflect.Name(name))
+		assert.Assert(t, md != nil, "message %s not found in broker.proto", name)
+		return dynamicpb.NewMessage(md)
+	}
+	get := func(m protoreflect.Message, path ...string) protoreflect.Value {
+		for _, name := range path[:len(path)-1] {
+			m = m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name))).Message()
+		}
+		return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(path[len(path)-1])))
+	}
+
+	broker := &grpcBroker{}
+	ts := httptest.NewServer(h2c.NewHandler(broker, &http2.Server{}))
+	defer ts.Close()
+
+	f, err := NewGRPCFactory(strings.TrimPrefix(ts.URL, "http://"))
+	assert.NilError(t, err)
+
+	api, err := f.APIWith(Credentials{ServiceKey: []byte("v1.0-key"), APIToken: []byte("token"), Endpoint: "https://api.example.com"})
+	assert.NilError(t, err)
+
+	ctx := WithMetadata(context.Background(), Metadata{
+		CorrelationID:   "c0ffee00",
+		IssuerKind:      "OriginIssuer",
+		IssuerNamespace: "default",
+		IssuerName:      "foobar",
+		ObjectKind:      "CertificateRequest",
+		ObjectNamespace: "default",
+		ObjectName:      "web",
+		ObjectUID:       "1234",
+		Attribution:     map[string]string{"team": "edge"},
+	})
+
+	// Requests decode as the messages of broker.proto.
+	cert := message("Certificate")
+	cert.Set(cert.Descriptor().Fields().ByName("id"), protoreflect.ValueOfString("9001"))
+	cert.Set(cert.Descriptor().Fields().ByName("certificate"), protoreflect.ValueOfString("bogus"))
+	hostnames := cert.Mutable(cert.Descriptor().Fields().ByName("hostnames")).List()
+	hostnames.Append(protoreflect.ValueOfString("example.com"))
+	hostnames.Append(protoreflect.ValueOfString("www.example.com"))
+	cert.Set(cert.Descriptor().Fields().ByName("expires_on"), protoreflect.ValueOfInt64(time.Date(2020, time.December, 25, 6, 27, 0, 0, time.UTC).Unix()))
+	cert.Set(cert.Descriptor().Fields().ByName("request_type"), protoreflect.ValueOfString("origin-ecc"))
+	cert.Set(cert.Descriptor().Fields().ByName("requested_validity"), protoreflect.ValueOfInt32(7))
+	broker.response, err = proto.Marshal(cert)
+	assert.NilError(t, err)
+
+	resp, err := api.Sign(ctx, &SignRequest{Hostnames: []string{"example.com", "www.example.com"}, Validity: 7, Type: "origin-ecc", CSR: "csr"})
+	assert.NilError(t, err)
+
+	sign := message("SignRequest")
+	assert.NilError(t, proto.Unmarshal(broker.request, sign))
+	assert.DeepEqual(t, get(sign, "credentials", "service_key").Bytes(), []byte("v1.0-key"))
+	assert.DeepEqual(t, get(sign, "credentials", "api_token").Bytes(), []byte("token"))
+	assert.Equal(t, get(sign, "credentials", "endpoint").String(), "https://api.example.com")
+	assert.Equal(t, get(sign, "caller", "correlation_id").String(), "c0ffee00")
+	assert.Equal(t, get(sign, "caller", "issuer_kind").String(), "OriginIssuer")
+	assert.Equal(t, get(sign, "caller", "issuer_namespace").String(), "default")
+	assert.Equal(t, get(sign, "caller", "issuer_name").String(), "foobar")
+	assert.Equal(t, get(sign, "caller", "object_kind").String(), "CertificateRequest")
+	assert.Equal(t, get(sign, "caller", "object_namespace").String(), "default")
+	assert.Equal(t, get(sign, "caller", "object_name").String(), "web")
+	assert.Equal(t, get(sign, "caller", "object_uid").String(), "1234")
+	assert.Equal(t, get(sign, "caller", "attribution").Map().Get(protoreflect.ValueOfString("team").MapKey()).String(), "edge")
+	assert.Equal(t, get(sign, "hostnames").List().Len(), 2)
+	assert.Equal(t, get(sign, "hostnames").List().Get(1).String(), "www.example.com")
+	assert.Equal(t, get(sign, "requested_validity").Int(), int64(7))
+	assert.Equal(t, get(sign, "request_type").String(), "origin-ecc")
+	assert.Equal(t, get(sign, "csr").String(), "csr")
+
+	// Responses encoded as the messages of broker.proto decode.
+	assert.DeepEqual(t, resp, &SignResponse{
+		Id:          "9001",
+		Certificate: "bogus",
+		Hostnames:   []string{"example.com", "www.example.com"},
+		Expiration:  time.Date(2020, time.December, 25, 6, 27, 0, 0, time.UTC),
+		Type:        "origin-ecc",
+		Validity:    7,
+	})
+
+	broker.response = []byte{}
+	assert.NilError(t, api.Revoke(ctx, "9001"))
+	revoke := message("RevokeRequest")
+	assert.NilError(t, proto.Unmarshal(broker.request, revoke))
+	assert.Equal(t, get(revoke, "id").String(), "9001")
+	assert.Equal(t, get(revoke, "caller", "object_name").String(), "web")
+
+	list := message("ListResponse")
+	certs := list.Mutable(list.Descriptor().Fields().ByName("certificates")).List()
+	certs.Append(protoreflect.ValueOfMessage(cert))
+	list.Set(list.Descriptor().Fields().ByName("total_count"), protoreflect.ValueOfInt32(21))
+	broker.response, err = proto.Marshal(list)
+	assert.NilError(t, err)
+
+	listResp, err := api.List(ctx, &ListRequest{ZoneID: "023e105f4ecef8ad9ca31a8372d0c353", Page: 2, PerPage: 20})
+	assert.NilError(t, err)
+	assert.Equal(t, listResp.TotalCount, 21)
+	assert.Equal(t, len(listResp.Certificates), 1)
+	assert.Equal(t, listResp.Certificates[0].Id, "9001")
+
+	listReq := message("ListRequest")
+	assert.NilError(t, proto.Unmarshal(broker.request, listReq))
+	assert.Equal(t, get(listReq, "zone_id").String(), "023e105f4ecef8ad9ca31a8372d0c353")
+	assert.Equal(t, get(listReq, "page").Int(), int64(2))
+	assert.Equal(t, get(listReq, "per_page").Int(), int64(20))
+	assert.DeepEqual(t, get(listReq, "credentials", "api_token").Bytes(), []byte("token"))
+}
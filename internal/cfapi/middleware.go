@@ -0,0 +1,168 @@
+package cfapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Metadata identifies the Kubernetes objects an API call is made on behalf
+// of. It is carried by the context of each call, so middlewares can correlate
+// API calls with the objects that caused them.
+type Metadata struct {
+	// CorrelationID identifies the reconcile making the call, and is included
+	// in its logs, events and status messages.
+	CorrelationID string
+
+	// IssuerKind, IssuerNamespace and IssuerName identify the issuer whose
+	// credentials authenticate the call.
+	IssuerKind      string
+	IssuerNamespace string
+	IssuerName      string
+
+	// ObjectKind, ObjectNamespace, ObjectName and ObjectUID identify the
+	// object being reconciled, such as a CertificateRequest. They are the
+	// issuer itself when verifying its credentials.
+	ObjectKind      string
+	ObjectNamespace string
+	ObjectName      string
+	ObjectUID       types.UID
+
+	// Attribution are the labels or annotations of the object attributing
+	// the call, such as to a team or an app. The Origin CA API has no field
+	// to store them with certificates, so they are only seen by middlewares.
+	Attribution map[string]string
+}
+
+// KeysAndValues returns the metadata as key/value pairs suitable for a
+// logr.Logger.
+func (m Metadata) KeysAndValues() []interface{} {
+	kv := []interface{}{
+		"correlation_id", m.CorrelationID,
+		"issuer_kind", m.IssuerKind,
+		"issuer_namespace", m.IssuerNamespace,
+		"issuer_name", m.IssuerName,
+		"object_kind", m.ObjectKind,
+		"object_namespace", m.ObjectNamespace,
+		"object_name", m.ObjectName,
+		"object_uid", m.ObjectUID,
+	}
+	if len(m.Attribution) > 0 {
+		kv = append(kv, "attribution", m.Attribution)
+	}
+
+	return kv
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a copy of ctx carrying the metadata of an API call.
+func WithMetadata(ctx context.Context, m Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// MetadataFromContext returns the metadata of an API call carried by ctx, if
+// any.
+func MetadataFromContext(ctx context.Context) (Metadata, bool) {
+	m, ok := ctx.Value(metadataKey{}).(Metadata)
+	return m, ok
+}
+
+// Middleware wraps an Interface, such as to log, trace or audit API calls.
+type Middleware func(Interface) Interface
+
+// WithMiddleware returns a Factory wrapping every API client created by f
+// with the middlewares. The first middleware is the outermost.
+func WithMiddleware(f Factory, middlewares ...Middleware) Factory {
+	return FactoryFunc(func(creds Credentials) (Interface, error) {
+		c, err := f.APIWith(creds)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			c = middlewares[i](c)
+		}
+
+		return c, nil
+	})
+}
+
+// Logging returns a Middleware logging every API call, its outcome, and the
+// metadata of the call. Failures are logged at the same verbosity as
+// successes, as callers are expected to report errors they act on.
+func Logging(log logr.Logger) Middleware {
+	return func(next Interface) Interface {
+		return &loggingAPI{next: next, log: log}
+	}
+}
+
+type loggingAPI struct {
+	next Interface
+	log  logr.Logger
+}
+
+func (l *loggingAPI) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	resp, err := l.next.Sign(ctx, req)
+	if err == nil {
+		l.logCall(ctx, "sign", err, "id", resp.Id)
+	} else {
+		l.logCall(ctx, "sign", err)
+	}
+
+	return resp, err
+}
+
+func (l *loggingAPI) Verify(ctx context.Context) error {
+	err := l.next.Verify(ctx)
+	l.logCall(ctx, "verify", err)
+
+	return err
+}
+
+func (l *loggingAPI) Revoke(ctx context.Context, id string) error {
+	err := l.next.Revoke(ctx, id)
+	l.logCall(ctx, "revoke", err, "id", id)
+
+	return err
+}
+
+func (l *loggingAPI) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	resp, err := l.next.List(ctx, req)
+	l.logCall(ctx, "list", err, "zone_id", req.ZoneID, "page", req.Page)
+
+	return resp, err
+}
+
+func (l *loggingAPI) Zones(ctx context.Context, name string) ([]Zone, error) {
+	finder, ok := l.next.(ZoneFinder)
+	if !ok {
+		return nil, ErrZonesUnsupported
+	}
+
+	zones, err := finder.Zones(ctx, name)
+	l.logCall(ctx, "zones", err, "name", name)
+
+	return zones, err
+}
+
+func (l *loggingAPI) logCall(ctx context.Context, call string, err error, keysAndValues ...interface{}) {
+	log := l.log.WithValues("call", call)
+	if m, ok := MetadataFromContext(ctx); ok {
+		log = log.WithValues(m.KeysAndValues()...)
+	}
+
+	if err != nil {
+		var apiError *APIError
+		if errors.As(err, &apiError) && apiError.RayID != "" {
+			keysAndValues = append(keysAndValues, "ray_id", apiError.RayID)
+		}
+
+		log.Info("Cloudflare API call failed", append(keysAndValues, "error", err.Error())...)
+		return
+	}
+
+	log.Info("Cloudflare API call succeeded", keysAndValues...)
+}
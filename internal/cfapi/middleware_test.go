@@ -0,0 +1,124 @@
+package cfapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"gotest.tools/v3/assert"
+)
+
+// fakeAPI returns the given error from every call, and records the names of
+// the calls.
+type fakeAPI struct {
+	name  string
+	err   error
+	calls *[]string
+}
+
+func (f fakeAPI) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	*f.calls = append(*f.calls, f.name+".sign")
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &SignResponse{Id: "9001"}, nil
+}
+
+func (f fakeAPI) Verify(ctx context.Context) error {
+	*f.calls = append(*f.calls, f.name+".verify")
+	return f.err
+}
+
+func (f fakeAPI) Revoke(ctx context.Context, id string) error {
+	*f.calls = append(*f.calls, f.name+".revoke")
+	return f.err
+}
+
+func (f fakeAPI) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	*f.calls = append(*f.calls, f.name+".list")
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &ListResponse{}, nil
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var calls []string
+
+	wrap := func(name string) Middleware {
+		return func(next Interface) Interface {
+			return &wrapped{Interface: next, before: func() { calls = append(calls, name) }}
+		}
+	}
+
+	f := WithMiddleware(FactoryFunc(func(creds Credentials) (Interface, error) {
+		return fakeAPI{name: "client", calls: &calls}, nil
+	}), wrap("outer"), wrap("inner"))
+
+	c, err := f.APIWith(Credentials{})
+	assert.NilError(t, err)
+
+	assert.NilError(t, c.Verify(context.Background()))
+	assert.DeepEqual(t, calls, []string{"outer", "inner", "client.verify"})
+}
+
+type wrapped struct {
+	Interface
+	before func()
+}
+
+func (w *wrapped) Verify(ctx context.Context) error {
+	w.before()
+	return w.Interface.Verify(ctx)
+}
+
+func TestMetadataFromContext(t *testing.T) {
+	_, ok := MetadataFromContext(context.Background())
+	assert.Assert(t, !ok)
+
+	m := Metadata{IssuerKind: "OriginIssuer", IssuerNamespace: "default", IssuerName: "foo"}
+	got, ok := MetadataFromContext(WithMetadata(context.Background(), m))
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, got, m)
+}
+
+func TestLogging(t *testing.T) {
+	var lines []string
+	log := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	var calls []string
+	ctx := WithMetadata(context.Background(), Metadata{
+		CorrelationID:   "c0ffee00",
+		IssuerKind:      "OriginIssuer",
+		IssuerNamespace: "default",
+		IssuerName:      "foo",
+		ObjectKind:      "CertificateRequest",
+		ObjectNamespace: "default",
+		ObjectName:      "bar",
+		ObjectUID:       "0000",
+	})
+
+	c := Logging(log)(fakeAPI{name: "client", calls: &calls})
+	_, err := c.Sign(ctx, &SignRequest{})
+	assert.NilError(t, err)
+
+	c = Logging(log)(fakeAPI{name: "client", err: errors.New("boom"), calls: &calls})
+	assert.Error(t, c.Revoke(context.Background(), "9001"), "boom")
+
+	assert.DeepEqual(t, calls, []string{"client.sign", "client.revoke"})
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, lines[0], `"level"=0 "msg"="Cloudflare API call succeeded" "call"="sign" "correlation_id"="c0ffee00" "issuer_kind"="OriginIssuer" "issuer_namespace"="default" "issuer_name"="foo" "object_kind"="CertificateRequest" "object_namespace"="default" "object_name"="bar" "object_uid"="0000" "id"="9001"`)
+	assert.Assert(t, strings.Contains(lines[1], `"call"="revoke"`), lines[1])
+	assert.Assert(t, strings.Contains(lines[1], `"error"="boom"`), lines[1])
+
+	c = Logging(log)(fakeAPI{name: "client", err: &APIError{Code: 1000, Message: "Invalid API Token", RayID: "0123456789abcdef"}, calls: &calls})
+	_, err = c.Sign(ctx, &SignRequest{})
+	assert.ErrorContains(t, err, "Invalid API Token")
+	assert.Assert(t, strings.Contains(lines[2], `"ray_id"="0123456789abcdef"`), lines[2])
+}
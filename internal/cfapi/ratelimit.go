@@ -0,0 +1,152 @@
+package cfapi
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter tracks when the Cloudflare API has asked clients to back off,
+// through the Retry-After header of a rate limited response. Requests made by
+// any client sharing the RateLimiter are refused until then, so reconciles
+// queue behind the limit instead of each spending a request to rediscover it.
+//
+// A nil RateLimiter never limits requests.
+type RateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that is not limiting requests.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{}
+}
+
+// RateLimiters holds a RateLimiter per credential, as the Cloudflare API
+// rate limits each user or API token separately: a limit reached with one
+// issuer's credential doesn't hold back issuers using other credentials.
+//
+// A nil RateLimiters never limits requests.
+type RateLimiters struct {
+	mu       sync.Mutex
+	limiters map[[sha256.Size]byte]*RateLimiter
+}
+
+// NewRateLimiters returns RateLimiters that are not limiting requests.
+func NewRateLimiters() *RateLimiters {
+	return &RateLimiters{limiters: make(map[[sha256.Size]byte]*RateLimiter)}
+}
+
+// For returns the RateLimiter shared by the clients using the credentials,
+// and the same endpoint. Credentials are only kept hashed, as by
+// WithClientCache.
+func (ls *RateLimiters) For(creds Credentials) *RateLimiter {
+	if ls == nil {
+		return nil
+	}
+
+	key := credentialsKey(creds)
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	l, ok := ls.limiters[key]
+	if !ok {
+		l = NewRateLimiter()
+		ls.limiters[key] = l
+	}
+
+	return l
+}
+
+// delay returns how long requests must wait before being sent, or zero if
+// they may be sent immediately.
+func (l *RateLimiter) delay(now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.until.After(now) {
+		return 0
+	}
+
+	return l.until.Sub(now)
+}
+
+// observe extends the limit to the time given by the Retry-After header of a
+// rate limited response.
+func (l *RateLimiter) observe(resp *http.Response, now time.Time) {
+	if l == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	until, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.until) {
+		l.until = until
+	}
+}
+
+// parseRetryAfter parses a Retry-After header value, given either as a
+// number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return time.Time{}, false
+		}
+
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+
+	until, err := http.ParseTime(value)
+	if err != nil || !until.After(now) {
+		return time.Time{}, false
+	}
+
+	return until, true
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of the
+// response, or zero if it has none.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	until, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok {
+		return 0
+	}
+
+	return until.Sub(now)
+}
+
+// RateLimitError is returned when a request was refused, or failed, because
+// the Cloudflare API is rate limiting requests. The request should be retried
+// after RetryAfter has elapsed.
+type RateLimitError struct {
+	RetryAfter time.Duration
+
+	// Err is the error of the rate limited request, if it was sent.
+	Err error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited by the Cloudflare API, retry after %s", e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,150 @@
+package cfapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.December, 25, 6, 27, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "seconds",
+			value:    "120",
+			expected: now.Add(2 * time.Minute),
+			ok:       true,
+		},
+		{
+			name:     "http date",
+			value:    "Fri, 25 Dec 2020 06:30:00 GMT",
+			expected: now.Add(3 * time.Minute),
+			ok:       true,
+		},
+		{
+			name:  "date in the past",
+			value: "Fri, 25 Dec 2020 06:00:00 GMT",
+		},
+		{
+			name:  "zero",
+			value: "0",
+		},
+		{
+			name: "missing",
+		},
+		{
+			name:  "garbage",
+			value: "soon",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			assert.Equal(t, ok, tt.ok)
+			assert.Assert(t, got.Equal(tt.expected), "got %s, expected %s", got, tt.expected)
+		})
+	}
+}
+
+func TestSign_RateLimited(t *testing.T) {
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintln(w, `{"success": false, "errors": [{"code": 971, "message": "Please wait and consider throttling your request speed"}], "messages": [], "result": null}`)
+			return
+		}
+
+		fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "1", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`)
+	}))
+	defer ts.Close()
+
+	clock := fakeClock.NewFakeClock(time.Now())
+	limiter := NewRateLimiter()
+	client := func() *Client {
+		return New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+			WithClient(ts.Client()),
+			WithClock(clock),
+			WithRateLimiter(limiter),
+			Must(WithEndpoint(ts.URL)),
+		)
+	}
+
+	_, err := client().Sign(context.Background(), &SignRequest{})
+	var rateLimited *RateLimitError
+	assert.Assert(t, errors.As(err, &rateLimited), "expected a rate limit error, got %v", err)
+	assert.Equal(t, rateLimited.RetryAfter, 2*time.Minute)
+	assert.Error(t, rateLimited.Err, "Cloudflare API Error code=971 message=Please wait and consider throttling your request speed ray_id=")
+	assert.Equal(t, requests, 1)
+
+	// Other clients sharing the limiter wait out the limit without sending
+	// requests.
+	clock.Step(time.Minute)
+	_, err = client().Sign(context.Background(), &SignRequest{})
+	assert.Error(t, err, "rate limited by the Cloudflare API, retry after 1m0s")
+	assert.Equal(t, requests, 1)
+
+	clock.Step(time.Minute)
+	_, err = client().Sign(context.Background(), &SignRequest{})
+	assert.NilError(t, err)
+	assert.Equal(t, requests, 2)
+}
+
+func TestSign_RateLimitedPerCredential(t *testing.T) {
+	requests := map[string]int{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Auth-User-Service-Key")
+		requests[key]++
+		if key == "v1.0-AAAA-AAAA" {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintln(w, `{"success": false, "errors": [{"code": 971, "message": "Please wait and consider throttling your request speed"}], "messages": [], "result": null}`)
+			return
+		}
+
+		fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": {"id": "1", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`)
+	}))
+	defer ts.Close()
+
+	clock := fakeClock.NewFakeClock(time.Now())
+	limiters := NewRateLimiters()
+	client := func(key string) *Client {
+		return New(Credentials{ServiceKey: []byte(key)},
+			WithClient(ts.Client()),
+			WithClock(clock),
+			WithRateLimiters(limiters),
+			Must(WithEndpoint(ts.URL)),
+		)
+	}
+
+	_, err := client("v1.0-AAAA-AAAA").Sign(context.Background(), &SignRequest{})
+	var rateLimited *RateLimitError
+	assert.Assert(t, errors.As(err, &rateLimited), "expected a rate limit error, got %v", err)
+
+	// Clients of the same credential wait out the limit, while clients of
+	// other credentials are unaffected.
+	_, err = client("v1.0-AAAA-AAAA").Sign(context.Background(), &SignRequest{})
+	assert.Error(t, err, "rate limited by the Cloudflare API, retry after 2m0s")
+	assert.Equal(t, requests["v1.0-AAAA-AAAA"], 1)
+
+	_, err = client("v1.0-BBBB-BBBB").Sign(context.Background(), &SignRequest{})
+	assert.NilError(t, err)
+	assert.Equal(t, requests["v1.0-BBBB-BBBB"], 1)
+}
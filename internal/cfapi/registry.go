@@ -0,0 +1,80 @@
+package cfapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultFactory is the name of the factory of clients calling the
+// Cloudflare API directly.
+const DefaultFactory = "cloudflare"
+
+// FactoryConstructor returns a Factory configured by an opaque config, such
+// as the address of a certificate broker, whose format is up to the factory.
+// The options are those of the Cloudflare API clients the controller would
+// otherwise create, for factories that wrap or fall back to them.
+type FactoryConstructor func(config string, opts ...Options) (Factory, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]FactoryConstructor{
+		DefaultFactory: func(_ string, opts ...Options) (Factory, error) {
+			return FactoryFunc(func(creds Credentials) (Interface, error) {
+				return New(creds, opts...), nil
+			}), nil
+		},
+		GRPCFactory: func(config string, _ ...Options) (Factory, error) {
+			return NewGRPCFactory(config)
+		},
+	}
+)
+
+// RegisterFactory makes a Factory available by name, so that organizations
+// can interpose their own service, such as a central certificate broker
+// enforcing approval or rate limits, between the controller and Cloudflare.
+// Factories are compiled in by importing a package calling RegisterFactory
+// from its init function. It panics if the name is already registered.
+func RegisterFactory(name string, constructor FactoryConstructor) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if constructor == nil {
+		panic("cfapi: RegisterFactory constructor is nil")
+	}
+
+	if _, dup := factories[name]; dup {
+		panic("cfapi: RegisterFactory called twice for factory " + name)
+	}
+
+	factories[name] = constructor
+}
+
+// Factories returns the sorted names of the registered factories.
+func Factories() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewFactory returns the registered Factory of the name, configured by
+// config.
+func NewFactory(name, config string, opts ...Options) (Factory, error) {
+	factoriesMu.RLock()
+	constructor, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown Cloudflare API factory %q, registered factories are: %s", name, strings.Join(Factories(), ", "))
+	}
+
+	return constructor(config, opts...)
+}
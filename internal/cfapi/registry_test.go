@@ -0,0 +1,67 @@
+package cfapi
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type brokerAPI struct {
+	Interface
+	address string
+}
+
+func (b *brokerAPI) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	return &SignResponse{Id: b.address}, nil
+}
+
+func TestRegisterFactory(t *testing.T) {
+	RegisterFactory("test-broker", func(config string, opts ...Options) (Factory, error) {
+		return FactoryFunc(func(creds Credentials) (Interface, error) {
+			return &brokerAPI{address: config}, nil
+		}), nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "test-broker")
+		factoriesMu.Unlock()
+	}()
+
+	assert.DeepEqual(t, Factories(), []string{"cloudflare", "grpc", "test-broker"})
+
+	f, err := NewFactory("test-broker", "broker.example.com:8443")
+	assert.NilError(t, err)
+
+	api, err := f.APIWith(Credentials{APIToken: []byte("token")})
+	assert.NilError(t, err)
+
+	resp, err := api.Sign(context.Background(), &SignRequest{})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Id, "broker.example.com:8443")
+
+	f, err = NewFactory(DefaultFactory, "")
+	assert.NilError(t, err)
+
+	api, err = f.APIWith(Credentials{APIToken: []byte("token")})
+	assert.NilError(t, err)
+	_, ok := api.(*Client)
+	assert.Assert(t, ok, "expected a Cloudflare API client, got %T", api)
+
+	_, err = NewFactory("missing", "")
+	assert.Error(t, err, `unknown Cloudflare API factory "missing", registered factories are: cloudflare, grpc, test-broker`)
+
+	assert.Assert(t, panics(func() {
+		RegisterFactory(DefaultFactory, func(string, ...Options) (Factory, error) { return nil, nil })
+	}), "expected registering a factory twice to panic")
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+
+	f()
+
+	return false
+}
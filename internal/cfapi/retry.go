@@ -0,0 +1,225 @@
+package cfapi
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// originDBWriteErrorCode is returned by the Cloudflare API when a signed
+// certificate could not be stored, and is safe to retry.
+const originDBWriteErrorCode = 1100
+
+// RetryPolicy controls how requests failing with a transient error are
+// retried. Retries are delayed with exponential backoff, starting at BaseDelay
+// and doubling on each attempt up to MaxDelay.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a failed request is retried. Requests
+	// are attempted once when zero.
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between retries.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomized to avoid retrying in lockstep with other clients.
+	Jitter float64
+
+	// RetryableCodes are the Cloudflare API error codes considered transient.
+	RetryableCodes []int
+
+	// PermanentCodes are the Cloudflare API error codes never retried, even
+	// when returned with one of the RetryableStatuses.
+	PermanentCodes []int
+
+	// RetryableStatuses are the HTTP status codes considered transient.
+	RetryableStatuses []int
+}
+
+// DefaultRetryPolicy returns the policy used by clients unless overridden with
+// WithRetryPolicy. Rate limiting, server errors and the codes classified as
+// temporary by DefaultErrorClasses are retried, except for server errors of
+// signing requests, see RetryableSign.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   10 * time.Second,
+		Jitter:     0.2,
+		RetryableStatuses: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}.WithErrorClasses(DefaultErrorClasses())
+}
+
+// Retryable reports whether err is an API error the policy considers
+// transient.
+func (p RetryPolicy) Retryable(err error) bool {
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	if slices.Contains(p.PermanentCodes, apiError.Code) {
+		return false
+	}
+
+	if slices.Contains(p.RetryableCodes, apiError.Code) {
+		return true
+	}
+
+	for _, status := range p.RetryableStatuses {
+		if apiError.StatusCode == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetryableSign reports whether err of a signing request is safe to retry. A
+// signing request failing with a server error may have been signed anyway,
+// and retrying it would sign a second certificate, so only rate limits, the
+// RetryableCodes and requests that failed before being sent are retried.
+func (p RetryPolicy) RetryableSign(err error) bool {
+	var notSent *notSentError
+	if errors.As(err, &notSent) {
+		return true
+	}
+
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	if slices.Contains(p.PermanentCodes, apiError.Code) {
+		return false
+	}
+
+	if slices.Contains(p.RetryableCodes, apiError.Code) {
+		return true
+	}
+
+	return apiError.StatusCode == http.StatusTooManyRequests && slices.Contains(p.RetryableStatuses, http.StatusTooManyRequests)
+}
+
+// notSentError is the error of a request that failed before it was written,
+// which the server never received.
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notSentError) Unwrap() error {
+	return e.err
+}
+
+// backoff returns the delay before the given retry, counting from zero.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < retry && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+
+	return delay
+}
+
+// TransientError is returned when a request failed with an error the retry
+// policy considers transient, and every retry was exhausted. Callers may
+// safely retry the request later.
+type TransientError struct {
+	Err      error
+	Attempts int
+
+	// RetryAfter is the delay asked for by the Retry-After header of the
+	// last attempt, if any.
+	RetryAfter time.Duration
+}
+
+func newTransientError(err error, attempts int) *TransientError {
+	transient := &TransientError{Err: err, Attempts: attempts}
+
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		transient.RetryAfter = apiError.RetryAfter
+	}
+
+	return transient
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// withRetry calls fn until it succeeds, fails with an error that isn't
+// transient, or the retry policy is exhausted. Requests that aren't
+// idempotent are only retried when RetryableSign allows it, and are
+// otherwise returned as a TransientError at once if the error is transient.
+func (c *Client) withRetry(ctx context.Context, idempotent bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var rateLimited *RateLimitError
+		if errors.As(err, &rateLimited) {
+			return err
+		}
+
+		// Waiting out a rate limit is left to the caller, rather than
+		// holding on to the request until the limit resets.
+		if wait := c.limiter.delay(c.clock.Now()); wait > 0 {
+			return &RateLimitError{RetryAfter: wait, Err: err}
+		}
+
+		if !idempotent && !c.retry.RetryableSign(err) {
+			if c.retry.Retryable(err) {
+				return newTransientError(err, attempt+1)
+			}
+
+			return err
+		}
+
+		if idempotent && !c.retry.Retryable(err) {
+			return err
+		}
+
+		if attempt >= c.retry.MaxRetries {
+			return newTransientError(err, attempt+1)
+		}
+
+		timer := c.clock.NewTimer(c.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return newTransientError(err, attempt+1)
+		case <-timer.C():
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package cfapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Second,
+	}
+
+	var got []time.Duration
+	for retry := 0; retry < 5; retry++ {
+		got = append(got, policy.backoff(retry))
+	}
+
+	assert.DeepEqual(t, got, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	})
+
+	policy.Jitter = 0.5
+	for retry := 0; retry < 5; retry++ {
+		delay := policy.backoff(retry)
+		assert.Assert(t, delay > got[retry]/2 && delay <= got[retry], "retry %d: %s outside of jitter range", retry, delay)
+	}
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		sign      bool
+	}{
+		{
+			name:      "database write error",
+			err:       &APIError{Code: 1100, StatusCode: http.StatusOK},
+			retryable: true,
+			sign:      true,
+		},
+		{
+			name:      "rate limited",
+			err:       &APIError{Code: 10000, StatusCode: http.StatusTooManyRequests},
+			retryable: true,
+			sign:      true,
+		},
+		{
+			name:      "wrapped server error",
+			err:       fmt.Errorf("signing: %w", &APIError{Code: 503, StatusCode: http.StatusServiceUnavailable}),
+			retryable: true,
+		},
+		{
+			name: "not sent",
+			err:  &notSentError{err: errors.New("connection refused")},
+			sign: true,
+		},
+		{
+			name: "invalid csr",
+			err:  &APIError{Code: 1010, StatusCode: http.StatusBadRequest},
+		},
+		{
+			name: "not an API error",
+			err:  errors.New("connection refused"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, policy.Retryable(tt.err), tt.retryable)
+			assert.Equal(t, policy.RetryableSign(tt.err), tt.sign)
+		})
+	}
+}
+
+func TestSign_Retry(t *testing.T) {
+	const (
+		success     = `{"success": true, "errors": [], "messages": [], "result": {"id": "1", "certificate": "bogus", "expires_on": "2020-12-25T06:27:00Z"}}`
+		dbWriteFail = `{"success": false, "errors": [{"code": 1100, "message": "Failed to write certificate to Database"}], "messages": [], "result": null}`
+		invalidCSR  = `{"success": false, "errors": [{"code": 1010, "message": "Invalid CSR"}], "messages": [], "result": null}`
+	)
+
+	type response struct {
+		status int
+		body   string
+	}
+
+	tests := []struct {
+		name      string
+		responses []response
+		retries   int
+		attempts  int
+		error     string
+		transient bool
+	}{
+		{
+			name: "server errors not retried",
+			responses: []response{
+				{status: http.StatusBadGateway, body: "<html>bad gateway</html>"},
+			},
+			retries:   3,
+			attempts:  1,
+			error:     "Cloudflare API Error code=502 message=Bad Gateway ray_id=",
+			transient: true,
+		},
+		{
+			name: "recovers from database write errors",
+			responses: []response{
+				{status: http.StatusOK, body: dbWriteFail},
+				{status: http.StatusOK, body: success},
+			},
+			retries:  3,
+			attempts: 2,
+		},
+		{
+			name: "retries exhausted",
+			responses: []response{
+				{status: http.StatusTooManyRequests, body: "{}"},
+				{status: http.StatusTooManyRequests, body: "{}"},
+				{status: http.StatusTooManyRequests, body: "{}"},
+			},
+			retries:   2,
+			attempts:  3,
+			error:     "Cloudflare API Error code=429 message=Too Many Requests ray_id=",
+			transient: true,
+		},
+		{
+			name: "retries disabled",
+			responses: []response{
+				{status: http.StatusOK, body: dbWriteFail},
+			},
+			attempts:  1,
+			error:     "Cloudflare API Error code=1100 message=Failed to write certificate to Database ray_id=",
+			transient: true,
+		},
+		{
+			name: "not retryable",
+			responses: []response{
+				{status: http.StatusBadRequest, body: invalidCSR},
+			},
+			retries:  3,
+			attempts: 1,
+			error:    "Cloudflare API Error code=1010 message=Invalid CSR ray_id=",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resp := tt.responses[attempts]
+				attempts++
+
+				w.WriteHeader(resp.status)
+				fmt.Fprintln(w, resp.body)
+			}))
+			defer ts.Close()
+
+			clock := fakeClock.NewFakeClock(time.Now())
+			policy := DefaultRetryPolicy()
+			policy.MaxRetries = tt.retries
+			policy.Jitter = 0
+
+			client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+				WithClient(ts.Client()),
+				WithClock(clock),
+				WithRetryPolicy(policy),
+				Must(WithEndpoint(ts.URL)),
+			)
+
+			done := make(chan error)
+			go func() {
+				_, err := client.Sign(context.Background(), &SignRequest{})
+				done <- err
+			}()
+
+			var err error
+		wait:
+			for {
+				select {
+				case err = <-done:
+					break wait
+				default:
+					if clock.HasWaiters() {
+						clock.Step(policy.MaxDelay)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			var transient *TransientError
+			assert.Equal(t, errors.As(err, &transient), tt.transient)
+			assert.Equal(t, attempts, tt.attempts)
+		})
+	}
+}
+
+func TestSign_TransientRetryAfter(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, `{"success": false, "errors": [{"code": 1100, "message": "Failed to write certificate to Database"}]}`)
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.MaxRetries = 0
+
+	client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+		WithClient(ts.Client()),
+		WithClock(fakeClock.NewFakeClock(time.Now())),
+		WithRetryPolicy(policy),
+		Must(WithEndpoint(ts.URL)),
+	)
+
+	_, err := client.Sign(context.Background(), &SignRequest{})
+
+	var transient *TransientError
+	assert.Assert(t, errors.As(err, &transient))
+	assert.Equal(t, transient.RetryAfter, 2*time.Minute)
+	assert.Assert(t, IsOriginDBWriteError(err))
+}
+
+func TestList_Retry(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintln(w, "<html>bad gateway</html>")
+			return
+		}
+
+		fmt.Fprintln(w, `{"success": true, "errors": [], "messages": [], "result": [], "result_info": {"total_count": 0}}`)
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+	policy.Jitter = 0
+
+	client := New(Credentials{ServiceKey: []byte("v1.0-FFFF-FFFF")},
+		WithClient(ts.Client()),
+		WithRetryPolicy(policy),
+		Must(WithEndpoint(ts.URL)),
+	)
+
+	_, err := client.List(context.Background(), &ListRequest{ZoneID: "023e105f4ecef8ad9ca31a8372d0c353"})
+	assert.NilError(t, err)
+	assert.Equal(t, attempts, 3)
+}
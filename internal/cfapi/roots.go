@@ -0,0 +1,211 @@
+package cfapi
+
+import (
+	"context"
+	"crypto/x509"
+	"embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+)
+
+// RootURLs are the locations Cloudflare publishes the Origin CA root
+// certificates at, by the request type of the certificates they sign.
+var RootURLs = map[string]string{
+	"origin-rsa": "https://developers.cloudflare.com/ssl/static/origin_ca_rsa_root.pem",
+	"origin-ecc": "https://developers.cloudflare.com/ssl/static/origin_ca_ecc_root.pem",
+}
+
+// maxRootSize bounds the size of a fetched root certificate, which is a
+// couple of kilobytes.
+const maxRootSize = 64 << 10
+
+// embeddedRoots holds the Origin CA root certificates vendored into the
+// controller, refreshed with `make update-origin-ca-roots`.
+//
+//go:embed roots
+var embeddedRoots embed.FS
+
+// EmbeddedRoots returns the Origin CA root certificates vendored into the
+// controller, by request type. Request types without a vendored root are
+// missing from the map.
+func EmbeddedRoots() (map[string][]byte, error) {
+	return readRoots(embeddedRoots, "roots")
+}
+
+// LoadRoots reads the Origin CA root certificates of the directory, such as
+// a mounted ConfigMap, by request type. Each root is a PEM file named after
+// its request type, such as origin-rsa.pem. Request types without a file
+// are missing from the map.
+func LoadRoots(dir string) (map[string][]byte, error) {
+	return readRoots(os.DirFS(dir), ".")
+}
+
+func readRoots(fsys fs.FS, dir string) (map[string][]byte, error) {
+	roots := make(map[string][]byte)
+	for requestType := range RootURLs {
+		name := path.Join(dir, requestType+".pem")
+
+		data, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		root, err := parseRoot(data)
+		if err != nil {
+			return nil, fmt.Errorf("reading Origin CA root %s: %w", name, err)
+		}
+
+		roots[requestType] = root
+	}
+
+	return roots, nil
+}
+
+// RootStore fetches the Origin CA root certificates on first use, and caches
+// them for the lifetime of the process. Failed fetches are not cached. Roots
+// pinned with Pin are never fetched.
+type RootStore struct {
+	client *http.Client
+	urls   map[string]string
+
+	mu     sync.Mutex
+	roots  map[string][]byte
+	pinned map[string]bool
+}
+
+// NewRootStore returns a RootStore fetching the roots from urls, by request
+// type, with the given client.
+func NewRootStore(client *http.Client, urls map[string]string) *RootStore {
+	return &RootStore{
+		client: client,
+		urls:   urls,
+		roots:  make(map[string][]byte),
+		pinned: make(map[string]bool),
+	}
+}
+
+// Pin sets the root certificates of request types, such as vendored roots
+// or roots overridden by configuration when Cloudflare rotates them, rather
+// than fetching them. Later pins override earlier ones.
+func (s *RootStore) Pin(roots map[string][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for requestType, root := range roots {
+		s.roots[requestType] = root
+		s.pinned[requestType] = true
+	}
+}
+
+// Root returns the PEM encoded root certificate of the Origin CA signing
+// certificates of the request type, such as "origin-rsa".
+func (s *RootStore) Root(ctx context.Context, requestType string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if root, ok := s.roots[requestType]; ok {
+		return root, nil
+	}
+
+	url, ok := s.urls[requestType]
+	if !ok {
+		return nil, fmt.Errorf("no Origin CA root known for request type %q", requestType)
+	}
+
+	root, err := s.fetch(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching Origin CA root for request type %q: %w", requestType, err)
+	}
+
+	s.roots[requestType] = root
+
+	return root, nil
+}
+
+// Refresh fetches the root certificate of the request type again, replacing
+// the cached root, so that roots rotated by Cloudflare are noticed. Pinned
+// roots are returned as is. On failure the cached root is kept.
+func (s *RootStore) Refresh(ctx context.Context, requestType string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pinned[requestType] {
+		return s.roots[requestType], nil
+	}
+
+	url, ok := s.urls[requestType]
+	if !ok {
+		return nil, fmt.Errorf("no Origin CA root known for request type %q", requestType)
+	}
+
+	root, err := s.fetch(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching Origin CA root for request type %q: %w", requestType, err)
+	}
+
+	s.roots[requestType] = root
+
+	return root, nil
+}
+
+func (s *RootStore) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRootSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(body); block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("response is not a PEM encoded certificate")
+	}
+
+	return parseRoot(body)
+}
+
+// parseRoot checks that data is a PEM encoded, self-signed certificate
+// authority, and returns it re-encoded without anything around it.
+func parseRoot(data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("not a PEM encoded certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %q is not a certificate authority", cert.Subject)
+	}
+
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		return nil, fmt.Errorf("certificate %q is not a self-signed root: %w", cert.Subject, err)
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
@@ -0,0 +1,22 @@
+//go:build release
+
+package cfapi
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// TestEmbeddedRootsComplete checks that a root is vendored for every request
+// type, so that released controllers don't depend on fetching them. Run it
+// with `make verify-origin-ca-roots`.
+func TestEmbeddedRootsComplete(t *testing.T) {
+	roots, err := EmbeddedRoots()
+	assert.NilError(t, err)
+
+	for requestType := range RootURLs {
+		_, ok := roots[requestType]
+		assert.Assert(t, ok, "no Origin CA root vendored for request type %q, run make update-origin-ca-roots", requestType)
+	}
+}
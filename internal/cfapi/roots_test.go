@@ -0,0 +1,191 @@
+package cfapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRootStore(t *testing.T) {
+	root := selfSigned(t, true)
+	leaf := selfSigned(t, false)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		status      int
+		requestType string
+		error       string
+	}{
+		{
+			name:        "root",
+			body:        root,
+			requestType: "origin-ecc",
+		},
+		{
+			name:        "unknown request type",
+			body:        root,
+			requestType: "origin-dsa",
+			error:       `no Origin CA root known for request type "origin-dsa"`,
+		},
+		{
+			name:        "server error",
+			status:      http.StatusInternalServerError,
+			requestType: "origin-ecc",
+			error:       `fetching Origin CA root for request type "origin-ecc": unexpected status 500 Internal Server Error`,
+		},
+		{
+			name:        "not a certificate",
+			body:        []byte("<html></html>"),
+			requestType: "origin-ecc",
+			error:       `fetching Origin CA root for request type "origin-ecc": response is not a PEM encoded certificate`,
+		},
+		{
+			name:        "not a certificate authority",
+			body:        leaf,
+			requestType: "origin-ecc",
+			error:       `fetching Origin CA root for request type "origin-ecc": certificate "CN=Origin CA" is not a certificate authority`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				_, _ = w.Write(tt.body)
+			}))
+			defer ts.Close()
+
+			store := NewRootStore(ts.Client(), map[string]string{"origin-ecc": ts.URL})
+
+			for i := 0; i < 2; i++ {
+				got, err := store.Root(context.Background(), tt.requestType)
+				if tt.error != "" {
+					assert.Error(t, err, tt.error)
+					continue
+				}
+
+				assert.NilError(t, err)
+				assert.DeepEqual(t, got, root)
+			}
+
+			// Roots are only fetched once, but failures are retried.
+			if tt.error == "" {
+				assert.Equal(t, requests, 1)
+			}
+		})
+	}
+}
+
+func TestRootStorePin(t *testing.T) {
+	pinned := selfSigned(t, true)
+	fetched := selfSigned(t, true)
+
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(fetched)
+	}))
+	defer ts.Close()
+
+	store := NewRootStore(ts.Client(), map[string]string{"origin-rsa": ts.URL, "origin-ecc": ts.URL})
+	store.Pin(map[string][]byte{"origin-ecc": pinned})
+
+	got, err := store.Root(context.Background(), "origin-ecc")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, pinned)
+	assert.Equal(t, requests, 0)
+
+	// Roots which aren't pinned are still fetched.
+	got, err = store.Root(context.Background(), "origin-rsa")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, fetched)
+	assert.Equal(t, requests, 1)
+
+	// Refreshing only fetches roots which aren't pinned.
+	got, err = store.Refresh(context.Background(), "origin-ecc")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, pinned)
+	assert.Equal(t, requests, 1)
+
+	fetched = selfSigned(t, true)
+	got, err = store.Refresh(context.Background(), "origin-rsa")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, fetched)
+	assert.Equal(t, requests, 2)
+
+	got, err = store.Root(context.Background(), "origin-rsa")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, fetched)
+	assert.Equal(t, requests, 2)
+}
+
+func TestLoadRoots(t *testing.T) {
+	root := selfSigned(t, true)
+
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "origin-ecc.pem"), append([]byte("# Origin CA ECC root\n"), root...), 0o600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "unrelated.pem"), []byte("ignored"), 0o600))
+
+	roots, err := LoadRoots(dir)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, roots, map[string][]byte{"origin-ecc": root})
+
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "origin-rsa.pem"), selfSigned(t, false), 0o600))
+	_, err = LoadRoots(dir)
+	assert.Error(t, err, `reading Origin CA root origin-rsa.pem: certificate "CN=Origin CA" is not a certificate authority`)
+
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "origin-rsa.pem"), []byte("<html></html>"), 0o600))
+	_, err = LoadRoots(dir)
+	assert.Error(t, err, "reading Origin CA root origin-rsa.pem: not a PEM encoded certificate")
+}
+
+func TestEmbeddedRoots(t *testing.T) {
+	roots, err := EmbeddedRoots()
+	assert.NilError(t, err)
+
+	for requestType := range roots {
+		_, ok := RootURLs[requestType]
+		assert.Assert(t, ok, "unexpected request type %q", requestType)
+	}
+}
+
+func selfSigned(t *testing.T, isCA bool) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Origin CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,74 @@
+package cfapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TransportOptions configures the HTTP client calling the Cloudflare API,
+// such as to reach it through an egress proxy.
+type TransportOptions struct {
+	// Timeout bounds each request, including reading its response. No
+	// timeout is applied when zero.
+	Timeout time.Duration
+
+	// ProxyURL is the HTTP proxy requests are sent through. When nil, the
+	// proxy is selected by the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	// environment variables.
+	ProxyURL *url.URL
+
+	// CAFile is a PEM bundle of certificate authorities trusted in addition
+	// to the system roots, such as that of a TLS-intercepting proxy.
+	CAFile string
+
+	// InsecureSkipVerify disables verifying the certificate of the API, and
+	// should only be used for testing.
+	InsecureSkipVerify bool
+}
+
+// NewHTTPClient returns an HTTP client configured by the options, for use
+// WithClient.
+func NewHTTPClient(opts TransportOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(opts.ProxyURL)
+	}
+
+	if opts.CAFile != "" || opts.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: opts.InsecureSkipVerify, //nolint:gosec // opt-in, for testing
+		}
+
+		if opts.CAFile != "" {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+
+			pem, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+			}
+
+			tlsConfig.RootCAs = pool
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}, nil
+}
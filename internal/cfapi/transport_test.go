@@ -0,0 +1,69 @@
+package cfapi
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestNewHTTPClientCAFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+
+	c, err := NewHTTPClient(TransportOptions{Timeout: 10 * time.Second})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Timeout, 10*time.Second)
+
+	_, err = c.Get(ts.URL)
+	assert.ErrorContains(t, err, "certificate")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NilError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: ts.Certificate().Raw,
+	}), 0o600))
+
+	c, err = NewHTTPClient(TransportOptions{CAFile: caFile})
+	assert.NilError(t, err)
+
+	resp, err := c.Get(ts.URL)
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	assert.NilError(t, os.WriteFile(empty, nil, 0o600))
+
+	_, err = NewHTTPClient(TransportOptions{CAFile: empty})
+	assert.Error(t, err, "no certificates found in "+empty)
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.NilError(t, err)
+
+	c, err := NewHTTPClient(TransportOptions{ProxyURL: proxyURL})
+	assert.NilError(t, err)
+
+	resp, err := c.Get("http://api.cloudflare.example/client/v4/certificates")
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, proxied, "http://api.cloudflare.example/client/v4/certificates")
+}
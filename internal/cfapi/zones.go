@@ -0,0 +1,167 @@
+package cfapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ZoneStatusActive is the status of zones whose traffic is proxied by
+// Cloudflare, once their nameservers were changed to Cloudflare's.
+const ZoneStatusActive = "active"
+
+// DefaultZoneCacheTTL is how long zones found by name are cached by clients
+// created WithZoneCache.
+const DefaultZoneCacheTTL = 5 * time.Minute
+
+// Zone is a Cloudflare zone, such as example.com.
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Status is the status of the zone, such as active, pending or moved.
+	Status string `json:"status,omitempty"`
+
+	// Paused is set on zones whose traffic is no longer proxied by
+	// Cloudflare, but sent straight to the origin.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Active reports whether the zone is active and not paused, and so whether
+// Cloudflare serves the Origin CA certificates of its hostnames.
+func (z *Zone) Active() bool {
+	return z.Status == ZoneStatusActive && !z.Paused
+}
+
+// ZoneFinder is implemented by API clients able to find Cloudflare zones by
+// name.
+type ZoneFinder interface {
+	Zones(ctx context.Context, name string) ([]Zone, error)
+}
+
+// ErrZonesUnsupported is returned when finding zones with an API client
+// that can't, such as a certificate broker.
+var ErrZonesUnsupported = errors.New("the Cloudflare API client does not support finding zones")
+
+// WithZoneCache caches the zones found by name for the TTL, so that the
+// zones of the hostnames of every CertificateRequest aren't looked up again
+// for each. Failed lookups are not cached.
+func WithZoneCache(ttl time.Duration) Options {
+	return func(c *Client) {
+		c.zoneCache = &zoneCache{ttl: ttl, entries: make(map[string]zoneCacheEntry)}
+	}
+}
+
+// Zones returns the zones named name that the client's credentials can
+// access. API tokens only see the zones they are granted a permission on,
+// while service keys can't list zones at all.
+func (c *Client) Zones(ctx context.Context, name string) ([]Zone, error) {
+	if zones, ok := c.zoneCache.get(name, c.clock.Now()); ok {
+		return zones, nil
+	}
+
+	var zones []Zone
+	err := c.withRetry(ctx, true, func() error {
+		var err error
+		zones, err = c.zones(ctx, name)
+		return err
+	})
+	if err == nil {
+		c.zoneCache.put(name, zones, c.clock.Now())
+	}
+
+	return zones, err
+}
+
+func (c *Client) zones(ctx context.Context, name string) ([]Zone, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/client/v4/zones"
+	u.RawQuery = url.Values{"name": {name}}.Encode()
+
+	r, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rayID := resp.Header.Get("CF-Ray")
+
+	api := APIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&api); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, statusError(resp, rayID, c.clock.Now())
+		}
+
+		return nil, err
+	}
+
+	if !api.Success {
+		return nil, api.apiError(resp, rayID, c.clock.Now())
+	}
+
+	var zones []Zone
+	if err := json.Unmarshal(api.Result, &zones); err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+type zoneCacheEntry struct {
+	zones   []Zone
+	expires time.Time
+}
+
+// zoneCache holds the zones found by name until they expire. A nil
+// zoneCache caches nothing.
+type zoneCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]zoneCacheEntry
+}
+
+func (z *zoneCache) get(name string, now time.Time) ([]Zone, bool) {
+	if z == nil {
+		return nil, false
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	e, ok := z.entries[name]
+	if !ok || !now.Before(e.expires) {
+		return nil, false
+	}
+
+	return append([]Zone(nil), e.zones...), true
+}
+
+func (z *zoneCache) put(name string, zones []Zone, now time.Time) {
+	if z == nil {
+		return
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for k, e := range z.entries {
+		if !now.Before(e.expires) {
+			delete(z.entries, k)
+		}
+	}
+
+	z.entries[name] = zoneCacheEntry{zones: append([]Zone(nil), zones...), expires: now.Add(z.ttl)}
+}
@@ -5,7 +5,13 @@ import (
 )
 
 // +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=oi
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Request Type",type="string",JSONPath=".spec.requestType"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // An OriginIssuer represents the Cloudflare Origin CA as an external cert-manager issuer.
 // It is scoped to a single namespace, so it can be used only by resources in the same
@@ -33,8 +39,13 @@ type OriginIssuerList struct {
 }
 
 // +kubebuilder:object:root=true
-// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:resource:scope=Cluster,shortName=coi
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Request Type",type="string",JSONPath=".spec.requestType"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // A ClusterOriginIssuer represents the Cloudflare Origin CA as an external cert-manager issuer.
 // It is scoped to a single namespace, so it can be used only by resources in the same
@@ -65,26 +76,428 @@ type ClusterOriginIssuerList struct {
 // configuration required for the issuer.
 type OriginIssuerSpec struct {
 	// RequestType is the signature algorithm Cloudflare should use to sign the certificate.
+	// When the admission webhook is enabled, it is defaulted if omitted.
 	RequestType RequestType `json:"requestType"`
 
+	// DualStack additionally signs each certificate with the signature
+	// algorithm not selected by RequestType, for proxies serving both RSA and
+	// ECDSA chains. Both certificates are issued for the same key and
+	// hostnames. The one signed as RequestType is published, and the other
+	// recorded in the DualStackCertificateAnnotation of the request.
+	// +optional
+	DualStack bool `json:"dualStack,omitempty"`
+
+	// RequireMatchingKeyType fails CertificateRequests whose public key
+	// doesn't match RequestType, such as ECDSA keys for OriginRSA issuers,
+	// with the KeyTypeMismatch reason, rather than sending them to
+	// Cloudflare. May not be set together with DualStack, which signs each
+	// key as both request types.
+	// +optional
+	RequireMatchingKeyType bool `json:"requireMatchingKeyType,omitempty"`
+
+	// IncludeChain appends the certificate of the Origin CA to each signed
+	// certificate, for TLS servers that require the full chain. Origin CA
+	// certificates are signed directly by the Origin CA root, so the chain
+	// ends with the root.
+	// +optional
+	IncludeChain bool `json:"includeChain,omitempty"`
+
+	// PEMFormat normalizes the PEM encoding of signed certificates, for
+	// consumers of tls.crt sensitive to its formatting. Certificates are
+	// published as returned by Cloudflare when unset.
+	// +optional
+	PEMFormat *PEMFormat `json:"pemFormat,omitempty"`
+
+	// MinDuration is the shortest validity certificates may be requested
+	// with. Requested durations are rounded, following DurationPolicy, to a
+	// validity supported by Cloudflare between MinDuration and MaxDuration.
+	// +optional
+	MinDuration *metav1.Duration `json:"minDuration,omitempty"`
+
+	// MaxDuration is the longest validity certificates may be requested with.
+	// +optional
+	MaxDuration *metav1.Duration `json:"maxDuration,omitempty"`
+
+	// DefaultDuration is the validity requested for CertificateRequests
+	// without a duration. Defaults to 7 days.
+	// +optional
+	DefaultDuration *metav1.Duration `json:"defaultDuration,omitempty"`
+
+	// DurationPolicy selects how requested durations are rounded to a
+	// validity supported by Cloudflare. Defaults to Closest.
+	// +optional
+	DurationPolicy DurationPolicy `json:"durationPolicy,omitempty"`
+
+	// ZoneID is the ID of the Cloudflare zone the issuer's certificates are
+	// for. When set, the number of Origin CA certificates of the zone is
+	// reported in the issuer's status, so that operators can anticipate the
+	// zone's certificate limit.
+	// +optional
+	ZoneID string `json:"zoneID,omitempty"`
+
+	// CertificateQuota is the Origin CA certificate limit of the zone
+	// selected by ZoneID. When set, the number of certificates the zone may
+	// still have is reported in the issuer's status, and its QuotaExhausted
+	// condition is set once the zone nears its limit, before renewals start
+	// failing. Requires ZoneID.
+	// +optional
+	CertificateQuota *CertificateQuota `json:"certificateQuota,omitempty"`
+
+	// RevokeSuperseded revokes the Origin CA certificates recorded on the
+	// earlier revisions of a Certificate once a new one is signed for it,
+	// so that renewals don't leave the zone to reach its certificate limit.
+	// Certificates issued by other means for the same hostnames are left
+	// alone. Requires ZoneID.
+	// +optional
+	RevokeSuperseded bool `json:"revokeSuperseded,omitempty"`
+
+	// DuplicatePolicy selects what happens when an unexpired Origin CA
+	// certificate of the zone was already issued for the exact hostnames and
+	// request type of a CertificateRequest: AlwaysNew signs a new one, Reuse
+	// publishes the existing certificate instead if it was issued for the
+	// same key and is not yet due for renewal, and Fail fails the
+	// CertificateRequest. Defaults to AlwaysNew. Reuse and Fail require
+	// ZoneID.
+	// +optional
+	DuplicatePolicy DuplicatePolicy `json:"duplicatePolicy,omitempty"`
+
+	// WildcardThreshold is the number of hostnames of a CertificateRequest
+	// sharing a parent domain, such as a.example.com and b.example.com, from
+	// which an event suggests a wildcard certificate of the parent domain,
+	// *.example.com, instead. Disabled when zero.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	WildcardThreshold int `json:"wildcardThreshold,omitempty"`
+
+	// CollapseToWildcard replaces the hostnames sharing a parent domain
+	// reaching the WildcardThreshold by a wildcard of the parent domain when
+	// signing, so that certificates stay within Cloudflare's hostname limit.
+	// Requires WildcardThreshold.
+	// +optional
+	CollapseToWildcard bool `json:"collapseToWildcard,omitempty"`
+
+	// ResolveZones resolves the Cloudflare zone of each hostname of a
+	// CertificateRequest before signing it, and checks the issuer's API token
+	// can manage the Origin CA certificates of each zone, so that requests
+	// for hostnames outside of the token's zones fail with an error naming
+	// the hostname and zone. Requires authenticating with an API token.
+	// +optional
+	ResolveZones bool `json:"resolveZones,omitempty"`
+
+	// RequireActiveZones fails CertificateRequests for hostnames of zones
+	// that aren't active in Cloudflare, such as paused zones or zones whose
+	// nameservers weren't changed yet, with the ZoneInactive reason, as
+	// Cloudflare would not serve their certificates. Requires ResolveZones.
+	// +optional
+	RequireActiveZones bool `json:"requireActiveZones,omitempty"`
+
+	// AllowedDNSNames are hostnames, such as "www.example.com" or
+	// "*.example.com", the issuer may sign certificates for. Together with
+	// AllowedDNSZones, requests for any other hostname fail with the
+	// HostnameNotAllowed reason. Every hostname is allowed when both are
+	// empty.
+	// +optional
+	AllowedDNSNames []string `json:"allowedDNSNames,omitempty"`
+
+	// AllowedDNSZones are domains, such as "example.com", whose hostnames,
+	// including the domain itself and its wildcards, the issuer may sign
+	// certificates for.
+	// +optional
+	AllowedDNSZones []string `json:"allowedDNSZones,omitempty"`
+
+	// AllowedNamespaces restricts the namespaces whose CertificateRequests a
+	// ClusterOriginIssuer signs. Requests from other namespaces fail with the
+	// NamespaceNotAllowed reason. All namespaces are allowed when unset. Not
+	// supported by OriginIssuers, which only sign requests of their own
+	// namespace.
+	// +optional
+	AllowedNamespaces *AllowedNamespaces `json:"allowedNamespaces,omitempty"`
+
+	// CloudflareAPIURL overrides the Cloudflare API endpoint the issuer's
+	// requests are sent to, such as an internal API gateway or a mock server
+	// in end to end tests. Must be an https URL the controller allows with
+	// --issuer-cf-api-url. Defaults to the controller's endpoints.
+	// +optional
+	CloudflareAPIURL string `json:"cloudflareAPIURL,omitempty"`
+
+	// Canary rolls out changes of Auth and CloudflareAPIURL gradually: only
+	// a percentage of new CertificateRequests are signed with the changed
+	// configuration, and the rest with the stable configuration recorded in
+	// the issuer's status, until enough requests were signed with the
+	// changed configuration to promote it. Set it before changing the
+	// configuration, as the configuration verified when it is set becomes
+	// the stable configuration.
+	// +optional
+	Canary *Canary `json:"canary,omitempty"`
+
 	// Auth configures how to authenticate with the Cloudflare API.
 	Auth OriginIssuerAuthentication `json:"auth"`
 }
 
+// Canary configures the gradual rollout of the changes of an issuer's
+// configuration.
+type Canary struct {
+	// Percent of new CertificateRequests signed with the changed
+	// configuration.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Percent int `json:"percent"`
+
+	// Successes is the number of CertificateRequests signed with the changed
+	// configuration promoting it to the stable configuration. Defaults to 5.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Successes int `json:"successes,omitempty"`
+}
+
+// IssuerConfiguration is the part of an issuer's spec rolled out by a Canary.
+type IssuerConfiguration struct {
+	// CloudflareAPIURL is the Cloudflare API endpoint of the configuration.
+	// +optional
+	CloudflareAPIURL string `json:"cloudflareAPIURL,omitempty"`
+
+	// Auth is how the configuration authenticates with the Cloudflare API.
+	Auth OriginIssuerAuthentication `json:"auth"`
+}
+
+// CanaryStatus is the progress of the rollout of a changed configuration.
+type CanaryStatus struct {
+	// Generation of the issuer whose configuration is rolled out. The
+	// rollout restarts whenever the spec changes.
+	Generation int64 `json:"generation"`
+
+	// Successes is the number of CertificateRequests signed with the changed
+	// configuration.
+	// +optional
+	Successes int `json:"successes,omitempty"`
+
+	// Failed is set once signing with the changed configuration failed, after
+	// which every CertificateRequest is signed with the stable configuration
+	// until the spec changes again.
+	// +optional
+	Failed bool `json:"failed,omitempty"`
+
+	// Message explains why the changed configuration failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// CertificateQuota is the Origin CA certificate limit of a zone.
+type CertificateQuota struct {
+	// Limit is the number of Origin CA certificates the zone may have.
+	// +kubebuilder:validation:Minimum=1
+	Limit int `json:"limit"`
+
+	// Reserve is the number of remaining certificates from which the zone is
+	// near its limit. Defaults to a tenth of Limit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Reserve *int `json:"reserve,omitempty"`
+}
+
+// AllowedNamespaces selects namespaces by name or by label. A namespace is
+// allowed if it is listed in Names or matches Selector.
+type AllowedNamespaces struct {
+	// Names of the allowed namespaces.
+	// +optional
+	Names []string `json:"names,omitempty"`
+
+	// Selector of the labels of the allowed namespaces.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
 // OriginIssuerStatus contains status information about an OriginIssuer
 type OriginIssuerStatus struct {
 	// List of status conditions to indicate the status of an OriginIssuer
 	// Known condition types are `Ready`.
 	// +optional
-	Conditions []OriginIssuerCondition `json:"conditions,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// ObservedGeneration is the generation of the issuer last reconciled.
+	// Conditions are stale while it is behind the issuer's generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastVerifiedTime is when the issuer's credentials were last verified
+	// with the Cloudflare API.
+	// +optional
+	LastVerifiedTime *metav1.Time `json:"lastVerifiedTime,omitempty"`
+
+	// FailedAttempts is the number of consecutive reconciles that failed to
+	// make the issuer ready, reset once its credentials are verified.
+	// +optional
+	FailedAttempts int `json:"failedAttempts,omitempty"`
+
+	// CertificateCount is the number of Origin CA certificates of the zone
+	// selected by ZoneID, including those not issued by this issuer, as of
+	// CertificateCountTime.
+	// +optional
+	CertificateCount *int `json:"certificateCount,omitempty"`
+
+	// QuotaRemaining is the number of Origin CA certificates the zone may
+	// still have before reaching the limit of CertificateQuota, as of
+	// CertificateCountTime.
+	// +optional
+	QuotaRemaining *int `json:"quotaRemaining,omitempty"`
+
+	// CertificateCountTime is when CertificateCount was last updated.
+	// +optional
+	CertificateCountTime *metav1.Time `json:"certificateCountTime,omitempty"`
+
+	// StableConfiguration is the configuration signing the CertificateRequests
+	// not selected by the Canary while a changed configuration is rolled
+	// out. Only recorded for issuers with a Canary.
+	// +optional
+	StableConfiguration *IssuerConfiguration `json:"stableConfiguration,omitempty"`
+
+	// Canary is the progress of the rollout of the spec's configuration,
+	// while it differs from StableConfiguration.
+	// +optional
+	Canary *CanaryStatus `json:"canary,omitempty"`
 }
 
 // OriginIssuerAuthentication defines how to authenticate with the Cloudflare API.
-// Only one of `serviceKeyRef` may be specified.
+// Only one of `serviceKeyRef`, `apiTokenRef`, `tokenExchange` or `vault` may be
+// specified.
 type OriginIssuerAuthentication struct {
 	// ServiceKeyRef authenticates with an API Service Key.
 	// +optional
 	ServiceKeyRef SecretKeySelector `json:"serviceKeyRef,omitempty"`
+
+	// APITokenRef authenticates with a Cloudflare API Token. The token must be
+	// granted the "Zone / SSL and Certificates / Edit" permission.
+	// +optional
+	APITokenRef *SecretKeySelector `json:"apiTokenRef,omitempty"`
+
+	// TokenExchange authenticates with short-lived credentials retrieved
+	// from a secret broker, in exchange for a token of a ServiceAccount,
+	// rather than with a credential stored in a Secret.
+	// +optional
+	TokenExchange *TokenExchange `json:"tokenExchange,omitempty"`
+
+	// Vault authenticates with a credential read from HashiCorp Vault when
+	// signing, rather than with a credential stored in a Secret.
+	// +optional
+	Vault *VaultAuth `json:"vault,omitempty"`
+
+	// VerifyTokenRef authenticates the readiness checks, certificate counts
+	// and zone lookups of the issuer with a separate Cloudflare API Token of
+	// lower privilege, such as one only granted the "Zone / Zone / Read" and
+	// "Zone / SSL and Certificates / Read" permissions, so that the signing
+	// credential is only retrieved to sign and revoke certificates. The
+	// signing credential is then not verified until a certificate is signed.
+	// +optional
+	VerifyTokenRef *SecretKeySelector `json:"verifyTokenRef,omitempty"`
+
+	// Zones authenticates CertificateRequests for hostnames of the listed
+	// zones with their own credential, such as that of another Cloudflare
+	// account, rather than with the issuer's. All hostnames of a request must
+	// fall under the zones of the same credential, or under none of them.
+	// +optional
+	Zones []ZoneCredential `json:"zones,omitempty"`
+}
+
+// ZoneCredential is a credential stored in a Secret, used to sign
+// certificates for the hostnames of some zones. Exactly one of ServiceKeyRef
+// and APITokenRef must be set.
+type ZoneCredential struct {
+	// Zones whose hostnames, including the zone itself, are signed with this
+	// credential, such as "example.com" or "*.example.com". Hostnames of
+	// several matching zones use the longest.
+	Zones []string `json:"zones"`
+
+	// ServiceKeyRef authenticates with an API Service Key.
+	// +optional
+	ServiceKeyRef *SecretKeySelector `json:"serviceKeyRef,omitempty"`
+
+	// APITokenRef authenticates with a Cloudflare API Token.
+	// +optional
+	APITokenRef *SecretKeySelector `json:"apiTokenRef,omitempty"`
+
+	// ZoneID is the ID of the credential's zone, used rather than the
+	// issuer's ZoneID by RevokeSuperseded and DuplicatePolicy for requests
+	// signed with the credential. It is required when the issuer sets
+	// either, in which case the credential may only list a single zone.
+	// +optional
+	ZoneID string `json:"zoneID,omitempty"`
+}
+
+// TokenExchange configures the exchange of a ServiceAccount token for
+// Cloudflare credentials with a secret broker. The controller requests a
+// token of the ServiceAccount, and POSTs it as a bearer token to the broker,
+// which responds with an API Token or Service Key, and when it expires.
+//
+// The token's audience is cert-manager.k8s.cloudflare.com/token-exchange. The
+// URL must be an https URL allowed with the controller's
+// --token-exchange-url flag, and the ServiceAccount must opt in with the
+// AllowTokenRequestsAnnotation.
+type TokenExchange struct {
+	// URL of the secret broker's token exchange endpoint.
+	URL string `json:"url"`
+
+	// ServiceAccountRef selects the ServiceAccount whose token is exchanged.
+	ServiceAccountRef ServiceAccountRef `json:"serviceAccountRef"`
+}
+
+// VaultAuth selects a Cloudflare credential stored in HashiCorp Vault. The
+// controller logs in to Vault with a token of a ServiceAccount, through the
+// Kubernetes or JWT auth method, and reads the credential from a KV secret.
+//
+// The token's audience is cert-manager.k8s.cloudflare.com/vault. The address
+// must be an https URL allowed with the controller's --vault-address flag,
+// and the ServiceAccount must opt in with the AllowTokenRequestsAnnotation.
+type VaultAuth struct {
+	// Address of the Vault server, such as https://vault.example.com:8200.
+	Address string `json:"address"`
+
+	// AuthPath is the mount path of the Kubernetes or JWT auth method the
+	// controller logs in with. Defaults to kubernetes.
+	// +optional
+	AuthPath string `json:"authPath,omitempty"`
+
+	// Role of the auth method to log in as.
+	Role string `json:"role"`
+
+	// ServiceAccountRef selects the ServiceAccount whose token the
+	// controller logs in with.
+	ServiceAccountRef ServiceAccountRef `json:"serviceAccountRef"`
+
+	// Path of the secret, such as secret/data/cloudflare for a KV version
+	// 2 engine mounted at secret.
+	Path string `json:"path"`
+
+	// Key of the secret's data holding the credential.
+	Key string `json:"key"`
+
+	// CredentialType is the type of the credential. Defaults to APIToken.
+	// +optional
+	CredentialType CredentialType `json:"credentialType,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=APIToken;ServiceKey
+
+// CredentialType represents the type of a Cloudflare credential.
+type CredentialType string
+
+const (
+	// CredentialTypeAPIToken represents a Cloudflare API Token.
+	CredentialTypeAPIToken CredentialType = "APIToken"
+
+	// CredentialTypeServiceKey represents an Origin CA Service Key.
+	CredentialTypeServiceKey CredentialType = "ServiceKey"
+)
+
+// ServiceAccountRef contains a reference to a ServiceAccount.
+type ServiceAccountRef struct {
+	// Name of the ServiceAccount in the issuer's namespace. If a
+	// cluster-scoped issuer, the ServiceAccount is selected from the
+	// "cluster resource namespace" configured on the controller.
+	Name string `json:"name"`
 }
 
 // SecretKeySelector contains a reference to a secret.
@@ -97,68 +510,191 @@ type SecretKeySelector struct {
 	Key string `json:"key"`
 }
 
-// OriginIssuerCondition contains condition information for the OriginIssuer.
-type OriginIssuerCondition struct {
-	// Type of the condition, known values are ('Ready')
-	Type ConditionType `json:"type"`
+const (
+	// CertificateIDAnnotation is set on CertificateRequests signed by an
+	// OriginIssuer or ClusterOriginIssuer to the ID of the Origin CA
+	// certificate. Dual-stack issuers record a comma-separated list of IDs.
+	CertificateIDAnnotation = "cert-manager.k8s.cloudflare.com/certificate-id"
+
+	// CertificateExpirationAnnotation is set alongside the
+	// CertificateIDAnnotation to the expiration of the Origin CA
+	// certificate, in RFC 3339 format, as returned by Cloudflare.
+	CertificateExpirationAnnotation = "cert-manager.k8s.cloudflare.com/certificate-expiration"
+
+	// RayIDAnnotation is set alongside the CertificateIDAnnotation to the
+	// Cloudflare Ray ID of the response signing the Origin CA certificate,
+	// identifying the request to Cloudflare support. It is omitted when the
+	// Cloudflare API client doesn't report one.
+	RayIDAnnotation = "cert-manager.k8s.cloudflare.com/ray-id"
+
+	// OriginCARootAnnotation is set on Certificates issued by an
+	// OriginIssuer or ClusterOriginIssuer, when watching for Origin CA root
+	// rotation, to the comma-separated SHA-256 fingerprints of the roots of
+	// the issuer's request types. Certificates are renewed when a root no
+	// longer matches.
+	OriginCARootAnnotation = "cert-manager.k8s.cloudflare.com/origin-ca-root"
+
+	// ReissueAnnotation is set by originca reissue on the Certificates it
+	// renewed to the reason given, such as the name of a migration, so that
+	// running it again skips them.
+	ReissueAnnotation = "cert-manager.k8s.cloudflare.com/reissue"
+
+	// DualStackCertificateAnnotation is set on the CertificateRequests and
+	// CertificateSigningRequests of dual-stack issuers to the certificate
+	// signed with the other signature algorithm than the request type, in
+	// PEM format, which is not published with the certificate.
+	DualStackCertificateAnnotation = "cert-manager.k8s.cloudflare.com/dual-stack-certificate"
+
+	// RetryCountAnnotation is set on CertificateRequests whose signing failed
+	// with a rate limit or a transient error of the Cloudflare API to the
+	// number of attempts failed so far, from which their backoff grows. It is
+	// removed once the certificate is issued.
+	RetryCountAnnotation = "cert-manager.k8s.cloudflare.com/retry-count"
+
+	// NextAttemptAnnotation is set alongside the RetryCountAnnotation to
+	// when the CertificateRequest is next signed, in RFC 3339 format, which
+	// holds across restarts of the controller.
+	NextAttemptAnnotation = "cert-manager.k8s.cloudflare.com/next-attempt"
+
+	// ResolvedIssuerAnnotation is set by the controller on CertificateRequests
+	// it signs with the default ClusterOriginIssuer in place of an issuer
+	// that doesn't exist, to the kind and name of the default issuer, such
+	// as "ClusterOriginIssuer/production". The request is then signed and
+	// revoked with that issuer even once the issuer it references is
+	// created.
+	ResolvedIssuerAnnotation = "cert-manager.k8s.cloudflare.com/resolved-issuer"
+
+	// AllowTokenRequestsAnnotation, set to "true" on a ServiceAccount, allows
+	// the controller to request its tokens for issuers authenticating with a
+	// token exchange or Vault. Tokens of other ServiceAccounts are never
+	// requested.
+	AllowTokenRequestsAnnotation = "cert-manager.k8s.cloudflare.com/allow-token-requests"
+
+	// CorrelationIDAnnotation is set on the events recorded by the
+	// controller to the correlation ID of the reconcile recording them, which
+	// is also logged and appended to condition messages. It is kept out of
+	// event messages so that the events repeated by retries are aggregated.
+	CorrelationIDAnnotation = "cert-manager.k8s.cloudflare.com/correlation-id"
+
+	// RevokeFinalizer is set on CertificateRequests whose Origin CA
+	// certificate must be revoked when the CertificateRequest is deleted.
+	RevokeFinalizer = "cert-manager.k8s.cloudflare.com/revoke"
+)
+
+// +kubebuilder:validation:Enum=OriginRSA;OriginECC
+
+// RequestType represents the signature algorithm used to sign certificates.
+type RequestType string
+
+const (
+	// RequestTypeOriginRSA represents an RSA256 signature.
+	RequestTypeOriginRSA RequestType = "OriginRSA"
 
-	// Status of the condition, one of ('True', 'False', 'Unknown')
-	Status ConditionStatus `json:"status"`
+	// RequestTypeOriginECC represents an ECDSA signature.
+	RequestTypeOriginECC RequestType = "OriginECC"
+)
 
-	// LastTransitionTime is the timestamp corresponding to the last status
-	// change of this condition.
+// PEMFormat configures how signed certificates are PEM encoded. Each
+// certificate is re-encoded with lines of 64 characters.
+type PEMFormat struct {
+	// LineEnding ends the lines of the certificates with LF or CRLF.
+	// Defaults to LF.
 	// +optional
-	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+	LineEnding LineEnding `json:"lineEnding,omitempty"`
 
-	// Reason is a brief machine readable explanation for the condition's last
-	// transition.
+	// OmitTrailingNewline removes the line ending after the last
+	// certificate.
 	// +optional
-	Reason string `json:"reason,omitempty"`
+	OmitTrailingNewline bool `json:"omitTrailingNewline,omitempty"`
 
-	// Message is a human readable description of the details of the last
-	// transition1, complementing reason.
+	// Comments precedes each signed certificate with lines starting with
+	// "#", recording its Cloudflare certificate ID, request type, hostnames
+	// and expiration. PEM decoders ignore text outside of PEM blocks.
 	// +optional
-	Message string `json:"message,omitempty"`
+	Comments bool `json:"comments,omitempty"`
 }
 
-// +kubebuilder:validation:Enum=OriginRSA;OriginECC
+// +kubebuilder:validation:Enum=LF;CRLF
 
-// RequestType represents the signature algorithm used to sign certificates.
-type RequestType string
+// LineEnding represents the line ending of PEM encoded certificates.
+type LineEnding string
 
 const (
-	// RequestTypeOriginRSA represents an RSA256 signature.
-	RequestTypeOriginRSA RequestType = "OriginRSA"
+	// LineEndingLF ends lines with a line feed.
+	LineEndingLF LineEnding = "LF"
 
-	// RequestTypeOriginECC represents an ECDSA signature.
-	RequestTypeOriginECC RequestType = "OriginECC"
+	// LineEndingCRLF ends lines with a carriage return and a line feed.
+	LineEndingCRLF LineEnding = "CRLF"
 )
 
-// +kubebuilder:validation:Enum=Ready
+// +kubebuilder:validation:Enum=Closest;RoundUp;RoundDown;Strict
 
-// ConditionType represents an OriginIssuer condition value.
-type ConditionType string
+// DurationPolicy represents how requested durations are rounded to a validity
+// supported by Cloudflare.
+type DurationPolicy string
+
+const (
+	// DurationPolicyClosest rounds to the closest supported validity, which
+	// may be shorter than requested.
+	DurationPolicyClosest DurationPolicy = "Closest"
+
+	// DurationPolicyRoundUp rounds to the shortest supported validity at
+	// least as long as requested.
+	DurationPolicyRoundUp DurationPolicy = "RoundUp"
+
+	// DurationPolicyRoundDown rounds to the longest supported validity at
+	// most as long as requested.
+	DurationPolicyRoundDown DurationPolicy = "RoundDown"
+
+	// DurationPolicyStrict fails CertificateRequests whose duration is not
+	// exactly a supported validity.
+	DurationPolicyStrict DurationPolicy = "Strict"
+)
+
+// +kubebuilder:validation:Enum=AlwaysNew;Reuse;Fail
+
+// DuplicatePolicy represents how CertificateRequests for the hostnames of an
+// existing Origin CA certificate are handled.
+type DuplicatePolicy string
+
+const (
+	// DuplicatePolicyAlwaysNew signs a new certificate regardless of
+	// existing ones.
+	DuplicatePolicyAlwaysNew DuplicatePolicy = "AlwaysNew"
+
+	// DuplicatePolicyReuse publishes an existing certificate issued for the
+	// same key and hostnames, rather than signing a new one.
+	DuplicatePolicyReuse DuplicatePolicy = "Reuse"
+
+	// DuplicatePolicyFail fails CertificateRequests for the hostnames of an
+	// existing certificate.
+	DuplicatePolicyFail DuplicatePolicy = "Fail"
+)
 
 const (
 	// ConditionReady represents that an OriginIssuer condition is in
 	// a ready state and able to issue certificates.
 	// If the `status` of this condition is `False`, CertificateRequest
 	// controllers should prevent attempts to sign certificates.
-	ConditionReady ConditionType = "Ready"
-)
+	ConditionReady = "Ready"
 
-// +kubebuilder:validation:Enum=True;False;Unknown
+	// ConditionDryRun reports the outcome of reconciling an OriginIssuer,
+	// or a CertificateRequest, with the controller in dry run mode, which
+	// leaves their Ready condition untouched.
+	ConditionDryRun = "DryRun"
 
-// ConditionStatus represents a condition's status.
-type ConditionStatus string
+	// ConditionQuotaExhausted reports whether the zone of an OriginIssuer
+	// with a CertificateQuota is near its Origin CA certificate limit.
+	ConditionQuotaExhausted = "QuotaExhausted"
+)
 
 const (
 	// ConditionTrue represents the fact that a given condition is true.
-	ConditionTrue ConditionStatus = "True"
+	ConditionTrue = metav1.ConditionTrue
 
 	// ConditionFalse represents the fact that a given condition is false.
-	ConditionFalse ConditionStatus = "False"
+	ConditionFalse = metav1.ConditionFalse
 
 	// ConditionUnknown represents the fact that a given condition is unknown.
-	ConditionUnknown ConditionStatus = "Unknown"
+	ConditionUnknown = metav1.ConditionUnknown
 )
@@ -5,15 +5,91 @@
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AllowedNamespaces) DeepCopyInto(out *AllowedNamespaces) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AllowedNamespaces.
+func (in *AllowedNamespaces) DeepCopy() *AllowedNamespaces {
+	if in == nil {
+		return nil
+	}
+	out := new(AllowedNamespaces)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Canary) DeepCopyInto(out *Canary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Canary.
+func (in *Canary) DeepCopy() *Canary {
+	if in == nil {
+		return nil
+	}
+	out := new(Canary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStatus) DeepCopyInto(out *CanaryStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStatus.
+func (in *CanaryStatus) DeepCopy() *CanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateQuota) DeepCopyInto(out *CertificateQuota) {
+	*out = *in
+	if in.Reserve != nil {
+		in, out := &in.Reserve, &out.Reserve
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateQuota.
+func (in *CertificateQuota) DeepCopy() *CertificateQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterOriginIssuer) DeepCopyInto(out *ClusterOriginIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -67,12 +143,28 @@ func (in *ClusterOriginIssuerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerConfiguration) DeepCopyInto(out *IssuerConfiguration) {
+	*out = *in
+	in.Auth.DeepCopyInto(&out.Auth)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerConfiguration.
+func (in *IssuerConfiguration) DeepCopy() *IssuerConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OriginIssuer) DeepCopyInto(out *OriginIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -98,6 +190,33 @@ func (in *OriginIssuer) DeepCopyObject() runtime.Object {
 func (in *OriginIssuerAuthentication) DeepCopyInto(out *OriginIssuerAuthentication) {
 	*out = *in
 	out.ServiceKeyRef = in.ServiceKeyRef
+	if in.APITokenRef != nil {
+		in, out := &in.APITokenRef, &out.APITokenRef
+		*out = new(SecretKeySelector)
+		**out = **in
+	}
+	if in.TokenExchange != nil {
+		in, out := &in.TokenExchange, &out.TokenExchange
+		*out = new(TokenExchange)
+		**out = **in
+	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultAuth)
+		**out = **in
+	}
+	if in.VerifyTokenRef != nil {
+		in, out := &in.VerifyTokenRef, &out.VerifyTokenRef
+		*out = new(SecretKeySelector)
+		**out = **in
+	}
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]ZoneCredential, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OriginIssuerAuthentication.
@@ -110,25 +229,6 @@ func (in *OriginIssuerAuthentication) DeepCopy() *OriginIssuerAuthentication {
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *OriginIssuerCondition) DeepCopyInto(out *OriginIssuerCondition) {
-	*out = *in
-	if in.LastTransitionTime != nil {
-		in, out := &in.LastTransitionTime, &out.LastTransitionTime
-		*out = (*in).DeepCopy()
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OriginIssuerCondition.
-func (in *OriginIssuerCondition) DeepCopy() *OriginIssuerCondition {
-	if in == nil {
-		return nil
-	}
-	out := new(OriginIssuerCondition)
-	in.DeepCopyInto(out)
-	return out
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OriginIssuerList) DeepCopyInto(out *OriginIssuerList) {
 	*out = *in
@@ -164,7 +264,52 @@ func (in *OriginIssuerList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OriginIssuerSpec) DeepCopyInto(out *OriginIssuerSpec) {
 	*out = *in
-	out.Auth = in.Auth
+	if in.PEMFormat != nil {
+		in, out := &in.PEMFormat, &out.PEMFormat
+		*out = new(PEMFormat)
+		**out = **in
+	}
+	if in.MinDuration != nil {
+		in, out := &in.MinDuration, &out.MinDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxDuration != nil {
+		in, out := &in.MaxDuration, &out.MaxDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.DefaultDuration != nil {
+		in, out := &in.DefaultDuration, &out.DefaultDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CertificateQuota != nil {
+		in, out := &in.CertificateQuota, &out.CertificateQuota
+		*out = new(CertificateQuota)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedDNSNames != nil {
+		in, out := &in.AllowedDNSNames, &out.AllowedDNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedDNSZones != nil {
+		in, out := &in.AllowedDNSZones, &out.AllowedDNSZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(AllowedNamespaces)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(Canary)
+		**out = **in
+	}
+	in.Auth.DeepCopyInto(&out.Auth)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OriginIssuerSpec.
@@ -182,11 +327,39 @@ func (in *OriginIssuerStatus) DeepCopyInto(out *OriginIssuerStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]OriginIssuerCondition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.LastVerifiedTime != nil {
+		in, out := &in.LastVerifiedTime, &out.LastVerifiedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CertificateCount != nil {
+		in, out := &in.CertificateCount, &out.CertificateCount
+		*out = new(int)
+		**out = **in
+	}
+	if in.QuotaRemaining != nil {
+		in, out := &in.QuotaRemaining, &out.QuotaRemaining
+		*out = new(int)
+		**out = **in
+	}
+	if in.CertificateCountTime != nil {
+		in, out := &in.CertificateCountTime, &out.CertificateCountTime
+		*out = (*in).DeepCopy()
+	}
+	if in.StableConfiguration != nil {
+		in, out := &in.StableConfiguration, &out.StableConfiguration
+		*out = new(IssuerConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanaryStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OriginIssuerStatus.
@@ -199,6 +372,21 @@ func (in *OriginIssuerStatus) DeepCopy() *OriginIssuerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PEMFormat) DeepCopyInto(out *PEMFormat) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PEMFormat.
+func (in *PEMFormat) DeepCopy() *PEMFormat {
+	if in == nil {
+		return nil
+	}
+	out := new(PEMFormat)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretKeySelector) DeepCopyInto(out *SecretKeySelector) {
 	*out = *in
@@ -213,3 +401,80 @@ func (in *SecretKeySelector) DeepCopy() *SecretKeySelector {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountRef) DeepCopyInto(out *ServiceAccountRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountRef.
+func (in *ServiceAccountRef) DeepCopy() *ServiceAccountRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenExchange) DeepCopyInto(out *TokenExchange) {
+	*out = *in
+	out.ServiceAccountRef = in.ServiceAccountRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenExchange.
+func (in *TokenExchange) DeepCopy() *TokenExchange {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenExchange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultAuth) DeepCopyInto(out *VaultAuth) {
+	*out = *in
+	out.ServiceAccountRef = in.ServiceAccountRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAuth.
+func (in *VaultAuth) DeepCopy() *VaultAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneCredential) DeepCopyInto(out *ZoneCredential) {
+	*out = *in
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceKeyRef != nil {
+		in, out := &in.ServiceKeyRef, &out.ServiceKeyRef
+		*out = new(SecretKeySelector)
+		**out = **in
+	}
+	if in.APITokenRef != nil {
+		in, out := &in.APITokenRef, &out.APITokenRef
+		*out = new(SecretKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneCredential.
+func (in *ZoneCredential) DeepCopy() *ZoneCredential {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneCredential)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,90 @@
+// Package audit records the Origin CA certificates issued and revoked by the
+// controller to sinks, such as a log file kept for compliance. Sinks other
+// than the built-in ones are compiled into the controller, and registered by
+// name with RegisterSink.
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Action is what was done to an Origin CA certificate.
+type Action string
+
+const (
+	// ActionIssued records the issuance of a certificate.
+	ActionIssued Action = "Issued"
+
+	// ActionRevoked records the revocation of a certificate.
+	ActionRevoked Action = "Revoked"
+)
+
+// Record describes an Origin CA certificate issued or revoked on behalf of a
+// CertificateRequest.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+
+	// Reason is why a certificate was revoked, such as its
+	// CertificateRequest being deleted, or it being superseded.
+	Reason string `json:"reason,omitempty"`
+
+	// DryRun is set on revocations only reported in dry run mode.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	Namespace          string    `json:"namespace"`
+	CertificateRequest string    `json:"certificateRequest"`
+	UID                types.UID `json:"uid,omitempty"`
+	CorrelationID      string    `json:"correlationID,omitempty"`
+
+	// Tenant owns the namespace of the CertificateRequest, such as a team,
+	// when the controller is configured to read it from namespaces.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Attribution are the labels or annotations of the CertificateRequest,
+	// or of its Certificate, the controller is configured to attribute
+	// certificates with, such as a team or an app.
+	Attribution map[string]string `json:"attribution,omitempty"`
+
+	IssuerKind string `json:"issuerKind"`
+	IssuerName string `json:"issuerName"`
+
+	CertificateID string     `json:"certificateID"`
+	RequestType   string     `json:"requestType,omitempty"`
+	Hostnames     []string   `json:"hostnames,omitempty"`
+	Expiration    *time.Time `json:"expiration,omitempty"`
+	RayID         string     `json:"rayID,omitempty"`
+}
+
+// Sink stores audit records. Sinks are called concurrently by the
+// controller's workers, and should return promptly: failures are logged,
+// and don't fail the CertificateRequest the record is about.
+type Sink interface {
+	Record(ctx context.Context, r Record) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, r Record) error
+
+func (f SinkFunc) Record(ctx context.Context, r Record) error {
+	return f(ctx, r)
+}
+
+// Multi returns a Sink recording to every sink, in order. Records are sent
+// to every sink even if some fail, and the failures are joined.
+func Multi(sinks ...Sink) Sink {
+	return SinkFunc(func(ctx context.Context, r Record) error {
+		var errs []error
+		for _, s := range sinks {
+			if err := s.Record(ctx, r); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
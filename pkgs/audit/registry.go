@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/record"
+)
+
+// SinkConstructor returns a Sink configured by an opaque config, such as the
+// path of a file or the address of a message broker, whose format is up to
+// the sink. The recorder records events on behalf of the controller.
+type SinkConstructor func(config string, recorder record.EventRecorder) (Sink, error)
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]SinkConstructor{
+		"stdout": func(_ string, _ record.EventRecorder) (Sink, error) {
+			return NewJSONSink(os.Stdout), nil
+		},
+		"file": func(path string, _ record.EventRecorder) (Sink, error) {
+			if path == "" {
+				return nil, fmt.Errorf("the file audit sink requires a path")
+			}
+
+			return NewFileSink(path, DefaultFileMaxSize, DefaultFileMaxBackups)
+		},
+		"events": func(_ string, recorder record.EventRecorder) (Sink, error) {
+			return NewEventSink(recorder), nil
+		},
+	}
+)
+
+// RegisterSink makes a Sink available by name, so that compliance teams can
+// record to their own storage, such as an object store or message broker.
+// Sinks are compiled in by importing a package calling RegisterSink from its
+// init function. It panics if the name is already registered.
+func RegisterSink(name string, constructor SinkConstructor) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	if constructor == nil {
+		panic("audit: RegisterSink constructor is nil")
+	}
+
+	if _, dup := sinks[name]; dup {
+		panic("audit: RegisterSink called twice for sink " + name)
+	}
+
+	sinks[name] = constructor
+}
+
+// Sinks returns the sorted names of the registered sinks.
+func Sinks() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseSink splits a sink specification, the name of a registered sink
+// optionally followed by a colon and its config, such as
+// file:/var/log/audit.log.
+func ParseSink(spec string) (name, config string, err error) {
+	name, config, _ = strings.Cut(spec, ":")
+
+	sinksMu.RLock()
+	_, ok := sinks[name]
+	sinksMu.RUnlock()
+
+	if !ok {
+		return "", "", fmt.Errorf("unknown audit sink %q, registered sinks are: %s", name, strings.Join(Sinks(), ", "))
+	}
+
+	return name, config, nil
+}
+
+// NewSink returns the registered Sink of the specification, see ParseSink.
+func NewSink(spec string, recorder record.EventRecorder) (Sink, error) {
+	name, config, err := ParseSink(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	sinksMu.RLock()
+	constructor := sinks[name]
+	sinksMu.RUnlock()
+
+	return constructor(config, recorder)
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRegisterSink(t *testing.T) {
+	var got []Record
+	RegisterSink("test-bucket", func(config string, _ record.EventRecorder) (Sink, error) {
+		return SinkFunc(func(ctx context.Context, r Record) error {
+			r.CertificateRequest = config
+			got = append(got, r)
+
+			return nil
+		}), nil
+	})
+	defer func() {
+		sinksMu.Lock()
+		delete(sinks, "test-bucket")
+		sinksMu.Unlock()
+	}()
+
+	assert.DeepEqual(t, Sinks(), []string{"events", "file", "stdout", "test-bucket"})
+
+	s, err := NewSink("test-bucket:s3://audit/origin-ca", nil)
+	assert.NilError(t, err)
+	assert.NilError(t, s.Record(context.Background(), Record{Action: ActionIssued, CertificateID: "1"}))
+	assert.DeepEqual(t, got, []Record{{Action: ActionIssued, CertificateID: "1", CertificateRequest: "s3://audit/origin-ca"}})
+
+	_, err = NewSink("file", nil)
+	assert.Error(t, err, "the file audit sink requires a path")
+
+	_, err = NewSink("missing:config", nil)
+	assert.Error(t, err, `unknown audit sink "missing", registered sinks are: events, file, stdout, test-bucket`)
+
+	assert.Assert(t, panics(func() {
+		RegisterSink("stdout", func(string, record.EventRecorder) (Sink, error) { return nil, nil })
+	}), "expected registering a sink twice to panic")
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+
+	f()
+
+	return false
+}
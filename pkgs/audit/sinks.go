@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// NewJSONSink returns a Sink writing records to w as JSON lines, such as to
+// stdout for a log collector to pick up.
+func NewJSONSink(w io.Writer) Sink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return SinkFunc(func(ctx context.Context, r Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return enc.Encode(r)
+	})
+}
+
+// Defaults of the rotation of a FileSink.
+const (
+	DefaultFileMaxSize    int64 = 100 << 20
+	DefaultFileMaxBackups       = 5
+)
+
+// FileSink appends records as JSON lines to a file, rotating it before it
+// grows beyond its maximum size: the file is renamed with a .1 suffix, older
+// files shifted up to the maximum number of backups, the oldest removed.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileSink returns a FileSink appending to the file at path, created if
+// missing, rotated once it reaches maxSize bytes, keeping maxBackups rotated
+// files.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f, s.size = f, info.Size()
+
+	return nil
+}
+
+func (s *FileSink) Record(ctx context.Context, r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotating audit file %s: %w", s.path, err)
+		}
+	}
+
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+
+	return err
+}
+
+// rotate renames the file and its backups, and opens a new file.
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	if s.maxBackups > 0 {
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
+
+// NewEventSink returns a Sink recording each record as a Normal event on its
+// CertificateRequest, with the record's action as reason.
+func NewEventSink(recorder record.EventRecorder) Sink {
+	return SinkFunc(func(ctx context.Context, r Record) error {
+		ref := &core.ObjectReference{
+			APIVersion: certmanager.SchemeGroupVersion.String(),
+			Kind:       certmanager.CertificateRequestKind,
+			Namespace:  r.Namespace,
+			Name:       r.CertificateRequest,
+			UID:        r.UID,
+		}
+
+		recorder.Event(ref, core.EventTypeNormal, "Audit"+string(r.Action), eventMessage(r))
+
+		return nil
+	})
+}
+
+// eventMessage describes a record in an event message.
+func eventMessage(r Record) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Certificate %s %s", r.CertificateID, strings.ToLower(string(r.Action)))
+	if len(r.Hostnames) > 0 {
+		fmt.Fprintf(&b, " for %s", strings.Join(r.Hostnames, ","))
+	}
+	if r.Expiration != nil {
+		fmt.Fprintf(&b, ", expiring %s", r.Expiration.UTC().Format(time.RFC3339))
+	}
+	if r.Reason != "" {
+		fmt.Fprintf(&b, ", reason %s", r.Reason)
+	}
+	if r.DryRun {
+		b.WriteString(" (dry run)")
+	}
+
+	return b.String()
+}
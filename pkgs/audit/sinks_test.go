@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/client-go/tools/record"
+)
+
+var testRecord = Record{
+	Time:               time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	Action:             ActionIssued,
+	Namespace:          "default",
+	CertificateRequest: "foobar",
+	UID:                "0bd9e9e9-0b4e-4cbb-8c4e-0f7b4d7f7d3a",
+	IssuerKind:         "OriginIssuer",
+	IssuerName:         "foobar",
+	CertificateID:      "9001",
+	RequestType:        "origin-rsa",
+	Hostnames:          []string{"example.com"},
+	RayID:              "8a1b2c3d4e5f6a7b-SJC",
+}
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewJSONSink(&buf)
+
+	assert.NilError(t, s.Record(context.Background(), testRecord))
+	assert.NilError(t, s.Record(context.Background(), Record{Action: ActionRevoked, Reason: "deleted", DryRun: true, CertificateID: "9001"}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, len(lines), 2, buf.String())
+
+	var got Record
+	assert.NilError(t, json.Unmarshal([]byte(lines[0]), &got))
+	assert.DeepEqual(t, got, testRecord)
+
+	assert.Equal(t, lines[1], `{"time":"0001-01-01T00:00:00Z","action":"Revoked","reason":"deleted","dryRun":true,"namespace":"","certificateRequest":"","issuerKind":"","issuerName":"","certificateID":"9001"}`)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	line, err := json.Marshal(testRecord)
+	assert.NilError(t, err)
+
+	// Two records fit in a file, the third rotates it.
+	s, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	assert.NilError(t, err)
+
+	for i := 0; i < 7; i++ {
+		assert.NilError(t, s.Record(context.Background(), testRecord))
+	}
+	assert.NilError(t, s.Close())
+
+	lines := func(name string) int {
+		data, err := os.ReadFile(name)
+		assert.NilError(t, err)
+
+		return strings.Count(string(data), "\n")
+	}
+
+	assert.Equal(t, lines(path), 1)
+	assert.Equal(t, lines(path+".1"), 2)
+	assert.Equal(t, lines(path+".2"), 2)
+	_, err = os.Stat(path + ".3")
+	assert.Assert(t, errors.Is(err, os.ErrNotExist), "expected only 2 backups, got %v", err)
+
+	// Reopening appends to the existing file.
+	s, err = NewFileSink(path, int64(2*(len(line)+1)), 2)
+	assert.NilError(t, err)
+	assert.NilError(t, s.Record(context.Background(), testRecord))
+	assert.NilError(t, s.Close())
+
+	assert.Equal(t, lines(path), 2)
+}
+
+func TestEventSink(t *testing.T) {
+	recorder := record.NewFakeRecorder(2)
+	s := NewEventSink(recorder)
+
+	expiration := time.Date(2024, 1, 9, 3, 4, 5, 0, time.UTC)
+	issued := testRecord
+	issued.Expiration = &expiration
+
+	assert.NilError(t, s.Record(context.Background(), issued))
+	assert.NilError(t, s.Record(context.Background(), Record{Action: ActionRevoked, Reason: "superseded", DryRun: true, CertificateID: "9000"}))
+
+	assert.Equal(t, <-recorder.Events, "Normal AuditIssued Certificate 9001 issued for example.com, expiring 2024-01-09T03:04:05Z")
+	assert.Equal(t, <-recorder.Events, "Normal AuditRevoked Certificate 9000 revoked, reason superseded (dry run)")
+}
+
+func TestMulti(t *testing.T) {
+	var got []string
+	s := Multi(
+		SinkFunc(func(ctx context.Context, r Record) error {
+			return errors.New("unavailable")
+		}),
+		SinkFunc(func(ctx context.Context, r Record) error {
+			got = append(got, r.CertificateID)
+
+			return nil
+		}),
+	)
+
+	err := s.Record(context.Background(), testRecord)
+	assert.Error(t, err, "unavailable")
+	assert.DeepEqual(t, got, []string{"9001"})
+}
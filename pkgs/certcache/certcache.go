@@ -0,0 +1,209 @@
+// Package certcache implements a cache of the Origin CA certificates issued
+// for CertificateRequests until they are recorded on them, persisted to a
+// local file, such as one on a persistent volume, so that it survives restarts
+// of the controller.
+package certcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// ErrFull is returned by Put when the cache holds MaxEntries entries.
+var ErrFull = errors.New("certificate cache is full")
+
+// Certificate is an Origin CA certificate issued for a request.
+type Certificate struct {
+	ID          string    `json:"id"`
+	Certificate string    `json:"certificate"`
+	Type        string    `json:"type,omitempty"`
+	Hostnames   []string  `json:"hostnames,omitempty"`
+	Expiration  time.Time `json:"expiration"`
+	Validity    int       `json:"validity,omitempty"`
+}
+
+// Entry records the Origin CA certificates issued for a request. Dual-stack
+// issuers issue several certificates for the same request.
+type Entry struct {
+	Certificates []Certificate `json:"certificates"`
+}
+
+// IDs returns the IDs of the entry's certificates.
+func (e Entry) IDs() []string {
+	ids := make([]string, 0, len(e.Certificates))
+	for _, cert := range e.Certificates {
+		ids = append(ids, cert.ID)
+	}
+
+	return ids
+}
+
+// expired returns whether all of the entry's certificates expired.
+func (e Entry) expired(now time.Time) bool {
+	for _, cert := range e.Certificates {
+		if now.Before(cert.Expiration) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Cache maps the UIDs of requests to the certificates issued for them. Entries
+// are meant to be deleted once the certificates are recorded on their request,
+// and are otherwise dropped once their certificates expire. Every change is
+// written to the cache's file before returning.
+type Cache struct {
+	// MaxEntries, when positive, caps the number of entries kept. Entries
+	// are never evicted, as their certificates could no longer be revoked,
+	// so Full reports the cache full until some are deleted or expire. Set
+	// it before the cache is used.
+	MaxEntries int
+
+	path  string
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Open returns a Cache persisted to path, loading its entries if the file
+// exists.
+func Open(path string, clock clock.Clock) (*Cache, error) {
+	c := &Cache{
+		path:    path,
+		clock:   clock,
+		entries: make(map[string]Entry),
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("decoding certificate cache %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Get returns the certificates issued for the request of the UID, unless they
+// expired.
+func (c *Cache) Get(uid string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[uid]
+	if !ok || e.expired(c.clock.Now()) {
+		return Entry{}, false
+	}
+
+	return e, true
+}
+
+// Full returns whether the cache holds MaxEntries unexpired entries, so that
+// no more certificates should be issued until some are deleted.
+func (c *Cache) Full() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.full()
+}
+
+func (c *Cache) full() bool {
+	if c.MaxEntries <= 0 || len(c.entries) < c.MaxEntries {
+		return false
+	}
+
+	now := c.clock.Now()
+	n := 0
+	for _, e := range c.entries {
+		if !e.expired(now) {
+			n++
+		}
+	}
+
+	return n >= c.MaxEntries
+}
+
+// Put records the certificates issued for the request of the UID, dropping
+// expired entries. It returns ErrFull, recording nothing, if the cache is
+// full and has no entry for the UID.
+func (c *Cache) Put(uid string, e Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[uid]; !ok && c.full() {
+		return ErrFull
+	}
+
+	c.entries[uid] = e
+
+	return c.save()
+}
+
+// Delete forgets the certificates issued for the request of the UID, such as
+// once they were recorded on it or revoked, dropping expired entries.
+func (c *Cache) Delete(uid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[uid]; !ok {
+		return nil
+	}
+
+	delete(c.entries, uid)
+
+	return c.save()
+}
+
+// save drops expired entries, and writes the rest to a temporary file
+// renamed over the cache's file, so that a crash never leaves a partially
+// written cache behind.
+func (c *Cache) save() error {
+	now := c.clock.Now()
+	for k, e := range c.entries {
+		if e.expired(now) {
+			delete(c.entries, k)
+		}
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path)
+}
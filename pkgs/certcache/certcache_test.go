@@ -0,0 +1,102 @@
+package certcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+// entry returns an entry of certificates of the IDs expiring at expiration.
+func entry(expiration time.Time, ids ...string) Entry {
+	var e Entry
+	for _, id := range ids {
+		e.Certificates = append(e.Certificates, Certificate{ID: id, Certificate: "cert-" + id, Expiration: expiration})
+	}
+
+	return e
+}
+
+func TestCache(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	path := filepath.Join(t.TempDir(), "certificates.json")
+
+	c, err := Open(path, clock)
+	assert.NilError(t, err)
+
+	_, ok := c.Get("uid")
+	assert.Assert(t, !ok, "expected empty cache")
+
+	assert.NilError(t, c.Put("uid", entry(clock.Now().Add(time.Hour), "9001", "9002")))
+	assert.NilError(t, c.Put("short-lived", entry(clock.Now().Add(time.Minute), "9003")))
+
+	// Entries survive reopening the cache, such as after a restart.
+	c, err = Open(path, clock)
+	assert.NilError(t, err)
+
+	e, ok := c.Get("uid")
+	assert.Assert(t, ok, "expected cached entry")
+	assert.DeepEqual(t, e.IDs(), []string{"9001", "9002"})
+	assert.Equal(t, e.Certificates[1].Certificate, "cert-9002")
+	assert.Assert(t, e.Certificates[0].Expiration.Equal(clock.Now().Add(time.Hour)))
+
+	// Expired entries are ignored, and dropped by the next change.
+	clock.Step(time.Minute)
+	_, ok = c.Get("short-lived")
+	assert.Assert(t, !ok, "expected expired entry to be ignored")
+
+	assert.NilError(t, c.Delete("uid"))
+	_, ok = c.Get("uid")
+	assert.Assert(t, !ok, "expected deleted entry to be forgotten")
+
+	data, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "{}")
+
+	// Nothing but the cache is left behind in its directory.
+	files, err := os.ReadDir(filepath.Dir(path))
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	c, err := Open(filepath.Join(t.TempDir(), "certificates.json"), clock)
+	assert.NilError(t, err)
+	c.MaxEntries = 2
+
+	assert.NilError(t, c.Put("day", entry(clock.Now().Add(24*time.Hour), "9001")))
+	assert.Assert(t, !c.Full(), "expected cache with room left not to be full")
+	assert.NilError(t, c.Put("hour", entry(clock.Now().Add(time.Hour), "9002")))
+	assert.Assert(t, c.Full(), "expected cache to be full")
+
+	// No entry is evicted to make room, as its certificates could no longer
+	// be revoked, but existing entries may still be updated.
+	assert.Equal(t, c.Put("week", entry(clock.Now().Add(7*24*time.Hour), "9003")), ErrFull)
+	assert.NilError(t, c.Put("hour", entry(clock.Now().Add(time.Hour), "9002", "9004")))
+	for _, uid := range []string{"day", "hour"} {
+		_, ok := c.Get(uid)
+		assert.Assert(t, ok, "expected %s entry to be kept", uid)
+	}
+
+	// Room is made by deleting entries, or by their certificates expiring.
+	assert.NilError(t, c.Delete("day"))
+	assert.NilError(t, c.Put("week", entry(clock.Now().Add(7*24*time.Hour), "9003")))
+	assert.Assert(t, c.Full(), "expected cache to be full")
+
+	clock.Step(time.Hour)
+	assert.Assert(t, !c.Full(), "expected expired entries not to count")
+	assert.NilError(t, c.Put("day", entry(clock.Now().Add(24*time.Hour), "9005")))
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certificates.json")
+	assert.NilError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	_, err := Open(path, fakeClock.NewFakeClock(time.Now()))
+	assert.ErrorContains(t, err, "decoding certificate cache")
+}
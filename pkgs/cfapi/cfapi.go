@@ -0,0 +1,85 @@
+// Package cfapi exposes the interface of the controller's Cloudflare API
+// clients to packages outside of this module, such as factories of clients
+// talking to a certificate broker, and tests using pkgs/testing. The types
+// are aliases of those used by the controller, so that values convert freely
+// between the two.
+package cfapi
+
+import (
+	"context"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+)
+
+type (
+	// Interface is the subset of the Cloudflare API used by the issuers.
+	Interface = cfapi.Interface
+
+	// Factory creates API clients authenticating with Credentials.
+	Factory = cfapi.Factory
+
+	// FactoryFunc is a function implementing Factory.
+	FactoryFunc = cfapi.FactoryFunc
+
+	// FactoryConstructor returns a Factory configured by the controller's
+	// --cf-api-factory-config.
+	FactoryConstructor = cfapi.FactoryConstructor
+
+	// Options configure the Cloudflare API clients the controller would
+	// otherwise create, for factories wrapping or falling back to them.
+	Options = cfapi.Options
+
+	// Credentials authenticate requests to the Cloudflare API.
+	Credentials = cfapi.Credentials
+
+	// SignRequest requests an Origin CA certificate.
+	SignRequest = cfapi.SignRequest
+
+	// SignResponse is a signed Origin CA certificate.
+	SignResponse = cfapi.SignResponse
+
+	// ListRequest selects a page of the Origin CA certificates of a zone.
+	ListRequest = cfapi.ListRequest
+
+	// ListResponse is a page of the Origin CA certificates of a zone.
+	ListResponse = cfapi.ListResponse
+
+	// APIError is an error of the Cloudflare API, which factories return
+	// for the controller to classify failures by their StatusCode.
+	APIError = cfapi.APIError
+
+	// Metadata identifies the Kubernetes objects an API call is made on
+	// behalf of.
+	Metadata = cfapi.Metadata
+
+	// Zone is a Cloudflare zone.
+	Zone = cfapi.Zone
+
+	// ZoneFinder is implemented by API clients able to look up zones by
+	// name.
+	ZoneFinder = cfapi.ZoneFinder
+)
+
+// DefaultFactory is the name of the factory of clients calling the
+// Cloudflare API directly.
+const DefaultFactory = cfapi.DefaultFactory
+
+// RegisterFactory makes a Factory available by name to --cf-api-factory.
+// Factories are compiled into the controller by blank importing a package
+// calling RegisterFactory from its init function. It panics if the name is
+// already registered.
+func RegisterFactory(name string, constructor FactoryConstructor) {
+	cfapi.RegisterFactory(name, constructor)
+}
+
+// NewFactory returns the registered Factory of the name, configured by
+// config, such as to fall back to the default factory.
+func NewFactory(name, config string, opts ...Options) (Factory, error) {
+	return cfapi.NewFactory(name, config, opts...)
+}
+
+// MetadataFromContext returns the metadata of an API call carried by ctx, if
+// any.
+func MetadataFromContext(ctx context.Context) (Metadata, bool) {
+	return cfapi.MetadataFromContext(ctx)
+}
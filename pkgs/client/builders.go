@@ -0,0 +1,236 @@
+package client
+
+import (
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SpecOption configures an OriginIssuerSpec built by NewOriginIssuer or
+// NewClusterOriginIssuer.
+type SpecOption func(*v1.OriginIssuerSpec)
+
+// WithRequestType sets the signature algorithm requested from Cloudflare.
+func WithRequestType(t v1.RequestType) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.RequestType = t
+	}
+}
+
+// WithDualStack signs certificates with both the RSA and ECC Origin CA.
+func WithDualStack() SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.DualStack = true
+	}
+}
+
+// WithIncludeChain appends the Origin CA certificate to signed certificates.
+func WithIncludeChain() SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.IncludeChain = true
+	}
+}
+
+// WithPEMFormat normalizes the PEM encoding of signed certificates.
+func WithPEMFormat(format v1.PEMFormat) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.PEMFormat = &format
+	}
+}
+
+// WithZoneID reports the number of Origin CA certificates of the zone in the
+// issuer's status.
+func WithZoneID(zoneID string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.ZoneID = zoneID
+	}
+}
+
+// WithRevokeSuperseded revokes the certificates of the issuer's zone superseded
+// by signed ones.
+func WithRevokeSuperseded() SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.RevokeSuperseded = true
+	}
+}
+
+// WithWildcardThreshold suggests a wildcard certificate for CertificateRequests
+// with at least threshold hostnames sharing a parent domain, or requests the
+// wildcard instead of them if collapse is set.
+func WithWildcardThreshold(threshold int, collapse bool) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.WildcardThreshold = threshold
+		s.CollapseToWildcard = collapse
+	}
+}
+
+// WithRequireMatchingKeyType fails requests whose public key doesn't match
+// the request type of the issuer.
+func WithRequireMatchingKeyType() SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.RequireMatchingKeyType = true
+	}
+}
+
+// WithResolveZones resolves the zone of each hostname before signing, and
+// checks the issuer's API token can manage its Origin CA certificates.
+func WithResolveZones() SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.ResolveZones = true
+	}
+}
+
+// WithRequireActiveZones fails requests for hostnames of zones that aren't
+// active in Cloudflare. Requires WithResolveZones.
+func WithRequireActiveZones() SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.RequireActiveZones = true
+	}
+}
+
+// WithAllowedDNS restricts the hostnames the issuer signs for to the names,
+// and to the hostnames of the zones.
+func WithAllowedDNS(names, zones []string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.AllowedDNSNames = names
+		s.AllowedDNSZones = zones
+	}
+}
+
+// WithAllowedNamespaces restricts a ClusterOriginIssuer to the
+// CertificateRequests of the namespaces named, or whose labels match the
+// selector, if not nil.
+func WithAllowedNamespaces(selector *metav1.LabelSelector, names ...string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.AllowedNamespaces = &v1.AllowedNamespaces{Names: names, Selector: selector}
+	}
+}
+
+// WithCloudflareAPIURL sends the issuer's requests to the Cloudflare API
+// endpoint at url, such as a mock server.
+func WithCloudflareAPIURL(url string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.CloudflareAPIURL = url
+	}
+}
+
+// WithCanary rolls out changes of the issuer's configuration to percent of
+// new CertificateRequests, promoting them after the given number of
+// successes.
+func WithCanary(percent, successes int) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Canary = &v1.Canary{Percent: percent, Successes: successes}
+	}
+}
+
+// WithServiceKeyRef authenticates with the Origin CA service key stored in the
+// given Secret and key.
+func WithServiceKeyRef(name, key string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Auth = v1.OriginIssuerAuthentication{
+			ServiceKeyRef: v1.SecretKeySelector{Name: name, Key: key},
+		}
+	}
+}
+
+// WithAPITokenRef authenticates with the API Token stored in the given Secret
+// and key.
+func WithAPITokenRef(name, key string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Auth = v1.OriginIssuerAuthentication{
+			APITokenRef: &v1.SecretKeySelector{Name: name, Key: key},
+		}
+	}
+}
+
+// WithVerifyTokenRef verifies the issuer, and resolves zones, with the API
+// Token stored in the given Secret, rather than with its signing credential.
+func WithVerifyTokenRef(name, key string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Auth.VerifyTokenRef = &v1.SecretKeySelector{Name: name, Key: key}
+	}
+}
+
+// WithTokenExchange authenticates with short-lived credentials the secret
+// broker at url exchanges for a token of the given ServiceAccount.
+func WithTokenExchange(url, serviceAccount string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Auth = v1.OriginIssuerAuthentication{
+			TokenExchange: &v1.TokenExchange{
+				URL:               url,
+				ServiceAccountRef: v1.ServiceAccountRef{Name: serviceAccount},
+			},
+		}
+	}
+}
+
+// WithVault authenticates with the API Token stored in Vault at address, under
+// key of the secret at path, logging in as role with a token of the given
+// ServiceAccount.
+func WithVault(address, role, serviceAccount, path, key string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Auth = v1.OriginIssuerAuthentication{
+			Vault: &v1.VaultAuth{
+				Address:           address,
+				Role:              role,
+				ServiceAccountRef: v1.ServiceAccountRef{Name: serviceAccount},
+				Path:              path,
+				Key:               key,
+			},
+		}
+	}
+}
+
+// WithZoneAPITokenRef authenticates requests for hostnames of the given zones
+// with the API Token stored in the given Secret and key. It must be applied
+// after the option setting the issuer's own authentication.
+func WithZoneAPITokenRef(name, key string, zones ...string) SpecOption {
+	return func(s *v1.OriginIssuerSpec) {
+		s.Auth.Zones = append(s.Auth.Zones, v1.ZoneCredential{
+			Zones:       zones,
+			APITokenRef: &v1.SecretKeySelector{Name: name, Key: key},
+		})
+	}
+}
+
+// NewOriginIssuer returns an OriginIssuer with the given options applied. The
+// request type defaults to OriginRSA.
+func NewOriginIssuer(namespace, name string, opts ...SpecOption) *v1.OriginIssuer {
+	return &v1.OriginIssuer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.GroupVersion.String(),
+			Kind:       "OriginIssuer",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Spec: newSpec(opts),
+	}
+}
+
+// NewClusterOriginIssuer returns a ClusterOriginIssuer with the given options
+// applied. The request type defaults to OriginRSA.
+func NewClusterOriginIssuer(name string, opts ...SpecOption) *v1.ClusterOriginIssuer {
+	return &v1.ClusterOriginIssuer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.GroupVersion.String(),
+			Kind:       "ClusterOriginIssuer",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: newSpec(opts),
+	}
+}
+
+func newSpec(opts []SpecOption) v1.OriginIssuerSpec {
+	spec := v1.OriginIssuerSpec{
+		RequestType: v1.RequestTypeOriginRSA,
+	}
+
+	for _, opt := range opts {
+		opt(&spec)
+	}
+
+	return spec
+}
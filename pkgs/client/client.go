@@ -0,0 +1,166 @@
+// Package client provides typed helpers for managing OriginIssuers and
+// ClusterOriginIssuers from Go programs, built on top of the controller-runtime
+// client so that callers don't need to handle unstructured objects.
+package client
+
+import (
+	"context"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewScheme returns a scheme with the Kubernetes built-in types and the
+// OriginIssuer API types registered.
+func NewScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	if err := v1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	return scheme, nil
+}
+
+// Client provides typed access to OriginIssuer and ClusterOriginIssuer
+// resources.
+type Client struct {
+	client ctrlclient.Client
+}
+
+// New returns a Client for the cluster described by config.
+func New(config *rest.Config) (*Client, error) {
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ctrlclient.New(config, ctrlclient.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewForClient(c), nil
+}
+
+// NewForClient returns a Client backed by an existing controller-runtime
+// client. The client's scheme must have the OriginIssuer API types registered.
+func NewForClient(c ctrlclient.Client) *Client {
+	return &Client{client: c}
+}
+
+// OriginIssuers returns an accessor for OriginIssuers in the given namespace.
+func (c *Client) OriginIssuers(namespace string) *OriginIssuers {
+	return &OriginIssuers{client: c.client, namespace: namespace}
+}
+
+// ClusterOriginIssuers returns an accessor for ClusterOriginIssuers.
+func (c *Client) ClusterOriginIssuers() *ClusterOriginIssuers {
+	return &ClusterOriginIssuers{client: c.client}
+}
+
+// OriginIssuers manages OriginIssuers in a single namespace.
+type OriginIssuers struct {
+	client    ctrlclient.Client
+	namespace string
+}
+
+// Get returns the named OriginIssuer.
+func (o *OriginIssuers) Get(ctx context.Context, name string) (*v1.OriginIssuer, error) {
+	iss := &v1.OriginIssuer{}
+	if err := o.client.Get(ctx, types.NamespacedName{Namespace: o.namespace, Name: name}, iss); err != nil {
+		return nil, err
+	}
+
+	return iss, nil
+}
+
+// List returns the OriginIssuers in the namespace matching opts.
+func (o *OriginIssuers) List(ctx context.Context, opts ...ctrlclient.ListOption) ([]v1.OriginIssuer, error) {
+	var list v1.OriginIssuerList
+	if err := o.client.List(ctx, &list, append(opts, ctrlclient.InNamespace(o.namespace))...); err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+// Create creates the OriginIssuer in the namespace.
+func (o *OriginIssuers) Create(ctx context.Context, iss *v1.OriginIssuer) error {
+	iss.Namespace = o.namespace
+
+	return o.client.Create(ctx, iss)
+}
+
+// Apply creates or updates the OriginIssuer with server-side apply, taking
+// ownership of the fields set in iss on behalf of fieldOwner.
+func (o *OriginIssuers) Apply(ctx context.Context, iss *v1.OriginIssuer, fieldOwner string) error {
+	iss.Namespace = o.namespace
+	iss.SetGroupVersionKind(v1.GroupVersion.WithKind("OriginIssuer"))
+	iss.ManagedFields = nil
+
+	return o.client.Patch(ctx, iss, ctrlclient.Apply, ctrlclient.FieldOwner(fieldOwner), ctrlclient.ForceOwnership)
+}
+
+// Delete deletes the named OriginIssuer.
+func (o *OriginIssuers) Delete(ctx context.Context, name string) error {
+	iss := &v1.OriginIssuer{}
+	iss.Namespace = o.namespace
+	iss.Name = name
+
+	return o.client.Delete(ctx, iss)
+}
+
+// ClusterOriginIssuers manages ClusterOriginIssuers.
+type ClusterOriginIssuers struct {
+	client ctrlclient.Client
+}
+
+// Get returns the named ClusterOriginIssuer.
+func (o *ClusterOriginIssuers) Get(ctx context.Context, name string) (*v1.ClusterOriginIssuer, error) {
+	iss := &v1.ClusterOriginIssuer{}
+	if err := o.client.Get(ctx, types.NamespacedName{Name: name}, iss); err != nil {
+		return nil, err
+	}
+
+	return iss, nil
+}
+
+// List returns the ClusterOriginIssuers matching opts.
+func (o *ClusterOriginIssuers) List(ctx context.Context, opts ...ctrlclient.ListOption) ([]v1.ClusterOriginIssuer, error) {
+	var list v1.ClusterOriginIssuerList
+	if err := o.client.List(ctx, &list, opts...); err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+// Create creates the ClusterOriginIssuer.
+func (o *ClusterOriginIssuers) Create(ctx context.Context, iss *v1.ClusterOriginIssuer) error {
+	return o.client.Create(ctx, iss)
+}
+
+// Apply creates or updates the ClusterOriginIssuer with server-side apply,
+// taking ownership of the fields set in iss on behalf of fieldOwner.
+func (o *ClusterOriginIssuers) Apply(ctx context.Context, iss *v1.ClusterOriginIssuer, fieldOwner string) error {
+	iss.SetGroupVersionKind(v1.GroupVersion.WithKind("ClusterOriginIssuer"))
+	iss.ManagedFields = nil
+
+	return o.client.Patch(ctx, iss, ctrlclient.Apply, ctrlclient.FieldOwner(fieldOwner), ctrlclient.ForceOwnership)
+}
+
+// Delete deletes the named ClusterOriginIssuer.
+func (o *ClusterOriginIssuers) Delete(ctx context.Context, name string) error {
+	iss := &v1.ClusterOriginIssuer{}
+	iss.Name = name
+
+	return o.client.Delete(ctx, iss)
+}
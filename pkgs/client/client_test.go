@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"gotest.tools/v3/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOriginIssuers(t *testing.T) {
+	scheme, err := NewScheme()
+	assert.NilError(t, err)
+
+	ctx := context.Background()
+	c := NewForClient(fake.NewClientBuilder().WithScheme(scheme).Build())
+
+	issuers := c.OriginIssuers("default")
+	assert.NilError(t, issuers.Create(ctx, NewOriginIssuer("", "foo",
+		WithRequestType(v1.RequestTypeOriginECC),
+		WithAPITokenRef("api-token", "token"),
+	)))
+
+	got, err := issuers.Get(ctx, "foo")
+	assert.NilError(t, err)
+	assert.Equal(t, got.Namespace, "default")
+	assert.Equal(t, got.Spec.RequestType, v1.RequestTypeOriginECC)
+	assert.DeepEqual(t, got.Spec.Auth.APITokenRef, &v1.SecretKeySelector{Name: "api-token", Key: "token"})
+
+	list, err := c.OriginIssuers("elsewhere").List(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 0)
+
+	assert.NilError(t, issuers.Delete(ctx, "foo"))
+	_, err = issuers.Get(ctx, "foo")
+	assert.Assert(t, apierrors.IsNotFound(err))
+}
+
+func TestClusterOriginIssuers(t *testing.T) {
+	scheme, err := NewScheme()
+	assert.NilError(t, err)
+
+	ctx := context.Background()
+	c := NewForClient(fake.NewClientBuilder().WithScheme(scheme).Build())
+
+	issuers := c.ClusterOriginIssuers()
+	assert.NilError(t, issuers.Create(ctx, NewClusterOriginIssuer("foo", WithServiceKeyRef("service-key", "key"))))
+
+	list, err := issuers.List(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 1)
+	assert.Equal(t, list[0].Spec.RequestType, v1.RequestTypeOriginRSA)
+	assert.Equal(t, list[0].Spec.Auth.ServiceKeyRef, v1.SecretKeySelector{Name: "service-key", Key: "key"})
+}
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   v1.OriginIssuerStatus
+		expected bool
+	}{
+		{
+			name:     "no conditions",
+			expected: false,
+		},
+		{
+			name: "ready",
+			status: v1.OriginIssuerStatus{Conditions: []metav1.Condition{
+				{Type: v1.ConditionReady, Status: v1.ConditionTrue},
+			}},
+			expected: true,
+		},
+		{
+			name: "not ready",
+			status: v1.OriginIssuerStatus{Conditions: []metav1.Condition{
+				{Type: v1.ConditionReady, Status: v1.ConditionFalse},
+			}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, IsReady(tt.status), tt.expected)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the given type, or nil if the status
+// has no such condition.
+func GetCondition(status v1.OriginIssuerStatus, conditionType string) *metav1.Condition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// IsReady returns true if the issuer status has a Ready condition with status
+// True, meaning the issuer is able to sign certificates.
+func IsReady(status v1.OriginIssuerStatus) bool {
+	c := GetCondition(status, v1.ConditionReady)
+
+	return c != nil && c.Status == v1.ConditionTrue
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// namespaceNotAllowedReason is the reason of the InvalidRequest condition of
+// CertificateRequests from a namespace a ClusterOriginIssuer doesn't allow.
+const namespaceNotAllowedReason = "NamespaceNotAllowed"
+
+// namespaceAllowed reports whether the namespace is allowed by the
+// AllowedNamespaces of a ClusterOriginIssuer. The namespace is only read when
+// it isn't listed by name, to match its labels against the selector.
+func namespaceAllowed(ctx context.Context, c client.Reader, allowed *v1.AllowedNamespaces, namespace string) (bool, error) {
+	if allowed == nil {
+		return true, nil
+	}
+
+	for _, name := range allowed.Names {
+		if name == namespace {
+			return true, nil
+		}
+	}
+
+	if allowed.Selector == nil {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(allowed.Selector)
+	if err != nil {
+		return false, err
+	}
+
+	var ns core.Namespace
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		return false, err
+	}
+
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/validation"
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// approverReason is the reason of the Approved and Denied conditions set by
+// the CertificateRequestApprover, naming the approver as cert-manager's does.
+const approverReason = "cert-manager.k8s.cloudflare.com"
+
+// CertificateRequestApprover approves the CertificateRequests referencing an
+// OriginIssuer or ClusterOriginIssuer that its policy allows, and denies the
+// others, replacing cert-manager's approver for simple setups. Requests
+// already approved or denied, such as by another approver, are left as is.
+// The policy denies what it doesn't explicitly allow.
+type CertificateRequestApprover struct {
+	Client   client.Client
+	Clock    clock.Clock
+	Recorder record.EventRecorder
+	Log      logr.Logger
+
+	// Namespaces are the namespaces whose CertificateRequests are approved,
+	// "*" approving requests of every namespace. Requests of every
+	// namespace are denied when empty.
+	Namespaces []string
+
+	// DNSZones are the domains whose hostnames, including the domains
+	// themselves, CertificateRequests may request. Every hostname is denied
+	// when empty.
+	DNSZones []string
+
+	// DryRun logs the decisions of the approver without approving or
+	// denying requests, which would otherwise be signed once the dry run
+	// ends.
+	DryRun bool
+}
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=get;update;patch
+
+// Reconcile approves or denies a CertificateRequest of the issuers that is
+// neither approved nor denied yet.
+func (r *CertificateRequestApprover) Reconcile(ctx context.Context, cr *certmanager.CertificateRequest) (reconcile.Result, error) {
+	log := r.Log.WithValues("namespace", cr.Namespace, "certificaterequest", cr.Name, "issuer_kind", cr.Spec.IssuerRef.Kind, "issuer_name", cr.Spec.IssuerRef.Name)
+
+	// Requests without a group are for cert-manager's own issuers, which the
+	// approver never approves.
+	if cr.Spec.IssuerRef.Group != v1.GroupVersion.Group {
+		return reconcile.Result{}, nil
+	}
+
+	switch cr.Spec.IssuerRef.Kind {
+	case "OriginIssuer", "ClusterOriginIssuer":
+	default:
+		return reconcile.Result{}, nil
+	}
+
+	if cmutil.CertificateRequestIsApproved(cr) || cmutil.CertificateRequestIsDenied(cr) {
+		return reconcile.Result{}, nil
+	}
+
+	message := r.deny(cr)
+	if r.DryRun {
+		if message != "" {
+			log.Info("dry run, not denying certificate request", "reason", message)
+		} else {
+			log.Info("dry run, not approving certificate request")
+		}
+
+		return reconcile.Result{}, nil
+	}
+
+	if message != "" {
+		log.Info("denying certificate request", "reason", message)
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionDenied, cmmeta.ConditionTrue, r.Log, r.Clock, approverReason, message)
+		if err := r.Client.Status().Update(ctx, cr); err != nil {
+			return reconcile.Result{}, err
+		}
+		r.Recorder.Event(cr, core.EventTypeWarning, "Denied", message)
+
+		return reconcile.Result{}, nil
+	}
+
+	log.V(4).Info("approving certificate request")
+	message = "Approved by the origin-ca-issuer approver"
+	SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionApproved, cmmeta.ConditionTrue, r.Log, r.Clock, approverReason, message)
+	if err := r.Client.Status().Update(ctx, cr); err != nil {
+		return reconcile.Result{}, err
+	}
+	r.Recorder.Event(cr, core.EventTypeNormal, "Approved", message)
+
+	return reconcile.Result{}, nil
+}
+
+// deny returns why the policy denies the CertificateRequest, or an empty
+// string if it allows it.
+func (r *CertificateRequestApprover) deny(cr *certmanager.CertificateRequest) string {
+	if !slices.Contains(r.Namespaces, "*") && !slices.Contains(r.Namespaces, cr.Namespace) {
+		return fmt.Sprintf("Namespace %s is not allowed by the origin-ca-issuer approver", cr.Namespace)
+	}
+
+	csr, err := pki.DecodeX509CertificateRequestBytes(cr.Spec.Request)
+	if err != nil {
+		return fmt.Sprintf("Failed to decode CSR: %v", err)
+	}
+
+	if len(csr.IPAddresses) > 0 || len(csr.URIs) > 0 || len(csr.EmailAddresses) > 0 {
+		return "IP address, URI and email address SANs are not allowed by the origin-ca-issuer approver"
+	}
+
+	hostnames := csr.DNSNames
+	if csr.Subject.CommonName != "" {
+		hostnames = append(hostnames, csr.Subject.CommonName)
+	}
+	if len(hostnames) == 0 {
+		return "CSR requests no hostnames"
+	}
+
+	var denied []string
+	for _, hostname := range validation.NormalizeHostnames(hostnames) {
+		if !provisioners.HostnameAllowed(hostname, nil, r.DNSZones) {
+			denied = append(denied, hostname)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Sprintf("Hostnames %s are not in the DNS zones allowed by the origin-ca-issuer approver", strings.Join(denied, ", "))
+	}
+
+	return ""
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestCertificateRequestApprover(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	tests := []struct {
+		name       string
+		cr         *cmapi.CertificateRequest
+		namespaces []string
+		zones      []string
+		dryRun     bool
+		condition  cmapi.CertificateRequestConditionType
+		message    string
+	}{
+		{
+			name: "nothing allowed",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			condition: cmapi.CertificateRequestConditionDenied,
+			message:   "Namespace default is not allowed by the origin-ca-issuer approver",
+		},
+		{
+			name: "no dns zones",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			namespaces: []string{"*"},
+			condition:  cmapi.CertificateRequestConditionDenied,
+			message:    "Hostnames example.com are not in the DNS zones allowed by the origin-ca-issuer approver",
+		},
+		{
+			name: "every namespace",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			namespaces: []string{"*"},
+			zones:      []string{"example.com"},
+			condition:  cmapi.CertificateRequestConditionApproved,
+			message:    "Approved by the origin-ca-issuer approver",
+		},
+		{
+			name: "common name not allowed",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				cmgen.SetCertificateRequestCSR(approverCSR(t, cmgen.SetCSRDNSNames("example.com"), cmgen.SetCSRCommonName("example.org"))),
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			namespaces: []string{"*"},
+			zones:      []string{"example.com"},
+			condition:  cmapi.CertificateRequestConditionDenied,
+			message:    "Hostnames example.org are not in the DNS zones allowed by the origin-ca-issuer approver",
+		},
+		{
+			name: "ip address",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				cmgen.SetCertificateRequestCSR(approverCSR(t, cmgen.SetCSRDNSNames("example.com"), cmgen.SetCSRIPAddresses(net.ParseIP("192.0.2.1")))),
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			namespaces: []string{"*"},
+			zones:      []string{"example.com"},
+			condition:  cmapi.CertificateRequestConditionDenied,
+			message:    "IP address, URI and email address SANs are not allowed by the origin-ca-issuer approver",
+		},
+		{
+			name: "dry run",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			namespaces: []string{"*"},
+			zones:      []string{"example.com"},
+			dryRun:     true,
+		},
+		{
+			name: "allowed",
+			cr: issuertesting.CertificateRequest("team-a", "foobar",
+				issuertesting.SetCertificateRequestDNSNames("example.com", "*.example.com", "www.example.net"),
+				issuertesting.SetCertificateRequestClusterOriginIssuer("foobar"),
+			),
+			namespaces: []string{"team-a"},
+			zones:      []string{"example.com", "example.net"},
+			condition:  cmapi.CertificateRequestConditionApproved,
+			message:    "Approved by the origin-ca-issuer approver",
+		},
+		{
+			name: "namespace not allowed",
+			cr: issuertesting.CertificateRequest("team-b", "foobar",
+				issuertesting.SetCertificateRequestClusterOriginIssuer("foobar"),
+			),
+			namespaces: []string{"team-a"},
+			zones:      []string{"example.com"},
+			condition:  cmapi.CertificateRequestConditionDenied,
+			message:    "Namespace team-b is not allowed by the origin-ca-issuer approver",
+		},
+		{
+			name: "hostnames not allowed",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestDNSNames("example.com", "example.org", "www.badexample.com"),
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			namespaces: []string{"default"},
+			zones:      []string{"example.com"},
+			condition:  cmapi.CertificateRequestConditionDenied,
+			message:    "Hostnames example.org, www.badexample.com are not in the DNS zones allowed by the origin-ca-issuer approver",
+		},
+		{
+			name: "other issuer",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{Name: "foobar", Kind: "Issuer"}),
+			),
+		},
+		{
+			name: "already denied",
+			cr: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+				cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+					Type:    cmapi.CertificateRequestConditionDenied,
+					Status:  cmmeta.ConditionTrue,
+					Reason:  "policy.cert-manager.io",
+					Message: "Denied by approver-policy",
+				}),
+			),
+			condition: cmapi.CertificateRequestConditionDenied,
+			message:   "Denied by approver-policy",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(tt.cr).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			approver := &CertificateRequestApprover{
+				Client:     client,
+				Clock:      clock,
+				Recorder:   record.NewFakeRecorder(10),
+				Log:        logf.Log,
+				Namespaces: tt.namespaces,
+				DNSZones:   tt.zones,
+				DryRun:     tt.dryRun,
+			}
+
+			_, err := reconcile.AsReconciler(client, approver).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: tt.cr.Namespace, Name: tt.cr.Name},
+			})
+			assert.NilError(t, err)
+
+			cr := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: tt.cr.Namespace, Name: tt.cr.Name}, cr))
+
+			if tt.condition == "" {
+				assert.Equal(t, len(cr.Status.Conditions), 0)
+				return
+			}
+
+			assert.Equal(t, len(cr.Status.Conditions), 1)
+			condition := cmutil.GetCertificateRequestCondition(cr, tt.condition)
+			assert.Assert(t, condition != nil)
+			assert.Equal(t, condition.Message, tt.message)
+		})
+	}
+}
+
+func approverCSR(t *testing.T, mods ...cmgen.CSRModifier) []byte {
+	t.Helper()
+
+	csr, _, err := cmgen.CSR(x509.ECDSA, mods...)
+	assert.NilError(t, err)
+
+	return csr
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type attributionKey struct{}
+
+// withAttribution returns a copy of ctx carrying the attribution of the
+// CertificateRequest being reconciled.
+func withAttribution(ctx context.Context, attribution map[string]string) context.Context {
+	return context.WithValue(ctx, attributionKey{}, attribution)
+}
+
+// attributionFromContext returns the attribution carried by ctx, or nil.
+func attributionFromContext(ctx context.Context) map[string]string {
+	attribution, _ := ctx.Value(attributionKey{}).(map[string]string)
+	return attribution
+}
+
+// attribution returns the values of the AttributionKeys of the
+// CertificateRequest, read from its annotations, or else labels, and then
+// from those of the Certificate owning it, as cert-manager doesn't copy the
+// labels of Certificates to their CertificateRequests. Keys without a value
+// are left out. Failing to read the Certificate is only logged, as it doesn't
+// affect signing.
+func (r *CertificateRequestController) attribution(ctx context.Context, log logr.Logger, cr *certmanager.CertificateRequest) map[string]string {
+	attribution := make(map[string]string, len(r.AttributionKeys))
+	missing := false
+	for _, key := range r.AttributionKeys {
+		if value, ok := objectAttribution(cr.ObjectMeta, key); ok {
+			attribution[key] = value
+		} else {
+			missing = true
+		}
+	}
+
+	owner := metav1.GetControllerOf(cr)
+	if !missing || owner == nil || owner.Kind != certmanager.CertificateKind || owner.APIVersion != certmanager.SchemeGroupVersion.String() {
+		return attribution
+	}
+
+	var cert certmanager.Certificate
+	if err := r.Reader.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: owner.Name}, &cert); err != nil {
+		log.V(4).Info("unable to retrieve owning Certificate, ignoring its attribution", "certificate", owner.Name, "error", err.Error())
+
+		return attribution
+	}
+
+	for _, key := range r.AttributionKeys {
+		if _, ok := attribution[key]; ok {
+			continue
+		}
+		if value, ok := objectAttribution(cert.ObjectMeta, key); ok {
+			attribution[key] = value
+		}
+	}
+
+	return attribution
+}
+
+// objectAttribution returns the value of the annotation of the object, or
+// else of its label.
+func objectAttribution(meta metav1.ObjectMeta, key string) (string, bool) {
+	if value, ok := meta.Annotations[key]; ok {
+		return value, true
+	}
+
+	value, ok := meta.Labels[key]
+	return value, ok
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// authFailureKey identifies a credential by the secret holding it, and the
+// secret's resource version, so that updating the secret invalidates any
+// failure recorded for the previous credential.
+type authFailureKey struct {
+	Secret          types.NamespacedName
+	ResourceVersion string
+}
+
+type authFailure struct {
+	err     error
+	expires time.Time
+}
+
+// authFailures remembers credentials rejected by the Cloudflare API for a
+// while, so that requests queued behind a rejected credential fail without
+// each calling Cloudflare. The zero value is ready to use.
+type authFailures struct {
+	mu       sync.Mutex
+	failures map[authFailureKey]authFailure
+}
+
+// get returns the error a credential was rejected with, unless it expired.
+func (a *authFailures) get(key authFailureKey, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, ok := a.failures[key]
+	if !ok {
+		return nil
+	}
+
+	if !now.Before(f.expires) {
+		delete(a.failures, key)
+		return nil
+	}
+
+	return f.err
+}
+
+// add records that a credential was rejected with err, until expires. Expired
+// failures are dropped, so that secrets rotated away from are forgotten.
+func (a *authFailures) add(key authFailureKey, err error, now, expires time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.failures == nil {
+		a.failures = make(map[authFailureKey]authFailure)
+	}
+
+	for k, f := range a.failures {
+		if !now.Before(f.expires) {
+			delete(a.failures, k)
+		}
+	}
+
+	a.failures[key] = authFailure{err: err, expires: expires}
+}
+
+// reset forgets every failure, so that the credentials are tried again.
+func (a *authFailures) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.failures = nil
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultCanarySuccesses is the number of CertificateRequests signed with a
+// changed configuration promoting it, unless the issuer's Canary sets it.
+const defaultCanarySuccesses = 5
+
+const (
+	canaryFailedReason   = "CanaryFailed"
+	canaryPromotedReason = "CanaryPromoted"
+)
+
+// issuerConfiguration returns the configuration of the spec rolled out by a
+// Canary.
+func issuerConfiguration(spec v1.OriginIssuerSpec) v1.IssuerConfiguration {
+	return v1.IssuerConfiguration{
+		CloudflareAPIURL: spec.CloudflareAPIURL,
+		Auth:             *spec.Auth.DeepCopy(),
+	}
+}
+
+// withConfiguration returns the spec with its configuration replaced.
+func withConfiguration(spec v1.OriginIssuerSpec, config v1.IssuerConfiguration) v1.OriginIssuerSpec {
+	spec.CloudflareAPIURL = config.CloudflareAPIURL
+	spec.Auth = *config.Auth.DeepCopy()
+
+	return spec
+}
+
+// canaryInProgress reports whether the configuration of the spec is being
+// rolled out, differing from the stable configuration of the issuer.
+func canaryInProgress(spec v1.OriginIssuerSpec, status v1.OriginIssuerStatus) bool {
+	return spec.Canary != nil && status.StableConfiguration != nil &&
+		!equality.Semantic.DeepEqual(*status.StableConfiguration, issuerConfiguration(spec))
+}
+
+// updateCanaryStatus records the configuration of an issuer just verified as
+// its stable configuration, unless it is a changed configuration to roll out,
+// whose rollout then starts.
+func updateCanaryStatus(spec v1.OriginIssuerSpec, status *v1.OriginIssuerStatus, generation int64) {
+	switch {
+	case spec.Canary == nil:
+		status.StableConfiguration, status.Canary = nil, nil
+	case !canaryInProgress(spec, *status):
+		config := issuerConfiguration(spec)
+		status.StableConfiguration, status.Canary = &config, nil
+	case status.Canary == nil || status.Canary.Generation != generation:
+		status.Canary = &v1.CanaryStatus{Generation: generation}
+	}
+}
+
+// failCanary stops the rollout of the configuration of the generation.
+func failCanary(status *v1.OriginIssuerStatus, generation int64, message string) {
+	if status.Canary == nil || status.Canary.Generation != generation {
+		status.Canary = &v1.CanaryStatus{Generation: generation}
+	}
+
+	status.Canary.Failed = true
+	status.Canary.Message = message
+}
+
+// canarySpec returns the spec signing a CertificateRequest, and whether it
+// is the changed configuration being rolled out. Requests are spread by UID,
+// so that retries of a request are signed with the same configuration. Until
+// the issuer verified the changed configuration, and once it failed, requests
+// are signed with the stable configuration.
+func canarySpec(spec v1.OriginIssuerSpec, status v1.OriginIssuerStatus, generation int64, uid types.UID) (v1.OriginIssuerSpec, bool) {
+	if !canaryInProgress(spec, status) {
+		return spec, false
+	}
+
+	if c := status.Canary; c != nil && c.Generation == generation && !c.Failed {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(uid))
+		if int(h.Sum32()%100) < spec.Canary.Percent {
+			return spec, true
+		}
+	}
+
+	return withConfiguration(spec, *status.StableConfiguration), false
+}
+
+// recordCanary records the outcome of signing a CertificateRequest with the
+// changed configuration of the issuer: the configuration is promoted to the
+// stable configuration once it signed enough requests, and no longer used
+// once it failed. Failing to record the outcome is only logged, as the
+// request was already signed or failed.
+func recordCanary(ctx context.Context, log logr.Logger, c client.Client, recorder record.EventRecorder, iss client.Object, signErr error) {
+	generation := iss.GetGeneration()
+
+	var reason, message string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		reason = ""
+		if err := c.Get(ctx, client.ObjectKeyFromObject(iss), iss); err != nil {
+			return err
+		}
+
+		spec, status := issuerSpecStatus(iss)
+		if iss.GetGeneration() != generation || !canaryInProgress(spec, *status) || status.Canary == nil || status.Canary.Generation != generation || status.Canary.Failed {
+			return nil
+		}
+
+		switch {
+		case signErr != nil:
+			reason, message = canaryFailedReason, fmt.Sprintf("Failed to sign certificate request: %v", signErr)
+			failCanary(status, generation, message)
+		case status.Canary.Successes+1 >= canarySuccesses(spec):
+			config := issuerConfiguration(spec)
+			status.StableConfiguration, status.Canary = &config, nil
+			reason, message = canaryPromotedReason, "Changed configuration promoted to the stable configuration"
+		default:
+			status.Canary.Successes++
+		}
+
+		return c.Status().Update(ctx, iss)
+	})
+	if err != nil {
+		log.Error(err, "failed to record the outcome of the canary")
+
+		return
+	}
+
+	switch reason {
+	case canaryFailedReason:
+		recorder.Event(iss, core.EventTypeWarning, reason, message)
+	case canaryPromotedReason:
+		recorder.Event(iss, core.EventTypeNormal, reason, message)
+	}
+}
+
+// canaryFailure reports whether an error signing a CertificateRequest says
+// something of the issuer's configuration, such as its credentials or API
+// endpoint, failing a canary. Errors of the request itself, such as a
+// duplicate certificate or hostnames outside of any zone, don't.
+func canaryFailure(err error) bool {
+	if errors.Is(err, provisioners.ErrInvalidRequest) {
+		return false
+	}
+
+	var zoneErr *provisioners.ZoneError
+	if errors.As(err, &zoneErr) && zoneErr.Err == nil {
+		return false
+	}
+
+	var apiErr *cfapi.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+			return false
+		}
+	}
+
+	return true
+}
+
+// canarySuccesses returns the number of requests signed with a changed
+// configuration promoting it.
+func canarySuccesses(spec v1.OriginIssuerSpec) int {
+	if spec.Canary.Successes > 0 {
+		return spec.Canary.Successes
+	}
+
+	return defaultCanarySuccesses
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const canaryServiceKey = "v1.0-0xCA9A41"
+
+func canarySecret(namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "canary-service-key"},
+		Data:       map[string][]byte{"key": []byte(canaryServiceKey)},
+	}
+}
+
+// stableConfiguration sets the stable configuration of the issuer to that of
+// issuertesting.ServiceKeySecret, and the progress of its canary.
+func stableConfiguration(canary *v1.CanaryStatus) issuertesting.IssuerModifier {
+	return func(_ *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+		status.StableConfiguration = &v1.IssuerConfiguration{
+			Auth: v1.OriginIssuerAuthentication{
+				ServiceKeyRef: v1.SecretKeySelector{Name: issuertesting.ServiceKeySecretName, Key: issuertesting.ServiceKeySecretKey},
+			},
+		}
+		status.Canary = canary
+	}
+}
+
+func TestOriginIssuerCanary(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	tests := []struct {
+		name     string
+		issuer   *v1.OriginIssuer
+		reason   string
+		stable   string
+		canary   *v1.CanaryStatus
+		errorful bool
+	}{
+		{
+			name:   "stable configuration recorded",
+			issuer: issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithCanary(10, 0))),
+			reason: "Verified",
+			stable: issuertesting.ServiceKeySecretName,
+		},
+		{
+			name: "rollout started",
+			issuer: issuertesting.OriginIssuer("default", "foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithCanary(10, 0), issuerclient.WithServiceKeyRef("canary-service-key", "key")),
+				stableConfiguration(nil),
+			),
+			reason: "Verified",
+			stable: issuertesting.ServiceKeySecretName,
+			canary: &v1.CanaryStatus{Generation: 2},
+		},
+		{
+			name: "rollout restarted",
+			issuer: issuertesting.OriginIssuer("default", "foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithCanary(10, 0), issuerclient.WithServiceKeyRef("canary-service-key", "key")),
+				stableConfiguration(&v1.CanaryStatus{Generation: 1, Failed: true, Message: "Failed"}),
+			),
+			reason: "Verified",
+			stable: issuertesting.ServiceKeySecretName,
+			canary: &v1.CanaryStatus{Generation: 2},
+		},
+		{
+			name: "changed configuration failed",
+			issuer: issuertesting.OriginIssuer("default", "foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithCanary(10, 0), issuerclient.WithServiceKeyRef("missing-service-key", "key")),
+				stableConfiguration(&v1.CanaryStatus{Generation: 2, Successes: 1}),
+			),
+			reason:   canaryFailedReason,
+			stable:   issuertesting.ServiceKeySecretName,
+			canary:   &v1.CanaryStatus{Generation: 2, Successes: 1, Failed: true, Message: `Failed to retrieve auth secret: secrets "missing-service-key" not found`},
+			errorful: true,
+		},
+		{
+			name: "canary removed",
+			issuer: issuertesting.OriginIssuer("default", "foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithServiceKeyRef("canary-service-key", "key")),
+				stableConfiguration(&v1.CanaryStatus{Generation: 2}),
+			),
+			reason: "Verified",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.issuer.Generation = 2
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithObjects(tt.issuer, issuertesting.ServiceKeySecret("default"), canarySecret("default")).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &OriginIssuerController{
+				Client:   client,
+				Reader:   client,
+				Factory:  api.Factory(),
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.Equal(t, err != nil, tt.errorful)
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+			assert.Assert(t, IssuerStatusHasCondition(got.Status, metav1.Condition{Type: v1.ConditionReady, Status: v1.ConditionTrue, Reason: tt.reason}))
+			if tt.stable == "" {
+				assert.Assert(t, got.Status.StableConfiguration == nil)
+			} else {
+				assert.Equal(t, got.Status.StableConfiguration.Auth.ServiceKeyRef.Name, tt.stable)
+			}
+			assert.DeepEqual(t, got.Status.Canary, tt.canary)
+		})
+	}
+}
+
+func TestCertificateRequestCanary(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	errRevoked := errors.New("service key revoked")
+
+	tests := []struct {
+		name       string
+		percent    int
+		successes  int
+		canary     *v1.CanaryStatus
+		signErr    error
+		serviceKey string
+		stable     string
+		expected   *v1.CanaryStatus
+	}{
+		{
+			name:       "signed with the changed configuration",
+			percent:    100,
+			successes:  2,
+			canary:     &v1.CanaryStatus{Generation: 2},
+			serviceKey: canaryServiceKey,
+			stable:     issuertesting.ServiceKeySecretName,
+			expected:   &v1.CanaryStatus{Generation: 2, Successes: 1},
+		},
+		{
+			name:       "promoted",
+			percent:    100,
+			successes:  2,
+			canary:     &v1.CanaryStatus{Generation: 2, Successes: 1},
+			serviceKey: canaryServiceKey,
+			stable:     "canary-service-key",
+		},
+		{
+			name:       "failed",
+			percent:    100,
+			canary:     &v1.CanaryStatus{Generation: 2},
+			signErr:    errRevoked,
+			serviceKey: canaryServiceKey,
+			stable:     issuertesting.ServiceKeySecretName,
+			expected:   &v1.CanaryStatus{Generation: 2, Failed: true, Message: "Failed to sign certificate request: unable to sign request: service key revoked"},
+		},
+		{
+			name:       "credentials rejected",
+			percent:    100,
+			canary:     &v1.CanaryStatus{Generation: 2},
+			signErr:    &cfapi.APIError{Code: 10000, Message: "Authentication error", StatusCode: http.StatusForbidden},
+			serviceKey: canaryServiceKey,
+			stable:     issuertesting.ServiceKeySecretName,
+			expected:   &v1.CanaryStatus{Generation: 2, Failed: true, Message: "Failed to sign certificate request: unable to sign request: Cloudflare API Error code=10000 message=Authentication error ray_id="},
+		},
+		{
+			name:       "request rejected",
+			percent:    100,
+			canary:     &v1.CanaryStatus{Generation: 2},
+			signErr:    &cfapi.APIError{Code: 1010, Message: "hostname not in account", StatusCode: http.StatusBadRequest},
+			serviceKey: canaryServiceKey,
+			stable:     issuertesting.ServiceKeySecretName,
+			expected:   &v1.CanaryStatus{Generation: 2},
+		},
+		{
+			name:       "signed with the stable configuration after failing",
+			percent:    100,
+			canary:     &v1.CanaryStatus{Generation: 2, Failed: true, Message: "Failed"},
+			serviceKey: issuertesting.ServiceKey,
+			stable:     issuertesting.ServiceKeySecretName,
+			expected:   &v1.CanaryStatus{Generation: 2, Failed: true, Message: "Failed"},
+		},
+		{
+			name:       "signed with the stable configuration until verified",
+			percent:    100,
+			canary:     &v1.CanaryStatus{Generation: 1},
+			serviceKey: issuertesting.ServiceKey,
+			stable:     issuertesting.ServiceKeySecretName,
+			expected:   &v1.CanaryStatus{Generation: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := issuertesting.OriginIssuer("default", "foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithCanary(tt.percent, tt.successes), issuerclient.WithServiceKeyRef("canary-service-key", "key")),
+				stableConfiguration(tt.canary),
+			)
+			issuer.Generation = 2
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithObjects(
+					issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+					issuer,
+					issuertesting.ServiceKeySecret("default"),
+					canarySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}, &v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{SignErr: tt.signErr}
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.DeepEqual(t, api.ServiceKeys(), []string{tt.serviceKey})
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+			assert.Equal(t, got.Status.StableConfiguration.Auth.ServiceKeyRef.Name, tt.stable)
+			assert.DeepEqual(t, got.Status.Canary, tt.expected)
+		})
+	}
+}
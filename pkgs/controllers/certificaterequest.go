@@ -1,28 +1,38 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
 	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/audit"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/certcache"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/metrics"
 	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/validation"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
 	"github.com/go-logr/logr"
 	core "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-const originDBWriteErrorCode = 1100
-
 // CertificateRequestController implements a controller that reconciles CertificateRequests
 // that references this controller.
 type CertificateRequestController struct {
@@ -31,18 +41,196 @@ type CertificateRequestController struct {
 	ClusterResourceNamespace string
 	Log                      logr.Logger
 	Factory                  cfapi.Factory
+	Recorder                 record.EventRecorder
 
 	Clock                  clock.Clock
 	CheckApprovedCondition bool
+
+	// SignTimeout bounds how long a call to the Cloudflare API to sign a
+	// CertificateRequest may take. No timeout is applied when zero.
+	SignTimeout time.Duration
+
+	// ShutdownGracePeriod is how long reconciles in flight when the
+	// controller shuts down may still sign their CertificateRequest and
+	// record its status. They are cancelled at once when zero.
+	ShutdownGracePeriod time.Duration
+
+	// DefaultDuration is the validity requested for CertificateRequests
+	// without a duration, unless their issuer sets a default. The provisioner
+	// default of 7 days applies when zero.
+	DefaultDuration time.Duration
+
+	// RevokeOnDelete adds a finalizer to signed CertificateRequests, which
+	// revokes their Origin CA certificate when the CertificateRequest is
+	// deleted, such as when its owning Certificate is deleted.
+	RevokeOnDelete bool
+
+	// RevokeDryRun only reports the certificates revoking on delete and
+	// revoking superseded certificates would revoke, with events and
+	// metrics, without revoking them.
+	RevokeDryRun bool
+
+	// MaxRetriesBeforeFail fails CertificateRequests whose signing failed
+	// with a rate limit or a transient error of the Cloudflare API more than
+	// this many times in a row. They are retried indefinitely when zero.
+	MaxRetriesBeforeFail int
+
+	authFailures authFailures
+
+	// kicked holds the keys of the CertificateRequests kicked while backing
+	// off, which are attempted at once rather than at their next attempt,
+	// with the time of the kick.
+	kicked sync.Map
+
+	// Roots provides the Origin CA root certificates, published as the CA of
+	// signed CertificateRequests when PopulateCA is set, and appended to the
+	// certificates of issuers including the chain.
+	Roots RootSource
+
+	// PopulateCA sets the CA of signed CertificateRequests.
+	PopulateCA bool
+
+	// AuthFailureTTL is how long credentials rejected by the Cloudflare API
+	// are remembered, failing further CertificateRequests signed with them
+	// without calling Cloudflare. Credentials are forgotten as soon as their
+	// secret is updated. Rejections are not remembered when zero.
+	AuthFailureTTL time.Duration
+
+	// Cache persists the certificates issued for each CertificateRequest
+	// until they are recorded on it, across restarts of the controller, so
+	// that they are published rather than signed again, or revoked, when
+	// recording them failed. Nothing is cached when nil.
+	Cache *certcache.Cache
+
+	// Audit records the certificates issued and revoked, including those
+	// only reported in dry run mode. Failing to record does not fail the
+	// CertificateRequest. Nothing is recorded when nil.
+	Audit audit.Sink
+
+	// Exchanger exchanges ServiceAccount tokens for the credentials of
+	// issuers authenticating with a token exchange, which fail without it.
+	Exchanger *tokenexchange.Exchanger
+
+	// Vault reads the credentials of issuers authenticating with Vault,
+	// which fail without it.
+	Vault *vault.Client
+
+	// NewCorrelationID generates the ID correlating the logs, events and
+	// condition messages of each reconcile. Defaults to a short random ID.
+	NewCorrelationID func() string
+
+	// TenantKey is the annotation, or else label, of the namespaces of
+	// CertificateRequests whose value is the tenant their issuance metrics
+	// and audit records are labeled with, such as a team name. Namespaces
+	// are not read when empty.
+	TenantKey string
+
+	// AttributionKeys are the annotations, or else labels, of
+	// CertificateRequests, or of the Certificates owning them, whose values,
+	// such as a team or an app, are carried with the calls to the Cloudflare
+	// API, logged, and recorded in audit records and issuance metrics, for
+	// cost attribution.
+	AttributionKeys []string
+
+	// AttributionMetricValues are the values of each of the AttributionKeys
+	// counted on their own by the attributed certificates metric, other
+	// values being counted together.
+	AttributionMetricValues map[string][]string
+
+	// DefaultClusterIssuer is the name of the ClusterOriginIssuer signing
+	// CertificateRequests referencing the ClusterOriginIssuer named
+	// DefaultClusterIssuerAlias, so that they need not know the name of the
+	// issuer in each cluster. The alias is not resolved when empty.
+	DefaultClusterIssuer string
+
+	// DefaultIssuerFallback signs every CertificateRequest referencing an
+	// OriginIssuer or ClusterOriginIssuer that doesn't exist with the
+	// DefaultClusterIssuer instead, recording it in the
+	// ResolvedIssuerAnnotation. Requires DefaultClusterIssuer.
+	DefaultIssuerFallback bool
+
+	// ReuseCertificates publishes the Origin CA certificate of the previous
+	// revision of a Certificate again, rather than signing a new one, when
+	// the new revision requests the same key and hostnames from the same
+	// issuer, and the certificate is not yet due for renewal. This avoids
+	// issuing certificates when only the Certificate's metadata changed.
+	ReuseCertificates bool
+
+	// DryRun validates CertificateRequests and logs what would be sent to
+	// the Cloudflare API to sign them, without calling it. Only the DryRun
+	// condition of CertificateRequests is updated, with the outcome, and
+	// issuers are expected to be reconciled in dry run mode too.
+	DryRun bool
+
+	// MessageTemplates override the messages of the conditions and events
+	// of CertificateRequests, by reason.
+	MessageTemplates MessageTemplates
+}
+
+// approvalRequeueDelay is how long to wait before checking again whether a
+// CertificateRequest was approved.
+const approvalRequeueDelay = 5 * time.Second
+
+// waitingForApprovalReason is the reason of the Ready condition of
+// CertificateRequests not approved yet, when CheckApprovedCondition is set.
+const waitingForApprovalReason = "WaitingForApproval"
+
+// dryRunCondition reports the outcome of signing a CertificateRequest in dry
+// run mode, in place of its Ready condition.
+const dryRunCondition = certmanager.CertificateRequestConditionType(v1.ConditionDryRun)
+
+// hostnameNotAllowedReason is the reason of the InvalidRequest condition of
+// CertificateRequests for hostnames outside of the issuer's allowedDNSNames
+// and allowedDNSZones.
+const hostnameNotAllowedReason = "HostnameNotAllowed"
+
+// zoneInactiveReason is the reason of the InvalidRequest condition of
+// CertificateRequests for hostnames of zones that aren't active, when the
+// issuer requires active zones.
+const zoneInactiveReason = "ZoneInactive"
+
+// keyTypeMismatchReason is the reason of the InvalidRequest condition of
+// CertificateRequests whose public key doesn't match the request type of the
+// issuer, when the issuer requires matching key types.
+const keyTypeMismatchReason = "KeyTypeMismatch"
+
+// approvalLatency returns how long the CertificateRequest waited after its
+// creation to be approved, if it was.
+func approvalLatency(cr *certmanager.CertificateRequest) (time.Duration, bool) {
+	for _, c := range cr.Status.Conditions {
+		if c.Type != certmanager.CertificateRequestConditionApproved || c.Status != cmmeta.ConditionTrue || c.LastTransitionTime == nil {
+			continue
+		}
+
+		return max(c.LastTransitionTime.Sub(cr.CreationTimestamp.Time), 0), true
+	}
+
+	return 0, false
+}
+
+// RootSource provides the PEM encoded root certificate of the Origin CA
+// signing certificates of a request type, such as "origin-rsa".
+type RootSource interface {
+	Root(ctx context.Context, requestType string) ([]byte, error)
 }
 
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;update
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile reconciles CertificateRequest by fetching a Cloudflare API provisioner from
 // the referenced OriginIssuer, and providing the request's CSR.
 func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certmanager.CertificateRequest) (reconcile.Result, error) {
-	log := r.Log.WithValues("namespace", cr.Namespace, "certificaterequest", cr.Name)
+	newID := r.NewCorrelationID
+	if newID == nil {
+		newID = newCorrelationID
+	}
+	id := newID()
+	ctx, cancel := withShutdownGracePeriod(ctx, r.Clock, r.ShutdownGracePeriod)
+	defer cancel()
+	ctx = withCorrelationID(ctx, id)
+	log := r.Log.WithValues("namespace", cr.Namespace, "certificaterequest", cr.Name, "correlation_id", id, "issuer_kind", cr.Spec.IssuerRef.Kind, "issuer_name", cr.Spec.IssuerRef.Name)
 
 	if cr.Spec.IssuerRef.Group != "" && cr.Spec.IssuerRef.Group != v1.GroupVersion.Group {
 		log.V(4).Info("resource does not specify an issuerRef group name that we are responsible for", "group", cr.Spec.IssuerRef.Group)
@@ -50,6 +238,10 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 		return reconcile.Result{}, nil
 	}
 
+	if !cr.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, r.finalize(ctx, log, cr)
+	}
+
 	// Ignore CertificateRequest if it is already Ready
 	if cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
 		Type:   certmanager.CertificateRequestConditionReady,
@@ -58,6 +250,14 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 		log.V(4).Info("CertificateRequest is Ready. Ignoring.")
 		return reconcile.Result{}, nil
 	}
+	// Ignore CertificateRequest if it was already signed in dry run mode
+	if r.DryRun && cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
+		Type:   dryRunCondition,
+		Status: cmmeta.ConditionTrue,
+	}) {
+		log.V(4).Info("CertificateRequest was signed in dry run mode. Ignoring.")
+		return reconcile.Result{}, nil
+	}
 	// Ignore CertificateRequest if it is already Failed
 	if cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
 		Type:   certmanager.CertificateRequestConditionReady,
@@ -92,10 +292,21 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 	}
 
 	if r.CheckApprovedCondition {
-		// If CertificateRequest has not been approved, exit early.
+		// If CertificateRequest has not been approved, report it as waiting
+		// for approval once. Approving it updates the CertificateRequest,
+		// which is reconciled again at once; check again shortly anyway, in
+		// case it is approved before the update reaches our cache.
 		if !cmutil.CertificateRequestIsApproved(cr) {
-			log.V(4).Info("certificate request has not been approved")
-			return reconcile.Result{}, nil
+			log.V(4).Info("certificate request has not been approved, requeue-ing", "after", approvalRequeueDelay)
+			if !cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
+				Type:   certmanager.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionFalse,
+				Reason: waitingForApprovalReason,
+			}) {
+				_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, waitingForApprovalReason, "Waiting for the CertificateRequest to be approved by an approval controller")
+			}
+
+			return reconcile.Result{RequeueAfter: approvalRequeueDelay}, nil
 		}
 	}
 
@@ -105,23 +316,84 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 		return reconcile.Result{}, nil
 	}
 
-	if cr.Spec.IsCA {
-		log.Info("Origin Issuer does not support signing of CA certificates")
+	// Requests backing off after failing to be signed wait for their next
+	// attempt, even when the controller restarted in the meantime, unless
+	// they were kicked.
+	if _, next := retryState(cr); next.After(r.Clock.Now()) {
+		if _, kicked := r.kicked.LoadAndDelete(client.ObjectKeyFromObject(cr)); !kicked {
+			delay := next.Sub(r.Clock.Now())
+			log.V(4).Info("certificate request is backing off, requeue-ing", "after", delay)
 
-		return reconcile.Result{}, nil
+			return reconcile.Result{RequeueAfter: delay}, nil
+		}
+	}
+
+	// Requests the Origin CA will never sign are failed, rather than left
+	// pending without any explanation.
+	if message := unsupportedByOriginCA(cr); message != "" {
+		log.Info("Origin CA does not support the certificate request", "reason", message)
+
+		if cr.Status.FailureTime == nil {
+			nowTime := metav1.NewTime(r.Clock.Now())
+			cr.Status.FailureTime = &nowTime
+		}
+
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, unsupportedByOriginCAReason, withCorrelationIDMessage(ctx, message))
+		return reconcile.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, message)
+	}
+
+	if usages := unissuedUsages(cr); len(usages) > 0 {
+		message := fmt.Sprintf("The Cloudflare Origin CA certificate will not have the %s usages requested, as Origin CA certificates are only issued for digital signature, key encipherment, server auth and client auth", strings.Join(usages, ", "))
+		recordEvent(ctx, r.Recorder, cr, core.EventTypeWarning, unissuedUsagesReason, message)
+	}
+
+	if len(r.AttributionKeys) > 0 {
+		attribution := r.attribution(ctx, log, cr)
+		ctx = withAttribution(ctx, attribution)
+		log = log.WithValues("attribution", attribution)
 	}
 
 	var (
 		secretNamespaceName types.NamespacedName
 		issuerspec          v1.OriginIssuerSpec
+		issuerStatus        v1.OriginIssuerStatus
+		issuerObj           client.Object
+		issuer              metrics.Issuer
 	)
 
-	switch cr.Spec.IssuerRef.Kind {
+	issuerKind, issuerName, fallback, err := r.issuerRef(ctx, cr)
+	if err != nil {
+		log.Error(err, "failed to retrieve issuer resource")
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to retrieve %s resource %s: %v", issuerKind, issuerName, err))
+
+		return reconcile.Result{}, err
+	}
+	// The fallback is recorded before signing, so that the request is
+	// signed, and later revoked, with the same issuer whatever happens to
+	// the one it references. Nothing is signed, nor recorded, in dry run
+	// mode.
+	switch {
+	case fallback && cr.Annotations[v1.ResolvedIssuerAnnotation] == "" && r.DryRun:
+		log.Info("issuer not found, would sign with the default ClusterOriginIssuer", "default_issuer", issuerName)
+	case fallback && cr.Annotations[v1.ResolvedIssuerAnnotation] == "":
+		metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.ResolvedIssuerAnnotation, issuerKind+"/"+issuerName)
+		if err := r.Client.Update(ctx, cr); err != nil {
+			log.Error(err, "failed to record the default ClusterOriginIssuer on the certificate request")
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to record the default ClusterOriginIssuer: %v", err))
+
+			return reconcile.Result{}, err
+		}
+
+		log.Info("issuer not found, signing with the default ClusterOriginIssuer", "default_issuer", issuerName)
+		recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, defaultIssuerFallbackReason, fmt.Sprintf("%s %s not found, signing with the default ClusterOriginIssuer %s", cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name, issuerName))
+	}
+
+	switch issuerKind {
 	case "OriginIssuer":
 		iss := v1.OriginIssuer{}
 		issNamespaceName := types.NamespacedName{
 			Namespace: cr.Namespace,
-			Name:      cr.Spec.IssuerRef.Name,
+			Name:      issuerName,
 		}
 
 		if err := r.Client.Get(ctx, issNamespaceName, &iss); err != nil {
@@ -131,7 +403,7 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 			return reconcile.Result{}, err
 		}
 
-		if !IssuerStatusHasCondition(iss.Status, v1.OriginIssuerCondition{Type: v1.ConditionReady, Status: v1.ConditionTrue}) {
+		if !r.issuerReady(iss.Status) {
 			err := fmt.Errorf("resource %s is not ready", issNamespaceName)
 			log.Error(err, "issuer failed readiness checks", "namespace", issNamespaceName.Namespace, "name", issNamespaceName.Name)
 			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("OriginIssuer %s is not Ready", issNamespaceName))
@@ -141,13 +413,14 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 
 		secretNamespaceName = types.NamespacedName{
 			Namespace: iss.Namespace,
-			Name:      iss.Spec.Auth.ServiceKeyRef.Name,
+			Name:      issuerAuthSecretRef(iss.Spec.Auth).Name,
 		}
-		issuerspec = iss.Spec
+		issuerspec, issuerStatus, issuerObj = iss.Spec, iss.Status, &iss
+		issuer = metrics.Issuer{Kind: issuerKind, Namespace: iss.Namespace, Name: iss.Name}
 	case "ClusterOriginIssuer":
 		iss := v1.ClusterOriginIssuer{}
 		issNamespaceName := types.NamespacedName{
-			Name: cr.Spec.IssuerRef.Name,
+			Name: issuerName,
 		}
 
 		if err := r.Client.Get(ctx, issNamespaceName, &iss); err != nil {
@@ -157,7 +430,7 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 			return reconcile.Result{}, err
 		}
 
-		if !IssuerStatusHasCondition(iss.Status, v1.OriginIssuerCondition{Type: v1.ConditionReady, Status: v1.ConditionTrue}) {
+		if !r.issuerReady(iss.Status) {
 			err := fmt.Errorf("resource %s is not ready", issNamespaceName)
 			log.Error(err, "issuer failed readiness checks", "namespace", issNamespaceName.Namespace, "name", issNamespaceName.Name)
 			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("OriginIssuer %s is not Ready", issNamespaceName))
@@ -165,48 +438,151 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 			return reconcile.Result{}, err
 		}
 
+		allowed, err := namespaceAllowed(ctx, r.Client, iss.Spec.AllowedNamespaces, cr.Namespace)
+		if err != nil {
+			log.Error(err, "failed to check the namespace is allowed by the ClusterOriginIssuer", "name", iss.Name)
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to check namespace %s is allowed by ClusterOriginIssuer %s: %v", cr.Namespace, iss.Name, err))
+
+			return reconcile.Result{}, err
+		}
+		if !allowed {
+			message := fmt.Sprintf("ClusterOriginIssuer %s does not allow CertificateRequests from namespace %s", iss.Name, cr.Namespace)
+			log.Info("namespace not allowed by the ClusterOriginIssuer", "name", iss.Name)
+
+			if cr.Status.FailureTime == nil {
+				nowTime := metav1.NewTime(r.Clock.Now())
+				cr.Status.FailureTime = &nowTime
+			}
+
+			SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, namespaceNotAllowedReason, withCorrelationIDMessage(ctx, message))
+			return reconcile.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, message)
+		}
+
 		secretNamespaceName = types.NamespacedName{
 			Namespace: r.ClusterResourceNamespace,
-			Name:      iss.Spec.Auth.ServiceKeyRef.Name,
+			Name:      issuerAuthSecretRef(iss.Spec.Auth).Name,
 		}
-		issuerspec = iss.Spec
+		issuerspec, issuerStatus, issuerObj = iss.Spec, iss.Status, &iss
+		issuer = metrics.Issuer{Kind: issuerKind, Name: iss.Name}
 	default:
 		err := fmt.Errorf("unknown issuer kind: %s", cr.Spec.IssuerRef.Kind)
 		log.Error(err, "certificate request references unknown issuer kind", "namespace", cr.Namespace, "name", cr.Name)
 		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Unknown issuer kind: %s", cr.Spec.IssuerRef.Kind))
 
-		return reconcile.Result{}, err
+		// The issuerRef is immutable, so retrying will never succeed.
+		return reconcile.Result{}, reconcile.TerminalError(err)
 	}
+	issuer.Tenant = r.tenant(ctx, log, cr.Namespace)
 
-	var secret core.Secret
-	if err := r.Reader.Get(ctx, secretNamespaceName, &secret); err != nil {
-		log.Error(err, "failed to retieve OriginIssuer auth secret", "namespace", secretNamespaceName.Namespace, "name", secretNamespaceName.Name)
-		if apierrors.IsNotFound(err) {
+	// Issuers rolling out a changed configuration sign only a percentage of
+	// requests with it, and the rest with their stable configuration.
+	issuerspec, canary := canarySpec(issuerspec, issuerStatus, issuerObj.GetGeneration(), cr.UID)
+	secretNamespaceName.Name = issuerAuthSecretRef(issuerspec.Auth).Name
+
+	if len(issuerspec.Auth.Zones) > 0 {
+		var err error
+		issuerspec, err = zoneCredentialSpec(issuerspec, cr)
+		if err != nil {
+			log.Error(err, "failed to select the zone credential of the certificate request")
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to select credentials: %v", err))
+
+			return reconcile.Result{}, reconcile.TerminalError(err)
+		}
+		secretNamespaceName.Name = issuerAuthSecretRef(issuerspec.Auth).Name
+	}
+
+	// Credentials exchanged for a ServiceAccount token or read from Vault
+	// change outside of Secrets, so only the rejections of credentials
+	// stored in Secrets are remembered.
+	var (
+		creds      cfapi.Credentials
+		failureKey authFailureKey
+	)
+	if hasExternalCredentials(issuerspec.Auth) {
+		var err error
+		creds, err = externalCredentials(ctx, r.Exchanger, r.Vault, issuerspec, secretNamespaceName.Namespace)
+		if err != nil {
+			var cerr *credentialsError
+			errors.As(err, &cerr)
+			log.Error(err, "failed to retrieve issuer credentials")
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, cerr.Reason, cerr.Message())
+
+			return reconcile.Result{}, err
+		}
+	} else {
+		var secret core.Secret
+		if err := r.Reader.Get(ctx, secretNamespaceName, &secret); err != nil {
+			log.Error(err, "failed to retieve OriginIssuer auth secret", "namespace", secretNamespaceName.Namespace, "name", secretNamespaceName.Name)
+			if apierrors.IsNotFound(err) {
+				_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+			} else {
+				_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, "Error", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+			}
+
+			return reconcile.Result{}, err
+		}
+
+		secretRef := issuerAuthSecretRef(issuerspec.Auth)
+		credential, ok := secret.Data[secretRef.Key]
+		if !ok {
+			err := &secretKeyError{Secret: secret.Name, Key: secretRef.Key}
+			log.Error(err, "failed to retrieve OriginIssuer auth secret")
 			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
-		} else {
-			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, "Error", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+
+			return reconcile.Result{}, err
 		}
 
-		return reconcile.Result{}, err
+		failureKey = authFailureKey{Secret: secretNamespaceName, ResourceVersion: secret.ResourceVersion}
+		if err := r.authFailures.get(failureKey, r.Clock.Now()); err != nil {
+			log.Info("credentials were recently rejected by the Cloudflare API, not signing", "secret", secretNamespaceName, "error", err.Error())
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: credentials were recently rejected by the Cloudflare API: %v", err))
+
+			return reconcile.Result{}, reconcile.TerminalError(err)
+		}
+
+		creds = issuerCredentials(issuerspec, credential)
 	}
 
-	serviceKey, ok := secret.Data[issuerspec.Auth.ServiceKeyRef.Key]
-	if !ok {
-		err := fmt.Errorf("secret %s does not contain key %q", secret.Name, issuerspec.Auth.ServiceKeyRef.Key)
-		log.Error(err, "failed to retrieve OriginIssuer auth secret")
-		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+	c, err := r.Factory.APIWith(creds)
+	if err != nil {
+		log.Error(err, "failed to create API client")
 
 		return reconcile.Result{}, err
 	}
 
-	c, err := r.Factory.APIWith(serviceKey)
+	lookup, err := zoneLookupAPI(ctx, r.Reader, r.Factory, issuerspec, secretNamespaceName.Namespace, c)
 	if err != nil {
-		log.Error(err, "failed to create API client")
+		log.Error(err, "failed to retrieve the verification token of the issuer")
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to retrieve verification token: %v", err))
 
 		return reconcile.Result{}, err
 	}
 
-	p, err := provisioners.New(c, issuerspec.RequestType, log)
+	opts, err := issuerProvisionerOptions(issuerspec, c, lookup, r.DefaultDuration, r.Clock)
+	if err != nil {
+		log.Error(err, "failed to resolve zones")
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+	opts = append(opts, provisioners.WithDryRun(r.DryRun))
+
+	// The certificates of earlier revisions of the Certificate are renewed,
+	// rather than duplicated, by the request, and are the only ones it
+	// supersedes.
+	var revisions []*certmanager.CertificateRequest
+	if issuerspec.DuplicatePolicy == v1.DuplicatePolicyFail || issuerspec.DuplicatePolicy == v1.DuplicatePolicyReuse || issuerspec.RevokeSuperseded {
+		revisions, err = r.earlierRevisions(ctx, cr)
+		if err != nil {
+			log.Error(err, "failed to list earlier revisions of the certificate request")
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to list earlier revisions: %v", err))
+
+			return reconcile.Result{}, err
+		}
+		opts = append(opts, provisioners.WithPreviousCertificates(certificateIDs(revisions)...))
+	}
+
+	p, err := provisioners.New(c, issuerspec.RequestType, log, opts...)
 	if err != nil {
 		log.Error(err, "failed to create provisioner")
 
@@ -215,32 +591,818 @@ func (r *CertificateRequestController) Reconcile(ctx context.Context, cr *certma
 		return reconcile.Result{}, err
 	}
 
-	pem, err := p.Sign(ctx, cr)
+	// The certificate of a previous revision is only reused once the request
+	// passes the issuer's policies, such as its allowed hostnames, key type
+	// and zones, with the credential it would be signed with. Requests which
+	// don't are left to signing, which reports why.
+	if r.ReuseCertificates && !r.DryRun {
+		if prev := r.reusable(ctx, log, cr, issuerspec); prev != nil {
+			if err := p.Check(cfapi.WithMetadata(ctx, requestMetadata(ctx, cr)), cr); err == nil {
+				return reconcile.Result{}, r.reuse(ctx, log, cr, prev)
+			}
+		}
+	}
+
+	var chain [][]byte
+	if issuerspec.IncludeChain && !r.DryRun {
+		chain, err = r.chain(ctx, p.RequestTypes())
+		if err != nil {
+			log.Error(err, "failed to get Origin CA certificates for the chain")
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to get Origin CA certificates for the chain: %v", err))
 
-	var apiError *cfapi.APIError
-	if errors.As(err, &apiError) {
-		if apiError.Code == originDBWriteErrorCode {
-			log.Error(err, "requeue-ing after API error")
 			return reconcile.Result{}, err
 		}
 	}
 
+	signCtx := cfapi.WithMetadata(ctx, requestMetadata(ctx, cr))
+	if deadline := r.signDeadline(ctx, log, cr); !deadline.IsZero() {
+		// The deadline is relative to the injected clock, which need not
+		// agree with the wall clock used by context deadlines.
+		var cancel context.CancelFunc
+		signCtx, cancel = context.WithTimeout(signCtx, deadline.Sub(r.Clock.Now()))
+		defer cancel()
+	}
+
+	// Many hostnames sharing a parent domain count against Cloudflare's
+	// hostname limit, where a wildcard would do. Decoding errors are left to
+	// signing to report.
+	if parents, _ := p.WildcardCandidates(cr); len(parents) > 0 {
+		wildcards := make([]string, 0, len(parents))
+		for _, parent := range parents {
+			wildcards = append(wildcards, "*."+parent)
+		}
+
+		if issuerspec.CollapseToWildcard {
+			recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "CollapsedToWildcard", fmt.Sprintf("Hostnames sharing a parent domain are requested as %s", strings.Join(wildcards, ",")))
+		} else {
+			recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "WildcardSuggested", fmt.Sprintf("At least %d hostnames share a parent domain, consider requesting %s instead", issuerspec.WildcardThreshold, strings.Join(wildcards, ",")))
+		}
+	}
+
+	// Certificates signed for the request, but which could not be recorded
+	// on it, are published rather than signed again.
+	var resps []*cfapi.SignResponse
+	if e, ok := r.cached(cr); ok {
+		log.Info("publishing certificates signed before they could be recorded", "id", strings.Join(e.IDs(), ","))
+		resps = cachedResponses(e)
+
+		// The issuer may have changed its request types since, so the
+		// chain is that of the cached certificates' own types.
+		if chain != nil {
+			requestTypes := make([]string, 0, len(resps))
+			for _, resp := range resps {
+				requestTypes = append(requestTypes, resp.Type)
+			}
+
+			chain, err = r.chain(ctx, requestTypes)
+			if err != nil {
+				log.Error(err, "failed to get Origin CA certificates for the chain")
+				_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Failed to get Origin CA certificates for the chain: %v", err))
+
+				return reconcile.Result{}, err
+			}
+		}
+	} else {
+		if r.Cache != nil && !r.DryRun {
+			if r.Cache.Full() {
+				log.Error(certcache.ErrFull, "not signing certificate request until cached certificates are recorded")
+				_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, "Certificate cache is full, waiting for cached certificates to be recorded")
+
+				return reconcile.Result{}, certcache.ErrFull
+			}
+
+			// The finalizer is added before signing, so that cached
+			// certificates are revoked should the request be deleted
+			// before they are recorded.
+			if r.RevokeOnDelete && !controllerutil.ContainsFinalizer(cr, v1.RevokeFinalizer) {
+				controllerutil.AddFinalizer(cr, v1.RevokeFinalizer)
+				if err := r.Client.Update(ctx, cr); err != nil {
+					log.Error(err, "failed to add revoke finalizer")
+
+					return reconcile.Result{}, err
+				}
+			}
+		}
+
+		start := r.Clock.Now()
+		resps, err = p.Sign(signCtx, cr)
+
+		// Invalid requests are rejected without calling the Cloudflare API,
+		// and would otherwise count against its error rate.
+		var dryRun *provisioners.DryRunError
+		if !errors.Is(err, provisioners.ErrInvalidRequest) && !errors.As(err, &dryRun) {
+			metrics.ObserveSign(issuer, r.Clock.Since(start), err)
+		}
+
+		// Nothing was signed in dry run mode, so there is nothing more to
+		// do.
+		if dryRun != nil {
+			return reconcile.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionTrue, "WouldSign", fmt.Sprintf("Certificate request validated: %v", err))
+		}
+	}
+
+	// Rate limits and transient errors, already retried by the API client,
+	// are requeued rather than failing a request which may yet succeed, at
+	// the time the Cloudflare API asked for where it did.
+	if delay, ok := requeueDelay(err); ok {
+		failures, _ := retryState(cr)
+		failures++
+		if r.MaxRetriesBeforeFail > 0 && failures > r.MaxRetriesBeforeFail {
+			log.Error(err, "failing certificate request after too many failed attempts", "attempts", failures)
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request after %d attempts: %v", failures, err))
+
+			return reconcile.Result{}, reconcile.TerminalError(err)
+		}
+
+		// The backoff is recorded on the request, so that it survives
+		// restarts of the controller, and users can see why it is waiting.
+		delay = retryBackoff(delay, failures)
+		next := r.Clock.Now().Add(delay)
+		setRetryState(cr, failures, next)
+		if err := r.Client.Update(ctx, cr); err != nil {
+			log.Error(err, "failed to record retry state", "attempts", failures)
+		}
+
+		// The time of the next attempt is left to the annotation, so that
+		// the message, and the events it is recorded with, hold across
+		// attempts.
+		var rateLimited *cfapi.RateLimitError
+		if errors.As(err, &rateLimited) {
+			log.Info("rate limited by the Cloudflare API, requeue-ing", "after", delay)
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Rate limited by the Cloudflare API, retrying at the time of the %s annotation", v1.NextAttemptAnnotation))
+		} else {
+			var transient *cfapi.TransientError
+			errors.As(err, &transient)
+			log.Error(err, "requeue-ing after transient API error", "attempts", transient.Attempts, "after", delay)
+			_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonPending, fmt.Sprintf("Temporary Cloudflare API error, retrying at the time of the %s annotation: %v", v1.NextAttemptAnnotation, err))
+		}
+
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+
+	// Origin CA certificates are only issued for DNS names, so requests for
+	// anything else are flagged as invalid, and will never succeed.
+	var unsupported *provisioners.UnsupportedSANError
+	if errors.As(err, &unsupported) {
+		log.Error(err, "certificate request has unsupported subject alternative names")
+		message := fmt.Sprintf("Unsupported subject alternative names: %v", unsupported.Errs.ToAggregate())
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, "UnsupportedSAN", withCorrelationIDMessage(ctx, message))
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Keys the Origin CA can't sign for, such as ECDSA keys on the P-521
+	// curve, are only rejected by the Cloudflare API with unhelpful errors,
+	// so are flagged as invalid with a hint on the supported keys.
+	var unsupportedKey *provisioners.UnsupportedKeyError
+	if errors.As(err, &unsupportedKey) {
+		log.Error(err, "certificate request has an unsupported public key")
+		message := fmt.Sprintf("Unsupported public key: %v. Use an RSA key, or an ECDSA key on the %s curve, such as with privateKey.size 256 on the Certificate", unsupportedKey.Errs.ToAggregate(), strings.Join(validation.SupportedCurves, " or "))
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, "UnsupportedKey", withCorrelationIDMessage(ctx, message))
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Keys of the other algorithm than the request type are rejected by
+	// Cloudflare with confusing errors, if at all, so are flagged with a hint
+	// on the key or issuer to use instead.
+	var mismatch *provisioners.KeyTypeMismatchError
+	if errors.As(err, &mismatch) {
+		log.Error(err, "certificate request has a public key not matching the request type", "requestType", mismatch.RequestType)
+		message := fmt.Sprintf("Public key does not match the request type: %v. Use an %s key, such as with privateKey.algorithm %s on the Certificate, or an issuer with requestType %s", err, mismatch.Expected(), mismatch.Expected(), mismatch.MatchingRequestType())
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, keyTypeMismatchReason, withCorrelationIDMessage(ctx, message))
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Hostnames outside of the issuer's allowed names and zones are a policy
+	// violation, which retrying won't fix.
+	var notAllowed *provisioners.HostnameNotAllowedError
+	if errors.As(err, &notAllowed) {
+		log.Error(err, "certificate request has hostnames not allowed by the issuer")
+		message := fmt.Sprintf("Hostnames not allowed by the issuer: %s", strings.Join(notAllowed.Hostnames, ", "))
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, hostnameNotAllowedReason, withCorrelationIDMessage(ctx, message))
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Certificates of zones that aren't active, such as paused zones, would
+	// not be served by Cloudflare, which is rarely what was intended.
+	var inactive *provisioners.ZoneInactiveError
+	if errors.As(err, &inactive) {
+		log.Error(err, "certificate request has hostnames of a zone that isn't active", "zone", inactive.Zone)
+		message := fmt.Sprintf("Cloudflare zone is not active: %v. Activate or unpause the zone, as Cloudflare does not serve the certificates of inactive zones", err)
+		SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionInvalidRequest, cmmeta.ConditionTrue, r.Log, r.Clock, zoneInactiveReason, withCorrelationIDMessage(ctx, message))
+		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
 	if err != nil {
 		log.Error(err, "failed to sign certificate request")
+		// An API token lacking a permission on the zone of a hostname may
+		// still sign for other zones, so is not cached as an auth failure.
+		var zoneErr *provisioners.ZoneError
+		if r.AuthFailureTTL > 0 && !hasExternalCredentials(issuerspec.Auth) && cfapi.IsAuthError(err) && !errors.As(err, &zoneErr) {
+			now := r.Clock.Now()
+			r.authFailures.add(failureKey, err, now, now.Add(r.AuthFailureTTL))
+		}
 		_ = r.setStatus(ctx, cr, cmmeta.ConditionFalse, certmanager.CertificateRequestReasonFailed, fmt.Sprintf("Failed to sign certificate request: %v", err))
+		if canary && canaryFailure(err) {
+			recordCanary(ctx, log, r.Client, r.Recorder, issuerObj, err)
+		}
+
+		// The CertificateRequest is now Failed, and will be ignored by any
+		// further reconciles, so avoid re-entering the queue.
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Dual-stack issuers return several certificates for the same key. Only
+	// the one of the request type is published, as cert-manager would take
+	// any following one for its chain, while the others are recorded in the
+	// DualStackCertificateAnnotation.
+	var (
+		ids, expirations, rayIDs []string
+		pem, others              bytes.Buffer
+	)
+	for i, resp := range resps {
+		ids = append(ids, resp.Id)
+		expirations = append(expirations, resp.Expiration.UTC().Format(time.RFC3339))
+		if resp.RayID != "" {
+			rayIDs = append(rayIDs, resp.RayID)
+		}
+
+		buf := &pem
+		if i > 0 {
+			buf = &others
+		}
+		cert := []byte(resp.Certificate)
+		if format := issuerspec.PEMFormat; format != nil {
+			cert = formatPEM(cert, format, pemComments(resp))
+		}
+		appendPEM(buf, cert)
+		if chain != nil {
+			cert := chain[i]
+			if format := issuerspec.PEMFormat; format != nil {
+				cert = formatPEM(cert, format, nil)
+			}
+			appendPEM(buf, cert)
+		}
+	}
+
+	// The certificates are cached until they are recorded, so that they are
+	// published rather than signed again, or revoked, should the update fail.
+	if r.Cache != nil {
+		if err := r.Cache.Put(string(cr.UID), cacheEntry(resps)); err != nil {
+			log.Error(err, "failed to cache certificate ID", "id", strings.Join(ids, ","))
+		}
+	}
+
+	err = recordSigned(ctx, r.Client, r.Reader, cr, func() {
+		metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.CertificateIDAnnotation, strings.Join(ids, ","))
+		metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.CertificateExpirationAnnotation, strings.Join(expirations, ","))
+		if len(rayIDs) > 0 {
+			metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.RayIDAnnotation, strings.Join(rayIDs, ","))
+		}
+		if others.Len() > 0 {
+			metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.DualStackCertificateAnnotation, others.String())
+		}
+		if r.RevokeOnDelete {
+			controllerutil.AddFinalizer(cr, v1.RevokeFinalizer)
+		}
+		clearRetryState(cr)
+	})
+	if err != nil {
+		log.Error(err, "failed to record certificate ID", "id", strings.Join(ids, ","))
 
 		return reconcile.Result{}, err
 	}
 
-	cr.Status.Certificate = pem
+	if r.Cache != nil {
+		if err := r.Cache.Delete(string(cr.UID)); err != nil {
+			log.Error(err, "failed to forget recorded certificate", "id", strings.Join(ids, ","))
+		}
+	}
+
+	if issuerspec.DuplicatePolicy == v1.DuplicatePolicyReuse {
+		r.releaseReused(ctx, log, cr, revisions, ids)
+	}
+
+	cr.Status.Certificate = pem.Bytes()
+	if format := issuerspec.PEMFormat; format != nil {
+		cr.Status.Certificate = finishPEM(cr.Status.Certificate, format)
+	}
+	cr.Status.CA = r.ca(ctx, log, resps)
 	_ = r.setStatus(ctx, cr, cmmeta.ConditionTrue, certmanager.CertificateRequestReasonIssued, "Certificate issued")
+	if canary {
+		recordCanary(ctx, log, r.Client, r.Recorder, issuerObj, nil)
+	}
+
+	// Requests are only observed once issued, so that retries don't count
+	// the same approval again.
+	if r.CheckApprovedCondition {
+		if latency, ok := approvalLatency(cr); ok {
+			metrics.ObserveApproval(issuer, latency)
+		}
+	}
+	if attribution := attributionFromContext(ctx); len(attribution) > 0 {
+		metrics.ObserveAttribution(issuer, attribution, r.AttributionMetricValues)
+	}
+
+	for _, resp := range resps {
+		expiration := resp.Expiration
+		r.recordAudit(ctx, log, cr, audit.Record{
+			Action:        audit.ActionIssued,
+			CertificateID: resp.Id,
+			RequestType:   resp.Type,
+			Hostnames:     resp.Hostnames,
+			Expiration:    &expiration,
+			RayID:         resp.RayID,
+		})
+	}
+
+	if cr.Spec.Duration == nil {
+		recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "DefaultDuration", fmt.Sprintf("No duration requested, issued with the default validity of %d days", resps[0].Validity))
+	}
+
+	// Superseded certificates are revoked once the new ones are recorded.
+	// Failures are only reported, as the request was issued; certificates
+	// left behind are revoked when the hostnames are next renewed.
+	revokeCtx := cfapi.WithMetadata(ctx, requestMetadata(ctx, cr))
+	if r.RevokeDryRun {
+		superseded, err := p.Superseded(revokeCtx, resps)
+		if len(superseded) > 0 {
+			metrics.ObserveRevocations(issuer, metrics.RevocationSuperseded, true, len(superseded))
+			recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "WouldRevokeSuperseded", fmt.Sprintf("Dry run, would revoke superseded Origin CA certificates %s", strings.Join(superseded, ",")))
+		}
+		for _, id := range superseded {
+			r.recordAudit(ctx, log, cr, audit.Record{Action: audit.ActionRevoked, Reason: metrics.RevocationSuperseded, DryRun: true, CertificateID: id})
+		}
+		if err != nil {
+			log.Error(err, "failed to list superseded certificates")
+			recordEvent(ctx, r.Recorder, cr, core.EventTypeWarning, "RevokeSupersededFailed", fmt.Sprintf("Failed to list superseded Origin CA certificates: %v", err))
+		}
+
+		return reconcile.Result{}, nil
+	}
+
+	revoked, err := p.RevokeSuperseded(revokeCtx, resps)
+	if len(revoked) > 0 {
+		metrics.ObserveRevocations(issuer, metrics.RevocationSuperseded, false, len(revoked))
+		recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "RevokedSuperseded", fmt.Sprintf("Revoked superseded Origin CA certificates %s", strings.Join(revoked, ",")))
+	}
+	for _, id := range revoked {
+		r.recordAudit(ctx, log, cr, audit.Record{Action: audit.ActionRevoked, Reason: metrics.RevocationSuperseded, CertificateID: id})
+	}
+	if err != nil {
+		log.Error(err, "failed to revoke superseded certificates")
+		recordEvent(ctx, r.Recorder, cr, core.EventTypeWarning, "RevokeSupersededFailed", fmt.Sprintf("Failed to revoke superseded Origin CA certificates: %v", err))
+	}
 
 	return reconcile.Result{}, nil
 }
 
+// ca returns the roots of the Origin CAs that signed the certificates, in the
+// same order. Without a root for every certificate no CA is returned; the
+// request is not failed, as its certificates were already issued.
+func (r *CertificateRequestController) ca(ctx context.Context, log logr.Logger, resps []*cfapi.SignResponse) []byte {
+	if !r.PopulateCA || r.Roots == nil {
+		return nil
+	}
+
+	var ca []byte
+	for _, resp := range resps {
+		root, err := r.Roots.Root(ctx, resp.Type)
+		if err != nil {
+			log.Error(err, "failed to get Origin CA root, not setting CA of certificate request")
+
+			return nil
+		}
+
+		ca = append(ca, root...)
+	}
+
+	return ca
+}
+
+// chain returns the Origin CA certificates of the request types, in the same
+// order. They are fetched before signing, so that a missing certificate
+// delays the request rather than issuing a certificate without its chain.
+func (r *CertificateRequestController) chain(ctx context.Context, requestTypes []string) ([][]byte, error) {
+	if r.Roots == nil {
+		return nil, errors.New("no source of Origin CA certificates is configured")
+	}
+
+	chain := make([][]byte, 0, len(requestTypes))
+	for _, requestType := range requestTypes {
+		root, err := r.Roots.Root(ctx, requestType)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, root)
+	}
+
+	return chain, nil
+}
+
+// cached returns the certificates cached for the CertificateRequest, signed
+// but not yet recorded on it.
+func (r *CertificateRequestController) cached(cr *certmanager.CertificateRequest) (certcache.Entry, bool) {
+	if r.Cache == nil || r.DryRun {
+		return certcache.Entry{}, false
+	}
+
+	return r.Cache.Get(string(cr.UID))
+}
+
+// cacheEntry returns the cache entry of signed certificates.
+func cacheEntry(resps []*cfapi.SignResponse) certcache.Entry {
+	var e certcache.Entry
+	for _, resp := range resps {
+		e.Certificates = append(e.Certificates, certcache.Certificate{
+			ID:          resp.Id,
+			Certificate: resp.Certificate,
+			Type:        resp.Type,
+			Hostnames:   resp.Hostnames,
+			Expiration:  resp.Expiration,
+			Validity:    resp.Validity,
+		})
+	}
+
+	return e
+}
+
+// cachedResponses returns the signed certificates of a cache entry.
+func cachedResponses(e certcache.Entry) []*cfapi.SignResponse {
+	resps := make([]*cfapi.SignResponse, 0, len(e.Certificates))
+	for _, cert := range e.Certificates {
+		resps = append(resps, &cfapi.SignResponse{
+			Id:          cert.ID,
+			Certificate: cert.Certificate,
+			Type:        cert.Type,
+			Hostnames:   cert.Hostnames,
+			Expiration:  cert.Expiration,
+			Validity:    cert.Validity,
+		})
+	}
+
+	return resps
+}
+
+// appendPEM appends PEM data to buf, on a new line.
+func appendPEM(buf *bytes.Buffer, data []byte) {
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+
+	buf.Write(data)
+}
+
+// finalize revokes the Origin CA certificate of a deleted CertificateRequest
+// and removes the revoke finalizer. If the issuer or its credential are gone
+// the certificate can no longer be revoked, so the finalizer is removed anyway
+// rather than blocking deletion forever. Certificates missing from the
+// CertificateRequest's annotations are looked up in the cache. In dry run
+// mode the certificates are only reported.
+func (r *CertificateRequestController) finalize(ctx context.Context, log logr.Logger, cr *certmanager.CertificateRequest) error {
+	if !controllerutil.ContainsFinalizer(cr, v1.RevokeFinalizer) {
+		return nil
+	}
+
+	ids := cr.Annotations[v1.CertificateIDAnnotation]
+	if ids == "" && r.Cache != nil {
+		if e, ok := r.Cache.Get(string(cr.UID)); ok {
+			ids = strings.Join(e.IDs(), ",")
+		}
+	}
+
+	m := requestMetadata(ctx, cr)
+	issuer := metrics.Issuer{Kind: m.IssuerKind, Namespace: m.IssuerNamespace, Name: m.IssuerName, Tenant: r.tenant(ctx, log, cr.Namespace)}
+
+	switch {
+	case ids == "":
+	case r.RevokeDryRun:
+		log.Info("dry run, not revoking certificate", "id", ids)
+		for _, id := range strings.Split(ids, ",") {
+			metrics.ObserveRevocations(issuer, metrics.RevocationDeleted, true, 1)
+			recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "WouldRevoke", fmt.Sprintf("Dry run, would revoke certificate %s", id))
+			r.recordAudit(ctx, log, cr, audit.Record{Action: audit.ActionRevoked, Reason: metrics.RevocationDeleted, DryRun: true, CertificateID: id})
+		}
+	default:
+		c, err := r.issuerAPI(ctx, cr)
+		var missingKey *secretKeyError
+		switch {
+		case apierrors.IsNotFound(err), errors.As(err, &missingKey):
+			log.Info("unable to revoke certificate, issuer or its credential no longer exists", "id", ids, "error", err.Error())
+		case err != nil:
+			log.Error(err, "failed to create API client to revoke certificate", "id", ids)
+
+			return err
+		default:
+			ctx := cfapi.WithMetadata(ctx, m)
+			for _, id := range strings.Split(ids, ",") {
+				if err := c.Revoke(ctx, id); err != nil {
+					log.Error(err, "failed to revoke certificate", "id", id)
+					recordEvent(ctx, r.Recorder, cr, core.EventTypeWarning, "RevokeFailed", fmt.Sprintf("Failed to revoke certificate %s: %v", id, err))
+
+					return err
+				}
+
+				metrics.ObserveRevocations(issuer, metrics.RevocationDeleted, false, 1)
+				recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "Revoked", fmt.Sprintf("Certificate %s revoked", id))
+				r.recordAudit(ctx, log, cr, audit.Record{Action: audit.ActionRevoked, Reason: metrics.RevocationDeleted, CertificateID: id})
+			}
+
+			if r.Cache != nil {
+				if err := r.Cache.Delete(string(cr.UID)); err != nil {
+					log.Error(err, "failed to forget revoked certificate", "id", ids)
+				}
+			}
+		}
+	}
+
+	controllerutil.RemoveFinalizer(cr, v1.RevokeFinalizer)
+
+	return r.Client.Update(ctx, cr)
+}
+
+// recordAudit completes an audit record with the CertificateRequest and its
+// issuer, and records it. Failures are only logged, as the certificate was
+// already issued or revoked.
+func (r *CertificateRequestController) recordAudit(ctx context.Context, log logr.Logger, cr *certmanager.CertificateRequest, rec audit.Record) {
+	if r.Audit == nil {
+		return
+	}
+
+	rec.Time = r.Clock.Now().UTC()
+	rec.Namespace = cr.Namespace
+	rec.CertificateRequest = cr.Name
+	rec.UID = cr.UID
+	rec.CorrelationID = correlationIDFromContext(ctx)
+	rec.IssuerKind = cr.Spec.IssuerRef.Kind
+	rec.IssuerName = cr.Spec.IssuerRef.Name
+	rec.Tenant = r.tenant(ctx, log, cr.Namespace)
+	rec.Attribution = attributionFromContext(ctx)
+
+	if err := r.Audit.Record(ctx, rec); err != nil {
+		log.Error(err, "failed to record audit record", "action", rec.Action, "id", rec.CertificateID)
+	}
+}
+
+// tenant returns the value of the TenantKey annotation of the namespace, or
+// else of its label. Failing to read the namespace is only logged, leaving
+// the tenant empty, as it doesn't affect signing.
+func (r *CertificateRequestController) tenant(ctx context.Context, log logr.Logger, namespace string) string {
+	if r.TenantKey == "" {
+		return ""
+	}
+
+	var ns core.Namespace
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "failed to retrieve namespace to find its tenant", "key", r.TenantKey)
+		}
+
+		return ""
+	}
+
+	if tenant, ok := ns.Annotations[r.TenantKey]; ok {
+		return tenant
+	}
+
+	return ns.Labels[r.TenantKey]
+}
+
+// issuerAPI returns an API client authenticated with the credentials of the
+// issuer referenced by the CertificateRequest, regardless of the issuer's
+// readiness.
+func (r *CertificateRequestController) issuerAPI(ctx context.Context, cr *certmanager.CertificateRequest) (cfapi.Interface, error) {
+	var (
+		spec            v1.OriginIssuerSpec
+		secretNamespace string
+	)
+
+	kind, name, _, err := r.issuerRef(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "OriginIssuer":
+		iss := v1.OriginIssuer{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: name}, &iss); err != nil {
+			return nil, err
+		}
+
+		spec, secretNamespace = iss.Spec, iss.Namespace
+	case "ClusterOriginIssuer":
+		iss := v1.ClusterOriginIssuer{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: name}, &iss); err != nil {
+			return nil, err
+		}
+
+		spec, secretNamespace = iss.Spec, r.ClusterResourceNamespace
+	default:
+		return nil, fmt.Errorf("unknown issuer kind: %s", cr.Spec.IssuerRef.Kind)
+	}
+
+	spec, err = zoneCredentialSpec(spec, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasExternalCredentials(spec.Auth) {
+		creds, err := externalCredentials(ctx, r.Exchanger, r.Vault, spec, secretNamespace)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.Factory.APIWith(creds)
+	}
+
+	secretRef := issuerAuthSecretRef(spec.Auth)
+
+	var secret core.Secret
+	if err := r.Reader.Get(ctx, types.NamespacedName{Namespace: secretNamespace, Name: secretRef.Name}, &secret); err != nil {
+		return nil, err
+	}
+
+	credential, ok := secret.Data[secretRef.Key]
+	if !ok {
+		return nil, &secretKeyError{Secret: secret.Name, Key: secretRef.Key}
+	}
+
+	return r.Factory.APIWith(issuerCredentials(spec, credential))
+}
+
+// requestMetadata identifies the CertificateRequest, the issuer it
+// references, and the reconcile, to middlewares of API calls made on its
+// behalf.
+func requestMetadata(ctx context.Context, cr *certmanager.CertificateRequest) cfapi.Metadata {
+	m := cfapi.Metadata{
+		CorrelationID:   correlationIDFromContext(ctx),
+		IssuerKind:      cr.Spec.IssuerRef.Kind,
+		IssuerName:      cr.Spec.IssuerRef.Name,
+		ObjectKind:      certmanager.CertificateRequestKind,
+		ObjectNamespace: cr.Namespace,
+		ObjectName:      cr.Name,
+		ObjectUID:       cr.UID,
+		Attribution:     attributionFromContext(ctx),
+	}
+
+	if m.IssuerKind == "OriginIssuer" {
+		m.IssuerNamespace = cr.Namespace
+	}
+
+	return m
+}
+
+// signDeadline returns the time after which signing the CertificateRequest
+// should be abandoned, or the zero time if there is none. Calls are bounded by
+// SignTimeout and, if the CertificateRequest is owned by a Certificate, by the
+// expiry of that Certificate's current certificate: a renewal stalled past
+// that point is better served by the newer CertificateRequest cert-manager
+// will create once this one fails.
+func (r *CertificateRequestController) signDeadline(ctx context.Context, log logr.Logger, cr *certmanager.CertificateRequest) time.Time {
+	now := r.Clock.Now()
+
+	var deadline time.Time
+	if r.SignTimeout > 0 {
+		deadline = now.Add(r.SignTimeout)
+	}
+
+	owner := metav1.GetControllerOf(cr)
+	if owner == nil || owner.Kind != certmanager.CertificateKind || owner.APIVersion != certmanager.SchemeGroupVersion.String() {
+		return deadline
+	}
+
+	var cert certmanager.Certificate
+	if err := r.Reader.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: owner.Name}, &cert); err != nil {
+		log.V(4).Info("unable to retrieve owning Certificate, ignoring its renewal deadline", "certificate", owner.Name, "error", err.Error())
+
+		return deadline
+	}
+
+	if cert.Status.NotAfter == nil || !cert.Status.NotAfter.Time.After(now) {
+		return deadline
+	}
+
+	if deadline.IsZero() || cert.Status.NotAfter.Time.Before(deadline) {
+		deadline = cert.Status.NotAfter.Time
+	}
+
+	return deadline
+}
+
+// issuerReady reports whether an issuer may sign CertificateRequests, being
+// Ready, or, in dry run mode, having passed its dry run.
+func (r *CertificateRequestController) issuerReady(status v1.OriginIssuerStatus) bool {
+	conditionType := v1.ConditionReady
+	if r.DryRun {
+		conditionType = v1.ConditionDryRun
+	}
+
+	return IssuerStatusHasCondition(status, metav1.Condition{Type: conditionType, Status: v1.ConditionTrue})
+}
+
+// IssuerToRequests maps an OriginIssuer or ClusterOriginIssuer to reconcile
+// requests for every incomplete CertificateRequest referencing it, so requests
+// waiting on an issuer are retried as soon as it changes. The default
+// ClusterOriginIssuer is also referenced by its alias.
+func (r *CertificateRequestController) IssuerToRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	var lists [][]client.ListOption
+
+	switch obj.(type) {
+	case *v1.OriginIssuer:
+		lists = append(lists, []client.ListOption{
+			client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{CertificateRequestIssuerIndex: issuerRefIndexValue("OriginIssuer", obj.GetName())},
+		})
+	case *v1.ClusterOriginIssuer:
+		lists = append(lists, []client.ListOption{
+			client.MatchingFields{CertificateRequestIssuerIndex: issuerRefIndexValue("ClusterOriginIssuer", obj.GetName())},
+		})
+		if r.DefaultClusterIssuer != "" && obj.GetName() == r.DefaultClusterIssuer {
+			lists = append(lists, []client.ListOption{
+				client.MatchingFields{CertificateRequestIssuerIndex: issuerRefIndexValue("ClusterOriginIssuer", DefaultClusterIssuerAlias)},
+			})
+		}
+	default:
+		return nil
+	}
+
+	var items []certmanager.CertificateRequest
+	for _, opts := range lists {
+		var crs certmanager.CertificateRequestList
+		if err := r.Client.List(ctx, &crs, opts...); err != nil {
+			r.Log.Error(err, "failed to list CertificateRequests referencing issuer", "namespace", obj.GetNamespace(), "name", obj.GetName())
+
+			return nil
+		}
+		items = append(items, crs.Items...)
+	}
+
+	requests := make([]reconcile.Request, 0, len(items))
+	for _, cr := range items {
+		if issued(&cr) || cr.Status.FailureTime != nil {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: cr.Namespace,
+				Name:      cr.Name,
+			},
+		})
+	}
+
+	return requests
+}
+
 // setStatus is a helper function to set the CertifcateRequest status condition with reason and message, and update the API.
+// An event is recorded with the same reason and message. The condition message carries the correlation ID of the reconcile,
+// and the event its annotation, except that a condition repeating the previous one keeps its ID, as updating the status
+// would trigger yet another reconcile.
+// In dry run mode, the DryRun condition is set instead, and any other change to the status is discarded.
 func (r *CertificateRequestController) setStatus(ctx context.Context, cr *certmanager.CertificateRequest, status cmmeta.ConditionStatus, reason, message string) error {
-	cmutil.SetCertificateRequestCondition(cr, certmanager.CertificateRequestConditionReady, status, reason, message)
+	message = r.MessageTemplates.render(MessageData{
+		Reason:     reason,
+		Message:    message,
+		Kind:       "CertificateRequest",
+		Namespace:  cr.Namespace,
+		Name:       cr.Name,
+		IssuerKind: cr.Spec.IssuerRef.Kind,
+		IssuerName: cr.Spec.IssuerRef.Name,
+	})
+
+	eventType := core.EventTypeWarning
+	if status == cmmeta.ConditionTrue {
+		eventType = core.EventTypeNormal
+	}
+	recordEvent(ctx, r.Recorder, cr, eventType, reason, message)
+	message = withCorrelationIDMessage(ctx, message)
+
+	conditionType := certmanager.CertificateRequestConditionReady
+	if r.DryRun {
+		latest := &certmanager.CertificateRequest{}
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(cr), latest); err != nil {
+			return err
+		}
+		cr = latest
+		conditionType = dryRunCondition
+	}
+
+	for _, c := range cr.Status.Conditions {
+		if c.Type == conditionType && c.Status == status && c.Reason == reason && trimCorrelationID(c.Message) == trimCorrelationID(message) {
+			message = c.Message
+		}
+	}
+	SetCertificateRequestCondition(cr, conditionType, status, r.Log, r.Clock, reason, message)
 
 	return r.Client.Status().Update(ctx, cr)
 }
@@ -0,0 +1,207 @@
+//go:build suite
+// +build suite
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi/fake"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// TestCertificateRequestFakeAPISuite signs CertificateRequests end to end,
+// with the controllers calling a fake of the Cloudflare API through the real
+// API client.
+func TestCertificateRequestFakeAPISuite(t *testing.T) {
+	srv := fake.NewServer(issuertesting.ServiceKey)
+	defer srv.Close()
+
+	mgr, err := manager.New(cfg, manager.Options{
+		Metrics: metricsserver.Options{
+			BindAddress: "0",
+		},
+		Scheme: scheme.Scheme,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := mgr.GetClient()
+
+	endpoint, err := cfapi.WithEndpoint(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := cfapi.NewRateLimiter()
+	retry := cfapi.DefaultRetryPolicy()
+	retry.BaseDelay = 10 * time.Millisecond
+	f := cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+		return cfapi.New(creds, cfapi.WithClient(srv.Client()), endpoint, cfapi.WithRateLimiter(limiter), cfapi.WithRetryPolicy(retry)), nil
+	})
+
+	issuerController := &OriginIssuerController{
+		Client:   c,
+		Reader:   c,
+		Clock:    clock.RealClock{},
+		Factory:  f,
+		Recorder: mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:      logf.Log,
+	}
+	if err := builder.ControllerManagedBy(mgr).
+		For(&v1.OriginIssuer{}).
+		Complete(reconcile.AsReconciler(c, issuerController)); err != nil {
+		t.Fatal(err)
+	}
+
+	crController := &CertificateRequestController{
+		Client:         c,
+		Reader:         c,
+		Clock:          clock.RealClock{},
+		Factory:        f,
+		Recorder:       mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:            logf.Log,
+		RevokeOnDelete: true,
+	}
+	if err := builder.ControllerManagedBy(mgr).
+		For(&cmapi.CertificateRequest{}).
+		Complete(reconcile.AsReconciler(c, crController)); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel, errChan := StartTestManager(mgr, t)
+	defer func() {
+		cancel()
+		if err := <-errChan; err != nil {
+			t.Fatalf("error starting test manager: %v", err)
+		}
+	}()
+
+	ctx := context.TODO()
+	secret := issuertesting.ServiceKeySecret("default")
+	if err := c.Create(ctx, secret); err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+	defer c.Delete(ctx, secret)
+
+	issuer := issuertesting.OriginIssuer("default", "fake-api", issuertesting.SetIssuerSpec(issuerclient.WithRequestType(v1.RequestTypeOriginECC)))
+	issuer.Status = v1.OriginIssuerStatus{}
+	if err := c.Create(ctx, issuer); err != nil {
+		t.Fatalf("error creating issuer: %v", err)
+	}
+	defer c.Delete(ctx, issuer)
+
+	Eventually(t, func() bool {
+		var iss v1.OriginIssuer
+		if err := c.Get(ctx, client.ObjectKeyFromObject(issuer), &iss); err != nil {
+			return false
+		}
+
+		return IssuerStatusHasCondition(iss.Status, metav1.Condition{Type: v1.ConditionReady, Status: v1.ConditionTrue})
+	}, 5*time.Second, 10*time.Millisecond, "OriginIssuer verified against the fake API")
+
+	root, err := srv.Root("origin-ecc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(root)
+
+	issued := func(cr *cmapi.CertificateRequest) func() bool {
+		return func() bool {
+			var got cmapi.CertificateRequest
+			if err := c.Get(ctx, client.ObjectKeyFromObject(cr), &got); err != nil {
+				return false
+			}
+
+			return cmutil.CertificateRequestHasCondition(&got, cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionTrue,
+			})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		faults []fake.Fault
+	}{
+		{
+			name: "signed",
+		},
+		{
+			name:   "transient error retried",
+			faults: []fake.Fault{fake.DBWriteError()},
+		},
+		{
+			name:   "rate limited",
+			faults: []fake.Fault{fake.RateLimited(time.Second)},
+		},
+	}
+
+	for i, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv.Fail(http.MethodPost, tt.faults...)
+
+			cr := issuertesting.CertificateRequest("default", "fake-api-"+string(rune('a'+i)),
+				issuertesting.SetCertificateRequestOriginIssuer(issuer.Name),
+			)
+			if err := c.Create(ctx, cr); err != nil {
+				t.Fatalf("error creating certificate request: %v", err)
+			}
+
+			Eventually(t, issued(cr), 10*time.Second, 10*time.Millisecond, "CertificateRequest issued")
+
+			var got cmapi.CertificateRequest
+			if err := c.Get(ctx, client.ObjectKeyFromObject(cr), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			block, _ := pem.Decode(got.Status.Certificate)
+			if block == nil {
+				t.Fatalf("certificate is not PEM encoded: %q", got.Status.Certificate)
+			}
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com"}); err != nil {
+				t.Fatalf("certificate not signed by the fake Origin CA: %v", err)
+			}
+
+			id := got.Annotations[v1.CertificateIDAnnotation]
+			if err := c.Delete(ctx, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			Eventually(t, func() bool {
+				for _, revoked := range srv.Revoked() {
+					if revoked == id {
+						return true
+					}
+				}
+
+				return false
+			}, 5*time.Second, 10*time.Millisecond, "certificate revoked once its CertificateRequest is deleted")
+		})
+	}
+}
@@ -2,7 +2,17 @@ package controllers
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,14 +22,23 @@ import (
 	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/audit"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/certcache"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	fakeClock "k8s.io/utils/clock/testing"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -36,24 +55,27 @@ func TestCertificateRequestReconcile(t *testing.T) {
 	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
 	now := metav1.NewTime(clock.Now())
 
-	cmutil.Clock = clock
-
 	tests := []struct {
 		name          string
 		objects       []runtime.Object
 		signer        SignerFunc
 		expected      cmapi.CertificateRequestStatus
+		checkApproved bool
 		error         string
+		terminal      bool
+		result        reconcile.Result
+		events        []string
 		namespaceName types.NamespacedName
 	}{
 		{
-			name: "working OriginIssuer",
+			name:   "working OriginIssuer",
+			events: []string{"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
 			objects: []runtime.Object{
 				cmgen.CertificateRequest("foobar",
 					cmgen.SetCertificateRequestNamespace("default"),
 					cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
 					cmgen.SetCertificateRequestCSR((func() []byte {
-						csr, _, err := cmgen.CSR(x509.ECDSA)
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
 						if err != nil {
 							t.Fatalf("creating CSR: %s", err)
 						}
@@ -80,7 +102,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						},
 					},
 					Status: v1.OriginIssuerStatus{
-						Conditions: []v1.OriginIssuerCondition{
+						Conditions: []metav1.Condition{
 							{
 								Type:   v1.ConditionReady,
 								Status: v1.ConditionTrue,
@@ -116,7 +138,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Status:             cmmeta.ConditionTrue,
 						LastTransitionTime: &now,
 						Reason:             "Issued",
-						Message:            "Certificate issued",
+						Message:            "Certificate issued (correlation ID c0ffee00)",
 					},
 				},
 				Certificate: []byte("bogus"),
@@ -127,13 +149,14 @@ func TestCertificateRequestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "working ClusterOriginIssuer",
+			name:   "working ClusterOriginIssuer",
+			events: []string{"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
 			objects: []runtime.Object{
 				cmgen.CertificateRequest("foobar",
 					cmgen.SetCertificateRequestNamespace("default"),
 					cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
 					cmgen.SetCertificateRequestCSR((func() []byte {
-						csr, _, err := cmgen.CSR(x509.ECDSA)
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
 						if err != nil {
 							t.Fatalf("creating CSR: %s", err)
 						}
@@ -159,7 +182,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						},
 					},
 					Status: v1.OriginIssuerStatus{
-						Conditions: []v1.OriginIssuerCondition{
+						Conditions: []metav1.Condition{
 							{
 								Type:   v1.ConditionReady,
 								Status: v1.ConditionTrue,
@@ -195,7 +218,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Status:             cmmeta.ConditionTrue,
 						LastTransitionTime: &now,
 						Reason:             "Issued",
-						Message:            "Certificate issued",
+						Message:            "Certificate issued (correlation ID c0ffee00)",
 					},
 				},
 				Certificate: []byte("bogus"),
@@ -206,13 +229,231 @@ func TestCertificateRequestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "requeue after API error",
+			name:   "requeue after API error",
+			events: []string{"Warning Pending Temporary Cloudflare API error, retrying at the time of the cert-manager.k8s.cloudflare.com/next-attempt annotation: unable to sign request: Cloudflare API Error code=1100 message=Failed to write certificate to Database ray_id=7d3eb086eedab98e map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
+					cmgen.SetCertificateRequestCSR((func() []byte {
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+						if err != nil {
+							t.Fatalf("creating CSR: %s", err)
+						}
+
+						return csr
+					})()),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foobar",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "service-key-issuer",
+								Key:  "key",
+							},
+						},
+					},
+					Status: v1.OriginIssuerStatus{
+						Conditions: []metav1.Condition{
+							{
+								Type:   v1.ConditionReady,
+								Status: v1.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-key-issuer",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"key": []byte("djEuMC0weDAwQkFCMTBD"),
+					},
+				},
+			},
+			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				return nil, &cfapi.TransientError{
+					Err: &cfapi.APIError{
+						Code:    1100,
+						Message: "Failed to write certificate to Database",
+						RayID:   "7d3eb086eedab98e",
+					},
+					Attempts: 4,
+				}
+			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Pending",
+						Message:            "Temporary Cloudflare API error, retrying at the time of the cert-manager.k8s.cloudflare.com/next-attempt annotation: unable to sign request: Cloudflare API Error code=1100 message=Failed to write certificate to Database ray_id=7d3eb086eedab98e (correlation ID c0ffee00)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			result: reconcile.Result{RequeueAfter: 15 * time.Second},
+		},
+		{
+			name:   "unknown issuer kind",
+			events: []string{"Warning Failed Unknown issuer kind: Issuer map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "Issuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+			},
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Failed",
+						Message:            "Unknown issuer kind: Issuer (correlation ID c0ffee00)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			error:    "terminal error: unknown issuer kind: Issuer",
+			terminal: true,
+		},
+		{
+			name:   "denied request",
+			events: []string{"Warning Denied The CertificateRequest was denied by an approval controller map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionDenied,
+						Status: cmmeta.ConditionTrue,
+						Reason: "Foo",
+					}),
+				),
+			},
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:   cmapi.CertificateRequestConditionDenied,
+						Status: cmmeta.ConditionTrue,
+						Reason: "Foo",
+					},
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Denied",
+						Message:            "The CertificateRequest was denied by an approval controller (correlation ID c0ffee00)",
+					},
+				},
+				FailureTime: &now,
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+		},
+		{
+			name:          "awaiting approval",
+			checkApproved: true,
+			events:        []string{"Warning WaitingForApproval Waiting for the CertificateRequest to be approved by an approval controller map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+			},
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "WaitingForApproval",
+						Message:            "Waiting for the CertificateRequest to be approved by an approval controller (correlation ID c0ffee00)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			result: reconcile.Result{RequeueAfter: 5 * time.Second},
+		},
+		{
+			name:          "still awaiting approval",
+			checkApproved: true,
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:    cmapi.CertificateRequestConditionReady,
+						Status:  cmmeta.ConditionFalse,
+						Reason:  "WaitingForApproval",
+						Message: "Waiting for the CertificateRequest to be approved by an approval controller (correlation ID 0ddba11)",
+					}),
+				),
+			},
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:    cmapi.CertificateRequestConditionReady,
+						Status:  cmmeta.ConditionFalse,
+						Reason:  "WaitingForApproval",
+						Message: "Waiting for the CertificateRequest to be approved by an approval controller (correlation ID 0ddba11)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			result: reconcile.Result{RequeueAfter: 5 * time.Second},
+		},
+		{
+			name:   "sign failure",
+			events: []string{"Warning Failed Failed to sign certificate request: unable to sign request: Cloudflare API Error code=1010 message=Invalid CSR ray_id=7d3eb086eedab98e map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
 			objects: []runtime.Object{
 				cmgen.CertificateRequest("foobar",
 					cmgen.SetCertificateRequestNamespace("default"),
 					cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
 					cmgen.SetCertificateRequestCSR((func() []byte {
-						csr, _, err := cmgen.CSR(x509.ECDSA)
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
 						if err != nil {
 							t.Fatalf("creating CSR: %s", err)
 						}
@@ -239,7 +480,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						},
 					},
 					Status: v1.OriginIssuerStatus{
-						Conditions: []v1.OriginIssuerCondition{
+						Conditions: []metav1.Condition{
 							{
 								Type:   v1.ConditionReady,
 								Status: v1.ConditionTrue,
@@ -259,57 +500,2747 @@ func TestCertificateRequestReconcile(t *testing.T) {
 			},
 			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
 				return nil, &cfapi.APIError{
-					Code:    1100,
-					Message: "Failed to write certificate to Database",
+					Code:    1010,
+					Message: "Invalid CSR",
 					RayID:   "7d3eb086eedab98e",
 				}
 			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Failed",
+						Message:            "Failed to sign certificate request: unable to sign request: Cloudflare API Error code=1010 message=Invalid CSR ray_id=7d3eb086eedab98e (correlation ID c0ffee00)",
+					},
+				},
+			},
 			namespaceName: types.NamespacedName{
 				Namespace: "default",
 				Name:      "foobar",
 			},
-			error: "unable to sign request: Cloudflare API Error code=1100 message=Failed to write certificate to Database ray_id=7d3eb086eedab98e",
+			error:    "terminal error: unable to sign request: Cloudflare API Error code=1010 message=Invalid CSR ray_id=7d3eb086eedab98e",
+			terminal: true,
 		},
-	}
-
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			client := fake.NewClientBuilder().
-				WithScheme(scheme.Scheme).
-				WithRuntimeObjects(tt.objects...).
-				WithStatusSubresource(&cmapi.CertificateRequest{}).
-				Build()
-
-			controller := &CertificateRequestController{
-				Client:                   client,
-				Reader:                   client,
-				ClusterResourceNamespace: "super-secret",
-				Log:                      logf.Log,
-				Factory: cfapi.FactoryFunc(func(serviceKey []byte) (cfapi.Interface, error) {
-					return tt.signer, nil
-				}),
-			}
-
-			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
-				NamespacedName: tt.namespaceName,
-			})
-
-			if err != nil {
-				assert.Error(t, err, tt.error)
-			} else {
-				assert.NilError(t, err)
-			}
-
-			got := &cmapi.CertificateRequest{}
-			assert.NilError(t, client.Get(context.TODO(), tt.namespaceName, got))
-			assert.DeepEqual(t, got.Status, tt.expected)
-		})
-	}
-}
-
-type SignerFunc func(context.Context, *cfapi.SignRequest) (*cfapi.SignResponse, error)
+		{
+			name:   "unsupported subject alternative names",
+			events: []string{"Warning Failed Failed to sign certificate request: invalid subject alternative names: spec.request.ipAddresses: Forbidden: Origin CA certificates can only be issued for DNS names map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestCSR((func() []byte {
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"), cmgen.SetCSRIPAddresses(net.ParseIP("192.0.2.1")))
+						if err != nil {
+							t.Fatalf("creating CSR: %s", err)
+						}
 
-func (f SignerFunc) Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
-	return f(ctx, req)
+						return csr
+					})()),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foobar",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "service-key-issuer",
+								Key:  "key",
+							},
+						},
+					},
+					Status: v1.OriginIssuerStatus{
+						Conditions: []metav1.Condition{
+							{
+								Type:   v1.ConditionReady,
+								Status: v1.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-key-issuer",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"key": []byte("djEuMC0weDAwQkFCMTBD"),
+					},
+				},
+			},
+			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				t.Fatal("unexpected call to the Cloudflare API")
+				return nil, nil
+			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionInvalidRequest,
+						Status:             cmmeta.ConditionTrue,
+						LastTransitionTime: &now,
+						Reason:             "UnsupportedSAN",
+						Message:            "Unsupported subject alternative names: spec.request.ipAddresses: Forbidden: Origin CA certificates can only be issued for DNS names (correlation ID c0ffee00)",
+					},
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Failed",
+						Message:            "Failed to sign certificate request: invalid subject alternative names: spec.request.ipAddresses: Forbidden: Origin CA certificates can only be issued for DNS names (correlation ID c0ffee00)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			error:    "terminal error: invalid subject alternative names: spec.request.ipAddresses: Forbidden: Origin CA certificates can only be issued for DNS names",
+			terminal: true,
+		},
+		{
+			name:   "unsupported public key",
+			events: []string{"Warning Failed Failed to sign certificate request: invalid public key: spec.request.publicKey.curve: Unsupported value: \"P-521\": supported values: \"P-256\", \"P-384\" map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestCSR((func() []byte {
+						key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+						if err != nil {
+							t.Fatalf("creating key: %s", err)
+						}
+						csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+						if err != nil {
+							t.Fatalf("creating CSR: %s", err)
+						}
+
+						return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+					})()),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foobar",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "service-key-issuer",
+								Key:  "key",
+							},
+						},
+					},
+					Status: v1.OriginIssuerStatus{
+						Conditions: []metav1.Condition{
+							{
+								Type:   v1.ConditionReady,
+								Status: v1.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-key-issuer",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"key": []byte("djEuMC0weDAwQkFCMTBD"),
+					},
+				},
+			},
+			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				t.Fatal("unexpected call to the Cloudflare API")
+				return nil, nil
+			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionInvalidRequest,
+						Status:             cmmeta.ConditionTrue,
+						LastTransitionTime: &now,
+						Reason:             "UnsupportedKey",
+						Message:            "Unsupported public key: spec.request.publicKey.curve: Unsupported value: \"P-521\": supported values: \"P-256\", \"P-384\". Use an RSA key, or an ECDSA key on the P-256 or P-384 curve, such as with privateKey.size 256 on the Certificate (correlation ID c0ffee00)",
+					},
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Failed",
+						Message:            "Failed to sign certificate request: invalid public key: spec.request.publicKey.curve: Unsupported value: \"P-521\": supported values: \"P-256\", \"P-384\" (correlation ID c0ffee00)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			error:    "terminal error: invalid public key: spec.request.publicKey.curve: Unsupported value: \"P-521\": supported values: \"P-256\", \"P-384\"",
+			terminal: true,
+		},
+		{
+			name:   "rate limited",
+			events: []string{"Warning Pending Rate limited by the Cloudflare API, retrying at the time of the cert-manager.k8s.cloudflare.com/next-attempt annotation map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
+					cmgen.SetCertificateRequestCSR((func() []byte {
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+						if err != nil {
+							t.Fatalf("creating CSR: %s", err)
+						}
+
+						return csr
+					})()),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foobar",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "service-key-issuer",
+								Key:  "key",
+							},
+						},
+					},
+					Status: v1.OriginIssuerStatus{
+						Conditions: []metav1.Condition{
+							{
+								Type:   v1.ConditionReady,
+								Status: v1.ConditionTrue,
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-key-issuer",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"key": []byte("djEuMC0weDAwQkFCMTBD"),
+					},
+				},
+			},
+			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				return nil, &cfapi.RateLimitError{RetryAfter: time.Minute}
+			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Pending",
+						Message:            "Rate limited by the Cloudflare API, retrying at the time of the cert-manager.k8s.cloudflare.com/next-attempt annotation (correlation ID c0ffee00)",
+					},
+				},
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+			result: reconcile.Result{RequeueAfter: time.Minute},
+		},
+		{
+			name:   "CA certificate",
+			events: []string{"Warning Failed The Cloudflare Origin CA does not sign CA certificates. Remove isCA from the Certificate, or use another issuer such as a cert-manager CA issuer. map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestIsCA(true),
+					cmgen.SetCertificateRequestCSR((func() []byte {
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+						if err != nil {
+							t.Fatalf("creating CSR: %s", err)
+						}
+
+						return csr
+					})()),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+			},
+			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				t.Fatal("unexpected call to the Cloudflare API")
+				return nil, nil
+			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionInvalidRequest,
+						Status:             cmmeta.ConditionTrue,
+						LastTransitionTime: &now,
+						Reason:             "UnsupportedByOriginCA",
+						Message:            "The Cloudflare Origin CA does not sign CA certificates. Remove isCA from the Certificate, or use another issuer such as a cert-manager CA issuer. (correlation ID c0ffee00)",
+					},
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Failed",
+						Message:            "The Cloudflare Origin CA does not sign CA certificates. Remove isCA from the Certificate, or use another issuer such as a cert-manager CA issuer. (correlation ID c0ffee00)",
+					},
+				},
+				FailureTime: &now,
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+		},
+		{
+			name:   "client auth only",
+			events: []string{"Warning Failed The Cloudflare Origin CA only signs server certificates, and can't sign certificates for client authentication alone. Add the \"server auth\" usage to the Certificate, or use another issuer for client certificates. map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]"},
+			objects: []runtime.Object{
+				cmgen.CertificateRequest("foobar",
+					cmgen.SetCertificateRequestNamespace("default"),
+					cmgen.SetCertificateRequestKeyUsages(cmapi.UsageDigitalSignature, cmapi.UsageClientAuth),
+					cmgen.SetCertificateRequestCSR((func() []byte {
+						csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+						if err != nil {
+							t.Fatalf("creating CSR: %s", err)
+						}
+
+						return csr
+					})()),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "foobar",
+						Kind:  "OriginIssuer",
+						Group: "cert-manager.k8s.cloudflare.com",
+					}),
+				),
+			},
+			signer: SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				t.Fatal("unexpected call to the Cloudflare API")
+				return nil, nil
+			}),
+			expected: cmapi.CertificateRequestStatus{
+				Conditions: []cmapi.CertificateRequestCondition{
+					{
+						Type:               cmapi.CertificateRequestConditionInvalidRequest,
+						Status:             cmmeta.ConditionTrue,
+						LastTransitionTime: &now,
+						Reason:             "UnsupportedByOriginCA",
+						Message:            "The Cloudflare Origin CA only signs server certificates, and can't sign certificates for client authentication alone. Add the \"server auth\" usage to the Certificate, or use another issuer for client certificates. (correlation ID c0ffee00)",
+					},
+					{
+						Type:               cmapi.CertificateRequestConditionReady,
+						Status:             cmmeta.ConditionFalse,
+						LastTransitionTime: &now,
+						Reason:             "Failed",
+						Message:            "The Cloudflare Origin CA only signs server certificates, and can't sign certificates for client authentication alone. Add the \"server auth\" usage to the Certificate, or use another issuer for client certificates. (correlation ID c0ffee00)",
+					},
+				},
+				FailureTime: &now,
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foobar",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(tt.objects...).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			recorder := record.NewFakeRecorder(len(tt.events))
+			controller := &CertificateRequestController{
+				Client:                   client,
+				Reader:                   client,
+				ClusterResourceNamespace: "super-secret",
+				Log:                      logf.Log,
+				Recorder:                 recorder,
+				Clock:                    clock,
+				CheckApprovedCondition:   tt.checkApproved,
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					return tt.signer, nil
+				}),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			result, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: tt.namespaceName,
+			})
+
+			if err != nil {
+				assert.Error(t, err, tt.error)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.Equal(t, errors.Is(err, reconcile.TerminalError(nil)), tt.terminal)
+			assert.DeepEqual(t, result, tt.result)
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.TODO(), tt.namespaceName, got))
+			assert.DeepEqual(t, got.Status, tt.expected)
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			assert.DeepEqual(t, events, tt.events)
+		})
+	}
+}
+
+type SignerFunc func(context.Context, *cfapi.SignRequest) (*cfapi.SignResponse, error)
+
+func (f SignerFunc) Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+	return f(ctx, req)
+}
+
+func (f SignerFunc) Verify(ctx context.Context) error {
+	return nil
+}
+
+func (f SignerFunc) Revoke(ctx context.Context, id string) error {
+	return nil
+}
+
+func (f SignerFunc) List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error) {
+	return &cfapi.ListResponse{}, nil
+}
+
+type VerifierFunc func(context.Context) error
+
+func (f VerifierFunc) Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f VerifierFunc) Verify(ctx context.Context) error {
+	return f(ctx)
+}
+
+func (f VerifierFunc) Revoke(ctx context.Context, id string) error {
+	return errors.New("not implemented")
+}
+
+func (f VerifierFunc) List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+// revokeRecorder signs every request with a fixed certificate ID, and records
+// the IDs of revoked certificates.
+type revokeRecorder struct {
+	SignerFunc
+	revoked []string
+}
+
+func (r *revokeRecorder) Revoke(ctx context.Context, id string) error {
+	r.revoked = append(r.revoked, id)
+	return nil
+}
+
+func TestCertificateRequestRevokeOnDelete(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+	if err != nil {
+		t.Fatalf("creating CSR: %s", err)
+	}
+
+	issuer := func() *v1.OriginIssuer {
+		return &v1.OriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foobar",
+				Namespace: "default",
+			},
+			Spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginECC,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{
+						Name: "service-key-issuer",
+						Key:  "key",
+					},
+				},
+			},
+			Status: v1.OriginIssuerStatus{
+				Conditions: []metav1.Condition{
+					{
+						Type:   v1.ConditionReady,
+						Status: v1.ConditionTrue,
+					},
+				},
+			},
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-key-issuer",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"key": []byte("djEuMC0weDAwQkFCMTBD"),
+		},
+	}
+
+	request := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR(csr),
+		cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+			Name:  "foobar",
+			Kind:  "OriginIssuer",
+			Group: "cert-manager.k8s.cloudflare.com",
+		}),
+	)
+	namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+
+	tests := []struct {
+		name         string
+		dualStack    bool
+		deleteIssuer bool
+		removeKey    bool
+		dryRun       bool
+		forgetID     bool
+		ids          string
+		certificate  string
+		revoked      []string
+		audited      []string
+	}{
+		{
+			name:        "issuer exists",
+			ids:         "9001",
+			certificate: "ecc",
+			revoked:     []string{"9001"},
+			audited:     []string{"Issued 9001", "Revoked 9001 deleted"},
+		},
+		{
+			name:         "issuer deleted",
+			deleteIssuer: true,
+			ids:          "9001",
+			certificate:  "ecc",
+			audited:      []string{"Issued 9001"},
+		},
+		{
+			name:        "dry run",
+			dryRun:      true,
+			ids:         "9001",
+			certificate: "ecc",
+			audited:     []string{"Issued 9001", "Revoked 9001 deleted (dry run)"},
+		},
+		{
+			name:        "credential removed",
+			removeKey:   true,
+			ids:         "9001",
+			certificate: "ecc",
+			audited:     []string{"Issued 9001"},
+		},
+		{
+			name:        "dual stack",
+			dualStack:   true,
+			ids:         "9001,9002",
+			certificate: "ecc",
+			revoked:     []string{"9001", "9002"},
+			audited:     []string{"Issued 9001", "Issued 9002", "Revoked 9001 deleted", "Revoked 9002 deleted"},
+		},
+		{
+			name:        "certificate ID lost",
+			forgetID:    true,
+			ids:         "9001",
+			certificate: "ecc",
+			audited:     []string{"Issued 9001"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuer()
+			iss.Spec.DualStack = tt.dualStack
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(request.DeepCopy(), iss, secret.DeepCopy()).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &revokeRecorder{
+				SignerFunc: func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+					m, ok := cfapi.MetadataFromContext(ctx)
+					assert.Assert(t, ok, "expected sign context to carry metadata")
+					assert.DeepEqual(t, m, cfapi.Metadata{
+						CorrelationID:   "c0ffee00",
+						IssuerKind:      "OriginIssuer",
+						IssuerNamespace: "default",
+						IssuerName:      "foobar",
+						ObjectKind:      "CertificateRequest",
+						ObjectNamespace: "default",
+						ObjectName:      "foobar",
+					})
+
+					if sr.Type == "origin-rsa" {
+						return &cfapi.SignResponse{Id: "9002", Certificate: "rsa", Expiration: clock.Now().Add(time.Hour), RayID: "ray-9002"}, nil
+					}
+
+					return &cfapi.SignResponse{Id: "9001", Certificate: "ecc", Expiration: clock.Now().Add(time.Hour), RayID: "ray-9001"}, nil
+				},
+			}
+
+			var records []audit.Record
+			sink := audit.SinkFunc(func(ctx context.Context, r audit.Record) error {
+				records = append(records, r)
+
+				return nil
+			})
+
+			controller := &CertificateRequestController{
+				Client:                   client,
+				Reader:                   client,
+				ClusterResourceNamespace: "super-secret",
+				Log:                      logf.Log,
+				Recorder:                 record.NewFakeRecorder(10),
+				Clock:                    clock,
+				RevokeOnDelete:           true,
+				RevokeDryRun:             tt.dryRun,
+				Audit:                    sink,
+				NewCorrelationID:         func() string { return "c0ffee00" },
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					return api, nil
+				}),
+			}
+			reconciler := reconcile.AsReconciler(client, controller)
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			assert.NilError(t, err)
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], tt.ids)
+			assert.Equal(t, string(got.Status.Certificate), tt.certificate)
+			if tt.dualStack {
+				assert.Equal(t, got.Annotations[v1.DualStackCertificateAnnotation], "rsa")
+			}
+			assert.DeepEqual(t, got.Finalizers, []string{v1.RevokeFinalizer})
+
+			var expirations, rayIDs []string
+			for _, id := range strings.Split(tt.ids, ",") {
+				expirations = append(expirations, clock.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+				rayIDs = append(rayIDs, "ray-"+id)
+			}
+			assert.Equal(t, got.Annotations[v1.CertificateExpirationAnnotation], strings.Join(expirations, ","))
+			assert.Equal(t, got.Annotations[v1.RayIDAnnotation], strings.Join(rayIDs, ","))
+
+			if tt.forgetID {
+				delete(got.Annotations, v1.CertificateIDAnnotation)
+				assert.NilError(t, client.Update(context.TODO(), got))
+			}
+
+			if tt.deleteIssuer {
+				assert.NilError(t, client.Delete(context.TODO(), issuer()))
+			}
+			if tt.removeKey {
+				s := &corev1.Secret{}
+				assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "service-key-issuer"}, s))
+				delete(s.Data, "key")
+				assert.NilError(t, client.Update(context.TODO(), s))
+			}
+			assert.NilError(t, client.Delete(context.TODO(), got))
+
+			_, err = reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			assert.NilError(t, err)
+
+			err = client.Get(context.TODO(), namespaceName, got)
+			assert.Assert(t, apierrors.IsNotFound(err), "expected CertificateRequest to be deleted, got %v", err)
+			assert.DeepEqual(t, api.revoked, tt.revoked)
+
+			var audited []string
+			for _, r := range records {
+				summary := string(r.Action) + " " + r.CertificateID
+				if r.Reason != "" {
+					summary += " " + r.Reason
+				}
+				if r.DryRun {
+					summary += " (dry run)"
+				}
+				audited = append(audited, summary)
+			}
+			assert.DeepEqual(t, audited, tt.audited)
+
+			expiration := clock.Now().Add(time.Hour)
+			assert.DeepEqual(t, records[0], audit.Record{
+				Time:               clock.Now().UTC(),
+				Action:             audit.ActionIssued,
+				Namespace:          "default",
+				CertificateRequest: "foobar",
+				CorrelationID:      "c0ffee00",
+				IssuerKind:         "OriginIssuer",
+				IssuerName:         "foobar",
+				CertificateID:      "9001",
+				Expiration:         &expiration,
+				RayID:              "ray-9001",
+			})
+		})
+	}
+}
+
+func TestSignDeadline(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := clock.Now()
+
+	certificate := func(notAfter time.Time) *cmapi.Certificate {
+		return &cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foobar",
+				Namespace: "default",
+			},
+			Status: cmapi.CertificateStatus{
+				NotAfter: &metav1.Time{Time: notAfter},
+			},
+		}
+	}
+
+	owned := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.AddCertificateRequestOwnerReferences(*metav1.NewControllerRef(
+			certificate(now), cmapi.SchemeGroupVersion.WithKind(cmapi.CertificateKind),
+		)),
+	)
+
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		cr       *cmapi.CertificateRequest
+		timeout  time.Duration
+		expected time.Time
+	}{
+		{
+			name:     "no timeout",
+			cr:       cmgen.CertificateRequest("foobar", cmgen.SetCertificateRequestNamespace("default")),
+			expected: time.Time{},
+		},
+		{
+			name:     "timeout",
+			cr:       cmgen.CertificateRequest("foobar", cmgen.SetCertificateRequestNamespace("default")),
+			timeout:  time.Minute,
+			expected: now.Add(time.Minute),
+		},
+		{
+			name:     "certificate expires before timeout",
+			objects:  []runtime.Object{certificate(now.Add(time.Second))},
+			cr:       owned,
+			timeout:  time.Minute,
+			expected: now.Add(time.Second),
+		},
+		{
+			name:     "certificate expires after timeout",
+			objects:  []runtime.Object{certificate(now.Add(time.Hour))},
+			cr:       owned,
+			timeout:  time.Minute,
+			expected: now.Add(time.Minute),
+		},
+		{
+			name:     "certificate already expired",
+			objects:  []runtime.Object{certificate(now.Add(-time.Hour))},
+			cr:       owned,
+			timeout:  time.Minute,
+			expected: now.Add(time.Minute),
+		},
+		{
+			name:     "certificate missing",
+			cr:       owned,
+			timeout:  time.Minute,
+			expected: now.Add(time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(tt.objects...).
+				Build()
+
+			controller := &CertificateRequestController{
+				Client:      client,
+				Reader:      client,
+				Log:         logf.Log,
+				Clock:       clock,
+				SignTimeout: tt.timeout,
+			}
+
+			got := controller.signDeadline(context.Background(), logf.Log, tt.cr)
+			assert.Assert(t, got.Equal(tt.expected), "got %s, expected %s", got, tt.expected)
+		})
+	}
+}
+
+func TestSignTimeoutFollowsClock(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// A clock far behind the wall clock would cancel the sign call
+	// immediately if its deadline were applied as an absolute time.
+	clock := fakeClock.NewFakeClock(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+	if err != nil {
+		t.Fatalf("creating CSR: %s", err)
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			cmgen.CertificateRequest("foobar",
+				cmgen.SetCertificateRequestNamespace("default"),
+				cmgen.SetCertificateRequestCSR(csr),
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+					Name:  "foobar",
+					Kind:  "ClusterOriginIssuer",
+					Group: "cert-manager.k8s.cloudflare.com",
+				}),
+			),
+			&v1.ClusterOriginIssuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+				Spec: v1.OriginIssuerSpec{
+					RequestType: v1.RequestTypeOriginECC,
+					Auth: v1.OriginIssuerAuthentication{
+						ServiceKeyRef: v1.SecretKeySelector{Name: "service-key-issuer", Key: "key"},
+					},
+				},
+				Status: v1.OriginIssuerStatus{
+					Conditions: []metav1.Condition{{Type: v1.ConditionReady, Status: v1.ConditionTrue}},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "service-key-issuer", Namespace: "super-secret"},
+				Data:       map[string][]byte{"key": []byte("djEuMC0weDAwQkFCMTBD")},
+			},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	controller := &CertificateRequestController{
+		Client:                   client,
+		Reader:                   client,
+		ClusterResourceNamespace: "super-secret",
+		Log:                      logf.Log,
+		Recorder:                 record.NewFakeRecorder(10),
+		Clock:                    clock,
+		SignTimeout:              time.Minute,
+		Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+			return SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				deadline, ok := ctx.Deadline()
+				assert.Assert(t, ok, "expected sign context to have a deadline")
+				assert.Assert(t, time.Until(deadline) > 50*time.Second, "deadline %s is not a minute away", deadline)
+
+				return &cfapi.SignResponse{Id: "1", Certificate: "bogus"}, nil
+			}), nil
+		}),
+	}
+
+	_, err = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+	})
+	assert.NilError(t, err)
+
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+	assert.DeepEqual(t, got.Status.Certificate, []byte("bogus"))
+	assert.Assert(t, got.Status.Conditions[0].LastTransitionTime.Time.Equal(clock.Now()))
+}
+
+// RootSourceFunc is a RootSource implemented by a function.
+type RootSourceFunc func(ctx context.Context, requestType string) ([]byte, error)
+
+func (f RootSourceFunc) Root(ctx context.Context, requestType string) ([]byte, error) {
+	return f(ctx, requestType)
+}
+
+func TestCertificateRequestCA(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := RootSourceFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+		switch requestType {
+		case "origin-rsa":
+			return []byte("rsa root\n"), nil
+		case "origin-ecc":
+			return []byte("ecc root\n"), nil
+		default:
+			return nil, errors.New("no root")
+		}
+	})
+
+	tests := []struct {
+		name       string
+		issuer     *v1.OriginIssuer
+		roots      RootSource
+		populateCA bool
+		expected   []byte
+	}{
+		{
+			name:       "rsa",
+			issuer:     issuertesting.OriginIssuer("default", "foobar"),
+			roots:      roots,
+			populateCA: true,
+			expected:   []byte("rsa root\n"),
+		},
+		{
+			name: "dual stack",
+			issuer: issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(
+				issuerclient.WithRequestType(v1.RequestTypeOriginECC),
+				issuerclient.WithDualStack(),
+			)),
+			roots:      roots,
+			populateCA: true,
+			expected:   []byte("ecc root\nrsa root\n"),
+		},
+		{
+			name:   "root unavailable",
+			issuer: issuertesting.OriginIssuer("default", "foobar"),
+			roots: RootSourceFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+				return nil, errors.New("no network")
+			}),
+			populateCA: true,
+		},
+		{
+			name:   "disabled",
+			issuer: issuertesting.OriginIssuer("default", "foobar"),
+			roots:  roots,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+					tt.issuer,
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:     client,
+				Reader:     client,
+				Log:        logf.Log,
+				Recorder:   record.NewFakeRecorder(10),
+				Clock:      fakeClock.NewFakeClock(time.Now()),
+				Factory:    api.Factory(),
+				Roots:      tt.roots,
+				PopulateCA: tt.populateCA,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			assert.NilError(t, err)
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.Assert(t, len(got.Status.Certificate) > 0, "expected certificate to be issued")
+			assert.DeepEqual(t, got.Status.CA, tt.expected)
+		})
+	}
+}
+
+func TestSetStatusCorrelationID(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+			Type:    cmapi.CertificateRequestConditionReady,
+			Status:  cmmeta.ConditionFalse,
+			Reason:  cmapi.CertificateRequestReasonPending,
+			Message: "OriginIssuer default/foobar is not Ready (correlation ID 00000001)",
+		}),
+	)
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(cr).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	recorder := record.NewFakeRecorder(2)
+	controller := &CertificateRequestController{
+		Client:   client,
+		Log:      logf.Log,
+		Recorder: recorder,
+		Clock:    fakeClock.NewFakeClock(time.Now()),
+	}
+
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+
+	// Repeating the condition keeps the ID of the reconcile that first set
+	// it, leaving the status unchanged.
+	ctx := withCorrelationID(context.Background(), "00000002")
+	assert.NilError(t, controller.setStatus(ctx, got, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "OriginIssuer default/foobar is not Ready"))
+	assert.Equal(t, got.Status.Conditions[0].Message, "OriginIssuer default/foobar is not Ready (correlation ID 00000001)")
+	assert.Equal(t, <-recorder.Events, "Warning Pending OriginIssuer default/foobar is not Ready map[cert-manager.k8s.cloudflare.com/correlation-id:00000002]")
+
+	ctx = withCorrelationID(context.Background(), "00000003")
+	assert.NilError(t, controller.setStatus(ctx, got, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "Failed to sign certificate request: boom"))
+	assert.Equal(t, got.Status.Conditions[0].Message, "Failed to sign certificate request: boom (correlation ID 00000003)")
+	assert.Equal(t, <-recorder.Events, "Warning Failed Failed to sign certificate request: boom map[cert-manager.k8s.cloudflare.com/correlation-id:00000003]")
+}
+
+func TestCertificateRequestDefaultDuration(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	days := func(n int) time.Duration {
+		return time.Duration(n) * 24 * time.Hour
+	}
+
+	tests := []struct {
+		name            string
+		duration        *metav1.Duration
+		issuerDefault   *metav1.Duration
+		defaultDuration time.Duration
+		validity        int
+		events          []string
+	}{
+		{
+			name:     "provisioner default",
+			validity: 7,
+			events: []string{
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+				"Normal DefaultDuration No duration requested, issued with the default validity of 7 days map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+		{
+			name:            "controller default",
+			defaultDuration: days(30),
+			validity:        30,
+			events: []string{
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+				"Normal DefaultDuration No duration requested, issued with the default validity of 30 days map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+		{
+			name:            "issuer default",
+			issuerDefault:   &metav1.Duration{Duration: days(90)},
+			defaultDuration: days(30),
+			validity:        90,
+			events: []string{
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+				"Normal DefaultDuration No duration requested, issued with the default validity of 90 days map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+		{
+			name:            "requested duration",
+			duration:        &metav1.Duration{Duration: days(365)},
+			defaultDuration: days(30),
+			validity:        365,
+			events: []string{
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuertesting.OriginIssuer("default", "foobar")
+			iss.Spec.DefaultDuration = tt.issuerDefault
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+						cmgen.SetCertificateRequestDuration(tt.duration),
+					),
+					iss,
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			recorder := record.NewFakeRecorder(len(tt.events))
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         recorder,
+				Clock:            fakeClock.NewFakeClock(time.Now()),
+				Factory:          api.Factory(),
+				DefaultDuration:  tt.defaultDuration,
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, api.SignedValidities(), []int{tt.validity})
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			assert.DeepEqual(t, events, tt.events)
+		})
+	}
+}
+
+func TestCertificateRequestIncludeChain(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := RootSourceFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+		switch requestType {
+		case "origin-rsa":
+			return []byte("rsa root\n"), nil
+		case "origin-ecc":
+			return []byte("ecc root\n"), nil
+		default:
+			return nil, errors.New("no root")
+		}
+	})
+	cert := issuertesting.FakeCertificate
+
+	tests := []struct {
+		name     string
+		opts     []issuerclient.SpecOption
+		roots    RootSource
+		expected string
+		signed   int
+		error    string
+	}{
+		{
+			name:     "disabled",
+			roots:    roots,
+			expected: cert,
+			signed:   1,
+		},
+		{
+			name:     "chain",
+			opts:     []issuerclient.SpecOption{issuerclient.WithIncludeChain()},
+			roots:    roots,
+			expected: cert + "\nrsa root\n",
+			signed:   1,
+		},
+		{
+			name:     "dual stack",
+			opts:     []issuerclient.SpecOption{issuerclient.WithIncludeChain(), issuerclient.WithRequestType(v1.RequestTypeOriginECC), issuerclient.WithDualStack()},
+			roots:    roots,
+			expected: cert + "\necc root\n",
+			signed:   2,
+		},
+		{
+			name: "root unavailable",
+			opts: []issuerclient.SpecOption{issuerclient.WithIncludeChain()},
+			roots: RootSourceFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+				return nil, errors.New("no network")
+			}),
+			error: "no network",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(tt.opts...)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:   client,
+				Reader:   client,
+				Log:      logf.Log,
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    fakeClock.NewFakeClock(time.Now()),
+				Factory:  api.Factory(),
+				Roots:    tt.roots,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.Equal(t, string(got.Status.Certificate), tt.expected)
+			assert.Equal(t, len(api.SignedHostnames()), tt.signed)
+		})
+	}
+}
+
+func TestCertificateRequestAuthFailures(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(name string) *cmapi.CertificateRequest {
+		return issuertesting.CertificateRequest("default", name, issuertesting.SetCertificateRequestOriginIssuer("foobar"))
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			request("a"), request("b"), request("c"), request("d"),
+			issuertesting.OriginIssuer("default", "foobar"),
+			issuertesting.ServiceKeySecret("default"),
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	clock := fakeClock.NewFakeClock(time.Now())
+	api := &issuertesting.FakeAPI{
+		SignErr: &cfapi.APIError{Code: 10000, Message: "Authentication error", StatusCode: 403},
+	}
+	controller := &CertificateRequestController{
+		Client:           client,
+		Reader:           client,
+		Log:              logf.Log,
+		Recorder:         record.NewFakeRecorder(10),
+		Clock:            clock,
+		Factory:          api.Factory(),
+		AuthFailureTTL:   time.Minute,
+		NewCorrelationID: func() string { return "c0ffee00" },
+	}
+	reconciler := reconcile.AsReconciler(client, controller)
+
+	reconcileRequest := func(name string) *cmapi.CertificateRequest {
+		namespaceName := types.NamespacedName{Namespace: "default", Name: name}
+		_, err := reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+		assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)), "expected terminal error, got %v", err)
+
+		got := &cmapi.CertificateRequest{}
+		assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+		return got
+	}
+
+	got := reconcileRequest("a")
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+	assert.Equal(t, got.Status.Conditions[0].Reason, cmapi.CertificateRequestReasonFailed)
+
+	// Requests signed with the same credentials fail without calling
+	// Cloudflare.
+	got = reconcileRequest("b")
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+	assert.Equal(t, got.Status.Conditions[0].Message, "Failed to sign certificate request: credentials were recently rejected by the Cloudflare API: unable to sign request: Cloudflare API Error code=10000 message=Authentication error ray_id= (correlation ID c0ffee00)")
+
+	// Updating the secret forgets the rejection.
+	secret := issuertesting.ServiceKeySecret("default")
+	assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: secret.Name}, secret))
+	secret.Data[issuertesting.ServiceKeySecretKey] = []byte("v1.0-0x00C0FFEE")
+	assert.NilError(t, client.Update(context.TODO(), secret))
+
+	reconcileRequest("c")
+	assert.Equal(t, len(api.SignedHostnames()), 2)
+
+	// So does time.
+	clock.Step(time.Minute)
+	reconcileRequest("d")
+	assert.Equal(t, len(api.SignedHostnames()), 3)
+}
+
+func TestCertificateRequestRetryBackoff(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			issuertesting.OriginIssuer("default", "foobar"),
+			issuertesting.ServiceKeySecret("default"),
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	api := &issuertesting.FakeAPI{SignErr: &cfapi.RateLimitError{RetryAfter: time.Minute}}
+	newController := func() *CertificateRequestController {
+		return &CertificateRequestController{
+			Client:               client,
+			Reader:               client,
+			Log:                  logf.Log,
+			Recorder:             record.NewFakeRecorder(10),
+			Clock:                clock,
+			Factory:              api.Factory(),
+			MaxRetriesBeforeFail: 2,
+			NewCorrelationID:     func() string { return "c0ffee00" },
+		}
+	}
+	controller := newController()
+
+	namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+	reconcileRequest := func() (reconcile.Result, *cmapi.CertificateRequest, error) {
+		result, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+
+		got := &cmapi.CertificateRequest{}
+		assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+		return result, got, err
+	}
+
+	result, got, err := reconcileRequest()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, reconcile.Result{RequeueAfter: time.Minute})
+	assert.Equal(t, got.Annotations[v1.RetryCountAnnotation], "1")
+	assert.Equal(t, got.Annotations[v1.NextAttemptAnnotation], clock.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+
+	// Requests wait for their next attempt, even after the controller
+	// restarted.
+	controller = newController()
+	clock.Step(20 * time.Second)
+	result, _, err = reconcileRequest()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, reconcile.Result{RequeueAfter: 40 * time.Second})
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+
+	// The backoff doubles with each failed attempt.
+	clock.Step(40 * time.Second)
+	result, got, err = reconcileRequest()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, reconcile.Result{RequeueAfter: 2 * time.Minute})
+	assert.Equal(t, got.Annotations[v1.RetryCountAnnotation], "2")
+	assert.Equal(t, got.Annotations[v1.NextAttemptAnnotation], clock.Now().Add(2*time.Minute).UTC().Format(time.RFC3339))
+	assert.Equal(t, got.Status.Conditions[0].Message, "Rate limited by the Cloudflare API, retrying at the time of the cert-manager.k8s.cloudflare.com/next-attempt annotation (correlation ID c0ffee00)")
+	assert.Equal(t, len(api.SignedHostnames()), 2)
+
+	// Kicked requests are attempted at once, and fail once out of retries.
+	controller.kicked.Store(namespaceName, clock.Now())
+	_, got, err = reconcileRequest()
+	assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)), "expected terminal error, got %v", err)
+	assert.Equal(t, got.Status.Conditions[0].Reason, cmapi.CertificateRequestReasonFailed)
+	assert.Equal(t, got.Status.Conditions[0].Message, "Failed to sign certificate request after 3 attempts: unable to sign request: rate limited by the Cloudflare API, retry after 1m0s (correlation ID c0ffee00)")
+	assert.Equal(t, len(api.SignedHostnames()), 3)
+
+	// Signed requests forget their retry state.
+	got.Status = cmapi.CertificateRequestStatus{}
+	assert.NilError(t, client.Status().Update(context.TODO(), got))
+	api.SignErr = nil
+	clock.Step(2 * time.Minute)
+	_, got, err = reconcileRequest()
+	assert.NilError(t, err)
+	assert.Assert(t, len(got.Status.Certificate) > 0)
+	assert.Equal(t, got.Annotations[v1.RetryCountAnnotation], "")
+	assert.Equal(t, got.Annotations[v1.NextAttemptAnnotation], "")
+}
+
+func TestCertificateRequestRecordConflict(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// The request is changed by someone else while it is signed, so that
+	// recording its certificate conflicts.
+	conflicted := false
+	client := interceptor.NewClient(fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			issuertesting.OriginIssuer("default", "foobar"),
+			issuertesting.ServiceKeySecret("default"),
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build(), interceptor.Funcs{
+		Update: func(ctx context.Context, c ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.UpdateOption) error {
+			if !conflicted {
+				conflicted = true
+
+				var other cmapi.CertificateRequest
+				if err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(obj), &other); err != nil {
+					return err
+				}
+				other.Labels = map[string]string{"team": "web"}
+				if err := c.Update(ctx, &other); err != nil {
+					return err
+				}
+			}
+
+			return c.Update(ctx, obj, opts...)
+		},
+	})
+
+	api := &issuertesting.FakeAPI{}
+	controller := &CertificateRequestController{
+		Client:   client,
+		Reader:   client,
+		Log:      logf.Log,
+		Recorder: record.NewFakeRecorder(10),
+		Clock:    fakeClock.NewFakeClock(time.Now()),
+		Factory:  api.Factory(),
+	}
+
+	namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+	_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+	assert.NilError(t, err)
+	assert.Assert(t, conflicted)
+
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.Background(), namespaceName, got))
+	assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], "1")
+	assert.Equal(t, got.Labels["team"], "web")
+	assert.Equal(t, got.Status.Conditions[0].Reason, cmapi.CertificateRequestReasonIssued)
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+}
+
+func TestCertificateRequestCache(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		delete  bool
+		revoked []string
+	}{
+		{
+			name: "recorded on retry",
+		},
+		{
+			name:    "deleted before recorded",
+			delete:  true,
+			revoked: []string{"1"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+			request := issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar"))
+			request.UID = "c0ffee"
+
+			// Recording the signed certificate fails until the apiserver
+			// recovers.
+			recovered := false
+			client := interceptor.NewClient(fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(request, issuertesting.OriginIssuer("default", "foobar"), issuertesting.ServiceKeySecret("default")).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build(), interceptor.Funcs{
+				Update: func(ctx context.Context, c ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.UpdateOption) error {
+					if _, ok := obj.GetAnnotations()[v1.CertificateIDAnnotation]; ok && !recovered {
+						return errors.New("apiserver unavailable")
+					}
+
+					return c.Update(ctx, obj, opts...)
+				},
+			})
+
+			cache, err := certcache.Open(filepath.Join(t.TempDir(), "certificates.json"), clock)
+			assert.NilError(t, err)
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:         client,
+				Reader:         client,
+				Log:            logf.Log,
+				Recorder:       record.NewFakeRecorder(10),
+				Clock:          clock,
+				RevokeOnDelete: true,
+				Cache:          cache,
+				Factory:        api.Factory(),
+			}
+			reconciler := reconcile.AsReconciler(client, controller)
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+
+			_, err = reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			assert.ErrorContains(t, err, "apiserver unavailable")
+
+			// The certificate is cached, and the request can't be deleted
+			// without revoking it.
+			e, ok := cache.Get("c0ffee")
+			assert.Assert(t, ok, "expected signed certificate to be cached")
+			assert.DeepEqual(t, e.IDs(), []string{"1"})
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), namespaceName, got))
+			assert.DeepEqual(t, got.Finalizers, []string{v1.RevokeFinalizer})
+			assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], "")
+
+			recovered = true
+			if tt.delete {
+				assert.NilError(t, client.Delete(context.Background(), got))
+			}
+
+			_, err = reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			assert.NilError(t, err)
+
+			if tt.delete {
+				err = client.Get(context.Background(), namespaceName, got)
+				assert.Assert(t, apierrors.IsNotFound(err), "expected CertificateRequest to be deleted, got %v", err)
+			} else {
+				// The cached certificate is published rather than signed
+				// again.
+				assert.NilError(t, client.Get(context.Background(), namespaceName, got))
+				assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], "1")
+				assert.Equal(t, string(got.Status.Certificate), issuertesting.FakeCertificate)
+				assert.Equal(t, got.Status.Conditions[0].Reason, cmapi.CertificateRequestReasonIssued)
+			}
+
+			assert.Equal(t, len(api.SignedHostnames()), 1)
+			assert.DeepEqual(t, api.Revoked(), tt.revoked)
+
+			_, ok = cache.Get("c0ffee")
+			assert.Assert(t, !ok, "expected certificate to be forgotten once recorded or revoked")
+		})
+	}
+}
+
+func TestCertificateRequestCacheChain(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	request := issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar"))
+	request.UID = "c0ffee"
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			request,
+			issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithIncludeChain())),
+			issuertesting.ServiceKeySecret("default"),
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	// The certificates were signed while the issuer was dual-stack, and
+	// could not be recorded before it was changed.
+	cache, err := certcache.Open(filepath.Join(t.TempDir(), "certificates.json"), clock)
+	assert.NilError(t, err)
+	assert.NilError(t, cache.Put("c0ffee", certcache.Entry{Certificates: []certcache.Certificate{
+		{ID: "1", Certificate: "ecc certificate\n", Type: "origin-ecc", Expiration: clock.Now().AddDate(1, 0, 0)},
+		{ID: "2", Certificate: "rsa certificate\n", Type: "origin-rsa", Expiration: clock.Now().AddDate(1, 0, 0)},
+	}}))
+
+	api := &issuertesting.FakeAPI{}
+	controller := &CertificateRequestController{
+		Client:   client,
+		Reader:   client,
+		Log:      logf.Log,
+		Recorder: record.NewFakeRecorder(10),
+		Clock:    clock,
+		Cache:    cache,
+		Factory:  api.Factory(),
+		Roots: RootSourceFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+			return []byte(requestType + " root\n"), nil
+		}),
+	}
+
+	namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+	_, err = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+	assert.NilError(t, err)
+
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.Background(), namespaceName, got))
+	assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], "1,2")
+	assert.Equal(t, string(got.Status.Certificate), "ecc certificate\norigin-ecc root\n")
+	assert.Equal(t, got.Annotations[v1.DualStackCertificateAnnotation], "rsa certificate\norigin-rsa root\n")
+	assert.Equal(t, len(api.SignedHostnames()), 0)
+}
+
+func TestCertificateRequestCacheFull(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	cache, err := certcache.Open(filepath.Join(t.TempDir(), "certificates.json"), clock)
+	assert.NilError(t, err)
+	cache.MaxEntries = 1
+	assert.NilError(t, cache.Put("other", certcache.Entry{Certificates: []certcache.Certificate{{ID: "9001", Expiration: clock.Now().Add(time.Hour)}}}))
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			issuertesting.OriginIssuer("default", "foobar"),
+			issuertesting.ServiceKeySecret("default"),
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	api := &issuertesting.FakeAPI{}
+	controller := &CertificateRequestController{
+		Client:   client,
+		Reader:   client,
+		Log:      logf.Log,
+		Recorder: record.NewFakeRecorder(10),
+		Clock:    clock,
+		Cache:    cache,
+		Factory:  api.Factory(),
+	}
+
+	namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+	_, err = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+	assert.Equal(t, err, certcache.ErrFull)
+
+	// Nothing is signed until cached certificates are recorded.
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.Background(), namespaceName, got))
+	assert.Equal(t, got.Status.Conditions[0].Reason, cmapi.CertificateRequestReasonPending)
+	assert.Equal(t, len(api.SignedHostnames()), 0)
+}
+
+func TestCertificateRequestRevokeSuperseded(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []issuerclient.SpecOption
+		dryRun  bool
+		listErr error
+		revoked []string
+		event   string
+	}{
+		{
+			name:    "disabled",
+			opts:    []issuerclient.SpecOption{issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353")},
+			revoked: []string{},
+		},
+		{
+			name:    "revoked",
+			opts:    []issuerclient.SpecOption{issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353"), issuerclient.WithRevokeSuperseded()},
+			revoked: []string{"1"},
+			event:   "Normal RevokedSuperseded Revoked superseded Origin CA certificates 1",
+		},
+		{
+			name:    "dry run",
+			opts:    []issuerclient.SpecOption{issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353"), issuerclient.WithRevokeSuperseded()},
+			dryRun:  true,
+			revoked: []string{},
+			event:   "Normal WouldRevokeSuperseded Dry run, would revoke superseded Origin CA certificates 1",
+		},
+		{
+			name:    "list error",
+			opts:    []issuerclient.SpecOption{issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353"), issuerclient.WithRevokeSuperseded()},
+			listErr: errors.New("cfapi error"),
+			revoked: []string{},
+			event:   "Warning RevokeSupersededFailed Failed to revoke superseded Origin CA certificates: unable to list certificates of zone 023e105f4ecef8ad9ca31a8372d0c353: cfapi error",
+		},
+	}
+
+	revision := func(rev int, id string) *cmapi.CertificateRequest {
+		return issuertesting.CertificateRequest("default", "foobar-"+strconv.Itoa(rev),
+			issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			cmgen.AddCertificateRequestOwnerReferences(cmgen.CertificateRef("foobar", "foobar-uid")),
+			cmgen.SetCertificateRequestAnnotations(map[string]string{
+				cmapi.CertificateNameKey:                      "foobar",
+				cmapi.CertificateRequestRevisionAnnotationKey: strconv.Itoa(rev),
+				v1.CertificateIDAnnotation:                    id,
+			}),
+		)
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					revision(1, "1"),
+					revision(2, ""),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(tt.opts...)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			// Certificates of the zone for the hostnames of the request,
+			// only the first recorded on an earlier revision of its
+			// Certificate.
+			api := &issuertesting.FakeAPI{ListErr: tt.listErr}
+			for i := 0; i < 2; i++ {
+				_, err := api.Sign(context.Background(), &cfapi.SignRequest{Hostnames: []string{"example.com"}, Type: "origin-rsa"})
+				assert.NilError(t, err)
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			controller := &CertificateRequestController{
+				Client:       client,
+				Reader:       client,
+				Log:          logf.Log,
+				Recorder:     recorder,
+				Clock:        fakeClock.NewFakeClock(time.Now()),
+				Factory:      api.Factory(),
+				RevokeDryRun: tt.dryRun,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar-2"}
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			assert.NilError(t, err)
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), namespaceName, got))
+			assert.Equal(t, got.Status.Conditions[0].Reason, cmapi.CertificateRequestReasonIssued)
+			assert.DeepEqual(t, api.Revoked(), tt.revoked, cmpopts.EquateEmpty())
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				if strings.Contains(event, "Superseded") {
+					// The correlation ID annotation is random.
+					event, _, _ = strings.Cut(event, " map[")
+					events = append(events, event)
+				}
+			}
+
+			if tt.event == "" {
+				assert.Equal(t, len(events), 0)
+			} else {
+				assert.DeepEqual(t, events, []string{tt.event})
+			}
+		})
+	}
+}
+
+func TestCertificateRequestWildcardPolicy(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		collapse  bool
+		hostnames []string
+		events    []string
+	}{
+		{
+			name:      "disabled",
+			hostnames: []string{"a.example.com", "b.example.com", "c.example.com"},
+			events: []string{
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+		{
+			name:      "suggested",
+			threshold: 3,
+			hostnames: []string{"a.example.com", "b.example.com", "c.example.com"},
+			events: []string{
+				"Normal WildcardSuggested At least 3 hostnames share a parent domain, consider requesting *.example.com instead map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+		{
+			name:      "collapsed",
+			threshold: 3,
+			collapse:  true,
+			hostnames: []string{"*.example.com"},
+			events: []string{
+				"Normal CollapsedToWildcard Hostnames sharing a parent domain are requested as *.example.com map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+				"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuertesting.OriginIssuer("default", "foobar")
+			iss.Spec.WildcardThreshold = tt.threshold
+			iss.Spec.CollapseToWildcard = tt.collapse
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+						issuertesting.SetCertificateRequestDNSNames("a.example.com", "b.example.com", "c.example.com"),
+						cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
+					),
+					iss,
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			recorder := record.NewFakeRecorder(len(tt.events))
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         recorder,
+				Clock:            fakeClock.NewFakeClock(time.Now()),
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, api.SignedHostnames(), [][]string{tt.hostnames})
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			assert.DeepEqual(t, events, tt.events)
+		})
+	}
+}
+
+func TestCertificateRequestTenant(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		tenantKey   string
+		annotations map[string]string
+		labels      map[string]string
+		tenant      string
+	}{
+		{
+			name:        "annotation",
+			tenantKey:   "example.com/team",
+			annotations: map[string]string{"example.com/team": "payments"},
+			tenant:      "payments",
+		},
+		{
+			name:      "label",
+			tenantKey: "example.com/team",
+			labels:    map[string]string{"example.com/team": "search"},
+			tenant:    "search",
+		},
+		{
+			name:        "annotation overrides label",
+			tenantKey:   "example.com/team",
+			annotations: map[string]string{"example.com/team": "payments"},
+			labels:      map[string]string{"example.com/team": "search"},
+			tenant:      "payments",
+		},
+		{
+			name:      "unset",
+			tenantKey: "example.com/team",
+		},
+		{
+			name:        "disabled",
+			annotations: map[string]string{"example.com/team": "payments"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Annotations: tt.annotations, Labels: tt.labels}},
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					),
+					issuertesting.OriginIssuer("default", "foobar"),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			var records []audit.Record
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:   client,
+				Reader:   client,
+				Log:      logf.Log,
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    fakeClock.NewFakeClock(time.Now()),
+				Factory:  api.Factory(),
+				Audit: audit.SinkFunc(func(ctx context.Context, r audit.Record) error {
+					records = append(records, r)
+
+					return nil
+				}),
+				TenantKey: tt.tenantKey,
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, len(records), 1)
+			assert.Equal(t, records[0].Tenant, tt.tenant)
+		})
+	}
+}
+
+func TestCertificateRequestAttribution(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		keys        []string
+		annotations map[string]string
+		labels      map[string]string
+		certificate map[string]string
+		expected    map[string]string
+	}{
+		{
+			name:        "annotation",
+			keys:        []string{"example.com/team"},
+			annotations: map[string]string{"example.com/team": "payments"},
+			expected:    map[string]string{"example.com/team": "payments"},
+		},
+		{
+			name:     "label",
+			keys:     []string{"example.com/team"},
+			labels:   map[string]string{"example.com/team": "search"},
+			expected: map[string]string{"example.com/team": "search"},
+		},
+		{
+			name:        "certificate",
+			keys:        []string{"example.com/team", "app"},
+			labels:      map[string]string{"example.com/team": "search"},
+			certificate: map[string]string{"example.com/team": "payments", "app": "checkout"},
+			expected:    map[string]string{"example.com/team": "search", "app": "checkout"},
+		},
+		{
+			name:     "unset",
+			keys:     []string{"example.com/team"},
+			expected: map[string]string{},
+		},
+		{
+			name:        "disabled",
+			annotations: map[string]string{"example.com/team": "payments"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					cmgen.Certificate("web", cmgen.SetCertificateNamespace("default"), cmgen.SetCertificateUID("web-uid"), func(crt *cmapi.Certificate) {
+						crt.Labels = tt.certificate
+					}),
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+						cmgen.AddCertificateRequestOwnerReferences(cmgen.CertificateRef("web", "web-uid")),
+						cmgen.SetCertificateRequestAnnotations(tt.annotations),
+						func(cr *cmapi.CertificateRequest) {
+							cr.Labels = tt.labels
+						},
+					),
+					issuertesting.OriginIssuer("default", "foobar"),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			var (
+				records  []audit.Record
+				metadata cfapi.Metadata
+			)
+			api := &issuertesting.FakeAPI{
+				SignFunc: func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+					metadata, _ = cfapi.MetadataFromContext(ctx)
+
+					return &cfapi.SignResponse{
+						Id:          "1",
+						Certificate: issuertesting.FakeCertificate,
+						Hostnames:   req.Hostnames,
+						Expiration:  time.Now().Add(7 * 24 * time.Hour),
+						Type:        req.Type,
+						Validity:    req.Validity,
+					}, nil
+				},
+			}
+			controller := &CertificateRequestController{
+				Client:   client,
+				Reader:   client,
+				Log:      logf.Log,
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    fakeClock.NewFakeClock(time.Now()),
+				Factory:  api.Factory(),
+				Audit: audit.SinkFunc(func(ctx context.Context, r audit.Record) error {
+					records = append(records, r)
+
+					return nil
+				}),
+				AttributionKeys: tt.keys,
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, len(records), 1)
+			assert.DeepEqual(t, records[0].Attribution, tt.expected)
+			assert.DeepEqual(t, metadata.Attribution, tt.expected)
+		})
+	}
+}
+
+func TestCertificateRequestReconcile_ZoneCredentials(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	tests := []struct {
+		name     string
+		dnsNames []string
+		expected cfapi.Credentials
+		error    string
+	}{
+		{
+			name:     "issuer credential",
+			dnsNames: []string{"example.com"},
+			expected: cfapi.Credentials{ServiceKey: []byte(issuertesting.ServiceKey)},
+		},
+		{
+			name:     "zone credential",
+			dnsNames: []string{"example.net", "www.example.net"},
+			expected: cfapi.Credentials{APIToken: []byte("example-net-token")},
+		},
+		{
+			name:     "different credentials",
+			dnsNames: []string{"example.com", "example.net"},
+			error:    "terminal error: hostnames example.com and example.net are not in the zones of the same credential",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(
+						issuerclient.WithZoneAPITokenRef("example-net", "token", "example.net"),
+					)),
+					issuertesting.ServiceKeySecret("default"),
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "example-net", Namespace: "default"},
+						Data:       map[string][]byte{"token": []byte("example-net-token")},
+					},
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			var got cfapi.Credentials
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				NewCorrelationID: func() string { return "c0ffee00" },
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					got = creds
+					return SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+						return &cfapi.SignResponse{Id: "1", Certificate: "bogus"}, nil
+					}), nil
+				}),
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)))
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tt.expected)
+		})
+	}
+}
+
+func TestZoneCredentialSpec(t *testing.T) {
+	spec := v1.OriginIssuerSpec{
+		ZoneID: "issuer-zone",
+		Auth: v1.OriginIssuerAuthentication{
+			ServiceKeyRef:  v1.SecretKeySelector{Name: "service-key", Key: "key"},
+			VerifyTokenRef: &v1.SecretKeySelector{Name: "verify-token", Key: "token"},
+			Zones: []v1.ZoneCredential{
+				{Zones: []string{"example.net"}, ZoneID: "example-net", APITokenRef: &v1.SecretKeySelector{Name: "example-net", Key: "token"}},
+			},
+		},
+	}
+
+	got, err := zoneCredentialSpec(spec, issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestDNSNames("www.example.net")))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got.Auth, v1.OriginIssuerAuthentication{APITokenRef: &v1.SecretKeySelector{Name: "example-net", Key: "token"}})
+	assert.Equal(t, got.ZoneID, "example-net")
+
+	// Requests signed with the issuer's own credential keep its zone.
+	got, err = zoneCredentialSpec(spec, issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestDNSNames("www.example.com")))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, spec)
+}
+
+func TestApprovalLatency(t *testing.T) {
+	created := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	approved := metav1.NewTime(created.Add(42 * time.Second))
+
+	cr := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+			Type:   cmapi.CertificateRequestConditionApproved,
+			Status: cmmeta.ConditionTrue,
+		}),
+	)
+	cr.CreationTimestamp = metav1.NewTime(created)
+
+	_, ok := approvalLatency(cr)
+	assert.Assert(t, !ok, "expected no latency without a transition time")
+
+	cr.Status.Conditions[0].LastTransitionTime = &approved
+	latency, ok := approvalLatency(cr)
+	assert.Assert(t, ok)
+	assert.Equal(t, latency, 42*time.Second)
+
+	cr.Status.Conditions = nil
+	_, ok = approvalLatency(cr)
+	assert.Assert(t, !ok)
+}
+
+func TestCertificateRequestReconcile_AllowedNamespaces(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"origin-ca-issuer": "allowed"}}
+
+	tests := []struct {
+		name      string
+		namespace string
+		reason    string
+	}{
+		{
+			name:      "allowed by name",
+			namespace: "team-a",
+			reason:    cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name:      "allowed by selector",
+			namespace: "team-b",
+			reason:    cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name:      "not allowed",
+			namespace: "team-c",
+			reason:    cmapi.CertificateRequestReasonFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := func(name string, labels map[string]string) *corev1.Namespace {
+				return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+			}
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest(tt.namespace, "foobar",
+						issuertesting.SetCertificateRequestClusterOriginIssuer("foobar"),
+					),
+					issuertesting.ClusterOriginIssuer("foobar", issuertesting.SetIssuerSpec(
+						issuerclient.WithAllowedNamespaces(selector, "team-a"),
+					)),
+					issuertesting.ServiceKeySecret("super-secret"),
+					namespace("team-a", nil),
+					namespace("team-b", map[string]string{"origin-ca-issuer": "allowed"}),
+					namespace("team-c", map[string]string{"origin-ca-issuer": "denied"}),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:                   client,
+				Reader:                   client,
+				ClusterResourceNamespace: "super-secret",
+				Log:                      logf.Log,
+				Recorder:                 record.NewFakeRecorder(10),
+				Clock:                    clock,
+				Factory:                  api.Factory(),
+				NewCorrelationID:         func() string { return "c0ffee00" },
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: tt.namespace, Name: "foobar"},
+			})
+			assert.NilError(t, err)
+
+			cr := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: tt.namespace, Name: "foobar"}, cr))
+
+			ready := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+			assert.Assert(t, ready != nil)
+			assert.Equal(t, ready.Reason, tt.reason)
+
+			invalid := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionInvalidRequest)
+			if tt.reason != cmapi.CertificateRequestReasonFailed {
+				assert.Assert(t, invalid == nil)
+				return
+			}
+
+			assert.Assert(t, invalid != nil)
+			assert.Equal(t, invalid.Reason, namespaceNotAllowedReason)
+			assert.Equal(t, invalid.Message, fmt.Sprintf("ClusterOriginIssuer foobar does not allow CertificateRequests from namespace %s (correlation ID c0ffee00)", tt.namespace))
+			assert.Equal(t, len(api.SignedHostnames()), 0)
+		})
+	}
+}
+
+func TestCertificateRequestReconcile_AllowedDNS(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	tests := []struct {
+		name     string
+		dnsNames []string
+		message  string
+	}{
+		{
+			name:     "allowed",
+			dnsNames: []string{"example.com", "www.example.com", "api.example.net"},
+		},
+		{
+			name:     "not allowed",
+			dnsNames: []string{"example.com", "example.org", "www.example.net"},
+			message:  "Hostnames not allowed by the issuer: example.org, www.example.net (correlation ID c0ffee00)",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(
+						issuerclient.WithAllowedDNS([]string{"api.example.net"}, []string{"example.com"}),
+					)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+
+			cr := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, cr))
+			invalid := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionInvalidRequest)
+
+			if tt.message == "" {
+				assert.NilError(t, err)
+				assert.Assert(t, invalid == nil)
+				assert.Equal(t, len(api.SignedHostnames()), 1)
+				return
+			}
+
+			assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)), "unexpected error: %v", err)
+			assert.Assert(t, invalid != nil)
+			assert.Equal(t, invalid.Reason, hostnameNotAllowedReason)
+			assert.Equal(t, invalid.Message, tt.message)
+			assert.Equal(t, len(api.SignedHostnames()), 0)
+
+			ready := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+			assert.Assert(t, ready != nil)
+			assert.Equal(t, ready.Reason, cmapi.CertificateRequestReasonFailed)
+		})
+	}
+}
+
+func TestCertificateRequestReconcile_ActiveZones(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	tests := []struct {
+		name     string
+		dnsNames []string
+		message  string
+	}{
+		{
+			name:     "active",
+			dnsNames: []string{"example.com", "www.example.com"},
+		},
+		{
+			name:     "paused",
+			dnsNames: []string{"example.com", "www.example.net"},
+			message:  "Cloudflare zone is not active: zone example.net of hostname www.example.net is paused in Cloudflare. Activate or unpause the zone, as Cloudflare does not serve the certificates of inactive zones (correlation ID c0ffee00)",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(
+						issuerclient.WithResolveZones(),
+						issuerclient.WithRequireActiveZones(),
+					)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{
+				CloudflareZones: []cfapi.Zone{
+					{ID: "1", Name: "example.com", Status: cfapi.ZoneStatusActive},
+					{ID: "2", Name: "example.net", Status: cfapi.ZoneStatusActive, Paused: true},
+				},
+			}
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+
+			cr := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, cr))
+			invalid := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionInvalidRequest)
+
+			if tt.message == "" {
+				assert.NilError(t, err)
+				assert.Assert(t, invalid == nil)
+				assert.Equal(t, len(api.SignedHostnames()), 1)
+				return
+			}
+
+			assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)), "unexpected error: %v", err)
+			assert.Assert(t, invalid != nil)
+			assert.Equal(t, invalid.Reason, zoneInactiveReason)
+			assert.Equal(t, invalid.Message, tt.message)
+			assert.Equal(t, len(api.SignedHostnames()), 0)
+
+			ready := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+			assert.Assert(t, ready != nil)
+			assert.Equal(t, ready.Reason, cmapi.CertificateRequestReasonFailed)
+		})
+	}
+}
+
+func TestCertificateRequestReconcile_VerifyToken(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestDNSNames("www.example.com"),
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(
+				issuerclient.WithResolveZones(),
+				issuerclient.WithVerifyTokenRef("verify-token", "token"),
+			)),
+			issuertesting.ServiceKeySecret("default"),
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "verify-token"},
+				Data:       map[string][]byte{"token": []byte("read-only")},
+			},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	api := &issuertesting.FakeAPI{
+		CloudflareZones: []cfapi.Zone{{ID: "1", Name: "example.com", Status: cfapi.ZoneStatusActive}},
+	}
+	controller := &CertificateRequestController{
+		Client:           client,
+		Reader:           client,
+		Log:              logf.Log,
+		Recorder:         record.NewFakeRecorder(10),
+		Clock:            fakeClock.NewFakeClock(time.Now().Truncate(time.Second)),
+		Factory:          api.Factory(),
+		NewCorrelationID: func() string { return "c0ffee00" },
+	}
+
+	_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+
+	// Certificates are signed with the service key, and zones looked up with
+	// the verification token.
+	assert.DeepEqual(t, api.ServiceKeys(), []string{issuertesting.ServiceKey, ""})
+	assert.DeepEqual(t, api.APITokens(), []string{"", "read-only"})
+}
+
+func TestCertificateRequestReconcile_KeyTypeMismatch(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	tests := []struct {
+		name    string
+		reqType v1.RequestType
+		message string
+	}{
+		{
+			name:    "matching",
+			reqType: v1.RequestTypeOriginECC,
+		},
+		{
+			name:    "mismatched",
+			reqType: v1.RequestTypeOriginRSA,
+			message: "Public key does not match the request type: public key is ECDSA, but the issuer signs OriginRSA certificates for RSA keys. Use an RSA key, such as with privateKey.algorithm RSA on the Certificate, or an issuer with requestType OriginECC (correlation ID c0ffee00)",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(
+						issuerclient.WithRequestType(tt.reqType),
+						issuerclient.WithRequireMatchingKeyType(),
+					)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+
+			cr := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, cr))
+			invalid := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionInvalidRequest)
+
+			if tt.message == "" {
+				assert.NilError(t, err)
+				assert.Assert(t, invalid == nil)
+				assert.Equal(t, len(api.SignedHostnames()), 1)
+				return
+			}
+
+			assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)), "unexpected error: %v", err)
+			assert.Assert(t, invalid != nil)
+			assert.Equal(t, invalid.Reason, keyTypeMismatchReason)
+			assert.Equal(t, invalid.Message, tt.message)
+			assert.Equal(t, len(api.SignedHostnames()), 0)
+
+			ready := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+			assert.Assert(t, ready != nil)
+			assert.Equal(t, ready.Reason, cmapi.CertificateRequestReasonFailed)
+		})
+	}
+}
+
+func TestCertificateRequestReconcile_DryRun(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	dryRunIssuer := func(spec *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+		issuertesting.SetIssuerReadyCondition(v1.ConditionFalse, "VerificationFailed", "Failed to verify credentials with the Cloudflare API")(spec, status)
+		status.Conditions = append(status.Conditions, metav1.Condition{Type: v1.ConditionDryRun, Status: v1.ConditionTrue, Reason: "DryRun"})
+	}
+
+	tests := []struct {
+		name     string
+		issuer   issuertesting.IssuerModifier
+		dnsNames []string
+		status   cmmeta.ConditionStatus
+		reason   string
+		message  string
+	}{
+		{
+			name:     "would sign",
+			issuer:   dryRunIssuer,
+			dnsNames: []string{"www.example.com", "example.com"},
+			status:   cmmeta.ConditionTrue,
+			reason:   "WouldSign",
+			message:  "Certificate request validated: dry run, would sign origin-rsa certificate for hostnames example.com, www.example.com valid for 7 days (correlation ID c0ffee00)",
+		},
+		{
+			name:     "hostname not allowed",
+			issuer:   dryRunIssuer,
+			dnsNames: []string{"example.org"},
+			status:   cmmeta.ConditionFalse,
+			reason:   cmapi.CertificateRequestReasonFailed,
+			message:  "Failed to sign certificate request: hostnames example.org are not allowed by the allowedDNSNames or allowedDNSZones of the issuer (correlation ID c0ffee00)",
+		},
+		{
+			name:     "issuer not dry run",
+			issuer:   issuertesting.SetIssuerSpec(),
+			dnsNames: []string{"example.com"},
+			status:   cmmeta.ConditionFalse,
+			reason:   cmapi.CertificateRequestReasonPending,
+			message:  "OriginIssuer default/foobar is not Ready (correlation ID c0ffee00)",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					issuertesting.CertificateRequest("default", "foobar",
+						issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+						issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					),
+					issuertesting.OriginIssuer("default", "foobar", tt.issuer, issuertesting.SetIssuerSpec(
+						issuerclient.WithAllowedDNS(nil, []string{"example.com"}),
+						issuerclient.WithIncludeChain(),
+					)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+				DryRun:           true,
+			}
+
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+
+			cr := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, cr))
+
+			assert.Equal(t, len(api.SignedHostnames()), 0)
+			assert.Assert(t, cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady) == nil)
+			assert.Assert(t, cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionInvalidRequest) == nil)
+			assert.Assert(t, cr.Status.FailureTime == nil)
+			assert.Equal(t, len(cr.Status.Certificate), 0)
+
+			dryRun := cmutil.GetCertificateRequestCondition(cr, dryRunCondition)
+			assert.Assert(t, dryRun != nil)
+			assert.Equal(t, dryRun.Status, tt.status)
+			assert.Equal(t, dryRun.Reason, tt.reason)
+			assert.Equal(t, dryRun.Message, tt.message)
+		})
+	}
 }
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
+	"github.com/go-logr/logr"
+	certificates "k8s.io/api/certificates/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ClusterOriginIssuerSignerPrefix prefixes the name of a ClusterOriginIssuer
+// in the signerName of the Kubernetes CertificateSigningRequests it signs.
+const ClusterOriginIssuerSignerPrefix = "clusteroriginissuers.cert-manager.k8s.cloudflare.com/"
+
+// CertificateSigningRequestController implements a controller signing the
+// Kubernetes CertificateSigningRequests of ClusterOriginIssuers, for clients
+// requesting certificates without cert-manager. Only approved requests are
+// signed.
+type CertificateSigningRequestController struct {
+	client.Client
+	Reader                   client.Reader
+	ClusterResourceNamespace string
+	Log                      logr.Logger
+	Factory                  cfapi.Factory
+	Recorder                 record.EventRecorder
+	Clock                    clock.Clock
+
+	// Exchanger exchanges ServiceAccount tokens for the credentials of
+	// issuers authenticating with a token exchange, which fail without it.
+	Exchanger *tokenexchange.Exchanger
+
+	// Vault reads the credentials of issuers authenticating with Vault,
+	// which fail without it.
+	Vault *vault.Client
+
+	// DefaultDuration is the validity requested for CertificateSigningRequests
+	// without an expirationSeconds, unless their issuer sets a default.
+	DefaultDuration time.Duration
+
+	// ShutdownGracePeriod is how long reconciles in flight when the
+	// controller shuts down may still sign their CertificateSigningRequest.
+	// They are cancelled at once when zero.
+	ShutdownGracePeriod time.Duration
+
+	// DefaultClusterIssuer is the name of the ClusterOriginIssuer signing
+	// requests for the signer of DefaultClusterIssuerAlias.
+	DefaultClusterIssuer string
+
+	// NewCorrelationID generates the ID correlating the logs, events and
+	// condition messages of each reconcile. Defaults to a short random ID.
+	NewCorrelationID func() string
+
+	// MessageTemplates override the messages of the Failed conditions and
+	// events of CertificateSigningRequests, by reason.
+	MessageTemplates MessageTemplates
+}
+
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,verbs=sign,resourceNames=clusteroriginissuers.cert-manager.k8s.cloudflare.com/*
+
+// Reconcile signs an approved CertificateSigningRequest with the
+// ClusterOriginIssuer of its signerName, failing it with a Failed condition
+// when it can never be signed.
+func (r *CertificateSigningRequestController) Reconcile(ctx context.Context, csr *certificates.CertificateSigningRequest) (reconcile.Result, error) {
+	name, ok := strings.CutPrefix(csr.Spec.SignerName, ClusterOriginIssuerSignerPrefix)
+	if !ok {
+		return reconcile.Result{}, nil
+	}
+
+	newID := r.NewCorrelationID
+	if newID == nil {
+		newID = newCorrelationID
+	}
+	id := newID()
+	ctx, cancel := withShutdownGracePeriod(ctx, r.Clock, r.ShutdownGracePeriod)
+	defer cancel()
+	ctx = withCorrelationID(ctx, id)
+	log := r.Log.WithValues("certificatesigningrequest", csr.Name, "correlation_id", id, "issuer_name", name)
+
+	if len(csr.Status.Certificate) > 0 {
+		log.V(4).Info("CertificateSigningRequest is already signed. Ignoring.")
+		return reconcile.Result{}, nil
+	}
+	if csrHasCondition(csr, certificates.CertificateFailed) {
+		log.V(4).Info("CertificateSigningRequest is Failed. Ignoring.")
+		return reconcile.Result{}, nil
+	}
+	if csrHasCondition(csr, certificates.CertificateDenied) {
+		log.V(4).Info("CertificateSigningRequest has been denied. Ignoring.")
+		return reconcile.Result{}, nil
+	}
+	// Unlike CertificateRequests, CertificateSigningRequests are always
+	// approved before being signed, and updated once they are.
+	if !csrHasCondition(csr, certificates.CertificateApproved) {
+		log.V(4).Info("CertificateSigningRequest has not been approved yet. Ignoring.")
+		return reconcile.Result{}, nil
+	}
+
+	cr := csrCertificateRequest(csr, clusterIssuerName(name, r.DefaultClusterIssuer))
+	resps, err := r.signer().Sign(ctx, log, cr.Spec.IssuerRef.Name, cr, cfapi.Metadata{
+		CorrelationID: id,
+		ObjectKind:    "CertificateSigningRequest",
+		ObjectName:    csr.Name,
+		ObjectUID:     csr.UID,
+	})
+
+	if delay, ok := requeueDelay(err); ok {
+		log.Error(err, "requeue-ing after transient API error", "after", delay)
+		recordEvent(ctx, r.Recorder, csr, core.EventTypeWarning, "Pending", fmt.Sprintf("Temporary Cloudflare API error, retrying in %s: %v", delay, err))
+
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+
+	var signErr *SignError
+	if errors.As(err, &signErr) {
+		log.Error(err, "failed to sign certificate signing request")
+		if err := r.fail(ctx, csr, signErr.Reason, signErr.Message); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	if err != nil {
+		log.Error(err, "failed to sign certificate signing request")
+		recordEvent(ctx, r.Recorder, csr, core.EventTypeWarning, "Pending", fmt.Sprintf("Failed to sign certificate signing request, retrying: %v", err))
+
+		return reconcile.Result{}, err
+	}
+
+	// Only the certificate of the request type is published, as the
+	// certificate of a CertificateSigningRequest holds a single leaf,
+	// followed by its chain.
+	var (
+		ids    []string
+		others bytes.Buffer
+	)
+	for i, resp := range resps {
+		ids = append(ids, resp.Id)
+		if i > 0 {
+			appendPEM(&others, []byte(resp.Certificate))
+		}
+	}
+
+	err = recordSigned(ctx, r.Client, r.Reader, csr, func() {
+		metav1.SetMetaDataAnnotation(&csr.ObjectMeta, v1.CertificateIDAnnotation, strings.Join(ids, ","))
+		metav1.SetMetaDataAnnotation(&csr.ObjectMeta, v1.CertificateExpirationAnnotation, resps[0].Expiration.UTC().Format(time.RFC3339))
+		if others.Len() > 0 {
+			metav1.SetMetaDataAnnotation(&csr.ObjectMeta, v1.DualStackCertificateAnnotation, others.String())
+		}
+	})
+	if err != nil {
+		log.Error(err, "failed to record certificate ID", "id", strings.Join(ids, ","))
+
+		return reconcile.Result{}, err
+	}
+
+	csr.Status.Certificate = []byte(resps[0].Certificate)
+	if err := r.Client.Status().Update(ctx, csr); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	recordEvent(ctx, r.Recorder, csr, core.EventTypeNormal, certmanager.CertificateRequestReasonIssued, "Certificate issued")
+
+	return reconcile.Result{}, nil
+}
+
+// signer returns the ClusterIssuerSigner signing the requests of the
+// controller.
+func (r *CertificateSigningRequestController) signer() *ClusterIssuerSigner {
+	return &ClusterIssuerSigner{
+		Client:                   r.Client,
+		Reader:                   r.Reader,
+		ClusterResourceNamespace: r.ClusterResourceNamespace,
+		Factory:                  r.Factory,
+		Clock:                    r.Clock,
+		Exchanger:                r.Exchanger,
+		Vault:                    r.Vault,
+		DefaultDuration:          r.DefaultDuration,
+	}
+}
+
+// fail sets the Failed condition of the CertificateSigningRequest, and
+// records an event with the same reason and message.
+func (r *CertificateSigningRequestController) fail(ctx context.Context, csr *certificates.CertificateSigningRequest, reason, message string) error {
+	message = r.MessageTemplates.render(MessageData{
+		Reason:     reason,
+		Message:    message,
+		Kind:       "CertificateSigningRequest",
+		Name:       csr.Name,
+		IssuerKind: "ClusterOriginIssuer",
+		IssuerName: strings.TrimPrefix(csr.Spec.SignerName, ClusterOriginIssuerSignerPrefix),
+	})
+	recordEvent(ctx, r.Recorder, csr, core.EventTypeWarning, reason, message)
+	message = withCorrelationIDMessage(ctx, message)
+
+	now := metav1.NewTime(r.Clock.Now())
+	csr.Status.Conditions = append(csr.Status.Conditions, certificates.CertificateSigningRequestCondition{
+		Type:               certificates.CertificateFailed,
+		Status:             core.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+	})
+
+	return r.Client.Status().Update(ctx, csr)
+}
+
+// csrHasCondition reports whether the CertificateSigningRequest has a true
+// condition of the type.
+func csrHasCondition(csr *certificates.CertificateSigningRequest, conditionType certificates.RequestConditionType) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == conditionType && c.Status == core.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// csrCertificateRequest returns the CertificateRequest the provisioner signs
+// for a CertificateSigningRequest of the ClusterOriginIssuer, with its CSR,
+// usages and requested duration.
+func csrCertificateRequest(csr *certificates.CertificateSigningRequest, issuer string) *certmanager.CertificateRequest {
+	cr := &certmanager.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: csr.Name, UID: csr.UID},
+		Spec: certmanager.CertificateRequestSpec{
+			Request: csr.Spec.Request,
+			IssuerRef: cmmeta.ObjectReference{
+				Group: v1.GroupVersion.Group,
+				Kind:  "ClusterOriginIssuer",
+				Name:  issuer,
+			},
+		},
+	}
+
+	if csr.Spec.ExpirationSeconds != nil {
+		cr.Spec.Duration = &metav1.Duration{Duration: time.Duration(*csr.Spec.ExpirationSeconds) * time.Second}
+	}
+
+	for _, usage := range csr.Spec.Usages {
+		cr.Spec.Usages = append(cr.Spec.Usages, certmanager.KeyUsage(usage))
+	}
+
+	return cr
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	certificates "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestCertificateSigningRequestReconcile(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	request := issuertesting.CertificateRequest("default", "foobar",
+		issuertesting.SetCertificateRequestDNSNames("example.com", "www.example.com"),
+	).Spec.Request
+
+	csr := func(signerName string, conditions ...certificates.RequestConditionType) *certificates.CertificateSigningRequest {
+		expiration := int32(7 * 24 * 60 * 60)
+		csr := &certificates.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+			Spec: certificates.CertificateSigningRequestSpec{
+				SignerName:        signerName,
+				Request:           request,
+				ExpirationSeconds: &expiration,
+				Usages:            []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment, certificates.UsageServerAuth},
+			},
+		}
+		for _, c := range conditions {
+			csr.Status.Conditions = append(csr.Status.Conditions, certificates.CertificateSigningRequestCondition{
+				Type:   c,
+				Status: corev1.ConditionTrue,
+			})
+		}
+
+		return csr
+	}
+
+	tests := []struct {
+		name            string
+		csr             *certificates.CertificateSigningRequest
+		issuer          *v1.ClusterOriginIssuer
+		expectSigned    bool
+		expectFailed    string
+		expectError     bool
+		expectHostnames [][]string
+	}{
+		{
+			name:            "approved",
+			csr:             csr(ClusterOriginIssuerSignerPrefix+"foobar", certificates.CertificateApproved),
+			issuer:          issuertesting.ClusterOriginIssuer("foobar"),
+			expectSigned:    true,
+			expectHostnames: [][]string{{"example.com", "www.example.com"}},
+		},
+		{
+			name:   "not approved",
+			csr:    csr(ClusterOriginIssuerSignerPrefix + "foobar"),
+			issuer: issuertesting.ClusterOriginIssuer("foobar"),
+		},
+		{
+			name:   "denied",
+			csr:    csr(ClusterOriginIssuerSignerPrefix+"foobar", certificates.CertificateApproved, certificates.CertificateDenied),
+			issuer: issuertesting.ClusterOriginIssuer("foobar"),
+		},
+		{
+			name:   "other signer",
+			csr:    csr("kubernetes.io/kube-apiserver-client", certificates.CertificateApproved),
+			issuer: issuertesting.ClusterOriginIssuer("foobar"),
+		},
+		{
+			name: "issuer not ready",
+			csr:  csr(ClusterOriginIssuerSignerPrefix+"foobar", certificates.CertificateApproved),
+			issuer: issuertesting.ClusterOriginIssuer("foobar",
+				issuertesting.SetIssuerReadyCondition(v1.ConditionFalse, "Faulted", "credentials rejected"),
+			),
+			expectError: true,
+		},
+		{
+			name: "allowed namespaces",
+			csr:  csr(ClusterOriginIssuerSignerPrefix+"foobar", certificates.CertificateApproved),
+			issuer: issuertesting.ClusterOriginIssuer("foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithAllowedNamespaces(nil, "default")),
+			),
+			expectFailed: "ClusterOriginIssuer foobar only signs the CertificateRequests of its allowedNamespaces, and not requests without a namespace (correlation ID c0ffee00)",
+		},
+		{
+			name: "hostname not allowed",
+			csr:  csr(ClusterOriginIssuerSignerPrefix+"foobar", certificates.CertificateApproved),
+			issuer: issuertesting.ClusterOriginIssuer("foobar",
+				issuertesting.SetIssuerSpec(issuerclient.WithAllowedDNS([]string{"example.com"}, nil)),
+			),
+			expectFailed: "Failed to sign certificate signing request",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					tt.csr,
+					tt.issuer,
+					issuertesting.ServiceKeySecret("super-secret"),
+				).
+				WithStatusSubresource(&certificates.CertificateSigningRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateSigningRequestController{
+				Client:                   client,
+				Reader:                   client,
+				ClusterResourceNamespace: "super-secret",
+				Log:                      logf.Log,
+				Recorder:                 record.NewFakeRecorder(10),
+				Clock:                    fakeClock.NewFakeClock(time.Now()),
+				Factory:                  api.Factory(),
+				NewCorrelationID:         func() string { return "c0ffee00" },
+			}
+
+			namespaceName := types.NamespacedName{Name: "foobar"}
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+			if tt.expectError {
+				assert.Assert(t, err != nil, "expected an error")
+			} else if tt.expectFailed == "" {
+				assert.NilError(t, err)
+			}
+
+			got := &certificates.CertificateSigningRequest{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.Equal(t, len(got.Status.Certificate) > 0, tt.expectSigned)
+			assert.Equal(t, len(api.SignedHostnames()), len(tt.expectHostnames))
+
+			if tt.expectSigned {
+				assert.Assert(t, got.Annotations[v1.CertificateIDAnnotation] != "")
+				assert.DeepEqual(t, api.SignedHostnames(), tt.expectHostnames)
+				assert.DeepEqual(t, api.SignedValidities(), []int{7})
+			}
+
+			if tt.expectFailed != "" {
+				assert.Assert(t, csrHasCondition(got, certificates.CertificateFailed), "expected a Failed condition")
+				message := got.Status.Conditions[len(got.Status.Conditions)-1].Message
+				assert.Assert(t, strings.HasPrefix(message, tt.expectFailed), "unexpected message: %s", message)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/metrics"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterIssuerSigner signs requests with ClusterOriginIssuers for clients
+// requesting certificates without a CertificateRequest, such as Kubernetes
+// CertificateSigningRequests or Istio sidecars. Requests are handed over as
+// CertificateRequests, which are never stored.
+type ClusterIssuerSigner struct {
+	Client                   client.Reader
+	Reader                   client.Reader
+	ClusterResourceNamespace string
+	Factory                  cfapi.Factory
+	Clock                    clock.Clock
+
+	// Exchanger exchanges ServiceAccount tokens for the credentials of
+	// issuers authenticating with a token exchange, which fail without it.
+	Exchanger *tokenexchange.Exchanger
+
+	// Vault reads the credentials of issuers authenticating with Vault,
+	// which fail without it.
+	Vault *vault.Client
+
+	// DefaultDuration is the validity requested for requests without a
+	// duration, unless their issuer sets a default.
+	DefaultDuration time.Duration
+}
+
+// SignError is returned by ClusterIssuerSigner for requests that can never be
+// signed, with the reason and message of the condition failing them.
+type SignError struct {
+	Reason  string
+	Message string
+}
+
+func (e *SignError) Error() string {
+	return e.Message
+}
+
+// Sign signs the request with the named ClusterOriginIssuer, which must be
+// Ready. Requests that can never be signed fail with a SignError, while
+// other errors, such as the transient errors of the Cloudflare API, are worth
+// retrying.
+func (s *ClusterIssuerSigner) Sign(ctx context.Context, log logr.Logger, name string, cr *certmanager.CertificateRequest, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+	return s.sign(ctx, log, name, cr, nil, meta)
+}
+
+// SignHostnames signs the request like Sign, but for the hostnames rather
+// than for the DNS names of its CSR, whose subject alternative names are
+// ignored. A single certificate, of the issuer's request type, is signed even
+// by dual-stack issuers, for clients that can only use one.
+func (s *ClusterIssuerSigner) SignHostnames(ctx context.Context, log logr.Logger, name string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+	return s.sign(ctx, log, name, cr, hostnames, meta)
+}
+
+func (s *ClusterIssuerSigner) sign(ctx context.Context, log logr.Logger, name string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+	iss := v1.ClusterOriginIssuer{}
+	if err := s.Client.Get(ctx, types.NamespacedName{Name: name}, &iss); err != nil {
+		return nil, fmt.Errorf("failed to retrieve ClusterOriginIssuer %s: %w", name, err)
+	}
+
+	if !IssuerStatusHasCondition(iss.Status, metav1.Condition{Type: v1.ConditionReady, Status: v1.ConditionTrue}) {
+		return nil, fmt.Errorf("ClusterOriginIssuer %s is not Ready", iss.Name)
+	}
+
+	// The requests have no namespace, so issuers restricting the namespaces
+	// they sign for never sign them.
+	if iss.Spec.AllowedNamespaces != nil {
+		return nil, &SignError{Reason: namespaceNotAllowedReason, Message: fmt.Sprintf("ClusterOriginIssuer %s only signs the CertificateRequests of its allowedNamespaces, and not requests without a namespace", iss.Name)}
+	}
+
+	if message := unsupportedByOriginCA(cr); message != "" {
+		return nil, &SignError{Reason: unsupportedByOriginCAReason, Message: message}
+	}
+
+	// Only CertificateRequests roll out changed configurations, so other
+	// requests are signed with the stable configuration in the meantime.
+	spec := iss.Spec
+	if canaryInProgress(spec, iss.Status) {
+		spec = withConfiguration(spec, *iss.Status.StableConfiguration)
+	}
+
+	spec, err := zoneCredentialSpec(spec, cr)
+	if err != nil {
+		return nil, &SignError{Reason: certmanager.CertificateRequestReasonFailed, Message: fmt.Sprintf("Failed to select credentials: %v", err)}
+	}
+
+	creds, err := s.credentials(ctx, spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the credentials of ClusterOriginIssuer %s: %w", iss.Name, err)
+	}
+
+	c, err := s.Factory.APIWith(creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API client: %w", err)
+	}
+
+	lookup, err := zoneLookupAPI(ctx, s.Reader, s.Factory, spec, s.ClusterResourceNamespace, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the verification token of ClusterOriginIssuer %s: %w", iss.Name, err)
+	}
+
+	opts, err := issuerProvisionerOptions(spec, c, lookup, s.DefaultDuration, s.Clock)
+	if err != nil {
+		return nil, &SignError{Reason: certmanager.CertificateRequestReasonFailed, Message: fmt.Sprintf("Failed to sign certificate signing request: %v", err)}
+	}
+
+	if hostnames != nil {
+		opts = append(opts, provisioners.WithHostnames(hostnames...), provisioners.WithDualStack(false))
+	}
+
+	p, err := provisioners.New(c, spec.RequestType, log, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provisioner: %w", err)
+	}
+
+	meta.IssuerKind = "ClusterOriginIssuer"
+	meta.IssuerName = iss.Name
+
+	start := s.Clock.Now()
+	resps, err := p.Sign(cfapi.WithMetadata(ctx, meta), cr)
+	if !errors.Is(err, provisioners.ErrInvalidRequest) {
+		metrics.ObserveSign(metrics.Issuer{Kind: "ClusterOriginIssuer", Name: iss.Name}, s.Clock.Since(start), err)
+	}
+
+	if _, ok := requeueDelay(err); ok {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, &SignError{Reason: certmanager.CertificateRequestReasonFailed, Message: fmt.Sprintf("Failed to sign certificate signing request: %v", err)}
+	}
+
+	return resps, nil
+}
+
+// credentials returns the Cloudflare API credentials of the issuer spec, read
+// from the cluster resource namespace.
+func (s *ClusterIssuerSigner) credentials(ctx context.Context, spec v1.OriginIssuerSpec) (cfapi.Credentials, error) {
+	if hasExternalCredentials(spec.Auth) {
+		return externalCredentials(ctx, s.Exchanger, s.Vault, spec, s.ClusterResourceNamespace)
+	}
+
+	secretRef := issuerAuthSecretRef(spec.Auth)
+	var secret core.Secret
+	if err := s.Reader.Get(ctx, types.NamespacedName{Namespace: s.ClusterResourceNamespace, Name: secretRef.Name}, &secret); err != nil {
+		return cfapi.Credentials{}, err
+	}
+
+	credential, ok := secret.Data[secretRef.Key]
+	if !ok {
+		return cfapi.Credentials{}, &secretKeyError{Secret: secret.Name, Key: secretRef.Key}
+	}
+
+	return issuerCredentials(spec, credential), nil
+}
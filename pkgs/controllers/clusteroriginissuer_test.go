@@ -14,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	fakeClock "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -36,6 +37,7 @@ func TestClusterOriginIssuerReconcile(t *testing.T) {
 		name          string
 		objects       []runtime.Object
 		expected      v1.OriginIssuerStatus
+		verifyErr     error
 		error         string
 		namespaceName types.NamespacedName
 	}{
@@ -67,15 +69,16 @@ func TestClusterOriginIssuerReconcile(t *testing.T) {
 				},
 			},
 			expected: v1.OriginIssuerStatus{
-				Conditions: []v1.OriginIssuerCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               v1.ConditionReady,
 						Status:             v1.ConditionTrue,
-						LastTransitionTime: &now,
+						LastTransitionTime: now,
 						Reason:             "Verified",
 						Message:            "ClusterOriginIssuer verified and ready to sign certificates",
 					},
 				},
+				LastVerifiedTime: &now,
 			},
 			namespaceName: types.NamespacedName{
 				Name: "foo",
@@ -100,15 +103,16 @@ func TestClusterOriginIssuerReconcile(t *testing.T) {
 				},
 			},
 			expected: v1.OriginIssuerStatus{
-				Conditions: []v1.OriginIssuerCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               v1.ConditionReady,
 						Status:             v1.ConditionFalse,
-						LastTransitionTime: &now,
+						LastTransitionTime: now,
 						Reason:             "NotFound",
 						Message:            `Failed to retrieve auth secret: secrets "issuer-service-key" not found`,
 					},
 				},
+				FailedAttempts: 1,
 			},
 			error: `secrets "issuer-service-key" not found`,
 			namespaceName: types.NamespacedName{
@@ -141,15 +145,16 @@ func TestClusterOriginIssuerReconcile(t *testing.T) {
 				},
 			},
 			expected: v1.OriginIssuerStatus{
-				Conditions: []v1.OriginIssuerCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               v1.ConditionReady,
 						Status:             v1.ConditionFalse,
-						LastTransitionTime: &now,
+						LastTransitionTime: now,
 						Reason:             "NotFound",
 						Message:            `Failed to retrieve auth secret: secret issuer-service-key does not contain key "key"`,
 					},
 				},
+				FailedAttempts: 1,
 			},
 			error: `secret issuer-service-key does not contain key "key"`,
 			namespaceName: types.NamespacedName{
@@ -171,11 +176,14 @@ func TestClusterOriginIssuerReconcile(t *testing.T) {
 				Client:                   client,
 				Reader:                   client,
 				ClusterResourceNamespace: "super-secret",
-				Factory: cfapi.FactoryFunc(func(serviceKey []byte) (cfapi.Interface, error) {
-					return nil, nil
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					return VerifierFunc(func(ctx context.Context) error {
+						return tt.verifyErr
+					}), nil
 				}),
-				Clock: clock,
-				Log:   logf.Log,
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
 			}
 
 			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
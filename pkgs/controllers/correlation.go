@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// correlationIDPrefix introduces the correlation ID appended to condition
+// messages.
+const correlationIDPrefix = " (correlation ID "
+
+type correlationIDKey struct{}
+
+// withCorrelationID returns a copy of ctx carrying the correlation ID of a
+// reconcile.
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// correlationIDFromContext returns the correlation ID carried by ctx, or the
+// empty string.
+func correlationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// newCorrelationID returns a short random ID, unique enough to find the log
+// lines of a reconcile across replicas.
+func newCorrelationID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// withCorrelationIDMessage appends the correlation ID carried by ctx, if any,
+// to a user-visible message, after sanitizing it with statusMessage.
+func withCorrelationIDMessage(ctx context.Context, message string) string {
+	message = statusMessage(message)
+	id := correlationIDFromContext(ctx)
+	if id == "" {
+		return message
+	}
+
+	return fmt.Sprintf("%s%s%s)", message, correlationIDPrefix, id)
+}
+
+// trimCorrelationID returns a message without its correlation ID.
+func trimCorrelationID(message string) string {
+	if i := strings.LastIndex(message, correlationIDPrefix); i >= 0 && strings.HasSuffix(message, ")") {
+		return message[:i]
+	}
+
+	return message
+}
+
+// recordEvent records an event on obj, after sanitizing its message with
+// statusMessage. The correlation ID carried by ctx, if any, is set as the
+// event's CorrelationIDAnnotation rather than appended to its message, as a
+// message differing on each reconcile would defeat the aggregation of the
+// events repeated by retries.
+func recordEvent(ctx context.Context, recorder record.EventRecorder, obj runtime.Object, eventtype, reason, message string) {
+	message = statusMessage(message)
+	id := correlationIDFromContext(ctx)
+	if id == "" {
+		recorder.Event(obj, eventtype, reason, message)
+		return
+	}
+
+	recorder.AnnotatedEventf(obj, map[string]string{v1.CorrelationIDAnnotation: id}, eventtype, reason, "%s", message)
+}
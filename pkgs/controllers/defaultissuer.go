@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultClusterIssuerAlias is the name CertificateRequests reference a
+// ClusterOriginIssuer by to be signed by the default ClusterOriginIssuer,
+// if one is configured, whatever its name in the cluster.
+const DefaultClusterIssuerAlias = "default"
+
+// clusterIssuerName returns the name of the ClusterOriginIssuer referenced
+// by name, resolving DefaultClusterIssuerAlias to the default issuer.
+func clusterIssuerName(name, defaultIssuer string) string {
+	if name == DefaultClusterIssuerAlias && defaultIssuer != "" {
+		return defaultIssuer
+	}
+
+	return name
+}
+
+// defaultIssuerFallbackReason is the reason of the event recorded on
+// CertificateRequests signed by the default ClusterOriginIssuer in place of
+// an issuer that doesn't exist.
+const defaultIssuerFallbackReason = "DefaultIssuerFallback"
+
+// issuerRef returns the kind and name of the issuer signing the
+// CertificateRequest, resolving DefaultClusterIssuerAlias, and whether it is
+// the default ClusterOriginIssuer in place of the issuer referenced. With
+// DefaultIssuerFallback, the default issuer takes the place of an issuer the
+// apiserver reports doesn't exist, or of any issuer once recorded in the
+// ResolvedIssuerAnnotation.
+func (r *CertificateRequestController) issuerRef(ctx context.Context, cr *certmanager.CertificateRequest) (kind, name string, fallback bool, err error) {
+	kind, name = cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name
+
+	var (
+		key types.NamespacedName
+		obj client.Object
+	)
+	switch kind {
+	case "OriginIssuer":
+		key, obj = types.NamespacedName{Namespace: cr.Namespace, Name: name}, &v1.OriginIssuer{}
+	case "ClusterOriginIssuer":
+		name = clusterIssuerName(name, r.DefaultClusterIssuer)
+		key, obj = types.NamespacedName{Name: name}, &v1.ClusterOriginIssuer{}
+	default:
+		return kind, name, false, nil
+	}
+
+	if !r.DefaultIssuerFallback || r.DefaultClusterIssuer == "" || (kind == "ClusterOriginIssuer" && name == r.DefaultClusterIssuer) {
+		return kind, name, false, nil
+	}
+
+	if cr.Annotations[v1.ResolvedIssuerAnnotation] == "ClusterOriginIssuer/"+r.DefaultClusterIssuer {
+		return "ClusterOriginIssuer", r.DefaultClusterIssuer, true, nil
+	}
+
+	// The cache may not have seen an issuer created moments ago, so the
+	// apiserver decides whether it exists.
+	if err := r.Reader.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "ClusterOriginIssuer", r.DefaultClusterIssuer, true, nil
+		}
+
+		return kind, name, false, err
+	}
+
+	return kind, name, false, nil
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestClusterIssuerName(t *testing.T) {
+	assert.Equal(t, clusterIssuerName("default", "production"), "production")
+	assert.Equal(t, clusterIssuerName("staging", "production"), "staging")
+	assert.Equal(t, clusterIssuerName("default", ""), "default")
+}
+
+func TestCertificateRequestReconcile_DefaultClusterIssuer(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+	if err != nil {
+		t.Fatalf("creating CSR: %s", err)
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			cmgen.CertificateRequest("foobar",
+				cmgen.SetCertificateRequestNamespace("default"),
+				cmgen.SetCertificateRequestCSR(csr),
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+					Name:  DefaultClusterIssuerAlias,
+					Kind:  "ClusterOriginIssuer",
+					Group: "cert-manager.k8s.cloudflare.com",
+				}),
+			),
+			&v1.ClusterOriginIssuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "production"},
+				Spec: v1.OriginIssuerSpec{
+					RequestType: v1.RequestTypeOriginECC,
+					Auth: v1.OriginIssuerAuthentication{
+						ServiceKeyRef: v1.SecretKeySelector{Name: "service-key-issuer", Key: "key"},
+					},
+				},
+				Status: v1.OriginIssuerStatus{
+					Conditions: []metav1.Condition{{Type: v1.ConditionReady, Status: v1.ConditionTrue}},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "service-key-issuer", Namespace: "super-secret"},
+				Data:       map[string][]byte{"key": []byte("djEuMC0weDAwQkFCMTBD")},
+			},
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	controller := &CertificateRequestController{
+		Client:                   client,
+		Reader:                   client,
+		ClusterResourceNamespace: "super-secret",
+		Log:                      logf.Log,
+		Recorder:                 record.NewFakeRecorder(10),
+		Clock:                    clock,
+		DefaultClusterIssuer:     "production",
+		NewCorrelationID:         func() string { return "c0ffee00" },
+		Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+			return SignerFunc(func(ctx context.Context, sr *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				return &cfapi.SignResponse{Id: "1", Certificate: "bogus"}, nil
+			}), nil
+		}),
+	}
+
+	_, err = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+	})
+	assert.NilError(t, err)
+
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+	assert.DeepEqual(t, got.Status.Certificate, []byte("bogus"))
+}
+
+func TestCertificateRequestReconcile_DefaultIssuerFallback(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	resolved := cmgen.SetCertificateRequestAnnotations(map[string]string{v1.ResolvedIssuerAnnotation: "ClusterOriginIssuer/production"})
+	// The default issuer is verified for dry run mode as well.
+	dryRunReady := func(_ *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+		status.Conditions = append(status.Conditions, metav1.Condition{Type: v1.ConditionDryRun, Status: v1.ConditionTrue, Reason: "DryRun"})
+	}
+
+	tests := []struct {
+		name          string
+		cr            *cmapi.CertificateRequest
+		defaultIssuer string
+		fallback      bool
+		dryRun        bool
+		event         string
+		resolved      string
+		error         string
+	}{
+		{
+			name:          "missing OriginIssuer",
+			cr:            issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("missing")),
+			defaultIssuer: "production",
+			fallback:      true,
+			event:         "Normal DefaultIssuerFallback OriginIssuer missing not found, signing with the default ClusterOriginIssuer production map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			resolved:      "ClusterOriginIssuer/production",
+		},
+		{
+			name:          "missing OriginIssuer, dry run",
+			cr:            issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("missing")),
+			defaultIssuer: "production",
+			fallback:      true,
+			dryRun:        true,
+		},
+		{
+			name:          "existing OriginIssuer",
+			cr:            issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			defaultIssuer: "production",
+			fallback:      true,
+		},
+		{
+			name:          "missing ClusterOriginIssuer",
+			cr:            issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestClusterOriginIssuer("missing")),
+			defaultIssuer: "production",
+			fallback:      true,
+			event:         "Normal DefaultIssuerFallback ClusterOriginIssuer missing not found, signing with the default ClusterOriginIssuer production map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+			resolved:      "ClusterOriginIssuer/production",
+		},
+		{
+			name:          "recorded fallback, issuer created since",
+			cr:            issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar"), resolved),
+			defaultIssuer: "production",
+			fallback:      true,
+			resolved:      "ClusterOriginIssuer/production",
+		},
+		{
+			name:          "recorded fallback, fallback disabled",
+			cr:            issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("missing"), resolved),
+			defaultIssuer: "production",
+			error:         `originissuers.cert-manager.k8s.cloudflare.com "missing" not found`,
+		},
+		{
+			name:     "no default issuer",
+			cr:       issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("missing")),
+			fallback: true,
+			error:    `originissuers.cert-manager.k8s.cloudflare.com "missing" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					tt.cr,
+					issuertesting.OriginIssuer("default", "foobar"),
+					issuertesting.ClusterOriginIssuer("production", dryRunReady),
+					issuertesting.ServiceKeySecret("default"),
+					issuertesting.ServiceKeySecret("super-secret"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			recorder := record.NewFakeRecorder(10)
+			controller := &CertificateRequestController{
+				Client:                   client,
+				Reader:                   client,
+				ClusterResourceNamespace: "super-secret",
+				Log:                      logf.Log,
+				Recorder:                 recorder,
+				Clock:                    clock,
+				Factory:                  api.Factory(),
+				DefaultClusterIssuer:     tt.defaultIssuer,
+				DefaultIssuerFallback:    tt.fallback,
+				NewCorrelationID:         func() string { return "c0ffee00" },
+				DryRun:                   tt.dryRun,
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			close(recorder.Events)
+
+			var fallbacks []string
+			for event := range recorder.Events {
+				if strings.Contains(event, defaultIssuerFallbackReason) {
+					fallbacks = append(fallbacks, event)
+				}
+			}
+
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Equal(t, len(api.SignedHostnames()), 0)
+				assert.Equal(t, len(fallbacks), 0)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+			assert.Equal(t, got.Annotations[v1.ResolvedIssuerAnnotation], tt.resolved)
+
+			if tt.dryRun {
+				assert.Equal(t, len(api.SignedHostnames()), 0)
+				assert.Equal(t, cmutil.GetCertificateRequestCondition(got, dryRunCondition).Reason, "WouldSign")
+			} else {
+				assert.Equal(t, len(api.SignedHostnames()), 1)
+			}
+
+			if tt.event == "" {
+				assert.Equal(t, len(fallbacks), 0)
+			} else {
+				assert.DeepEqual(t, fallbacks, []string{tt.event})
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// IssuerSecretIndex indexes OriginIssuers and ClusterOriginIssuers by the
+	// names of the Secrets they reference for authentication.
+	IssuerSecretIndex = "spec.auth.secretName"
+
+	// CertificateRequestIssuerIndex indexes CertificateRequests by the kind
+	// and name of the issuer they reference, if the issuer belongs to the
+	// OriginIssuer API group.
+	CertificateRequestIssuerIndex = "spec.issuerRef"
+)
+
+// SetupIndexes registers the field indexes used by the controllers to map a
+// changed Secret or issuer to exactly the objects depending on it, instead of
+// re-reconciling every object in a namespace.
+func SetupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &v1.OriginIssuer{}, IssuerSecretIndex, indexOriginIssuerSecrets); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &v1.ClusterOriginIssuer{}, IssuerSecretIndex, indexClusterOriginIssuerSecrets); err != nil {
+		return err
+	}
+
+	return indexer.IndexField(ctx, &certmanager.CertificateRequest{}, CertificateRequestIssuerIndex, indexCertificateRequestIssuer)
+}
+
+func indexOriginIssuerSecrets(obj client.Object) []string {
+	iss, ok := obj.(*v1.OriginIssuer)
+	if !ok {
+		return nil
+	}
+
+	return issuerSecretNames(iss.Spec)
+}
+
+func indexClusterOriginIssuerSecrets(obj client.Object) []string {
+	iss, ok := obj.(*v1.ClusterOriginIssuer)
+	if !ok {
+		return nil
+	}
+
+	return issuerSecretNames(iss.Spec)
+}
+
+func indexCertificateRequestIssuer(obj client.Object) []string {
+	cr, ok := obj.(*certmanager.CertificateRequest)
+	if !ok {
+		return nil
+	}
+
+	if cr.Spec.IssuerRef.Group != v1.GroupVersion.Group {
+		return nil
+	}
+
+	return []string{issuerRefIndexValue(cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name)}
+}
+
+// issuerSecretNames returns the names of every Secret referenced by the
+// issuer spec.
+func issuerSecretNames(spec v1.OriginIssuerSpec) []string {
+	var names []string
+
+	if name := spec.Auth.ServiceKeyRef.Name; name != "" {
+		names = append(names, name)
+	}
+
+	if spec.Auth.APITokenRef != nil && spec.Auth.APITokenRef.Name != "" {
+		names = append(names, spec.Auth.APITokenRef.Name)
+	}
+
+	if spec.Auth.VerifyTokenRef != nil && spec.Auth.VerifyTokenRef.Name != "" {
+		names = append(names, spec.Auth.VerifyTokenRef.Name)
+	}
+
+	for _, zone := range spec.Auth.Zones {
+		if ref := zone.ServiceKeyRef; ref != nil && ref.Name != "" {
+			names = append(names, ref.Name)
+		}
+
+		if ref := zone.APITokenRef; ref != nil && ref.Name != "" {
+			names = append(names, ref.Name)
+		}
+	}
+
+	return names
+}
+
+// issuerRefIndexValue returns the value stored in CertificateRequestIssuerIndex
+// for an issuer of the given kind and name.
+func issuerRefIndexValue(kind, name string) string {
+	return kind + "/" + name
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestIndexMapping(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := func(secret string) v1.OriginIssuerSpec {
+		return v1.OriginIssuerSpec{
+			RequestType: v1.RequestTypeOriginRSA,
+			Auth: v1.OriginIssuerAuthentication{
+				ServiceKeyRef: v1.SecretKeySelector{
+					Name: secret,
+					Key:  "key",
+				},
+			},
+		}
+	}
+
+	objects := []runtime.Object{
+		&v1.OriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			Spec:       spec("service-key"),
+		},
+		&v1.OriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"},
+			Spec:       spec("other-key"),
+		},
+		&v1.OriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "elsewhere"},
+			Spec:       spec("service-key"),
+		},
+		&v1.OriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "baz", Namespace: "default"},
+			Spec: func() v1.OriginIssuerSpec {
+				s := spec("other-key")
+				s.Auth.VerifyTokenRef = &v1.SecretKeySelector{Name: "verify-token", Key: "token"}
+				return s
+			}(),
+		},
+		&v1.ClusterOriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+			Spec:       spec("service-key"),
+		},
+		cmgen.CertificateRequest("pending",
+			cmgen.SetCertificateRequestNamespace("default"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "foo",
+				Kind:  "OriginIssuer",
+				Group: "cert-manager.k8s.cloudflare.com",
+			}),
+		),
+		cmgen.CertificateRequest("issued",
+			cmgen.SetCertificateRequestNamespace("default"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "foo",
+				Kind:  "OriginIssuer",
+				Group: "cert-manager.k8s.cloudflare.com",
+			}),
+			cmgen.SetCertificateRequestCertificate([]byte("bogus")),
+		),
+		cmgen.CertificateRequest("cluster",
+			cmgen.SetCertificateRequestNamespace("elsewhere"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "foo",
+				Kind:  "ClusterOriginIssuer",
+				Group: "cert-manager.k8s.cloudflare.com",
+			}),
+		),
+		cmgen.CertificateRequest("aliased",
+			cmgen.SetCertificateRequestNamespace("elsewhere"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "default",
+				Kind:  "ClusterOriginIssuer",
+				Group: "cert-manager.k8s.cloudflare.com",
+			}),
+		),
+		cmgen.CertificateRequest("other-group",
+			cmgen.SetCertificateRequestNamespace("default"),
+			cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+				Name:  "foo",
+				Kind:  "OriginIssuer",
+				Group: "cert-manager.io",
+			}),
+		),
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(objects...).
+		WithIndex(&v1.OriginIssuer{}, IssuerSecretIndex, indexOriginIssuerSecrets).
+		WithIndex(&v1.ClusterOriginIssuer{}, IssuerSecretIndex, indexClusterOriginIssuerSecrets).
+		WithIndex(&cmapi.CertificateRequest{}, CertificateRequestIssuerIndex, indexCertificateRequestIssuer).
+		Build()
+
+	secret := func(namespace, name string) client.Object {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	request := func(namespace, name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+	}
+
+	t.Run("secret to OriginIssuer", func(t *testing.T) {
+		r := &OriginIssuerController{Client: c, Log: logf.Log}
+
+		got := r.SecretToIssuers(context.Background(), secret("default", "service-key"))
+		assert.DeepEqual(t, got, []reconcile.Request{request("default", "foo")})
+
+		got = r.SecretToIssuers(context.Background(), secret("default", "verify-token"))
+		assert.DeepEqual(t, got, []reconcile.Request{request("default", "baz")})
+	})
+
+	t.Run("secret to ClusterOriginIssuer", func(t *testing.T) {
+		r := &ClusterOriginIssuerController{Client: c, ClusterResourceNamespace: "super-secret", Log: logf.Log}
+
+		got := r.SecretToIssuers(context.Background(), secret("super-secret", "service-key"))
+		assert.DeepEqual(t, got, []reconcile.Request{request("", "foo")})
+
+		got = r.SecretToIssuers(context.Background(), secret("default", "service-key"))
+		assert.Equal(t, len(got), 0)
+	})
+
+	t.Run("OriginIssuer to CertificateRequests", func(t *testing.T) {
+		r := &CertificateRequestController{Client: c, Log: logf.Log}
+
+		got := r.IssuerToRequests(context.Background(), &v1.OriginIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}})
+		assert.DeepEqual(t, got, []reconcile.Request{request("default", "pending")})
+	})
+
+	t.Run("ClusterOriginIssuer to CertificateRequests", func(t *testing.T) {
+		r := &CertificateRequestController{Client: c, Log: logf.Log}
+
+		got := r.IssuerToRequests(context.Background(), &v1.ClusterOriginIssuer{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+		assert.DeepEqual(t, got, []reconcile.Request{request("elsewhere", "cluster")})
+	})
+
+	t.Run("default ClusterOriginIssuer to CertificateRequests", func(t *testing.T) {
+		r := &CertificateRequestController{Client: c, Log: logf.Log, DefaultClusterIssuer: "foo"}
+
+		got := r.IssuerToRequests(context.Background(), &v1.ClusterOriginIssuer{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+		assert.DeepEqual(t, got, []reconcile.Request{request("elsewhere", "cluster"), request("elsewhere", "aliased")})
+	})
+}
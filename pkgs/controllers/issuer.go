@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/metrics"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/validation"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// issuer is an OriginIssuer or a ClusterOriginIssuer, which share their spec
+// and status, and are reconciled alike.
+type issuer interface {
+	*v1.OriginIssuer | *v1.ClusterOriginIssuer
+	client.Object
+}
+
+// issuerSpecStatus returns the spec of the issuer, and its status to update.
+func issuerSpecStatus(iss client.Object) (v1.OriginIssuerSpec, *v1.OriginIssuerStatus) {
+	switch iss := iss.(type) {
+	case *v1.OriginIssuer:
+		return iss.Spec, &iss.Status
+	case *v1.ClusterOriginIssuer:
+		return iss.Spec, &iss.Status
+	default:
+		panic(fmt.Sprintf("unexpected issuer type %T", iss))
+	}
+}
+
+// issuerReconciler verifies the credentials of issuers of a kind, on behalf
+// of the OriginIssuerController and ClusterOriginIssuerController.
+type issuerReconciler[T issuer] struct {
+	client.Client
+	Reader    client.Reader
+	Log       logr.Logger
+	Clock     clock.Clock
+	Factory   cfapi.Factory
+	Recorder  record.EventRecorder
+	Exchanger *tokenexchange.Exchanger
+	Vault     *vault.Client
+
+	CertificateCountInterval time.Duration
+
+	// DryRun leaves the credentials unverified, and reports the outcome in
+	// the DryRun condition of the issuer rather than its Ready condition.
+	DryRun bool
+
+	// Kind of the issuers, OriginIssuer or ClusterOriginIssuer.
+	Kind string
+
+	// Namespace of the Secrets and ServiceAccounts the issuer authenticates
+	// with.
+	Namespace string
+}
+
+// Reconcile validates the spec of the issuer, and verifies its credentials
+// with the Cloudflare API, reflecting the outcome in its Ready condition.
+func (r *issuerReconciler[T]) Reconcile(ctx context.Context, iss T) (reconcile.Result, error) {
+	log := r.Log.WithValues("namespace", iss.GetNamespace(), strings.ToLower(r.Kind), iss.GetName())
+	spec, status := issuerSpecStatus(iss)
+
+	validateSpec := validation.ValidateOriginIssuerSpec
+	if r.Kind == "OriginIssuer" {
+		validateSpec = validation.ValidateNamespacedOriginIssuerSpec
+	}
+
+	if errs := validateSpec(spec, field.NewPath("spec")); len(errs) > 0 {
+		err := errs.ToAggregate()
+		log.Error(err, fmt.Sprintf("failed to validate %s resource", r.Kind))
+		_ = r.setStatus(ctx, iss, v1.ConditionFalse, "InvalidSpec", fmt.Sprintf("Invalid %s spec: %v", r.Kind, err))
+
+		// The spec must be changed to resolve the error, which will trigger a new reconcile.
+		return reconcile.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Issuers with a verification token are verified with it alone, so that
+	// their signing credential is only retrieved to sign certificates.
+	var creds cfapi.Credentials
+	if hasExternalCredentials(spec.Auth) && spec.Auth.VerifyTokenRef == nil {
+		var err error
+		creds, err = externalCredentials(ctx, r.Exchanger, r.Vault, spec, r.Namespace)
+		if err != nil {
+			var cerr *credentialsError
+			errors.As(err, &cerr)
+			log.Error(err, "failed to retrieve issuer credentials")
+			_ = r.setStatus(ctx, iss, v1.ConditionFalse, cerr.Reason, cerr.Message())
+
+			return reconcile.Result{}, err
+		}
+	} else {
+		secretRef := verifyAuthSecretRef(spec.Auth)
+		secret := core.Secret{}
+		secretNamespaceName := types.NamespacedName{
+			Namespace: r.Namespace,
+			Name:      secretRef.Name,
+		}
+
+		if err := r.Reader.Get(ctx, secretNamespaceName, &secret); err != nil {
+			log.Error(err, fmt.Sprintf("failed to retieve %s auth secret", r.Kind), "namespace", secretNamespaceName.Namespace, "name", secretNamespaceName.Name)
+
+			if apierrors.IsNotFound(err) {
+				_ = r.setStatus(ctx, iss, v1.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+			} else {
+				_ = r.setStatus(ctx, iss, v1.ConditionFalse, "Error", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+			}
+
+			return reconcile.Result{}, err
+		}
+
+		credential, ok := secret.Data[secretRef.Key]
+		if !ok {
+			err := &secretKeyError{Secret: secret.Name, Key: secretRef.Key}
+			log.Error(err, fmt.Sprintf("failed to retrieve %s auth secret", r.Kind))
+			_ = r.setStatus(ctx, iss, v1.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
+
+			return reconcile.Result{}, err
+		}
+
+		creds = verifyCredentials(spec, credential)
+	}
+
+	c, err := r.Factory.APIWith(creds)
+	if errors.Is(err, cfapi.ErrEndpointNotAllowed) {
+		log.Error(err, "Cloudflare API endpoint not allowed")
+
+		return reconcile.Result{}, r.setStatus(ctx, iss, v1.ConditionFalse, "EndpointNotAllowed", fmt.Sprintf("Failed to create API client: %v", err))
+	}
+	if err != nil {
+		log.Error(err, "failed to create API client")
+
+		return reconcile.Result{}, err
+	}
+
+	if r.DryRun {
+		log.Info("dry run, not verifying credentials with the Cloudflare API")
+
+		return reconcile.Result{}, r.setStatus(ctx, iss, v1.ConditionTrue, "DryRun", fmt.Sprintf("%s credentials retrieved, not verified with the Cloudflare API in dry run mode", r.Kind))
+	}
+
+	ctx = cfapi.WithMetadata(ctx, cfapi.Metadata{
+		IssuerKind:      r.Kind,
+		IssuerNamespace: iss.GetNamespace(),
+		IssuerName:      iss.GetName(),
+		ObjectKind:      r.Kind,
+		ObjectNamespace: iss.GetNamespace(),
+		ObjectName:      iss.GetName(),
+		ObjectUID:       iss.GetUID(),
+	})
+
+	if err := c.Verify(ctx); err != nil {
+		// Being rate limited says nothing about the credentials, so keep
+		// the current status and check again once the limit resets.
+		var rateLimited *cfapi.RateLimitError
+		if errors.As(err, &rateLimited) {
+			log.Info("rate limited by the Cloudflare API, requeue-ing", "after", rateLimited.RetryAfter)
+
+			return reconcile.Result{RequeueAfter: rateLimited.RetryAfter}, nil
+		}
+
+		log.Error(err, "failed to verify credentials with the Cloudflare API")
+		_ = r.setStatus(ctx, iss, v1.ConditionFalse, "VerificationFailed", fmt.Sprintf("Failed to verify credentials with the Cloudflare API: %v", err))
+
+		return reconcile.Result{}, err
+	}
+
+	if err := r.verifyZoneCredentials(ctx, spec); err != nil {
+		var rateLimited *cfapi.RateLimitError
+		if errors.As(err, &rateLimited) {
+			log.Info("rate limited by the Cloudflare API, requeue-ing", "after", rateLimited.RetryAfter)
+
+			return reconcile.Result{RequeueAfter: rateLimited.RetryAfter}, nil
+		}
+
+		var zerr *zoneCredentialError
+		errors.As(err, &zerr)
+		log.Error(err, "failed to verify zone credential", "zones", zerr.Zones)
+		_ = r.setStatus(ctx, iss, v1.ConditionFalse, zerr.Reason, err.Error())
+
+		return reconcile.Result{}, err
+	}
+
+	updateCertificateCount(ctx, c, spec, status, metrics.Issuer{Kind: r.Kind, Namespace: iss.GetNamespace(), Name: iss.GetName()}, log, r.Clock)
+	if updateCertificateQuota(spec, status, iss.GetGeneration(), log, r.Clock) {
+		r.Recorder.Event(iss, core.EventTypeWarning, v1.ConditionQuotaExhausted, fmt.Sprintf("Zone %s has only %d of its %d Origin CA certificates left", spec.ZoneID, *status.QuotaRemaining, spec.CertificateQuota.Limit))
+	}
+	updateCanaryStatus(spec, status, iss.GetGeneration())
+
+	if err := r.setStatus(ctx, iss, v1.ConditionTrue, "Verified", fmt.Sprintf("%s verified and ready to sign certificates", r.Kind)); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if spec.ZoneID != "" && r.CertificateCountInterval > 0 {
+		return reconcile.Result{RequeueAfter: r.CertificateCountInterval}, nil
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// zoneCredentialError is returned when a zone credential of an issuer can't
+// be retrieved or verified, with the reason of the issuer's condition.
+type zoneCredentialError struct {
+	Zones  []string
+	Reason string
+	Err    error
+}
+
+func (e *zoneCredentialError) Error() string {
+	return fmt.Sprintf("Failed to verify the credential of zones %s: %v", strings.Join(e.Zones, ", "), e.Err)
+}
+
+func (e *zoneCredentialError) Unwrap() error {
+	return e.Err
+}
+
+// verifyZoneCredentials verifies each zone credential of the issuer with the
+// Cloudflare API, so that a missing or rejected credential is reported on the
+// issuer rather than only on the requests signed with it.
+func (r *issuerReconciler[T]) verifyZoneCredentials(ctx context.Context, spec v1.OriginIssuerSpec) error {
+	for _, credential := range spec.Auth.Zones {
+		zoneSpec := spec
+		zoneSpec.Auth = zoneCredentialAuth(credential)
+
+		secretRef := issuerAuthSecretRef(zoneSpec.Auth)
+		var secret core.Secret
+		if err := r.Reader.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: secretRef.Name}, &secret); err != nil {
+			reason := "Error"
+			if apierrors.IsNotFound(err) {
+				reason = "NotFound"
+			}
+
+			return &zoneCredentialError{Zones: credential.Zones, Reason: reason, Err: err}
+		}
+
+		value, ok := secret.Data[secretRef.Key]
+		if !ok {
+			return &zoneCredentialError{Zones: credential.Zones, Reason: "NotFound", Err: &secretKeyError{Secret: secret.Name, Key: secretRef.Key}}
+		}
+
+		c, err := r.Factory.APIWith(issuerCredentials(zoneSpec, value))
+		if err != nil {
+			return &zoneCredentialError{Zones: credential.Zones, Reason: "Error", Err: err}
+		}
+
+		if err := c.Verify(ctx); err != nil {
+			return &zoneCredentialError{Zones: credential.Zones, Reason: "VerificationFailed", Err: err}
+		}
+	}
+
+	return nil
+}
+
+// setStatus is a helper function to set the Issuer status condition with reason and message, and update the API.
+// An event is recorded with the same reason and message. In dry run mode, only the DryRun condition is set.
+func (r *issuerReconciler[T]) setStatus(ctx context.Context, iss T, status metav1.ConditionStatus, reason, message string) error {
+	spec, issStatus := issuerSpecStatus(iss)
+
+	message = statusMessage(message)
+
+	// A changed configuration failing while it is rolled out leaves the
+	// issuer signing with its stable configuration, which was verified
+	// before.
+	if !r.DryRun && status == v1.ConditionFalse && reason != "InvalidSpec" && canaryInProgress(spec, *issStatus) {
+		failCanary(issStatus, iss.GetGeneration(), message)
+		SetIssuerStatusCondition(issStatus, iss.GetGeneration(), v1.ConditionReady, v1.ConditionTrue, r.Log, r.Clock, canaryFailedReason, statusMessage(fmt.Sprintf("Changed configuration failed, signing with the stable configuration: %s", message)))
+		issStatus.ObservedGeneration = iss.GetGeneration()
+		r.Recorder.Event(iss, core.EventTypeWarning, canaryFailedReason, message)
+
+		return r.Client.Status().Update(ctx, iss)
+	}
+
+	if r.DryRun {
+		SetIssuerStatusCondition(issStatus, iss.GetGeneration(), v1.ConditionDryRun, status, r.Log, r.Clock, reason, message)
+	} else {
+		SetIssuerStatusCondition(issStatus, iss.GetGeneration(), v1.ConditionReady, status, r.Log, r.Clock, reason, message)
+		setIssuerObservedState(issStatus, iss.GetGeneration(), status, r.Clock)
+	}
+	recordIssuerEvent(r.Recorder, iss, status, reason, message)
+
+	return r.Client.Status().Update(ctx, iss)
+}
@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/go-logr/logr"
+	authentication "k8s.io/api/authentication/v1"
+	authorization "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// minKickInterval is how long kicks following a kick are ignored, so that
+// repeated kicks don't flood the Cloudflare API.
+const minKickInterval = 10 * time.Second
+
+// kickedReason is the reason of the Issuing condition set on the Certificates
+// of failed CertificateRequests retried by a kick.
+const kickedReason = "Kicked"
+
+// kickAudience is the audience of the bearer tokens POSTed to /kick, so that
+// tokens issued for other services can't kick the controllers.
+const kickAudience = "origin-ca-issuer"
+
+// errKickedRecently is returned by Kick within minKickInterval of a kick.
+var errKickedRecently = fmt.Errorf("kicked less than %v ago", minKickInterval)
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates/status,verbs=update
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Kicker immediately re-verifies every issuer and retries every
+// CertificateRequest still pending, rather than once their backoff expires,
+// when the controller receives SIGHUP or a POST to the Kicker's handler, such
+// as once the Cloudflare API recovered from an incident. Credentials recently
+// rejected are tried again as well, and the Certificates of failed
+// CertificateRequests are renewed, as cert-manager otherwise waits for their
+// own backoff to request them again.
+//
+// The controllers are kicked through the sources of the Kicker, which must be
+// watched by the respective controllers.
+type Kicker struct {
+	Client client.Client
+	Clock  clock.Clock
+	Log    logr.Logger
+
+	// CertificateRequests, when set, forgets the credentials recently
+	// rejected by the Cloudflare API on each kick.
+	CertificateRequests *CertificateRequestController
+
+	once                                                     sync.Once
+	originIssuers, clusterOriginIssuers, certificateRequests chan event.GenericEvent
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (k *Kicker) init() {
+	k.once.Do(func() {
+		k.originIssuers = make(chan event.GenericEvent)
+		k.clusterOriginIssuers = make(chan event.GenericEvent)
+		k.certificateRequests = make(chan event.GenericEvent)
+	})
+}
+
+// OriginIssuerSource returns the source of the OriginIssuers kicked.
+func (k *Kicker) OriginIssuerSource() source.Source {
+	k.init()
+	return &source.Channel{Source: k.originIssuers}
+}
+
+// ClusterOriginIssuerSource returns the source of the ClusterOriginIssuers
+// kicked.
+func (k *Kicker) ClusterOriginIssuerSource() source.Source {
+	k.init()
+	return &source.Channel{Source: k.clusterOriginIssuers}
+}
+
+// CertificateRequestSource returns the source of the CertificateRequests
+// kicked.
+func (k *Kicker) CertificateRequestSource() source.Source {
+	k.init()
+	return &source.Channel{Source: k.certificateRequests}
+}
+
+// Start kicks the controllers on every SIGHUP until the context is done.
+func (k *Kicker) Start(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signals:
+			if _, _, err := k.Kick(ctx); err != nil {
+				k.Log.Error(err, "failed to kick controllers on SIGHUP")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection reports that every replica handles its own signals.
+func (k *Kicker) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP kicks the controllers on POST requests. Requests must carry the
+// bearer token of a user allowed to create the non-resource URL of the
+// request, such as /kick, which is checked with a TokenReview and a
+// SubjectAccessReview.
+func (k *Kicker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests kick the controllers", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if code, err := k.authorize(r); err != nil {
+		if code == http.StatusInternalServerError {
+			k.Log.Error(err, "failed to authorize kick")
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	issuers, requests, err := k.Kick(r.Context())
+	switch {
+	case err == errKickedRecently:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "kicked %d issuers and %d certificate requests\n", issuers, requests)
+}
+
+// Kick enqueues every issuer, and every CertificateRequest of an issuer of
+// this controller neither issued nor failed, and renews the Certificates of
+// those failed, returning the numbers of issuers and CertificateRequests
+// kicked.
+func (k *Kicker) Kick(ctx context.Context) (issuers, requests int, err error) {
+	k.init()
+
+	k.mu.Lock()
+	now := k.Clock.Now()
+	if !k.last.IsZero() && now.Before(k.last.Add(minKickInterval)) {
+		k.mu.Unlock()
+		return 0, 0, errKickedRecently
+	}
+	k.last = now
+	k.mu.Unlock()
+
+	if k.CertificateRequests != nil {
+		k.CertificateRequests.authFailures.reset()
+
+		// Requests kicked by earlier kicks but deleted before they were
+		// reconciled would be kept forever. Those still backing off are
+		// kicked again.
+		k.CertificateRequests.kicked.Range(func(key, kickedAt any) bool {
+			if kickedAt.(time.Time).Before(now) {
+				k.CertificateRequests.kicked.Delete(key)
+			}
+			return true
+		})
+	}
+
+	var originIssuers v1.OriginIssuerList
+	if err := k.Client.List(ctx, &originIssuers); err != nil {
+		return 0, 0, fmt.Errorf("listing OriginIssuers: %w", err)
+	}
+
+	var clusterOriginIssuers v1.ClusterOriginIssuerList
+	if err := k.Client.List(ctx, &clusterOriginIssuers); err != nil {
+		return 0, 0, fmt.Errorf("listing ClusterOriginIssuers: %w", err)
+	}
+
+	var crs certmanager.CertificateRequestList
+	if err := k.Client.List(ctx, &crs); err != nil {
+		return 0, 0, fmt.Errorf("listing CertificateRequests: %w", err)
+	}
+
+	for i := range originIssuers.Items {
+		if err := kick(ctx, k.originIssuers, &originIssuers.Items[i]); err != nil {
+			return issuers, requests, err
+		}
+		issuers++
+	}
+
+	for i := range clusterOriginIssuers.Items {
+		if err := kick(ctx, k.clusterOriginIssuers, &clusterOriginIssuers.Items[i]); err != nil {
+			return issuers, requests, err
+		}
+		issuers++
+	}
+
+	for i := range crs.Items {
+		cr := &crs.Items[i]
+		if cr.Spec.IssuerRef.Group != v1.GroupVersion.Group || issued(cr) {
+			continue
+		}
+
+		if cr.Status.FailureTime != nil {
+			retried, err := k.retryFailed(ctx, cr)
+			if err != nil {
+				k.Log.Error(err, "failed to retry failed certificate request", "namespace", cr.Namespace, "certificaterequest", cr.Name)
+			}
+			if retried {
+				requests++
+			}
+			continue
+		}
+
+		// Requests backing off are attempted at once rather than at their
+		// next attempt.
+		if _, next := retryState(cr); k.CertificateRequests != nil && next.After(now) {
+			k.CertificateRequests.kicked.Store(client.ObjectKeyFromObject(cr), now)
+		}
+
+		if err := kick(ctx, k.certificateRequests, cr); err != nil {
+			return issuers, requests, err
+		}
+		requests++
+	}
+
+	k.Log.Info("kicked controllers", "issuers", issuers, "certificaterequests", requests)
+
+	return issuers, requests, nil
+}
+
+// retryFailed renews the Certificate of a failed CertificateRequest, which
+// cert-manager replaces by a new CertificateRequest, and reports whether it
+// did. Only the latest revision of a Certificate not already being issued is
+// retried, and neither requests denied nor requests the Origin CA can never
+// sign.
+func (k *Kicker) retryFailed(ctx context.Context, cr *certmanager.CertificateRequest) (bool, error) {
+	if !cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
+		Type:   certmanager.CertificateRequestConditionReady,
+		Status: cmmeta.ConditionFalse,
+		Reason: certmanager.CertificateRequestReasonFailed,
+	}) || cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
+		Type:   certmanager.CertificateRequestConditionInvalidRequest,
+		Status: cmmeta.ConditionTrue,
+	}) {
+		return false, nil
+	}
+
+	name, ok := cr.Annotations[certmanager.CertificateNameKey]
+	if !ok {
+		return false, nil
+	}
+
+	crt := &certmanager.Certificate{}
+	if err := k.Client.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: name}, crt); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	revision := 1
+	if crt.Status.Revision != nil {
+		revision = *crt.Status.Revision + 1
+	}
+	if cr.Annotations[certmanager.CertificateRequestRevisionAnnotationKey] != strconv.Itoa(revision) ||
+		cmutil.CertificateHasCondition(crt, certmanager.CertificateCondition{Type: certmanager.CertificateConditionIssuing, Status: cmmeta.ConditionTrue}) {
+		return false, nil
+	}
+
+	cmutil.SetCertificateCondition(crt, crt.Generation, certmanager.CertificateConditionIssuing, cmmeta.ConditionTrue, kickedReason, fmt.Sprintf("Retrying failed CertificateRequest %s as the controller was kicked", cr.Name))
+	if err := k.Client.Status().Update(ctx, crt); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// authorize authenticates the bearer token of r, which must be issued for
+// kickAudience, with a TokenReview, and checks its user may create the
+// non-resource URL of r with a SubjectAccessReview, returning the HTTP status
+// to reply with otherwise.
+func (k *Kicker) authorize(r *http.Request) (int, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return http.StatusUnauthorized, errors.New("a bearer token is required to kick the controllers")
+	}
+
+	tr := &authentication.TokenReview{
+		Spec: authentication.TokenReviewSpec{
+			Token:     token,
+			Audiences: []string{kickAudience},
+		},
+	}
+	if err := k.Client.Create(r.Context(), tr); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("reviewing token: %w", err)
+	}
+	if !tr.Status.Authenticated {
+		return http.StatusUnauthorized, errors.New("bearer token not authenticated")
+	}
+	// Authenticators unaware of audiences authenticate tokens of any
+	// audience, returning none.
+	if !slices.Contains(tr.Status.Audiences, kickAudience) {
+		return http.StatusUnauthorized, fmt.Errorf("bearer token not issued for the %s audience", kickAudience)
+	}
+
+	extra := make(map[string]authorization.ExtraValue, len(tr.Status.User.Extra))
+	for key, value := range tr.Status.User.Extra {
+		extra[key] = authorization.ExtraValue(value)
+	}
+
+	sar := &authorization.SubjectAccessReview{
+		Spec: authorization.SubjectAccessReviewSpec{
+			User:   tr.Status.User.Username,
+			UID:    tr.Status.User.UID,
+			Groups: tr.Status.User.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorization.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: "create",
+			},
+		},
+	}
+	if err := k.Client.Create(r.Context(), sar); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("reviewing access: %w", err)
+	}
+	if !sar.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("%s is not allowed to create %s", tr.Status.User.Username, r.URL.Path)
+	}
+
+	return http.StatusOK, nil
+}
+
+func kick(ctx context.Context, events chan<- event.GenericEvent, obj client.Object) error {
+	select {
+	case events <- event.GenericEvent{Object: obj}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	authentication "k8s.io/api/authentication/v1"
+	authorization "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakeClock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestKicker(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := metav1.NewTime(clock.Now())
+
+	failedCondition := cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonFailed})
+	revision := func(name, rev string) cmgen.CertificateRequestModifier {
+		return cmgen.SetCertificateRequestAnnotations(map[string]string{cmapi.CertificateNameKey: name, cmapi.CertificateRequestRevisionAnnotationKey: rev})
+	}
+
+	// Tokens authenticate as the user of the same name, which is only
+	// allowed to kick when named "oncall".
+	c := interceptor.NewClient(fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithStatusSubresource(&cmapi.Certificate{}).
+		WithObjects(
+			issuertesting.OriginIssuer("default", "foobar"),
+			issuertesting.ClusterOriginIssuer("foobar"),
+			issuertesting.CertificateRequest("default", "pending", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			issuertesting.CertificateRequest("default", "backing-off", issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+				cmgen.SetCertificateRequestAnnotations(map[string]string{v1.NextAttemptAnnotation: clock.Now().Add(time.Hour).UTC().Format(time.RFC3339)}),
+			),
+			issuertesting.CertificateRequest("default", "issued", issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+				cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionTrue, Reason: cmapi.CertificateRequestReasonIssued}),
+			),
+			issuertesting.CertificateRequest("default", "failed", issuertesting.SetCertificateRequestOriginIssuer("foobar"), cmgen.SetCertificateRequestFailureTime(now)),
+			issuertesting.CertificateRequest("default", "other", cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{Group: "cert-manager.io", Kind: "Issuer", Name: "foobar"})),
+			issuertesting.CertificateRequest("default", "web-2", issuertesting.SetCertificateRequestOriginIssuer("foobar"), cmgen.SetCertificateRequestFailureTime(now), failedCondition, revision("web", "2")),
+			issuertesting.CertificateRequest("default", "web-1", issuertesting.SetCertificateRequestOriginIssuer("foobar"), cmgen.SetCertificateRequestFailureTime(now), failedCondition, revision("web", "1")),
+			issuertesting.CertificateRequest("default", "denied", issuertesting.SetCertificateRequestOriginIssuer("foobar"), cmgen.SetCertificateRequestFailureTime(now), revision("api", "1"),
+				cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonDenied}),
+			),
+			&cmapi.Certificate{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+				Status:     cmapi.CertificateStatus{Revision: ptr.To(1)},
+			},
+			&cmapi.Certificate{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api"},
+			},
+		).
+		Build(), interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			switch review := obj.(type) {
+			case *authentication.TokenReview:
+				// Tokens of other audiences are authenticated by
+				// authenticators unaware of audiences, returning none.
+				review.Status.Authenticated = review.Spec.Token != "invalid"
+				review.Status.User.Username = strings.TrimSuffix(review.Spec.Token, "@apiserver")
+				if !strings.HasSuffix(review.Spec.Token, "@apiserver") {
+					review.Status.Audiences = review.Spec.Audiences
+				}
+			case *authorization.SubjectAccessReview:
+				review.Status.Allowed = review.Spec.User == "oncall" && review.Spec.NonResourceAttributes.Path == "/kick" && review.Spec.NonResourceAttributes.Verb == "create"
+			default:
+				return c.Create(ctx, obj, opts...)
+			}
+			return nil
+		},
+	})
+
+	crController := &CertificateRequestController{}
+	crController.authFailures.add(authFailureKey{Secret: types.NamespacedName{Namespace: "default", Name: "service-key"}}, errors.New("rejected"), clock.Now(), clock.Now().Add(time.Hour))
+
+	kicker := &Kicker{
+		Client:              c,
+		Clock:               clock,
+		Log:                 logf.Log,
+		CertificateRequests: crController,
+	}
+	kicker.init()
+
+	var (
+		mu     sync.Mutex
+		kicked []string
+		wg     sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	for kind, events := range map[string]chan event.GenericEvent{
+		"OriginIssuer":        kicker.originIssuers,
+		"ClusterOriginIssuer": kicker.clusterOriginIssuers,
+		"CertificateRequest":  kicker.certificateRequests,
+	} {
+		kind, events := kind, events
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case evt := <-events:
+					mu.Lock()
+					kicked = append(kicked, kind+" "+evt.Object.GetName())
+					mu.Unlock()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	rec := httptest.NewRecorder()
+	kicker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kick", nil))
+	assert.Equal(t, rec.Code, http.StatusMethodNotAllowed)
+
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/kick", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		kicker.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, post("").Code, http.StatusUnauthorized)
+	assert.Equal(t, post("invalid").Code, http.StatusUnauthorized)
+	assert.Equal(t, post("oncall@apiserver").Code, http.StatusUnauthorized)
+	assert.Equal(t, post("developer").Code, http.StatusForbidden)
+
+	rec = post("oncall")
+	assert.Equal(t, rec.Code, http.StatusOK)
+	assert.Equal(t, rec.Body.String(), "kicked 2 issuers and 3 certificate requests\n")
+	assert.NilError(t, crController.authFailures.get(authFailureKey{Secret: types.NamespacedName{Namespace: "default", Name: "service-key"}}, clock.Now()))
+	_, backingOff := crController.kicked.Load(types.NamespacedName{Namespace: "default", Name: "backing-off"})
+	assert.Assert(t, backingOff, "expected the request backing off to skip its backoff")
+	_, pending := crController.kicked.Load(types.NamespacedName{Namespace: "default", Name: "pending"})
+	assert.Assert(t, !pending, "expected only requests backing off to be marked as kicked")
+
+	// Only the latest revision of a Certificate is retried, by renewing it.
+	crt := &cmapi.Certificate{}
+	assert.NilError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "web"}, crt))
+	assert.Assert(t, cmutil.CertificateHasCondition(crt, cmapi.CertificateCondition{Type: cmapi.CertificateConditionIssuing, Status: cmmeta.ConditionTrue}))
+	assert.Equal(t, cmutil.GetCertificateCondition(crt, cmapi.CertificateConditionIssuing).Reason, kickedReason)
+	assert.NilError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "api"}, crt))
+	assert.Equal(t, len(crt.Status.Conditions), 0)
+
+	cancel()
+	wg.Wait()
+	sort.Strings(kicked)
+	assert.DeepEqual(t, kicked, []string{"CertificateRequest backing-off", "CertificateRequest pending", "ClusterOriginIssuer foobar", "OriginIssuer foobar"})
+
+	// Kicks are ignored for a while after a kick.
+	assert.Equal(t, post("oncall").Code, http.StatusTooManyRequests)
+
+	// Requests deleted before they were reconciled are forgotten by the
+	// next kick.
+	assert.NilError(t, c.Delete(context.Background(), &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backing-off"}}))
+	clock.Step(minKickInterval)
+	_, _, err := kicker.Kick(ctx)
+	assert.Equal(t, err, context.Canceled)
+	_, backingOff = crController.kicked.Load(types.NamespacedName{Namespace: "default", Name: "backing-off"})
+	assert.Assert(t, !backingOff, "expected the deleted request to be forgotten")
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxStatusMessageLength is the length in bytes beyond which messages of
+// conditions and events are truncated. Errors of the Cloudflare API may
+// carry arbitrary response bodies, which would otherwise be copied into
+// every object failing with them, and written to etcd on each attempt.
+const maxStatusMessageLength = 1024
+
+const truncatedSuffix = "... (truncated)"
+
+// statusMessage returns message suitable for a condition or event: control
+// characters are replaced, runs of whitespace collapsed to a single space,
+// and messages longer than maxStatusMessageLength truncated on a rune
+// boundary. The complete message is left for logs.
+func statusMessage(message string) string {
+	message = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return ' '
+		}
+
+		return r
+	}, message)
+	message = strings.Join(strings.Fields(message), " ")
+
+	if len(message) <= maxStatusMessageLength {
+		return message
+	}
+
+	n := maxStatusMessageLength - len(truncatedSuffix)
+	for n > 0 && !utf8.RuneStart(message[n]) {
+		n--
+	}
+
+	return message[:n] + truncatedSuffix
+}
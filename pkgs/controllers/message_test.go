@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStatusMessage(t *testing.T) {
+	long := "Failed to sign certificate request: Cloudflare API Error code=10000 message=" + strings.Repeat("é", maxStatusMessageLength)
+
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			message:  "Certificate issued",
+			expected: "Certificate issued",
+		},
+		{
+			name:     "control characters",
+			message:  "Cloudflare API Error code=1000 message=<html>\r\n  <body>\tBad\x00Gateway</body>\n</html>",
+			expected: "Cloudflare API Error code=1000 message=<html> <body> Bad Gateway</body> </html>",
+		},
+		{
+			name:     "invalid utf-8",
+			message:  "message=\xff\xfe",
+			expected: "message=",
+		},
+		{
+			name:     "truncated",
+			message:  long,
+			expected: long[:maxStatusMessageLength-len(truncatedSuffix)-1] + truncatedSuffix,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := statusMessage(tt.message)
+			assert.Equal(t, got, tt.expected)
+			assert.Assert(t, len(got) <= maxStatusMessageLength)
+			assert.Assert(t, utf8.ValidString(got))
+		})
+	}
+
+	// Correlation IDs are appended after truncating, so that they are kept.
+	ctx := withCorrelationID(context.Background(), "c0ffee00")
+	assert.Assert(t, strings.HasSuffix(withCorrelationIDMessage(ctx, long), truncatedSuffix+" (correlation ID c0ffee00)"))
+}
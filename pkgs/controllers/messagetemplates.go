@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// MessageData holds the variables available to message templates.
+type MessageData struct {
+	// Reason is the reason of the condition or event, which also names the
+	// template.
+	Reason string
+	// Message is the message the controller would otherwise have set.
+	Message string
+
+	// Kind, Namespace and Name identify the object whose condition is set,
+	// with an empty Namespace for cluster-scoped objects.
+	Kind      string
+	Namespace string
+	Name      string
+
+	// IssuerKind and IssuerName identify the issuer of the object.
+	IssuerKind string
+	IssuerName string
+}
+
+// MessageTemplates are Go templates, keyed by reason, overriding the messages
+// of the conditions and events of CertificateRequests and
+// CertificateSigningRequests, such as to link to internal runbooks. Reasons
+// without a template keep the controller's message.
+type MessageTemplates map[string]*template.Template
+
+// LoadMessageTemplates reads the message templates of dir, as mounted from a
+// ConfigMap, with one file per reason. Templates are checked against
+// placeholder data, so that those referring to unknown variables fail here
+// rather than when rendering a message.
+func LoadMessageTemplates(dir string) (MessageTemplates, error) {
+	return readMessageTemplates(os.DirFS(dir))
+}
+
+func readMessageTemplates(fsys fs.FS) (MessageTemplates, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(MessageTemplates)
+	for _, entry := range entries {
+		// ConfigMap volumes hold their keys as symlinks into hidden
+		// directories, such as ..data, which are skipped.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := template.New(entry.Name()).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parsing message template %s: %w", entry.Name(), err)
+		}
+
+		if err := tmpl.Execute(io.Discard, MessageData{Reason: entry.Name()}); err != nil {
+			return nil, fmt.Errorf("checking message template %s: %w", entry.Name(), err)
+		}
+
+		templates[entry.Name()] = tmpl
+	}
+
+	return templates, nil
+}
+
+// render returns the message of the template for data.Reason, or data.Message
+// when there is none or it fails.
+func (t MessageTemplates) render(data MessageData) string {
+	tmpl, ok := t[data.Reason]
+	if !ok {
+		return data.Message
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return data.Message
+	}
+
+	return b.String()
+}
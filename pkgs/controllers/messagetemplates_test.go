@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestReadMessageTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected []string
+		err      string
+	}{
+		{
+			name: "configmap volume",
+			fsys: fstest.MapFS{
+				"Failed":                        {Data: []byte("{{ .Message }}. See https://wiki.example.com/{{ .Reason }}")},
+				"UnsupportedByOriginCA":         {Data: []byte("{{ .Kind }} {{ .Namespace }}/{{ .Name }}: {{ .Message }}")},
+				"..data/Failed":                 {Data: []byte("{{ .Message }}")},
+				"..2024_01_01_00_00_00.0/other": {Data: []byte("{{ .Message }}")},
+			},
+			expected: []string{"Failed", "UnsupportedByOriginCA"},
+		},
+		{
+			name: "invalid template",
+			fsys: fstest.MapFS{
+				"Failed": {Data: []byte("{{ .Message ")},
+			},
+			err: "parsing message template Failed: template: Failed:1: unclosed action",
+		},
+		{
+			name: "unknown variable",
+			fsys: fstest.MapFS{
+				"Failed": {Data: []byte("{{ .Runbook }}")},
+			},
+			err: `checking message template Failed: template: Failed:1:3: executing "Failed" at <.Runbook>: can't evaluate field Runbook in type controllers.MessageData`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := readMessageTemplates(tt.fsys)
+			if tt.err != "" {
+				assert.Error(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+
+			var reasons []string
+			for reason := range templates {
+				reasons = append(reasons, reason)
+			}
+			sort.Strings(reasons)
+			assert.DeepEqual(t, reasons, tt.expected)
+		})
+	}
+}
+
+func TestSetStatusMessageTemplates(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := readMessageTemplates(fstest.MapFS{
+		"Failed": {Data: []byte("{{ .Message }}. See https://wiki.example.com/origin-ca/{{ .Reason }}?issuer={{ .IssuerName | urlquery }}")},
+	})
+	assert.NilError(t, err)
+
+	cr := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{Kind: "OriginIssuer", Name: "prod issuer"}),
+	)
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(cr).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	recorder := record.NewFakeRecorder(2)
+	controller := &CertificateRequestController{
+		Client:           client,
+		Log:              logf.Log,
+		Recorder:         recorder,
+		Clock:            fakeClock.NewFakeClock(time.Now()),
+		MessageTemplates: templates,
+	}
+
+	got := &cmapi.CertificateRequest{}
+	assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+
+	ctx := withCorrelationID(context.Background(), "00000001")
+	assert.NilError(t, controller.setStatus(ctx, got, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "Failed to sign certificate request: boom"))
+	assert.Equal(t, got.Status.Conditions[0].Message, "Failed to sign certificate request: boom. See https://wiki.example.com/origin-ca/Failed?issuer=prod+issuer (correlation ID 00000001)")
+	assert.Equal(t, <-recorder.Events, "Warning Failed Failed to sign certificate request: boom. See https://wiki.example.com/origin-ca/Failed?issuer=prod+issuer map[cert-manager.k8s.cloudflare.com/correlation-id:00000001]")
+
+	// Reasons without a template keep the controller's message.
+	assert.NilError(t, controller.setStatus(ctx, got, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "OriginIssuer default/prod issuer is not Ready"))
+	assert.Equal(t, got.Status.Conditions[0].Message, "OriginIssuer default/prod issuer is not Ready (correlation ID 00000001)")
+}
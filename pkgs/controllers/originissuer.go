@@ -2,14 +2,15 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"time"
 
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
 	"github.com/go-logr/logr"
-	core "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -19,10 +20,28 @@ import (
 // to OriginIssuer resources.
 type OriginIssuerController struct {
 	client.Client
-	Reader  client.Reader
-	Log     logr.Logger
-	Clock   clock.Clock
-	Factory cfapi.Factory
+	Reader   client.Reader
+	Log      logr.Logger
+	Clock    clock.Clock
+	Factory  cfapi.Factory
+	Recorder record.EventRecorder
+
+	// Exchanger exchanges ServiceAccount tokens for the credentials of
+	// issuers authenticating with a token exchange, which fail without it.
+	Exchanger *tokenexchange.Exchanger
+
+	// Vault reads the credentials of issuers authenticating with Vault,
+	// which fail without it.
+	Vault *vault.Client
+
+	// CertificateCountInterval is how often the certificate count of issuers
+	// with a zone is refreshed. Zero disables refreshing, counts are then
+	// only updated when the issuer changes.
+	CertificateCountInterval time.Duration
+
+	// DryRun leaves the credentials of issuers unverified, reporting in
+	// their DryRun condition, rather than Ready, whether they could be read.
+	DryRun bool
 }
 
 //go:generate controller-gen rbac:roleName=originissuer-control paths=./. output:rbac:artifacts:config=../../deploy/rbac
@@ -34,64 +53,45 @@ type OriginIssuerController struct {
 
 // Reconcile reconciles OriginIssuer resources by managing Cloudflare API provisioners.
 func (r *OriginIssuerController) Reconcile(ctx context.Context, iss *v1.OriginIssuer) (reconcile.Result, error) {
-	log := r.Log.WithValues("namespace", iss.Namespace, "originissuer", iss.Name)
-
-	if err := validateOriginIssuer(iss.Spec); err != nil {
-		log.Error(err, "failed to validate OriginIssuer resource")
-
-		return reconcile.Result{}, err
-	}
-
-	secret := core.Secret{}
-	secretNamespaceName := types.NamespacedName{
+	reconciler := &issuerReconciler[*v1.OriginIssuer]{
+		Client:    r.Client,
+		Reader:    r.Reader,
+		Log:       r.Log,
+		Clock:     r.Clock,
+		Factory:   r.Factory,
+		Recorder:  r.Recorder,
+		Exchanger: r.Exchanger,
+		Vault:     r.Vault,
+
+		CertificateCountInterval: r.CertificateCountInterval,
+		DryRun:                   r.DryRun,
+
+		Kind:      "OriginIssuer",
 		Namespace: iss.Namespace,
-		Name:      iss.Spec.Auth.ServiceKeyRef.Name,
 	}
 
-	if err := r.Reader.Get(ctx, secretNamespaceName, &secret); err != nil {
-		log.Error(err, "failed to retieve OriginIssuer auth secret", "namespace", secretNamespaceName.Namespace, "name", secretNamespaceName.Name)
-
-		if apierrors.IsNotFound(err) {
-			_ = r.setStatus(ctx, iss, v1.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
-		} else {
-			_ = r.setStatus(ctx, iss, v1.ConditionFalse, "Error", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
-		}
-
-		return reconcile.Result{}, err
-	}
-
-	_, ok := secret.Data[iss.Spec.Auth.ServiceKeyRef.Key]
-	if !ok {
-		err := fmt.Errorf("secret %s does not contain key %q", secret.Name, iss.Spec.Auth.ServiceKeyRef.Key)
-		log.Error(err, "failed to retrieve OriginIssuer auth secret")
-		_ = r.setStatus(ctx, iss, v1.ConditionFalse, "NotFound", fmt.Sprintf("Failed to retrieve auth secret: %v", err))
-
-		return reconcile.Result{}, err
-	}
-
-	return reconcile.Result{}, r.setStatus(ctx, iss, v1.ConditionTrue, "Verified", "OriginIssuer verified and ready to sign certificates")
+	return reconciler.Reconcile(ctx, iss)
 }
 
-// setStatus is a helper function to set the Issuer status condition with reason and message, and update the API.
-func (r *OriginIssuerController) setStatus(ctx context.Context, iss *v1.OriginIssuer, status v1.ConditionStatus, reason, message string) error {
-	SetIssuerStatusCondition(&iss.Status, v1.ConditionReady, status, r.Log, r.Clock, reason, message)
+// SecretToIssuers maps a Secret to reconcile requests for every OriginIssuer
+// in the same namespace referencing it.
+func (r *OriginIssuerController) SecretToIssuers(ctx context.Context, obj client.Object) []reconcile.Request {
+	var issuers v1.OriginIssuerList
+	if err := r.Client.List(ctx, &issuers, client.InNamespace(obj.GetNamespace()), client.MatchingFields{IssuerSecretIndex: obj.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list OriginIssuers referencing secret", "namespace", obj.GetNamespace(), "name", obj.GetName())
 
-	return r.Client.Status().Update(ctx, iss)
-}
+		return nil
+	}
 
-// validateOriginIssuer ensures required fields are set, and enums are correctly set.
-// TODO: move this to another package?
-func validateOriginIssuer(s v1.OriginIssuerSpec) error {
-	switch {
-	case s.Auth.ServiceKeyRef.Name == "":
-		return fmt.Errorf("spec.auth.serviceKeyRef.name cannot be empty")
-	case s.Auth.ServiceKeyRef.Key == "":
-		return fmt.Errorf("spec.auth.serviceKeyRef.key cannot be empty")
-	case s.RequestType == "":
-		return fmt.Errorf("spec.requestType cannot be empty")
-	case s.RequestType != v1.RequestTypeOriginRSA && s.RequestType != v1.RequestTypeOriginECC:
-		return fmt.Errorf("spec.requestType has invalid value %q", s.RequestType)
+	requests := make([]reconcile.Request, 0, len(issuers.Items))
+	for _, iss := range issuers.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: iss.Namespace,
+				Name:      iss.Name,
+			},
+		})
 	}
 
-	return nil
+	return requests
 }
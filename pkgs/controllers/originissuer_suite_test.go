@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,13 +18,16 @@ import (
 	"github.com/go-logr/zerologr"
 	"github.com/rs/zerolog"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -37,6 +41,7 @@ func TestMain(m *testing.M) {
 	logf.SetLogger(zerologr.New(&zl))
 	t := &envtest.Environment{
 		CRDDirectoryPaths: []string{filepath.Join("..", "..", "deploy", "crds")},
+		CRDs:              certManagerCRDs(),
 	}
 	cmapi.AddToScheme(scheme.Scheme)
 	v1.AddToScheme(scheme.Scheme)
@@ -88,16 +93,19 @@ func TestOriginIssuerReconcileSuite(t *testing.T) {
 	}
 	c := mgr.GetClient()
 
-	f := cfapi.FactoryFunc(func(serviceKey []byte) (cfapi.Interface, error) {
-		return nil, nil
+	f := cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+		return VerifierFunc(func(ctx context.Context) error {
+			return nil
+		}), nil
 	})
 
 	controller := &OriginIssuerController{
-		Client:  c,
-		Reader:  c,
-		Clock:   clock.RealClock{},
-		Factory: f,
-		Log:     logf.Log,
+		Client:   c,
+		Reader:   c,
+		Clock:    clock.RealClock{},
+		Factory:  f,
+		Recorder: mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:      logf.Log,
 	}
 
 	builder.ControllerManagedBy(mgr).
@@ -134,10 +142,157 @@ func TestOriginIssuerReconcileSuite(t *testing.T) {
 			return false
 		}
 
-		return IssuerStatusHasCondition(iss.Status, v1.OriginIssuerCondition{Type: v1.ConditionReady, Status: v1.ConditionTrue})
+		return IssuerStatusHasCondition(iss.Status, metav1.Condition{Type: v1.ConditionReady, Status: v1.ConditionTrue})
 	}, 5*time.Second, 10*time.Millisecond, "OriginIssuer reconciler")
 }
 
+func TestOriginIssuerSecretWatchSuite(t *testing.T) {
+	issuer := &v1.OriginIssuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watched",
+			Namespace: "default",
+		},
+		Spec: v1.OriginIssuerSpec{
+			RequestType: v1.RequestTypeOriginRSA,
+			Auth: v1.OriginIssuerAuthentication{
+				ServiceKeyRef: v1.SecretKeySelector{
+					Name: "watched-service-key",
+					Key:  "key",
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watched-service-key",
+			Namespace: "default",
+		},
+		StringData: map[string]string{
+			"key": "v1.0-0x00BAB10C",
+		},
+	}
+
+	mgr, err := manager.New(cfg, manager.Options{
+		Metrics: metricsserver.Options{
+			BindAddress: "0",
+		},
+		Scheme: scheme.Scheme,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := mgr.GetClient()
+
+	if err := SetupIndexes(context.TODO(), mgr.GetFieldIndexer()); err != nil {
+		t.Fatal(err)
+	}
+
+	f := cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+		return VerifierFunc(func(ctx context.Context) error {
+			return nil
+		}), nil
+	})
+
+	controller := &OriginIssuerController{
+		Client:   c,
+		Reader:   mgr.GetAPIReader(),
+		Clock:    clock.RealClock{},
+		Factory:  f,
+		Recorder: mgr.GetEventRecorderFor("origin-ca-issuer"),
+		Log:      logf.Log,
+	}
+
+	err = builder.ControllerManagedBy(mgr).
+		For(&v1.OriginIssuer{}).
+		WatchesMetadata(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(controller.SecretToIssuers)).
+		Complete(reconcile.AsReconciler(c, controller))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel, errChan := StartTestManager(mgr, t)
+	defer func() {
+		cancel()
+		if err := <-errChan; err != nil {
+			t.Fatalf("error starting test manager: %v", err)
+		}
+	}()
+
+	ready := func(status metav1.ConditionStatus) func() bool {
+		return func() bool {
+			iss := v1.OriginIssuer{}
+			if err := c.Get(context.TODO(), client.ObjectKeyFromObject(issuer), &iss); err != nil {
+				return false
+			}
+
+			return IssuerStatusHasCondition(iss.Status, metav1.Condition{Type: v1.ConditionReady, Status: status})
+		}
+	}
+
+	// The issuer is created before its secret, and is not ready until the
+	// secret is created.
+	if err := c.Create(context.TODO(), issuer); err != nil {
+		t.Fatalf("error creating instance: %v", err)
+	}
+	defer c.Delete(context.TODO(), issuer)
+
+	Eventually(t, ready(v1.ConditionFalse), 5*time.Second, 10*time.Millisecond, "OriginIssuer without secret")
+
+	if err := c.Create(context.TODO(), secret); err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+
+	Eventually(t, ready(v1.ConditionTrue), 5*time.Second, 10*time.Millisecond, "OriginIssuer after secret created")
+
+	if err := c.Delete(context.TODO(), secret); err != nil {
+		t.Fatalf("error deleting secret: %v", err)
+	}
+
+	Eventually(t, ready(v1.ConditionFalse), 5*time.Second, 10*time.Millisecond, "OriginIssuer after secret deleted")
+}
+
+// certManagerCRDs returns CRDs of the cert-manager resources reconciled or
+// read by the controllers, without a schema. cert-manager's own CRDs are
+// Helm templates, which can't be installed as is.
+func certManagerCRDs() []*apiextensionsv1.CustomResourceDefinition {
+	crd := func(kind, plural string) *apiextensionsv1.CustomResourceDefinition {
+		preserve := true
+
+		return &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: plural + "." + cmapi.SchemeGroupVersion.Group},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group: cmapi.SchemeGroupVersion.Group,
+				Names: apiextensionsv1.CustomResourceDefinitionNames{
+					Kind:     kind,
+					ListKind: kind + "List",
+					Plural:   plural,
+					Singular: strings.ToLower(kind),
+				},
+				Scope: apiextensionsv1.NamespaceScoped,
+				Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+					Name:    cmapi.SchemeGroupVersion.Version,
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type:                   "object",
+							XPreserveUnknownFields: &preserve,
+						},
+					},
+					Subresources: &apiextensionsv1.CustomResourceSubresources{
+						Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+					},
+				}},
+			},
+		}
+	}
+
+	return []*apiextensionsv1.CustomResourceDefinition{
+		crd(cmapi.CertificateRequestKind, "certificaterequests"),
+		crd(cmapi.CertificateKind, "certificates"),
+	}
+}
+
 func StartTestManager(mgr manager.Manager, t *testing.T) (context.CancelFunc, chan error) {
 	t.Helper()
 
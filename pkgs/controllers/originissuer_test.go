@@ -2,18 +2,29 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
 	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	fakeClock "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -36,6 +47,7 @@ func TestOriginIssuerReconcile(t *testing.T) {
 		name          string
 		objects       []runtime.Object
 		expected      v1.OriginIssuerStatus
+		verifyErr     error
 		error         string
 		namespaceName types.NamespacedName
 	}{
@@ -44,8 +56,9 @@ func TestOriginIssuerReconcile(t *testing.T) {
 			objects: []runtime.Object{
 				&v1.OriginIssuer{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "foo",
-						Namespace: "default",
+						Name:       "foo",
+						Namespace:  "default",
+						Generation: 3,
 					},
 					Spec: v1.OriginIssuerSpec{
 						RequestType: v1.RequestTypeOriginRSA,
@@ -56,6 +69,9 @@ func TestOriginIssuerReconcile(t *testing.T) {
 							},
 						},
 					},
+					Status: v1.OriginIssuerStatus{
+						FailedAttempts: 2,
+					},
 				},
 				&corev1.Secret{
 					ObjectMeta: metav1.ObjectMeta{
@@ -68,16 +84,188 @@ func TestOriginIssuerReconcile(t *testing.T) {
 				},
 			},
 			expected: v1.OriginIssuerStatus{
-				Conditions: []v1.OriginIssuerCondition{
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1.ConditionReady,
+						Status:             v1.ConditionTrue,
+						ObservedGeneration: 3,
+						LastTransitionTime: now,
+						Reason:             "Verified",
+						Message:            "OriginIssuer verified and ready to sign certificates",
+					},
+				},
+				ObservedGeneration: 3,
+				LastVerifiedTime:   &now,
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foo",
+			},
+		},
+		{
+			name: "working with api token",
+			objects: []runtime.Object{
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						RequestType: v1.RequestTypeOriginRSA,
+						Auth: v1.OriginIssuerAuthentication{
+							APITokenRef: &v1.SecretKeySelector{
+								Name: "issuer-api-token",
+								Key:  "token",
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer-api-token",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"token": []byte("api-token"),
+					},
+				},
+			},
+			expected: v1.OriginIssuerStatus{
+				Conditions: []metav1.Condition{
 					{
 						Type:               v1.ConditionReady,
 						Status:             v1.ConditionTrue,
-						LastTransitionTime: &now,
+						LastTransitionTime: now,
 						Reason:             "Verified",
 						Message:            "OriginIssuer verified and ready to sign certificates",
 					},
 				},
+				LastVerifiedTime: &now,
+			},
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foo",
+			},
+		},
+		{
+			name: "invalid spec",
+			objects: []runtime.Object{
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "issuer-service-key",
+							},
+						},
+					},
+				},
+			},
+			expected: v1.OriginIssuerStatus{
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1.ConditionReady,
+						Status:             v1.ConditionFalse,
+						LastTransitionTime: now,
+						Reason:             "InvalidSpec",
+						Message:            "Invalid OriginIssuer spec: [spec.auth.serviceKeyRef.key: Required value, spec.requestType: Required value]",
+					},
+				},
+				FailedAttempts: 1,
+			},
+			error: "terminal error: [spec.auth.serviceKeyRef.key: Required value, spec.requestType: Required value]",
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foo",
+			},
+		},
+		{
+			name: "rejected credentials",
+			objects: []runtime.Object{
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						RequestType: v1.RequestTypeOriginRSA,
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "issuer-service-key",
+								Key:  "key",
+							},
+						},
+					},
+					Status: v1.OriginIssuerStatus{
+						FailedAttempts: 1,
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer-service-key",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"key": []byte("djEuMC0weDAwQkFCMTBD"),
+					},
+				},
+			},
+			verifyErr: &cfapi.APIError{
+				Code:    10000,
+				Message: "Authentication error",
+				RayID:   "7d3eb086eedab98e",
+			},
+			expected: v1.OriginIssuerStatus{
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1.ConditionReady,
+						Status:             v1.ConditionFalse,
+						LastTransitionTime: now,
+						Reason:             "VerificationFailed",
+						Message:            "Failed to verify credentials with the Cloudflare API: Cloudflare API Error code=10000 message=Authentication error ray_id=7d3eb086eedab98e",
+					},
+				},
+				FailedAttempts: 2,
 			},
+			error: "Cloudflare API Error code=10000 message=Authentication error ray_id=7d3eb086eedab98e",
+			namespaceName: types.NamespacedName{
+				Namespace: "default",
+				Name:      "foo",
+			},
+		},
+		{
+			name: "rate limited",
+			objects: []runtime.Object{
+				&v1.OriginIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+					Spec: v1.OriginIssuerSpec{
+						RequestType: v1.RequestTypeOriginRSA,
+						Auth: v1.OriginIssuerAuthentication{
+							ServiceKeyRef: v1.SecretKeySelector{
+								Name: "issuer-service-key",
+								Key:  "key",
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer-service-key",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"key": []byte("djEuMC0weDAwQkFCMTBD"),
+					},
+				},
+			},
+			verifyErr: &cfapi.RateLimitError{RetryAfter: time.Minute},
+			expected:  v1.OriginIssuerStatus{},
 			namespaceName: types.NamespacedName{
 				Namespace: "default",
 				Name:      "foo",
@@ -103,15 +291,16 @@ func TestOriginIssuerReconcile(t *testing.T) {
 				},
 			},
 			expected: v1.OriginIssuerStatus{
-				Conditions: []v1.OriginIssuerCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               v1.ConditionReady,
 						Status:             v1.ConditionFalse,
-						LastTransitionTime: &now,
+						LastTransitionTime: now,
 						Reason:             "NotFound",
 						Message:            `Failed to retrieve auth secret: secrets "issuer-service-key" not found`,
 					},
 				},
+				FailedAttempts: 1,
 			},
 			error: `secrets "issuer-service-key" not found`,
 			namespaceName: types.NamespacedName{
@@ -146,15 +335,16 @@ func TestOriginIssuerReconcile(t *testing.T) {
 				},
 			},
 			expected: v1.OriginIssuerStatus{
-				Conditions: []v1.OriginIssuerCondition{
+				Conditions: []metav1.Condition{
 					{
 						Type:               v1.ConditionReady,
 						Status:             v1.ConditionFalse,
-						LastTransitionTime: &now,
+						LastTransitionTime: now,
 						Reason:             "NotFound",
 						Message:            `Failed to retrieve auth secret: secret issuer-service-key does not contain key "key"`,
 					},
 				},
+				FailedAttempts: 1,
 			},
 			error: `secret issuer-service-key does not contain key "key"`,
 			namespaceName: types.NamespacedName{
@@ -176,11 +366,14 @@ func TestOriginIssuerReconcile(t *testing.T) {
 			controller := &OriginIssuerController{
 				Client: client,
 				Reader: client,
-				Factory: cfapi.FactoryFunc(func(serviceKey []byte) (cfapi.Interface, error) {
-					return nil, nil
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					return VerifierFunc(func(ctx context.Context) error {
+						return tt.verifyErr
+					}), nil
 				}),
-				Clock: clock,
-				Log:   logf.Log,
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
 			}
 
 			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
@@ -203,3 +396,701 @@ func TestOriginIssuerReconcile(t *testing.T) {
 		})
 	}
 }
+
+func TestOriginIssuerCertificateCount(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := metav1.NewTime(clock.Now())
+	count := 2
+
+	tests := []struct {
+		name     string
+		issuer   *v1.OriginIssuer
+		listErr  error
+		count    *int
+		time     *metav1.Time
+		interval time.Duration
+		result   reconcile.Result
+	}{
+		{
+			name:     "zone",
+			issuer:   issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353"))),
+			count:    &count,
+			time:     &now,
+			interval: time.Hour,
+			result:   reconcile.Result{RequeueAfter: time.Hour},
+		},
+		{
+			name:   "zone without refresh",
+			issuer: issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353"))),
+			count:  &count,
+			time:   &now,
+		},
+		{
+			name:     "list error",
+			issuer:   issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353"))),
+			listErr:  &cfapi.APIError{Code: 1000, Message: "Invalid zone"},
+			interval: time.Hour,
+			result:   reconcile.Result{RequeueAfter: time.Hour},
+		},
+		{
+			name: "zone removed",
+			issuer: issuertesting.OriginIssuer("default", "foobar", func(_ *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+				status.CertificateCount = &count
+				status.CertificateCountTime = &now
+			}),
+			interval: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithObjects(tt.issuer, issuertesting.ServiceKeySecret("default")).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{ListErr: tt.listErr}
+			for i := 0; i < count; i++ {
+				_, err := api.Sign(context.Background(), &cfapi.SignRequest{Hostnames: []string{"example.com"}})
+				assert.NilError(t, err)
+			}
+
+			controller := &OriginIssuerController{
+				Client:                   client,
+				Reader:                   client,
+				Factory:                  api.Factory(),
+				Recorder:                 record.NewFakeRecorder(10),
+				Clock:                    clock,
+				Log:                      logf.Log,
+				CertificateCountInterval: tt.interval,
+			}
+
+			result, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, result, tt.result)
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+			assert.Assert(t, IssuerStatusHasCondition(got.Status, metav1.Condition{Type: v1.ConditionReady, Status: v1.ConditionTrue}))
+			assert.DeepEqual(t, got.Status.CertificateCount, tt.count)
+			assert.DeepEqual(t, got.Status.CertificateCountTime, tt.time)
+		})
+	}
+}
+
+func TestOriginIssuerCertificateQuota(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	reserve, remaining, none, one := 1, 17, 0, 1
+
+	quota := func(limit int, reserve *int) issuertesting.IssuerModifier {
+		return func(spec *v1.OriginIssuerSpec, _ *v1.OriginIssuerStatus) {
+			spec.ZoneID = "023e105f4ecef8ad9ca31a8372d0c353"
+			spec.CertificateQuota = &v1.CertificateQuota{Limit: limit, Reserve: reserve}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		issuer    *v1.OriginIssuer
+		remaining *int
+		condition *metav1.Condition
+		event     bool
+	}{
+		{
+			name:      "within limit",
+			issuer:    issuertesting.OriginIssuer("default", "foobar", quota(20, nil)),
+			remaining: &remaining,
+			condition: &metav1.Condition{Type: v1.ConditionQuotaExhausted, Status: v1.ConditionFalse, Reason: "WithinLimit", Message: "Zone 023e105f4ecef8ad9ca31a8372d0c353 has 3 Origin CA certificates, 17 below its limit of 20"},
+		},
+		{
+			name:      "reserve reached",
+			issuer:    issuertesting.OriginIssuer("default", "foobar", quota(4, &reserve)),
+			remaining: &one,
+			condition: &metav1.Condition{Type: v1.ConditionQuotaExhausted, Status: v1.ConditionTrue, Reason: "NearLimit", Message: "Zone 023e105f4ecef8ad9ca31a8372d0c353 has 3 Origin CA certificates, 1 below its limit of 4"},
+			event:     true,
+		},
+		{
+			name: "limit reached",
+			issuer: issuertesting.OriginIssuer("default", "foobar", quota(2, nil), func(_ *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+				status.Conditions = append(status.Conditions, metav1.Condition{Type: v1.ConditionQuotaExhausted, Status: v1.ConditionTrue, Reason: "NearLimit"})
+			}),
+			remaining: &none,
+			condition: &metav1.Condition{Type: v1.ConditionQuotaExhausted, Status: v1.ConditionTrue, Reason: "LimitReached", Message: "Zone 023e105f4ecef8ad9ca31a8372d0c353 has 3 Origin CA certificates, reaching its limit of 2"},
+		},
+		{
+			name: "quota removed",
+			issuer: issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353")), func(_ *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+				status.QuotaRemaining = &one
+				status.Conditions = append(status.Conditions, metav1.Condition{Type: v1.ConditionQuotaExhausted, Status: v1.ConditionTrue, Reason: "NearLimit"})
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithObjects(tt.issuer, issuertesting.ServiceKeySecret("default")).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			for i := 0; i < 3; i++ {
+				_, err := api.Sign(context.Background(), &cfapi.SignRequest{Hostnames: []string{"example.com"}})
+				assert.NilError(t, err)
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			controller := &OriginIssuerController{
+				Client:   client,
+				Reader:   client,
+				Factory:  api.Factory(),
+				Recorder: recorder,
+				Clock:    clock,
+				Log:      logf.Log,
+			}
+
+			_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+			})
+			assert.NilError(t, err)
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+			assert.DeepEqual(t, got.Status.QuotaRemaining, tt.remaining)
+
+			var condition *metav1.Condition
+			for _, c := range got.Status.Conditions {
+				if c.Type == v1.ConditionQuotaExhausted {
+					c := c
+					c.LastTransitionTime = metav1.Time{}
+					condition = &c
+				}
+			}
+			assert.DeepEqual(t, condition, tt.condition)
+
+			events := len(recorder.Events)
+			if tt.event {
+				assert.Equal(t, events, 2)
+				assert.Equal(t, <-recorder.Events, "Warning QuotaExhausted Zone 023e105f4ecef8ad9ca31a8372d0c353 has only 1 of its 4 Origin CA certificates left")
+			} else {
+				assert.Equal(t, events, 1)
+			}
+		})
+	}
+}
+
+func TestOriginIssuerDryRun(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	issuer := issuertesting.OriginIssuer("default", "foobar",
+		issuertesting.SetIssuerReadyCondition(v1.ConditionFalse, "VerificationFailed", "Failed to verify credentials with the Cloudflare API"),
+		issuertesting.SetIssuerSpec(issuerclient.WithZoneID("023e105f4ecef8ad9ca31a8372d0c353")),
+	)
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(issuer, issuertesting.ServiceKeySecret("default")).
+		WithStatusSubresource(&v1.OriginIssuer{}).
+		Build()
+
+	api := &issuertesting.FakeAPI{}
+	controller := &OriginIssuerController{
+		Client:                   client,
+		Reader:                   client,
+		Factory:                  api.Factory(),
+		Recorder:                 record.NewFakeRecorder(10),
+		Clock:                    clock,
+		Log:                      logf.Log,
+		CertificateCountInterval: time.Hour,
+		DryRun:                   true,
+	}
+
+	result, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, reconcile.Result{})
+	assert.Equal(t, api.Verified(), 0)
+
+	got := &v1.OriginIssuer{}
+	assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+	assert.Assert(t, IssuerStatusHasCondition(got.Status, metav1.Condition{Type: v1.ConditionReady, Status: v1.ConditionFalse}))
+	assert.Assert(t, IssuerStatusHasCondition(got.Status, metav1.Condition{Type: v1.ConditionDryRun, Status: v1.ConditionTrue}))
+	assert.Assert(t, got.Status.CertificateCount == nil)
+}
+
+func TestOriginIssuerTokenExchange(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := metav1.NewTime(clock.Now())
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer default/origin-ca" {
+			http.Error(w, "ServiceAccount not allowed", http.StatusForbidden)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(tokenexchange.Credentials{APIToken: "short-lived", ExpiresAt: clock.Now().Add(time.Hour)})
+	}))
+	defer srv.Close()
+
+	tokens := tokenexchange.TokenSourceFunc(func(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error) {
+		assert.DeepEqual(t, audiences, []string{tokenexchange.Audience})
+
+		return namespace + "/" + serviceAccount, nil
+	})
+
+	tests := []struct {
+		name           string
+		serviceAccount string
+		exchanger      *tokenexchange.Exchanger
+		expected       metav1.Condition
+	}{
+		{
+			name:           "exchanged",
+			serviceAccount: "origin-ca",
+			exchanger:      tokenexchange.New(tokens, srv.Client(), clock, []string{srv.URL}),
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: now,
+				Reason:             "Verified",
+				Message:            "OriginIssuer verified and ready to sign certificates",
+			},
+		},
+		{
+			name:           "rejected",
+			serviceAccount: "default",
+			exchanger:      tokenexchange.New(tokens, srv.Client(), clock, []string{srv.URL}),
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "TokenExchangeFailed",
+				Message:            fmt.Sprintf("Failed to exchange ServiceAccount token for credentials: exchanging token of ServiceAccount default/default with %s: unexpected status 403 Forbidden", srv.URL),
+			},
+		},
+		{
+			name:           "not allowed",
+			serviceAccount: "origin-ca",
+			exchanger:      tokenexchange.New(tokens, srv.Client(), clock, nil),
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "TokenExchangeFailed",
+				Message:            fmt.Sprintf("Failed to exchange ServiceAccount token for credentials: secret broker URL %s is not allowed by the controller", srv.URL),
+			},
+		},
+		{
+			name:           "disabled",
+			serviceAccount: "origin-ca",
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "TokenExchangeFailed",
+				Message:            "Failed to exchange ServiceAccount token for credentials: token exchange is not enabled on the controller",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuerclient.NewOriginIssuer("default", "foo", issuerclient.WithTokenExchange(srv.URL, tt.serviceAccount))
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(iss).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			controller := &OriginIssuerController{
+				Client: client,
+				Reader: client,
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					assert.DeepEqual(t, creds, cfapi.Credentials{APIToken: []byte("short-lived")})
+
+					return VerifierFunc(func(ctx context.Context) error {
+						return nil
+					}), nil
+				}),
+				Recorder:  record.NewFakeRecorder(10),
+				Clock:     clock,
+				Log:       logf.Log,
+				Exchanger: tt.exchanger,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foo"}
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.DeepEqual(t, got.Status.Conditions, []metav1.Condition{tt.expected})
+		})
+	}
+}
+
+func TestOriginIssuerVault(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := metav1.NewTime(clock.Now())
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			var login struct {
+				Role string `json:"role"`
+				JWT  string `json:"jwt"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&login)
+			if login.Role != "origin-ca" || login.JWT != "default/origin-ca" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.token","lease_duration":3600,"renewable":true}}`))
+		case "/v1/secret/data/cloudflare":
+			_, _ = w.Write([]byte(`{"data":{"data":{"api-token":"from-vault"},"metadata":{"version":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tokens := tokenexchange.TokenSourceFunc(func(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error) {
+		assert.DeepEqual(t, audiences, []string{vault.Audience})
+
+		return namespace + "/" + serviceAccount, nil
+	})
+
+	tests := []struct {
+		name     string
+		role     string
+		vault    *vault.Client
+		expected metav1.Condition
+	}{
+		{
+			name:  "read",
+			role:  "origin-ca",
+			vault: vault.New(tokens, srv.Client(), clock, []string{srv.URL}),
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: now,
+				Reason:             "Verified",
+				Message:            "OriginIssuer verified and ready to sign certificates",
+			},
+		},
+		{
+			name:  "denied",
+			role:  "default",
+			vault: vault.New(tokens, srv.Client(), clock, []string{srv.URL}),
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "VaultFailed",
+				Message:            "Failed to read credentials from Vault: logging in to vault as role default: vault responded with status 403: permission denied",
+			},
+		},
+		{
+			name:  "not allowed",
+			role:  "origin-ca",
+			vault: vault.New(tokens, srv.Client(), clock, nil),
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "VaultFailed",
+				Message:            fmt.Sprintf("Failed to read credentials from Vault: vault address %s is not allowed by the controller", srv.URL),
+			},
+		},
+		{
+			name: "disabled",
+			role: "origin-ca",
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "VaultFailed",
+				Message:            "Failed to read credentials from Vault: vault is not enabled on the controller",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuerclient.NewOriginIssuer("default", "foo", issuerclient.WithVault(srv.URL, tt.role, "origin-ca", "secret/data/cloudflare", "api-token"))
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(iss).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			controller := &OriginIssuerController{
+				Client: client,
+				Reader: client,
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					assert.DeepEqual(t, creds, cfapi.Credentials{APIToken: []byte("from-vault")})
+
+					return VerifierFunc(func(ctx context.Context) error {
+						return nil
+					}), nil
+				}),
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
+				Vault:    tt.vault,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foo"}
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.DeepEqual(t, got.Status.Conditions, []metav1.Condition{tt.expected})
+		})
+	}
+}
+
+func TestOriginIssuerVerifyToken(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := metav1.NewTime(clock.Now())
+
+	verifyToken := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "verify-token"},
+		Data:       map[string][]byte{"token": []byte("read-only")},
+	}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		apiTokens []string
+		expected  metav1.Condition
+	}{
+		{
+			name:      "verified with the token",
+			objects:   []runtime.Object{verifyToken},
+			apiTokens: []string{"read-only"},
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: now,
+				Reason:             "Verified",
+				Message:            "OriginIssuer verified and ready to sign certificates",
+			},
+		},
+		{
+			name:      "token not found",
+			objects:   []runtime.Object{issuertesting.ServiceKeySecret("default")},
+			apiTokens: []string{},
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "NotFound",
+				Message:            `Failed to retrieve auth secret: secrets "verify-token" not found`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuertesting.OriginIssuer("default", "foo", issuertesting.SetIssuerSpec(issuerclient.WithVerifyTokenRef("verify-token", "token")))
+			iss.Status = v1.OriginIssuerStatus{}
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(append(tt.objects, iss)...).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			controller := &OriginIssuerController{
+				Client:   client,
+				Reader:   client,
+				Factory:  api.Factory(),
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foo"}
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.DeepEqual(t, got.Status.Conditions, []metav1.Condition{tt.expected})
+
+			// The signing credential is never retrieved to verify the issuer.
+			assert.DeepEqual(t, api.APITokens(), tt.apiTokens)
+			for _, key := range api.ServiceKeys() {
+				assert.Equal(t, key, "")
+			}
+		})
+	}
+}
+
+func TestOriginIssuerZoneCredentials(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	now := metav1.NewTime(clock.Now())
+
+	zoneToken := func(token string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-net"},
+			Data:       map[string][]byte{"token": []byte(token)},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		expected metav1.Condition
+	}{
+		{
+			name:    "verified",
+			objects: []runtime.Object{zoneToken("example-net-token")},
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: now,
+				Reason:             "Verified",
+				Message:            "OriginIssuer verified and ready to sign certificates",
+			},
+		},
+		{
+			name: "credential not found",
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "NotFound",
+				Message:            `Failed to verify the credential of zones example.net: secrets "example-net" not found`,
+			},
+		},
+		{
+			name:    "credential rejected",
+			objects: []runtime.Object{zoneToken("revoked")},
+			expected: metav1.Condition{
+				Type:               v1.ConditionReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             "VerificationFailed",
+				Message:            "Failed to verify the credential of zones example.net: token revoked",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iss := issuertesting.OriginIssuer("default", "foo", issuertesting.SetIssuerSpec(issuerclient.WithZoneAPITokenRef("example-net", "token", "example.net")))
+			iss.Status = v1.OriginIssuerStatus{}
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(append(tt.objects, iss, issuertesting.ServiceKeySecret("default"))...).
+				WithStatusSubresource(&v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{}
+			rejected := &issuertesting.FakeAPI{VerifyErr: errors.New("token revoked")}
+			controller := &OriginIssuerController{
+				Client: client,
+				Reader: client,
+				Factory: cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+					if string(creds.APIToken) == "revoked" {
+						return rejected.Factory().APIWith(creds)
+					}
+
+					return api.Factory().APIWith(creds)
+				}),
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foo"}
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+
+			got := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+			assert.DeepEqual(t, got.Status.Conditions, []metav1.Condition{tt.expected})
+		})
+	}
+}
+
+func TestOriginIssuerEndpointNotAllowed(t *testing.T) {
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	iss := issuertesting.OriginIssuer("default", "foo", issuertesting.SetIssuerSpec(issuerclient.WithCloudflareAPIURL("https://attacker.example.com")))
+	iss.Status = v1.OriginIssuerStatus{}
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(iss, issuertesting.ServiceKeySecret("default")).
+		WithStatusSubresource(&v1.OriginIssuer{}).
+		Build()
+
+	api := &issuertesting.FakeAPI{}
+	controller := &OriginIssuerController{
+		Client:   client,
+		Reader:   client,
+		Factory:  cfapi.WithAllowedEndpoints(api.Factory(), []string{"https://api-gateway.example.com"}),
+		Recorder: record.NewFakeRecorder(10),
+		Clock:    clock,
+		Log:      logf.Log,
+	}
+
+	namespaceName := types.NamespacedName{Namespace: "default", Name: "foo"}
+	_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+	assert.NilError(t, err)
+
+	got := &v1.OriginIssuer{}
+	assert.NilError(t, client.Get(context.TODO(), namespaceName, got))
+	assert.DeepEqual(t, got.Status.Conditions, []metav1.Condition{{
+		Type:               v1.ConditionReady,
+		Status:             v1.ConditionFalse,
+		LastTransitionTime: metav1.NewTime(clock.Now()),
+		Reason:             "EndpointNotAllowed",
+		Message:            "Failed to create API client: Cloudflare API endpoint https://attacker.example.com is not allowed by the controller",
+	}})
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+)
+
+// formatPEM re-encodes the PEM blocks of data, preceded by comments when the
+// format asks for them. Data without any PEM block is kept, with its line
+// endings normalized.
+func formatPEM(data []byte, format *v1.PEMFormat, comments []string) []byte {
+	var buf bytes.Buffer
+	if format.Comments {
+		for _, comment := range comments {
+			fmt.Fprintf(&buf, "# %s\n", comment)
+		}
+	}
+
+	var (
+		block  *pem.Block
+		blocks int
+	)
+	for rest := data; ; blocks++ {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		_ = pem.Encode(&buf, block)
+	}
+	if blocks == 0 {
+		buf.Write(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	}
+
+	return buf.Bytes()
+}
+
+// finishPEM applies the line endings of the format to certificates formatted
+// by formatPEM.
+func finishPEM(data []byte, format *v1.PEMFormat) []byte {
+	if format.OmitTrailingNewline {
+		data = bytes.TrimRight(data, "\n")
+	}
+
+	if format.LineEnding == v1.LineEndingCRLF {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+
+	return data
+}
+
+// pemComments describes a signed certificate in the comments preceding it.
+func pemComments(resp *cfapi.SignResponse) []string {
+	return []string{
+		fmt.Sprintf("Cloudflare Origin CA certificate %s", resp.Id),
+		fmt.Sprintf("Request type: %s", resp.Type),
+		fmt.Sprintf("Hostnames: %s", strings.Join(resp.Hostnames, ", ")),
+		fmt.Sprintf("Expires: %s", resp.Expiration.UTC().Format(time.RFC3339)),
+	}
+}
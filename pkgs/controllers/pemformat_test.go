@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"gotest.tools/v3/assert"
+)
+
+func TestFormatPEM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	leaf := reuseLeaf(t, key, time.Now(), time.Now().Add(time.Hour))
+	block, _ := pem.Decode(leaf)
+	// A certificate as returned with CRLF line endings and without a
+	// trailing newline.
+	returned := bytes.TrimRight(bytes.ReplaceAll(leaf, []byte("\n"), []byte("\r\n")), "\r\n")
+
+	resp := &cfapi.SignResponse{
+		Id:         "9001",
+		Type:       "origin-ecc",
+		Hostnames:  []string{"example.com", "www.example.com"},
+		Expiration: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name     string
+		format   v1.PEMFormat
+		expected string
+	}{
+		{
+			name:     "normalized",
+			expected: string(leaf),
+		},
+		{
+			name:     "crlf",
+			format:   v1.PEMFormat{LineEnding: v1.LineEndingCRLF},
+			expected: strings.ReplaceAll(string(leaf), "\n", "\r\n"),
+		},
+		{
+			name:     "omit trailing newline",
+			format:   v1.PEMFormat{OmitTrailingNewline: true},
+			expected: strings.TrimSuffix(string(leaf), "\n"),
+		},
+		{
+			name:   "comments",
+			format: v1.PEMFormat{Comments: true},
+			expected: "# Cloudflare Origin CA certificate 9001\n" +
+				"# Request type: origin-ecc\n" +
+				"# Hostnames: example.com, www.example.com\n" +
+				"# Expires: 2030-01-01T00:00:00Z\n" +
+				string(leaf),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := finishPEM(formatPEM(returned, &tt.format, pemComments(resp)), &tt.format)
+			assert.Equal(t, string(got), tt.expected)
+
+			decoded, _ := pem.Decode(got)
+			assert.Assert(t, decoded != nil)
+			assert.DeepEqual(t, decoded.Bytes, block.Bytes)
+		})
+	}
+
+	// Data without PEM blocks is kept, with its line endings normalized.
+	assert.Equal(t, string(formatPEM([]byte("rsa root\r\n"), &v1.PEMFormat{}, nil)), "rsa root\n")
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// rateLimitedRequeueDelay is how long CertificateRequests wait after
+	// being rate limited by the Cloudflare API, when it didn't say how long.
+	rateLimitedRequeueDelay = time.Minute
+
+	// originDBWriteRequeueDelay is how long CertificateRequests wait after
+	// the Cloudflare API failed to store their certificate, which is usually
+	// brief.
+	originDBWriteRequeueDelay = 15 * time.Second
+
+	// transientRequeueDelay is how long CertificateRequests wait after any
+	// other transient error of the Cloudflare API.
+	transientRequeueDelay = 30 * time.Second
+
+	// maxRetryBackoff bounds how long CertificateRequests failing
+	// repeatedly wait between attempts.
+	maxRetryBackoff = 15 * time.Minute
+)
+
+// requeueDelay returns how long to wait before signing again a request that
+// failed with err, and whether it may succeed then. The delay asked for by
+// the Retry-After header of the response is preferred to the defaults of
+// each kind of error.
+func requeueDelay(err error) (time.Duration, bool) {
+	var rateLimited *cfapi.RateLimitError
+	if errors.As(err, &rateLimited) {
+		if rateLimited.RetryAfter > 0 {
+			return rateLimited.RetryAfter, true
+		}
+
+		return rateLimitedRequeueDelay, true
+	}
+
+	var transient *cfapi.TransientError
+	if !errors.As(err, &transient) {
+		return 0, false
+	}
+
+	if transient.RetryAfter > 0 {
+		return transient.RetryAfter, true
+	}
+
+	var apiError *cfapi.APIError
+	switch {
+	case errors.As(err, &apiError) && apiError.StatusCode == http.StatusTooManyRequests:
+		return rateLimitedRequeueDelay, true
+	case cfapi.IsOriginDBWriteError(err):
+		return originDBWriteRequeueDelay, true
+	default:
+		return transientRequeueDelay, true
+	}
+}
+
+// retryBackoff returns how long to wait before the attempt following the
+// given number of failed attempts, doubling the delay of the error for each
+// earlier failure, up to maxRetryBackoff, though never below the delay asked
+// for by the Cloudflare API.
+func retryBackoff(delay time.Duration, failures int) time.Duration {
+	backoff := delay
+	for i := 1; i < failures && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	return max(min(backoff, maxRetryBackoff), delay)
+}
+
+// retryState returns the number of failed attempts recorded on the
+// CertificateRequest, and when it is next attempted. Malformed annotations
+// are ignored.
+func retryState(cr *certmanager.CertificateRequest) (int, time.Time) {
+	failures, _ := strconv.Atoi(cr.Annotations[v1.RetryCountAnnotation])
+	next, _ := time.Parse(time.RFC3339, cr.Annotations[v1.NextAttemptAnnotation])
+
+	return max(failures, 0), next
+}
+
+// setRetryState records the retry state on the CertificateRequest.
+func setRetryState(cr *certmanager.CertificateRequest, failures int, next time.Time) {
+	metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.RetryCountAnnotation, strconv.Itoa(failures))
+	metav1.SetMetaDataAnnotation(&cr.ObjectMeta, v1.NextAttemptAnnotation, next.UTC().Format(time.RFC3339))
+}
+
+// clearRetryState removes the retry state from the CertificateRequest.
+func clearRetryState(cr *certmanager.CertificateRequest) {
+	delete(cr.Annotations, v1.RetryCountAnnotation)
+	delete(cr.Annotations, v1.NextAttemptAnnotation)
+}
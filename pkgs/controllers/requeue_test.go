@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"gotest.tools/v3/assert"
+)
+
+func TestRequeueDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		delay   time.Duration
+		requeue bool
+	}{
+		{
+			name:    "rate limited",
+			err:     &cfapi.RateLimitError{RetryAfter: 2 * time.Minute},
+			delay:   2 * time.Minute,
+			requeue: true,
+		},
+		{
+			name:    "rate limited without retry after",
+			err:     &cfapi.RateLimitError{},
+			delay:   rateLimitedRequeueDelay,
+			requeue: true,
+		},
+		{
+			name:    "origin database write",
+			err:     &cfapi.TransientError{Err: &cfapi.APIError{Code: 1100, StatusCode: http.StatusOK}, Attempts: 4},
+			delay:   originDBWriteRequeueDelay,
+			requeue: true,
+		},
+		{
+			name:    "too many requests",
+			err:     &cfapi.TransientError{Err: &cfapi.APIError{Code: 10000, StatusCode: http.StatusTooManyRequests}, Attempts: 4},
+			delay:   rateLimitedRequeueDelay,
+			requeue: true,
+		},
+		{
+			name:    "retry after",
+			err:     fmt.Errorf("unable to sign request: %w", &cfapi.TransientError{Err: &cfapi.APIError{Code: 1100, StatusCode: http.StatusServiceUnavailable}, Attempts: 4, RetryAfter: 45 * time.Second}),
+			delay:   45 * time.Second,
+			requeue: true,
+		},
+		{
+			name:    "server error",
+			err:     &cfapi.TransientError{Err: &cfapi.APIError{Code: 502, StatusCode: http.StatusBadGateway}, Attempts: 4},
+			delay:   transientRequeueDelay,
+			requeue: true,
+		},
+		{
+			name: "permanent",
+			err:  &cfapi.APIError{Code: 1010, StatusCode: http.StatusBadRequest},
+		},
+		{
+			name: "other",
+			err:  errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			delay, requeue := requeueDelay(tt.err)
+			assert.Equal(t, requeue, tt.requeue)
+			assert.Equal(t, delay, tt.delay)
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		failures int
+		backoff  time.Duration
+	}{
+		{name: "first failure", delay: 15 * time.Second, failures: 1, backoff: 15 * time.Second},
+		{name: "second failure", delay: 15 * time.Second, failures: 2, backoff: 30 * time.Second},
+		{name: "fourth failure", delay: 15 * time.Second, failures: 4, backoff: 2 * time.Minute},
+		{name: "capped", delay: 15 * time.Second, failures: 100, backoff: maxRetryBackoff},
+		{name: "retry after beyond the cap", delay: time.Hour, failures: 3, backoff: time.Hour},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, retryBackoff(tt.delay, tt.failures), tt.backoff)
+		})
+	}
+}
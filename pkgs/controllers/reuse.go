@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// forcedReissueReasons are the reasons of the Issuing condition of
+// Certificates whose re-issuance was explicitly requested, which never reuse
+// the certificate of a previous revision.
+var forcedReissueReasons = map[string]bool{
+	"ManuallyTriggered": true,
+	rootRotatedReason:   true,
+}
+
+// reusable returns the CertificateRequest of a previous revision of the same
+// Certificate whose Origin CA certificate can be published again, rather
+// than signing a new one. Certificates are only reused for the same issuer,
+// duration, public key and hostnames, signed as the request types of the
+// issuer's spec, until their owning Certificate would renew them anyway, and
+// never when re-issuance was forced. Any failure to decide means a new
+// certificate is signed.
+func (r *CertificateRequestController) reusable(ctx context.Context, log logr.Logger, cr *certmanager.CertificateRequest, issuerspec v1.OriginIssuerSpec) *certmanager.CertificateRequest {
+	revisions, err := r.earlierRevisions(ctx, cr)
+	if err != nil {
+		log.V(4).Info("unable to list CertificateRequests, not reusing a previous certificate", "error", err.Error())
+
+		return nil
+	}
+
+	// The latest issued revision is the certificate currently published by
+	// the Certificate.
+	var prev *certmanager.CertificateRequest
+	for _, item := range revisions {
+		if issued(item) {
+			prev = item
+		}
+	}
+
+	if prev == nil {
+		return nil
+	}
+
+	name := cr.Annotations[certmanager.CertificateNameKey]
+	var crt certmanager.Certificate
+	if err := r.Reader.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: name}, &crt); err != nil {
+		log.V(4).Info("unable to retrieve owning Certificate, not reusing a previous certificate", "certificate", name, "error", err.Error())
+
+		return nil
+	}
+
+	if cond := cmutil.GetCertificateCondition(&crt, certmanager.CertificateConditionIssuing); cond != nil && forcedReissueReasons[cond.Reason] {
+		return nil
+	}
+
+	if prev.Annotations[v1.CertificateIDAnnotation] == "" || !prev.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	// The certificate of the previous revision may have been stripped from
+	// the cache.
+	if len(prev.Status.Certificate) == 0 {
+		var full certmanager.CertificateRequest
+		if err := r.Reader.Get(ctx, client.ObjectKeyFromObject(prev), &full); err != nil {
+			log.V(4).Info("unable to retrieve previous revision, not reusing its certificate", "previous", prev.Name, "error", err.Error())
+
+			return nil
+		}
+		prev = &full
+	}
+
+	if prev.Spec.IssuerRef != cr.Spec.IssuerRef || !sameDuration(prev.Spec.Duration, cr.Spec.Duration) {
+		return nil
+	}
+
+	reqTypes := provisioners.RequestTypes(issuerspec.RequestType, issuerspec.DualStack)
+	if len(strings.Split(prev.Annotations[v1.CertificateIDAnnotation], ",")) != len(reqTypes) {
+		return nil
+	}
+
+	if same, err := sameCSRIdentity(prev.Spec.Request, cr.Spec.Request); err != nil || !same {
+		return nil
+	}
+
+	block, _ := pem.Decode(prev.Status.Certificate)
+	if block == nil {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || !signedAs(leaf, reqTypes[0]) {
+		return nil
+	}
+
+	// cert-manager renews certificates a third of their lifetime before
+	// they expire, unless the Certificate says otherwise.
+	renewBefore := leaf.NotAfter.Sub(leaf.NotBefore) / 3
+	if crt.Spec.RenewBefore != nil {
+		renewBefore = crt.Spec.RenewBefore.Duration
+	}
+	if !r.Clock.Now().Before(leaf.NotAfter.Add(-renewBefore)) {
+		return nil
+	}
+
+	return prev
+}
+
+// earlierRevisions returns the CertificateRequests of the revisions of the
+// Certificate owning cr that precede it, ordered by revision. Nothing is
+// returned for requests not owned by a Certificate.
+func (r *CertificateRequestController) earlierRevisions(ctx context.Context, cr *certmanager.CertificateRequest) ([]*certmanager.CertificateRequest, error) {
+	name := cr.Annotations[certmanager.CertificateNameKey]
+	revision, err := strconv.Atoi(cr.Annotations[certmanager.CertificateRequestRevisionAnnotationKey])
+	if name == "" || err != nil || revision <= 1 {
+		return nil, nil
+	}
+
+	owner := metav1.GetControllerOf(cr)
+	if owner == nil || owner.Kind != certmanager.CertificateKind || owner.APIVersion != certmanager.SchemeGroupVersion.String() || owner.Name != name {
+		return nil, nil
+	}
+
+	var list certmanager.CertificateRequestList
+	if err := r.Client.List(ctx, &list, client.InNamespace(cr.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var revisions []*certmanager.CertificateRequest
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.Annotations[certmanager.CertificateNameKey] != name {
+			continue
+		}
+
+		if rev, err := strconv.Atoi(item.Annotations[certmanager.CertificateRequestRevisionAnnotationKey]); err == nil && rev < revision {
+			revisions = append(revisions, item)
+		}
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		a, _ := strconv.Atoi(revisions[i].Annotations[certmanager.CertificateRequestRevisionAnnotationKey])
+		b, _ := strconv.Atoi(revisions[j].Annotations[certmanager.CertificateRequestRevisionAnnotationKey])
+
+		return a < b
+	})
+
+	return revisions, nil
+}
+
+// certificateIDs returns the IDs of the Origin CA certificates recorded on
+// the CertificateRequests.
+func certificateIDs(crs []*certmanager.CertificateRequest) []string {
+	var ids []string
+	for _, cr := range crs {
+		if recorded := cr.Annotations[v1.CertificateIDAnnotation]; recorded != "" {
+			ids = append(ids, strings.Split(recorded, ",")...)
+		}
+	}
+
+	return ids
+}
+
+// releaseReused removes the revoke finalizer of the earlier revisions whose
+// certificates the duplicate policy reused for cr, so that deleting them no
+// longer revokes a certificate still in use. Failures are only reported, as
+// the request was issued.
+func (r *CertificateRequestController) releaseReused(ctx context.Context, log logr.Logger, cr *certmanager.CertificateRequest, revisions []*certmanager.CertificateRequest, ids []string) {
+	for _, prev := range revisions {
+		reused := false
+		for _, id := range certificateIDs([]*certmanager.CertificateRequest{prev}) {
+			reused = reused || slices.Contains(ids, id)
+		}
+
+		if !reused || !controllerutil.RemoveFinalizer(prev, v1.RevokeFinalizer) {
+			continue
+		}
+
+		if err := r.Client.Update(ctx, prev); err != nil {
+			log.Error(err, "failed to remove revoke finalizer of previous revision", "previous", prev.Name)
+			recordEvent(ctx, r.Recorder, cr, core.EventTypeWarning, "ReleaseReusedFailed", fmt.Sprintf("Failed to remove the revoke finalizer of CertificateRequest %s, whose certificate was reused: %v", prev.Name, err))
+		}
+	}
+}
+
+// reuse publishes the Origin CA certificate of the previous revision prev on
+// the CertificateRequest. The revoke finalizer is moved to the
+// CertificateRequest, so that deleting the previous revision no longer
+// revokes a certificate still in use.
+func (r *CertificateRequestController) reuse(ctx context.Context, log logr.Logger, cr, prev *certmanager.CertificateRequest) error {
+	ids := prev.Annotations[v1.CertificateIDAnnotation]
+	for _, key := range []string{v1.CertificateIDAnnotation, v1.CertificateExpirationAnnotation, v1.RayIDAnnotation} {
+		if value, ok := prev.Annotations[key]; ok {
+			metav1.SetMetaDataAnnotation(&cr.ObjectMeta, key, value)
+		}
+	}
+	if controllerutil.ContainsFinalizer(prev, v1.RevokeFinalizer) {
+		controllerutil.AddFinalizer(cr, v1.RevokeFinalizer)
+	}
+
+	if err := r.Client.Update(ctx, cr); err != nil {
+		log.Error(err, "failed to record reused certificate ID", "id", ids)
+
+		return err
+	}
+
+	if controllerutil.RemoveFinalizer(prev, v1.RevokeFinalizer) {
+		if err := r.Client.Update(ctx, prev); err != nil {
+			log.Error(err, "failed to remove revoke finalizer of previous revision", "previous", prev.Name)
+
+			return err
+		}
+	}
+
+	cr.Status.Certificate = prev.Status.Certificate
+	cr.Status.CA = prev.Status.CA
+	_ = r.setStatus(ctx, cr, cmmeta.ConditionTrue, certmanager.CertificateRequestReasonIssued, "Certificate issued")
+
+	log.Info("reused certificate of previous revision", "id", ids, "previous", prev.Name)
+	recordEvent(ctx, r.Recorder, cr, core.EventTypeNormal, "Reused", fmt.Sprintf("Reused certificate %s of CertificateRequest %s, as its key and hostnames are unchanged", ids, prev.Name))
+
+	return nil
+}
+
+// signedAs reports whether the certificate was signed by the Origin CA of
+// the request type, which sign with ECDSA and RSA keys respectively.
+func signedAs(cert *x509.Certificate, requestType string) bool {
+	switch cert.SignatureAlgorithm {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return requestType == "origin-ecc"
+	default:
+		return requestType == "origin-rsa"
+	}
+}
+
+func sameDuration(a, b *metav1.Duration) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Duration == b.Duration
+}
+
+// sameCSRIdentity reports whether two CSRs request certificates for the same
+// public key and hostnames, ignoring their order.
+func sameCSRIdentity(a, b []byte) (bool, error) {
+	ca, err := pki.DecodeX509CertificateRequestBytes(a)
+	if err != nil {
+		return false, err
+	}
+	cb, err := pki.DecodeX509CertificateRequestBytes(b)
+	if err != nil {
+		return false, err
+	}
+
+	if string(ca.RawSubjectPublicKeyInfo) != string(cb.RawSubjectPublicKeyInfo) {
+		return false, nil
+	}
+
+	return strings.Join(csrHostnames(ca), ",") == strings.Join(csrHostnames(cb), ","), nil
+}
+
+func csrHostnames(csr *x509.CertificateRequest) []string {
+	hostnames := append([]string{csr.Subject.CommonName}, csr.DNSNames...)
+	sort.Strings(hostnames)
+
+	return hostnames
+}
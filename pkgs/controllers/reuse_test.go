@@ -0,0 +1,426 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// strippedCache returns a client listing CertificateRequests as a cache
+// transformed by StripCompletedCertificateRequest does.
+func strippedCache(c client.WithWatch) client.WithWatch {
+	return interceptor.NewClient(c, interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if err := c.List(ctx, list, opts...); err != nil {
+				return err
+			}
+
+			if crs, ok := list.(*cmapi.CertificateRequestList); ok {
+				for i := range crs.Items {
+					_, _ = StripCompletedCertificateRequest(&crs.Items[i])
+				}
+			}
+
+			return nil
+		},
+	})
+}
+
+func TestCertificateRequestReuse(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	// The previous revision was issued 10 of 90 days ago.
+	leaf := reuseLeaf(t, key, clock.Now().Add(-10*24*time.Hour), clock.Now().Add(80*24*time.Hour))
+
+	tests := []struct {
+		name        string
+		disabled    bool
+		stripped    bool
+		key         crypto.Signer
+		dnsNames    []string
+		duration    *metav1.Duration
+		requestType v1.RequestType
+		renewBefore time.Duration
+		reason      string
+		issuer      []issuerclient.SpecOption
+		failed      bool
+		reused      bool
+	}{
+		{
+			name:   "unchanged",
+			reused: true,
+		},
+		{
+			name:     "stripped from the cache",
+			stripped: true,
+			reused:   true,
+		},
+		{
+			name:     "hostnames reordered",
+			dnsNames: []string{"www.example.com", "example.com"},
+			reused:   true,
+		},
+		{
+			name:     "disabled",
+			disabled: true,
+		},
+		{
+			name: "private key rotated",
+			key:  otherKey,
+		},
+		{
+			name:     "hostnames changed",
+			dnsNames: []string{"example.com", "api.example.com"},
+		},
+		{
+			name:     "duration changed",
+			duration: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+		},
+		{
+			name:        "request type changed",
+			requestType: v1.RequestTypeOriginRSA,
+		},
+		{
+			name:        "due for renewal",
+			renewBefore: 85 * 24 * time.Hour,
+		},
+		{
+			name:   "manually triggered",
+			reason: "ManuallyTriggered",
+		},
+		{
+			name:   "root rotated",
+			reason: rootRotatedReason,
+		},
+		{
+			name:   "hostnames no longer allowed",
+			issuer: []issuerclient.SpecOption{issuerclient.WithAllowedDNS([]string{"example.com"}, nil)},
+			failed: true,
+		},
+		{
+			name:   "zone no longer allowed",
+			issuer: []issuerclient.SpecOption{issuerclient.WithAllowedDNS(nil, []string{"example.org"})},
+			failed: true,
+		},
+		{
+			name:   "hostnames still allowed",
+			issuer: []issuerclient.SpecOption{issuerclient.WithAllowedDNS(nil, []string{"example.com"})},
+			reused: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signer := crypto.Signer(key)
+			if tt.key != nil {
+				signer = tt.key
+			}
+			dnsNames := []string{"example.com", "www.example.com"}
+			if tt.dnsNames != nil {
+				dnsNames = tt.dnsNames
+			}
+			requestType := v1.RequestTypeOriginECC
+			if tt.requestType != "" {
+				requestType = tt.requestType
+			}
+
+			crt := cmgen.Certificate("web", cmgen.SetCertificateNamespace("default"), cmgen.SetCertificateUID("web-uid"))
+			if tt.renewBefore > 0 {
+				crt.Spec.RenewBefore = &metav1.Duration{Duration: tt.renewBefore}
+			}
+			if tt.reason != "" {
+				crt.Status.Conditions = []cmapi.CertificateCondition{{Type: cmapi.CertificateConditionIssuing, Status: cmmeta.ConditionTrue, Reason: tt.reason}}
+			}
+
+			revision := func(rev int, request []byte, duration *metav1.Duration) *cmapi.CertificateRequest {
+				return issuertesting.CertificateRequest("default", "web-"+strconv.Itoa(rev),
+					cmgen.SetCertificateRequestCSR(request),
+					cmgen.SetCertificateRequestDuration(duration),
+					issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					cmgen.AddCertificateRequestOwnerReferences(cmgen.CertificateRef("web", "web-uid")),
+					cmgen.SetCertificateRequestAnnotations(map[string]string{
+						cmapi.CertificateNameKey:                      "web",
+						cmapi.CertificateRequestRevisionAnnotationKey: strconv.Itoa(rev),
+					}),
+				)
+			}
+
+			prev := revision(1, reuseCSR(t, key, "example.com", "www.example.com"), nil)
+			prev.Annotations[v1.CertificateIDAnnotation] = "9001"
+			prev.Finalizers = []string{v1.RevokeFinalizer}
+			prev.Status.Certificate = leaf
+			prev.Status.Conditions = []cmapi.CertificateRequestCondition{{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionTrue, Reason: cmapi.CertificateRequestReasonIssued}}
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					crt,
+					prev,
+					revision(2, reuseCSR(t, signer, dnsNames...), tt.duration),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(append([]issuerclient.SpecOption{issuerclient.WithRequestType(requestType)}, tt.issuer...)...)),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			cached := client
+			if tt.stripped {
+				cached = strippedCache(client)
+			}
+
+			api := &issuertesting.FakeAPI{}
+			controller := &CertificateRequestController{
+				Client:            cached,
+				Reader:            client,
+				Log:               logf.Log,
+				Recorder:          record.NewFakeRecorder(10),
+				Clock:             clock,
+				Factory:           api.Factory(),
+				RevokeOnDelete:    true,
+				ReuseCertificates: !tt.disabled,
+			}
+
+			_, err := reconcile.AsReconciler(cached, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-2"},
+			})
+
+			var got, gotPrev cmapi.CertificateRequest
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-2"}, &got))
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-1"}, &gotPrev))
+
+			// Requests the issuer no longer allows are failed, rather than
+			// reusing a certificate signed before its policy changed.
+			if tt.failed {
+				assert.Assert(t, errors.Is(err, reconcile.TerminalError(nil)), "expected a terminal error, got %v", err)
+				assert.Equal(t, readyReason(&got), cmapi.CertificateRequestReasonFailed)
+				assert.Equal(t, len(api.SignedHostnames()), 0)
+				assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], "")
+				assert.DeepEqual(t, gotPrev.Finalizers, []string{v1.RevokeFinalizer})
+
+				return
+			}
+			assert.NilError(t, err)
+
+			assert.Equal(t, readyReason(&got), cmapi.CertificateRequestReasonIssued)
+			assert.DeepEqual(t, got.Finalizers, []string{v1.RevokeFinalizer})
+
+			if tt.reused {
+				assert.Equal(t, len(api.SignedHostnames()), 0)
+				assert.Equal(t, got.Annotations[v1.CertificateIDAnnotation], "9001")
+				assert.DeepEqual(t, got.Status.Certificate, leaf)
+				assert.Equal(t, len(gotPrev.Finalizers), 0)
+			} else {
+				assert.Equal(t, len(api.SignedHostnames()), 1)
+				assert.Assert(t, got.Annotations[v1.CertificateIDAnnotation] != "9001")
+				assert.DeepEqual(t, gotPrev.Finalizers, []string{v1.RevokeFinalizer})
+			}
+		})
+	}
+}
+
+func readyReason(cr *cmapi.CertificateRequest) string {
+	for _, c := range cr.Status.Conditions {
+		if c.Type == cmapi.CertificateRequestConditionReady {
+			return c.Reason
+		}
+	}
+
+	return ""
+}
+
+// reuseCSR returns a PEM encoded CSR for the DNS names, signed by the key.
+func reuseCSR(t *testing.T, key crypto.Signer, dnsNames ...string) []byte {
+	t.Helper()
+
+	der, err := pki.EncodeCSR(&x509.CertificateRequest{
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+		PublicKey:          key.Public(),
+		DNSNames:           dnsNames,
+	}, key)
+	assert.NilError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// reuseLeaf returns a PEM encoded certificate for the key, signed by an ECDSA
+// CA as the Origin CA does for origin-ecc requests.
+func reuseLeaf(t *testing.T, key *ecdsa.PrivateKey, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, caKey)
+	assert.NilError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCertificateRequestDuplicatePolicy(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		previous string
+		reason   string
+	}{
+		{
+			name:     "renewing the previous revision",
+			previous: "1",
+			reason:   cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name:     "duplicating another certificate",
+			previous: "9001",
+			reason:   cmapi.CertificateRequestReasonFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			revision := func(rev int) *cmapi.CertificateRequest {
+				return issuertesting.CertificateRequest("default", "web-"+strconv.Itoa(rev),
+					issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+					cmgen.AddCertificateRequestOwnerReferences(cmgen.CertificateRef("web", "web-uid")),
+					cmgen.SetCertificateRequestAnnotations(map[string]string{
+						cmapi.CertificateNameKey:                      "web",
+						cmapi.CertificateRequestRevisionAnnotationKey: strconv.Itoa(rev),
+					}),
+				)
+			}
+
+			prev := revision(1)
+			prev.Annotations[v1.CertificateIDAnnotation] = tt.previous
+			prev.Status.Conditions = []cmapi.CertificateRequestCondition{{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionTrue, Reason: cmapi.CertificateRequestReasonIssued}}
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					prev,
+					revision(2),
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(func(s *v1.OriginIssuerSpec) {
+						s.DuplicatePolicy = v1.DuplicatePolicyFail
+						s.RequestType = v1.RequestTypeOriginECC
+						s.ZoneID = "023e105f4ecef8ad9ca31a8372d0c353"
+					})),
+					issuertesting.ServiceKeySecret("default"),
+				).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).
+				Build()
+
+			// The certificate of the zone for the same hostnames.
+			api := &issuertesting.FakeAPI{}
+			_, err := api.Sign(context.Background(), &cfapi.SignRequest{Hostnames: []string{"example.com"}, Type: "origin-ecc", Validity: 7})
+			assert.NilError(t, err)
+
+			controller := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            fakeClock.NewFakeClock(time.Now()),
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			_, _ = reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-2"},
+			})
+
+			var got cmapi.CertificateRequest
+			assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-2"}, &got))
+			assert.Equal(t, readyReason(&got), tt.reason)
+		})
+	}
+}
+
+func TestReleaseReused(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	revision := func(name, ids string) *cmapi.CertificateRequest {
+		return issuertesting.CertificateRequest("default", name,
+			cmgen.SetCertificateRequestAnnotations(map[string]string{v1.CertificateIDAnnotation: ids}),
+			func(cr *cmapi.CertificateRequest) { cr.Finalizers = []string{v1.RevokeFinalizer} },
+		)
+	}
+
+	reused, other := revision("web-1", "1,2"), revision("web-2", "3")
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(reused, other).
+		Build()
+
+	controller := &CertificateRequestController{
+		Client:   client,
+		Log:      logf.Log,
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	cr := issuertesting.CertificateRequest("default", "web-3")
+	controller.releaseReused(context.Background(), logf.Log, cr, []*cmapi.CertificateRequest{reused, other}, []string{"2", "4"})
+
+	var got cmapi.CertificateRequest
+	assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-1"}, &got))
+	assert.Equal(t, len(got.Finalizers), 0)
+	assert.NilError(t, client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-2"}, &got))
+	assert.DeepEqual(t, got.Finalizers, []string{v1.RevokeFinalizer})
+}
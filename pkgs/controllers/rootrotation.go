@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RootRefresher fetches the current Origin CA root certificate of a request
+// type, such as "origin-rsa", bypassing any cache.
+type RootRefresher interface {
+	Refresh(ctx context.Context, requestType string) ([]byte, error)
+}
+
+// RootRotationWatcher periodically fetches the Origin CA roots, and renews
+// the Certificates of OriginIssuers and ClusterOriginIssuers when a root of
+// their issuer's request types was rotated, so that they pick up the new
+// chain promptly rather than at their next renewal.
+//
+// The fingerprints of the roots are recorded on each Certificate in the
+// OriginCARootAnnotation. Certificates without it are annotated without
+// being renewed, and renewed once the roots no longer match, by setting
+// their Issuing condition as cmctl renew does.
+type RootRotationWatcher struct {
+	Client   client.Client
+	Roots    RootRefresher
+	Recorder record.EventRecorder
+
+	// Interval between checks.
+	Interval time.Duration
+
+	// DefaultClusterIssuer is the name of the ClusterOriginIssuer that
+	// Certificates referencing DefaultClusterIssuerAlias are issued by.
+	DefaultClusterIssuer string
+
+	Clock clock.WithTicker
+	Log   logr.Logger
+}
+
+// rootRotatedReason is the reason of the Issuing condition set on
+// Certificates renewed after a root rotation.
+const rootRotatedReason = "OriginCARootRotated"
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates/status,verbs=get;update;patch
+
+// Start checks for rotated roots every Interval until the context is done.
+func (w *RootRotationWatcher) Start(ctx context.Context) error {
+	ticker := w.Clock.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Check(ctx); err != nil {
+			w.Log.Error(err, "failed to check for rotated Origin CA roots")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// NeedLeaderElection reports that only the leader checks for rotated roots,
+// as it updates Certificates.
+func (w *RootRotationWatcher) NeedLeaderElection() bool {
+	return true
+}
+
+// Check fetches the Origin CA roots, and renews the Certificates whose
+// recorded roots no longer match. Certificates are checked independently, so
+// failing to check one doesn't prevent checking the others; the failures
+// are joined.
+func (w *RootRotationWatcher) Check(ctx context.Context) error {
+	var certificates certmanager.CertificateList
+	if err := w.Client.List(ctx, &certificates); err != nil {
+		return fmt.Errorf("listing Certificates: %w", err)
+	}
+
+	fingerprints := make(map[string]string)
+	fingerprint := func(requestType string) (string, error) {
+		if fp, ok := fingerprints[requestType]; ok {
+			return fp, nil
+		}
+
+		root, err := w.Roots.Refresh(ctx, requestType)
+		if err != nil {
+			return "", err
+		}
+
+		block, _ := pem.Decode(root)
+		if block == nil {
+			return "", fmt.Errorf("root of request type %q is not PEM encoded", requestType)
+		}
+
+		sum := sha256.Sum256(block.Bytes)
+		fingerprints[requestType] = hex.EncodeToString(sum[:])
+
+		return fingerprints[requestType], nil
+	}
+
+	var errs []error
+	for i := range certificates.Items {
+		crt := &certificates.Items[i]
+		if crt.Spec.IssuerRef.Group != v1.GroupVersion.Group {
+			continue
+		}
+
+		if err := w.check(ctx, crt, fingerprint); err != nil {
+			errs = append(errs, fmt.Errorf("certificate %s/%s: %w", crt.Namespace, crt.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *RootRotationWatcher) check(ctx context.Context, crt *certmanager.Certificate, fingerprint func(string) (string, error)) error {
+	log := w.Log.WithValues("namespace", crt.Namespace, "certificate", crt.Name)
+
+	var spec v1.OriginIssuerSpec
+	switch crt.Spec.IssuerRef.Kind {
+	case "", "OriginIssuer":
+		var iss v1.OriginIssuer
+		if err := w.Client.Get(ctx, types.NamespacedName{Namespace: crt.Namespace, Name: crt.Spec.IssuerRef.Name}, &iss); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		spec = iss.Spec
+	case "ClusterOriginIssuer":
+		var iss v1.ClusterOriginIssuer
+		if err := w.Client.Get(ctx, types.NamespacedName{Name: clusterIssuerName(crt.Spec.IssuerRef.Name, w.DefaultClusterIssuer)}, &iss); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		spec = iss.Spec
+	default:
+		return nil
+	}
+
+	var fps []string
+	for _, requestType := range provisioners.RequestTypes(spec.RequestType, spec.DualStack) {
+		fp, err := fingerprint(requestType)
+		if err != nil {
+			return err
+		}
+
+		fps = append(fps, fp)
+	}
+	current := strings.Join(fps, ",")
+
+	previous, ok := crt.Annotations[v1.OriginCARootAnnotation]
+	if previous == current {
+		return nil
+	}
+
+	if ok && !cmutil.CertificateHasCondition(crt, certmanager.CertificateCondition{Type: certmanager.CertificateConditionIssuing, Status: cmmeta.ConditionTrue}) {
+		log.Info("Origin CA root rotated, renewing certificate", "previous", previous, "current", current)
+
+		cmutil.SetCertificateCondition(crt, crt.Generation, certmanager.CertificateConditionIssuing, cmmeta.ConditionTrue, rootRotatedReason, "Renewing certificate as the Origin CA root was rotated")
+		if err := w.Client.Status().Update(ctx, crt); err != nil {
+			if apierrors.IsConflict(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		w.Recorder.Event(crt, core.EventTypeNormal, rootRotatedReason, "Renewing certificate as the Origin CA root was rotated")
+	}
+
+	if crt.Annotations == nil {
+		crt.Annotations = make(map[string]string)
+	}
+	crt.Annotations[v1.OriginCARootAnnotation] = current
+
+	if err := w.Client.Update(ctx, crt); err != nil && !apierrors.IsConflict(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+type rootRefresherFunc func(ctx context.Context, requestType string) ([]byte, error)
+
+func (f rootRefresherFunc) Refresh(ctx context.Context, requestType string) ([]byte, error) {
+	return f(ctx, requestType)
+}
+
+func TestRootRotationWatcher(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := func(der string) string {
+		sum := sha256.Sum256([]byte(der))
+		return hex.EncodeToString(sum[:])
+	}
+
+	issuing := cmgen.SetCertificateStatusCondition(cmapi.CertificateCondition{Type: cmapi.CertificateConditionIssuing, Status: cmmeta.ConditionTrue, Reason: "Renewing"})
+	rotated := map[string]string{v1.OriginCARootAnnotation: fingerprint("old-rsa-root")}
+	originIssuer := cmgen.SetCertificateIssuer(cmmeta.ObjectReference{Name: "foobar", Kind: "OriginIssuer", Group: v1.GroupVersion.Group})
+
+	tests := []struct {
+		name        string
+		certificate *cmapi.Certificate
+		refreshErr  error
+		annotation  string
+		renewed     bool
+		events      []string
+	}{
+		{
+			name:        "not annotated",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), originIssuer),
+			annotation:  fingerprint("rsa-root"),
+		},
+		{
+			name:        "unchanged",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), originIssuer, cmgen.AddCertificateAnnotations(map[string]string{v1.OriginCARootAnnotation: fingerprint("rsa-root")})),
+			annotation:  fingerprint("rsa-root"),
+		},
+		{
+			name:        "rotated",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), originIssuer, cmgen.AddCertificateAnnotations(rotated)),
+			annotation:  fingerprint("rsa-root"),
+			renewed:     true,
+			events:      []string{"Normal OriginCARootRotated Renewing certificate as the Origin CA root was rotated"},
+		},
+		{
+			name:        "rotated while issuing",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), originIssuer, cmgen.AddCertificateAnnotations(rotated), issuing),
+			annotation:  fingerprint("rsa-root"),
+		},
+		{
+			name: "dual stack",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), cmgen.AddCertificateAnnotations(rotated),
+				cmgen.SetCertificateIssuer(cmmeta.ObjectReference{Name: "dual-stack", Kind: "ClusterOriginIssuer", Group: v1.GroupVersion.Group}),
+			),
+			annotation: fingerprint("ecc-root") + "," + fingerprint("rsa-root"),
+			renewed:    true,
+			events:     []string{"Normal OriginCARootRotated Renewing certificate as the Origin CA root was rotated"},
+		},
+		{
+			name:        "roots unavailable",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), originIssuer, cmgen.AddCertificateAnnotations(rotated)),
+			refreshErr:  errors.New("connection refused"),
+			annotation:  fingerprint("old-rsa-root"),
+		},
+		{
+			name: "issuer missing",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), cmgen.AddCertificateAnnotations(rotated),
+				cmgen.SetCertificateIssuer(cmmeta.ObjectReference{Name: "missing", Kind: "OriginIssuer", Group: v1.GroupVersion.Group}),
+			),
+			annotation: fingerprint("old-rsa-root"),
+		},
+		{
+			name: "other issuer",
+			certificate: cmgen.Certificate("foobar", cmgen.SetCertificateNamespace("default"), cmgen.AddCertificateAnnotations(rotated),
+				cmgen.SetCertificateIssuer(cmmeta.ObjectReference{Name: "foobar", Kind: "Issuer", Group: "cert-manager.io"}),
+			),
+			annotation: fingerprint("old-rsa-root"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(
+					tt.certificate,
+					issuertesting.OriginIssuer("default", "foobar", issuertesting.SetIssuerSpec(issuerclient.WithRequestType(v1.RequestTypeOriginRSA))),
+					issuertesting.ClusterOriginIssuer("dual-stack", issuertesting.SetIssuerSpec(issuerclient.WithRequestType(v1.RequestTypeOriginECC), issuerclient.WithDualStack())),
+				).
+				WithStatusSubresource(&cmapi.Certificate{}).
+				Build()
+
+			recorder := record.NewFakeRecorder(10)
+			w := &RootRotationWatcher{
+				Client: client,
+				Roots: rootRefresherFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+					if tt.refreshErr != nil {
+						return nil, tt.refreshErr
+					}
+
+					der := map[string]string{"origin-rsa": "rsa-root", "origin-ecc": "ecc-root"}[requestType]
+
+					return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(der)}), nil
+				}),
+				Recorder: recorder,
+				Interval: time.Hour,
+				Clock:    fakeClock.NewFakeClock(time.Now()),
+				Log:      logf.Log,
+			}
+
+			err := w.Check(context.Background())
+			if tt.refreshErr != nil {
+				assert.ErrorContains(t, err, "certificate default/foobar: connection refused")
+			} else {
+				assert.NilError(t, err)
+			}
+
+			got := &cmapi.Certificate{}
+			assert.NilError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "foobar"}, got))
+			assert.Equal(t, got.Annotations[v1.OriginCARootAnnotation], tt.annotation)
+			issuing := cmutil.GetCertificateCondition(got, cmapi.CertificateConditionIssuing)
+			assert.Equal(t, issuing != nil && issuing.Reason == rootRotatedReason, tt.renewed)
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			assert.DeepEqual(t, events, tt.events)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// withShutdownGracePeriod returns a context not cancelled with ctx until the
+// grace period after it, so that a reconcile interrupted by the controller
+// shutting down may still complete its call to the Cloudflare API and record
+// the certificate signed, rather than leaving its CertificateRequest pending
+// with an Origin CA certificate issued that nothing refers to. ctx is
+// returned as is when the grace period is zero.
+func withShutdownGracePeriod(ctx context.Context, clock clock.Clock, grace time.Duration) (context.Context, context.CancelFunc) {
+	if grace <= 0 {
+		return ctx, func() {}
+	}
+
+	drained, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		select {
+		case <-clock.After(grace):
+			cancel()
+		case <-drained.Done():
+		}
+	})
+
+	return drained, func() {
+		stop()
+		cancel()
+	}
+}
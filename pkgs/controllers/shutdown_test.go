@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestWithShutdownGracePeriod(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Now())
+
+	parent, shutdown := context.WithCancel(context.Background())
+	ctx, cancel := withShutdownGracePeriod(parent, clock, 20*time.Second)
+	defer cancel()
+
+	shutdown()
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if clock.HasWaiters() {
+			return poll.Success()
+		}
+		return poll.Continue("waiting for the grace period to start")
+	})
+	assert.NilError(t, ctx.Err(), "expected reconcile to outlive the shutdown during the grace period")
+
+	clock.Step(20 * time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reconcile to be cancelled at the end of the grace period")
+	}
+
+	// Without a grace period, reconciles are cancelled with the shutdown.
+	ctx, cancel = withShutdownGracePeriod(parent, clock, 0)
+	defer cancel()
+	assert.Equal(t, ctx.Err(), context.Canceled)
+}
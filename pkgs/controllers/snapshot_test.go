@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuerclient "github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// TestStatusSnapshots reconciles a new OriginIssuer and then a
+// CertificateRequest referencing it, and compares the statuses they are left
+// with against the golden files in testdata. Run with -test.update-golden to
+// rewrite them after intended changes to conditions.
+func TestStatusSnapshots(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+	unreconciled := func(_ *v1.OriginIssuerSpec, status *v1.OriginIssuerStatus) {
+		*status = v1.OriginIssuerStatus{}
+	}
+
+	tests := []struct {
+		name    string
+		issuer  *v1.OriginIssuer
+		request *cmapi.CertificateRequest
+		signErr error
+	}{
+		{
+			name:    "issued",
+			issuer:  issuertesting.OriginIssuer("default", "foobar", unreconciled),
+			request: issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+		},
+		{
+			name:    "missing-secret",
+			issuer:  issuertesting.OriginIssuer("default", "foobar", unreconciled, issuertesting.SetIssuerSpec(issuerclient.WithServiceKeyRef("missing-service-key", "key"))),
+			request: issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+		},
+		{
+			name:    "sign-failed",
+			issuer:  issuertesting.OriginIssuer("default", "foobar", unreconciled),
+			request: issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			signErr: errors.New("upstream unavailable"),
+		},
+		{
+			name:    "api-error-chain",
+			issuer:  issuertesting.OriginIssuer("default", "foobar", unreconciled),
+			request: issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar")),
+			signErr: &cfapi.APIError{
+				Code:       1010,
+				Message:    "Failed to validate requested hostname",
+				ErrorChain: []cfapi.ResponseMessage{{Code: 1413, Message: "hostname not found in zone"}},
+				RayID:      "0123456789abcdef-ABC",
+				StatusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name:    "unsupported",
+			issuer:  issuertesting.OriginIssuer("default", "foobar", unreconciled),
+			request: issuertesting.CertificateRequest("default", "foobar", issuertesting.SetCertificateRequestOriginIssuer("foobar"), cmgen.SetCertificateRequestIsCA(true)),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.issuer.Generation = 1
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithObjects(tt.issuer, tt.request, issuertesting.ServiceKeySecret("default")).
+				WithStatusSubresource(&cmapi.CertificateRequest{}, &v1.OriginIssuer{}).
+				Build()
+
+			api := &issuertesting.FakeAPI{SignErr: tt.signErr}
+			issuerController := &OriginIssuerController{
+				Client:   client,
+				Reader:   client,
+				Factory:  api.Factory(),
+				Recorder: record.NewFakeRecorder(10),
+				Clock:    clock,
+				Log:      logf.Log,
+			}
+			requestController := &CertificateRequestController{
+				Client:           client,
+				Reader:           client,
+				Log:              logf.Log,
+				Recorder:         record.NewFakeRecorder(10),
+				Clock:            clock,
+				Factory:          api.Factory(),
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			key := types.NamespacedName{Namespace: "default", Name: "foobar"}
+			_, _ = reconcile.AsReconciler(client, issuerController).Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+			_, _ = reconcile.AsReconciler(client, requestController).Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+
+			issuer := &v1.OriginIssuer{}
+			assert.NilError(t, client.Get(context.Background(), key, issuer))
+			request := &cmapi.CertificateRequest{}
+			assert.NilError(t, client.Get(context.Background(), key, request))
+
+			issuertesting.AssertStatusSnapshot(t, "status-"+tt.name+".golden", issuer, request)
+		})
+	}
+}
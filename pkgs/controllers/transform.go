@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+)
+
+// StripCompletedCertificateRequest is a cache transform keeping only what the
+// controllers read of CertificateRequests already issued: their metadata,
+// spec and conditions. The certificates and CAs in their status, the bulk of
+// their size, and the managed fields of every CertificateRequest are
+// dropped, so that the cache holds little more than the metadata of the
+// hundreds of thousands of CertificateRequests historical renewals can leave
+// behind. The status of a stripped CertificateRequest must be read from the
+// apiserver, and never written back from the cache.
+func StripCompletedCertificateRequest(obj interface{}) (interface{}, error) {
+	cr, ok := obj.(*certmanager.CertificateRequest)
+	if !ok {
+		return obj, nil
+	}
+
+	cr.ManagedFields = nil
+
+	if issued(cr) {
+		cr.Status.Certificate = nil
+		cr.Status.CA = nil
+	}
+
+	return cr, nil
+}
+
+// issued reports whether the CertificateRequest is Ready, whether or not its
+// certificate was stripped from the cache.
+func issued(cr *certmanager.CertificateRequest) bool {
+	return len(cr.Status.Certificate) > 0 || cmutil.CertificateRequestHasCondition(cr, certmanager.CertificateRequestCondition{
+		Type:   certmanager.CertificateRequestConditionReady,
+		Status: cmmeta.ConditionTrue,
+	})
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+)
+
+// unsupportedByOriginCAReason is the reason of the InvalidRequest condition
+// of CertificateRequests for certificates the Origin CA never signs.
+const unsupportedByOriginCAReason = "UnsupportedByOriginCA"
+
+// unissuedUsagesReason is the reason of the events of CertificateRequests
+// requesting usages their Origin CA certificate will not have.
+const unissuedUsagesReason = "UnissuedUsages"
+
+// originCAUsages are the key usages and extended key usages of the
+// certificates signed by the Origin CA.
+var originCAUsages = map[certmanager.KeyUsage]bool{
+	certmanager.UsageSigning:          true,
+	certmanager.UsageDigitalSignature: true,
+	certmanager.UsageKeyEncipherment:  true,
+	certmanager.UsageServerAuth:       true,
+	certmanager.UsageClientAuth:       true,
+}
+
+// extendedUsages are the usages that are extended key usages, restricting
+// the purposes the certificate may be used for.
+var extendedUsages = map[certmanager.KeyUsage]bool{
+	certmanager.UsageAny:             true,
+	certmanager.UsageServerAuth:      true,
+	certmanager.UsageClientAuth:      true,
+	certmanager.UsageCodeSigning:     true,
+	certmanager.UsageEmailProtection: true,
+	certmanager.UsageSMIME:           true,
+	certmanager.UsageIPsecEndSystem:  true,
+	certmanager.UsageIPsecTunnel:     true,
+	certmanager.UsageIPsecUser:       true,
+	certmanager.UsageTimestamping:    true,
+	certmanager.UsageOCSPSigning:     true,
+	certmanager.UsageMicrosoftSGC:    true,
+	certmanager.UsageNetscapeSGC:     true,
+}
+
+// unsupportedByOriginCA returns a message explaining why the Origin CA can't
+// sign the CertificateRequest, or an empty string if it may. The Origin CA
+// only signs server certificates, so CA certificates, and certificates
+// usable only for client authentication or other purposes, are refused
+// before calling the Cloudflare API. Requests without usages are signed.
+func unsupportedByOriginCA(cr *certmanager.CertificateRequest) string {
+	if cr.Spec.IsCA {
+		return "The Cloudflare Origin CA does not sign CA certificates. Remove isCA from the Certificate, or use another issuer such as a cert-manager CA issuer."
+	}
+
+	var (
+		clientAuth, serverAuth bool
+		purposes, caUsages     []string
+	)
+	for _, usage := range cr.Spec.Usages {
+		switch usage {
+		case certmanager.UsageClientAuth:
+			clientAuth = true
+		case certmanager.UsageServerAuth:
+			serverAuth = true
+		case certmanager.UsageCertSign, certmanager.UsageCRLSign:
+			caUsages = append(caUsages, fmt.Sprintf("%q", usage))
+		default:
+			if extendedUsages[usage] {
+				purposes = append(purposes, fmt.Sprintf("%q", usage))
+			}
+		}
+	}
+	switch {
+	case len(caUsages) > 0:
+		return fmt.Sprintf("The Cloudflare Origin CA does not sign CA certificates, so can't sign certificates with the %s usages. Remove them from the usages of the Certificate, or use another issuer such as a cert-manager CA issuer.", strings.Join(caUsages, ", "))
+	case clientAuth && !serverAuth:
+		return `The Cloudflare Origin CA only signs server certificates, and can't sign certificates for client authentication alone. Add the "server auth" usage to the Certificate, or use another issuer for client certificates.`
+	case len(purposes) > 0 && !serverAuth:
+		return fmt.Sprintf(`The Cloudflare Origin CA only signs server certificates, and can't sign certificates with the %s usages. Add the "server auth" usage to the Certificate, or use another issuer.`, strings.Join(purposes, ", "))
+	}
+
+	return ""
+}
+
+// unissuedUsages returns the usages requested by the CertificateRequest that
+// its Origin CA certificate will not have, such as "code signing" alongside
+// "server auth", which cert-manager would otherwise not point out.
+func unissuedUsages(cr *certmanager.CertificateRequest) []string {
+	var usages []string
+	for _, usage := range cr.Spec.Usages {
+		if !originCAUsages[usage] {
+			usages = append(usages, fmt.Sprintf("%q", usage))
+		}
+	}
+
+	return usages
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestUnsupportedUsages(t *testing.T) {
+	tests := []struct {
+		name        string
+		usages      []cmapi.KeyUsage
+		unsupported string
+		unissued    []string
+	}{
+		{
+			name: "no usages",
+		},
+		{
+			name:   "default usages",
+			usages: cmapi.DefaultKeyUsages(),
+		},
+		{
+			name:   "server and client auth",
+			usages: []cmapi.KeyUsage{cmapi.UsageDigitalSignature, cmapi.UsageKeyEncipherment, cmapi.UsageServerAuth, cmapi.UsageClientAuth},
+		},
+		{
+			name:     "server auth and code signing",
+			usages:   []cmapi.KeyUsage{cmapi.UsageServerAuth, cmapi.UsageCodeSigning, cmapi.UsageKeyAgreement},
+			unissued: []string{`"code signing"`, `"key agreement"`},
+		},
+		{
+			name:        "client auth only",
+			usages:      []cmapi.KeyUsage{cmapi.UsageDigitalSignature, cmapi.UsageClientAuth},
+			unsupported: `The Cloudflare Origin CA only signs server certificates, and can't sign certificates for client authentication alone. Add the "server auth" usage to the Certificate, or use another issuer for client certificates.`,
+		},
+		{
+			name:        "email protection only",
+			usages:      []cmapi.KeyUsage{cmapi.UsageDigitalSignature, cmapi.UsageEmailProtection, cmapi.UsageSMIME},
+			unsupported: `The Cloudflare Origin CA only signs server certificates, and can't sign certificates with the "email protection", "s/mime" usages. Add the "server auth" usage to the Certificate, or use another issuer.`,
+			unissued:    []string{`"email protection"`, `"s/mime"`},
+		},
+		{
+			name:        "cert sign",
+			usages:      []cmapi.KeyUsage{cmapi.UsageServerAuth, cmapi.UsageCertSign, cmapi.UsageCRLSign},
+			unsupported: `The Cloudflare Origin CA does not sign CA certificates, so can't sign certificates with the "cert sign", "crl sign" usages. Remove them from the usages of the Certificate, or use another issuer such as a cert-manager CA issuer.`,
+			unissued:    []string{`"cert sign"`, `"crl sign"`},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cr := issuertesting.CertificateRequest("default", "foobar", cmgen.SetCertificateRequestKeyUsages(tt.usages...))
+
+			assert.Equal(t, unsupportedByOriginCA(cr), tt.unsupported)
+			assert.DeepEqual(t, unissuedUsages(cr), tt.unissued)
+		})
+	}
+}
+
+func TestCertificateRequestUnissuedUsages(t *testing.T) {
+	if err := cmapi.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(
+			issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+				cmgen.SetCertificateRequestKeyUsages(cmapi.UsageDigitalSignature, cmapi.UsageServerAuth, cmapi.UsageCodeSigning),
+			),
+			issuertesting.OriginIssuer("default", "foobar"),
+			issuertesting.ServiceKeySecret("default"),
+		).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).
+		Build()
+
+	recorder := record.NewFakeRecorder(10)
+	api := &issuertesting.FakeAPI{}
+	controller := &CertificateRequestController{
+		Client:           client,
+		Reader:           client,
+		Log:              logf.Log,
+		Recorder:         recorder,
+		Clock:            clock.RealClock{},
+		Factory:          api.Factory(),
+		NewCorrelationID: func() string { return "c0ffee00" },
+	}
+
+	_, err := reconcile.AsReconciler(client, controller).Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "foobar"},
+	})
+	assert.NilError(t, err)
+
+	// The request is still signed, with a warning.
+	assert.Equal(t, len(api.SignedHostnames()), 1)
+
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	assert.DeepEqual(t, events, []string{
+		`Warning UnissuedUsages The Cloudflare Origin CA certificate will not have the "code signing" usages requested, as Origin CA certificates are only issued for digital signature, key encipherment, server auth and client auth map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]`,
+		"Normal Issued Certificate issued map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+		"Normal DefaultDuration No duration requested, issued with the default validity of 7 days map[cert-manager.k8s.cloudflare.com/correlation-id:c0ffee00]",
+	})
+}
@@ -1,18 +1,37 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/metrics"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/provisioners"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/vault"
 	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // IssuerStatusHasCondition will return true if the given OriginIssuerStatus has
-// a condition matching the provided OriginIssuerCondtion. Only the Type and
-// Status fields are used in the comparison, meaning this function will return
-// `true` even if the Reason, Message, and LastTransitionTime fields do not
+// a condition matching the provided Condition. Only the Type and Status fields
+// are used in the comparison, meaning this function will return `true` even if
+// the Reason, Message, ObservedGeneration and LastTransitionTime fields do not
 // match.
-func IssuerStatusHasCondition(status v1.OriginIssuerStatus, c v1.OriginIssuerCondition) bool {
+func IssuerStatusHasCondition(status v1.OriginIssuerStatus, c metav1.Condition) bool {
 	for _, cond := range status.Conditions {
 		if c.Type == cond.Type && c.Status == cond.Status {
 			return true
@@ -33,14 +52,17 @@ func IssuerStatusHasCondition(status v1.OriginIssuerStatus, c v1.OriginIssuerCon
 // If a condition of the same type and different state already exists, the
 // condition will be updated and the LastTransitionTime set to the current
 // time.
-func SetIssuerStatusCondition(ois *v1.OriginIssuerStatus, conditionType v1.ConditionType, status v1.ConditionStatus, log logr.Logger, cl clock.Clock, reason, message string) {
-	now := metav1.NewTime(cl.Now())
-	c := v1.OriginIssuerCondition{
+//
+// The condition's ObservedGeneration is set to the generation of the issuer it
+// was computed from.
+func SetIssuerStatusCondition(ois *v1.OriginIssuerStatus, generation int64, conditionType string, status metav1.ConditionStatus, log logr.Logger, cl clock.Clock, reason, message string) {
+	c := metav1.Condition{
 		Type:               conditionType,
 		Status:             status,
+		ObservedGeneration: generation,
 		Reason:             reason,
 		Message:            message,
-		LastTransitionTime: &now,
+		LastTransitionTime: metav1.NewTime(cl.Now()),
 	}
 
 	for i, condition := range ois.Conditions {
@@ -65,3 +87,407 @@ func SetIssuerStatusCondition(ois *v1.OriginIssuerStatus, conditionType v1.Condi
 
 	ois.Conditions = append(ois.Conditions, c)
 }
+
+// setIssuerObservedState records the generation of the issuer reconciled, and
+// either when the issuer was verified, for a Ready condition, or another
+// failed attempt otherwise.
+func setIssuerObservedState(ois *v1.OriginIssuerStatus, generation int64, status metav1.ConditionStatus, cl clock.Clock) {
+	ois.ObservedGeneration = generation
+
+	if status == v1.ConditionTrue {
+		now := metav1.NewTime(cl.Now())
+		ois.LastVerifiedTime = &now
+		ois.FailedAttempts = 0
+
+		return
+	}
+
+	ois.FailedAttempts++
+}
+
+// SetCertificateRequestCondition will set a condition on the given
+// CertificateRequest, following the same rules as SetIssuerStatusCondition.
+// Unlike the cert-manager helper, the current time is read from the given
+// clock rather than a package variable.
+func SetCertificateRequestCondition(cr *certmanager.CertificateRequest, conditionType certmanager.CertificateRequestConditionType, status cmmeta.ConditionStatus, log logr.Logger, cl clock.Clock, reason, message string) {
+	now := metav1.NewTime(cl.Now())
+	c := certmanager.CertificateRequestCondition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: &now,
+	}
+
+	for i, condition := range cr.Status.Conditions {
+		if condition.Type != conditionType {
+			continue
+		}
+
+		if condition.Status == status {
+			c.LastTransitionTime = condition.LastTransitionTime
+		} else {
+			log.Info("found status change for CertificateRequest; setting lastTransitionTime",
+				"condition", condition.Type,
+				"old_status", condition.Status,
+				"new_status", c.Status,
+			)
+		}
+
+		cr.Status.Conditions[i] = c
+
+		return
+	}
+
+	cr.Status.Conditions = append(cr.Status.Conditions, c)
+}
+
+// recordIssuerEvent records an event for a change of an issuer's Ready
+// condition. The event is a Warning unless the issuer is Ready.
+func recordIssuerEvent(recorder record.EventRecorder, iss runtime.Object, status metav1.ConditionStatus, reason, message string) {
+	eventType := core.EventTypeWarning
+	if status == v1.ConditionTrue {
+		eventType = core.EventTypeNormal
+	}
+
+	recorder.Event(iss, eventType, reason, message)
+}
+
+// issuerAuthSecretRef returns the reference to the Secret holding the
+// credential an issuer authenticates with.
+func issuerAuthSecretRef(auth v1.OriginIssuerAuthentication) v1.SecretKeySelector {
+	if auth.APITokenRef != nil {
+		return *auth.APITokenRef
+	}
+
+	return auth.ServiceKeyRef
+}
+
+// verifyAuthSecretRef returns the reference to the Secret holding the
+// credential an issuer is verified with: its VerifyTokenRef, if any, or else
+// the credential it signs with.
+func verifyAuthSecretRef(auth v1.OriginIssuerAuthentication) v1.SecretKeySelector {
+	if auth.VerifyTokenRef != nil {
+		return *auth.VerifyTokenRef
+	}
+
+	return issuerAuthSecretRef(auth)
+}
+
+// secretKeyError is returned when an issuer's auth Secret exists, but lacks
+// the key holding its credential.
+type secretKeyError struct {
+	Secret string
+	Key    string
+}
+
+func (e *secretKeyError) Error() string {
+	return fmt.Sprintf("secret %s does not contain key %q", e.Secret, e.Key)
+}
+
+// issuerCredentials wraps the value read from an issuer's auth Secret as the
+// credential type the issuer is configured with, used with the issuer's
+// Cloudflare API endpoint.
+func issuerCredentials(spec v1.OriginIssuerSpec, value []byte) cfapi.Credentials {
+	if spec.Auth.APITokenRef != nil {
+		return cfapi.Credentials{APIToken: value, Endpoint: spec.CloudflareAPIURL}
+	}
+
+	return cfapi.Credentials{ServiceKey: value, Endpoint: spec.CloudflareAPIURL}
+}
+
+// verifyCredentials wraps the value read from the Secret of
+// verifyAuthSecretRef as the credential type an issuer is verified with.
+func verifyCredentials(spec v1.OriginIssuerSpec, value []byte) cfapi.Credentials {
+	if spec.Auth.VerifyTokenRef != nil {
+		return cfapi.Credentials{APIToken: value, Endpoint: spec.CloudflareAPIURL}
+	}
+
+	return issuerCredentials(spec, value)
+}
+
+// zoneLookupAPI returns the API client the zones of hostnames are resolved
+// with when signing for the issuer: one authenticated with its
+// VerifyTokenRef, read from its Secret in the namespace, if any, or else the
+// signing client c.
+func zoneLookupAPI(ctx context.Context, reader client.Reader, factory cfapi.Factory, spec v1.OriginIssuerSpec, namespace string, c cfapi.Interface) (cfapi.Interface, error) {
+	ref := spec.Auth.VerifyTokenRef
+	if !spec.ResolveZones || ref == nil {
+		return c, nil
+	}
+
+	var secret core.Secret
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, err
+	}
+
+	token, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, &secretKeyError{Secret: secret.Name, Key: ref.Key}
+	}
+
+	return factory.APIWith(verifyCredentials(spec, token))
+}
+
+// issuerProvisionerOptions returns the options of a provisioner signing
+// following the issuer spec with the API client, resolving zones with the
+// lookup client, while checking access to them with the signing client. The default duration applies when the issuer sets none,
+// unless zero. cfapi.ErrZonesUnsupported is returned for issuers resolving
+// zones with a client that can't.
+func issuerProvisionerOptions(spec v1.OriginIssuerSpec, c, lookup cfapi.Interface, defaultDuration time.Duration, clock clock.PassiveClock) ([]provisioners.Option, error) {
+	duration := spec.DefaultDuration
+	if duration == nil && defaultDuration > 0 {
+		duration = &metav1.Duration{Duration: defaultDuration}
+	}
+
+	opts := []provisioners.Option{
+		provisioners.WithDualStack(spec.DualStack),
+		provisioners.WithDurations(spec.MinDuration, spec.MaxDuration, duration),
+		provisioners.WithDurationPolicy(spec.DurationPolicy),
+	}
+	if spec.RequireMatchingKeyType {
+		opts = append(opts, provisioners.WithKeyTypeCheck())
+	}
+	if spec.RevokeSuperseded {
+		opts = append(opts, provisioners.WithRevokeSuperseded(c, spec.ZoneID))
+	}
+	if spec.DuplicatePolicy == v1.DuplicatePolicyReuse || spec.DuplicatePolicy == v1.DuplicatePolicyFail {
+		opts = append(opts, provisioners.WithDuplicatePolicy(spec.DuplicatePolicy, c, spec.ZoneID, clock))
+	}
+	if spec.WildcardThreshold > 0 {
+		opts = append(opts, provisioners.WithWildcardPolicy(spec.WildcardThreshold, spec.CollapseToWildcard))
+	}
+	if len(spec.AllowedDNSNames) > 0 || len(spec.AllowedDNSZones) > 0 {
+		opts = append(opts, provisioners.WithAllowedHostnames(spec.AllowedDNSNames, spec.AllowedDNSZones))
+	}
+	if spec.ResolveZones {
+		finder, ok := lookup.(cfapi.ZoneFinder)
+		if !ok {
+			return nil, cfapi.ErrZonesUnsupported
+		}
+
+		opts = append(opts, provisioners.WithZoneResolution(finder, c))
+		if spec.RequireActiveZones {
+			opts = append(opts, provisioners.WithActiveZones())
+		}
+	}
+
+	return opts, nil
+}
+
+// zoneCredentialSpec returns the issuer spec authenticating with the zone
+// credential of the hostnames of the CertificateRequest, if any, instead of
+// the issuer's own credential. The certificates of its zone, rather than of
+// the issuer's, are then listed for superseded and duplicate certificates.
+func zoneCredentialSpec(spec v1.OriginIssuerSpec, cr *certmanager.CertificateRequest) (v1.OriginIssuerSpec, error) {
+	if len(spec.Auth.Zones) == 0 {
+		return spec, nil
+	}
+
+	i, err := provisioners.SelectZoneCredential(cr, spec.Auth.Zones)
+	if err != nil || i < 0 {
+		return spec, err
+	}
+
+	credential := spec.Auth.Zones[i]
+	spec.Auth = zoneCredentialAuth(credential)
+	spec.ZoneID = credential.ZoneID
+
+	return spec, nil
+}
+
+// zoneCredentialAuth returns the authentication of the zone credential.
+func zoneCredentialAuth(credential v1.ZoneCredential) v1.OriginIssuerAuthentication {
+	auth := v1.OriginIssuerAuthentication{APITokenRef: credential.APITokenRef}
+	if credential.ServiceKeyRef != nil {
+		auth.ServiceKeyRef = *credential.ServiceKeyRef
+	}
+
+	return auth
+}
+
+// hasExternalCredentials reports whether an issuer authenticates with
+// credentials retrieved from outside a Secret.
+func hasExternalCredentials(auth v1.OriginIssuerAuthentication) bool {
+	return auth.TokenExchange != nil || auth.Vault != nil
+}
+
+// credentialsError is returned when the credentials of an issuer can't be
+// retrieved from outside a Secret, with the reason to report it with.
+type credentialsError struct {
+	Reason string
+	Action string
+	Err    error
+}
+
+func (e *credentialsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.Err
+}
+
+// Message describes the failure in a condition message.
+func (e *credentialsError) Message() string {
+	return fmt.Sprintf("Failed to %s: %v", e.Action, e.Err)
+}
+
+// externalCredentials retrieves the credentials of an issuer authenticating
+// with a token exchange or Vault, with a ServiceAccount of namespace.
+// Failures are returned as a credentialsError.
+func externalCredentials(ctx context.Context, e *tokenexchange.Exchanger, vc *vault.Client, spec v1.OriginIssuerSpec, namespace string) (cfapi.Credentials, error) {
+	if spec.Auth.Vault != nil {
+		creds, err := vaultCredentials(ctx, vc, spec, namespace)
+		if err != nil {
+			return cfapi.Credentials{}, &credentialsError{Reason: "VaultFailed", Action: "read credentials from Vault", Err: err}
+		}
+
+		return creds, nil
+	}
+
+	creds, err := exchangeCredentials(ctx, e, spec, namespace)
+	if err != nil {
+		return cfapi.Credentials{}, &credentialsError{Reason: "TokenExchangeFailed", Action: "exchange ServiceAccount token for credentials", Err: err}
+	}
+
+	return creds, nil
+}
+
+// exchangeCredentials retrieves the short-lived credentials of an issuer
+// authenticating with a token exchange, in exchange for a token of its
+// ServiceAccount in namespace.
+func exchangeCredentials(ctx context.Context, e *tokenexchange.Exchanger, spec v1.OriginIssuerSpec, namespace string) (cfapi.Credentials, error) {
+	if e == nil {
+		return cfapi.Credentials{}, errors.New("token exchange is not enabled on the controller")
+	}
+
+	creds, err := e.Credentials(ctx, tokenexchange.Request{
+		URL:            spec.Auth.TokenExchange.URL,
+		Namespace:      namespace,
+		ServiceAccount: spec.Auth.TokenExchange.ServiceAccountRef.Name,
+	})
+	if err != nil {
+		return cfapi.Credentials{}, err
+	}
+
+	if creds.APIToken != "" {
+		return cfapi.Credentials{APIToken: []byte(creds.APIToken), Endpoint: spec.CloudflareAPIURL}, nil
+	}
+
+	return cfapi.Credentials{ServiceKey: []byte(creds.ServiceKey), Endpoint: spec.CloudflareAPIURL}, nil
+}
+
+// vaultCredentials reads the credentials of an issuer authenticating with
+// Vault, logging in with a token of its ServiceAccount in namespace.
+func vaultCredentials(ctx context.Context, vc *vault.Client, spec v1.OriginIssuerSpec, namespace string) (cfapi.Credentials, error) {
+	if vc == nil {
+		return cfapi.Credentials{}, errors.New("vault is not enabled on the controller")
+	}
+
+	value, err := vc.Credential(ctx, vault.Request{
+		Address:        spec.Auth.Vault.Address,
+		AuthPath:       spec.Auth.Vault.AuthPath,
+		Role:           spec.Auth.Vault.Role,
+		Namespace:      namespace,
+		ServiceAccount: spec.Auth.Vault.ServiceAccountRef.Name,
+		Path:           spec.Auth.Vault.Path,
+		Key:            spec.Auth.Vault.Key,
+	})
+	if err != nil {
+		return cfapi.Credentials{}, err
+	}
+
+	if spec.Auth.Vault.CredentialType == v1.CredentialTypeServiceKey {
+		return cfapi.Credentials{ServiceKey: value, Endpoint: spec.CloudflareAPIURL}, nil
+	}
+
+	return cfapi.Credentials{APIToken: value, Endpoint: spec.CloudflareAPIURL}, nil
+}
+
+// updateCertificateCount sets the number of Origin CA certificates of an
+// issuer's zone in its status, and records it as a metric. The count is
+// cleared from issuers without a zone. Failures are logged and leave the last
+// count in place, as they don't affect the issuer's readiness.
+func updateCertificateCount(ctx context.Context, c cfapi.Interface, spec v1.OriginIssuerSpec, status *v1.OriginIssuerStatus, iss metrics.Issuer, log logr.Logger, cl clock.Clock) {
+	if spec.ZoneID == "" {
+		status.CertificateCount = nil
+		status.CertificateCountTime = nil
+
+		return
+	}
+
+	resp, err := c.List(ctx, &cfapi.ListRequest{ZoneID: spec.ZoneID, PerPage: 1})
+	if err != nil {
+		log.Error(err, "failed to count the Origin CA certificates of the zone", "zone_id", spec.ZoneID)
+
+		return
+	}
+
+	now := metav1.NewTime(cl.Now())
+	status.CertificateCount = &resp.TotalCount
+	status.CertificateCountTime = &now
+
+	metrics.SetZoneCertificates(iss, spec.ZoneID, resp.TotalCount)
+}
+
+// updateCertificateQuota sets the number of Origin CA certificates an
+// issuer's zone may still have, and its QuotaExhausted condition, from the
+// certificate count of its status. Both are cleared from issuers without a
+// quota. It reports whether the zone just neared its limit.
+func updateCertificateQuota(spec v1.OriginIssuerSpec, status *v1.OriginIssuerStatus, generation int64, log logr.Logger, cl clock.Clock) bool {
+	quota := spec.CertificateQuota
+	if spec.ZoneID == "" || quota == nil {
+		status.QuotaRemaining = nil
+		apimeta.RemoveStatusCondition(&status.Conditions, v1.ConditionQuotaExhausted)
+
+		return false
+	}
+
+	if status.CertificateCount == nil {
+		return false
+	}
+
+	count := *status.CertificateCount
+	remaining := max(quota.Limit-count, 0)
+	status.QuotaRemaining = &remaining
+
+	reserve := quota.Limit / 10
+	if quota.Reserve != nil {
+		reserve = *quota.Reserve
+	}
+
+	exhausted := IssuerStatusHasCondition(*status, metav1.Condition{Type: v1.ConditionQuotaExhausted, Status: v1.ConditionTrue})
+	switch {
+	case remaining == 0:
+		SetIssuerStatusCondition(status, generation, v1.ConditionQuotaExhausted, v1.ConditionTrue, log, cl, "LimitReached", fmt.Sprintf("Zone %s has %d Origin CA certificates, reaching its limit of %d", spec.ZoneID, count, quota.Limit))
+	case remaining <= reserve:
+		SetIssuerStatusCondition(status, generation, v1.ConditionQuotaExhausted, v1.ConditionTrue, log, cl, "NearLimit", fmt.Sprintf("Zone %s has %d Origin CA certificates, %d below its limit of %d", spec.ZoneID, count, remaining, quota.Limit))
+	default:
+		SetIssuerStatusCondition(status, generation, v1.ConditionQuotaExhausted, v1.ConditionFalse, log, cl, "WithinLimit", fmt.Sprintf("Zone %s has %d Origin CA certificates, %d below its limit of %d", spec.ZoneID, count, remaining, quota.Limit))
+	}
+
+	return !exhausted && remaining <= reserve
+}
+
+// recordSigned applies record to obj, such as to annotate it with the IDs of
+// the certificates just signed for it, and updates it. On conflicts, obj is
+// read again from the apiserver and record applied again, as failing to
+// record the certificates would sign them again on the next reconcile,
+// leaving the first ones unrevokable.
+func recordSigned(ctx context.Context, c client.Client, reader client.Reader, obj client.Object, record func()) error {
+	first := true
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := reader.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		record()
+
+		return c.Update(ctx, obj)
+	})
+}
@@ -0,0 +1,56 @@
+package istiocsr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authentication "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultAudience is the audience of the ServiceAccount tokens Istio
+// authenticates to its CA with.
+const DefaultAudience = "istio-ca"
+
+// Authenticator authenticates the bearer token of a request, returning the
+// name of the user it identifies.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+// TokenReviewAuthenticator authenticates Kubernetes ServiceAccount tokens with
+// TokenReviews.
+type TokenReviewAuthenticator struct {
+	Client client.Client
+
+	// Audiences the tokens must be issued for, DefaultAudience when empty.
+	Audiences []string
+}
+
+func (a *TokenReviewAuthenticator) Authenticate(ctx context.Context, token string) (string, error) {
+	audiences := a.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{DefaultAudience}
+	}
+
+	review := &authentication.TokenReview{
+		Spec: authentication.TokenReviewSpec{
+			Token:     token,
+			Audiences: audiences,
+		},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return "", fmt.Errorf("reviewing token: %w", err)
+	}
+
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return "", errors.New(review.Status.Error)
+		}
+
+		return "", errors.New("token not authenticated")
+	}
+
+	return review.Status.User.Username, nil
+}
@@ -0,0 +1,82 @@
+package istiocsr
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the messages of istio.v1.auth.IstioCertificateService, as
+// defined by security/v1alpha1/ca.proto of istio.io/api. The messages are
+// small enough to be encoded by hand, rather than vendoring the generated
+// code of Istio's API.
+const (
+	csrField              protowire.Number = 1
+	validityDurationField protowire.Number = 3
+	certChainField        protowire.Number = 200
+)
+
+// certificateRequest is an IstioCertificateRequest. Its metadata, only used
+// by Istio's own CA to impersonate identities, is ignored.
+type certificateRequest struct {
+	CSR string
+
+	// ValidityDuration is the requested validity in seconds, the CA's
+	// default when zero.
+	ValidityDuration int64
+}
+
+func unmarshalCertificateRequest(b []byte) (*certificateRequest, error) {
+	req := &certificateRequest{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == csrField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			req.CSR = v
+			b = b[n:]
+		case num == validityDurationField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			req.ValidityDuration = int64(v)
+			b = b[n:]
+		case num == csrField || num == validityDurationField:
+			return nil, fmt.Errorf("field %d has wire type %d", num, typ)
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	if req.CSR == "" {
+		return nil, errors.New("csr is required")
+	}
+
+	return req, nil
+}
+
+// marshalCertificateResponse returns the IstioCertificateResponse with the
+// certificate chain, each certificate PEM encoded and the root last.
+func marshalCertificateResponse(chain []string) []byte {
+	var b []byte
+	for _, cert := range chain {
+		b = protowire.AppendTag(b, certChainField, protowire.BytesType)
+		b = protowire.AppendString(b, cert)
+	}
+
+	return b
+}
@@ -0,0 +1,485 @@
+// Package istiocsr serves the CA API of Istio, as served by cert-manager's
+// istio-csr, signing the certificates requested by Istio proxies with a
+// ClusterOriginIssuer, so that proxies behind Cloudflare can present Origin CA
+// certificates without going through CertificateRequests.
+//
+// Only the CreateCertificate method of istio.v1.auth.IstioCertificateService
+// is served, over gRPC on HTTP/2 with TLS. Uncompressed messages are encoded
+// and decoded with protowire, so that neither gRPC nor Istio's API need be
+// vendored.
+//
+// Certificates are reused for CSRs of the same hostname and key until half
+// their lifetime, so that proxies retrying their CSRs don't have an Origin CA
+// certificate signed every time.
+package istiocsr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/controllers"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+)
+
+// CreateCertificatePath is the gRPC path of the CreateCertificate method of
+// Istio's CA API.
+const CreateCertificatePath = "/istio.v1.auth.IstioCertificateService/CreateCertificate"
+
+// DefaultTrustDomain is the SPIFFE trust domain of the mesh when none is set.
+const DefaultTrustDomain = "cluster.local"
+
+// serviceAccountPrefix prefixes the usernames of ServiceAccounts.
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// maxMessageSize bounds the size of the requests read, far above that of a
+// CSR.
+const maxMessageSize = 64 << 10
+
+// gRPC status codes returned by the server.
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnavailable       = 14
+	codeUnauthenticated   = 16
+)
+
+// Signer signs CertificateRequests for the hostnames with the named
+// ClusterOriginIssuer, returning a single certificate, such as
+// controllers.ClusterIssuerSigner.
+type Signer interface {
+	SignHostnames(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error)
+}
+
+// Server serves Istio's CA API, authenticating proxies with their
+// ServiceAccount tokens, and signing their CSRs with the ClusterOriginIssuer.
+type Server struct {
+	Signer        Signer
+	Authenticator Authenticator
+	Log           logr.Logger
+
+	// Issuer is the name of the ClusterOriginIssuer signing the requests.
+	Issuer string
+
+	// Domain is the domain under which the hostnames of ServiceAccounts
+	// are, as <serviceaccount>.<namespace>.<domain>.
+	Domain string
+
+	// TrustDomain is the SPIFFE trust domain of the mesh,
+	// DefaultTrustDomain when empty.
+	TrustDomain string
+
+	// Roots, when set, provides the Origin CA root appended to certificate
+	// chains, which Istio expects last.
+	Roots controllers.RootSource
+
+	// Addr and CertDir are the address the server listens on with Start,
+	// and the directory of its serving certificate, as tls.crt and tls.key.
+	Addr    string
+	CertDir string
+
+	// ShutdownGracePeriod is how long requests in flight when the server
+	// stops may still sign their certificates, rather than being cancelled
+	// with the context passed to Start, which is otherwise waited on for 10
+	// seconds.
+	ShutdownGracePeriod time.Duration
+
+	// NewCorrelationID generates the ID correlating the logs of a request
+	// with the calls to the Cloudflare API signing it.
+	NewCorrelationID func() string
+
+	// Clock tells when certificates stop being reused, the system clock
+	// when nil.
+	Clock clock.PassiveClock
+
+	// signed holds the certificates signed for each hostname and key,
+	// reused for CSRs of the same key, such as those retried by proxies.
+	mu     sync.Mutex
+	signed map[signedKey]*cfapi.SignResponse
+}
+
+// signedKey identifies the CSRs a certificate is reused for.
+type signedKey struct {
+	hostname         string
+	publicKey        [sha256.Size]byte
+	validityDuration int64
+}
+
+// Start serves the API until the context is done.
+func (s *Server) Start(ctx context.Context) error {
+	base, timeout := ctx, 10*time.Second
+	if s.ShutdownGracePeriod > 0 {
+		// Requests still in flight once the grace period ends are
+		// cancelled on return.
+		var cancel context.CancelFunc
+		base, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		timeout = s.ShutdownGracePeriod
+	}
+
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		s.Log.Info("serving Istio CA API", "addr", s.Addr, "issuer", s.Issuer)
+		errs <- srv.ListenAndServeTLS(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection is false, so that every replica of the controller serves
+// the API.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "only gRPC requests are served", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Add("Trailer", "Grpc-Status")
+	w.Header().Add("Trailer", "Grpc-Message")
+	// The status is always sent as trailers, after the headers.
+	w.WriteHeader(http.StatusOK)
+
+	if r.URL.Path != CreateCertificatePath {
+		writeStatus(w, codeUnimplemented, fmt.Sprintf("unknown method %s", r.URL.Path))
+		return
+	}
+
+	newID := s.NewCorrelationID
+	if newID == nil {
+		newID = randomID
+	}
+	id := newID()
+	log := s.Log.WithValues("correlation_id", id, "issuer_name", s.Issuer)
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeStatus(w, codeUnauthenticated, "bearer token required")
+		return
+	}
+
+	user, err := s.Authenticator.Authenticate(r.Context(), token)
+	if err != nil {
+		log.Error(err, "failed to authenticate request")
+		writeStatus(w, codeUnauthenticated, "authentication failed")
+		return
+	}
+	log = log.WithValues("user", user)
+
+	namespace, serviceAccount, ok := splitServiceAccount(user)
+	if !ok {
+		writeStatus(w, codePermissionDenied, "only ServiceAccounts may request certificates")
+		return
+	}
+
+	msg, code, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, code, err.Error())
+		return
+	}
+
+	req, err := unmarshalCertificateRequest(msg)
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, fmt.Sprintf("invalid IstioCertificateRequest: %v", err))
+		return
+	}
+
+	csr, err := pki.DecodeX509CertificateRequestBytes([]byte(req.CSR))
+	if err != nil {
+		log.Error(err, "invalid certificate request")
+		writeStatus(w, codePermissionDenied, fmt.Sprintf("invalid CSR: %v", err))
+		return
+	}
+
+	hostname, err := s.hostname(csr, namespace, serviceAccount)
+	if err != nil {
+		log.Error(err, "certificate request does not match the ServiceAccount")
+		writeStatus(w, codePermissionDenied, err.Error())
+		return
+	}
+	log = log.WithValues("hostname", hostname)
+
+	key := signedKey{
+		hostname:         hostname,
+		publicKey:        sha256.Sum256(csr.RawSubjectPublicKeyInfo),
+		validityDuration: req.ValidityDuration,
+	}
+	if resp := s.reusable(key); resp != nil {
+		log.Info("reused certificate", "id", resp.Id, "expiration", resp.Expiration)
+		s.respond(w, r, log, resp)
+		return
+	}
+
+	cr := &certmanager.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: user},
+		Spec: certmanager.CertificateRequestSpec{
+			Request: []byte(req.CSR),
+			IssuerRef: cmmeta.ObjectReference{
+				Group: v1.GroupVersion.Group,
+				Kind:  "ClusterOriginIssuer",
+				Name:  s.Issuer,
+			},
+		},
+	}
+	if req.ValidityDuration > 0 {
+		cr.Spec.Duration = &metav1.Duration{Duration: time.Duration(req.ValidityDuration) * time.Second}
+	}
+
+	resps, err := s.Signer.SignHostnames(r.Context(), log, s.Issuer, cr, []string{hostname}, cfapi.Metadata{
+		CorrelationID: id,
+		ObjectKind:    "IstioCertificateRequest",
+		ObjectName:    user,
+	})
+
+	var signErr *controllers.SignError
+	switch {
+	case errors.As(err, &signErr):
+		log.Error(err, "failed to sign certificate request")
+		writeStatus(w, codeInvalidArgument, signErr.Message)
+		return
+	case err != nil:
+		log.Error(err, "failed to sign certificate request")
+		writeStatus(w, codeUnavailable, err.Error())
+		return
+	}
+
+	log.Info("signed certificate", "id", resps[0].Id, "expiration", resps[0].Expiration)
+	s.remember(key, resps[0])
+	s.respond(w, r, log, resps[0])
+}
+
+// respond writes the certificate chain of the signed certificate, with the
+// Origin CA root last.
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, log logr.Logger, resp *cfapi.SignResponse) {
+	chain := []string{resp.Certificate}
+	if s.Roots != nil {
+		root, err := s.Roots.Root(r.Context(), resp.Type)
+		if err != nil {
+			log.Error(err, "failed to retrieve Origin CA root", "request_type", resp.Type)
+			writeStatus(w, codeUnavailable, fmt.Sprintf("failed to retrieve Origin CA root: %v", err))
+			return
+		}
+		chain = append(chain, string(root))
+	}
+
+	if err := writeMessage(w, marshalCertificateResponse(chain)); err != nil {
+		log.Error(err, "failed to write response")
+		return
+	}
+	writeStatus(w, codeOK, "")
+}
+
+// reusable returns the certificate signed for the key, unless it is past half
+// its lifetime, when istio-agent rotates certificates by default.
+func (s *Server) reusable(key signedKey) *cfapi.SignResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp, ok := s.signed[key]
+	if !ok {
+		return nil
+	}
+
+	if !s.now().Before(reuseUntil(resp)) {
+		delete(s.signed, key)
+		return nil
+	}
+
+	return resp
+}
+
+// remember records the certificate signed for the key, forgetting those no
+// longer reused.
+func (s *Server) remember(key signedKey, resp *cfapi.SignResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if !now.Before(reuseUntil(resp)) {
+		return
+	}
+
+	for k, v := range s.signed {
+		if !now.Before(reuseUntil(v)) {
+			delete(s.signed, k)
+		}
+	}
+
+	if s.signed == nil {
+		s.signed = make(map[signedKey]*cfapi.SignResponse)
+	}
+	s.signed[key] = resp
+}
+
+func (s *Server) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+
+	return s.Clock.Now()
+}
+
+// reuseUntil returns when the certificate stops being reused, half way
+// through its lifetime. Certificates that can't be parsed aren't reused.
+func reuseUntil(resp *cfapi.SignResponse) time.Time {
+	leaf, err := pki.DecodeX509CertificateBytes([]byte(resp.Certificate))
+	if err != nil {
+		return time.Time{}
+	}
+
+	return leaf.NotAfter.Add(-leaf.NotAfter.Sub(leaf.NotBefore) / 2)
+}
+
+// splitServiceAccount returns the namespace and name of the ServiceAccount
+// the username identifies, or false for other users.
+func splitServiceAccount(user string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(user, serviceAccountPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	namespace, name, ok := strings.Cut(rest, ":")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, ":") {
+		return "", "", false
+	}
+
+	return namespace, name, true
+}
+
+// hostname returns the hostname the certificate of the ServiceAccount is
+// issued for, once checked that the CSR requests its SPIFFE ID, and no other
+// subject alternative name but the hostname.
+func (s *Server) hostname(csr *x509.CertificateRequest, namespace, serviceAccount string) (string, error) {
+	trustDomain := s.TrustDomain
+	if trustDomain == "" {
+		trustDomain = DefaultTrustDomain
+	}
+	spiffeID := (&url.URL{Scheme: "spiffe", Host: trustDomain, Path: "/ns/" + namespace + "/sa/" + serviceAccount}).String()
+	hostname := serviceAccount + "." + namespace + "." + s.Domain
+
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != spiffeID {
+		return "", fmt.Errorf("CSR must request the SPIFFE ID %s of the ServiceAccount", spiffeID)
+	}
+
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 {
+		return "", errors.New("CSR may not request IP or email addresses")
+	}
+
+	for _, name := range csr.DNSNames {
+		if !strings.EqualFold(strings.TrimSuffix(name, "."), hostname) {
+			return "", fmt.Errorf("CSR may not request DNS names other than %s", hostname)
+		}
+	}
+
+	return hostname, nil
+}
+
+// readMessage reads the single length-prefixed message of a unary gRPC
+// request, returning the status code to fail the call with on errors.
+func readMessage(r io.Reader) ([]byte, int, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, codeInvalidArgument, fmt.Errorf("reading message: %w", err)
+	}
+
+	if prefix[0] != 0 {
+		return nil, codeUnimplemented, errors.New("compressed messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessageSize {
+		return nil, codeResourceExhausted, fmt.Errorf("message of %d bytes is larger than %d bytes", size, maxMessageSize)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, codeInvalidArgument, fmt.Errorf("reading message: %w", err)
+	}
+
+	return msg, codeOK, nil
+}
+
+// writeMessage writes the length-prefixed message of a unary gRPC response.
+func writeMessage(w io.Writer, msg []byte) error {
+	prefix := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+
+	_, err := w.Write(append(prefix, msg...))
+	return err
+}
+
+// writeStatus ends the call with the gRPC status code and message, sent as
+// trailers.
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+}
+
+// encodeGRPCMessage percent-encodes the message as required of the
+// Grpc-Message header.
+func encodeGRPCMessage(message string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func randomID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,533 @@
+package istiocsr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/controllers"
+	"github.com/go-logr/logr"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+type signerFunc func(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error)
+
+func (f signerFunc) SignHostnames(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+	return f(ctx, log, issuer, cr, hostnames, meta)
+}
+
+type authenticatorFunc func(ctx context.Context, token string) (string, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, token string) (string, error) {
+	return f(ctx, token)
+}
+
+type rootsFunc func(ctx context.Context, requestType string) ([]byte, error)
+
+func (f rootsFunc) Root(ctx context.Context, requestType string) ([]byte, error) {
+	return f(ctx, requestType)
+}
+
+func TestCreateCertificate(t *testing.T) {
+	newCSR := func(uri string, dnsNames ...string) string {
+		spiffeID, err := url.Parse(uri)
+		assert.NilError(t, err)
+
+		csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRURIs(spiffeID), cmgen.SetCSRDNSNames(dnsNames...))
+		assert.NilError(t, err)
+
+		return string(csr)
+	}
+	csr := newCSR("spiffe://cluster.local/ns/default/sa/httpbin")
+
+	request := func(csr string, validity int64) []byte {
+		var b []byte
+		b = protowire.AppendTag(b, csrField, protowire.BytesType)
+		b = protowire.AppendString(b, csr)
+		b = protowire.AppendTag(b, validityDurationField, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(validity))
+		// Metadata, which is ignored.
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, []byte{0x0a, 0x00})
+		return b
+	}
+
+	signed := signerFunc(func(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+		if issuer != "mesh" || cr.Spec.Duration == nil || cr.Spec.Duration.Duration != 24*time.Hour || meta.ObjectName != "system:serviceaccount:default:httpbin" {
+			return nil, errors.New("unexpected request")
+		}
+
+		if len(hostnames) != 1 || hostnames[0] != "httpbin.default.mesh.example.com" {
+			return nil, errors.New("unexpected hostnames")
+		}
+
+		return []*cfapi.SignResponse{{Id: "1", Certificate: "ecc certificate\n", Type: "origin-ecc"}}, nil
+	})
+
+	tests := []struct {
+		name            string
+		path            string
+		token           string
+		body            []byte
+		signer          Signer
+		expectedStatus  string
+		expectedMessage string
+		expectedChain   []string
+	}{
+		{
+			name:           "signed",
+			path:           CreateCertificatePath,
+			token:          "valid",
+			body:           request(csr, 24*60*60),
+			signer:         signed,
+			expectedStatus: "0",
+			expectedChain:  []string{"ecc certificate\n", "origin-ecc root\n"},
+		},
+		{
+			name:           "hostname requested",
+			path:           CreateCertificatePath,
+			token:          "valid",
+			body:           request(newCSR("spiffe://cluster.local/ns/default/sa/httpbin", "httpbin.default.mesh.example.com"), 24*60*60),
+			signer:         signed,
+			expectedStatus: "0",
+			expectedChain:  []string{"ecc certificate\n", "origin-ecc root\n"},
+		},
+		{
+			name:            "other ServiceAccount",
+			path:            CreateCertificatePath,
+			token:           "valid",
+			body:            request(newCSR("spiffe://cluster.local/ns/kube-system/sa/admin"), 24*60*60),
+			signer:          signed,
+			expectedStatus:  "7",
+			expectedMessage: "CSR must request the SPIFFE ID spiffe://cluster.local/ns/default/sa/httpbin of the ServiceAccount",
+		},
+		{
+			name:            "other hostname",
+			path:            CreateCertificatePath,
+			token:           "valid",
+			body:            request(newCSR("spiffe://cluster.local/ns/default/sa/httpbin", "www.example.com"), 24*60*60),
+			signer:          signed,
+			expectedStatus:  "7",
+			expectedMessage: "CSR may not request DNS names other than httpbin.default.mesh.example.com",
+		},
+		{
+			name:            "not a ServiceAccount",
+			path:            CreateCertificatePath,
+			token:           "user",
+			body:            request(csr, 24*60*60),
+			signer:          signed,
+			expectedStatus:  "7",
+			expectedMessage: "only ServiceAccounts may request certificates",
+		},
+		{
+			name:            "unauthenticated",
+			path:            CreateCertificatePath,
+			token:           "expired",
+			body:            request(csr, 24*60*60),
+			signer:          signed,
+			expectedStatus:  "16",
+			expectedMessage: "authentication failed",
+		},
+		{
+			name:            "unknown method",
+			path:            "/istio.v1.auth.IstioCertificateService/Rotate",
+			token:           "valid",
+			body:            request(csr, 24*60*60),
+			signer:          signed,
+			expectedStatus:  "12",
+			expectedMessage: "unknown method /istio.v1.auth.IstioCertificateService/Rotate",
+		},
+		{
+			name:            "missing csr",
+			path:            CreateCertificatePath,
+			token:           "valid",
+			body:            request("", 24*60*60),
+			signer:          signed,
+			expectedStatus:  "3",
+			expectedMessage: "invalid IstioCertificateRequest: csr is required",
+		},
+		{
+			name:  "unsupported request",
+			path:  CreateCertificatePath,
+			token: "valid",
+			body:  request(csr, 24*60*60),
+			signer: signerFunc(func(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+				return nil, &controllers.SignError{Reason: "Failed", Message: "Failed to sign certificate signing request: 100%"}
+			}),
+			expectedStatus:  "3",
+			expectedMessage: "Failed to sign certificate signing request: 100%25",
+		},
+		{
+			name:  "transient error",
+			path:  CreateCertificatePath,
+			token: "valid",
+			body:  request(csr, 24*60*60),
+			signer: signerFunc(func(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+				return nil, errors.New("ClusterOriginIssuer mesh is not Ready")
+			}),
+			expectedStatus:  "14",
+			expectedMessage: "ClusterOriginIssuer mesh is not Ready",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{
+				Signer: tt.signer,
+				Authenticator: authenticatorFunc(func(ctx context.Context, token string) (string, error) {
+					switch token {
+					case "valid":
+						return "system:serviceaccount:default:httpbin", nil
+					case "user":
+						return "jane@example.com", nil
+					}
+					return "", errors.New("token expired")
+				}),
+				Roots: rootsFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+					return []byte(requestType + " root\n"), nil
+				}),
+				Log:              logr.Discard(),
+				Issuer:           "mesh",
+				Domain:           "mesh.example.com",
+				NewCorrelationID: func() string { return "c0ffee00" },
+			}
+
+			srv := httptest.NewUnstartedServer(server)
+			srv.EnableHTTP2 = true
+			srv.StartTLS()
+			defer srv.Close()
+
+			frame := make([]byte, 5, 5+len(tt.body))
+			frame[4] = byte(len(tt.body))
+			frame[3] = byte(len(tt.body) >> 8)
+			frame = append(frame, tt.body...)
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+tt.path, bytes.NewReader(frame))
+			assert.NilError(t, err)
+			req.Header.Set("Content-Type", "application/grpc")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			resp, err := srv.Client().Do(req)
+			assert.NilError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, resp.ProtoMajor, 2)
+
+			body, err := io.ReadAll(resp.Body)
+			assert.NilError(t, err)
+			assert.Equal(t, resp.Trailer.Get("Grpc-Status"), tt.expectedStatus)
+			assert.Equal(t, resp.Trailer.Get("Grpc-Message"), tt.expectedMessage)
+
+			if tt.expectedChain == nil {
+				assert.Equal(t, len(body), 0)
+				return
+			}
+
+			msg, _, err := readMessage(bytes.NewReader(body))
+			assert.NilError(t, err)
+
+			var chain []string
+			for len(msg) > 0 {
+				num, typ, n := protowire.ConsumeTag(msg)
+				assert.Assert(t, n > 0)
+				assert.Equal(t, num, certChainField)
+				assert.Equal(t, typ, protowire.BytesType)
+				msg = msg[n:]
+
+				cert, n := protowire.ConsumeString(msg)
+				assert.Assert(t, n > 0)
+				chain = append(chain, cert)
+				msg = msg[n:]
+			}
+			assert.DeepEqual(t, chain, tt.expectedChain)
+		})
+	}
+}
+
+func TestCreateCertificate_Reuse(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+
+	var signed int
+	server := &Server{
+		Signer: signerFunc(func(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+			signed++
+			return []*cfapi.SignResponse{{Id: strconv.Itoa(signed), Certificate: issue(t, cr.Spec.Request, clock.Now(), 24*time.Hour), Type: "origin-ecc"}}, nil
+		}),
+		Authenticator: authenticatorFunc(func(ctx context.Context, token string) (string, error) {
+			return "system:serviceaccount:default:httpbin", nil
+		}),
+		Log:    logr.Discard(),
+		Issuer: "mesh",
+		Domain: "mesh.example.com",
+		Clock:  clock,
+	}
+
+	newCSR := func() string {
+		spiffeID, err := url.Parse("spiffe://cluster.local/ns/default/sa/httpbin")
+		assert.NilError(t, err)
+
+		csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRURIs(spiffeID))
+		assert.NilError(t, err)
+
+		return string(csr)
+	}
+
+	create := func(csr string, validity int64) string {
+		var b []byte
+		b = protowire.AppendTag(b, csrField, protowire.BytesType)
+		b = protowire.AppendString(b, csr)
+		b = protowire.AppendTag(b, validityDurationField, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(validity))
+
+		var body bytes.Buffer
+		assert.NilError(t, writeMessage(&body, b))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, CreateCertificatePath, &body)
+		r.Header.Set("Content-Type", "application/grpc")
+		r.Header.Set("Authorization", "Bearer valid")
+		server.ServeHTTP(w, r)
+		assert.Equal(t, w.Header().Get("Grpc-Status"), "0", w.Header().Get("Grpc-Message"))
+
+		msg, _, err := readMessage(w.Body)
+		assert.NilError(t, err)
+		_, typ, n := protowire.ConsumeTag(msg)
+		assert.Equal(t, typ, protowire.BytesType)
+		cert, _ := protowire.ConsumeString(msg[n:])
+		return cert
+	}
+
+	csr := newCSR()
+	first := create(csr, 24*60*60)
+	assert.Equal(t, signed, 1)
+
+	// Retries of the same CSR are given the same certificate.
+	clock.Step(11 * time.Hour)
+	assert.Equal(t, create(csr, 24*60*60), first)
+	assert.Equal(t, signed, 1)
+
+	// Another key, or another validity, is signed a certificate of its own.
+	create(newCSR(), 24*60*60)
+	assert.Equal(t, signed, 2)
+	create(csr, 48*60*60)
+	assert.Equal(t, signed, 3)
+
+	// Past half its lifetime, when the proxy rotates it, the certificate
+	// is no longer reused.
+	clock.Step(time.Hour)
+	assert.Assert(t, create(csr, 24*60*60) != first)
+	assert.Equal(t, signed, 4)
+}
+
+// issue returns a certificate for the key of the CSR, valid for the duration
+// from now.
+func issue(t *testing.T, csrPEM []byte, now time.Time, duration time.Duration) string {
+	t.Helper()
+
+	csr, err := pki.DecodeX509CertificateRequestBytes(csrPEM)
+	assert.NilError(t, err)
+
+	key, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		DNSNames:     csr.DNSNames,
+		NotBefore:    now,
+		NotAfter:     now.Add(duration),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, key)
+	assert.NilError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// istioCA returns the descriptor of security/v1alpha1/ca.proto of istio.io/api,
+// with which istio-agent encodes its requests.
+func istioCA(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("security/v1alpha1/ca.proto"),
+		Package:    proto.String("istio.v1.auth"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/struct.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("IstioCertificateRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("csr", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("validity_duration", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+					field("metadata", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Struct"),
+				},
+			},
+			{
+				Name: proto.String("IstioCertificateResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("cert_chain", 200, repeated, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("IstioCertificateService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("CreateCertificate"),
+				InputType:  proto.String(".istio.v1.auth.IstioCertificateRequest"),
+				OutputType: proto.String(".istio.v1.auth.IstioCertificateResponse"),
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	assert.NilError(t, err)
+
+	return fd
+}
+
+// TestCreateCertificate_GRPCClient calls the API as istio-agent's CA client
+// does with grpc-go: over TLS with HTTP/2, with grpc-go's headers and the
+// metadata of the proxy, messages encoded with Istio's ca.proto, and the
+// response checked as grpc-go and istio-agent check it.
+func TestCreateCertificate_GRPCClient(t *testing.T) {
+	method := istioCA(t).Services().ByName("IstioCertificateService").Methods().ByName("CreateCertificate")
+	assert.Equal(t, "/"+string(method.Parent().FullName())+"/"+string(method.Name()), CreateCertificatePath)
+
+	var signed int
+	server := &Server{
+		Signer: signerFunc(func(ctx context.Context, log logr.Logger, issuer string, cr *certmanager.CertificateRequest, hostnames []string, meta cfapi.Metadata) ([]*cfapi.SignResponse, error) {
+			if cr.Spec.Duration == nil || cr.Spec.Duration.Duration != 24*time.Hour {
+				return nil, errors.New("unexpected duration")
+			}
+			signed++
+			return []*cfapi.SignResponse{{Id: "1", Certificate: issue(t, cr.Spec.Request, time.Now(), 24*time.Hour), Type: "origin-ecc"}}, nil
+		}),
+		Authenticator: authenticatorFunc(func(ctx context.Context, token string) (string, error) {
+			if token != "istio-ca token" {
+				return "", errors.New("token expired")
+			}
+			return "system:serviceaccount:default:httpbin", nil
+		}),
+		Roots: rootsFunc(func(ctx context.Context, requestType string) ([]byte, error) {
+			return []byte(requestType + " root\n"), nil
+		}),
+		Log:    logr.Discard(),
+		Issuer: "mesh",
+		Domain: "mesh.example.com",
+	}
+
+	srv := httptest.NewUnstartedServer(server)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http2.Transport{TLSClientConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}}
+
+	spiffeID, err := url.Parse("spiffe://cluster.local/ns/default/sa/httpbin")
+	assert.NilError(t, err)
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRURIs(spiffeID))
+	assert.NilError(t, err)
+
+	metadata, err := structpb.NewStruct(map[string]interface{}{"ClusterID": "Kubernetes"})
+	assert.NilError(t, err)
+
+	call := func(token string) (*http.Response, []byte) {
+		req := dynamicpb.NewMessage(method.Input())
+		req.Set(method.Input().Fields().ByName("csr"), protoreflect.ValueOfString(string(csr)))
+		req.Set(method.Input().Fields().ByName("validity_duration"), protoreflect.ValueOfInt64(24*60*60))
+		req.Set(method.Input().Fields().ByName("metadata"), protoreflect.ValueOfMessage(metadata.ProtoReflect()))
+		msg, err := proto.Marshal(req)
+		assert.NilError(t, err)
+
+		var body bytes.Buffer
+		assert.NilError(t, writeMessage(&body, msg))
+
+		r, err := http.NewRequest(http.MethodPost, srv.URL+CreateCertificatePath, &body)
+		assert.NilError(t, err)
+		r.Header.Set("Content-Type", "application/grpc")
+		r.Header.Set("Te", "trailers")
+		r.Header.Set("User-Agent", "grpc-go/1.60.1")
+		r.Header.Set("Grpc-Accept-Encoding", "gzip")
+		r.Header.Set("Grpc-Timeout", "9999998u")
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Clusterid", "Kubernetes")
+
+		resp, err := client.Do(r)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, resp.ProtoMajor, 2)
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+		assert.Assert(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc"))
+		assert.Equal(t, resp.Header.Get("Grpc-Encoding"), "")
+
+		b, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		return resp, b
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, body := call("istio-ca token")
+		assert.Equal(t, resp.Trailer.Get("Grpc-Status"), "0", resp.Trailer.Get("Grpc-Message"))
+
+		msg, code, err := readMessage(bytes.NewReader(body))
+		assert.NilError(t, err)
+		assert.Equal(t, code, codeOK)
+		assert.Equal(t, len(body), 5+len(msg), "a unary call has a single message")
+
+		out := dynamicpb.NewMessage(method.Output())
+		assert.NilError(t, proto.Unmarshal(msg, out))
+		assert.Equal(t, len(out.GetUnknown()), 0)
+
+		chain := out.Get(method.Output().Fields().ByName("cert_chain")).List()
+		assert.Equal(t, chain.Len(), 2)
+		leaf, err := pki.DecodeX509CertificateBytes([]byte(chain.Get(0).String()))
+		assert.NilError(t, err)
+		assert.Equal(t, leaf.NotAfter.Sub(leaf.NotBefore), 24*time.Hour)
+		assert.Equal(t, chain.Get(1).String(), "origin-ecc root\n")
+	}
+	// The proxy retrying its CSR is given the same certificate.
+	assert.Equal(t, signed, 1)
+
+	resp, body := call("expired")
+	assert.Equal(t, len(body), 0)
+	assert.Equal(t, resp.Trailer.Get("Grpc-Status"), "16")
+	assert.Equal(t, resp.Trailer.Get("Grpc-Message"), "authentication failed")
+}
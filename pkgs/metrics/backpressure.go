@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// workqueueDepthMetric is registered by controller-runtime for the work
+	// queue of every controller.
+	workqueueDepthMetric = "workqueue_depth"
+
+	signRequestsMetric = namespace + "_sign_requests_total"
+)
+
+var backpressure = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "backpressure",
+	Help:      "Whether the controller is falling behind, by reason: work queues deeper than the configured threshold (queue_depth), or too many failed sign requests (error_rate).",
+}, []string{"reason"})
+
+func init() {
+	metrics.Registry.MustRegister(backpressure)
+}
+
+// Backpressure periodically checks whether the controllers are falling
+// behind: whether their work queues hold more than MaxQueueDepth items, or more
+// than MaxErrorRate of the sign requests since the previous check failed.
+// Either threshold is disabled when zero.
+//
+// The outcome is exposed as the backpressure metric, and through Check as a
+// readiness check, so operators or autoscalers can add capacity before
+// issuance latency suffers.
+type Backpressure struct {
+	MaxQueueDepth int
+	MaxErrorRate  float64
+
+	// Interval between checks.
+	Interval time.Duration
+
+	// Gatherer provides the work queue and sign request metrics, usually the
+	// controller-runtime metrics registry.
+	Gatherer prometheus.Gatherer
+
+	Clock clock.WithTicker
+	Log   logr.Logger
+
+	mu           sync.Mutex
+	err          error
+	lastRequests float64
+	lastFailures float64
+}
+
+// Start checks for backpressure every Interval until the context is done.
+func (b *Backpressure) Start(ctx context.Context) error {
+	ticker := b.Clock.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		b.Evaluate()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// NeedLeaderElection reports that every replica checks for backpressure, as
+// readiness is reported by every replica.
+func (b *Backpressure) NeedLeaderElection() bool {
+	return false
+}
+
+// Check returns an error describing the backpressure found by the last
+// check, if any. It implements healthz.Checker.
+func (b *Backpressure) Check(_ *http.Request) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.err
+}
+
+// Evaluate checks the current metrics for backpressure.
+func (b *Backpressure) Evaluate() {
+	families, err := b.Gatherer.Gather()
+	if err != nil {
+		b.Log.Error(err, "failed to gather metrics, backpressure may be misreported")
+	}
+
+	var depth, requests, failures float64
+	for _, family := range families {
+		switch family.GetName() {
+		case workqueueDepthMetric:
+			for _, m := range family.GetMetric() {
+				depth += m.GetGauge().GetValue()
+			}
+		case signRequestsMetric:
+			for _, m := range family.GetMetric() {
+				requests += m.GetCounter().GetValue()
+				if labelValue(m, "result") == "failure" {
+					failures += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errorRate float64
+	if requests > b.lastRequests {
+		errorRate = (failures - b.lastFailures) / (requests - b.lastRequests)
+	}
+	b.lastRequests, b.lastFailures = requests, failures
+
+	b.err = nil
+	backpressure.WithLabelValues("queue_depth").Set(0)
+	backpressure.WithLabelValues("error_rate").Set(0)
+
+	if b.MaxErrorRate > 0 && errorRate > b.MaxErrorRate {
+		b.err = fmt.Errorf("%.0f%% of sign requests failed, more than the threshold of %.0f%%", errorRate*100, b.MaxErrorRate*100)
+		backpressure.WithLabelValues("error_rate").Set(1)
+	}
+
+	if b.MaxQueueDepth > 0 && depth > float64(b.MaxQueueDepth) {
+		b.err = fmt.Errorf("%.0f items queued, more than the threshold of %d", depth, b.MaxQueueDepth)
+		backpressure.WithLabelValues("queue_depth").Set(1)
+	}
+
+	if b.err != nil {
+		b.Log.Info("controller is falling behind", "reason", b.err.Error())
+	}
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestBackpressure(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	depth := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: workqueueDepthMetric}, []string{"name"})
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: signRequestsMetric}, []string{"result"})
+	registry.MustRegister(depth, requests)
+
+	b := &Backpressure{
+		MaxQueueDepth: 10,
+		MaxErrorRate:  0.5,
+		Interval:      time.Minute,
+		Gatherer:      registry,
+		Clock:         fakeClock.NewFakeClock(time.Now()),
+		Log:           logr.Discard(),
+	}
+
+	b.Evaluate()
+	assert.NilError(t, b.Check(nil))
+
+	// Queue depth is summed across controllers.
+	depth.WithLabelValues("certificaterequest").Set(8)
+	depth.WithLabelValues("originissuer").Set(3)
+	b.Evaluate()
+	assert.Error(t, b.Check(nil), "11 items queued, more than the threshold of 10")
+	assert.Equal(t, testutil.ToFloat64(backpressure.WithLabelValues("queue_depth")), float64(1))
+
+	depth.WithLabelValues("originissuer").Set(0)
+	b.Evaluate()
+	assert.NilError(t, b.Check(nil))
+	assert.Equal(t, testutil.ToFloat64(backpressure.WithLabelValues("queue_depth")), float64(0))
+
+	// The error rate only considers requests since the previous check.
+	requests.WithLabelValues("success").Add(1)
+	requests.WithLabelValues("failure").Add(3)
+	b.Evaluate()
+	assert.Error(t, b.Check(nil), "75% of sign requests failed, more than the threshold of 50%")
+	assert.Equal(t, testutil.ToFloat64(backpressure.WithLabelValues("error_rate")), float64(1))
+
+	requests.WithLabelValues("success").Add(3)
+	requests.WithLabelValues("failure").Add(1)
+	b.Evaluate()
+	assert.NilError(t, b.Check(nil))
+	assert.Equal(t, testutil.ToFloat64(backpressure.WithLabelValues("error_rate")), float64(0))
+
+	// No requests since the previous check is not an error.
+	b.Evaluate()
+	assert.NilError(t, b.Check(nil))
+}
+
+func TestBackpressure_Disabled(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	depth := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: workqueueDepthMetric}, []string{"name"})
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: signRequestsMetric}, []string{"result"})
+	registry.MustRegister(depth, requests)
+
+	b := &Backpressure{
+		Gatherer: registry,
+		Log:      logr.Discard(),
+	}
+
+	depth.WithLabelValues("certificaterequest").Set(1000)
+	requests.WithLabelValues("failure").Add(1000)
+	b.Evaluate()
+	assert.NilError(t, b.Check(nil))
+}
@@ -0,0 +1,161 @@
+// Package metrics provides Prometheus metrics for the operations performed by
+// the origin-ca-issuer controllers. Metrics are registered with the
+// controller-runtime metrics registry, and served by the manager's metrics
+// endpoint.
+package metrics
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "origin_ca_issuer"
+
+var issuerLabels = []string{"issuer_kind", "issuer_namespace", "issuer_name"}
+
+// requestLabels label the metrics of CertificateRequests with their tenant,
+// in addition to their issuer.
+var requestLabels = []string{"issuer_kind", "issuer_namespace", "issuer_name", "tenant"}
+
+var (
+	signRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sign_requests_total",
+		Help:      "Total number of certificate signing requests sent to the Cloudflare API, by result.",
+	}, append(requestLabels, "result"))
+
+	signErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sign_errors_total",
+		Help:      "Total number of failed certificate signing requests, by Cloudflare API error code. Errors not returned by the API have the code \"none\".",
+	}, append(requestLabels, "code"))
+
+	signDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sign_duration_seconds",
+		Help:      "Latency of certificate signing requests sent to the Cloudflare API.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, requestLabels)
+
+	approvalDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "approval_duration_seconds",
+		Help:      "Time from the creation of signed CertificateRequests to their approval, when the controller waits for approval.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 300, 900, 3600},
+	}, requestLabels)
+
+	zoneCertificates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "zone_certificates",
+		Help:      "Number of Origin CA certificates of the zone of an issuer, including those issued by other means.",
+	}, append(issuerLabels, "zone_id"))
+
+	attributedCertificates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "attributed_certificates_total",
+		Help:      "Total number of CertificateRequests issued, by the value of each of the labels or annotations the controller attributes them with, such as a team or an app. Values the controller wasn't told to count are recorded as \"other\".",
+	}, append(issuerLabels, "key", "value"))
+
+	revocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "revocations_total",
+		Help:      "Total number of Origin CA certificates revoked, by reason: their CertificateRequest was deleted (deleted), or they were superseded by a newly signed certificate (superseded). Revocations only reported in dry run mode have dry_run=\"true\".",
+	}, append(requestLabels, "reason", "dry_run"))
+)
+
+func init() {
+	metrics.Registry.MustRegister(signRequests, signErrors, signDuration, approvalDuration, zoneCertificates, revocations, attributedCertificates)
+}
+
+// Issuer identifies the issuer an operation was performed on behalf of.
+type Issuer struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Tenant owns the namespace of the CertificateRequest the operation was
+	// performed for, such as a team, for chargeback. Empty when unknown.
+	Tenant string
+}
+
+func (i Issuer) labels() []string {
+	return []string{i.Kind, i.Namespace, i.Name}
+}
+
+func (i Issuer) requestLabels() []string {
+	return []string{i.Kind, i.Namespace, i.Name, i.Tenant}
+}
+
+// ObserveSign records the outcome and latency of a call to the Cloudflare API
+// to sign a certificate.
+func ObserveSign(iss Issuer, latency time.Duration, err error) {
+	signDuration.WithLabelValues(iss.requestLabels()...).Observe(latency.Seconds())
+
+	if err == nil {
+		signRequests.WithLabelValues(append(iss.requestLabels(), "success")...).Inc()
+
+		return
+	}
+
+	signRequests.WithLabelValues(append(iss.requestLabels(), "failure")...).Inc()
+	signErrors.WithLabelValues(append(iss.requestLabels(), errorCode(err))...).Inc()
+}
+
+// ObserveApproval records how long a signed CertificateRequest waited to be
+// approved after its creation.
+func ObserveApproval(iss Issuer, latency time.Duration) {
+	approvalDuration.WithLabelValues(iss.requestLabels()...).Observe(latency.Seconds())
+}
+
+// SetZoneCertificates records the number of Origin CA certificates of the zone
+// of an issuer.
+func SetZoneCertificates(iss Issuer, zoneID string, count int) {
+	zoneCertificates.WithLabelValues(append(iss.labels(), zoneID)...).Set(float64(count))
+}
+
+// OtherAttribution is the value recorded for attribution values that aren't
+// counted on their own.
+const OtherAttribution = "other"
+
+// ObserveAttribution records the issuance of a CertificateRequest with the
+// attribution keys and values. Only the values listed for their key in
+// allowed are recorded as is, and others as OtherAttribution, as the values
+// are set by the users creating CertificateRequests and would otherwise
+// grow the metric without bound.
+func ObserveAttribution(iss Issuer, attribution map[string]string, allowed map[string][]string) {
+	for key, value := range attribution {
+		if !slices.Contains(allowed[key], value) {
+			value = OtherAttribution
+		}
+
+		attributedCertificates.WithLabelValues(append(iss.labels(), key, value)...).Inc()
+	}
+}
+
+// Reasons of certificate revocations.
+const (
+	RevocationDeleted    = "deleted"
+	RevocationSuperseded = "superseded"
+)
+
+// ObserveRevocations records the revocation of count Origin CA certificates
+// for the reason, or, in dry run mode, that they would have been revoked.
+func ObserveRevocations(iss Issuer, reason string, dryRun bool, count int) {
+	revocations.WithLabelValues(append(iss.requestLabels(), reason, strconv.FormatBool(dryRun))...).Add(float64(count))
+}
+
+// errorCode returns the Cloudflare API error code of err as a label value.
+func errorCode(err error) string {
+	var apiError *cfapi.APIError
+	if errors.As(err, &apiError) {
+		return strconv.Itoa(apiError.Code)
+	}
+
+	return "none"
+}
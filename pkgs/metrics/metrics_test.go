@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestObserveSign(t *testing.T) {
+	iss := Issuer{Kind: "OriginIssuer", Namespace: "default", Name: "foobar", Tenant: "payments"}
+
+	ObserveSign(iss, time.Second, nil)
+	ObserveSign(iss, time.Second, fmt.Errorf("unable to sign request: %w", &cfapi.APIError{Code: 1100}))
+	ObserveSign(iss, time.Second, errors.New("connection reset"))
+
+	assert.Equal(t, testutil.ToFloat64(signRequests.WithLabelValues("OriginIssuer", "default", "foobar", "payments", "success")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(signRequests.WithLabelValues("OriginIssuer", "default", "foobar", "payments", "failure")), float64(2))
+	assert.Equal(t, testutil.ToFloat64(signErrors.WithLabelValues("OriginIssuer", "default", "foobar", "payments", "1100")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(signErrors.WithLabelValues("OriginIssuer", "default", "foobar", "payments", "none")), float64(1))
+	assert.Equal(t, testutil.CollectAndCount(signDuration), 1)
+}
+
+func TestObserveApproval(t *testing.T) {
+	iss := Issuer{Kind: "OriginIssuer", Namespace: "default", Name: "foobar"}
+
+	ObserveApproval(iss, 3*time.Second)
+	ObserveApproval(iss, time.Minute)
+
+	assert.Equal(t, testutil.CollectAndCount(approvalDuration), 1)
+}
+
+func TestSetZoneCertificates(t *testing.T) {
+	iss := Issuer{Kind: "ClusterOriginIssuer", Name: "foobar"}
+
+	SetZoneCertificates(iss, "023e105f4ecef8ad9ca31a8372d0c353", 12)
+	SetZoneCertificates(iss, "023e105f4ecef8ad9ca31a8372d0c353", 13)
+
+	assert.Equal(t, testutil.ToFloat64(zoneCertificates.WithLabelValues("ClusterOriginIssuer", "", "foobar", "023e105f4ecef8ad9ca31a8372d0c353")), float64(13))
+}
+
+func TestObserveAttribution(t *testing.T) {
+	iss := Issuer{Kind: "OriginIssuer", Namespace: "default", Name: "foobar", Tenant: "payments"}
+
+	allowed := map[string][]string{"example.com/team": {"payments"}}
+	ObserveAttribution(iss, map[string]string{"example.com/team": "payments", "app": "checkout"}, allowed)
+	ObserveAttribution(iss, map[string]string{"example.com/team": "payments"}, allowed)
+	ObserveAttribution(iss, map[string]string{"example.com/team": "a3f9c2"}, allowed)
+
+	assert.Equal(t, testutil.ToFloat64(attributedCertificates.WithLabelValues("OriginIssuer", "default", "foobar", "example.com/team", "payments")), float64(2))
+	assert.Equal(t, testutil.ToFloat64(attributedCertificates.WithLabelValues("OriginIssuer", "default", "foobar", "example.com/team", "other")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(attributedCertificates.WithLabelValues("OriginIssuer", "default", "foobar", "app", "other")), float64(1))
+}
+
+func TestObserveRevocations(t *testing.T) {
+	iss := Issuer{Kind: "OriginIssuer", Namespace: "default", Name: "foobar"}
+
+	ObserveRevocations(iss, RevocationDeleted, false, 1)
+	ObserveRevocations(iss, RevocationSuperseded, true, 2)
+	ObserveRevocations(iss, RevocationSuperseded, true, 1)
+
+	assert.Equal(t, testutil.ToFloat64(revocations.WithLabelValues("OriginIssuer", "default", "foobar", "", "deleted", "false")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(revocations.WithLabelValues("OriginIssuer", "default", "foobar", "", "superseded", "true")), float64(3))
+}
@@ -0,0 +1,72 @@
+package provisioners
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithAllowedHostnames restricts the hostnames Sign may request to names,
+// matched exactly, and to the hostnames of zones, including the zones
+// themselves. Every hostname is allowed when both are empty.
+func WithAllowedHostnames(names, zones []string) Option {
+	return func(p *Provisioner) {
+		p.allowedNames = names
+		p.allowedZones = zones
+	}
+}
+
+// HostnameNotAllowedError is returned when signing a CSR with hostnames
+// outside of the allowed names and zones of the issuer.
+type HostnameNotAllowedError struct {
+	Hostnames []string
+}
+
+func (e *HostnameNotAllowedError) Error() string {
+	return fmt.Sprintf("hostnames %s are not allowed by the allowedDNSNames or allowedDNSZones of the issuer", strings.Join(e.Hostnames, ", "))
+}
+
+func (e *HostnameNotAllowedError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// checkAllowedHostnames returns a HostnameNotAllowedError listing the
+// hostnames that aren't allowed, if any. The hostnames must be normalized.
+func (p *Provisioner) checkAllowedHostnames(hostnames []string) error {
+	if len(p.allowedNames) == 0 && len(p.allowedZones) == 0 {
+		return nil
+	}
+
+	var denied []string
+	for _, hostname := range hostnames {
+		if !HostnameAllowed(hostname, p.allowedNames, p.allowedZones) {
+			denied = append(denied, hostname)
+		}
+	}
+
+	if len(denied) > 0 {
+		return &HostnameNotAllowedError{Hostnames: denied}
+	}
+
+	return nil
+}
+
+// HostnameAllowed reports whether the hostname is one of the names, or is in
+// one of the zones. Wildcards are in the zone of their parent domain, so
+// *.example.com is in the zone example.com. The hostname must be normalized.
+func HostnameAllowed(hostname string, names, zones []string) bool {
+	for _, name := range names {
+		if hostname == strings.ToLower(name) {
+			return true
+		}
+	}
+
+	hostname = strings.TrimPrefix(hostname, "*.")
+	for _, zone := range zones {
+		zone = strings.ToLower(zone)
+		if hostname == zone || strings.HasSuffix(hostname, "."+zone) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package provisioners
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+)
+
+func TestSign_AllowedHostnames(t *testing.T) {
+	tests := []struct {
+		name     string
+		dnsNames []string
+		names    []string
+		zones    []string
+		collapse bool
+		denied   []string
+	}{
+		{
+			name:     "unrestricted",
+			dnsNames: []string{"example.org"},
+		},
+		{
+			name:     "allowed names",
+			dnsNames: []string{"WWW.example.com.", "*.example.net"},
+			names:    []string{"www.example.com", "*.Example.net"},
+		},
+		{
+			name:     "allowed zones",
+			dnsNames: []string{"example.com", "*.example.com", "a.b.example.com"},
+			zones:    []string{"Example.com"},
+		},
+		{
+			name:     "outside of zones",
+			dnsNames: []string{"example.com", "badexample.com", "example.org"},
+			names:    []string{"example.org"},
+			zones:    []string{"example.com"},
+			denied:   []string{"badexample.com"},
+		},
+		{
+			name:     "name does not allow subdomains",
+			dnsNames: []string{"www.example.com", "a.www.example.com"},
+			names:    []string{"www.example.com"},
+			denied:   []string{"a.www.example.com"},
+		},
+		{
+			name:     "collapsed wildcard",
+			dnsNames: []string{"a.example.com", "b.example.com"},
+			names:    []string{"a.example.com", "b.example.com"},
+			collapse: true,
+			denied:   []string{"*.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signed := false
+			signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				signed = true
+				return &cfapi.SignResponse{Id: "1"}, nil
+			})
+
+			opts := []Option{WithAllowedHostnames(tt.names, tt.zones)}
+			if tt.collapse {
+				opts = append(opts, WithWildcardPolicy(2, true))
+			}
+			provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), opts...)
+			assert.NilError(t, err)
+
+			req := issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+			)
+
+			_, err = provisioner.Sign(context.Background(), req)
+			if tt.denied == nil {
+				assert.NilError(t, err)
+				assert.Assert(t, signed)
+				return
+			}
+
+			var notAllowed *HostnameNotAllowedError
+			assert.Assert(t, errors.As(err, &notAllowed), "unexpected error: %v", err)
+			assert.DeepEqual(t, notAllowed.Hostnames, tt.denied)
+			assert.Assert(t, errors.Is(err, ErrInvalidRequest))
+			assert.Assert(t, !signed, "signed hostnames that are not allowed")
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package provisioners
+
+import (
+	"fmt"
+	"strings"
+
+	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/validation"
+)
+
+// SelectZoneCredential returns the index of the zone credential to sign the
+// CertificateRequest with, or -1 if none of their zones contain its
+// hostnames, which are then signed with the issuer's own credential. Each
+// hostname is matched to the credential of its longest zone, and the
+// request is invalid if its hostnames match different credentials.
+func SelectZoneCredential(cr *certmanager.CertificateRequest, credentials []v1.ZoneCredential) (int, error) {
+	csr, err := pki.DecodeX509CertificateRequestBytes(cr.Spec.Request)
+	if err != nil {
+		return -1, &invalidRequestError{fmt.Errorf("failed to decode CSR: %w", err)}
+	}
+
+	selected, first := -1, ""
+	for i, hostname := range validation.NormalizeHostnames(csr.DNSNames) {
+		index := zoneCredential(strings.TrimPrefix(hostname, "*."), credentials)
+		if i == 0 {
+			selected, first = index, hostname
+			continue
+		}
+
+		if index != selected {
+			return -1, &invalidRequestError{fmt.Errorf("hostnames %s and %s are not in the zones of the same credential", first, hostname)}
+		}
+	}
+
+	return selected, nil
+}
+
+// zoneCredential returns the index of the credential with the longest zone
+// containing hostname, or -1 if there is none.
+func zoneCredential(hostname string, credentials []v1.ZoneCredential) int {
+	index, longest := -1, 0
+	for i, credential := range credentials {
+		for _, zone := range credential.Zones {
+			zone = strings.ToLower(strings.TrimPrefix(zone, "*."))
+			if hostname != zone && !strings.HasSuffix(hostname, "."+zone) {
+				continue
+			}
+
+			if len(zone) > longest {
+				index, longest = i, len(zone)
+			}
+		}
+	}
+
+	return index
+}
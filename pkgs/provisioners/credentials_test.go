@@ -0,0 +1,75 @@
+package provisioners
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+)
+
+func TestSelectZoneCredential(t *testing.T) {
+	credentials := []v1.ZoneCredential{
+		{Zones: []string{"*.example.com"}},
+		{Zones: []string{"example.net", "example.org"}},
+		{Zones: []string{"dev.example.com"}},
+	}
+
+	tests := []struct {
+		name     string
+		dnsNames []string
+		expected int
+		error    string
+	}{
+		{
+			name:     "zone",
+			dnsNames: []string{"example.com", "www.example.com", "*.example.com"},
+			expected: 0,
+		},
+		{
+			name:     "second zone of a credential",
+			dnsNames: []string{"WWW.example.org."},
+			expected: 1,
+		},
+		{
+			name:     "longest zone",
+			dnsNames: []string{"api.dev.example.com", "*.dev.example.com"},
+			expected: 2,
+		},
+		{
+			name:     "no zone",
+			dnsNames: []string{"example.io", "notexample.com"},
+			expected: -1,
+		},
+		{
+			name:     "different credentials",
+			dnsNames: []string{"example.com", "example.net"},
+			error:    "hostnames example.com and example.net are not in the zones of the same credential",
+		},
+		{
+			name:     "partly in no zone",
+			dnsNames: []string{"example.com", "example.io"},
+			error:    "hostnames example.com and example.io are not in the zones of the same credential",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+			)
+
+			got, err := SelectZoneCredential(req, credentials)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Assert(t, errors.Is(err, ErrInvalidRequest))
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package provisioners
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+)
+
+// WithDryRun configures Sign to validate CertificateRequests and log the
+// requests it would send, without calling the Cloudflare API. Checks relying
+// on the API, resolving zones and looking for duplicate certificates, are
+// skipped. Sign then returns a DryRunError.
+func WithDryRun(dryRun bool) Option {
+	return func(p *Provisioner) {
+		p.dryRun = dryRun
+	}
+}
+
+// DryRunError is returned by Sign in dry run mode, for a CertificateRequest
+// which passed validation, with the requests that would have been sent to the
+// Cloudflare API.
+type DryRunError struct {
+	Requests []*cfapi.SignRequest
+}
+
+func (e *DryRunError) Error() string {
+	types := make([]string, 0, len(e.Requests))
+	for _, req := range e.Requests {
+		types = append(types, req.Type)
+	}
+
+	req := e.Requests[0]
+	return fmt.Sprintf("dry run, would sign %s certificate for hostnames %s valid for %d days", strings.Join(types, " and "), strings.Join(req.Hostnames, ", "), req.Validity)
+}
+
+// dryRunError logs the requests Sign would send for the CSR, leaving out the
+// CSR itself, and returns them as a DryRunError.
+func (p *Provisioner) dryRunError(hostnames []string, validity int, csr string) error {
+	reqTypes := p.RequestTypes()
+	reqs := make([]*cfapi.SignRequest, 0, len(reqTypes))
+	for _, reqType := range reqTypes {
+		req := &cfapi.SignRequest{Hostnames: hostnames, Validity: validity, Type: reqType, CSR: csr}
+		p.log.Info("dry run, not signing certificate request", "hostnames", req.Hostnames, "validity", req.Validity, "request_type", req.Type)
+		reqs = append(reqs, req)
+	}
+
+	return &DryRunError{Requests: reqs}
+}
@@ -0,0 +1,56 @@
+package provisioners
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+func TestSign_DryRun(t *testing.T) {
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		t.Fatal("signed in dry run mode")
+		return nil, nil
+	})
+	zones := &fakeZones{}
+	duplicates := &fakeZone{certificates: []cfapi.SignResponse{{Id: "duplicate", Hostnames: []string{"example.com", "www.example.com"}, Type: "origin-rsa", Expiration: time.Now().Add(time.Hour)}}}
+
+	provisioner, err := New(signer, v1.RequestTypeOriginRSA, logr.Discard(),
+		WithDryRun(true),
+		WithDualStack(true),
+		WithZoneResolution(zones, zones),
+		WithDuplicatePolicy(v1.DuplicatePolicyFail, duplicates, "023e105f4ecef8ad9ca31a8372d0c353", fakeClock.NewFakeClock(time.Now())),
+	)
+	assert.NilError(t, err)
+
+	req := issuertesting.CertificateRequest("default", "foobar",
+		issuertesting.SetCertificateRequestDNSNames("www.example.com", "Example.com"),
+	)
+
+	_, err = provisioner.Sign(context.Background(), req)
+
+	var dryRun *DryRunError
+	assert.Assert(t, errors.As(err, &dryRun), "unexpected error: %v", err)
+	assert.Error(t, err, "dry run, would sign origin-rsa and origin-ecc certificate for hostnames example.com, www.example.com valid for 7 days")
+	assert.Equal(t, len(dryRun.Requests), 2)
+	for _, req := range dryRun.Requests {
+		assert.DeepEqual(t, req.Hostnames, []string{"example.com", "www.example.com"})
+		assert.Equal(t, req.Validity, 7)
+		assert.Assert(t, req.CSR != "")
+	}
+	assert.Equal(t, len(zones.lookups), 0)
+
+	// Invalid requests are still rejected.
+	req = issuertesting.CertificateRequest("default", "foobar",
+		issuertesting.SetCertificateRequestDNSNames("www.*.example.com"),
+	)
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.Assert(t, errors.Is(err, ErrInvalidRequest), "unexpected error: %v", err)
+}
@@ -0,0 +1,154 @@
+package provisioners
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"k8s.io/utils/clock"
+)
+
+// Lister implements the Origin CA API to list the certificates of a zone.
+type Lister interface {
+	List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error)
+}
+
+// WithDuplicatePolicy configures Sign to look for unexpired certificates of
+// the zone issued for the same hostnames and request type before signing,
+// and to handle them following the policy. The AlwaysNew policy, or an empty
+// one, never looks.
+func WithDuplicatePolicy(policy v1.DuplicatePolicy, client Lister, zoneID string, clock clock.PassiveClock) Option {
+	return func(p *Provisioner) {
+		p.duplicatePolicy = policy
+		p.lister = client
+		p.listZoneID = zoneID
+		p.clock = clock
+	}
+}
+
+// WithPreviousCertificates sets the IDs of the certificates of earlier
+// revisions of the same Certificate, which the request supersedes. The Fail
+// duplicate policy doesn't count them as duplicates, and RevokeSuperseded
+// only revokes them.
+func WithPreviousCertificates(ids ...string) Option {
+	return func(p *Provisioner) {
+		p.previous = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			p.previous[id] = true
+		}
+	}
+}
+
+// DuplicateCertificateError is returned when signing a CertificateRequest
+// for the hostnames of an existing certificate with the Fail duplicate
+// policy.
+type DuplicateCertificateError struct {
+	ID         string
+	Hostnames  []string
+	Expiration time.Time
+}
+
+func (e *DuplicateCertificateError) Error() string {
+	return fmt.Sprintf("certificate %s was already issued for hostnames %s, and expires at %s", e.ID, strings.Join(e.Hostnames, ", "), e.Expiration.UTC().Format(time.RFC3339))
+}
+
+func (e *DuplicateCertificateError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// duplicates returns, by request type, the existing certificates Sign
+// publishes rather than signing new ones. Following the duplicate policy,
+// these are certificates issued for the hostnames, public key and validity
+// that are not yet due for renewal, or a DuplicateCertificateError is
+// returned for any unexpired certificate of the hostnames, other than those
+// of earlier revisions or due for renewal, which the request renews.
+func (p *Provisioner) duplicates(ctx context.Context, hostnames []string, publicKey []byte, validity int) (map[string]*cfapi.SignResponse, error) {
+	switch p.duplicatePolicy {
+	case v1.DuplicatePolicyReuse, v1.DuplicatePolicyFail:
+	default:
+		return nil, nil
+	}
+
+	reqTypes := p.RequestTypes()
+	now := p.clock.Now()
+	reusable := make(map[string]*cfapi.SignResponse)
+	for page, seen := 1, 0; ; page++ {
+		resp, err := p.lister.List(ctx, &cfapi.ListRequest{ZoneID: p.listZoneID, Page: page, PerPage: listPageSize})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list certificates of zone %s: %w", p.listZoneID, err)
+		}
+
+		for i := range resp.Certificates {
+			cert := &resp.Certificates[i]
+			if !slices.Contains(reqTypes, cert.Type) || !sameHostnames(cert.Hostnames, hostnames) || !now.Before(cert.Expiration) {
+				continue
+			}
+
+			if p.duplicatePolicy == v1.DuplicatePolicyFail {
+				if p.previous[cert.Id] || dueForRenewal(cert, now) {
+					continue
+				}
+
+				return nil, &DuplicateCertificateError{ID: cert.Id, Hostnames: hostnames, Expiration: cert.Expiration}
+			}
+
+			if reusable[cert.Type] == nil && cert.Validity == validity && reusableCertificate(cert, publicKey, now) {
+				reusable[cert.Type] = cert
+			}
+		}
+
+		seen += len(resp.Certificates)
+		if len(resp.Certificates) == 0 || seen >= resp.TotalCount {
+			break
+		}
+	}
+
+	return reusable, nil
+}
+
+// reusableCertificate reports whether the certificate was issued for the
+// public key, and is not yet due for renewal. cert-manager renews
+// certificates a third of their lifetime before they expire, so publishing
+// one past that point would only trigger another renewal.
+func reusableCertificate(cert *cfapi.SignResponse, publicKey []byte, now time.Time) bool {
+	leaf := parseLeaf(cert)
+	if leaf == nil || string(leaf.RawSubjectPublicKeyInfo) != string(publicKey) {
+		return false
+	}
+
+	return now.Before(renewalTime(leaf))
+}
+
+// dueForRenewal reports whether cert-manager would already renew the
+// certificate. Certificates that can't be parsed are not.
+func dueForRenewal(cert *cfapi.SignResponse, now time.Time) bool {
+	leaf := parseLeaf(cert)
+
+	return leaf != nil && !now.Before(renewalTime(leaf))
+}
+
+// renewalTime returns when cert-manager renews the certificate, a third of
+// its lifetime before it expires.
+func renewalTime(leaf *x509.Certificate) time.Time {
+	return leaf.NotAfter.Add(-leaf.NotAfter.Sub(leaf.NotBefore) / 3)
+}
+
+func parseLeaf(cert *cfapi.SignResponse) *x509.Certificate {
+	block, _ := pem.Decode([]byte(cert.Certificate))
+	if block == nil {
+		return nil
+	}
+
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+
+	return leaf
+}
@@ -0,0 +1,147 @@
+package provisioners
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+// keyPair returns a PEM encoded CSR for the hostnames, and a function
+// returning a PEM encoded certificate for its key valid between notBefore
+// and notAfter.
+func keyPair(t *testing.T, hostnames ...string) ([]byte, func(notBefore, notAfter time.Time) string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: hostnames}, key)
+	assert.NilError(t, err)
+
+	certificate := func(notBefore, notAfter time.Time) string {
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: hostnames[0]},
+			DNSNames:     hostnames,
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+		}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+		assert.NilError(t, err)
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), certificate
+}
+
+func TestSign_DuplicatePolicy(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	clock := fakeClock.NewFakeClock(now)
+
+	csr, certificate := keyPair(t, "example.com", "www.example.com")
+	_, otherCertificate := keyPair(t, "example.com", "www.example.com")
+
+	hostnames := []string{"www.example.com", "example.com"}
+	fresh := cfapi.SignResponse{Id: "fresh", Hostnames: hostnames, Type: "origin-ecc", Validity: 7, Expiration: now.Add(6 * 24 * time.Hour), Certificate: certificate(now.Add(-24*time.Hour), now.Add(6*24*time.Hour))}
+	dueForRenewal := cfapi.SignResponse{Id: "due", Hostnames: hostnames, Type: "origin-ecc", Validity: 7, Expiration: now.Add(24 * time.Hour), Certificate: certificate(now.Add(-6*24*time.Hour), now.Add(24*time.Hour))}
+	otherKey := cfapi.SignResponse{Id: "other-key", Hostnames: hostnames, Type: "origin-ecc", Validity: 7, Expiration: now.Add(6 * 24 * time.Hour), Certificate: otherCertificate(now.Add(-24*time.Hour), now.Add(6*24*time.Hour))}
+	otherValidity := cfapi.SignResponse{Id: "other-validity", Hostnames: hostnames, Type: "origin-ecc", Validity: 30, Expiration: now.Add(29 * 24 * time.Hour), Certificate: certificate(now.Add(-24*time.Hour), now.Add(29*24*time.Hour))}
+	expired := cfapi.SignResponse{Id: "expired", Hostnames: hostnames, Type: "origin-ecc", Validity: 7, Expiration: now.Add(-time.Hour), Certificate: certificate(now.Add(-8*24*time.Hour), now.Add(-time.Hour))}
+	subset := cfapi.SignResponse{Id: "subset", Hostnames: []string{"example.com"}, Type: "origin-ecc", Validity: 7, Expiration: now.Add(6 * 24 * time.Hour)}
+	rsa := cfapi.SignResponse{Id: "rsa", Hostnames: hostnames, Type: "origin-rsa", Validity: 7, Expiration: now.Add(6 * 24 * time.Hour)}
+
+	tests := []struct {
+		name         string
+		policy       v1.DuplicatePolicy
+		certificates []cfapi.SignResponse
+		previous     []string
+		expected     string
+		error        string
+	}{
+		{
+			name:         "always new",
+			policy:       v1.DuplicatePolicyAlwaysNew,
+			certificates: []cfapi.SignResponse{fresh},
+			expected:     "signed",
+		},
+		{
+			name:         "reuse",
+			policy:       v1.DuplicatePolicyReuse,
+			certificates: []cfapi.SignResponse{expired, otherKey, otherValidity, dueForRenewal, fresh},
+			expected:     "fresh",
+		},
+		{
+			name:         "nothing to reuse",
+			policy:       v1.DuplicatePolicyReuse,
+			certificates: []cfapi.SignResponse{expired, otherKey, otherValidity, dueForRenewal, subset, rsa},
+			expected:     "signed",
+		},
+		{
+			name:         "fail",
+			policy:       v1.DuplicatePolicyFail,
+			certificates: []cfapi.SignResponse{expired, subset, rsa, otherKey},
+			error:        "certificate other-key was already issued for hostnames example.com, www.example.com, and expires at 2024-03-07T00:00:00Z",
+		},
+		{
+			name:         "no duplicate",
+			policy:       v1.DuplicatePolicyFail,
+			certificates: []cfapi.SignResponse{expired, subset, rsa},
+			expected:     "signed",
+		},
+		{
+			name:         "renewal",
+			policy:       v1.DuplicatePolicyFail,
+			certificates: []cfapi.SignResponse{dueForRenewal, fresh},
+			previous:     []string{"fresh"},
+			expected:     "signed",
+		},
+		{
+			name:         "fail despite previous revision",
+			policy:       v1.DuplicatePolicyFail,
+			certificates: []cfapi.SignResponse{fresh, otherKey},
+			previous:     []string{"fresh"},
+			error:        "certificate other-key was already issued for hostnames example.com, www.example.com, and expires at 2024-03-07T00:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				return &cfapi.SignResponse{Id: "signed"}, nil
+			})
+			zone := &fakeZone{certificates: tt.certificates}
+
+			provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithDuplicatePolicy(tt.policy, zone, "023e105f4ecef8ad9ca31a8372d0c353", clock), WithPreviousCertificates(tt.previous...))
+			assert.NilError(t, err)
+
+			req := issuertesting.CertificateRequest("default", "foobar", cmgen.SetCertificateRequestCSR(csr))
+			resps, err := provisioner.Sign(context.Background(), req)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Assert(t, errors.Is(err, ErrInvalidRequest))
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(resps), 1)
+			assert.Equal(t, resps[0].Id, tt.expected)
+		})
+	}
+}
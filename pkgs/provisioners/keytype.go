@@ -0,0 +1,72 @@
+package provisioners
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+)
+
+// WithKeyTypeCheck configures Sign to fail requests whose public key doesn't
+// match the request type, such as ECDSA keys for OriginRSA issuers, rather
+// than sending them to the Cloudflare API. Dual-stack provisioners sign each
+// key as both request types, so their requests aren't checked.
+func WithKeyTypeCheck() Option {
+	return func(p *Provisioner) {
+		p.matchKeyType = true
+	}
+}
+
+// KeyTypeMismatchError is returned when signing, WithKeyTypeCheck, a CSR
+// whose public key isn't of the algorithm of the request type.
+type KeyTypeMismatchError struct {
+	Algorithm   x509.PublicKeyAlgorithm
+	RequestType v1.RequestType
+}
+
+func (e *KeyTypeMismatchError) Error() string {
+	return fmt.Sprintf("public key is %s, but the issuer signs %s certificates for %s keys", e.Algorithm, e.RequestType, keyAlgorithm(e.RequestType))
+}
+
+func (e *KeyTypeMismatchError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// Expected returns the public key algorithm the request type signs.
+func (e *KeyTypeMismatchError) Expected() x509.PublicKeyAlgorithm {
+	return keyAlgorithm(e.RequestType)
+}
+
+// MatchingRequestType returns the request type signing certificates for the
+// public key.
+func (e *KeyTypeMismatchError) MatchingRequestType() v1.RequestType {
+	if e.Algorithm == x509.ECDSA {
+		return v1.RequestTypeOriginECC
+	}
+
+	return v1.RequestTypeOriginRSA
+}
+
+// keyAlgorithm returns the public key algorithm of the certificates signed
+// as the request type.
+func keyAlgorithm(reqType v1.RequestType) x509.PublicKeyAlgorithm {
+	if reqType == v1.RequestTypeOriginECC {
+		return x509.ECDSA
+	}
+
+	return x509.RSA
+}
+
+// checkKeyType returns a KeyTypeMismatchError when the public key of the
+// CSR isn't of the algorithm of the request type.
+func (p *Provisioner) checkKeyType(csr *x509.CertificateRequest) error {
+	if !p.matchKeyType || p.dualStack {
+		return nil
+	}
+
+	if csr.PublicKeyAlgorithm != keyAlgorithm(p.reqType) {
+		return &KeyTypeMismatchError{Algorithm: csr.PublicKeyAlgorithm, RequestType: p.reqType}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package provisioners
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+)
+
+func TestSign_KeyTypeCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		reqType   v1.RequestType
+		key       x509.PublicKeyAlgorithm
+		dualStack bool
+		error     string
+	}{
+		{
+			name:    "rsa",
+			reqType: v1.RequestTypeOriginRSA,
+			key:     x509.RSA,
+		},
+		{
+			name:    "ecc",
+			reqType: v1.RequestTypeOriginECC,
+			key:     x509.ECDSA,
+		},
+		{
+			name:    "ecdsa key for rsa",
+			reqType: v1.RequestTypeOriginRSA,
+			key:     x509.ECDSA,
+			error:   "public key is ECDSA, but the issuer signs OriginRSA certificates for RSA keys",
+		},
+		{
+			name:    "rsa key for ecc",
+			reqType: v1.RequestTypeOriginECC,
+			key:     x509.RSA,
+			error:   "public key is RSA, but the issuer signs OriginECC certificates for ECDSA keys",
+		},
+		{
+			name:      "dual-stack",
+			reqType:   v1.RequestTypeOriginECC,
+			key:       x509.RSA,
+			dualStack: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signed := false
+			signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				signed = true
+				return &cfapi.SignResponse{Id: "1"}, nil
+			})
+
+			provisioner, err := New(signer, tt.reqType, logr.Discard(), WithKeyTypeCheck(), WithDualStack(tt.dualStack))
+			assert.NilError(t, err)
+
+			csr, _, err := cmgen.CSR(tt.key, cmgen.SetCSRDNSNames("example.com"))
+			assert.NilError(t, err)
+			req := issuertesting.CertificateRequest("default", "foobar", cmgen.SetCertificateRequestCSR(csr))
+
+			_, err = provisioner.Sign(context.Background(), req)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Assert(t, errors.Is(err, ErrInvalidRequest))
+				assert.Assert(t, !signed)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Assert(t, signed)
+		})
+	}
+}
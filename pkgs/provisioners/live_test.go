@@ -0,0 +1,197 @@
+//go:build e2e
+// +build e2e
+
+package provisioners
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The live tests sign and revoke Origin CA certificates with the Cloudflare
+// API, so that releases are checked against its actual behaviour. They are
+// skipped unless credentials and a zone are set in the environment:
+//
+//	ORIGIN_CA_E2E_API_TOKEN   API token, or else
+//	ORIGIN_CA_E2E_SERVICE_KEY Origin CA service key
+//	ORIGIN_CA_E2E_ZONE        zone whose subdomains are signed, such as example.com
+//	ORIGIN_CA_E2E_ZONE_ID     ID of the zone, to check certificates are listed (optional)
+//	ORIGIN_CA_E2E_ENDPOINT    Cloudflare API endpoint (optional)
+//
+// Every case signs for random subdomains of the zone, which need no DNS
+// records, and revokes its certificates, so that runs may overlap, such as
+// from concurrent release pipelines.
+
+// liveHostname returns a random hostname of the zone, unique to a case.
+func liveHostname(t *testing.T, zone string) string {
+	t.Helper()
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return "origin-ca-e2e-" + hex.EncodeToString(b) + "." + zone
+}
+
+func TestLiveAPI(t *testing.T) {
+	zone := os.Getenv("ORIGIN_CA_E2E_ZONE")
+	creds := cfapi.Credentials{
+		APIToken:   []byte(os.Getenv("ORIGIN_CA_E2E_API_TOKEN")),
+		ServiceKey: []byte(os.Getenv("ORIGIN_CA_E2E_SERVICE_KEY")),
+		Endpoint:   os.Getenv("ORIGIN_CA_E2E_ENDPOINT"),
+	}
+	if zone == "" || (len(creds.APIToken) == 0 && len(creds.ServiceKey) == 0) {
+		t.Skip("set ORIGIN_CA_E2E_ZONE, and ORIGIN_CA_E2E_API_TOKEN or ORIGIN_CA_E2E_SERVICE_KEY, to test against the Cloudflare API")
+	}
+	zoneID := os.Getenv("ORIGIN_CA_E2E_ZONE_ID")
+
+	client := cfapi.New(creds, cfapi.WithRateLimiter(cfapi.NewRateLimiter()), cfapi.WithZoneCache(cfapi.DefaultZoneCacheTTL))
+
+	// Roots not vendored into the checkout are fetched from Cloudflare, as
+	// the controller would.
+	embedded, err := cfapi.EmbeddedRoots()
+	assert.NilError(t, err)
+	roots := cfapi.NewRootStore(http.DefaultClient, cfapi.RootURLs)
+	roots.Pin(embedded)
+
+	tests := []struct {
+		name      string
+		reqType   v1.RequestType
+		key       x509.PublicKeyAlgorithm
+		dualStack bool
+		wildcard  bool
+		zones     bool
+	}{
+		{name: "rsa", reqType: v1.RequestTypeOriginRSA, key: x509.RSA},
+		{name: "rsa with ecdsa key", reqType: v1.RequestTypeOriginRSA, key: x509.ECDSA},
+		{name: "ecc", reqType: v1.RequestTypeOriginECC, key: x509.ECDSA},
+		{name: "wildcard", reqType: v1.RequestTypeOriginECC, key: x509.ECDSA, wildcard: true},
+		{name: "dual-stack", reqType: v1.RequestTypeOriginECC, key: x509.ECDSA, dualStack: true},
+		{name: "zone resolution", reqType: v1.RequestTypeOriginECC, key: x509.ECDSA, zones: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tt.zones && len(creds.APIToken) == 0 {
+				t.Skip("service keys can't find zones")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+
+			hostname := liveHostname(t, zone)
+			hostnames := []string{hostname}
+			if tt.wildcard {
+				hostnames = append(hostnames, "*."+hostname)
+			}
+
+			csr, _, err := cmgen.CSR(tt.key, cmgen.SetCSRDNSNames(hostnames...))
+			assert.NilError(t, err)
+			cr := issuertesting.CertificateRequest("default", "e2e",
+				cmgen.SetCertificateRequestCSR(csr),
+				cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 7 * 24 * time.Hour}),
+			)
+
+			opts := []Option{WithDualStack(tt.dualStack)}
+			if tt.zones {
+				opts = append(opts, WithZoneResolution(client, client), WithActiveZones())
+			}
+			provisioner, err := New(client, tt.reqType, logr.Discard(), opts...)
+			assert.NilError(t, err)
+
+			resps, err := provisioner.Sign(ctx, cr)
+			assert.NilError(t, err)
+
+			// Certificates are revoked even when the case fails.
+			revoked := make(map[string]bool)
+			t.Cleanup(func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+
+				for _, resp := range resps {
+					if revoked[resp.Id] {
+						continue
+					}
+					if err := client.Revoke(ctx, resp.Id); err != nil {
+						t.Errorf("revoking certificate %s: %v", resp.Id, err)
+					}
+				}
+			})
+
+			assert.DeepEqual(t, requestTypesOf(resps), provisioner.RequestTypes())
+			for _, resp := range resps {
+				block, _ := pem.Decode([]byte(resp.Certificate))
+				assert.Assert(t, block != nil, "certificate %s is not PEM encoded", resp.Id)
+				leaf, err := x509.ParseCertificate(block.Bytes)
+				assert.NilError(t, err)
+
+				root, err := roots.Root(context.Background(), resp.Type)
+				assert.NilError(t, err)
+				pool := x509.NewCertPool()
+				assert.Assert(t, pool.AppendCertsFromPEM(root), "no root of request type %s", resp.Type)
+				for _, name := range hostnames {
+					_, err := leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: name})
+					assert.NilError(t, err, "certificate %s of request type %s", resp.Id, resp.Type)
+				}
+				assert.Assert(t, resp.Expiration.After(time.Now()))
+
+				if zoneID != "" {
+					assert.Assert(t, listed(ctx, t, client, zoneID, resp.Id), "certificate %s not listed in zone %s", resp.Id, zoneID)
+				}
+			}
+
+			for _, resp := range resps {
+				assert.NilError(t, client.Revoke(ctx, resp.Id))
+				revoked[resp.Id] = true
+			}
+		})
+	}
+}
+
+func requestTypesOf(resps []*cfapi.SignResponse) []string {
+	types := make([]string, 0, len(resps))
+	for _, resp := range resps {
+		types = append(types, resp.Type)
+	}
+
+	return types
+}
+
+// listed reports whether the certificate is among those of the zone.
+func listed(ctx context.Context, t *testing.T, client *cfapi.Client, zoneID, id string) bool {
+	t.Helper()
+
+	for page := 1; ; page++ {
+		resp, err := client.List(ctx, &cfapi.ListRequest{ZoneID: zoneID, Page: page, PerPage: 50})
+		assert.NilError(t, err)
+
+		for _, cert := range resp.Certificates {
+			if cert.Id == id {
+				return true
+			}
+		}
+
+		if len(resp.Certificates) == 0 || page*50 >= resp.TotalCount {
+			return false
+		}
+	}
+}
@@ -5,14 +5,24 @@ package provisioners
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"strings"
+	"time"
 
 	certmanager "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/cert-manager/cert-manager/pkg/util/pki"
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/validation"
 	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/clock"
 )
 
 const (
@@ -22,13 +32,75 @@ const (
 
 var allowedValidty = []int{7, 30, 90, 365, 730, 1095, 5475}
 
+// IsSupportedValidity returns true if d is exactly one of the validities
+// supported by Cloudflare.
+func IsSupportedValidity(d time.Duration) bool {
+	for _, v := range allowedValidty {
+		if days(v) == d {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Provisioner allows for CertificateRequests to be signed using the stored
 // Cloudflare API client.
 type Provisioner struct {
 	client Signer
 	log    logr.Logger
 
-	reqType v1.RequestType
+	reqType      v1.RequestType
+	dualStack    bool
+	matchKeyType bool
+	hostnames    []string
+
+	minDuration     *metav1.Duration
+	maxDuration     *metav1.Duration
+	defaultDuration *metav1.Duration
+	durationPolicy  v1.DurationPolicy
+
+	revoker Revoker
+	zoneID  string
+
+	wildcardThreshold  int
+	collapseToWildcard bool
+
+	allowedNames []string
+	allowedZones []string
+
+	zones              cfapi.ZoneFinder
+	zoneLister         Lister
+	requireActiveZones bool
+
+	duplicatePolicy v1.DuplicatePolicy
+	lister          Lister
+	previous        map[string]bool
+	listZoneID      string
+	clock           clock.PassiveClock
+
+	dryRun bool
+}
+
+// Option configures optional behaviour of a Provisioner.
+type Option func(p *Provisioner)
+
+// WithDualStack signs every CertificateRequest with both the RSA and ECC
+// Origin CA, rather than only the one selected by the request type.
+func WithDualStack(dualStack bool) Option {
+	return func(p *Provisioner) {
+		p.dualStack = dualStack
+	}
+}
+
+// WithHostnames signs every CertificateRequest for the hostnames, rather than
+// for the DNS names of its CSR, whose subject alternative names are then
+// ignored, such as the SPIFFE ID of an Istio proxy. Origin CA certificates
+// are only issued for the hostnames requested.
+func WithHostnames(hostnames ...string) Option {
+	return func(p *Provisioner) {
+		p.hostnames = hostnames
+	}
 }
 
 // Signer implements the Origin CA signing API.
@@ -36,54 +108,474 @@ type Signer interface {
 	Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error)
 }
 
+// Revoker implements the Origin CA API to list and revoke certificates.
+type Revoker interface {
+	List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// WithRevokeSuperseded configures RevokeSuperseded to revoke the certificates
+// of the zone superseded by signed ones.
+func WithRevokeSuperseded(client Revoker, zoneID string) Option {
+	return func(p *Provisioner) {
+		p.revoker = client
+		p.zoneID = zoneID
+	}
+}
+
+// WithDurations limits the validities the provisioner may request to those
+// between min and max, and requests def for CertificateRequests without a
+// duration. Nil durations are ignored.
+func WithDurations(min, max, def *metav1.Duration) Option {
+	return func(p *Provisioner) {
+		p.minDuration = min
+		p.maxDuration = max
+		p.defaultDuration = def
+	}
+}
+
+// WithDurationPolicy selects how requested durations are rounded to a
+// validity supported by Cloudflare. The empty policy rounds to the closest
+// validity.
+func WithDurationPolicy(policy v1.DurationPolicy) Option {
+	return func(p *Provisioner) {
+		p.durationPolicy = policy
+	}
+}
+
 // New returns a new provisioner.
-func New(client Signer, reqType v1.RequestType, log logr.Logger) (*Provisioner, error) {
+func New(client Signer, reqType v1.RequestType, log logr.Logger, opts ...Option) (*Provisioner, error) {
 	p := &Provisioner{
 		client:  client,
 		log:     log,
 		reqType: reqType,
 	}
 
+	for _, opt := range opts {
+		opt(p)
+	}
+
 	return p, nil
 }
 
+// ErrInvalidRequest is matched, using errors.Is, by the errors of signing a
+// CertificateRequest that can never be signed as requested, such as one with
+// a malformed CSR, or unsupported hostnames or duration. No call to the
+// Cloudflare API is made for such requests.
+var ErrInvalidRequest = errors.New("invalid certificate request")
+
+// invalidRequestError marks an error as an ErrInvalidRequest, keeping its
+// message.
+type invalidRequestError struct {
+	err error
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidRequestError) Unwrap() error {
+	return e.err
+}
+
+func (e *invalidRequestError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// UnsupportedSANError is returned when signing a CSR with subject alternative
+// names other than DNS names, such as IP addresses, email addresses or URIs,
+// which Origin CA certificates can't be issued for.
+type UnsupportedSANError struct {
+	Errs field.ErrorList
+}
+
+func (e *UnsupportedSANError) Error() string {
+	return fmt.Sprintf("invalid subject alternative names: %v", e.Errs.ToAggregate())
+}
+
+func (e *UnsupportedSANError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// UnsupportedKeyError is returned when signing a CSR whose public key the
+// Origin CA can't sign certificates for, such as an ECDSA key on the P-521
+// curve.
+type UnsupportedKeyError struct {
+	Errs field.ErrorList
+}
+
+func (e *UnsupportedKeyError) Error() string {
+	return fmt.Sprintf("invalid public key: %v", e.Errs.ToAggregate())
+}
+
+func (e *UnsupportedKeyError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
 // Sign uses the Cloduflare API to sign a CertificateRequest. The validity of the CertificateRequest is
-// normalized to the closests validity allowed by the Cloudflare API, which make be significantly different
-// than the validity provided.
-func (p *Provisioner) Sign(ctx context.Context, cr *certmanager.CertificateRequest) (certPem []byte, err error) {
+// normalized to a validity allowed by the Cloudflare API following the duration policy, which may be
+// significantly different than the validity provided. A response, with the signed certificate and its Cloudflare ID, is returned
+// for each requested signature type; dual-stack provisioners return the certificate of the configured
+// request type first. Existing certificates are returned instead of signing new ones when configured
+// WithDuplicatePolicy to reuse them. Nothing is signed WithDryRun.
+func (p *Provisioner) Sign(ctx context.Context, cr *certmanager.CertificateRequest) ([]*cfapi.SignResponse, error) {
+	req, err := p.request(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	reused, err := p.duplicates(ctx, req.hostnames, req.csr.RawSubjectPublicKeyInfo, req.duration)
+	if err != nil {
+		return nil, err
+	}
+
+	reqTypes := p.RequestTypes()
+	resps := make([]*cfapi.SignResponse, 0, len(reqTypes))
+	for _, reqType := range reqTypes {
+		if resp, ok := reused[reqType]; ok {
+			p.log.Info("reusing existing certificate issued for the same key and hostnames", "id", resp.Id, "request_type", reqType)
+			resps = append(resps, resp)
+
+			continue
+		}
+
+		resp, err := p.client.Sign(ctx, &cfapi.SignRequest{
+			Hostnames: req.hostnames,
+			Validity:  req.duration,
+			Type:      reqType,
+			CSR:       req.csrPEM,
+		})
+
+		// Certificates already signed for a dual-stack request are not
+		// returned on failure, and will be signed again on retry, so are
+		// revoked rather than left unrecorded until they expire.
+		if err != nil {
+			p.revokeSigned(ctx, resps, reused)
+
+			return nil, fmt.Errorf("unable to sign request: %w", err)
+		}
+
+		resps = append(resps, resp)
+	}
+
+	return resps, nil
+}
+
+// Check validates the CertificateRequest against the issuer's policies, such
+// as its allowed hostnames, key type and zones, returning the error Sign would
+// without signing anything. It is used before publishing a certificate signed
+// for an earlier request, which must still be allowed for this one.
+func (p *Provisioner) Check(ctx context.Context, cr *certmanager.CertificateRequest) error {
+	_, err := p.request(ctx, cr)
+
+	return err
+}
+
+// signRequest is a validated CertificateRequest, as signed for every request
+// type.
+type signRequest struct {
+	csr       *x509.CertificateRequest
+	hostnames []string
+	csrPEM    string
+	duration  int
+}
+
+// request validates the CertificateRequest against the issuer's policies and
+// returns what to sign for it.
+func (p *Provisioner) request(ctx context.Context, cr *certmanager.CertificateRequest) (*signRequest, error) {
 	csr, err := pki.DecodeX509CertificateRequestBytes(cr.Spec.Request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode CSR for signing: %s", err)
+		return nil, &invalidRequestError{fmt.Errorf("failed to decode CSR for signing: %w", err)}
 	}
 
-	hostnames := csr.DNSNames
-	var duration int
-	if cr.Spec.Duration == nil {
-		duration = DefaultDurationInternval
-	} else {
-		duration = closest(int(cr.Spec.Duration.Duration.Hours()/24), allowedValidty)
+	names := p.hostnames
+	if names == nil {
+		if errs := validation.ValidateCSRSubjectAltNames(csr, field.NewPath("spec", "request")); len(errs) > 0 {
+			return nil, &UnsupportedSANError{Errs: errs}
+		}
+
+		names = csr.DNSNames
 	}
 
-	var reqType string
-	switch p.reqType {
-	case v1.RequestTypeOriginECC:
-		reqType = "origin-ecc"
-	case v1.RequestTypeOriginRSA:
-		reqType = "origin-rsa"
+	if errs := validation.ValidateCSRPublicKey(csr, field.NewPath("spec", "request")); len(errs) > 0 {
+		return nil, &UnsupportedKeyError{Errs: errs}
+	}
+
+	if errs := validation.ValidateCSRSignature(csr, field.NewPath("spec", "request")); len(errs) > 0 {
+		return nil, &invalidRequestError{fmt.Errorf("invalid CSR: %w", errs.ToAggregate())}
+	}
+
+	if err := p.checkKeyType(csr); err != nil {
+		return nil, err
+	}
+
+	hostnames := validation.NormalizeHostnames(names)
+	if p.collapseToWildcard {
+		hostnames = collapseToWildcards(hostnames, wildcardCandidates(hostnames, p.wildcardThreshold))
+	}
+
+	if errs := validation.ValidateHostnames(hostnames, field.NewPath("spec", "request", "dnsNames")); len(errs) > 0 {
+		return nil, &invalidRequestError{fmt.Errorf("invalid hostnames: %w", errs.ToAggregate())}
+	}
+
+	if err := p.checkAllowedHostnames(hostnames); err != nil {
+		return nil, err
 	}
 
-	resp, err := p.client.Sign(ctx, &cfapi.SignRequest{
-		Hostnames: hostnames,
-		Validity:  duration,
-		Type:      reqType,
-		CSR:       string(cr.Spec.Request),
+	// Requests for the same hostnames and key are sent as identical
+	// payloads, regardless of the order of the hostnames or the encoding of
+	// the CSR.
+	slices.Sort(hostnames)
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw}))
+
+	duration, err := p.validity(cr.Spec.Duration)
+	if err != nil {
+		return nil, &invalidRequestError{err}
+	}
+
+	if p.dryRun {
+		return nil, p.dryRunError(hostnames, duration, csrPEM)
+	}
+
+	if p.zones != nil {
+		if err := p.checkZones(ctx, hostnames); err != nil {
+			return nil, err
+		}
+	}
+
+	return &signRequest{csr: csr, hostnames: hostnames, csrPEM: csrPEM, duration: duration}, nil
+}
+
+// revokeSigned revokes the certificates signed for a request that failed to
+// be signed with every request type, other than the reused ones, with a
+// signer that can revoke them. Failures are only logged.
+func (p *Provisioner) revokeSigned(ctx context.Context, resps []*cfapi.SignResponse, reused map[string]*cfapi.SignResponse) {
+	revoker, ok := p.client.(interface {
+		Revoke(ctx context.Context, id string) error
 	})
+	if !ok {
+		return
+	}
 
+	// The request may have failed on its deadline, which should not prevent
+	// the revocations.
+	ctx = context.WithoutCancel(ctx)
+	for _, resp := range resps {
+		if reused[resp.Type] == resp {
+			continue
+		}
+
+		if err := revoker.Revoke(ctx, resp.Id); err != nil {
+			p.log.Error(err, "failed to revoke certificate of a request that failed to be signed", "id", resp.Id, "request_type", resp.Type)
+
+			continue
+		}
+
+		p.log.Info("revoked certificate of a request that failed to be signed", "id", resp.Id, "request_type", resp.Type)
+	}
+}
+
+// WildcardCandidates returns the parent domains, such as example.com, of at
+// least the wildcard threshold of the CertificateRequest's hostnames, which a
+// wildcard certificate would cover. Nothing is returned unless configured
+// WithWildcardPolicy.
+func (p *Provisioner) WildcardCandidates(cr *certmanager.CertificateRequest) ([]string, error) {
+	if p.wildcardThreshold <= 0 {
+		return nil, nil
+	}
+
+	csr, err := pki.DecodeX509CertificateRequestBytes(cr.Spec.Request)
 	if err != nil {
-		return nil, fmt.Errorf("unable to sign request: %w", err)
+		return nil, &invalidRequestError{fmt.Errorf("failed to decode CSR: %w", err)}
+	}
+
+	return wildcardCandidates(validation.NormalizeHostnames(csr.DNSNames), p.wildcardThreshold), nil
+}
+
+// listPageSize is the number of certificates listed per call by
+// RevokeSuperseded.
+const listPageSize = 50
+
+// RevokeSuperseded revokes the unexpired Origin CA certificates of the zone
+// of earlier revisions of the same Certificate, set WithPreviousCertificates,
+// which the signed certificates supersede. The signed certificates
+// themselves, such as reused ones, are kept, and certificates issued by other
+// means for the same hostnames are left alone. The IDs of the revoked
+// certificates are returned, including on failure. It does nothing unless
+// configured WithRevokeSuperseded.
+func (p *Provisioner) RevokeSuperseded(ctx context.Context, signed []*cfapi.SignResponse) ([]string, error) {
+	if p.revoker == nil {
+		return nil, nil
+	}
+
+	superseded, err := p.Superseded(ctx, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := make([]string, 0, len(superseded))
+	for _, id := range superseded {
+		if err := p.revoker.Revoke(ctx, id); err != nil {
+			return revoked, fmt.Errorf("unable to revoke superseded certificate %s: %w", id, err)
+		}
+
+		revoked = append(revoked, id)
+	}
+
+	return revoked, nil
+}
+
+// Superseded returns the IDs of the certificates RevokeSuperseded would
+// revoke, without revoking them. It returns nothing unless configured
+// WithRevokeSuperseded.
+func (p *Provisioner) Superseded(ctx context.Context, signed []*cfapi.SignResponse) ([]string, error) {
+	if p.revoker == nil {
+		return nil, nil
+	}
+
+	// The zone is listed in full before revoking, as revoking shifts the
+	// following pages. Certificates already revoked or expired are no
+	// longer listed.
+	var superseded []string
+	for page, seen := 1, 0; ; page++ {
+		resp, err := p.revoker.List(ctx, &cfapi.ListRequest{ZoneID: p.zoneID, Page: page, PerPage: listPageSize})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list certificates of zone %s: %w", p.zoneID, err)
+		}
+
+		for _, cert := range resp.Certificates {
+			if p.previous[cert.Id] && !slices.ContainsFunc(signed, func(s *cfapi.SignResponse) bool { return s.Id == cert.Id }) {
+				superseded = append(superseded, cert.Id)
+			}
+		}
+
+		seen += len(resp.Certificates)
+		if len(resp.Certificates) == 0 || seen >= resp.TotalCount {
+			break
+		}
+	}
+
+	return superseded, nil
+}
+
+// sameHostnames reports whether a and b hold the same hostnames, in any
+// order.
+func sameHostnames(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// RequestTypes returns the Cloudflare API request types, such as
+// "origin-rsa", each CertificateRequest is signed as, in the order Sign
+// returns their certificates.
+func (p *Provisioner) RequestTypes() []string {
+	return RequestTypes(p.reqType, p.dualStack)
+}
+
+// RequestTypes returns the Cloudflare API request types an issuer of the
+// request type signs CertificateRequests as, including the other request
+// type for dual-stack issuers.
+func RequestTypes(reqType v1.RequestType, dualStack bool) []string {
+	reqTypes := []string{requestType(reqType)}
+	if dualStack {
+		switch reqType {
+		case v1.RequestTypeOriginECC:
+			reqTypes = append(reqTypes, requestType(v1.RequestTypeOriginRSA))
+		case v1.RequestTypeOriginRSA:
+			reqTypes = append(reqTypes, requestType(v1.RequestTypeOriginECC))
+		}
+	}
+
+	return reqTypes
+}
+
+// requestType maps the request type of an issuer to the one used by the
+// Cloudflare API.
+func requestType(t v1.RequestType) string {
+	switch t {
+	case v1.RequestTypeOriginECC:
+		return "origin-ecc"
+	case v1.RequestTypeOriginRSA:
+		return "origin-rsa"
+	}
+
+	return ""
+}
+
+// validity returns the validity, in days, to request for a certificate of the
+// given duration: the validity supported by Cloudflare, and allowed by the
+// provisioner's bounds, selected by the duration policy.
+func (p *Provisioner) validity(duration *metav1.Duration) (int, error) {
+	if duration == nil {
+		duration = p.defaultDuration
+	}
+
+	requested := DefaultDurationInternval * 24 * time.Hour
+	if duration != nil {
+		requested = duration.Duration
+	}
+
+	var valid []int
+	for _, v := range allowedValidty {
+		d := days(v)
+		if p.minDuration != nil && d < p.minDuration.Duration {
+			continue
+		}
+
+		if p.maxDuration != nil && d > p.maxDuration.Duration {
+			continue
+		}
+
+		valid = append(valid, v)
+	}
+
+	if len(valid) == 0 {
+		return 0, fmt.Errorf("no validity supported by Cloudflare is within the issuer's bounds: minDuration=%s maxDuration=%s", durationString(p.minDuration), durationString(p.maxDuration))
+	}
+
+	switch p.durationPolicy {
+	case v1.DurationPolicyRoundUp:
+		for _, v := range valid {
+			if days(v) >= requested {
+				return v, nil
+			}
+		}
+
+		return 0, fmt.Errorf("duration %s is longer than any validity supported by Cloudflare within the issuer's bounds, the longest is %d days", requested, valid[len(valid)-1])
+	case v1.DurationPolicyRoundDown:
+		for i := len(valid) - 1; i >= 0; i-- {
+			if days(valid[i]) <= requested {
+				return valid[i], nil
+			}
+		}
+
+		return 0, fmt.Errorf("duration %s is shorter than any validity supported by Cloudflare within the issuer's bounds, the shortest is %d days", requested, valid[0])
+	case v1.DurationPolicyStrict:
+		for _, v := range valid {
+			if days(v) == requested {
+				return v, nil
+			}
+		}
+
+		return 0, fmt.Errorf("duration %s is not a validity supported by Cloudflare within the issuer's bounds, supported validities in days are %s", requested, strings.Trim(fmt.Sprint(valid), "[]"))
+	default:
+		return closest(int(requested.Hours()/24), valid), nil
+	}
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+func durationString(d *metav1.Duration) string {
+	if d == nil {
+		return "none"
 	}
 
-	return []byte(resp.Certificate), nil
+	return d.Duration.String()
 }
 
 func closest(of int, valid []int) int {
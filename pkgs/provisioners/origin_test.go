@@ -1,9 +1,19 @@
 package provisioners
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"testing"
 	"testing/quick"
 	"time"
@@ -12,6 +22,7 @@ import (
 	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
 	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
 	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
 	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
@@ -43,7 +54,8 @@ func TestSign(t *testing.T) {
 
 		res, err := provisioner.Sign(ctx, tc.req)
 		assert.NilError(t, err)
-		assert.DeepEqual(t, res, tc.expected)
+		assert.Equal(t, len(res), 1)
+		assert.DeepEqual(t, []byte(res[0].Certificate), tc.expected)
 	}
 
 	testCases := []testCase{
@@ -140,6 +152,96 @@ func TestSign(t *testing.T) {
 	}
 }
 
+func TestSign_DualStack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		return &cfapi.SignResponse{
+			Id:          req.Type,
+			Certificate: "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n",
+		}, nil
+	})
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR((func() []byte {
+			csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"))
+			assert.NilError(t, err)
+
+			return csr
+		})()),
+	)
+
+	tests := []struct {
+		name     string
+		reqType  v1.RequestType
+		expected []string
+	}{
+		{
+			name:     "origin ecc",
+			reqType:  v1.RequestTypeOriginECC,
+			expected: []string{"origin-ecc", "origin-rsa"},
+		},
+		{
+			name:     "origin rsa",
+			reqType:  v1.RequestTypeOriginRSA,
+			expected: []string{"origin-rsa", "origin-ecc"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			provisioner, err := New(signer, tt.reqType, logr.Discard(), WithDualStack(true))
+			assert.NilError(t, err)
+
+			res, err := provisioner.Sign(ctx, req)
+			assert.NilError(t, err)
+
+			var got []string
+			for _, r := range res {
+				got = append(got, r.Id)
+			}
+			assert.DeepEqual(t, got, tt.expected)
+		})
+	}
+}
+
+// revokingSigner signs the request types it is given certificates of, and
+// records the certificates revoked.
+type revokingSigner struct {
+	certificates map[string]string
+	revoked      []string
+}
+
+func (s *revokingSigner) Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+	id, ok := s.certificates[req.Type]
+	if !ok {
+		return nil, errors.New("cfapi error")
+	}
+
+	return &cfapi.SignResponse{Id: id, Type: req.Type}, nil
+}
+
+func (s *revokingSigner) Revoke(ctx context.Context, id string) error {
+	s.revoked = append(s.revoked, id)
+
+	return nil
+}
+
+func TestSign_DualStackPartialFailure(t *testing.T) {
+	req := issuertesting.CertificateRequest("default", "foobar")
+
+	signer := &revokingSigner{certificates: map[string]string{"origin-ecc": "ecc"}}
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithDualStack(true))
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.Error(t, err, "unable to sign request: cfapi error")
+	assert.DeepEqual(t, signer.revoked, []string{"ecc"})
+}
+
 func TestSign_Error(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -163,6 +265,321 @@ func TestSign_Error(t *testing.T) {
 
 	_, err = provisioner.Sign(ctx, req)
 	assert.Error(t, err, "unable to sign request: cfapi error")
+	assert.Assert(t, !errors.Is(err, ErrInvalidRequest), "expected API errors not to be invalid requests")
+}
+
+func TestSign_InvalidHostnames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		t.Fatal("unexpected call to the Cloudflare API")
+		return nil, nil
+	})
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR((func() []byte {
+			csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com", "*.*.example.com"))
+			assert.NilError(t, err)
+
+			return csr
+		})()),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(ctx, req)
+	assert.Error(t, err, `invalid hostnames: spec.request.dnsNames[1]: Invalid value: "*.*.example.com": wildcard may only cover one level, such as *.example.com`)
+	assert.Assert(t, errors.Is(err, ErrInvalidRequest), "expected ErrInvalidRequest, got %v", err)
+}
+
+func TestSign_InvalidSubjectAltNames(t *testing.T) {
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		t.Fatal("unexpected call to the Cloudflare API")
+		return nil, nil
+	})
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR((func() []byte {
+			csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("example.com"), cmgen.SetCSRIPAddresses(net.ParseIP("192.0.2.1")))
+			assert.NilError(t, err)
+
+			return csr
+		})()),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.Error(t, err, "invalid subject alternative names: spec.request.ipAddresses: Forbidden: Origin CA certificates can only be issued for DNS names")
+
+	var unsupported *UnsupportedSANError
+	assert.Assert(t, errors.As(err, &unsupported), "expected UnsupportedSANError, got %T", err)
+	assert.Assert(t, errors.Is(err, ErrInvalidRequest), "expected ErrInvalidRequest, got %v", err)
+}
+
+func TestSign_Hostnames(t *testing.T) {
+	var hostnames []string
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		hostnames = req.Hostnames
+		return &cfapi.SignResponse{Id: "1"}, nil
+	})
+
+	spiffeID, err := url.Parse("spiffe://cluster.local/ns/default/sa/httpbin")
+	assert.NilError(t, err)
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR((func() []byte {
+			csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRURIs(spiffeID))
+			assert.NilError(t, err)
+
+			return csr
+		})()),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithHostnames("httpbin.default.mesh.example.com"))
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hostnames, []string{"httpbin.default.mesh.example.com"})
+}
+
+func TestSign_UnsupportedKey(t *testing.T) {
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		t.Fatal("unexpected call to the Cloudflare API")
+		return nil, nil
+	})
+
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.NilError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+	assert.NilError(t, err)
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.Error(t, err, `invalid public key: spec.request.publicKey.curve: Unsupported value: "P-521": supported values: "P-256", "P-384"`)
+
+	var unsupported *UnsupportedKeyError
+	assert.Assert(t, errors.As(err, &unsupported), "expected UnsupportedKeyError, got %T", err)
+	assert.Assert(t, errors.Is(err, ErrInvalidRequest), "expected ErrInvalidRequest, got %v", err)
+}
+
+func TestSign_InvalidCSR(t *testing.T) {
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		t.Fatal("unexpected call to the Cloudflare API")
+		return nil, nil
+	})
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR([]byte("not a CSR")),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.ErrorContains(t, err, "failed to decode CSR for signing: ")
+	assert.Assert(t, errors.Is(err, ErrInvalidRequest), "expected ErrInvalidRequest, got %v", err)
+	assert.Assert(t, errors.Unwrap(errors.Unwrap(err)) != nil, "expected the decoding error to be wrapped")
+}
+
+func TestSign_NormalizedHostnames(t *testing.T) {
+	var hostnames []string
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		hostnames = req.Hostnames
+		return &cfapi.SignResponse{Id: "1"}, nil
+	})
+
+	req := cmgen.CertificateRequest("foobar",
+		cmgen.SetCertificateRequestNamespace("default"),
+		cmgen.SetCertificateRequestCSR((func() []byte {
+			csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("Example.com.", "*.example.com", "example.com"))
+			assert.NilError(t, err)
+
+			return csr
+		})()),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hostnames, []string{"*.example.com", "example.com"})
+}
+
+func TestSign_DeterministicPayload(t *testing.T) {
+	var payloads []string
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		p, err := json.Marshal(req)
+		assert.NilError(t, err)
+
+		payloads = append(payloads, string(p))
+		return &cfapi.SignResponse{Id: "1"}, nil
+	})
+
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames("b.example.com", "a.example.com"))
+	assert.NilError(t, err)
+
+	block, _ := pem.Decode(csr)
+	assert.Assert(t, block != nil)
+
+	// The same CSR, PEM encoded with headers and without a trailing
+	// newline.
+	reencoded := pem.EncodeToMemory(&pem.Block{Type: block.Type, Headers: map[string]string{"Comment": "renewal"}, Bytes: block.Bytes})
+	reencoded = bytes.TrimSuffix(reencoded, []byte("\n"))
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	for _, request := range [][]byte{csr, reencoded} {
+		_, err = provisioner.Sign(context.Background(), cmgen.CertificateRequest("foobar", cmgen.SetCertificateRequestCSR(request)))
+		assert.NilError(t, err)
+	}
+
+	assert.Equal(t, len(payloads), 2)
+	assert.Equal(t, payloads[0], payloads[1])
+	assert.Assert(t, strings.Contains(payloads[0], `"hostnames":["a.example.com","b.example.com"]`), payloads[0])
+}
+
+func TestValidity(t *testing.T) {
+	days := func(n int) *metav1.Duration {
+		return &metav1.Duration{Duration: time.Duration(n) * 24 * time.Hour}
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		duration *metav1.Duration
+		expected int
+		error    string
+	}{
+		{
+			name:     "default",
+			expected: 7,
+		},
+		{
+			name:     "closest",
+			duration: days(60),
+			expected: 30,
+		},
+		{
+			name:     "issuer default",
+			opts:     []Option{WithDurations(nil, nil, days(90))},
+			expected: 90,
+		},
+		{
+			name:     "clamped to maximum",
+			opts:     []Option{WithDurations(nil, days(90), nil)},
+			duration: days(5475),
+			expected: 90,
+		},
+		{
+			name:     "clamped to minimum",
+			opts:     []Option{WithDurations(days(30), nil, nil)},
+			duration: days(1),
+			expected: 30,
+		},
+		{
+			name:     "default clamped",
+			opts:     []Option{WithDurations(days(365), nil, nil)},
+			expected: 365,
+		},
+		{
+			name:  "no validity within bounds",
+			opts:  []Option{WithDurations(days(8), days(29), nil)},
+			error: "no validity supported by Cloudflare is within the issuer's bounds: minDuration=192h0m0s maxDuration=696h0m0s",
+		},
+		{
+			name:  "no validity below maximum",
+			opts:  []Option{WithDurations(nil, days(1), nil)},
+			error: "no validity supported by Cloudflare is within the issuer's bounds: minDuration=none maxDuration=24h0m0s",
+		},
+		{
+			name:     "round up",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyRoundUp)},
+			duration: days(31),
+			expected: 90,
+		},
+		{
+			name:     "round up partial day",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyRoundUp)},
+			duration: &metav1.Duration{Duration: 7*24*time.Hour + time.Minute},
+			expected: 30,
+		},
+		{
+			name:     "round up exact",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyRoundUp)},
+			duration: days(30),
+			expected: 30,
+		},
+		{
+			name:     "round up beyond maximum",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyRoundUp), WithDurations(nil, days(90), nil)},
+			duration: days(91),
+			error:    "duration 2184h0m0s is longer than any validity supported by Cloudflare within the issuer's bounds, the longest is 90 days",
+		},
+		{
+			name:     "round down",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyRoundDown)},
+			duration: days(89),
+			expected: 30,
+		},
+		{
+			name:     "round down below minimum",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyRoundDown)},
+			duration: days(1),
+			error:    "duration 24h0m0s is shorter than any validity supported by Cloudflare within the issuer's bounds, the shortest is 7 days",
+		},
+		{
+			name:     "strict",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyStrict)},
+			duration: days(365),
+			expected: 365,
+		},
+		{
+			name:     "strict default",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyStrict)},
+			expected: 7,
+		},
+		{
+			name:     "strict mismatch",
+			opts:     []Option{WithDurationPolicy(v1.DurationPolicyStrict), WithDurations(nil, days(365), nil)},
+			duration: days(60),
+			error:    "duration 1440h0m0s is not a validity supported by Cloudflare within the issuer's bounds, supported validities in days are 7 30 90 365",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(nil, v1.RequestTypeOriginECC, logr.Discard(), tt.opts...)
+			assert.NilError(t, err)
+
+			got, err := p.validity(tt.duration)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.expected)
+		})
+	}
 }
 
 func TestClosest(t *testing.T) {
@@ -190,3 +607,112 @@ type SignerFunc func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignRe
 func (f SignerFunc) Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
 	return f(ctx, req)
 }
+
+func TestIsSupportedValidity(t *testing.T) {
+	assert.Assert(t, IsSupportedValidity(7*24*time.Hour))
+	assert.Assert(t, IsSupportedValidity(5475*24*time.Hour))
+	assert.Assert(t, !IsSupportedValidity(8*24*time.Hour))
+	assert.Assert(t, !IsSupportedValidity(7*24*time.Hour+time.Second))
+	assert.Assert(t, !IsSupportedValidity(0))
+}
+
+// fakeZone lists a fixed set of certificates, and removes revoked ones.
+type fakeZone struct {
+	certificates []cfapi.SignResponse
+	revokeErr    error
+	revoked      []string
+}
+
+func (z *fakeZone) List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error) {
+	start := min((req.Page-1)*req.PerPage, len(z.certificates))
+	end := min(start+req.PerPage, len(z.certificates))
+
+	return &cfapi.ListResponse{Certificates: z.certificates[start:end], TotalCount: len(z.certificates)}, nil
+}
+
+func (z *fakeZone) Revoke(ctx context.Context, id string) error {
+	if z.revokeErr != nil {
+		return z.revokeErr
+	}
+
+	z.revoked = append(z.revoked, id)
+	return nil
+}
+
+func TestRevokeSuperseded(t *testing.T) {
+	signed := []*cfapi.SignResponse{
+		{Id: "new", Hostnames: []string{"example.com", "*.example.com"}, Type: "origin-ecc"},
+	}
+
+	// Pad the zone beyond a single page of certificates.
+	var certificates []cfapi.SignResponse
+	for i := 0; i < listPageSize; i++ {
+		certificates = append(certificates, cfapi.SignResponse{Id: fmt.Sprintf("other-%d", i), Hostnames: []string{fmt.Sprintf("%d.example.net", i)}, Type: "origin-ecc"})
+	}
+	certificates = append(certificates,
+		cfapi.SignResponse{Id: "new", Hostnames: []string{"example.com", "*.example.com"}, Type: "origin-ecc"},
+		cfapi.SignResponse{Id: "old", Hostnames: []string{"*.example.com", "example.com"}, Type: "origin-ecc"},
+		cfapi.SignResponse{Id: "rsa", Hostnames: []string{"example.com", "*.example.com"}, Type: "origin-rsa"},
+		cfapi.SignResponse{Id: "subset", Hostnames: []string{"example.com"}, Type: "origin-ecc"},
+		cfapi.SignResponse{Id: "older", Hostnames: []string{"example.com", "*.example.com"}, Type: "origin-ecc"},
+	)
+
+	tests := []struct {
+		name      string
+		revokeErr error
+		expected  []string
+		error     string
+	}{
+		{
+			name:     "revoked",
+			expected: []string{"old", "older"},
+		},
+		{
+			name:      "revoke error",
+			revokeErr: errors.New("cfapi error"),
+			expected:  []string{},
+			error:     "unable to revoke superseded certificate old: cfapi error",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			zone := &fakeZone{certificates: certificates, revokeErr: tt.revokeErr}
+
+			// Only certificates of earlier revisions are superseded, other
+			// than those signed, or reused, for the request, and those no
+			// longer listed.
+			provisioner, err := New(SignerFunc(nil), v1.RequestTypeOriginECC, logr.Discard(),
+				WithRevokeSuperseded(zone, "023e105f4ecef8ad9ca31a8372d0c353"),
+				WithPreviousCertificates("older", "new", "old", "expired"),
+			)
+			assert.NilError(t, err)
+
+			revoked, err := provisioner.RevokeSuperseded(context.Background(), signed)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			assert.DeepEqual(t, revoked, tt.expected)
+			assert.DeepEqual(t, zone.revoked, tt.expected, cmpopts.EquateEmpty())
+
+			zone.revoked = nil
+			superseded, err := provisioner.Superseded(context.Background(), signed)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, superseded, []string{"old", "older"})
+			assert.Equal(t, len(zone.revoked), 0)
+		})
+	}
+}
+
+func TestRevokeSuperseded_Disabled(t *testing.T) {
+	provisioner, err := New(SignerFunc(nil), v1.RequestTypeOriginECC, logr.Discard())
+	assert.NilError(t, err)
+
+	revoked, err := provisioner.RevokeSuperseded(context.Background(), []*cfapi.SignResponse{{Id: "new"}})
+	assert.NilError(t, err)
+	assert.Assert(t, revoked == nil)
+}
@@ -0,0 +1,83 @@
+package provisioners
+
+import (
+	"slices"
+	"strings"
+)
+
+// WithWildcardPolicy reports the parent domains of at least threshold of a
+// CertificateRequest's hostnames as wildcard candidates, and replaces those
+// hostnames by wildcards of their parent domain when signing if collapse is
+// set. Disabled when threshold is zero.
+func WithWildcardPolicy(threshold int, collapse bool) Option {
+	return func(p *Provisioner) {
+		p.wildcardThreshold = threshold
+		p.collapseToWildcard = collapse
+	}
+}
+
+// wildcardCandidates returns the parent domains, such as example.com, of at
+// least threshold of the hostnames, such as a.example.com and b.example.com,
+// in the order they first appear. Wildcards, and hostnames whose parent is a
+// top-level domain, are ignored. The hostnames must be normalized.
+func wildcardCandidates(hostnames []string, threshold int) []string {
+	if threshold <= 0 {
+		return nil
+	}
+
+	var (
+		parents []string
+		counts  = make(map[string]int)
+	)
+	for _, hostname := range hostnames {
+		parent, ok := wildcardParent(hostname)
+		if !ok {
+			continue
+		}
+
+		if counts[parent] == 0 {
+			parents = append(parents, parent)
+		}
+		counts[parent]++
+	}
+
+	var candidates []string
+	for _, parent := range parents {
+		if counts[parent] >= threshold {
+			candidates = append(candidates, parent)
+		}
+	}
+
+	return candidates
+}
+
+// collapseToWildcards replaces the hostnames of the parent domains by a
+// wildcard of each parent domain, in place of the first of them.
+func collapseToWildcards(hostnames, parents []string) []string {
+	collapsed := make([]string, 0, len(hostnames))
+	seen := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		if parent, ok := wildcardParent(hostname); ok && slices.Contains(parents, parent) {
+			hostname = "*." + parent
+		}
+
+		if !seen[hostname] {
+			seen[hostname] = true
+			collapsed = append(collapsed, hostname)
+		}
+	}
+
+	return collapsed
+}
+
+// wildcardParent returns the domain a wildcard would replace the left-most
+// label of the hostname with, unless the hostname is a wildcard or its parent
+// a top-level domain.
+func wildcardParent(hostname string) (string, bool) {
+	label, parent, ok := strings.Cut(hostname, ".")
+	if !ok || label == "*" || !strings.Contains(parent, ".") {
+		return "", false
+	}
+
+	return parent, true
+}
@@ -0,0 +1,93 @@
+package provisioners
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+)
+
+func TestWildcardCandidates(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostnames []string
+		threshold int
+		expected  []string
+		collapsed []string
+	}{
+		{
+			name:      "disabled",
+			hostnames: []string{"a.example.com", "b.example.com"},
+			collapsed: []string{"a.example.com", "b.example.com"},
+		},
+		{
+			name:      "below threshold",
+			hostnames: []string{"a.example.com", "b.example.com", "a.example.net"},
+			threshold: 3,
+			collapsed: []string{"a.example.com", "b.example.com", "a.example.net"},
+		},
+		{
+			name:      "siblings",
+			hostnames: []string{"example.com", "a.example.com", "a.example.net", "b.example.com", "*.example.com", "c.example.com"},
+			threshold: 3,
+			expected:  []string{"example.com"},
+			collapsed: []string{"example.com", "*.example.com", "a.example.net"},
+		},
+		{
+			name:      "several parents",
+			hostnames: []string{"a.example.net", "a.example.com", "b.example.com", "b.example.net", "a.b.example.com"},
+			threshold: 2,
+			expected:  []string{"example.net", "example.com"},
+			collapsed: []string{"*.example.net", "*.example.com", "a.b.example.com"},
+		},
+		{
+			name:      "top-level domain",
+			hostnames: []string{"example.com", "example.net"},
+			threshold: 2,
+			collapsed: []string{"example.com", "example.net"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := wildcardCandidates(tt.hostnames, tt.threshold)
+			assert.DeepEqual(t, candidates, tt.expected)
+			assert.DeepEqual(t, collapseToWildcards(tt.hostnames, candidates), tt.collapsed)
+		})
+	}
+}
+
+func TestSign_CollapseToWildcard(t *testing.T) {
+	var hostnames []string
+	signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+		hostnames = req.Hostnames
+		return &cfapi.SignResponse{Id: "1"}, nil
+	})
+
+	req := issuertesting.CertificateRequest("default", "foobar",
+		issuertesting.SetCertificateRequestDNSNames("a.example.com", "B.example.com", "example.com"),
+	)
+
+	provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithWildcardPolicy(2, false))
+	assert.NilError(t, err)
+
+	candidates, err := provisioner.WildcardCandidates(req)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, candidates, []string{"example.com"})
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hostnames, []string{"a.example.com", "b.example.com", "example.com"})
+
+	provisioner, err = New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithWildcardPolicy(2, true))
+	assert.NilError(t, err)
+
+	_, err = provisioner.Sign(context.Background(), req)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hostnames, []string{"*.example.com", "example.com"})
+}
@@ -0,0 +1,139 @@
+package provisioners
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+)
+
+// WithZoneResolution configures Sign to resolve the zone of each hostname
+// with the finder before signing, and to check the signing credentials of
+// the lister can manage the Origin CA certificates of each zone. The finder
+// may authenticate with other credentials, such as a verification token.
+func WithZoneResolution(finder cfapi.ZoneFinder, lister Lister) Option {
+	return func(p *Provisioner) {
+		p.zones = finder
+		p.zoneLister = lister
+	}
+}
+
+// WithActiveZones configures Sign, when resolving zones, to fail requests
+// for hostnames of zones that aren't active in Cloudflare, such as paused
+// zones, whose Origin CA certificates would not be served.
+func WithActiveZones() Option {
+	return func(p *Provisioner) {
+		p.requireActiveZones = true
+	}
+}
+
+// ZoneError is returned when the zone of a hostname can't be resolved, or
+// the credentials can't manage the Origin CA certificates of its zone.
+type ZoneError struct {
+	Hostname string
+	Zone     string
+	Err      error
+
+	message string
+}
+
+func (e *ZoneError) Error() string {
+	if e.Err == nil {
+		return e.message
+	}
+
+	return fmt.Sprintf("%s: %v", e.message, e.Err)
+}
+
+func (e *ZoneError) Unwrap() error {
+	return e.Err
+}
+
+// ZoneInactiveError is returned when signing, with WithActiveZones, a
+// request for a hostname of a zone that isn't active, or is paused.
+type ZoneInactiveError struct {
+	Hostname string
+	Zone     string
+	Status   string
+	Paused   bool
+}
+
+func (e *ZoneInactiveError) Error() string {
+	if e.Paused {
+		return fmt.Sprintf("zone %s of hostname %s is paused in Cloudflare", e.Zone, e.Hostname)
+	}
+
+	return fmt.Sprintf("zone %s of hostname %s is %s in Cloudflare, rather than active", e.Zone, e.Hostname, e.Status)
+}
+
+// checkZones resolves the zone of each hostname, from the longest candidate
+// zone name to the shortest, so that hostnames of a subdomain delegated to
+// its own zone resolve to it. Listing the Origin CA certificates of each
+// zone checks the signing credentials were granted the "SSL and
+// Certificates" permission on it.
+func (p *Provisioner) checkZones(ctx context.Context, hostnames []string) error {
+	found := make(map[string]*cfapi.Zone)
+	checked := make(map[string]bool)
+
+	for _, hostname := range hostnames {
+		zone, err := p.zoneOf(ctx, strings.TrimPrefix(hostname, "*."), found)
+		if err != nil {
+			return &ZoneError{Hostname: hostname, Err: err, message: fmt.Sprintf("unable to resolve the Cloudflare zone of hostname %s", hostname)}
+		}
+		if zone == nil {
+			return &ZoneError{Hostname: hostname, message: fmt.Sprintf("hostname %s is not in any Cloudflare zone the API token has a permission on", hostname)}
+		}
+
+		if p.requireActiveZones && !zone.Active() {
+			return &ZoneInactiveError{Hostname: hostname, Zone: zone.Name, Status: zone.Status, Paused: zone.Paused}
+		}
+
+		if checked[zone.ID] {
+			continue
+		}
+
+		if _, err := p.zoneLister.List(ctx, &cfapi.ListRequest{ZoneID: zone.ID}); err != nil {
+			if cfapi.IsAuthError(err) {
+				return &ZoneError{Hostname: hostname, Zone: zone.Name, Err: err, message: fmt.Sprintf(`API token lacks the "SSL and Certificates: Edit" permission on zone %s of hostname %s`, zone.Name, hostname)}
+			}
+
+			return &ZoneError{Hostname: hostname, Zone: zone.Name, Err: err, message: fmt.Sprintf("unable to check access to zone %s of hostname %s", zone.Name, hostname)}
+		}
+		checked[zone.ID] = true
+	}
+
+	return nil
+}
+
+// zoneOf returns the zone of the hostname, or nil if none is found. Zones
+// found, or not, are remembered by name in found.
+func (p *Provisioner) zoneOf(ctx context.Context, hostname string, found map[string]*cfapi.Zone) (*cfapi.Zone, error) {
+	labels := strings.Split(hostname, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+		if zone, ok := found[name]; ok {
+			if zone != nil {
+				return zone, nil
+			}
+
+			continue
+		}
+
+		zones, err := p.zones.Zones(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		found[name] = nil
+		for i := range zones {
+			if zones[i].Name == name {
+				found[name] = &zones[i]
+
+				return &zones[i], nil
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,178 @@
+package provisioners
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/cloudflare/origin-ca-issuer/internal/cfapi"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"github.com/go-logr/logr"
+	"gotest.tools/v3/assert"
+)
+
+// fakeZones resolves a fixed set of zones, and fails to list the
+// certificates of the zones the API token has no permission on.
+type fakeZones struct {
+	zones     []cfapi.Zone
+	forbidden map[string]bool
+	lookups   []string
+}
+
+func (z *fakeZones) Zones(ctx context.Context, name string) ([]cfapi.Zone, error) {
+	z.lookups = append(z.lookups, name)
+
+	var zones []cfapi.Zone
+	for _, zone := range z.zones {
+		if zone.Name == name {
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones, nil
+}
+
+func (z *fakeZones) List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error) {
+	if z.forbidden[req.ZoneID] {
+		return nil, &cfapi.APIError{Code: 9109, Message: "Unauthorized to access requested resource", RayID: "0123456789abcdef-ABC", StatusCode: http.StatusForbidden}
+	}
+
+	return &cfapi.ListResponse{}, nil
+}
+
+func TestSign_ZoneResolution(t *testing.T) {
+	zones := []cfapi.Zone{
+		{ID: "1", Name: "example.com"},
+		{ID: "2", Name: "dev.example.com"},
+		{ID: "3", Name: "example.net"},
+	}
+
+	tests := []struct {
+		name     string
+		dnsNames []string
+		lookups  []string
+		error    string
+	}{
+		{
+			name:     "resolved",
+			dnsNames: []string{"example.com", "*.example.com", "www.example.com"},
+			lookups:  []string{"example.com", "www.example.com"},
+		},
+		{
+			name:     "subdomain zone",
+			dnsNames: []string{"api.dev.example.com"},
+			lookups:  []string{"api.dev.example.com", "dev.example.com"},
+		},
+		{
+			name:     "no zone",
+			dnsNames: []string{"example.com", "example.org"},
+			lookups:  []string{"example.com", "example.org"},
+			error:    "hostname example.org is not in any Cloudflare zone the API token has a permission on",
+		},
+		{
+			name:     "forbidden zone",
+			dnsNames: []string{"example.com", "www.example.net"},
+			lookups:  []string{"example.com", "www.example.net", "example.net"},
+			error:    `API token lacks the "SSL and Certificates: Edit" permission on zone example.net of hostname www.example.net: Cloudflare API Error code=9109 message=Unauthorized to access requested resource ray_id=0123456789abcdef-ABC`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signed := false
+			signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				signed = true
+				return &cfapi.SignResponse{Id: "1"}, nil
+			})
+			// Zones are found with a verification token, while access to
+			// them is checked with the signing credentials.
+			resolver := &fakeZones{zones: zones}
+			signing := &fakeZones{forbidden: map[string]bool{"3": true}}
+
+			provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithZoneResolution(resolver, signing))
+			assert.NilError(t, err)
+
+			req := issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+			)
+
+			_, err = provisioner.Sign(context.Background(), req)
+			assert.DeepEqual(t, resolver.lookups, tt.lookups)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Assert(t, !signed)
+
+				var zoneErr *ZoneError
+				assert.Assert(t, errors.As(err, &zoneErr))
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Assert(t, signed)
+		})
+	}
+}
+
+func TestSign_ActiveZones(t *testing.T) {
+	zones := []cfapi.Zone{
+		{ID: "1", Name: "example.com", Status: cfapi.ZoneStatusActive},
+		{ID: "2", Name: "example.net", Status: cfapi.ZoneStatusActive, Paused: true},
+		{ID: "3", Name: "example.org", Status: "pending"},
+	}
+
+	tests := []struct {
+		name     string
+		dnsNames []string
+		error    string
+	}{
+		{
+			name:     "active",
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "paused",
+			dnsNames: []string{"www.example.com", "www.example.net"},
+			error:    "zone example.net of hostname www.example.net is paused in Cloudflare",
+		},
+		{
+			name:     "pending",
+			dnsNames: []string{"example.org"},
+			error:    "zone example.org of hostname example.org is pending in Cloudflare, rather than active",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signed := false
+			signer := SignerFunc(func(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+				signed = true
+				return &cfapi.SignResponse{Id: "1"}, nil
+			})
+			resolver := &fakeZones{zones: zones}
+
+			provisioner, err := New(signer, v1.RequestTypeOriginECC, logr.Discard(), WithZoneResolution(resolver, resolver), WithActiveZones())
+			assert.NilError(t, err)
+
+			req := issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestDNSNames(tt.dnsNames...),
+			)
+
+			_, err = provisioner.Sign(context.Background(), req)
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				assert.Assert(t, !signed)
+
+				var inactive *ZoneInactiveError
+				assert.Assert(t, errors.As(err, &inactive))
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Assert(t, signed)
+		})
+	}
+}
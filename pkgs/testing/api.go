@@ -0,0 +1,218 @@
+package testing
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/pkgs/cfapi"
+)
+
+// FakeCertificate is the certificate returned by FakeAPI for every signed
+// request, unless SignFunc is set.
+const FakeCertificate = "-----BEGIN CERTIFICATE-----\nfake\n-----END CERTIFICATE-----"
+
+// FakeAPI is a fake Cloudflare API recording every call made to it. Its
+// Factory may be set as the Factory of the controllers.
+//
+// By default every request is signed with FakeCertificate and a sequential
+// certificate ID, and credentials are valid. Certificates signed and not
+// revoked are listed, regardless of the zone. SignErr, VerifyErr, RevokeErr
+// and ListErr make the respective calls fail instead; SignFunc replaces
+// signing entirely. The API types are those of pkgs/cfapi, so that tests
+// outside of this module can name them. Zones are found by name among
+// CloudflareZones.
+//
+// FakeAPI is safe for concurrent use.
+type FakeAPI struct {
+	SignFunc  func(context.Context, *cfapi.SignRequest) (*cfapi.SignResponse, error)
+	SignErr   error
+	VerifyErr error
+	RevokeErr error
+	ListErr   error
+
+	CloudflareZones []cfapi.Zone
+
+	mu          sync.Mutex
+	credentials []cfapi.Credentials
+	signed      []cfapi.SignRequest
+	issued      []cfapi.SignResponse
+	verified    int
+	revoked     []string
+}
+
+// Factory returns a factory creating clients of the fake API, and recording
+// the credentials they were created with.
+func (f *FakeAPI) Factory() cfapi.Factory {
+	return cfapi.FactoryFunc(func(creds cfapi.Credentials) (cfapi.Interface, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.credentials = append(f.credentials, creds)
+
+		return f, nil
+	})
+}
+
+func (f *FakeAPI) Sign(ctx context.Context, req *cfapi.SignRequest) (*cfapi.SignResponse, error) {
+	f.mu.Lock()
+	f.signed = append(f.signed, *req)
+	id := strconv.Itoa(len(f.signed))
+	f.mu.Unlock()
+
+	if f.SignFunc != nil {
+		return f.SignFunc(ctx, req)
+	}
+
+	if f.SignErr != nil {
+		return nil, f.SignErr
+	}
+
+	resp := cfapi.SignResponse{
+		Id:          id,
+		Certificate: FakeCertificate,
+		Hostnames:   req.Hostnames,
+		Expiration:  time.Now().Add(time.Duration(req.Validity) * 24 * time.Hour),
+		Type:        req.Type,
+		Validity:    req.Validity,
+	}
+
+	f.mu.Lock()
+	f.issued = append(f.issued, resp)
+	f.mu.Unlock()
+
+	return &resp, nil
+}
+
+func (f *FakeAPI) Verify(ctx context.Context) error {
+	f.mu.Lock()
+	f.verified++
+	f.mu.Unlock()
+
+	return f.VerifyErr
+}
+
+func (f *FakeAPI) Revoke(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revoked = append(f.revoked, id)
+	if f.RevokeErr != nil {
+		return f.RevokeErr
+	}
+
+	for i, cert := range f.issued {
+		if cert.Id == id {
+			f.issued = append(f.issued[:i:i], f.issued[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (f *FakeAPI) List(ctx context.Context, req *cfapi.ListRequest) (*cfapi.ListResponse, error) {
+	if f.ListErr != nil {
+		return nil, f.ListErr
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	page, perPage := req.Page, req.PerPage
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+
+	start := min((page-1)*perPage, len(f.issued))
+	end := min(start+perPage, len(f.issued))
+
+	return &cfapi.ListResponse{
+		Certificates: append([]cfapi.SignResponse(nil), f.issued[start:end]...),
+		TotalCount:   len(f.issued),
+	}, nil
+}
+
+func (f *FakeAPI) Zones(ctx context.Context, name string) ([]cfapi.Zone, error) {
+	var zones []cfapi.Zone
+	for _, zone := range f.CloudflareZones {
+		if zone.Name == name {
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones, nil
+}
+
+// SignedHostnames returns the hostnames of every sign request, in order.
+func (f *FakeAPI) SignedHostnames() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hostnames := make([][]string, 0, len(f.signed))
+	for _, req := range f.signed {
+		hostnames = append(hostnames, req.Hostnames)
+	}
+
+	return hostnames
+}
+
+// SignedValidities returns the validity in days of every sign request, in
+// order.
+func (f *FakeAPI) SignedValidities() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	validities := make([]int, 0, len(f.signed))
+	for _, req := range f.signed {
+		validities = append(validities, req.Validity)
+	}
+
+	return validities
+}
+
+// Verified returns the number of times credentials were verified.
+func (f *FakeAPI) Verified() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.verified
+}
+
+// Revoked returns the IDs of revoked certificates, in order.
+func (f *FakeAPI) Revoked() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.revoked...)
+}
+
+// ServiceKeys returns the service keys clients were created with, in order.
+func (f *FakeAPI) ServiceKeys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.credentials))
+	for _, creds := range f.credentials {
+		keys = append(keys, string(creds.ServiceKey))
+	}
+
+	return keys
+}
+
+// APITokens returns the API tokens clients were created with, in order.
+func (f *FakeAPI) APITokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tokens := make([]string, 0, len(f.credentials))
+	for _, creds := range f.credentials {
+		tokens = append(tokens, string(creds.APIToken))
+	}
+
+	return tokens
+}
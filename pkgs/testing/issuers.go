@@ -0,0 +1,105 @@
+// Package testing provides fixtures for unit testing code built on top of the
+// OriginIssuer API, such as policies or operators, against realistic objects
+// and a fake Cloudflare API, without a cluster or Cloudflare credentials.
+package testing
+
+import (
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ServiceKeySecretName and ServiceKeySecretKey locate the service key
+	// referenced by the issuers returned by OriginIssuer and
+	// ClusterOriginIssuer.
+	ServiceKeySecretName = "service-key-issuer"
+	ServiceKeySecretKey  = "key"
+
+	// ServiceKey is the service key stored by ServiceKeySecret. It is
+	// well-formed, but not accepted by Cloudflare.
+	ServiceKey = "v1.0-0x00BAB10C"
+)
+
+// IssuerModifier changes the spec or status of an issuer.
+type IssuerModifier func(*v1.OriginIssuerSpec, *v1.OriginIssuerStatus)
+
+// OriginIssuer returns a Ready OriginIssuer authenticating with the service
+// key of ServiceKeySecret, with the modifiers applied.
+func OriginIssuer(namespace, name string, mods ...IssuerModifier) *v1.OriginIssuer {
+	iss := client.NewOriginIssuer(namespace, name, client.WithServiceKeyRef(ServiceKeySecretName, ServiceKeySecretKey))
+	iss.Status = readyStatus()
+
+	for _, mod := range mods {
+		mod(&iss.Spec, &iss.Status)
+	}
+
+	return iss
+}
+
+// ClusterOriginIssuer returns a Ready ClusterOriginIssuer authenticating with
+// the service key of ServiceKeySecret, with the modifiers applied. The secret
+// is expected in the controller's cluster resource namespace.
+func ClusterOriginIssuer(name string, mods ...IssuerModifier) *v1.ClusterOriginIssuer {
+	iss := client.NewClusterOriginIssuer(name, client.WithServiceKeyRef(ServiceKeySecretName, ServiceKeySecretKey))
+	iss.Status = readyStatus()
+
+	for _, mod := range mods {
+		mod(&iss.Spec, &iss.Status)
+	}
+
+	return iss
+}
+
+// SetIssuerSpec applies the client spec options, such as
+// client.WithRequestType or client.WithDualStack.
+func SetIssuerSpec(opts ...client.SpecOption) IssuerModifier {
+	return func(spec *v1.OriginIssuerSpec, _ *v1.OriginIssuerStatus) {
+		for _, opt := range opts {
+			opt(spec)
+		}
+	}
+}
+
+// SetIssuerReadyCondition replaces the Ready condition of the issuer, such as
+// to test against an issuer whose credentials were rejected.
+func SetIssuerReadyCondition(status metav1.ConditionStatus, reason, message string) IssuerModifier {
+	return func(_ *v1.OriginIssuerSpec, s *v1.OriginIssuerStatus) {
+		s.Conditions = []metav1.Condition{
+			{
+				Type:    v1.ConditionReady,
+				Status:  status,
+				Reason:  reason,
+				Message: message,
+			},
+		}
+	}
+}
+
+// ServiceKeySecret returns the secret holding the service key referenced by
+// the issuers returned by OriginIssuer and ClusterOriginIssuer.
+func ServiceKeySecret(namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      ServiceKeySecretName,
+		},
+		Data: map[string][]byte{
+			ServiceKeySecretKey: []byte(ServiceKey),
+		},
+	}
+}
+
+func readyStatus() v1.OriginIssuerStatus {
+	return v1.OriginIssuerStatus{
+		Conditions: []metav1.Condition{
+			{
+				Type:    v1.ConditionReady,
+				Status:  v1.ConditionTrue,
+				Reason:  "Verified",
+				Message: "OriginIssuer verified and ready to sign certificates",
+			},
+		},
+	}
+}
@@ -0,0 +1,61 @@
+package testing
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+)
+
+// CertificateRequest returns a CertificateRequest with an ECDSA CSR for
+// example.com, with the modifiers applied. Modifiers from cert-manager's gen
+// package, such as gen.SetCertificateRequestDuration, may be used as well.
+func CertificateRequest(namespace, name string, mods ...cmgen.CertificateRequestModifier) *cmapi.CertificateRequest {
+	mods = append([]cmgen.CertificateRequestModifier{
+		cmgen.SetCertificateRequestNamespace(namespace),
+		SetCertificateRequestDNSNames("example.com"),
+	}, mods...)
+
+	return cmgen.CertificateRequest(name, mods...)
+}
+
+// SetCertificateRequestDNSNames replaces the CSR of the request with an ECDSA
+// CSR for the DNS names.
+func SetCertificateRequestDNSNames(dnsNames ...string) cmgen.CertificateRequestModifier {
+	return cmgen.SetCertificateRequestCSR(CSR(dnsNames...))
+}
+
+// SetCertificateRequestOriginIssuer references the named OriginIssuer, in the
+// namespace of the request.
+func SetCertificateRequestOriginIssuer(name string) cmgen.CertificateRequestModifier {
+	return cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+		Name:  name,
+		Kind:  "OriginIssuer",
+		Group: v1.GroupVersion.Group,
+	})
+}
+
+// SetCertificateRequestClusterOriginIssuer references the named
+// ClusterOriginIssuer.
+func SetCertificateRequestClusterOriginIssuer(name string) cmgen.CertificateRequestModifier {
+	return cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+		Name:  name,
+		Kind:  "ClusterOriginIssuer",
+		Group: v1.GroupVersion.Group,
+	})
+}
+
+// CSR returns a PEM encoded ECDSA certificate signing request for the DNS
+// names. It panics if the key or request cannot be generated, which is not
+// expected outside of a broken environment.
+func CSR(dnsNames ...string) []byte {
+	csr, _, err := cmgen.CSR(x509.ECDSA, cmgen.SetCSRDNSNames(dnsNames...))
+	if err != nil {
+		panic(fmt.Sprintf("creating CSR: %s", err))
+	}
+
+	return csr
+}
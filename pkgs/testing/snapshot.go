@@ -0,0 +1,80 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AssertStatusSnapshot compares the status of the objects, such as the
+// CertificateRequests and issuers left by a sequence of reconciles, with the
+// golden file testdata/<filename>, so that changes to the wording or ordering
+// of their conditions show up in the diff of the golden file. Timestamps are
+// replaced, as they vary between runs. Run the tests with
+// -test.update-golden to rewrite the golden files.
+func AssertStatusSnapshot(t assert.TestingT, filename string, objs ...client.Object) {
+	if ht, ok := t.(interface{ Helper() }); ok {
+		ht.Helper()
+	}
+
+	snapshot, err := StatusSnapshot(objs...)
+	assert.NilError(t, err)
+
+	golden.Assert(t, snapshot, filename)
+}
+
+// StatusSnapshot returns the statuses of the objects as indented JSON, each
+// headed by a comment naming the object's type and key, with the value of
+// every field named like a timestamp, such as lastTransitionTime, replaced.
+func StatusSnapshot(objs ...client.Object) (string, error) {
+	var b bytes.Buffer
+	for _, obj := range objs {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "# %s %s\n", reflect.TypeOf(obj).Elem().Name(), client.ObjectKeyFromObject(obj))
+
+		// Indented JSON, unlike YAML, never wraps long condition messages.
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(redactTimes(fields["status"])); err != nil {
+			return "", err
+		}
+	}
+
+	return b.String(), nil
+}
+
+// redactTimes replaces the values of the timestamps in the decoded JSON value.
+func redactTimes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if strings.HasSuffix(key, "Time") && field != nil {
+				v[key] = "<time>"
+				continue
+			}
+			v[key] = redactTimes(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactTimes(v[i])
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,138 @@
+package testing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/client"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/controllers"
+	issuertesting "github.com/cloudflare/origin-ca-issuer/pkgs/testing"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestFixtures(t *testing.T) {
+	scheme, err := client.NewScheme()
+	assert.NilError(t, err)
+	assert.NilError(t, cmapi.AddToScheme(scheme))
+
+	tests := []struct {
+		name      string
+		request   *cmapi.CertificateRequest
+		issuer    *v1.OriginIssuer
+		cluster   *v1.ClusterOriginIssuer
+		signErr   error
+		hostnames [][]string
+		validity  []int
+		reason    string
+	}{
+		{
+			name: "origin issuer",
+			request: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+				issuertesting.SetCertificateRequestDNSNames("example.com", "*.example.com"),
+				cmgen.SetCertificateRequestDuration(&metav1.Duration{Duration: 90 * 24 * time.Hour}),
+			),
+			issuer:    issuertesting.OriginIssuer("default", "foobar"),
+			hostnames: [][]string{{"*.example.com", "example.com"}},
+			validity:  []int{90},
+			reason:    cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name: "dual stack cluster origin issuer",
+			request: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestClusterOriginIssuer("foobar"),
+			),
+			cluster:   issuertesting.ClusterOriginIssuer("foobar", issuertesting.SetIssuerSpec(client.WithDualStack())),
+			hostnames: [][]string{{"example.com"}, {"example.com"}},
+			validity:  []int{7, 7},
+			reason:    cmapi.CertificateRequestReasonIssued,
+		},
+		{
+			name: "sign error",
+			request: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			issuer:    issuertesting.OriginIssuer("default", "foobar"),
+			signErr:   errors.New("boom"),
+			hostnames: [][]string{{"example.com"}},
+			validity:  []int{7},
+			reason:    cmapi.CertificateRequestReasonFailed,
+		},
+		{
+			name: "issuer not ready",
+			request: issuertesting.CertificateRequest("default", "foobar",
+				issuertesting.SetCertificateRequestOriginIssuer("foobar"),
+			),
+			issuer: issuertesting.OriginIssuer("default", "foobar",
+				issuertesting.SetIssuerReadyCondition(v1.ConditionFalse, "Error", "bad credentials"),
+			),
+			hostnames: [][]string{},
+			validity:  []int{},
+			reason:    cmapi.CertificateRequestReasonPending,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tt.request, issuertesting.ServiceKeySecret("default"), issuertesting.ServiceKeySecret("cluster")).
+				WithStatusSubresource(&cmapi.CertificateRequest{})
+			if tt.issuer != nil {
+				builder = builder.WithObjects(tt.issuer)
+			}
+			if tt.cluster != nil {
+				builder = builder.WithObjects(tt.cluster)
+			}
+			c := builder.Build()
+
+			api := &issuertesting.FakeAPI{SignErr: tt.signErr}
+			controller := &controllers.CertificateRequestController{
+				Client:                   c,
+				Reader:                   c,
+				ClusterResourceNamespace: "cluster",
+				Log:                      logf.Log,
+				Recorder:                 record.NewFakeRecorder(10),
+				Clock:                    fakeClock.NewFakeClock(time.Now()),
+				Factory:                  api.Factory(),
+			}
+
+			namespaceName := types.NamespacedName{Namespace: "default", Name: "foobar"}
+			_, _ = reconcile.AsReconciler(c, controller).Reconcile(context.Background(), reconcile.Request{NamespacedName: namespaceName})
+
+			assert.DeepEqual(t, api.SignedHostnames(), tt.hostnames)
+			assert.DeepEqual(t, api.SignedValidities(), tt.validity)
+
+			got := &cmapi.CertificateRequest{}
+			assert.NilError(t, c.Get(context.Background(), namespaceName, got))
+			assert.Equal(t, readyReason(got), tt.reason)
+			if tt.reason == cmapi.CertificateRequestReasonIssued {
+				assert.DeepEqual(t, api.ServiceKeys(), []string{issuertesting.ServiceKey})
+			}
+		})
+	}
+}
+
+func readyReason(cr *cmapi.CertificateRequest) string {
+	for _, c := range cr.Status.Conditions {
+		if c.Type == cmapi.CertificateRequestConditionReady && c.Status != cmmeta.ConditionUnknown {
+			return c.Reason
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,237 @@
+// Package tokenexchange retrieves short-lived Cloudflare credentials from a
+// secret broker, in exchange for a token of a Kubernetes ServiceAccount, so
+// that issuers don't need long-lived credentials stored in Secrets.
+//
+// The token is sent to the broker in a POST request, as a bearer token. The
+// broker responds with a JSON object holding either an apiToken or a
+// serviceKey, and the expiresAt time of the credential:
+//
+//	{"apiToken": "...", "expiresAt": "2024-01-02T15:04:05Z"}
+//
+// Tokens are only requested for ServiceAccounts opting in with the
+// AllowTokenRequestsAnnotation, for the fixed Audience, and only exchanged
+// with the https brokers the controller allows.
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	authentication "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+)
+
+// refreshBefore is how long before they expire cached credentials are
+// exchanged again, so that they don't expire during a request.
+const refreshBefore = time.Minute
+
+// DefaultTokenExpiration is the expiration of the ServiceAccount tokens
+// requested, the minimum the TokenRequest API allows.
+const DefaultTokenExpiration = 10 * time.Minute
+
+// Audience of the ServiceAccount tokens exchanged with secret brokers, which
+// brokers must require. It is never the apiserver's, so that brokers can't
+// replay the tokens against the apiserver.
+const Audience = "cert-manager.k8s.cloudflare.com/token-exchange"
+
+// maxResponseSize bounds the size of the broker's responses.
+const maxResponseSize = 64 << 10
+
+// Credentials are the Cloudflare credentials returned by a secret broker.
+// Either the APIToken or the ServiceKey is set.
+type Credentials struct {
+	APIToken   string    `json:"apiToken,omitempty"`
+	ServiceKey string    `json:"serviceKey,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Request selects the ServiceAccount whose token is exchanged, and the
+// broker exchanging it.
+type Request struct {
+	URL            string
+	Namespace      string
+	ServiceAccount string
+}
+
+func (r Request) key() string {
+	return strings.Join([]string{r.URL, r.Namespace, r.ServiceAccount}, "\x00")
+}
+
+// TokenSource provides tokens of ServiceAccounts, valid for the audiences.
+type TokenSource interface {
+	Token(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error) {
+	return f(ctx, namespace, serviceAccount, audiences)
+}
+
+// NewTokenSource returns a TokenSource requesting tokens from the
+// apiserver's TokenRequest API, valid for the given expiration, of
+// ServiceAccounts with the AllowTokenRequestsAnnotation set to "true", as
+// read from the reader.
+func NewTokenSource(c client.Client, reader client.Reader, expiration time.Duration) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error) {
+		seconds := int64(expiration.Seconds())
+		sa := &core.ServiceAccount{}
+		if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: serviceAccount}, sa); err != nil {
+			return "", fmt.Errorf("getting ServiceAccount %s/%s: %w", namespace, serviceAccount, err)
+		}
+
+		if sa.Annotations[v1.AllowTokenRequestsAnnotation] != "true" {
+			return "", fmt.Errorf("ServiceAccount %s/%s must be annotated with %s: \"true\" for the controller to request its tokens", namespace, serviceAccount, v1.AllowTokenRequestsAnnotation)
+		}
+
+		tr := &authentication.TokenRequest{
+			Spec: authentication.TokenRequestSpec{
+				Audiences:         audiences,
+				ExpirationSeconds: &seconds,
+			},
+		}
+
+		if err := c.SubResource("token").Create(ctx, sa, tr); err != nil {
+			return "", fmt.Errorf("requesting token of ServiceAccount %s/%s: %w", namespace, serviceAccount, err)
+		}
+
+		return tr.Status.Token, nil
+	})
+}
+
+// Exchanger exchanges ServiceAccount tokens for Cloudflare credentials, and
+// caches the credentials until shortly before they expire.
+type Exchanger struct {
+	tokens  TokenSource
+	client  *http.Client
+	clock   clock.Clock
+	allowed map[string]bool
+
+	mu     sync.Mutex
+	cached map[string]Credentials
+}
+
+// New returns an Exchanger exchanging tokens of the TokenSource with the
+// HTTP client, with the brokers at the allowed URLs only.
+func New(tokens TokenSource, client *http.Client, clock clock.Clock, allowed []string) *Exchanger {
+	e := &Exchanger{
+		tokens:  tokens,
+		client:  client,
+		clock:   clock,
+		allowed: make(map[string]bool),
+		cached:  make(map[string]Credentials),
+	}
+
+	for _, u := range allowed {
+		e.allowed[NormalizeURL(u)] = true
+	}
+
+	return e
+}
+
+// NormalizeURL returns u without a trailing slash, as compared against the
+// allowed URLs.
+func NormalizeURL(u string) string {
+	return strings.TrimRight(u, "/")
+}
+
+// allow returns an error unless the broker at rawURL is allowed.
+func (e *Exchanger) allow(rawURL string) error {
+	if u, err := url.Parse(rawURL); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("secret broker URL %s must be an https URL", rawURL)
+	}
+
+	if !e.allowed[NormalizeURL(rawURL)] {
+		return fmt.Errorf("secret broker URL %s is not allowed by the controller", rawURL)
+	}
+
+	return nil
+}
+
+// Credentials returns the credentials the broker exchanges for a token of
+// the request's ServiceAccount, from the cache unless they are about to
+// expire.
+func (e *Exchanger) Credentials(ctx context.Context, req Request) (Credentials, error) {
+	if err := e.allow(req.URL); err != nil {
+		return Credentials{}, err
+	}
+
+	key := req.key()
+
+	e.mu.Lock()
+	creds, ok := e.cached[key]
+	e.mu.Unlock()
+
+	if ok && e.clock.Now().Add(refreshBefore).Before(creds.ExpiresAt) {
+		return creds, nil
+	}
+
+	token, err := e.tokens.Token(ctx, req.Namespace, req.ServiceAccount, []string{Audience})
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	creds, err = e.exchange(ctx, req.URL, token)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("exchanging token of ServiceAccount %s/%s with %s: %w", req.Namespace, req.ServiceAccount, req.URL, err)
+	}
+
+	e.mu.Lock()
+	if creds.ExpiresAt.IsZero() {
+		delete(e.cached, key)
+	} else {
+		e.cached[key] = creds
+	}
+	e.mu.Unlock()
+
+	return creds, nil
+}
+
+func (e *Exchanger) exchange(ctx context.Context, url, token string) (Credentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// The body is left out, as the error is reported in the issuer's
+		// status, readable by its tenants.
+		return Credentials{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return Credentials{}, fmt.Errorf("decoding response: %w", err)
+	}
+
+	if (creds.APIToken == "") == (creds.ServiceKey == "") {
+		return Credentials{}, fmt.Errorf("response must hold either an apiToken or a serviceKey")
+	}
+
+	return creds, nil
+}
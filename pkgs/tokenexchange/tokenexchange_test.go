@@ -0,0 +1,138 @@
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	authentication "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakeClock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+)
+
+func TestExchanger(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	var exchanges int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges++
+		assert.Equal(t, r.Method, http.MethodPost)
+
+		switch r.Header.Get("Authorization") {
+		case "Bearer default/origin-ca":
+			_ = json.NewEncoder(w).Encode(Credentials{APIToken: "short-lived", ExpiresAt: clock.Now().Add(time.Hour)})
+		case "Bearer default/no-expiry":
+			_ = json.NewEncoder(w).Encode(Credentials{ServiceKey: "v1.0-key"})
+		case "Bearer default/both":
+			_ = json.NewEncoder(w).Encode(Credentials{APIToken: "token", ServiceKey: "v1.0-key"})
+		default:
+			http.Error(w, "ServiceAccount not allowed", http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	var audiences [][]string
+	tokens := TokenSourceFunc(func(ctx context.Context, namespace, serviceAccount string, aud []string) (string, error) {
+		audiences = append(audiences, aud)
+		if serviceAccount == "missing" {
+			return "", errors.New("serviceaccounts \"missing\" not found")
+		}
+
+		return namespace + "/" + serviceAccount, nil
+	})
+
+	e := New(tokens, srv.Client(), clock, []string{srv.URL + "/"})
+	ctx := context.Background()
+
+	creds, err := e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "origin-ca"})
+	assert.NilError(t, err)
+	assert.Equal(t, creds.APIToken, "short-lived")
+	assert.DeepEqual(t, audiences, [][]string{{Audience}})
+
+	// Cached until shortly before they expire.
+	clock.Step(58 * time.Minute)
+	_, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "origin-ca"})
+	assert.NilError(t, err)
+	assert.Equal(t, exchanges, 1)
+
+	clock.Step(time.Minute)
+	_, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "origin-ca"})
+	assert.NilError(t, err)
+	assert.Equal(t, exchanges, 2)
+
+	// Credentials without an expiry are never cached.
+	creds, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "no-expiry"})
+	assert.NilError(t, err)
+	assert.Equal(t, creds.ServiceKey, "v1.0-key")
+	_, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "no-expiry"})
+	assert.NilError(t, err)
+	assert.Equal(t, exchanges, 4)
+
+	_, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "both"})
+	assert.ErrorContains(t, err, "response must hold either an apiToken or a serviceKey")
+
+	_, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "kube-system", ServiceAccount: "default"})
+	assert.ErrorContains(t, err, "unexpected status 403 Forbidden")
+	assert.Assert(t, !strings.Contains(err.Error(), "ServiceAccount not allowed"))
+
+	_, err = e.Credentials(ctx, Request{URL: srv.URL, Namespace: "default", ServiceAccount: "missing"})
+	assert.Error(t, err, `serviceaccounts "missing" not found`)
+
+	// Only the allowed https brokers are exchanged with.
+	_, err = e.Credentials(ctx, Request{URL: "https://secrets.example.com", Namespace: "default", ServiceAccount: "origin-ca"})
+	assert.Error(t, err, "secret broker URL https://secrets.example.com is not allowed by the controller")
+
+	_, err = e.Credentials(ctx, Request{URL: "http://" + strings.TrimPrefix(srv.URL, "https://"), Namespace: "default", ServiceAccount: "origin-ca"})
+	assert.ErrorContains(t, err, "must be an https URL")
+	assert.Equal(t, exchanges, 6)
+}
+
+func TestNewTokenSource(t *testing.T) {
+	c := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			&core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "origin-ca",
+				Annotations: map[string]string{v1.AllowTokenRequestsAnnotation: "true"},
+			}},
+			&core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "default"}},
+		).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceCreate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, subResourceObj client.Object, opts ...client.SubResourceCreateOption) error {
+				assert.Equal(t, subResource, "token")
+				sa := obj.(*core.ServiceAccount)
+				tr := subResourceObj.(*authentication.TokenRequest)
+				assert.DeepEqual(t, tr.Spec.Audiences, []string{"secrets"})
+				assert.Equal(t, *tr.Spec.ExpirationSeconds, int64(600))
+
+				tr.Status.Token = sa.Namespace + "/" + sa.Name
+
+				return nil
+			},
+		}).
+		Build()
+
+	token, err := NewTokenSource(c, c, DefaultTokenExpiration).Token(context.Background(), "default", "origin-ca", []string{"secrets"})
+	assert.NilError(t, err)
+	assert.Equal(t, token, "default/origin-ca")
+
+	_, err = NewTokenSource(c, c, DefaultTokenExpiration).Token(context.Background(), "default", "default", []string{"secrets"})
+	assert.Error(t, err, `ServiceAccount default/default must be annotated with cert-manager.k8s.cloudflare.com/allow-token-requests: "true" for the controller to request its tokens`)
+
+	_, err = NewTokenSource(c, c, DefaultTokenExpiration).Token(context.Background(), "default", "missing", []string{"secrets"})
+	assert.ErrorContains(t, err, "getting ServiceAccount default/missing")
+}
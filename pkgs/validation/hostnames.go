@@ -0,0 +1,110 @@
+package validation
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// MaxHostnames is the largest number of hostnames Cloudflare signs a
+	// single Origin CA certificate for.
+	MaxHostnames = 200
+
+	// maxHostnameLength is the longest hostname allowed in DNS.
+	maxHostnameLength = 253
+)
+
+// NormalizeHostnames returns the hostnames lowercased, without a trailing
+// dot, and without duplicates, in their original order.
+func NormalizeHostnames(hostnames []string) []string {
+	normalized := make([]string, 0, len(hostnames))
+	seen := make(map[string]bool, len(hostnames))
+
+	for _, hostname := range hostnames {
+		hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+		if seen[hostname] {
+			continue
+		}
+
+		seen[hostname] = true
+		normalized = append(normalized, hostname)
+	}
+
+	return normalized
+}
+
+// ValidateHostnames ensures hostnames requested for an Origin CA certificate
+// are within the constraints of the Cloudflare API: at least one and at most
+// MaxHostnames hostnames, using wildcards only as the whole left-most label,
+// and covering a single level. Cloudflare rejects other requests with a
+// generic hostname error.
+func ValidateHostnames(hostnames []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	switch {
+	case len(hostnames) == 0:
+		errs = append(errs, field.Required(fldPath, "Origin CA certificates must be requested for at least one DNS name"))
+	case len(hostnames) > MaxHostnames:
+		errs = append(errs, field.TooMany(fldPath, len(hostnames), MaxHostnames))
+	}
+
+	for i, hostname := range hostnames {
+		switch {
+		case hostname == "":
+			errs = append(errs, field.Invalid(fldPath.Index(i), hostname, "must not be empty"))
+		case len(hostname) > maxHostnameLength:
+			errs = append(errs, field.TooLong(fldPath.Index(i), hostname, maxHostnameLength))
+		default:
+			if msg := wildcardError(hostname); msg != "" {
+				errs = append(errs, field.Invalid(fldPath.Index(i), hostname, msg))
+			}
+		}
+	}
+
+	return errs
+}
+
+// ValidateCSRSubjectAltNames ensures a certificate request only has the DNS
+// name subject alternative names Origin CA certificates can be issued for.
+func ValidateCSRSubjectAltNames(csr *x509.CertificateRequest, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(csr.IPAddresses) > 0 {
+		errs = append(errs, field.Forbidden(fldPath.Child("ipAddresses"), "Origin CA certificates can only be issued for DNS names"))
+	}
+
+	if len(csr.EmailAddresses) > 0 {
+		errs = append(errs, field.Forbidden(fldPath.Child("emailAddresses"), "Origin CA certificates can only be issued for DNS names"))
+	}
+
+	if len(csr.URIs) > 0 {
+		errs = append(errs, field.Forbidden(fldPath.Child("uris"), "Origin CA certificates can only be issued for DNS names"))
+	}
+
+	return errs
+}
+
+// wildcardError describes the first misplaced wildcard in the hostname, or
+// returns an empty string if there is none.
+func wildcardError(hostname string) string {
+	labels := strings.Split(hostname, ".")
+
+	for i, label := range labels {
+		if !strings.Contains(label, "*") {
+			continue
+		}
+
+		switch {
+		case label != "*":
+			return "wildcard must be an entire label, such as *.example.com"
+		case i == 1 && labels[0] == "*":
+			return "wildcard may only cover one level, such as *.example.com"
+		case i > 0:
+			return "wildcard must be the left-most label"
+		}
+	}
+
+	return ""
+}
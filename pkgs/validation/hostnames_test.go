@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateHostnames(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostnames []string
+		expected  string
+	}{
+		{
+			name:      "plain",
+			hostnames: []string{"example.com", "www.example.com"},
+		},
+		{
+			name:      "wildcard",
+			hostnames: []string{"*.example.com", "*.www.example.com"},
+		},
+		{
+			name:      "nested wildcard",
+			hostnames: []string{"*.*.example.com"},
+			expected:  `dnsNames[0]: Invalid value: "*.*.example.com": wildcard may only cover one level, such as *.example.com`,
+		},
+		{
+			name:      "wildcard not left-most",
+			hostnames: []string{"example.com", "www.*.example.com"},
+			expected:  `dnsNames[1]: Invalid value: "www.*.example.com": wildcard must be the left-most label`,
+		},
+		{
+			name:      "partial wildcard",
+			hostnames: []string{"www*.example.com"},
+			expected:  `dnsNames[0]: Invalid value: "www*.example.com": wildcard must be an entire label, such as *.example.com`,
+		},
+		{
+			name:     "none",
+			expected: "dnsNames: Required value: Origin CA certificates must be requested for at least one DNS name",
+		},
+		{
+			name:      "too many",
+			hostnames: strings.Split(strings.Repeat("example.com ", MaxHostnames+1), " ")[:MaxHostnames+1],
+			expected:  "dnsNames: Too many: 201: must have at most 200 items",
+		},
+		{
+			name:      "too long",
+			hostnames: []string{strings.Repeat("a", 250) + ".com"},
+			expected:  "dnsNames[0]: Too long: must have at most 253 bytes",
+		},
+		{
+			name:      "multiple invalid",
+			hostnames: []string{"*.*.example.com", "www.*.example.com"},
+			expected:  `[dnsNames[0]: Invalid value: "*.*.example.com": wildcard may only cover one level, such as *.example.com, dnsNames[1]: Invalid value: "www.*.example.com": wildcard must be the left-most label]`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateHostnames(tt.hostnames, field.NewPath("dnsNames"))
+			if tt.expected == "" {
+				assert.NilError(t, errs.ToAggregate())
+			} else {
+				assert.Error(t, errs.ToAggregate(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeHostnames(t *testing.T) {
+	got := NormalizeHostnames([]string{"Example.com.", "*.example.com", "example.com", "WWW.example.com"})
+	assert.DeepEqual(t, got, []string{"example.com", "*.example.com", "www.example.com"})
+}
+
+func TestValidateCSRSubjectAltNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		csr      *x509.CertificateRequest
+		expected string
+	}{
+		{
+			name: "dns names",
+			csr:  &x509.CertificateRequest{DNSNames: []string{"example.com"}},
+		},
+		{
+			name: "ip addresses",
+			csr: &x509.CertificateRequest{
+				DNSNames:    []string{"example.com"},
+				IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+			},
+			expected: "request.ipAddresses: Forbidden: Origin CA certificates can only be issued for DNS names",
+		},
+		{
+			name: "email addresses and uris",
+			csr: &x509.CertificateRequest{
+				EmailAddresses: []string{"admin@example.com"},
+				URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com"}},
+			},
+			expected: "[request.emailAddresses: Forbidden: Origin CA certificates can only be issued for DNS names, request.uris: Forbidden: Origin CA certificates can only be issued for DNS names]",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateCSRSubjectAltNames(tt.csr, field.NewPath("request"))
+			if tt.expected == "" {
+				assert.NilError(t, errs.ToAggregate())
+			} else {
+				assert.Error(t, errs.ToAggregate(), tt.expected)
+			}
+		})
+	}
+}
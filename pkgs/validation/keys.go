@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// SupportedCurves are the elliptic curves of the ECDSA keys the Origin CA
+// signs certificates for.
+var SupportedCurves = []string{"P-256", "P-384"}
+
+// ValidateCSRPublicKey ensures a certificate request has an RSA key, or an
+// ECDSA key on one of the SupportedCurves, which the Origin CA can sign
+// certificates for. Others, such as P-521 or Ed25519 keys, are rejected by the
+// Cloudflare API with unhelpful errors.
+func ValidateCSRPublicKey(csr *x509.CertificateRequest, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	switch csr.PublicKeyAlgorithm {
+	case x509.RSA:
+	case x509.ECDSA:
+		key, ok := csr.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+
+		curve := key.Curve.Params().Name
+		if !slices.Contains(SupportedCurves, curve) {
+			errs = append(errs, field.NotSupported(fldPath.Child("publicKey", "curve"), curve, SupportedCurves))
+		}
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("publicKeyAlgorithm"), csr.PublicKeyAlgorithm.String(), []string{x509.RSA.String(), x509.ECDSA.String()}))
+	}
+
+	return errs
+}
+
+// ValidateCSRSignature ensures a certificate request is signed by the key it
+// requests a certificate for, with either an RSA or ECDSA signature, so that
+// CSRs altered after signing are rejected before reaching the Cloudflare API.
+// The public key must have been validated with ValidateCSRPublicKey.
+func ValidateCSRSignature(csr *x509.CertificateRequest, fldPath *field.Path) field.ErrorList {
+	if err := csr.CheckSignature(); err != nil {
+		return field.ErrorList{field.Invalid(fldPath.Child("signature"), csr.SignatureAlgorithm.String(), err.Error())}
+	}
+
+	return nil
+}
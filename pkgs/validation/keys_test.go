@@ -0,0 +1,134 @@
+package validation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateCSRPublicKey(t *testing.T) {
+	ecdsaKey := func(curve elliptic.Curve) crypto.Signer {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		assert.NilError(t, err)
+
+		return key
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name     string
+		key      crypto.Signer
+		expected string
+	}{
+		{
+			name: "rsa",
+			key:  rsaKey,
+		},
+		{
+			name: "p-256",
+			key:  ecdsaKey(elliptic.P256()),
+		},
+		{
+			name: "p-384",
+			key:  ecdsaKey(elliptic.P384()),
+		},
+		{
+			name:     "p-521",
+			key:      ecdsaKey(elliptic.P521()),
+			expected: `request.publicKey.curve: Unsupported value: "P-521": supported values: "P-256", "P-384"`,
+		},
+		{
+			name:     "ed25519",
+			key:      ed25519Key,
+			expected: `request.publicKeyAlgorithm: Unsupported value: "Ed25519": supported values: "RSA", "ECDSA"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, tt.key)
+			assert.NilError(t, err)
+
+			csr, err := x509.ParseCertificateRequest(der)
+			assert.NilError(t, err)
+
+			errs := ValidateCSRPublicKey(csr, field.NewPath("request"))
+			if tt.expected == "" {
+				assert.NilError(t, errs.ToAggregate())
+			} else {
+				assert.Error(t, errs.ToAggregate(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateCSRSignature(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name     string
+		key      crypto.Signer
+		tamper   bool
+		expected string
+	}{
+		{
+			name: "rsa",
+			key:  rsaKey,
+		},
+		{
+			name: "ecdsa",
+			key:  ecdsaKey,
+		},
+		{
+			name:     "tampered rsa",
+			key:      rsaKey,
+			tamper:   true,
+			expected: `request.signature: Invalid value: "SHA256-RSA": crypto/rsa: verification error`,
+		},
+		{
+			name:     "tampered ecdsa",
+			key:      ecdsaKey,
+			tamper:   true,
+			expected: `request.signature: Invalid value: "ECDSA-SHA256": x509: ECDSA verification failure`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, tt.key)
+			assert.NilError(t, err)
+
+			csr, err := x509.ParseCertificateRequest(der)
+			assert.NilError(t, err)
+			if tt.tamper {
+				csr.Signature[len(csr.Signature)-1] ^= 0xff
+			}
+
+			errs := ValidateCSRSignature(csr, field.NewPath("request"))
+			if tt.expected == "" {
+				assert.NilError(t, errs.ToAggregate())
+			} else {
+				assert.Error(t, errs.ToAggregate(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+// Package validation implements validation of the OriginIssuer API types, and
+// of the certificates they are asked to sign. All problems are reported at
+// once, rather than only the first one found.
+package validation
+
+import (
+	"net/url"
+	"strings"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var supportedRequestTypes = []string{
+	string(v1.RequestTypeOriginRSA),
+	string(v1.RequestTypeOriginECC),
+}
+
+var supportedDurationPolicies = []string{
+	string(v1.DurationPolicyClosest),
+	string(v1.DurationPolicyRoundUp),
+	string(v1.DurationPolicyRoundDown),
+	string(v1.DurationPolicyStrict),
+}
+
+var supportedLineEndings = []string{
+	string(v1.LineEndingLF),
+	string(v1.LineEndingCRLF),
+}
+
+var supportedDuplicatePolicies = []string{
+	string(v1.DuplicatePolicyAlwaysNew),
+	string(v1.DuplicatePolicyReuse),
+	string(v1.DuplicatePolicyFail),
+}
+
+// ValidateOriginIssuerSpec ensures required fields are set, and enums are
+// correctly set, on the spec of an OriginIssuer or ClusterOriginIssuer.
+func ValidateOriginIssuerSpec(s v1.OriginIssuerSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateAuthentication(s.Auth, fldPath.Child("auth"))...)
+	errs = append(errs, validateZoneCredentials(s.Auth.Zones, fldPath.Child("auth", "zones"))...)
+	if s.Auth.VerifyTokenRef != nil {
+		errs = append(errs, validateSecretKeySelector(*s.Auth.VerifyTokenRef, fldPath.Child("auth", "verifyTokenRef"))...)
+	}
+
+	switch s.RequestType {
+	case "":
+		errs = append(errs, field.Required(fldPath.Child("requestType"), ""))
+	case v1.RequestTypeOriginRSA, v1.RequestTypeOriginECC:
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("requestType"), s.RequestType, supportedRequestTypes))
+	}
+
+	switch s.DurationPolicy {
+	case "", v1.DurationPolicyClosest, v1.DurationPolicyRoundUp, v1.DurationPolicyRoundDown, v1.DurationPolicyStrict:
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("durationPolicy"), s.DurationPolicy, supportedDurationPolicies))
+	}
+
+	errs = append(errs, validateDurations(s, fldPath)...)
+
+	if s.PEMFormat != nil {
+		switch s.PEMFormat.LineEnding {
+		case "", v1.LineEndingLF, v1.LineEndingCRLF:
+		default:
+			errs = append(errs, field.NotSupported(fldPath.Child("pemFormat", "lineEnding"), s.PEMFormat.LineEnding, supportedLineEndings))
+		}
+	}
+
+	if s.RevokeSuperseded && s.ZoneID == "" {
+		errs = append(errs, field.Required(fldPath.Child("zoneID"), "required to revoke superseded certificates"))
+	}
+
+	if s.CertificateQuota != nil {
+		if s.ZoneID == "" {
+			errs = append(errs, field.Required(fldPath.Child("zoneID"), "required to count the certificates of the quota"))
+		}
+		if s.CertificateQuota.Limit < 1 {
+			errs = append(errs, field.Invalid(fldPath.Child("certificateQuota", "limit"), s.CertificateQuota.Limit, "must be positive"))
+		}
+		if reserve := s.CertificateQuota.Reserve; reserve != nil && (*reserve < 0 || *reserve >= s.CertificateQuota.Limit) {
+			errs = append(errs, field.Invalid(fldPath.Child("certificateQuota", "reserve"), *reserve, "must be at least 0 and less than limit"))
+		}
+	}
+
+	switch s.DuplicatePolicy {
+	case "", v1.DuplicatePolicyAlwaysNew:
+	case v1.DuplicatePolicyReuse, v1.DuplicatePolicyFail:
+		if s.ZoneID == "" {
+			errs = append(errs, field.Required(fldPath.Child("zoneID"), "required to find duplicate certificates"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("duplicatePolicy"), s.DuplicatePolicy, supportedDuplicatePolicies))
+	}
+
+	// Superseded and duplicate certificates of requests signed with a zone
+	// credential are listed in its own zone.
+	if s.RevokeSuperseded || s.DuplicatePolicy == v1.DuplicatePolicyReuse || s.DuplicatePolicy == v1.DuplicatePolicyFail {
+		errs = append(errs, validateZoneCredentialZoneIDs(s.Auth.Zones, fldPath.Child("auth", "zones"))...)
+	}
+
+	switch {
+	case s.WildcardThreshold < 0 || s.WildcardThreshold == 1:
+		errs = append(errs, field.Invalid(fldPath.Child("wildcardThreshold"), s.WildcardThreshold, "must be 0 or at least 2"))
+	case s.CollapseToWildcard && s.WildcardThreshold == 0:
+		errs = append(errs, field.Required(fldPath.Child("wildcardThreshold"), "required to collapse hostnames to wildcards"))
+	}
+
+	// Zones are looked up with the verification token, when set, rather
+	// than with the signing credential.
+	serviceKey := s.Auth.APITokenRef == nil && s.Auth.TokenExchange == nil && s.Auth.VerifyTokenRef == nil &&
+		(s.Auth.Vault == nil || s.Auth.Vault.CredentialType == v1.CredentialTypeServiceKey)
+	if s.ResolveZones && serviceKey {
+		errs = append(errs, field.Invalid(fldPath.Child("resolveZones"), s.ResolveZones, "requires authenticating with an API token, as service keys can't find zones"))
+	}
+	if s.RequireMatchingKeyType && s.DualStack {
+		errs = append(errs, field.Invalid(fldPath.Child("requireMatchingKeyType"), s.RequireMatchingKeyType, "may not be set together with dualStack, which signs each key as both request types"))
+	}
+	if s.RequireActiveZones && !s.ResolveZones {
+		errs = append(errs, field.Required(fldPath.Child("resolveZones"), "required to check the status of zones"))
+	}
+
+	errs = append(errs, validateAllowedDNS(s.AllowedDNSNames, s.AllowedDNSZones, fldPath)...)
+
+	if s.AllowedNamespaces != nil {
+		errs = append(errs, validateAllowedNamespaces(*s.AllowedNamespaces, fldPath.Child("allowedNamespaces"))...)
+	}
+
+	if s.CloudflareAPIURL != "" {
+		if u, err := url.Parse(s.CloudflareAPIURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, field.Invalid(fldPath.Child("cloudflareAPIURL"), s.CloudflareAPIURL, "must be an absolute https URL"))
+		}
+	}
+
+	if s.Canary != nil {
+		if s.Canary.Percent < 1 || s.Canary.Percent > 100 {
+			errs = append(errs, field.Invalid(fldPath.Child("canary", "percent"), s.Canary.Percent, "must be between 1 and 100"))
+		}
+		if s.Canary.Successes < 0 {
+			errs = append(errs, field.Invalid(fldPath.Child("canary", "successes"), s.Canary.Successes, "must not be negative"))
+		}
+	}
+
+	return errs
+}
+
+// ValidateNamespacedOriginIssuerSpec validates the spec of an OriginIssuer,
+// which may not set the fields only supported by ClusterOriginIssuers.
+func ValidateNamespacedOriginIssuerSpec(s v1.OriginIssuerSpec, fldPath *field.Path) field.ErrorList {
+	errs := ValidateOriginIssuerSpec(s, fldPath)
+
+	if s.AllowedNamespaces != nil {
+		errs = append(errs, field.Forbidden(fldPath.Child("allowedNamespaces"), "only supported by ClusterOriginIssuers, as OriginIssuers only sign requests of their own namespace"))
+	}
+
+	return errs
+}
+
+// validateDurations ensures the duration bounds are positive, ordered, and
+// contain the default duration.
+func validateDurations(s v1.OriginIssuerSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for _, d := range []struct {
+		name     string
+		duration *metav1.Duration
+	}{
+		{"minDuration", s.MinDuration},
+		{"maxDuration", s.MaxDuration},
+		{"defaultDuration", s.DefaultDuration},
+	} {
+		if d.duration != nil && d.duration.Duration <= 0 {
+			errs = append(errs, field.Invalid(fldPath.Child(d.name), d.duration.Duration.String(), "must be positive"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if s.MinDuration != nil && s.MaxDuration != nil && s.MinDuration.Duration > s.MaxDuration.Duration {
+		errs = append(errs, field.Invalid(fldPath.Child("minDuration"), s.MinDuration.Duration.String(), "must not be greater than maxDuration"))
+	}
+
+	if s.DefaultDuration != nil {
+		if s.MinDuration != nil && s.DefaultDuration.Duration < s.MinDuration.Duration {
+			errs = append(errs, field.Invalid(fldPath.Child("defaultDuration"), s.DefaultDuration.Duration.String(), "must not be less than minDuration"))
+		}
+
+		if s.MaxDuration != nil && s.DefaultDuration.Duration > s.MaxDuration.Duration {
+			errs = append(errs, field.Invalid(fldPath.Child("defaultDuration"), s.DefaultDuration.Duration.String(), "must not be greater than maxDuration"))
+		}
+	}
+
+	return errs
+}
+
+func validateAuthentication(a v1.OriginIssuerAuthentication, fldPath *field.Path) field.ErrorList {
+	var method string
+	var errs field.ErrorList
+
+	switch {
+	case a.Vault != nil:
+		method = "vault"
+		errs = validateVault(*a.Vault, fldPath.Child("vault"))
+	case a.TokenExchange != nil:
+		method = "tokenExchange"
+		errs = validateTokenExchange(*a.TokenExchange, fldPath.Child("tokenExchange"))
+	case a.APITokenRef != nil:
+		method = "apiTokenRef"
+		errs = validateSecretKeySelector(*a.APITokenRef, fldPath.Child("apiTokenRef"))
+	default:
+		return validateSecretKeySelector(a.ServiceKeyRef, fldPath.Child("serviceKeyRef"))
+	}
+
+	// Methods are listed in the order they take precedence.
+	var forbidden field.ErrorList
+	for _, m := range []struct {
+		name string
+		set  bool
+	}{
+		{"serviceKeyRef", a.ServiceKeyRef != (v1.SecretKeySelector{})},
+		{"apiTokenRef", a.APITokenRef != nil},
+		{"tokenExchange", a.TokenExchange != nil},
+	} {
+		if m.name == method {
+			break
+		}
+
+		if m.set {
+			forbidden = append(forbidden, field.Forbidden(fldPath.Child(m.name), "may not be set together with "+method))
+		}
+	}
+
+	return append(forbidden, errs...)
+}
+
+func validateZoneCredentials(credentials []v1.ZoneCredential, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	seen := make(map[string]bool)
+	for i, credential := range credentials {
+		idxPath := fldPath.Index(i)
+
+		if len(credential.Zones) == 0 {
+			errs = append(errs, field.Required(idxPath.Child("zones"), ""))
+		}
+
+		for j, zone := range credential.Zones {
+			name := strings.ToLower(strings.TrimPrefix(zone, "*."))
+			switch {
+			case len(utilvalidation.IsDNS1123Subdomain(name)) > 0:
+				errs = append(errs, field.Invalid(idxPath.Child("zones").Index(j), zone, "must be a domain name, optionally prefixed with *."))
+			case seen[name]:
+				errs = append(errs, field.Duplicate(idxPath.Child("zones").Index(j), zone))
+			}
+			seen[name] = true
+		}
+
+		switch {
+		case credential.ServiceKeyRef != nil && credential.APITokenRef != nil:
+			errs = append(errs, field.Forbidden(idxPath.Child("serviceKeyRef"), "may not be set together with apiTokenRef"))
+		case credential.ServiceKeyRef != nil:
+			errs = append(errs, validateSecretKeySelector(*credential.ServiceKeyRef, idxPath.Child("serviceKeyRef"))...)
+		case credential.APITokenRef != nil:
+			errs = append(errs, validateSecretKeySelector(*credential.APITokenRef, idxPath.Child("apiTokenRef"))...)
+		default:
+			errs = append(errs, field.Required(idxPath, "one of serviceKeyRef or apiTokenRef must be set"))
+		}
+	}
+
+	return errs
+}
+
+// validateZoneCredentialZoneIDs checks that each zone credential sets the ID
+// of its single zone.
+func validateZoneCredentialZoneIDs(credentials []v1.ZoneCredential, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for i, credential := range credentials {
+		idxPath := fldPath.Index(i)
+
+		if credential.ZoneID == "" {
+			errs = append(errs, field.Required(idxPath.Child("zoneID"), "required to revoke superseded or find duplicate certificates"))
+		}
+
+		names := make(map[string]bool)
+		for _, zone := range credential.Zones {
+			names[strings.ToLower(strings.TrimPrefix(zone, "*."))] = true
+		}
+		if len(names) > 1 {
+			errs = append(errs, field.Invalid(idxPath.Child("zones"), credential.Zones, "must list a single zone to revoke superseded or find duplicate certificates"))
+		}
+	}
+
+	return errs
+}
+
+func validateTokenExchange(t v1.TokenExchange, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	switch u, err := url.Parse(t.URL); {
+	case t.URL == "":
+		errs = append(errs, field.Required(fldPath.Child("url"), ""))
+	case err != nil || u.Scheme != "https" || u.Host == "":
+		errs = append(errs, field.Invalid(fldPath.Child("url"), t.URL, "must be an absolute https URL"))
+	}
+
+	if t.ServiceAccountRef.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("serviceAccountRef", "name"), ""))
+	}
+
+	return errs
+}
+
+var supportedCredentialTypes = []string{
+	string(v1.CredentialTypeAPIToken),
+	string(v1.CredentialTypeServiceKey),
+}
+
+func validateVault(v v1.VaultAuth, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	switch u, err := url.Parse(v.Address); {
+	case v.Address == "":
+		errs = append(errs, field.Required(fldPath.Child("address"), ""))
+	case err != nil || u.Scheme != "https" || u.Host == "":
+		errs = append(errs, field.Invalid(fldPath.Child("address"), v.Address, "must be an absolute https URL"))
+	}
+
+	if v.Role == "" {
+		errs = append(errs, field.Required(fldPath.Child("role"), ""))
+	}
+
+	if v.ServiceAccountRef.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("serviceAccountRef", "name"), ""))
+	}
+
+	if v.Path == "" {
+		errs = append(errs, field.Required(fldPath.Child("path"), ""))
+	}
+
+	if v.Key == "" {
+		errs = append(errs, field.Required(fldPath.Child("key"), ""))
+	}
+
+	switch v.CredentialType {
+	case "", v1.CredentialTypeAPIToken, v1.CredentialTypeServiceKey:
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("credentialType"), v.CredentialType, supportedCredentialTypes))
+	}
+
+	return errs
+}
+
+// validateAllowedNamespaces ensures the names are namespace names, and the
+// selector is valid.
+func validateAllowedNamespaces(a v1.AllowedNamespaces, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(a.Names) == 0 && a.Selector == nil {
+		errs = append(errs, field.Required(fldPath, "names or selector must be set"))
+	}
+
+	for i, name := range a.Names {
+		for _, msg := range utilvalidation.IsDNS1123Label(name) {
+			errs = append(errs, field.Invalid(fldPath.Child("names").Index(i), name, msg))
+		}
+	}
+
+	if a.Selector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(a.Selector, metav1validation.LabelSelectorValidationOptions{}, fldPath.Child("selector"))...)
+	}
+
+	return errs
+}
+
+// validateAllowedDNS ensures the allowed names are hostnames, optionally
+// wildcards, and the allowed zones are domain names, without duplicates.
+func validateAllowedDNS(names, zones []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	seen := make(map[string]bool)
+	for i, name := range names {
+		hostname := strings.ToLower(name)
+		switch {
+		case len(utilvalidation.IsDNS1123Subdomain(strings.TrimPrefix(hostname, "*."))) > 0:
+			errs = append(errs, field.Invalid(fldPath.Child("allowedDNSNames").Index(i), name, "must be a hostname, optionally prefixed with *."))
+		case seen[hostname]:
+			errs = append(errs, field.Duplicate(fldPath.Child("allowedDNSNames").Index(i), name))
+		}
+		seen[hostname] = true
+	}
+
+	seen = make(map[string]bool)
+	for i, zone := range zones {
+		domain := strings.ToLower(zone)
+		switch {
+		case len(utilvalidation.IsDNS1123Subdomain(domain)) > 0:
+			errs = append(errs, field.Invalid(fldPath.Child("allowedDNSZones").Index(i), zone, "must be a domain name"))
+		case seen[domain]:
+			errs = append(errs, field.Duplicate(fldPath.Child("allowedDNSZones").Index(i), zone))
+		}
+		seen[domain] = true
+	}
+
+	return errs
+}
+
+func validateSecretKeySelector(s v1.SecretKeySelector, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if s.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("name"), ""))
+	}
+
+	if s.Key == "" {
+		errs = append(errs, field.Required(fldPath.Child("key"), ""))
+	}
+
+	return errs
+}
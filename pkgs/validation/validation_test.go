@@ -0,0 +1,555 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateOriginIssuerSpec(t *testing.T) {
+	reserve := 200
+
+	tests := []struct {
+		name     string
+		spec     v1.OriginIssuerSpec
+		expected string
+	}{
+		{
+			name: "valid service key",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+			},
+		},
+		{
+			name: "valid api token",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginECC,
+				Auth: v1.OriginIssuerAuthentication{
+					APITokenRef: &v1.SecretKeySelector{Name: "api-token", Key: "token"},
+				},
+			},
+		},
+		{
+			name:     "empty",
+			spec:     v1.OriginIssuerSpec{},
+			expected: "[spec.auth.serviceKeyRef.name: Required value, spec.auth.serviceKeyRef.key: Required value, spec.requestType: Required value]",
+		},
+		{
+			name: "invalid request type",
+			spec: v1.OriginIssuerSpec{
+				RequestType: "OriginDSA",
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+			},
+			expected: `spec.requestType: Unsupported value: "OriginDSA": supported values: "OriginRSA", "OriginECC"`,
+		},
+		{
+			name: "conflicting auth",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					APITokenRef:   &v1.SecretKeySelector{Name: "api-token"},
+				},
+			},
+			expected: "[spec.auth.serviceKeyRef: Forbidden: may not be set together with apiTokenRef, spec.auth.apiTokenRef.key: Required value]",
+		},
+		{
+			name: "valid durations",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				MinDuration:     &metav1.Duration{Duration: 7 * 24 * time.Hour},
+				MaxDuration:     &metav1.Duration{Duration: 90 * 24 * time.Hour},
+				DefaultDuration: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+			},
+		},
+		{
+			name: "negative duration",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				MinDuration: &metav1.Duration{Duration: -time.Hour},
+			},
+			expected: `spec.minDuration: Invalid value: "-1h0m0s": must be positive`,
+		},
+		{
+			name: "inverted durations",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				MinDuration:     &metav1.Duration{Duration: 90 * 24 * time.Hour},
+				MaxDuration:     &metav1.Duration{Duration: 7 * 24 * time.Hour},
+				DefaultDuration: &metav1.Duration{Duration: 365 * 24 * time.Hour},
+			},
+			expected: `[spec.minDuration: Invalid value: "2160h0m0s": must not be greater than maxDuration, spec.defaultDuration: Invalid value: "8760h0m0s": must not be greater than maxDuration]`,
+		},
+		{
+			name: "invalid duration policy",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				DurationPolicy: "Nearest",
+			},
+			expected: `spec.durationPolicy: Unsupported value: "Nearest": supported values: "Closest", "RoundUp", "RoundDown", "Strict"`,
+		},
+		{
+			name: "invalid pem line ending",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				PEMFormat: &v1.PEMFormat{LineEnding: "CR"},
+			},
+			expected: `spec.pemFormat.lineEnding: Unsupported value: "CR": supported values: "LF", "CRLF"`,
+		},
+		{
+			name: "revoke superseded without zone",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				RevokeSuperseded: true,
+			},
+			expected: "spec.zoneID: Required value: required to revoke superseded certificates",
+		},
+		{
+			name: "reuse duplicates without zone",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				DuplicatePolicy: v1.DuplicatePolicyReuse,
+			},
+			expected: "spec.zoneID: Required value: required to find duplicate certificates",
+		},
+		{
+			name: "invalid duplicate policy",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				ZoneID:          "023e105f4ecef8ad9ca31a8372d0c353",
+				DuplicatePolicy: "Skip",
+			},
+			expected: `spec.duplicatePolicy: Unsupported value: "Skip": supported values: "AlwaysNew", "Reuse", "Fail"`,
+		},
+		{
+			name: "wildcard threshold of one",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				WildcardThreshold: 1,
+			},
+			expected: "spec.wildcardThreshold: Invalid value: 1: must be 0 or at least 2",
+		},
+		{
+			name: "collapse to wildcard without threshold",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				CollapseToWildcard: true,
+			},
+			expected: "spec.wildcardThreshold: Required value: required to collapse hostnames to wildcards",
+		},
+		{
+			name: "collapse to wildcard",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				WildcardThreshold:  10,
+				CollapseToWildcard: true,
+			},
+		},
+		{
+			name: "zone credentials",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					Zones: []v1.ZoneCredential{
+						{Zones: []string{"*.example.com"}, APITokenRef: &v1.SecretKeySelector{Name: "example-com", Key: "token"}},
+						{Zones: []string{"example.net", "example.org"}, ServiceKeyRef: &v1.SecretKeySelector{Name: "example-net", Key: "key"}},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid zone credentials",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					Zones: []v1.ZoneCredential{
+						{Zones: []string{"example.com", "-example.net"}},
+						{Zones: []string{"*.example.com"}, ServiceKeyRef: &v1.SecretKeySelector{Name: "example-com", Key: "key"}, APITokenRef: &v1.SecretKeySelector{Name: "example-com", Key: "token"}},
+						{APITokenRef: &v1.SecretKeySelector{Name: "example-org"}},
+					},
+				},
+			},
+			expected: `[spec.auth.zones[0].zones[1]: Invalid value: "-example.net": must be a domain name, optionally prefixed with *., spec.auth.zones[0]: Required value: one of serviceKeyRef or apiTokenRef must be set, spec.auth.zones[1].zones[0]: Duplicate value: "*.example.com", spec.auth.zones[1].serviceKeyRef: Forbidden: may not be set together with apiTokenRef, spec.auth.zones[2].zones: Required value, spec.auth.zones[2].apiTokenRef.key: Required value]`,
+		},
+		{
+			name: "zone credentials revoking superseded certificates",
+			spec: v1.OriginIssuerSpec{
+				RequestType:      v1.RequestTypeOriginRSA,
+				ZoneID:           "issuer-zone",
+				RevokeSuperseded: true,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					Zones: []v1.ZoneCredential{
+						{Zones: []string{"*.example.com"}, ZoneID: "example-com", APITokenRef: &v1.SecretKeySelector{Name: "example-com", Key: "token"}},
+					},
+				},
+			},
+		},
+		{
+			name: "zone credentials without zone IDs",
+			spec: v1.OriginIssuerSpec{
+				RequestType:     v1.RequestTypeOriginRSA,
+				ZoneID:          "issuer-zone",
+				DuplicatePolicy: v1.DuplicatePolicyReuse,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					Zones: []v1.ZoneCredential{
+						{Zones: []string{"example.com"}, APITokenRef: &v1.SecretKeySelector{Name: "example-com", Key: "token"}},
+						{Zones: []string{"example.net", "example.org"}, ZoneID: "example-net", ServiceKeyRef: &v1.SecretKeySelector{Name: "example-net", Key: "key"}},
+					},
+				},
+			},
+			expected: `[spec.auth.zones[0].zoneID: Required value: required to revoke superseded or find duplicate certificates, spec.auth.zones[1].zones: Invalid value: []string{"example.net", "example.org"}: must list a single zone to revoke superseded or find duplicate certificates]`,
+		},
+		{
+			name: "resolve zones",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					APITokenRef: &v1.SecretKeySelector{Name: "api-token", Key: "token"},
+				},
+				ResolveZones: true,
+			},
+		},
+		{
+			name: "resolve zones with service key",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				ResolveZones: true,
+			},
+			expected: "spec.resolveZones: Invalid value: true: requires authenticating with an API token, as service keys can't find zones",
+		},
+		{
+			name: "require matching key type",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginECC,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				RequireMatchingKeyType: true,
+			},
+		},
+		{
+			name: "require matching key type of dual-stack issuer",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginECC,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				DualStack:              true,
+				RequireMatchingKeyType: true,
+			},
+			expected: "spec.requireMatchingKeyType: Invalid value: true: may not be set together with dualStack, which signs each key as both request types",
+		},
+		{
+			name: "resolve zones with service key and verification token",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef:  v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					VerifyTokenRef: &v1.SecretKeySelector{Name: "verify-token", Key: "token"},
+				},
+				ResolveZones: true,
+			},
+		},
+		{
+			name: "verification token without key",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef:  v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					VerifyTokenRef: &v1.SecretKeySelector{Name: "verify-token"},
+				},
+			},
+			expected: "spec.auth.verifyTokenRef.key: Required value",
+		},
+		{
+			name: "require active zones",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					APITokenRef: &v1.SecretKeySelector{Name: "api-token", Key: "token"},
+				},
+				ResolveZones:       true,
+				RequireActiveZones: true,
+			},
+		},
+		{
+			name: "require active zones without resolving zones",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					APITokenRef: &v1.SecretKeySelector{Name: "api-token", Key: "token"},
+				},
+				RequireActiveZones: true,
+			},
+			expected: "spec.resolveZones: Required value: required to check the status of zones",
+		},
+		{
+			name: "cloudflare api url",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				CloudflareAPIURL: "https://cloudflare-mock.e2e.svc:8443",
+			},
+		},
+		{
+			name: "http cloudflare api url",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				CloudflareAPIURL: "http://cloudflare-mock.e2e.svc:8080",
+			},
+			expected: `spec.cloudflareAPIURL: Invalid value: "http://cloudflare-mock.e2e.svc:8080": must be an absolute https URL`,
+		},
+		{
+			name: "relative cloudflare api url",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				CloudflareAPIURL: "api-gateway.example.com",
+			},
+			expected: `spec.cloudflareAPIURL: Invalid value: "api-gateway.example.com": must be an absolute https URL`,
+		},
+		{
+			name: "certificate quota",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				ZoneID:           "023e105f4ecef8ad9ca31a8372d0c353",
+				CertificateQuota: &v1.CertificateQuota{Limit: 200},
+			},
+		},
+		{
+			name: "invalid certificate quota",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				CertificateQuota: &v1.CertificateQuota{Limit: 200, Reserve: &reserve},
+			},
+			expected: "[spec.zoneID: Required value: required to count the certificates of the quota, spec.certificateQuota.reserve: Invalid value: 200: must be at least 0 and less than limit]",
+		},
+		{
+			name: "canary",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				Canary: &v1.Canary{Percent: 10, Successes: 20},
+			},
+		},
+		{
+			name: "invalid canary",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				Canary: &v1.Canary{Percent: 0, Successes: -1},
+			},
+			expected: "[spec.canary.percent: Invalid value: 0: must be between 1 and 100, spec.canary.successes: Invalid value: -1: must not be negative]",
+		},
+		{
+			name: "allowed namespaces",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				AllowedNamespaces: &v1.AllowedNamespaces{
+					Names:    []string{"team-a"},
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}},
+				},
+			},
+		},
+		{
+			name: "empty allowed namespaces",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				AllowedNamespaces: &v1.AllowedNamespaces{},
+			},
+			expected: "spec.allowedNamespaces: Required value: names or selector must be set",
+		},
+		{
+			name: "invalid allowed namespaces",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				AllowedNamespaces: &v1.AllowedNamespaces{
+					Names: []string{"Team_A"},
+					Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "team", Operator: metav1.LabelSelectorOpIn},
+					}},
+				},
+			},
+			expected: `[spec.allowedNamespaces.names[0]: Invalid value: "Team_A": a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?'), spec.allowedNamespaces.selector.matchExpressions[0].values: Required value: must be specified when ` + "`operator`" + ` is 'In' or 'NotIn']`,
+		},
+		{
+			name: "allowed dns",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				AllowedDNSNames: []string{"www.example.net", "*.example.org"},
+				AllowedDNSZones: []string{"example.com"},
+			},
+		},
+		{
+			name: "invalid allowed dns",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+				},
+				AllowedDNSNames: []string{"www.example.net", "WWW.example.net", "a.*.example.org"},
+				AllowedDNSZones: []string{"*.example.com", "example.net", "Example.net"},
+			},
+			expected: `[spec.allowedDNSNames[1]: Duplicate value: "WWW.example.net", spec.allowedDNSNames[2]: Invalid value: "a.*.example.org": must be a hostname, optionally prefixed with *., spec.allowedDNSZones[0]: Invalid value: "*.example.com": must be a domain name, spec.allowedDNSZones[2]: Duplicate value: "Example.net"]`,
+		},
+		{
+			name: "token exchange",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					TokenExchange: &v1.TokenExchange{
+						URL:               "https://secrets.example.com/exchange",
+						ServiceAccountRef: v1.ServiceAccountRef{Name: "origin-ca"},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid token exchange",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					APITokenRef: &v1.SecretKeySelector{Name: "api-token", Key: "token"},
+					TokenExchange: &v1.TokenExchange{
+						URL: "http://secrets.example.com",
+					},
+				},
+			},
+			expected: `[spec.auth.apiTokenRef: Forbidden: may not be set together with tokenExchange, spec.auth.tokenExchange.url: Invalid value: "http://secrets.example.com": must be an absolute https URL, spec.auth.tokenExchange.serviceAccountRef.name: Required value]`,
+		},
+		{
+			name: "vault",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					Vault: &v1.VaultAuth{
+						Address:           "https://vault.example.com:8200",
+						Role:              "origin-ca-issuer",
+						ServiceAccountRef: v1.ServiceAccountRef{Name: "origin-ca"},
+						Path:              "secret/data/cloudflare",
+						Key:               "token",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid vault",
+			spec: v1.OriginIssuerSpec{
+				RequestType: v1.RequestTypeOriginRSA,
+				Auth: v1.OriginIssuerAuthentication{
+					ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+					TokenExchange: &v1.TokenExchange{URL: "https://secrets.example.com/exchange"},
+					Vault: &v1.VaultAuth{
+						Address:        "http://vault.example.com",
+						CredentialType: "Password",
+					},
+				},
+			},
+			expected: `[spec.auth.serviceKeyRef: Forbidden: may not be set together with vault, spec.auth.tokenExchange: Forbidden: may not be set together with vault, spec.auth.vault.address: Invalid value: "http://vault.example.com": must be an absolute https URL, spec.auth.vault.role: Required value, spec.auth.vault.serviceAccountRef.name: Required value, spec.auth.vault.path: Required value, spec.auth.vault.key: Required value, spec.auth.vault.credentialType: Unsupported value: "Password": supported values: "APIToken", "ServiceKey"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateOriginIssuerSpec(tt.spec, field.NewPath("spec"))
+			if tt.expected == "" {
+				assert.Equal(t, len(errs), 0)
+				return
+			}
+
+			assert.Error(t, errs.ToAggregate(), tt.expected)
+		})
+	}
+}
+
+func TestValidateNamespacedOriginIssuerSpec(t *testing.T) {
+	spec := v1.OriginIssuerSpec{
+		RequestType: v1.RequestTypeOriginRSA,
+		Auth: v1.OriginIssuerAuthentication{
+			ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+		},
+	}
+	assert.Equal(t, len(ValidateNamespacedOriginIssuerSpec(spec, field.NewPath("spec"))), 0)
+
+	spec.AllowedNamespaces = &v1.AllowedNamespaces{Names: []string{"team-a"}}
+	assert.Error(t, ValidateNamespacedOriginIssuerSpec(spec, field.NewPath("spec")).ToAggregate(), "spec.allowedNamespaces: Forbidden: only supported by ClusterOriginIssuers, as OriginIssuers only sign requests of their own namespace")
+}
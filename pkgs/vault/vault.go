@@ -0,0 +1,326 @@
+// Package vault reads Cloudflare credentials from HashiCorp Vault, logging in
+// with a token of a Kubernetes ServiceAccount through the Kubernetes or JWT
+// auth method. Vault tokens are cached and renewed until they expire, and
+// secrets cached for their lease, so that signing doesn't call Vault every
+// time.
+//
+// Tokens are only requested for ServiceAccounts opting in with the
+// AllowTokenRequestsAnnotation, for the fixed Audience, and only sent to the
+// https Vault servers the controller allows.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"k8s.io/utils/clock"
+)
+
+// DefaultAuthPath is the mount path of the auth method logged in with when
+// none is set.
+const DefaultAuthPath = "kubernetes"
+
+// Audience of the ServiceAccount tokens logged in to Vault with, which the
+// roles of the auth methods must bind. It is never the apiserver's, so that
+// Vault servers can't replay the tokens against the apiserver.
+const Audience = "cert-manager.k8s.cloudflare.com/vault"
+
+// DefaultSecretTTL is how long secrets without a lease, such as those of KV
+// engines, are cached.
+const DefaultSecretTTL = 5 * time.Minute
+
+// refreshBefore is how long before they expire Vault tokens are renewed, and
+// cached secrets read again.
+const refreshBefore = time.Minute
+
+// maxResponseSize bounds the size of Vault's responses.
+const maxResponseSize = 1 << 20
+
+// Request selects a secret stored in Vault, and how to log in to read it.
+type Request struct {
+	Address string
+
+	// AuthPath is the mount path of the auth method. Defaults to
+	// DefaultAuthPath.
+	AuthPath string
+	Role     string
+
+	// Namespace and ServiceAccount select the ServiceAccount whose token
+	// is logged in with.
+	Namespace      string
+	ServiceAccount string
+
+	Path string
+	Key  string
+}
+
+func (r Request) loginKey() string {
+	return strings.Join([]string{r.Address, r.AuthPath, r.Role, r.Namespace, r.ServiceAccount}, "\x00")
+}
+
+// Error is an error response of Vault.
+type Error struct {
+	StatusCode int      `json:"-"`
+	Errors     []string `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault responded with status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("vault responded with status %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+type login struct {
+	token     string
+	renewable bool
+	expires   time.Time
+}
+
+type secret struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+// Client reads secrets from Vault servers.
+type Client struct {
+	tokens  tokenexchange.TokenSource
+	client  *http.Client
+	clock   clock.Clock
+	allowed map[string]bool
+
+	mu      sync.Mutex
+	logins  map[string]login
+	secrets map[string]secret
+}
+
+// New returns a Client logging in with tokens of the TokenSource, and
+// calling the Vault servers at the allowed addresses only with the HTTP
+// client.
+func New(tokens tokenexchange.TokenSource, client *http.Client, clock clock.Clock, allowed []string) *Client {
+	c := &Client{
+		tokens:  tokens,
+		client:  client,
+		clock:   clock,
+		allowed: make(map[string]bool),
+		logins:  make(map[string]login),
+		secrets: make(map[string]secret),
+	}
+
+	for _, address := range allowed {
+		c.allowed[strings.TrimRight(address, "/")] = true
+	}
+
+	return c
+}
+
+// allow returns an error unless the Vault server at address is allowed.
+func (c *Client) allow(address string) error {
+	if u, err := url.Parse(address); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("vault address %s must be an https URL", address)
+	}
+
+	if !c.allowed[strings.TrimRight(address, "/")] {
+		return fmt.Errorf("vault address %s is not allowed by the controller", address)
+	}
+
+	return nil
+}
+
+// Credential returns the value of the request's key in the secret at its
+// path, from the cache unless its lease is about to expire.
+func (c *Client) Credential(ctx context.Context, req Request) ([]byte, error) {
+	if err := c.allow(req.Address); err != nil {
+		return nil, err
+	}
+
+	if req.AuthPath == "" {
+		req.AuthPath = DefaultAuthPath
+	}
+
+	lk := req.loginKey()
+	sk := lk + "\x00" + req.Path
+
+	c.mu.Lock()
+	s, ok := c.secrets[sk]
+	c.mu.Unlock()
+
+	if !ok || !c.clock.Now().Add(refreshBefore).Before(s.expires) {
+		token, err := c.token(ctx, req, lk)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err = c.read(ctx, req, token)
+		if err != nil {
+			// The token may have been revoked, log in again next time.
+			var verr *Error
+			if errors.As(err, &verr) && verr.StatusCode == http.StatusForbidden {
+				c.mu.Lock()
+				delete(c.logins, lk)
+				c.mu.Unlock()
+			}
+
+			return nil, fmt.Errorf("reading %s from vault: %w", req.Path, err)
+		}
+
+		c.mu.Lock()
+		c.secrets[sk] = s
+		c.mu.Unlock()
+	}
+
+	value, ok := s.data[req.Key].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s does not contain key %q", req.Path, req.Key)
+	}
+
+	return []byte(value), nil
+}
+
+// token returns a Vault token of the request's role, renewing the cached
+// token when it is about to expire, or logging in again.
+func (c *Client) token(ctx context.Context, req Request, key string) (string, error) {
+	c.mu.Lock()
+	l, ok := c.logins[key]
+	c.mu.Unlock()
+
+	now := c.clock.Now()
+	switch {
+	case ok && now.Add(refreshBefore).Before(l.expires):
+		return l.token, nil
+	case ok && l.renewable && now.Before(l.expires):
+		renewed, err := c.authenticate(ctx, req.Address, "auth/token/renew-self", l.token, nil)
+		if err == nil {
+			l = renewed
+			break
+		}
+
+		fallthrough
+	default:
+		jwt, err := c.tokens.Token(ctx, req.Namespace, req.ServiceAccount, []string{Audience})
+		if err != nil {
+			return "", err
+		}
+
+		l, err = c.authenticate(ctx, req.Address, "auth/"+strings.Trim(req.AuthPath, "/")+"/login", "", map[string]string{
+			"role": req.Role,
+			"jwt":  jwt,
+		})
+		if err != nil {
+			return "", fmt.Errorf("logging in to vault as role %s: %w", req.Role, err)
+		}
+	}
+
+	c.mu.Lock()
+	c.logins[key] = l
+	c.mu.Unlock()
+
+	return l.token, nil
+}
+
+// authenticate logs in, or renews a token, returning the token.
+func (c *Client) authenticate(ctx context.Context, address, path, token string, body interface{}) (login, error) {
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+			Renewable     bool   `json:"renewable"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, address, path, token, body, &resp); err != nil {
+		return login{}, err
+	}
+
+	if resp.Auth.ClientToken == "" {
+		return login{}, errors.New("vault response holds no client token")
+	}
+
+	return login{
+		token:     resp.Auth.ClientToken,
+		renewable: resp.Auth.Renewable,
+		expires:   c.clock.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second),
+	}, nil
+}
+
+// read reads a secret of a KV engine, or any secrets engine returning its
+// data as an object. The data of KV version 2 secrets is unwrapped.
+func (c *Client) read(ctx context.Context, req Request, token string) (secret, error) {
+	var resp struct {
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, req.Address, strings.Trim(req.Path, "/"), token, nil, &resp); err != nil {
+		return secret{}, err
+	}
+
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	ttl := time.Duration(resp.LeaseDuration) * time.Second
+	if ttl <= 0 {
+		ttl = DefaultSecretTTL
+	}
+
+	return secret{data: data, expires: c.clock.Now().Add(ttl)}, nil
+}
+
+func (c *Client) do(ctx context.Context, method, address, path, token string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(address, "/")+"/v1/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		verr := &Error{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(data, verr)
+
+		return verr
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding vault response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/origin-ca-issuer/pkgs/tokenexchange"
+	"gotest.tools/v3/assert"
+	fakeClock "k8s.io/utils/clock/testing"
+)
+
+type fakeVault struct {
+	logins, renewals, reads int
+	revoked                 bool
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role"] != "origin-ca-issuer" || body["jwt"] != "default/origin-ca" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+
+			return
+		}
+
+		v.logins++
+		v.revoked = false
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"s.token","lease_duration":600,"renewable":true}}`))
+	case "/v1/auth/token/renew-self":
+		v.renewals++
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"s.token","lease_duration":600,"renewable":true}}`))
+	case "/v1/secret/data/cloudflare":
+		if v.revoked || r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+
+			return
+		}
+
+		v.reads++
+		_, _ = w.Write([]byte(`{"lease_duration":0,"data":{"data":{"token":"api-token"},"metadata":{"version":3}}}`))
+	case "/v1/kv/cloudflare":
+		_, _ = w.Write([]byte(`{"lease_duration":3600,"data":{"service-key":"v1.0-key"}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func TestCredential(t *testing.T) {
+	clock := fakeClock.NewFakeClock(time.Now().Truncate(time.Second))
+
+	v := &fakeVault{}
+	srv := httptest.NewTLSServer(v)
+	defer srv.Close()
+
+	tokens := tokenexchange.TokenSourceFunc(func(ctx context.Context, namespace, serviceAccount string, audiences []string) (string, error) {
+		assert.DeepEqual(t, audiences, []string{Audience})
+		if serviceAccount == "missing" {
+			return "", errors.New(`serviceaccounts "missing" not found`)
+		}
+
+		return namespace + "/" + serviceAccount, nil
+	})
+
+	c := New(tokens, srv.Client(), clock, []string{srv.URL})
+	ctx := context.Background()
+	req := Request{
+		Address:        srv.URL,
+		Role:           "origin-ca-issuer",
+		Namespace:      "default",
+		ServiceAccount: "origin-ca",
+		Path:           "secret/data/cloudflare",
+		Key:            "token",
+	}
+
+	value, err := c.Credential(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "api-token")
+
+	// KV secrets are cached for DefaultSecretTTL.
+	clock.Step(DefaultSecretTTL - refreshBefore - time.Second)
+	_, err = c.Credential(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, v.reads, 1)
+
+	clock.Step(time.Second)
+	_, err = c.Credential(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, v.reads, 2)
+	assert.Equal(t, v.logins, 1)
+
+	// The Vault token is renewed shortly before it expires.
+	clock.Step(5 * time.Minute)
+	_, err = c.Credential(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, v.reads, 3)
+	assert.Equal(t, v.logins, 1)
+	assert.Equal(t, v.renewals, 1)
+
+	// Tokens that expired log in again.
+	clock.Step(20 * time.Minute)
+	_, err = c.Credential(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, v.logins, 2)
+
+	// Revoked tokens log in again on the next read.
+	v.revoked = true
+	clock.Step(DefaultSecretTTL)
+	_, err = c.Credential(ctx, req)
+	assert.Error(t, err, "reading secret/data/cloudflare from vault: vault responded with status 403: permission denied")
+	_, err = c.Credential(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, v.logins, 3)
+
+	value, err = c.Credential(ctx, Request{Address: srv.URL, Role: "origin-ca-issuer", Namespace: "default", ServiceAccount: "origin-ca", Path: "kv/cloudflare", Key: "service-key"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "v1.0-key")
+
+	_, err = c.Credential(ctx, Request{Address: srv.URL, Role: "origin-ca-issuer", Namespace: "default", ServiceAccount: "origin-ca", Path: "kv/cloudflare", Key: "token"})
+	assert.Error(t, err, `vault secret kv/cloudflare does not contain key "token"`)
+
+	_, err = c.Credential(ctx, Request{Address: srv.URL, Role: "admin", Namespace: "default", ServiceAccount: "origin-ca", Path: "kv/cloudflare", Key: "token"})
+	assert.Error(t, err, "logging in to vault as role admin: vault responded with status 403: permission denied")
+
+	_, err = c.Credential(ctx, Request{Address: srv.URL, Role: "origin-ca-issuer", Namespace: "default", ServiceAccount: "missing", Path: "kv/cloudflare", Key: "token"})
+	assert.Error(t, err, `serviceaccounts "missing" not found`)
+
+	_, err = c.Credential(ctx, Request{Address: srv.URL, AuthPath: "jwt", Role: "origin-ca-issuer", Namespace: "default", ServiceAccount: "origin-ca", Path: "kv/cloudflare", Key: "token"})
+	assert.Error(t, err, "logging in to vault as role origin-ca-issuer: vault responded with status 404")
+
+	// Only the allowed https Vault servers are called.
+	_, err = c.Credential(ctx, Request{Address: "https://vault.example.com:8200", Role: "origin-ca-issuer", Namespace: "default", ServiceAccount: "origin-ca", Path: "kv/cloudflare", Key: "service-key"})
+	assert.Error(t, err, "vault address https://vault.example.com:8200 is not allowed by the controller")
+
+	_, err = c.Credential(ctx, Request{Address: "http://" + strings.TrimPrefix(srv.URL, "https://"), Role: "origin-ca-issuer", Namespace: "default", ServiceAccount: "origin-ca", Path: "kv/cloudflare", Key: "service-key"})
+	assert.ErrorContains(t, err, "must be an https URL")
+}
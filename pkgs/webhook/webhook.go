@@ -0,0 +1,142 @@
+// Package webhook implements admission webhooks for OriginIssuers and
+// ClusterOriginIssuers, defaulting omitted fields and rejecting invalid specs
+// when they are created or updated rather than only reporting them in the
+// issuer's status once reconciled.
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"github.com/cloudflare/origin-ca-issuer/pkgs/validation"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//go:generate controller-gen webhook paths=./. output:webhook:artifacts:config=../../deploy/webhook
+
+// +kubebuilder:webhook:path=/mutate-cert-manager-k8s-cloudflare-com-v1-originissuer,mutating=true,failurePolicy=fail,sideEffects=None,groups=cert-manager.k8s.cloudflare.com,resources=originissuers,verbs=create;update,versions=v1,name=originissuers.cert-manager.k8s.cloudflare.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-cert-manager-k8s-cloudflare-com-v1-clusteroriginissuer,mutating=true,failurePolicy=fail,sideEffects=None,groups=cert-manager.k8s.cloudflare.com,resources=clusteroriginissuers,verbs=create;update,versions=v1,name=clusteroriginissuers.cert-manager.k8s.cloudflare.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-cert-manager-k8s-cloudflare-com-v1-originissuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=cert-manager.k8s.cloudflare.com,resources=originissuers,verbs=create;update,versions=v1,name=originissuers.cert-manager.k8s.cloudflare.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-cert-manager-k8s-cloudflare-com-v1-clusteroriginissuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=cert-manager.k8s.cloudflare.com,resources=clusteroriginissuers,verbs=create;update,versions=v1,name=clusteroriginissuers.cert-manager.k8s.cloudflare.com,admissionReviewVersions=v1
+
+// IssuerDefaulter defaults omitted fields of the spec of OriginIssuers and
+// ClusterOriginIssuers.
+type IssuerDefaulter struct {
+	// RequestType is set on issuers without a request type.
+	RequestType v1.RequestType
+}
+
+var _ admission.CustomDefaulter = IssuerDefaulter{}
+
+// Default sets the request type of issuers without one.
+func (d IssuerDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	var spec *v1.OriginIssuerSpec
+	switch iss := obj.(type) {
+	case *v1.OriginIssuer:
+		spec = &iss.Spec
+	case *v1.ClusterOriginIssuer:
+		spec = &iss.Spec
+	default:
+		return fmt.Errorf("expected an OriginIssuer or ClusterOriginIssuer, got %T", obj)
+	}
+
+	if spec.RequestType == "" {
+		spec.RequestType = d.RequestType
+	}
+
+	return nil
+}
+
+// IssuerValidator validates the spec of OriginIssuers and
+// ClusterOriginIssuers.
+type IssuerValidator struct{}
+
+var _ admission.CustomValidator = IssuerValidator{}
+
+// ValidateCreate rejects issuers with an invalid spec.
+func (IssuerValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, validate(obj)
+}
+
+// ValidateUpdate rejects changes to the spec of an issuer leaving it invalid.
+// Updates leaving the spec unchanged are allowed, so that issuers created
+// before the webhook can still be relabeled or finalized.
+func (IssuerValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldSpec, _, err := issuerSpec(oldObj)
+	if err != nil {
+		return nil, err
+	}
+
+	newSpec, _, err := issuerSpec(newObj)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiequality.Semantic.DeepEqual(oldSpec, newSpec) {
+		return nil, nil
+	}
+
+	return nil, validate(newObj)
+}
+
+// ValidateDelete allows every deletion.
+func (IssuerValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// SetupWithManager registers the webhooks with the manager's webhook server,
+// defaulting the request type of issuers without one to requestType.
+func SetupWithManager(mgr manager.Manager, requestType v1.RequestType) error {
+	defaulter := IssuerDefaulter{RequestType: requestType}
+
+	for _, obj := range []runtime.Object{&v1.OriginIssuer{}, &v1.ClusterOriginIssuer{}} {
+		err := builder.WebhookManagedBy(mgr).
+			For(obj).
+			WithDefaulter(defaulter).
+			WithValidator(IssuerValidator{}).
+			Complete()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validate(obj runtime.Object) error {
+	spec, kind, err := issuerSpec(obj)
+	if err != nil {
+		return err
+	}
+
+	validateSpec := validation.ValidateOriginIssuerSpec
+	if kind == "OriginIssuer" {
+		validateSpec = validation.ValidateNamespacedOriginIssuerSpec
+	}
+
+	if errs := validateSpec(spec, field.NewPath("spec")); len(errs) > 0 {
+		name := obj.(interface{ GetName() string }).GetName()
+
+		return apierrors.NewInvalid(v1.GroupVersion.WithKind(kind).GroupKind(), name, errs)
+	}
+
+	return nil
+}
+
+func issuerSpec(obj runtime.Object) (v1.OriginIssuerSpec, string, error) {
+	switch iss := obj.(type) {
+	case *v1.OriginIssuer:
+		return iss.Spec, "OriginIssuer", nil
+	case *v1.ClusterOriginIssuer:
+		return iss.Spec, "ClusterOriginIssuer", nil
+	}
+
+	return v1.OriginIssuerSpec{}, "", fmt.Errorf("expected an OriginIssuer or ClusterOriginIssuer, got %T", obj)
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/cloudflare/origin-ca-issuer/pkgs/apis/v1"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestIssuerValidator(t *testing.T) {
+	valid := v1.OriginIssuerSpec{
+		RequestType: v1.RequestTypeOriginRSA,
+		Auth: v1.OriginIssuerAuthentication{
+			ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+		},
+	}
+
+	invalid := v1.OriginIssuerSpec{
+		RequestType: "OriginDSA",
+		Auth: v1.OriginIssuerAuthentication{
+			ServiceKeyRef: v1.SecretKeySelector{Name: "service-key", Key: "key"},
+			APITokenRef:   &v1.SecretKeySelector{Name: "api-token", Key: "token"},
+		},
+	}
+
+	restricted := valid
+	restricted.AllowedNamespaces = &v1.AllowedNamespaces{Names: []string{"team-a"}}
+
+	issuer := func(spec v1.OriginIssuerSpec, labels map[string]string) *v1.OriginIssuer {
+		return &v1.OriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "foobar", Namespace: "default", Labels: labels},
+			Spec:       spec,
+		}
+	}
+
+	clusterIssuer := func(spec v1.OriginIssuerSpec) *v1.ClusterOriginIssuer {
+		return &v1.ClusterOriginIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+			Spec:       spec,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		old    runtime.Object
+		new    runtime.Object
+		delete bool
+		error  string
+	}{
+		{
+			name: "create valid OriginIssuer",
+			new:  issuer(valid, nil),
+		},
+		{
+			name:  "create invalid OriginIssuer",
+			new:   issuer(invalid, nil),
+			error: `OriginIssuer.cert-manager.k8s.cloudflare.com "foobar" is invalid: [spec.auth.serviceKeyRef: Forbidden: may not be set together with apiTokenRef, spec.requestType: Unsupported value: "OriginDSA": supported values: "OriginRSA", "OriginECC"]`,
+		},
+		{
+			name:  "create ClusterOriginIssuer without auth",
+			new:   clusterIssuer(v1.OriginIssuerSpec{RequestType: v1.RequestTypeOriginECC}),
+			error: `ClusterOriginIssuer.cert-manager.k8s.cloudflare.com "foobar" is invalid: [spec.auth.serviceKeyRef.name: Required value, spec.auth.serviceKeyRef.key: Required value]`,
+		},
+		{
+			name: "create ClusterOriginIssuer with allowed namespaces",
+			new:  clusterIssuer(restricted),
+		},
+		{
+			name:  "create OriginIssuer with allowed namespaces",
+			new:   issuer(restricted, nil),
+			error: `OriginIssuer.cert-manager.k8s.cloudflare.com "foobar" is invalid: spec.allowedNamespaces: Forbidden: only supported by ClusterOriginIssuers, as OriginIssuers only sign requests of their own namespace`,
+		},
+		{
+			name: "update valid OriginIssuer",
+			old:  issuer(invalid, nil),
+			new:  issuer(valid, nil),
+		},
+		{
+			name:  "update invalid ClusterOriginIssuer",
+			old:   clusterIssuer(valid),
+			new:   clusterIssuer(invalid),
+			error: `ClusterOriginIssuer.cert-manager.k8s.cloudflare.com "foobar" is invalid: [spec.auth.serviceKeyRef: Forbidden: may not be set together with apiTokenRef, spec.requestType: Unsupported value: "OriginDSA": supported values: "OriginRSA", "OriginECC"]`,
+		},
+		{
+			name: "update invalid OriginIssuer without changing spec",
+			old:  issuer(invalid, nil),
+			new:  issuer(invalid, map[string]string{"team": "edge"}),
+		},
+		{
+			name:   "delete invalid OriginIssuer",
+			old:    issuer(invalid, nil),
+			delete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				v   IssuerValidator
+				err error
+				ctx = context.Background()
+			)
+
+			switch {
+			case tt.delete:
+				_, err = v.ValidateDelete(ctx, tt.old)
+			case tt.old != nil:
+				_, err = v.ValidateUpdate(ctx, tt.old, tt.new)
+			default:
+				_, err = v.ValidateCreate(ctx, tt.new)
+			}
+
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
+				return
+			}
+
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestIssuerDefaulter(t *testing.T) {
+	tests := []struct {
+		name     string
+		obj      runtime.Object
+		expected v1.RequestType
+	}{
+		{
+			name:     "OriginIssuer without request type",
+			obj:      &v1.OriginIssuer{},
+			expected: v1.RequestTypeOriginECC,
+		},
+		{
+			name:     "ClusterOriginIssuer without request type",
+			obj:      &v1.ClusterOriginIssuer{},
+			expected: v1.RequestTypeOriginECC,
+		},
+		{
+			name:     "OriginIssuer with request type",
+			obj:      &v1.OriginIssuer{Spec: v1.OriginIssuerSpec{RequestType: v1.RequestTypeOriginRSA}},
+			expected: v1.RequestTypeOriginRSA,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d := IssuerDefaulter{RequestType: v1.RequestTypeOriginECC}
+			assert.NilError(t, d.Default(context.Background(), tt.obj))
+
+			spec, _, err := issuerSpec(tt.obj)
+			assert.NilError(t, err)
+			assert.Equal(t, spec.RequestType, tt.expected)
+		})
+	}
+}